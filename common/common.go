@@ -1,11 +1,17 @@
 package common
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
+	"hash"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -75,6 +81,27 @@ func (e *InternalError) Error() string {
 	return e.Message
 }
 
+// NotLeader is the error returned by a CSS instance that isn't the leader (a replica) for requests that only the leader can handle
+type NotLeader struct {
+	Message string
+
+	// LeaderAddress is the advertised address of the leader, empty if it isn't known
+	LeaderAddress string
+}
+
+func (e *NotLeader) Error() string {
+	if e.LeaderAddress == "" {
+		return e.Message
+	}
+	return e.Message + " The leader is at " + e.LeaderAddress
+}
+
+// IsNotLeader returns true if the error passed in is the common.NotLeader error
+func IsNotLeader(err error) bool {
+	_, ok := err.(*NotLeader)
+	return ok
+}
+
 // NotFound is the error returned if an object wasn't found
 type NotFound struct {
 	message string
@@ -119,6 +146,48 @@ type Destination struct {
 	// CodeVersion is the sync service code version used by the destination
 	//   required: true
 	CodeVersion string `json:"codeVersion" bson:"code-version"`
+
+	// MaxObjectVersion is the newest version of objects' formats that the applications on the destination can use,
+	// as reported by the destination when it registered. Empty if the destination didn't report it.
+	MaxObjectVersion string `json:"maxObjectVersion,omitempty" bson:"max-object-version,omitempty"`
+
+	// AvailableSpace is the storage space, in bytes, that was available for objects' data on the destination,
+	// as reported by the destination when it last registered, pinged, or sent a heartbeat.
+	// Zero if the destination didn't report it.
+	AvailableSpace int64 `json:"availableSpace,omitempty" bson:"available-space,omitempty"`
+
+	// CompressionAlgorithms is a comma separated list of the compression algorithms of data messages that the destination
+	// supports, as reported by the destination when it registered. Empty if the destination doesn't support compression.
+	CompressionAlgorithms string `json:"compressionAlgorithms,omitempty" bson:"compression-algorithms,omitempty"`
+
+	// DataTopics is the number of MQTT topics across which the destination receives the chunks of the data of objects,
+	// as reported by the destination when it registered. Zero if the destination didn't report it.
+	DataTopics int `json:"dataTopics,omitempty" bson:"data-topics,omitempty"`
+
+	// Attributes are the runtime attributes of the destination, such as its firmware version or region,
+	// as reported by the destination when it last registered. Objects can be targeted at the destinations
+	// with some attributes (see DestinationAttributes in the object's metadata).
+	Attributes map[string]string `json:"attributes,omitempty" bson:"attributes,omitempty"`
+}
+
+// DestinationInfo describes a destination, the time it was last seen by the CSS, the message version used with it,
+// whether sending data to it is paused, and whether it is offline
+// swagger:model
+type DestinationInfo struct {
+	Destination
+
+	// LastSeen is the time the CSS last received a registration, ping, or heartbeat from the destination
+	LastSeen time.Time `json:"lastSeen"`
+
+	// MessageVersion is the message version negotiated with the destination when it registered
+	MessageVersion SyncServiceVersion `json:"messageVersion"`
+
+	// Paused is true if sending data to the destination was paused by an operator
+	Paused bool `json:"paused"`
+
+	// Offline is true if the destination wasn't seen for longer than the DestinationOfflineTimeout. The notifications
+	// to an offline destination are suspended until it registers again.
+	Offline bool `json:"offline"`
 }
 
 // PolicyProperty is a property in a policy
@@ -268,13 +337,29 @@ type MetaData struct {
 	// This field is ignored when working with ESS (the destination is always the CSS).
 	DestinationsList []string `json:"destinationsList" bson:"destinations-list"`
 
+	// DestGroup is the name of a destination group to send the object to.
+	// The object is sent to the destinations that are members of the group when it is sent, and to destinations
+	// that join the group later.
+	// When a DestGroup is provided DestinationsList, DestinationPolicy, DestType, and DestID must be omitted.
+	// This field is available only when working with the CSS.
+	DestGroup string `json:"destinationGroup" bson:"destination-group"`
+
+	// DestinationAttributes is a selector of the destinations to send the object to by their runtime attributes.
+	// The object is sent only to the destinations, out of the destinations set by the other destination fields,
+	// that reported all of these attributes with these values when they registered. A destination whose attributes
+	// change when it registers again gets the objects that now match its attributes.
+	// When DestinationAttributes are provided DestinationPolicy must be omitted.
+	// This field is available only when working with the CSS.
+	// Optional field, if omitted the object is sent regardless of the destinations' attributes.
+	DestinationAttributes map[string]string `json:"destinationAttributes,omitempty" bson:"destination-attributes,omitempty"`
+
 	// DestinationPolicy is the policy specification that should be used to distribute this object
 	// to the appropriate set of destinations.
 	// When a DestinationPolicy is provided DestinationsList, DestType, and DestID must be omitted.
 	DestinationPolicy *Policy `json:"destinationPolicy" bson:"destination-policy"`
 
 	// Expiration is a timestamp/date indicating when the object expires.
-	// When the object expires it is automatically deleted.
+	// When the object expires it is automatically deleted, and the destinations it was delivered to are notified.
 	// The timestamp should be provided in RFC3339 format.
 	// This field is available only when working with the CSS.
 	// Optional field, if omitted the object doesn't expire.
@@ -289,7 +374,8 @@ type MetaData struct {
 	Description string `json:"description" bson:"description"`
 
 	// Link is a link to where the data for this object can be fetched from.
-	// The link is set and used by the application. The sync service does not access the link.
+	// The link is set and used by the application. The sync service does not access the link, unless the receiving
+	// node is configured to fetch the linked data (see FetchLinkedData).
 	// Optional field, if omitted the data must be provided by the application.
 	Link string `json:"link" bson:"link"`
 
@@ -341,6 +427,17 @@ type MetaData struct {
 	// Read only field, should not be set by users.
 	OriginType string `json:"originType" bson:"origin-type"`
 
+	// OriginChain is the list of the nodes that the object was relayed through, starting at the node that created it
+	// and ending at the node it was received from (OriginType/OriginID). Each receiver appends the sender of the object.
+	// Read only field, should not be set by users.
+	OriginChain []OriginHop `json:"originChain,omitempty" bson:"origin-chain,omitempty"`
+
+	// TraceID is the correlation ID of the object's transfers. It is generated when the object is created or updated by
+	// an application, unless the application provides it, and is kept when the object is relayed.
+	// The trace messages of the object's transfers on all the nodes include it, so that they are found by the trace ID.
+	// Optional field, if omitted a trace ID is generated.
+	TraceID string `json:"traceID,omitempty" bson:"trace-id,omitempty"`
+
 	// Deleted is a flag indicating to applications polling for updates that this object has been deleted.
 	// Read only field, should not be set by users.
 	Deleted bool `json:"deleted" bson:"deleted"`
@@ -349,6 +446,10 @@ type MetaData struct {
 	// This field should not be set by users.
 	InstanceID int64 `json:"instanceID" bson:"instance-id"`
 
+	// InstanceSequence is an internal sequence number of the instance, incremented by the origin on every update of the object.
+	// This field should not be set by users.
+	InstanceSequence int64 `json:"instanceSequence" bson:"instance-sequence"`
+
 	// DataID is an internal data ID.
 	// This field should not be set by users.
 	DataID int64 `json:"dataID" bson:"data-id"`
@@ -357,13 +458,115 @@ type MetaData struct {
 	// This field should not be set by users.
 	ObjectSize int64 `json:"objectSize" bson:"object-size"`
 
-	// ChunkSize is an internal field indicating the maximal message payload size.
+	// ChunkSize is an internal field indicating the size of the chunks that the object's data is requested in
+	// (see ObjectChunkSize in the configuration). A data message may carry several chunks or a part of a chunk.
 	// This field should not be set by users.
 	ChunkSize int `json:"chunkSize" bson:"chunk-size"`
 
 	// OwnerID is an internal field indicating who creates the object
 	// This field should not be set by users
 	OwnerID string `json:"ownerID" bson:"owner-id"`
+
+	// Hash is the hex encoded hash of the object's data.
+	// When Hash is set, the receiver verifies the fully assembled data against it before marking the object as received.
+	// If the verification fails, the data is requested again from the beginning.
+	// Optional field, if omitted the data is not verified.
+	Hash string `json:"hash" bson:"hash"`
+
+	// HashAlgorithm is the algorithm used to calculate Hash.
+	// The supported algorithms are sha1, sha256, and sha512.
+	// Optional field, if omitted the node's DefaultHashAlgorithm is used.
+	HashAlgorithm string `json:"hashAlgorithm" bson:"hash-algorithm"`
+
+	// Signature is the base64 encoded detached signature of the object's data. The signature is of the hash of the data,
+	// calculated with HashAlgorithm, using RSA PKCS #1 v1.5 or ECDSA (ASN.1 encoded).
+	// The receiver verifies the fully assembled data against it with the public key of the organization, if the organization has
+	// a public key (see SignaturePublicKeysPath in the configuration). Objects whose signature doesn't match their data are rejected.
+	// Optional field, required only by receivers that have a public key of the organization.
+	Signature string `json:"signature,omitempty" bson:"signature,omitempty"`
+
+	// PatchRanges is a list of the byte ranges of the object's data that changed in this update.
+	// When PatchRanges is set, receivers that hold the previous version of the data request only the chunks covering these
+	// ranges (and any data appended beyond the previous size), and keep the rest of their stored data.
+	// Receivers that don't hold the previous version of the data request all of it.
+	// Optional field, if omitted the whole data is sent.
+	PatchRanges []ByteRange `json:"patchRanges" bson:"patch-ranges"`
+
+	// PatchBaseDataID is an internal field indicating the data ID of the data that PatchRanges apply to.
+	// This field should not be set by users.
+	PatchBaseDataID int64 `json:"patchBaseDataID" bson:"patch-base-data-id"`
+
+	// DataURL is an internal field with a presigned URL from which the receiver downloads the object's data directly,
+	// instead of requesting it in chunks. It is set by the sender in the update notifications of objects larger than
+	// OutOfBandTransferThreshold, and isn't stored by the receiver.
+	// This field should not be set by users.
+	DataURL string `json:"dataURL,omitempty" bson:"data-url,omitempty"`
+
+	// OrderSequence is an internal field with the sequence number of the update among the updates of the objects of the type
+	// that were sent to the destination, if the type is delivered in order (see OrderedObjectTypes in the configuration).
+	// This field should not be set by users.
+	OrderSequence int64 `json:"orderSequence,omitempty" bson:"order-sequence,omitempty"`
+
+	// OrderBase is an internal field with the lowest order sequence number of the updates of the objects of the type that
+	// haven't been delivered to the destination when the notification was sent. The receiver doesn't wait for the updates
+	// before it, which were delivered or superseded.
+	// This field should not be set by users.
+	OrderBase int64 `json:"orderBase,omitempty" bson:"order-base,omitempty"`
+
+	// Priority is the priority class of the transfer of the object's data, either 0 (normal) or 1 (high).
+	// While the data of high priority objects is being received, the chunks of normal priority objects
+	// are requested at a lower rate (see PriorityWeight in the configuration).
+	// Optional field, if omitted the priority is normal.
+	Priority int `json:"priority" bson:"priority"`
+
+	// DeliverBy is a timestamp/date by which the object should be received by its destinations.
+	// The destinations that didn't receive the object by then are reported in notification events with the
+	// DeliveryOverdue status, and the object's priority is raised if EscalateOverdueObjects is set in the configuration.
+	// The timestamp should be provided in RFC3339 format.
+	// This field is available only when working with the CSS.
+	// Optional field, if omitted the object has no delivery deadline.
+	DeliverBy string `json:"deliverBy,omitempty" bson:"deliver-by,omitempty"`
+
+	// QoS is the MQTT quality of service (0, 1, or 2) of the messages of the object, including its data.
+	// Loss tolerant objects can use QoS 0, the chunks of their data that are lost are requested again.
+	// Optional field, if omitted the QoS in the configuration (MQTTQoS) is used.
+	QoS *int `json:"qos,omitempty" bson:"qos,omitempty"`
+
+	// RequiredVersion is the version (major.minor) of objects' formats that destinations must support to use the object.
+	// The object is not sent to destinations that reported an older MaxObjectVersion, or didn't report it, when they registered.
+	// Optional field, if omitted the object is sent to all its destinations.
+	RequiredVersion string `json:"requiredVersion,omitempty" bson:"required-version,omitempty"`
+
+	// Transfer describes the transfer of the object's data that was just completed.
+	// It is set only in the payload of the webhooks called when the object's data is received.
+	Transfer *TransferInfo `json:"transfer,omitempty" bson:"transfer,omitempty"`
+
+	// SchemaVersion is the version of the meta data's schema, set by the sync service (see MetaDataSchemaVersion).
+	// Meta data of an older schema is upgraded when it is received or retrieved from the storage.
+	// Optional field, ignored if set by the application.
+	SchemaVersion int `json:"schemaVersion,omitempty" bson:"schema-version,omitempty"`
+}
+
+// OriginHop identifies a node that an object was relayed through
+type OriginHop struct {
+	Type string `json:"type" bson:"type"`
+	ID   string `json:"id" bson:"id"`
+}
+
+// Priority classes of the transfers of objects' data
+const (
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// ByteRange describes a range of bytes of an object's data
+// swagger:model
+type ByteRange struct {
+	// Offset is the offset of the first byte of the range
+	Offset int64 `json:"offset" bson:"offset"`
+
+	// Length is the number of bytes in the range
+	Length int64 `json:"length" bson:"length"`
 }
 
 // ChunkInfo describes chunks for multi-inflight data transfer.
@@ -375,23 +578,53 @@ type ChunkInfo struct {
 // Notification is used to store notifications in the store
 // swagger:ignore
 type Notification struct {
-	ObjectID   string `json:"objectID" bson:"object-id"`
-	ObjectType string `json:"objectType" bson:"object-type"`
-	DestOrgID  string `json:"destinationOrgID" bson:"destination-org-id"`
-	DestID     string `json:"destinationID" bson:"destination-id"`
-	DestType   string `json:"destinationType" bson:"destination-type"`
-	Status     string `json:"status" bson:"status"`
-	InstanceID int64  `json:"instanceID" bson:"instance-id"`
-	DataID     int64  `json:"dataID" bson:"data-id"`
-	ResendTime int64  `json:"resendTime" bson:"resend-time"`
+	ObjectID         string `json:"objectID" bson:"object-id"`
+	ObjectType       string `json:"objectType" bson:"object-type"`
+	DestOrgID        string `json:"destinationOrgID" bson:"destination-org-id"`
+	DestID           string `json:"destinationID" bson:"destination-id"`
+	DestType         string `json:"destinationType" bson:"destination-type"`
+	Status           string `json:"status" bson:"status"`
+	InstanceID       int64  `json:"instanceID" bson:"instance-id"`
+	InstanceSequence int64  `json:"instanceSequence" bson:"instance-sequence"`
+	DataID           int64  `json:"dataID" bson:"data-id"`
+	ResendTime       int64  `json:"resendTime" bson:"resend-time"`
+
+	// OrderSequence is the order sequence number of the update, or 0 if the object's type isn't delivered in order
+	OrderSequence int64 `json:"orderSequence,omitempty" bson:"order-sequence,omitempty"`
+
+	// CreationTime is the time (in seconds since the epoch) at which the record of the instance was created,
+	// or 0 if it wasn't recorded (see Config.NotificationMaxAge)
+	CreationTime int64 `json:"creationTime" bson:"creation-time"`
+}
+
+// CompareInstances compares two instances of an object.
+// It returns -1 if the first instance is older than the second one, 0 if they are the same instance,
+// and 1 if the first instance is newer than the second one.
+// Instances are ordered by their instance sequence, which the origin of the object increments on every update
+// and therefore doesn't depend on the origin's clock. Instances with the same sequence are ordered by their instance IDs.
+// If either of the sequences is 0 (the instance was created by an older version), only the instance IDs are compared.
+func CompareInstances(instanceID1 int64, sequence1 int64, instanceID2 int64, sequence2 int64) int {
+	if sequence1 != 0 && sequence2 != 0 && sequence1 != sequence2 {
+		if sequence1 < sequence2 {
+			return -1
+		}
+		return 1
+	}
+	if instanceID1 < instanceID2 {
+		return -1
+	} else if instanceID1 > instanceID2 {
+		return 1
+	}
+	return 0
 }
 
 // StoreDestinationStatus is the information about destinations and their status for an object
 // swagger:ignore
 type StoreDestinationStatus struct {
-	Destination Destination `bson:"destination"`
-	Status      string      `bson:"status"`
-	Message     string      `bson:"message"`
+	Destination    Destination `bson:"destination"`
+	Status         string      `bson:"status"`
+	Message        string      `bson:"message"`
+	ConsumedOffset int64       `bson:"consumed-offset"`
 }
 
 // DestinationsStatus describes the delivery status of an object for a destination
@@ -404,6 +637,7 @@ type StoreDestinationStatus struct {
 //   consumed - indicates that the object was consumed by this destination
 //   deleted - indicates that this destination acknowledged the deletion of the object
 //   error - indicates that a feedback error message was received from this destination
+//   rejected - indicates that the admission policy of this destination rejected the object
 // swagger:model
 type DestinationsStatus struct {
 	// DestType is the destination type
@@ -416,22 +650,29 @@ type DestinationsStatus struct {
 
 	// Status is the destination status
 	//   required: true
-	//   enum: pending,delivering,delivered,consumed,deleted,error
+	//   enum: pending,delivering,delivered,consumed,deleted,error,rejected
 	Status string `json:"status"`
 
 	// Message is the message for the destination
 	//    required: false
 	Message string `json:"message"`
+
+	// ConsumedOffset is the offset up to which the destination reported that it consumed the object's data,
+	// before it consumed the whole object
+	//    required: false
+	ConsumedOffset int64 `json:"consumedOffset,omitempty"`
 }
 
 // ObjectStatus describes the delivery status of an object for a destination
 // The status can be one of the following:
 // Indication whether the object has been delivered to the destination
+//   pending - indicates that the object is pending delivery, its notification wasn't sent yet
 //   delivering - indicates that the object is being delivered
 //   delivered - indicates that the object was delivered
 //   consumed - indicates that the object was consumed
 //   deleted - indicates that this destination acknowledged the deletion of the object
 //   error - indicates that a feedback error message was received
+//   rejected - indicates that the admission policy of the destination rejected the object
 // swagger:model
 type ObjectStatus struct {
 	// OrgID is the organization ID of the organization
@@ -447,10 +688,128 @@ type ObjectStatus struct {
 
 	// Status is the object status for this destination
 	//   required: true
-	//   enum: delivering,delivered,consumed,deleted,error
+	//   enum: pending,delivering,delivered,consumed,deleted,error,rejected
 	Status string `json:"status"`
 }
 
+// ObjectDeliveryStatus summarizes the delivery of an object to its destinations
+// swagger:model
+type ObjectDeliveryStatus struct {
+	// Destinations are the destinations of the object and the delivery status of the object for each of them
+	Destinations []DestinationsStatus `json:"destinations"`
+
+	// Pending is the number of destinations to which the object is pending delivery or is being delivered
+	Pending int `json:"pending"`
+
+	// Delivered is the number of destinations that received the object and didn't consume it yet
+	Delivered int `json:"delivered"`
+
+	// Consumed is the number of destinations that consumed the object
+	Consumed int `json:"consumed"`
+
+	// Deleted is the number of destinations that acknowledged the deletion of the object
+	Deleted int `json:"deleted"`
+
+	// Error is the number of destinations from which a feedback error message was received
+	Error int `json:"error"`
+
+	// Rejected is the number of destinations whose admission policy rejected the object
+	Rejected int `json:"rejected"`
+}
+
+// TransferProgress describes the progress of receiving the data of an object
+// swagger:model
+type TransferProgress struct {
+	// ReceivedBytes is the number of bytes of the object's data that have been received
+	ReceivedBytes int64 `json:"receivedBytes"`
+
+	// TotalBytes is the size of the object's data
+	TotalBytes int64 `json:"totalBytes"`
+
+	// InflightChunks is the number of chunks that have been requested but not received yet
+	InflightChunks int `json:"inflightChunks"`
+}
+
+// UploadProgress describes an upload of the data of an object by an application in several parts
+// swagger:model
+type UploadProgress struct {
+	// Size is the size of the object's data being uploaded
+	Size int64 `json:"size"`
+
+	// Offset is the offset up to which all the data has been received, an interrupted upload resumes from it
+	Offset int64 `json:"offset"`
+
+	// Received are the byte ranges of the data that have been received, sorted by their offsets
+	Received []ByteRange `json:"received"`
+
+	// Complete indicates whether all the data has been received and stored as the object's data
+	Complete bool `json:"complete"`
+}
+
+// ManifestEntry describes an object stored by an ESS, in the manifest that the ESS sends to the CSS
+// to verify that its objects match the objects of the CSS
+// swagger:ignore
+type ManifestEntry struct {
+	ObjectType string `json:"objectType"`
+	ObjectID   string `json:"objectID"`
+	InstanceID int64  `json:"instanceID"`
+	ObjectSize int64  `json:"objectSize"`
+
+	// Hash is the hash of the data stored by the ESS, empty if the object has no data
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	Hash          string `json:"hash,omitempty"`
+}
+
+// AckEntry is the ack of a received or consumed notification of an object, in a batch of acks sent together to a destination
+// swagger:ignore
+type AckEntry struct {
+	// Command is the ack's notification, ackreceived or ackconsumed
+	Command    string `json:"command"`
+	ObjectType string `json:"objectType"`
+	ObjectID   string `json:"objectID"`
+	OriginType string `json:"originType"`
+	OriginID   string `json:"originID"`
+	InstanceID int64  `json:"instanceID"`
+	DataID     int64  `json:"dataID,omitempty"`
+}
+
+// Reasons of discrepancies between the objects of an ESS and the objects of the CSS
+const (
+	DiscrepancyMissing  = "missing"  // The object was delivered to the ESS, but the ESS doesn't have it
+	DiscrepancyInstance = "instance" // The ESS has a different instance of the object
+	DiscrepancyData     = "data"     // The size or the hash of the data stored by the ESS differs
+	DiscrepancyUnknown  = "unknown"  // The ESS has an object that the CSS doesn't have
+)
+
+// ObjectDiscrepancy describes an object of an ESS that doesn't match the object of the CSS
+// swagger:model
+type ObjectDiscrepancy struct {
+	ObjectType string `json:"objectType"`
+	ObjectID   string `json:"objectID"`
+
+	// Reason is the reason of the discrepancy
+	//   enum: missing,instance,data,unknown
+	Reason string `json:"reason"`
+
+	// Resent is true if the object was sent again to the ESS
+	Resent bool `json:"resent"`
+}
+
+// VerifyReport describes the result of verifying the objects of an ESS against the objects of the CSS
+// swagger:model
+type VerifyReport struct {
+	DestOrgID string    `json:"destinationOrgID"`
+	DestType  string    `json:"destinationType"`
+	DestID    string    `json:"destinationID"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// VerifiedObjects is the number of objects in the manifest sent by the ESS
+	VerifiedObjects int `json:"verifiedObjects"`
+
+	// Discrepancies are the objects that don't match, only objects whose instance or data differ are sent again
+	Discrepancies []ObjectDiscrepancy `json:"discrepancies"`
+}
+
 // ObjectDestinationPolicy contains information about an object that has a Destination Policy.
 // swagger:model
 type ObjectDestinationPolicy struct {
@@ -509,6 +868,40 @@ type ConsumedObject struct {
 	Timestamp time.Time
 }
 
+// Webhook events
+const (
+	// ObjectUpdatedEvent is the event of the webhooks called when an object is received or updated, the default event
+	ObjectUpdatedEvent = "updated"
+
+	// ObjectDeletedEvent is the event of the webhooks called when a deleted object is removed
+	ObjectDeletedEvent = "deleted"
+)
+
+// DeletionWebhooksKey returns the key under which the webhooks called on the deletion of objects of the type are stored.
+// Object types don't contain slashes, as they are parts of the APIs' paths, so the key doesn't collide with an object type.
+func DeletionWebhooksKey(objectType string) string {
+	return objectType + "/" + ObjectDeletedEvent
+}
+
+// WebhookDelivery is a call of a webhook that failed and is retried later. Webhook deliveries are persisted
+// so that retries survive a restart.
+type WebhookDelivery struct {
+	URL         string    `json:"url" bson:"url"`
+	MetaData    MetaData  `json:"metaData" bson:"metadata"`
+	Attempts    int       `json:"attempts" bson:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt" bson:"next-attempt"`
+
+	// DeadLetter is true if the delivery failed WebhookMaxAttempts times and is kept for inspection only
+	DeadLetter bool `json:"deadLetter" bson:"dead-letter"`
+}
+
+// ObjectCleanup is a removal of an object from the storage that failed and is retried until it succeeds.
+// Object cleanups are persisted so that retries survive a restart.
+type ObjectCleanup struct {
+	MetaData MetaData `json:"metaData" bson:"metadata"`
+	Attempts int      `json:"attempts" bson:"attempts"`
+}
+
 // NotificationInfo contains information about a message to send to the other side
 type NotificationInfo struct {
 	NotificationTopic string
@@ -516,6 +909,7 @@ type NotificationInfo struct {
 	DestID            string
 	InstanceID        int64
 	DataID            int64
+	OrderSequence     int64
 	MetaData          *MetaData
 }
 
@@ -529,6 +923,8 @@ const (
 	ObjDeleted         = "objdeleted"         // The object was deleted by the other side
 	ObjReceived        = "objreceived"        // The object was received by the app
 	ConsumedByDest     = "consumedByDest"     // The object was consumed by the other side (ESS only)
+	SignatureRejected  = "signatureRejected"  // The object's data was rejected, its signature is missing or invalid
+	HeldInOrder        = "heldInOrder"        // The object was received completely, and is held until the objects sent before it are received
 )
 
 // Notification status and type
@@ -537,8 +933,10 @@ const (
 	Updated               = "updated"
 	Consumed              = "consumed"
 	AckConsumed           = "ackconsumed"
+	PartiallyConsumed     = "partiallyconsumed"
 	ConsumedByDestination = "consumedByDest"
 	Getdata               = "getdata"
+	TransferFailed        = "transferFailed"
 	Data                  = "data"
 	UpdatePending         = "updatePending"
 	ConsumedPending       = "consumedPending"
@@ -552,6 +950,7 @@ const (
 	AckResend             = "ackresend"
 	Register              = "register"
 	AckRegister           = "regack"
+	RegisterDenied        = "regdenied"
 	RegisterNew           = "registerNew"
 	RegisterAsNew         = "registerAsNew"
 	Unregister            = "unregister"
@@ -561,7 +960,12 @@ const (
 	ReceivedByDestination = "receivedByDest"
 	Feedback              = "feedback"
 	Error                 = "error"
+	Rejected              = "rejected"
 	Ping                  = "ping"
+	Heartbeat             = "heartbeat"
+	Verify                = "verify"
+	Cancel                = "cancel"
+	AckBatch              = "ackbatch"
 )
 
 // Indication whether the object has been delivered to the destination
@@ -571,22 +975,61 @@ const (
 	Delivered  = "delivered"
 	// Consumed (defined above)
 	// Error (defined above)
+	// Rejected (defined above)
 	// Deleted (defined above)
 )
 
+// DeliveryOverdue is the status of the notification events that report that a destination didn't receive an object
+// by the object's DeliverBy deadline
+const DeliveryOverdue = "deliveryOverdue"
+
 // Feedback codes
 const (
-	InternalErrorCode = 1
-	IOErrorCode       = 2
-	SecurityErrorCode = 3
-	PathErrorCode     = 4
-	InvalidObject     = 5
+	InternalErrorCode   = 1
+	IOErrorCode         = 2
+	SecurityErrorCode   = 3
+	PathErrorCode       = 4
+	InvalidObject       = 5
+	ObjectSizeErrorCode = 6
+	OriginLoopErrorCode = 7
+	LinkErrorCode       = 8
+
+	// AdmissionRejectedCode is sent to the origins of the objects that the admission policy of the receiver rejected
+	AdmissionRejectedCode = 9
 
 	// All error codes must have a value below this value
 	// and all feedback codes must have a value above this value
 	lastErrorCode = 10000
+
+	// GoingAwayCode is sent to the origins of the objects whose data is being received by a node that is shutting down,
+	// so that they don't resend the notifications of the objects until the retry interval passes
+	GoingAwayCode = 10001
+)
+
+// Supported hash algorithms for verifying object data
+const (
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
 )
 
+// NewHash returns a hash.Hash for the provided algorithm.
+// If algorithm is empty the configured DefaultHashAlgorithm is used.
+func NewHash(algorithm string) (hash.Hash, SyncServiceError) {
+	if algorithm == "" {
+		algorithm = Configuration.DefaultHashAlgorithm
+	}
+	switch strings.ToLower(algorithm) {
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+	return nil, &InvalidRequest{Message: fmt.Sprintf("Unsupported hash algorithm %s", algorithm)}
+}
+
 // Magic is a magic number placed in the front of various payloads
 const Magic = uint32(0x01010101)
 
@@ -613,6 +1056,50 @@ func VersionAsString() string {
 	return fmt.Sprintf("%d.%d", Version.Major, Version.Minor)
 }
 
+// MinMessageVersion is the oldest version of the messages (e.g., data messages) that the Sync-Service can build and parse.
+// Messages of any version between MinMessageVersion and Version are supported.
+var MinMessageVersion = SyncServiceVersion{Major: 1, Minor: 0}
+
+// CompressedNotificationsVersion is the oldest message version that supports compressed notification messages
+var CompressedNotificationsVersion = SyncServiceVersion{Major: 1, Minor: 1}
+
+// AckBatchVersion is the oldest message version that supports batched acks
+var AckBatchVersion = SyncServiceVersion{Major: 1, Minor: 2}
+
+// ZeroFillVersion is the oldest message version that supports zero-fill data messages
+var ZeroFillVersion = SyncServiceVersion{Major: 1, Minor: 3}
+
+// ParseVersion parses a version of the form major.minor, as returned by VersionAsString
+func ParseVersion(version string) (SyncServiceVersion, error) {
+	var result SyncServiceVersion
+	if _, err := fmt.Sscanf(version, "%d.%d", &result.Major, &result.Minor); err != nil {
+		return SyncServiceVersion{}, &InvalidRequest{Message: fmt.Sprintf("Invalid version %s", version)}
+	}
+	return result, nil
+}
+
+// Less returns true if the version is older than the other version
+func (version SyncServiceVersion) Less(other SyncServiceVersion) bool {
+	return version.Major < other.Major || (version.Major == other.Major && version.Minor < other.Minor)
+}
+
+// IsSupportedMessageVersion returns true if messages of the version can be parsed
+func IsSupportedMessageVersion(version SyncServiceVersion) bool {
+	return !version.Less(MinMessageVersion) && !Version.Less(version)
+}
+
+// NegotiateMessageVersion returns the newest message version supported by both the Sync-Service and a peer
+// of the specified version. Peers that didn't specify a version (the zero version) get MinMessageVersion.
+func NegotiateMessageVersion(peerVersion SyncServiceVersion) SyncServiceVersion {
+	if peerVersion.Less(MinMessageVersion) {
+		return MinMessageVersion
+	}
+	if Version.Less(peerVersion) {
+		return Version
+	}
+	return peerVersion
+}
+
 // SingleOrgCSS is true in case of CSS ouside WIoTP with one organization set in the configration,
 // and false otherwise
 var SingleOrgCSS bool
@@ -634,6 +1121,8 @@ const (
 	ResendAll = iota
 	ResendDelivered
 	ResendUndelivered
+	// ResendNew only sends the objects that weren't sent to the destination before
+	ResendNew
 )
 
 // Storage providers
@@ -672,18 +1161,90 @@ type Locks struct {
 	numberOfLocks uint32
 	locks         []sync.RWMutex
 	name          string
+	statistics    *lockStatistics
 }
 
+// lockStatistics collects the time spent waiting for the locks of a set of locks, if LockStatistics is set.
+// It is kept behind a pointer so that copies of a Locks value share the same counters, and is nil if the locks aren't measured.
+type lockStatistics struct {
+	acquisitions uint64
+	waitTime     uint64
+	maxWaitTime  uint64
+
+	// buckets collects the statistics of each lock when LockBucketStatistics is set, and is nil otherwise
+	buckets []lockBucketStatistics
+}
+
+// lockBucketStatistics collects the time spent waiting for a lock, and holding it exclusively
+type lockBucketStatistics struct {
+	acquisitions uint64
+	waitTime     uint64
+	maxWaitTime  uint64
+	holdTime     uint64
+	maxHoldTime  uint64
+
+	// lockedAt is the time in nanoseconds when the lock was last locked exclusively
+	lockedAt int64
+}
+
+// maxReportedLockBuckets is the number of locks of a set that are reported with the statistics of the set
+const maxReportedLockBuckets = 10
+
+// LockStatistics describes the time spent waiting for the locks of a set of locks
+// swagger:model
+type LockStatistics struct {
+	Name          string `json:"name"`
+	NumberOfLocks uint32 `json:"numberOfLocks"`
+	Acquisitions  uint64 `json:"acquisitions"`
+	// Total and maximal wait time in microseconds
+	TotalWaitTime uint64 `json:"totalWaitTime"`
+	MaxWaitTime   uint64 `json:"maxWaitTime"`
+
+	// Total and maximal time in microseconds the locks were held exclusively, measured if LockBucketStatistics is set
+	TotalHoldTime uint64 `json:"totalHoldTime,omitempty"`
+	MaxHoldTime   uint64 `json:"maxHoldTime,omitempty"`
+
+	// Buckets are the locks that were waited for the longest, if LockBucketStatistics is set
+	Buckets []LockBucketStatistics `json:"buckets,omitempty"`
+}
+
+// LockBucketStatistics describes the time spent waiting for a lock of a set of locks, and holding it exclusively
+// swagger:model
+type LockBucketStatistics struct {
+	Index        uint32 `json:"index"`
+	Acquisitions uint64 `json:"acquisitions"`
+	// Total and maximal wait and hold times in microseconds
+	TotalWaitTime uint64 `json:"totalWaitTime"`
+	MaxWaitTime   uint64 `json:"maxWaitTime"`
+	TotalHoldTime uint64 `json:"totalHoldTime"`
+	MaxHoldTime   uint64 `json:"maxHoldTime"`
+}
+
+var registeredLocks = make(map[string]*Locks)
+var registeredLocksLock sync.Mutex
+
 // NewLocks initializes object locks
 func NewLocks(name string) *Locks {
 	locks := Locks{name: name}
-	if Configuration.NodeType == ESS {
+	if Configuration.NumberOfObjectLocks > 0 {
+		locks.numberOfLocks = uint32(Configuration.NumberOfObjectLocks)
+	} else if Configuration.NodeType == ESS {
 		locks.numberOfLocks = 256
 	} else {
 		locks.numberOfLocks = 1024
 	}
 
 	locks.locks = make([]sync.RWMutex, locks.numberOfLocks)
+	if Configuration.LockStatistics || Configuration.LockBucketStatistics {
+		locks.statistics = &lockStatistics{}
+	}
+	if Configuration.LockBucketStatistics {
+		locks.statistics.buckets = make([]lockBucketStatistics, locks.numberOfLocks)
+	}
+
+	registeredLocksLock.Lock()
+	registeredLocks[name] = &locks
+	registeredLocksLock.Unlock()
 	return &locks
 }
 
@@ -697,17 +1258,30 @@ func InitObjectLocks() {
 
 // Lock locks the object
 func (locks *Locks) Lock(index uint32) {
+	if locks.statistics == nil {
+		locks.locks[index&(locks.numberOfLocks-1)].Lock()
+		return
+	}
+	start := time.Now()
 	locks.locks[index&(locks.numberOfLocks-1)].Lock()
+	locks.lockAcquired(index, start, true)
 }
 
 // Unlock unlocks the object
 func (locks *Locks) Unlock(index uint32) {
+	locks.lockReleased(index)
 	locks.locks[index&(locks.numberOfLocks-1)].Unlock()
 }
 
 // RLock locks the object for reading
 func (locks *Locks) RLock(index uint32) {
+	if locks.statistics == nil {
+		locks.locks[index&(locks.numberOfLocks-1)].RLock()
+		return
+	}
+	start := time.Now()
 	locks.locks[index&(locks.numberOfLocks-1)].RLock()
+	locks.lockAcquired(index, start, false)
 }
 
 // RUnlock unlocks the object for reading
@@ -718,23 +1292,133 @@ func (locks *Locks) RUnlock(index uint32) {
 // ConditionalLock locks the object if the index doesn't correspond to a lock that is already taken
 func (locks *Locks) ConditionalLock(index uint32, lockedIndex uint32) {
 	if index&(locks.numberOfLocks-1) != lockedIndex&(locks.numberOfLocks-1) {
-		locks.locks[index&(locks.numberOfLocks-1)].Lock()
+		locks.Lock(index)
 	}
 }
 
 // ConditionalUnlock unlocks the object if the index doesn't correspond to a lock that is already taken
 func (locks *Locks) ConditionalUnlock(index uint32, lockedIndex uint32) {
 	if index&(locks.numberOfLocks-1) != lockedIndex&(locks.numberOfLocks-1) {
+		locks.lockReleased(index)
 		locks.locks[index&(locks.numberOfLocks-1)].Unlock()
 	}
 }
 
+// lockAcquired records the time spent waiting for the lock, and the time it was locked if it is locked exclusively
+func (locks *Locks) lockAcquired(index uint32, start time.Time, exclusive bool) {
+	now := time.Now()
+	wait := now.Sub(start)
+	locks.statistics.update(wait)
+	if locks.statistics.buckets == nil {
+		return
+	}
+	bucket := &locks.statistics.buckets[index&(locks.numberOfLocks-1)]
+	atomic.AddUint64(&bucket.acquisitions, 1)
+	atomic.AddUint64(&bucket.waitTime, uint64(wait))
+	updateMaximum(&bucket.maxWaitTime, uint64(wait))
+	if exclusive {
+		atomic.StoreInt64(&bucket.lockedAt, now.UnixNano())
+	}
+}
+
+// lockReleased records the time the exclusive lock was held
+func (locks *Locks) lockReleased(index uint32) {
+	if locks.statistics == nil || locks.statistics.buckets == nil {
+		return
+	}
+	bucket := &locks.statistics.buckets[index&(locks.numberOfLocks-1)]
+	hold := uint64(time.Now().UnixNano() - atomic.LoadInt64(&bucket.lockedAt))
+	atomic.AddUint64(&bucket.holdTime, hold)
+	updateMaximum(&bucket.maxHoldTime, hold)
+}
+
+// Statistics returns the time spent waiting for the locks, and if LockBucketStatistics is set, the time spent
+// holding them and the statistics of the locks that were waited for the longest.
+// Only the number of locks is returned if the locks aren't measured.
+func (locks *Locks) Statistics() LockStatistics {
+	if locks.statistics == nil {
+		return LockStatistics{Name: locks.name, NumberOfLocks: locks.numberOfLocks}
+	}
+	statistics := LockStatistics{Name: locks.name, NumberOfLocks: locks.numberOfLocks,
+		Acquisitions:  atomic.LoadUint64(&locks.statistics.acquisitions),
+		TotalWaitTime: atomic.LoadUint64(&locks.statistics.waitTime) / 1000,
+		MaxWaitTime:   atomic.LoadUint64(&locks.statistics.maxWaitTime) / 1000}
+	if locks.statistics.buckets == nil {
+		return statistics
+	}
+
+	buckets := make([]LockBucketStatistics, 0)
+	for i := range locks.statistics.buckets {
+		bucket := &locks.statistics.buckets[i]
+		bucketStatistics := LockBucketStatistics{Index: uint32(i), Acquisitions: atomic.LoadUint64(&bucket.acquisitions),
+			TotalWaitTime: atomic.LoadUint64(&bucket.waitTime) / 1000, MaxWaitTime: atomic.LoadUint64(&bucket.maxWaitTime) / 1000,
+			TotalHoldTime: atomic.LoadUint64(&bucket.holdTime) / 1000, MaxHoldTime: atomic.LoadUint64(&bucket.maxHoldTime) / 1000}
+		statistics.TotalHoldTime += bucketStatistics.TotalHoldTime
+		if bucketStatistics.MaxHoldTime > statistics.MaxHoldTime {
+			statistics.MaxHoldTime = bucketStatistics.MaxHoldTime
+		}
+		if bucketStatistics.Acquisitions > 0 {
+			buckets = append(buckets, bucketStatistics)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].TotalWaitTime != buckets[j].TotalWaitTime {
+			return buckets[i].TotalWaitTime > buckets[j].TotalWaitTime
+		}
+		return buckets[i].TotalHoldTime > buckets[j].TotalHoldTime
+	})
+	if len(buckets) > maxReportedLockBuckets {
+		buckets = buckets[:maxReportedLockBuckets]
+	}
+	statistics.Buckets = buckets
+	return statistics
+}
+
+func (statistics *lockStatistics) update(wait time.Duration) {
+	atomic.AddUint64(&statistics.acquisitions, 1)
+	atomic.AddUint64(&statistics.waitTime, uint64(wait))
+	updateMaximum(&statistics.maxWaitTime, uint64(wait))
+}
+
+// updateMaximum atomically sets the maximum to value if value is larger
+func updateMaximum(maximum *uint64, value uint64) {
+	for {
+		current := atomic.LoadUint64(maximum)
+		if value <= current || atomic.CompareAndSwapUint64(maximum, current, value) {
+			return
+		}
+	}
+}
+
+// GetLocksStatistics returns the statistics of all the sets of locks that are measured, sorted by name
+func GetLocksStatistics() []LockStatistics {
+	registeredLocksLock.Lock()
+	defer registeredLocksLock.Unlock()
+
+	statistics := make([]LockStatistics, 0, len(registeredLocks))
+	for _, locks := range registeredLocks {
+		if locks.statistics != nil {
+			statistics = append(statistics, locks.Statistics())
+		}
+	}
+	sort.Slice(statistics, func(i, j int) bool { return statistics[i].Name < statistics[j].Name })
+	return statistics
+}
+
 // GetNotificationID gets the notification ID for the notification
 func GetNotificationID(notification Notification) string {
 	return CreateNotificationID(notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType,
 		notification.DestID)
 }
 
+// TraceIDTag returns the tag of the object's trace ID, to append to the trace messages of the object's transfers
+func TraceIDTag(metaData *MetaData) string {
+	if metaData == nil || metaData.TraceID == "" {
+		return ""
+	}
+	return " [trace " + metaData.TraceID + "]"
+}
+
 // CreateNotificationID creates notification ID
 func CreateNotificationID(orgID string, objectType string, objectID string, destType string, destID string) string {
 	var strBuilder strings.Builder
@@ -864,7 +1548,23 @@ func ValidateDestinationListInput(destinationsList []string) (bool, SyncServiceE
 	return true, nil
 }
 
+// MatchDestinationAttributes returns true if the destination's attributes have all the attributes of the selector,
+// with the same values
+func MatchDestinationAttributes(selector map[string]string, attributes map[string]string) bool {
+	for name, value := range selector {
+		if attribute, ok := attributes[name]; !ok || attribute != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SameDestination returns true if both destinations are the same destination, regardless of what the destination reported
+func SameDestination(dest1 Destination, dest2 Destination) bool {
+	return dest1.DestOrgID == dest2.DestOrgID && dest1.DestType == dest2.DestType && dest1.DestID == dest2.DestID
+}
+
 func init() {
 	Version.Major = 1
-	Version.Minor = 0
+	Version.Minor = 3
 }
@@ -0,0 +1,258 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCompareInstances(t *testing.T) {
+	tests := []struct {
+		instanceID1 int64
+		sequence1   int64
+		instanceID2 int64
+		sequence2   int64
+		expected    int
+	}{
+		{5, 0, 5, 0, 0}, {4, 0, 5, 0, -1}, {6, 0, 5, 0, 1},
+		// The sequence takes precedence over the instance ID, e.g. if the origin's clock moved backward
+		{4, 3, 5, 2, 1}, {6, 2, 5, 3, -1},
+		// Same sequence, the instance ID is the tiebreak
+		{4, 2, 5, 2, -1}, {6, 2, 5, 2, 1}, {5, 2, 5, 2, 0},
+		// Instances without a sequence are compared by their instance IDs only
+		{4, 3, 5, 0, -1}, {6, 0, 5, 3, 1}, {5, 0, 5, 3, 0},
+	}
+
+	for _, test := range tests {
+		if result := CompareInstances(test.instanceID1, test.sequence1, test.instanceID2, test.sequence2); result != test.expected {
+			t.Errorf("CompareInstances(%d, %d, %d, %d) returned %d instead of %d", test.instanceID1, test.sequence1,
+				test.instanceID2, test.sequence2, result, test.expected)
+		}
+		if result := CompareInstances(test.instanceID2, test.sequence2, test.instanceID1, test.sequence1); result != -test.expected {
+			t.Errorf("CompareInstances(%d, %d, %d, %d) returned %d instead of %d", test.instanceID2, test.sequence2,
+				test.instanceID1, test.sequence1, result, -test.expected)
+		}
+	}
+}
+
+func TestTraceIDTag(t *testing.T) {
+	if tag := TraceIDTag(nil); tag != "" {
+		t.Errorf("TraceIDTag returned %q for nil meta data", tag)
+	}
+	if tag := TraceIDTag(&MetaData{ObjectID: "1"}); tag != "" {
+		t.Errorf("TraceIDTag returned %q for meta data without a trace ID", tag)
+	}
+	if tag := TraceIDTag(&MetaData{ObjectID: "1", TraceID: "abc"}); tag != " [trace abc]" {
+		t.Errorf("TraceIDTag returned %q instead of \" [trace abc]\"", tag)
+	}
+}
+
+func TestNegotiateMessageVersion(t *testing.T) {
+	version := Version
+	minVersion := MinMessageVersion
+	defer func() {
+		Version = version
+		MinMessageVersion = minVersion
+	}()
+	Version = SyncServiceVersion{Major: 2, Minor: 3}
+	MinMessageVersion = SyncServiceVersion{Major: 1, Minor: 5}
+
+	tests := []struct {
+		peerVersion SyncServiceVersion
+		negotiated  SyncServiceVersion
+		supported   bool
+	}{
+		{SyncServiceVersion{}, MinMessageVersion, false},
+		{SyncServiceVersion{Major: 1, Minor: 4}, MinMessageVersion, false},
+		{SyncServiceVersion{Major: 1, Minor: 5}, SyncServiceVersion{Major: 1, Minor: 5}, true},
+		{SyncServiceVersion{Major: 2, Minor: 0}, SyncServiceVersion{Major: 2, Minor: 0}, true},
+		{SyncServiceVersion{Major: 2, Minor: 3}, Version, true},
+		{SyncServiceVersion{Major: 2, Minor: 4}, Version, false},
+		{SyncServiceVersion{Major: 3, Minor: 0}, Version, false},
+	}
+
+	for _, test := range tests {
+		if negotiated := NegotiateMessageVersion(test.peerVersion); negotiated != test.negotiated {
+			t.Errorf("NegotiateMessageVersion(%v) returned %v instead of %v", test.peerVersion, negotiated, test.negotiated)
+		}
+		if supported := IsSupportedMessageVersion(test.peerVersion); supported != test.supported {
+			t.Errorf("IsSupportedMessageVersion(%v) returned %t instead of %t", test.peerVersion, supported, test.supported)
+		}
+	}
+
+	if parsed, err := ParseVersion("2.1"); err != nil {
+		t.Errorf("ParseVersion failed. Error: %s", err.Error())
+	} else if parsed != (SyncServiceVersion{Major: 2, Minor: 1}) {
+		t.Errorf("ParseVersion returned %v instead of 2.1", parsed)
+	}
+	if _, err := ParseVersion("abc"); err == nil {
+		t.Errorf("ParseVersion parsed an invalid version")
+	}
+}
+
+func TestLocksStatistics(t *testing.T) {
+	numberOfLocks := Configuration.NumberOfObjectLocks
+	defer func() {
+		Configuration.NumberOfObjectLocks = numberOfLocks
+		Configuration.LockStatistics = false
+	}()
+	Configuration.NumberOfObjectLocks = 8
+
+	// The locks aren't measured by default
+	locks := NewLocks("test")
+	locks.Lock(3)
+	locks.Unlock(3)
+	if statistics := locks.Statistics(); statistics.NumberOfLocks != 8 || statistics.Acquisitions != 0 {
+		t.Errorf("The locks were measured although LockStatistics isn't set: %+v", statistics)
+	}
+	for _, registered := range GetLocksStatistics() {
+		if registered.Name == "test" {
+			t.Errorf("GetLocksStatistics returned the statistics of locks that aren't measured")
+		}
+	}
+
+	Configuration.LockStatistics = true
+	locks = NewLocks("test")
+	if statistics := locks.Statistics(); statistics.NumberOfLocks != 8 || statistics.Acquisitions != 0 {
+		t.Errorf("Wrong statistics of new locks: %+v", statistics)
+	}
+
+	// Indices that differ by the number of locks map to the same lock
+	locks.Lock(3)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		locks.Unlock(3)
+	}()
+	locks.Lock(11)
+	locks.Unlock(11)
+	locks.RLock(4)
+	locks.RUnlock(4)
+
+	statistics := locks.Statistics()
+	if statistics.Acquisitions != 3 {
+		t.Errorf("Statistics returned %d acquisitions instead of 3", statistics.Acquisitions)
+	}
+	if statistics.MaxWaitTime < 10000 || statistics.TotalWaitTime < statistics.MaxWaitTime {
+		t.Errorf("Wrong wait times: max = %d, total = %d", statistics.MaxWaitTime, statistics.TotalWaitTime)
+	}
+
+	found := false
+	for _, registered := range GetLocksStatistics() {
+		if registered.Name == "test" {
+			found = registered.Acquisitions == 3
+		}
+	}
+	if !found {
+		t.Errorf("GetLocksStatistics didn't return the statistics of the test locks")
+	}
+}
+
+func TestLockBucketStatistics(t *testing.T) {
+	numberOfLocks := Configuration.NumberOfObjectLocks
+	defer func() {
+		Configuration.NumberOfObjectLocks = numberOfLocks
+		Configuration.LockBucketStatistics = false
+	}()
+	Configuration.NumberOfObjectLocks = 8
+	Configuration.LockBucketStatistics = true
+
+	locks := NewLocks("buckets")
+	locks.Lock(3)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		locks.Unlock(3)
+	}()
+	locks.Lock(11)
+	locks.Unlock(11)
+	locks.RLock(5)
+	locks.RUnlock(5)
+
+	statistics := locks.Statistics()
+	if statistics.MaxHoldTime < 10000 || statistics.TotalHoldTime < statistics.MaxHoldTime {
+		t.Errorf("Wrong hold times: max = %d, total = %d", statistics.MaxHoldTime, statistics.TotalHoldTime)
+	}
+	if len(statistics.Buckets) != 2 {
+		t.Fatalf("Statistics returned %d buckets instead of 2", len(statistics.Buckets))
+	}
+	// The contended lock is reported first
+	if bucket := statistics.Buckets[0]; bucket.Index != 3 || bucket.Acquisitions != 2 || bucket.MaxWaitTime < 10000 {
+		t.Errorf("Wrong statistics of the contended lock: %+v", bucket)
+	}
+	if bucket := statistics.Buckets[1]; bucket.Index != 5 || bucket.Acquisitions != 1 || bucket.TotalHoldTime != 0 {
+		t.Errorf("Wrong statistics of the read lock: %+v", bucket)
+	}
+
+	// The buckets aren't measured by default
+	Configuration.LockBucketStatistics = false
+	locks = NewLocks("buckets")
+	locks.Lock(3)
+	locks.Unlock(3)
+	if statistics := locks.Statistics(); statistics.Buckets != nil || statistics.TotalHoldTime != 0 {
+		t.Errorf("Bucket statistics were measured although LockBucketStatistics isn't set: %+v", statistics)
+	}
+}
+
+func TestMetaDataSchema(t *testing.T) {
+	upgrades := metaDataUpgrades
+	schemaVersion := MetaDataSchemaVersion
+	defer func() {
+		metaDataUpgrades = upgrades
+		MetaDataSchemaVersion = schemaVersion
+	}()
+
+	// A newer schema adds a field whose default isn't the zero value
+	metaDataUpgrades = append(metaDataUpgrades[:len(metaDataUpgrades):len(metaDataUpgrades)], func(metaData *MetaData) {
+		if metaData.ExpectedConsumers == 0 {
+			metaData.ExpectedConsumers = 1
+		}
+	})
+	MetaDataSchemaVersion = len(metaDataUpgrades)
+
+	tests := []struct {
+		json              string
+		expectedConsumers int
+	}{
+		// Sent by a node of an older schema
+		{`{"objectID": "1", "objectType": "type1"}`, 1},
+		{`{"objectID": "1", "objectType": "type1", "schemaVersion": 1}`, 1},
+		{`{"objectID": "1", "objectType": "type1", "consumers": 3}`, 3},
+		// Sent by a node of the current schema, that set the field to its zero value
+		{`{"objectID": "1", "objectType": "type1", "schemaVersion": 2}`, 0},
+		// Sent by a node of a newer schema, with fields that aren't known
+		{`{"objectID": "1", "objectType": "type1", "schemaVersion": 3, "newField": {"a": 1}}`, 0},
+	}
+	for i, test := range tests {
+		metaData := MetaData{}
+		if err := json.Unmarshal([]byte(test.json), &metaData); err != nil {
+			t.Errorf("Test %d: failed to unmarshal the meta data. Error: %s", i, err.Error())
+			continue
+		}
+		if metaData.ObjectID != "1" || metaData.ObjectType != "type1" {
+			t.Errorf("Test %d: wrong meta data %s:%s", i, metaData.ObjectType, metaData.ObjectID)
+		}
+		if metaData.ExpectedConsumers != test.expectedConsumers {
+			t.Errorf("Test %d: ExpectedConsumers is %d instead of %d", i, metaData.ExpectedConsumers, test.expectedConsumers)
+		}
+		if metaData.SchemaVersion < MetaDataSchemaVersion {
+			t.Errorf("Test %d: the meta data wasn't upgraded, its schema version is %d", i, metaData.SchemaVersion)
+		}
+	}
+
+	// The meta data is sent with the current schema version, also when embedded in other messages
+	message := struct {
+		Meta MetaData `json:"meta"`
+	}{MetaData{ObjectID: "1"}}
+	encoded, err := json.Marshal(&message)
+	if err != nil {
+		t.Errorf("Failed to marshal the meta data. Error: %s", err.Error())
+		return
+	}
+	decoded := struct {
+		Meta map[string]interface{} `json:"meta"`
+	}{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Errorf("Failed to unmarshal the message. Error: %s", err.Error())
+	} else if version, ok := decoded.Meta["schemaVersion"].(float64); !ok || int(version) != MetaDataSchemaVersion {
+		t.Errorf("The meta data was sent with schema version %v instead of %d", decoded.Meta["schemaVersion"], MetaDataSchemaVersion)
+	}
+}
@@ -3,9 +3,11 @@ package common
 // config contains functions and structs for dealing with the configuration file.
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math"
 	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -46,6 +48,19 @@ const (
 	ParallelMQTTLarge  = "large"
 )
 
+// The compression algorithms of the data of data messages, from the least to the most preferred
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// MaxMQTTDataTopics is the maximal number of MQTT topics across which the chunks of the data of objects are striped
+const MaxMQTTDataTopics = 32
+
+// CompressionAlgorithms lists the compression algorithms from the least to the most preferred
+var CompressionAlgorithms = []string{CompressionNone, CompressionGzip, CompressionZstd}
+
 // DefaultLogTraceFileSize default value for log and trace file size in KB
 const DefaultLogTraceFileSize = 20000
 
@@ -107,6 +122,24 @@ type Config struct {
 	// LeadershipTimeout is the timeout for leadership updates in seconds
 	LeadershipTimeout int32 `env:"LEADERSHIP_TIMEOUT"`
 
+	// ShardObjectOwnership specifies whether the objects are assigned to the CSS instances by consistent hashing,
+	// so that each instance receives the chunked data of the objects it owns, rather than the leader receiving the
+	// chunked data of all the objects. The advertised address of an object's owner is returned with the errors of
+	// requests that only the owner can handle. Used only by a CSS with mongo storage, outside the Watson IoT Platform.
+	// The default value is false, meaning that the leader receives the chunked data of all the objects
+	ShardObjectOwnership bool `env:"SHARD_OBJECT_OWNERSHIP"`
+
+	// SingleNodeCSS specifies that the CSS runs as a single instance, which is always the leader and owns all the objects.
+	// No leader election takes place. Used only by a CSS with mongo storage, other CSSs are always the leader.
+	// The default value is false
+	SingleNodeCSS bool `env:"SINGLE_NODE_CSS"`
+
+	// AdvertisedAddress is the address (e.g., https://css1.example.com:8443) at which this CSS instance can be reached.
+	// When this instance is the leader, the other CSS instances (the replicas) return it as the address of the leader
+	// with the errors of requests that only the leader can handle.
+	// The default value is empty, meaning the replicas don't return the address of the leader
+	AdvertisedAddress string `env:"ADVERTISED_ADDRESS"`
+
 	// AuthenticationHandler indicates which Authentication handler should be used.
 	// The current possible values are:
 	//     dummy - for the dummyAuthenticate Authentication handler
@@ -165,6 +198,34 @@ type Config struct {
 	// Default is "none" (or empty string), i.e., no threading
 	MQTTParallelMode string `env:"PARALLEL_MQTT_MODE"`
 
+	// MQTTQoS specifies the MQTT quality of service (0, 1, or 2) of the messages that are published to the broker.
+	// The QoS of the messages of an object can be set in the object's meta data.
+	// Default is 0
+	MQTTQoS int `env:"MQTT_QOS"`
+
+	// MQTTNotificationCompressionThreshold specifies the size (in bytes) of serialized notification messages from which
+	// they are compressed before they are published to the broker. Notifications are compressed only if the other side
+	// supports compressed notifications. 0 means that notifications aren't compressed.
+	// Default is 0
+	MQTTNotificationCompressionThreshold int `env:"MQTT_NOTIFICATION_COMPRESSION_THRESHOLD"`
+
+	// MQTTDataTopics specifies the number of MQTT topics across which the chunks of the data of objects sent to
+	// a destination are striped, so that the broker can deliver them in parallel. The number of topics used with
+	// a destination is the smaller of the numbers configured on the two sides. Between 1 and 32.
+	// Default is 1
+	MQTTDataTopics int `env:"MQTT_DATA_TOPICS"`
+
+	// AckBatchWindow specifies the time (in milliseconds) during which the acks of received and consumed notifications
+	// to the same destination are collected and sent together in one message. Acks are batched only if the other side
+	// supports batched acks. 0 means that each ack is sent immediately.
+	// Default is 0
+	AckBatchWindow int `env:"ACK_BATCH_WINDOW"`
+
+	// AckBatchMaxSize specifies the maximal number of acks sent in one message. A batch that reaches this size
+	// is sent without waiting for AckBatchWindow to expire.
+	// Default is 100
+	AckBatchMaxSize int `env:"ACK_BATCH_MAX_SIZE"`
+
 	// Root path for storing persisted data.
 	//  Default value: /var/wiotp-edge/persist
 	PersistenceRootPath string `env:"PERSISTENCE_ROOT_PATH"`
@@ -195,6 +256,13 @@ type Config struct {
 	// Default value: none
 	HTTPCSSCACertificate string `env:"HTTP_CSS_CA_CERTIFICATE"`
 
+	// TLSReloadInterval specifies the frequency in seconds of checks whether the files of the TLS certificates and keys
+	// used to communicate with the MQTT broker or the CSS were modified. Modified files are reloaded and used by the
+	// connections established afterward, the existing connections are not interrupted.
+	// The files are also reloaded when a standalone sync service receives a SIGHUP signal.
+	// A value of zero means the files are not checked
+	TLSReloadInterval int `env:"TLS_RELOAD_INTERVAL"`
+
 	// LogLevel specifies the logging level in string format
 	LogLevel string `env:"LOG_LEVEL"`
 
@@ -227,11 +295,64 @@ type Config struct {
 	// LogTraceMaintenanceInterval specifies the frequency in seconds of log and trace maintenance (memory consumption, etc.)
 	LogTraceMaintenanceInterval int16 `env:"LOG_TRACE_MAINTENANCE_INTERVAL"`
 
-	// ResendInterval specifies the frequency in seconds of checks to resend unacknowledged notifications
-	// ESS resends register notification with this interval
-	// Other notifications are resent with frequency equal to ResendInterval*6
+	// ResendInterval is deprecated, use NotificationResendInterval and ChunkResendInterval instead.
+	// If changed from its default, it sets NotificationResendInterval to ResendInterval and ChunkResendInterval
+	// to ResendInterval*6, unless they are changed from their defaults
 	ResendInterval int16 `env:"RESEND_INTERVAL"`
 
+	// NotificationResendInterval specifies the frequency in seconds of checks to resend unacknowledged notifications
+	// and to request again unreceived data chunks
+	// ESS resends register notification with this interval
+	// Other notifications are resent with frequency equal to NotificationResendInterval*6
+	NotificationResendInterval int16 `env:"NOTIFICATION_RESEND_INTERVAL"`
+
+	// ChunkResendInterval specifies the time in seconds after which unreceived data chunks are requested again.
+	// The chunks are requested again at the first check (see NotificationResendInterval) after this time
+	ChunkResendInterval int `env:"CHUNK_RESEND_INTERVAL"`
+
+	// ResendJitterPercent specifies the maximal random delay, as a percentage of ChunkResendInterval, added to the time
+	// at which unreceived data chunks are requested again. The jitter spreads out the resends of many nodes that
+	// started their transfers at the same time (e.g. after the CSS reconnects following an outage).
+	// The value must be between 0 and 100. The default value is 0, meaning no jitter
+	ResendJitterPercent int `env:"RESEND_JITTER_PERCENT"`
+
+	// NotificationMaxAge specifies the age in seconds after which a notification record no longer matches the messages
+	// received for the object. A stale record is treated as absent, so that a message that was delayed or replayed after
+	// a long disconnection doesn't change the state of the object's transfer. The creation time of a record is recorded
+	// only while NotificationMaxAge is set, and records without a creation time never become stale.
+	// NotificationMaxAge should be much longer than the time it takes to deliver an object.
+	// The default value is 0, meaning that notification records don't become stale
+	NotificationMaxAge int `env:"NOTIFICATION_MAX_AGE"`
+
+	// MaxNotificationRecordsPerDestination specifies the maximal number of notification records of a destination.
+	// A new notification record of a destination that has that many records is rejected, so that a misbehaving
+	// destination can't grow the storage without bounds. The rejections are logged and counted in the health usage info.
+	// The default value is 0, meaning that the number of notification records isn't limited
+	MaxNotificationRecordsPerDestination int `env:"MAX_NOTIFICATION_RECORDS_PER_DESTINATION"`
+
+	// ReadinessMaxPendingNotificationAge specifies the age in seconds of the oldest unacknowledged notification
+	// above which the node reports that it is degraded in its readiness status. While it is set, the creation time
+	// of notification records is recorded, and only the records created since are taken into account.
+	// The default value is 0, meaning that the age of the notifications doesn't affect the readiness
+	ReadinessMaxPendingNotificationAge int `env:"READINESS_MAX_PENDING_NOTIFICATION_AGE"`
+
+	// ReadinessMaxActiveTransfers specifies the number of transfers of objects' data being received above which
+	// the node reports that it is degraded in its readiness status.
+	// The default value is 0, meaning that the number of transfers doesn't affect the readiness
+	ReadinessMaxActiveTransfers int `env:"READINESS_MAX_ACTIVE_TRANSFERS"`
+
+	// CircuitBreakerThreshold specifies the number of consecutive failures to send to a destination after which
+	// the destination's circuit breaker opens. While the circuit breaker is open, sends to the destination fail
+	// immediately. After CircuitBreakerCooldown one send is let through to probe the destination, and the circuit
+	// breaker closes if it succeeds.
+	// The default value is 0, meaning that sends are never short-circuited
+	CircuitBreakerThreshold int `env:"CIRCUIT_BREAKER_THRESHOLD"`
+
+	// CircuitBreakerCooldown specifies the time in seconds that a circuit breaker stays open before it lets
+	// a send through to probe the destination.
+	// The default value is 30
+	CircuitBreakerCooldown int `env:"CIRCUIT_BREAKER_COOLDOWN"`
+
 	// ESSPingInterval specifies the frequency in hours of ping messages that ESS sends to CSS
 	ESSPingInterval int16 `env:"ESS_PING_INTERVAL"`
 
@@ -241,12 +362,234 @@ type Config struct {
 	// A value of zero means ESSs are never removed
 	RemoveESSRegistrationTime int16 `env:"REMOVE_ESS_REGISTRATION_TIME"`
 
+	// ESSHeartbeatInterval specifies the frequency in seconds of heartbeat messages that ESS sends to CSS
+	// The CSS records the time it received the last heartbeat from each ESS
+	// A value of zero means heartbeats are not sent
+	ESSHeartbeatInterval int `env:"ESS_HEARTBEAT_INTERVAL"`
+
+	// DestinationStaleTimeout specifies the time period in seconds after which the CSS considers
+	// an ESS that has not been seen (registration, ping, or heartbeat) as stale. Notifications to a stale
+	// ESS are not sent, they are kept pending until the ESS is seen again.
+	// CSS only parameter, ignored on ESS
+	// A value of zero means ESSs are never considered stale
+	DestinationStaleTimeout int `env:"DESTINATION_STALE_TIMEOUT"`
+
+	// DestinationOfflineTimeout specifies the time period in seconds after which the CSS marks
+	// an ESS that has not been seen (registration, ping, or heartbeat) as offline. The notifications to an
+	// offline ESS are suspended, they are neither sent nor resent, until the ESS registers again.
+	// The check is done by the leader CSS. Should be much larger than the ping interval of the ESSs.
+	// CSS only parameter, ignored on ESS
+	// A value of zero means ESSs are never marked as offline
+	DestinationOfflineTimeout int `env:"DESTINATION_OFFLINE_TIMEOUT"`
+
+	// DeliveryDeadlineCheckInterval specifies the frequency in seconds of checking if there are objects that weren't
+	// received by some of their destinations by their delivery deadline (DeliverBy in the object's meta data).
+	// Each destination that didn't receive an object by its deadline is reported once in a notification event.
+	// The check is done by the leader CSS.
+	// CSS only parameter, ignored on ESS
+	// A value of zero means the delivery deadlines aren't checked. The default value is 60
+	DeliveryDeadlineCheckInterval int `env:"DELIVERY_DEADLINE_CHECK_INTERVAL"`
+
+	// EscalateOverdueObjects specifies whether the priority of an object that wasn't received by some of its destinations
+	// by its delivery deadline is raised to high, so that the destinations receive its data ahead of normal priority objects.
+	// CSS only parameter, ignored on ESS
+	// The default value is false
+	EscalateOverdueObjects bool `env:"ESCALATE_OVERDUE_OBJECTS"`
+
+	// PreStageObjects specifies whether objects can be created with a DestinationsList that includes destinations that
+	// haven't registered yet. The objects are pre-staged for these destinations, and are sent to each of them
+	// when it first registers. Objects sent to a single destination (DestType and DestID) are always pre-staged.
+	// CSS only parameter, ignored on ESS
+	// The default value is false (all the destinations in a DestinationsList must be registered)
+	PreStageObjects bool `env:"PRE_STAGE_OBJECTS"`
+
+	// WebhookMaxAttempts specifies the maximal number of times a webhook is called before giving up
+	// on it. A value of 1 means failed webhook calls are not retried.
+	WebhookMaxAttempts int `env:"WEBHOOK_MAX_ATTEMPTS"`
+
+	// WebhookRetryInterval specifies the time in seconds to wait before retrying a failed webhook call.
+	// The interval is doubled after each failed attempt.
+	WebhookRetryInterval int `env:"WEBHOOK_RETRY_INTERVAL"`
+
+	// WebhookDeadLetter specifies whether webhook calls that failed WebhookMaxAttempts times are kept in the storage
+	// for later inspection. Otherwise they are discarded.
+	WebhookDeadLetter bool `env:"WEBHOOK_DEAD_LETTER"`
+
 	// Maximum size of data that can be sent in one message
 	MaxDataChunkSize int `env:"MAX_DATA_CHUNK_SIZE"`
 
+	// ObjectChunkSize specifies the size of the chunks that the data of new objects is requested and tracked in.
+	// It can differ from MaxDataChunkSize: a data message carries several chunks if MaxDataChunkSize is larger,
+	// and a chunk is split across several data messages if MaxDataChunkSize is smaller.
+	// The default value is 0, meaning that MaxDataChunkSize is used
+	ObjectChunkSize int `env:"OBJECT_CHUNK_SIZE"`
+
 	// Max num of inflight chunks
 	MaxInflightChunks int `env:"MAX_INFLIGHT_CHUNKS"`
 
+	// MaxConcurrentTransfersPerDestination specifies the maximal number of objects whose data is received from
+	// a single destination (or from the CSS on an ESS) at the same time. The data of additional objects is requested
+	// when the transfers of the data of other objects complete.
+	// The default value is 0, meaning no limit
+	MaxConcurrentTransfersPerDestination int `env:"MAX_CONCURRENT_TRANSFERS_PER_DESTINATION"`
+
+	// DataSendRatePerDestination specifies the maximal number of bytes of objects' data per second sent to a single
+	// destination (or to the CSS on an ESS) in data messages. The sending of data messages that exceed the rate is
+	// deferred, without delaying the data of other destinations.
+	// The default value is 0, meaning no limit
+	DataSendRatePerDestination int `env:"DATA_SEND_RATE_PER_DESTINATION"`
+
+	// DataSendBurstPerDestination specifies the number of bytes that can be sent to a destination at once
+	// after it was idle, while DataSendRatePerDestination is set.
+	// The default value is 0, meaning the bytes of one second at DataSendRatePerDestination
+	DataSendBurstPerDestination int `env:"DATA_SEND_BURST_PER_DESTINATION"`
+
+	// MaxChunkResends specifies how many times a chunk of an object's data is requested again if it isn't received.
+	// When a chunk has to be requested more times, the transfer of the object's data fails. The object and the state of
+	// the transfer are kept, and the transfer can be retried.
+	// It also limits how many times the data of an object is requested again after the received data failed verification.
+	// The default value is 0, meaning no limit
+	MaxChunkResends int `env:"MAX_CHUNK_RESENDS"`
+
+	// MaxObjectSize specifies the maximum size in bytes of the data of an object received from the other side.
+	// Updates of larger objects are rejected, and their sender is notified with an error feedback.
+	// The default value is 0, meaning no limit
+	MaxObjectSize int64 `env:"MAX_OBJECT_SIZE"`
+
+	// FetchLinkedData specifies whether the data of objects received with a link is fetched from the link and stored as
+	// the objects' data. The http, https and file schemes are supported. Data larger than MaxObjectSize is rejected,
+	// and the objects' sender is notified with an error feedback if the data can't be fetched.
+	// The default value is false, meaning that objects with a link are received without data
+	FetchLinkedData bool `env:"FETCH_LINKED_DATA"`
+
+	// OutOfBandTransferThreshold specifies the object size in bytes above which the data of the objects is handed off
+	// through a presigned URL (e.g., of an S3 or MinIO bucket) instead of being sent in chunks. The URL is provided by the
+	// presigner registered by the application (see communications.RegisterDataURLPresigner), and the receiver downloads
+	// the data from it directly. The data is sent in chunks if no presigner is registered, or if the download fails.
+	// The default value is 0, meaning that the data is always sent in chunks
+	OutOfBandTransferThreshold int64 `env:"OUT_OF_BAND_TRANSFER_THRESHOLD"`
+
+	// OrderedObjectTypes specifies a comma separated list of object types whose objects are delivered to the applications
+	// of each destination in the order in which they were sent. An object that is received before the objects sent to
+	// the destination before it is held (its status is heldInOrder) until they are received, deleted or superseded.
+	// Objects of other types are delivered as soon as they are received.
+	// The default value is empty, meaning that objects are delivered as soon as they are received
+	OrderedObjectTypes string `env:"ORDERED_OBJECT_TYPES"`
+
+	// CompressionAlgorithm specifies the algorithm (none, gzip, or zstd) by which the data of objects is compressed
+	// in data messages. The algorithm is negotiated with the other side: if it doesn't support the algorithm, the most
+	// preferred algorithm (zstd, then gzip) that both sides support is used instead. gzip is always supported, zstd is
+	// supported if the application registered its compressor (see communications.RegisterCompressor).
+	// Data that doesn't get smaller is sent uncompressed.
+	// The default value is "none", meaning that the data is sent uncompressed
+	CompressionAlgorithm string `env:"COMPRESSION_ALGORITHM"`
+
+	// CompressionLevel specifies the level at which the data is compressed, 1-9 for gzip and 1-22 for zstd.
+	// Higher levels compress better and use more CPU.
+	// The default value is 0, meaning the default level of the algorithm
+	CompressionLevel int `env:"COMPRESSION_LEVEL"`
+
+	// SparseDataTransfer specifies whether the data messages of objects' data that is all zeros (e.g., the holes of sparse files)
+	// are sent as zero-fill directives, without the zeros. The receiver marks the zeros as received, and stores them sparsely
+	// where the storage supports it. The zeros are sent as data to peers that don't support zero-fill directives.
+	// The default value is false
+	SparseDataTransfer bool `env:"SPARSE_DATA_TRANSFER"`
+
+	// MaxObjectVersion specifies the newest version (major.minor) of objects' formats that the applications on the ESS can use.
+	// It is reported to the CSS when the ESS registers, and the CSS doesn't send the ESS objects that require a newer version.
+	// Not used on the CSS. The default value is empty, meaning that the ESS doesn't get objects that require a version
+	MaxObjectVersion string `env:"MAX_OBJECT_VERSION"`
+
+	// DestinationAttributes specifies the runtime attributes of the ESS, such as its firmware version or region,
+	// as a comma separated list of name=value pairs. They are reported to the CSS when the ESS registers, and the CSS
+	// sends the ESS the objects whose DestinationAttributes match them.
+	// Not used on the CSS. The default value is empty, meaning that the ESS has no attributes
+	DestinationAttributes string `env:"DESTINATION_ATTRIBUTES"`
+
+	// ChunkIntervalSetThreshold specifies the object size in bytes above which the received chunks of an object's data
+	// are tracked as a set of intervals instead of a bitmap with a bit per chunk. The chunks are mostly received in order,
+	// so the set takes much less memory than the bitmap of a very large object.
+	// The default value is 1GB, a value of 0 means that the bitmap is always used
+	ChunkIntervalSetThreshold int64 `env:"CHUNK_INTERVAL_SET_THRESHOLD"`
+
+	// MaxChunkBitmapSize specifies the maximum size in bytes of the bitmap that tracks the received chunks of an object's data.
+	// The bitmap has a bit per chunk of the object's chunk size, so a large object with a small chunk size requires a large
+	// bitmap. Updates of objects whose bitmap would be larger are rejected, and their sender is notified with an error feedback.
+	// The default value is 16MB, a value of 0 means no limit
+	MaxChunkBitmapSize int64 `env:"MAX_CHUNK_BITMAP_SIZE"`
+
+	// VerifyReceivedDataSize specifies whether the sizes of the received chunks of an object's data are verified to add up
+	// to the object's size before the object is marked as completely received. If they don't, the object's data is
+	// requested again.
+	// The default value is true
+	VerifyReceivedDataSize bool `env:"VERIFY_RECEIVED_DATA_SIZE"`
+
+	// StorageMaxAttempts specifies the maximal number of times a received chunk of data is appended to the storage
+	// when the storage fails with a transient error, such as a lost connection to the database, before giving up
+	// on the chunk and waiting for it to be resent. A value of 1 means the failed appends are not retried.
+	// The default value is 3
+	StorageMaxAttempts int `env:"STORAGE_MAX_ATTEMPTS"`
+
+	// StorageRetryInterval specifies the time in milliseconds to wait before appending a chunk of data again.
+	// The interval is doubled after each failed attempt.
+	// The default value is 100
+	StorageRetryInterval int `env:"STORAGE_RETRY_INTERVAL"`
+
+	// PriorityWeight specifies how many times more chunks are requested at once for a high priority object
+	// than for a normal priority object, while the data of high priority objects is being received.
+	// The inflight window of normal priority objects, and the number of their chunks requested again
+	// in each resend scan, are divided by PriorityWeight. A value of 1 means that both classes are treated equally.
+	// The default value is 4
+	PriorityWeight int `env:"PRIORITY_WEIGHT"`
+
+	// NumberOfObjectLocks specifies the number of locks in each set of object locks. Objects are mapped to the locks
+	// by the hash of their IDs, so a larger number reduces the contention between unrelated objects on a busy node.
+	// The value must be a power of two. The default value is 0, meaning 256 locks on an ESS and 1024 locks on a CSS.
+	NumberOfObjectLocks int `env:"NUMBER_OF_OBJECT_LOCKS"`
+
+	// LockStatistics specifies whether the time spent waiting for the locks of each set of object locks is measured,
+	// and reported in the usage section of the detailed health report. Measuring the locks adds to the cost of each lock.
+	// The default is false
+	LockStatistics bool `env:"LOCK_STATISTICS"`
+
+	// LockBucketStatistics specifies whether the time spent waiting for each lock of the sets of object locks, and
+	// the time each lock is held exclusively, are measured. The locks that were waited for the longest are reported
+	// with the statistics of their sets of locks in the usage section of the detailed health report.
+	// Setting LockBucketStatistics also measures the locks as LockStatistics does.
+	// The default is false
+	LockBucketStatistics bool `env:"LOCK_BUCKET_STATISTICS"`
+
+	// NotificationFanoutRate specifies the maximal number of notifications per second sent by the CSS
+	// when it resends the objects of a destination after a registration or a resend request.
+	// The limit is shared by all the destinations, so that a single reconnecting node can't starve the others.
+	// A value of zero means no limit
+	NotificationFanoutRate int `env:"NOTIFICATION_FANOUT_RATE"`
+
+	// RegistrationNotificationWorkers specifies the maximal number of objects whose notifications are sent concurrently
+	// by the CSS to a newly registered destination. The notifications of each object are still sent one at a time.
+	// The default value is 4
+	RegistrationNotificationWorkers int `env:"REGISTRATION_NOTIFICATION_WORKERS"`
+
+	// RegistrationDebounceInterval specifies the time in seconds after the CSS resent the notifications of a destination
+	// that registered again, during which further registrations of the destination don't resend the notifications,
+	// unless the destination doesn't persist its objects. Registrations that arrive while the notifications are being
+	// resent are coalesced into one more resend.
+	// The default value is 5
+	RegistrationDebounceInterval int `env:"REGISTRATION_DEBOUNCE_INTERVAL"`
+
+	// DefaultHashAlgorithm specifies the algorithm used to verify the data of objects that have a hash
+	// in their metadata, but don't specify the hash algorithm
+	// The options are 'sha1', 'sha256' (the default), and 'sha512'
+	DefaultHashAlgorithm string `env:"DEFAULT_HASH_ALGORITHM"`
+
+	// SignaturePublicKeysPath specifies a directory containing the public keys used to verify the signatures
+	// of the objects received from the other side. The PEM encoded public key (RSA or ECDSA) of an organization
+	// is in the file <orgID>.pem in the directory. The objects of an organization that has a public key must be signed,
+	// and their data is rejected if it doesn't match the signature.
+	// The path is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	// The default is empty, meaning signatures are not verified
+	SignaturePublicKeysPath string `env:"SIGNATURE_PUBLIC_KEYS_PATH"`
+
 	// MongoAddressCsv specifies one or more addresses of the mongo database
 	MongoAddressCsv string `env:"MONGO_ADDRESS_CSV"`
 
@@ -278,6 +621,33 @@ type Config struct {
 	// MongoSessionCacheSize specifies the number of MongoDB session copies to use
 	MongoSessionCacheSize int `env:"MONGO_SESSION_CACHE_SIZE"`
 
+	// S3Endpoint specifies the URL of an S3 compatible object store (e.g. https://minio.example.com:9000)
+	// in which the data of objects is stored, while their metadata remains in mongo.
+	// S3Endpoint can be used only when the StorageProvider is set to mongo.
+	// The default is empty (not set) meaning that the data is stored in mongo.
+	S3Endpoint string `env:"S3_ENDPOINT"`
+
+	// S3Bucket specifies the name of the bucket in which the data of objects is stored
+	S3Bucket string `env:"S3_BUCKET"`
+
+	// S3Region specifies the region of the S3 bucket
+	// The default value is us-east-1
+	S3Region string `env:"S3_REGION"`
+
+	// S3AccessKeyID specifies the access key ID used to sign the S3 requests
+	// If both S3AccessKeyID and S3SecretAccessKey are empty, the requests are not signed
+	S3AccessKeyID string `env:"S3_ACCESS_KEY_ID"`
+
+	// S3SecretAccessKey specifies the secret access key used to sign the S3 requests
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY"`
+
+	// DeduplicateData specifies whether the CSS stores the data of objects with identical content only once.
+	// The data of each object is hashed when it is completely stored, and objects with the same hash share one copy
+	// of the data, that is removed when no object refers to it.
+	// DeduplicateData can be used only when the StorageProvider is set to mongo and S3Endpoint isn't set.
+	// The default value is false
+	DeduplicateData bool `env:"DEDUPLICATE_DATA"`
+
 	// DatabaseConnectTimeout specifies that the timeout in seconds of database connection attempts on startup
 	// The default value is 300
 	DatabaseConnectTimeout int `env:"DATABASE_CONNECT_TIMEOUT"`
@@ -294,11 +664,65 @@ type Config struct {
 	// For the ESS the options are 'inmemory' (the default), and 'bolt'
 	StorageProvider string `env:"STORAGE_PROVIDER"`
 
+	// DataEncryptionKey specifies a hex encoded AES key (16, 24, or 32 bytes) used to encrypt the data of objects
+	// in the storage. The key must not change as long as the storage contains data encrypted with it.
+	// DataEncryptionKey can't be set together with ObjectsDataPath.
+	// The default is empty (not set) meaning that the data is stored as is
+	DataEncryptionKey string `env:"DATA_ENCRYPTION_KEY"`
+
+	// DataEncryptionKeyID specifies the ID of the DataEncryptionKey. The ID of the key is recorded with each object
+	// whose data is encrypted with it, so that the key can be rotated: the data of an object is always read with the
+	// key that encrypted it, while the data of new objects is encrypted with DataEncryptionKey.
+	// The default is empty
+	DataEncryptionKeyID string `env:"DATA_ENCRYPTION_KEY_ID"`
+
+	// PreviousDataEncryptionKeys specifies the keys that encrypted the data of objects before the DataEncryptionKey,
+	// as a comma separated list of id:key pairs, where key is a hex encoded AES key, and id is the DataEncryptionKeyID
+	// that was set with it (possibly empty, e.g., ":000102...").
+	// The data of the objects encrypted with a previous key is re-encrypted with the DataEncryptionKey in the background,
+	// and the previous key can be removed once no object's data is encrypted with it.
+	// The default is empty (no previous keys)
+	PreviousDataEncryptionKeys string `env:"PREVIOUS_DATA_ENCRYPTION_KEYS"`
+
+	// DataReencryptionInterval specifies the frequency in seconds of re-encrypting, with the DataEncryptionKey,
+	// the data of objects encrypted with one of the PreviousDataEncryptionKeys. A few objects are re-encrypted
+	// each time. 0 disables the re-encryption.
+	// The default is 60 seconds
+	DataReencryptionInterval int `env:"DATA_REENCRYPTION_INTERVAL"`
+
+	// DataWriteAheadLog specifies whether the ESS flushes each received chunk of an object's data to disk and logs it
+	// in a write-ahead log. After a restart, the chunks in the log are not requested again from the CSS.
+	// DataWriteAheadLog can be used only on an ESS when the StorageProvider is set to bolt.
+	// The default is false
+	DataWriteAheadLog bool `env:"DATA_WRITE_AHEAD_LOG"`
+
+	// CompressStoredData specifies whether the data of objects is stored gzip compressed. The data is compressed in
+	// blocks of up to MaxDataChunkSize bytes, so that chunks can still be stored and read at any offset.
+	// The data stored before CompressStoredData was set is still read, and it is compressed when it is stored again.
+	// CompressStoredData can be used only when the StorageProvider is set to bolt, and can't be set together with
+	// ObjectsDataPath or DataEncryptionKey (encrypted data doesn't compress).
+	// The default is false
+	CompressStoredData bool `env:"COMPRESS_STORED_DATA"`
+
 	// ESSConsumedObjectsKept specifies the number of objects sent by the ESS and consumed by the CSS
 	// that are kept by the ESS for reporting
 	// The default value is 1000
 	ESSConsumedObjectsKept int `env:"ESS_CONSUMED_OBJECTS_KEPT"`
 
+	// InMemoryMaxDataSizeKB specifies the maximal size in kilo bytes of the data kept by the in-memory storage of the ESS.
+	// When the limit is exceeded, the least recently used objects that were received by the app or consumed are evicted.
+	// Objects that are still being received or that weren't delivered to the app yet are never evicted.
+	// The default value is 0, meaning no limit
+	InMemoryMaxDataSizeKB int `env:"INMEMORY_MAX_DATA_SIZE_KB"`
+
+	// DataChunkCacheSizeKB specifies the maximal size in kilo bytes of the in-memory cache of the chunks of objects' data
+	// that were recently sent. When a popular object is sent to many destinations, the chunks that they request are read
+	// from the storage once. The chunks are cached by the instance of the object, so the chunks of an updated object's
+	// previous instance are never sent. When the cache is enabled, the chunks that a destination requests together are read
+	// from the storage one by one. When the limit is exceeded, the least recently used chunks are evicted.
+	// The default value is 0, meaning that the chunks aren't cached
+	DataChunkCacheSizeKB int `env:"DATA_CHUNK_CACHE_SIZE_KB"`
+
 	// MessagingGroupCacheExpiration specifies the expiration time in minutes of organization to messaging group mapping cache
 	MessagingGroupCacheExpiration int16 `env:"MESSAGING_GROUP_CACHE_EXPIRATION"`
 
@@ -306,6 +730,12 @@ type Config struct {
 	// The default values is 60 seconds
 	ShutdownQuiesceTime int `env:"SHUTDOWN_QUIESCE_TIME"`
 
+	// ShutdownDrainTimeout specifies the maximum time in seconds that the Sync Service waits, while shutting down, for the
+	// transfers of objects' data that it is receiving to complete. No new transfers are started while it waits.
+	// The state of the transfers that don't complete in time is checkpointed, so that they are resumed after a restart.
+	// The default value is 0, meaning that the transfers are checkpointed without waiting
+	ShutdownDrainTimeout int `env:"SHUTDOWN_DRAIN_TIMEOUT"`
+
 	// ObjectsDataPath specifies a directory in which the object's data should be persisted.
 	// The application can then access the object's data directly on the file system instead of reading
 	// the data via the Sync Service. Applications should only read/copy the data but not modify/delete it.
@@ -504,6 +934,14 @@ func ValidateConfig() error {
 		return &configError{"CSS on Watson IoTP should use wiotp protocol"}
 	}
 
+	if Configuration.ShardObjectOwnership && Configuration.NodeType == CSS && Configuration.CSSOnWIoTP {
+		return &configError{"ShardObjectOwnership is not supported by a CSS on Watson IoTP"}
+	}
+
+	if Configuration.ShardObjectOwnership && Configuration.SingleNodeCSS {
+		return &configError{"ShardObjectOwnership can't be set for a single node CSS"}
+	}
+
 	if (mqtt || (wiotp && (Configuration.UsingEdgeConnector || Configuration.NodeType == CSS))) &&
 		Configuration.MQTTUserName == "" && Configuration.MQTTPassword != "" {
 		// For ESS connecting not via EC with wiotp we set user name to use-auth-token,
@@ -615,6 +1053,38 @@ func ValidateConfig() error {
 		return &configError{"Invalid MQTTParallelMode, please specify any off: 'none', 'small', 'medium', 'large', or leave as empty string"}
 	}
 
+	if Configuration.MQTTQoS < 0 || Configuration.MQTTQoS > 2 {
+		return &configError{"Invalid MQTTQoS, please specify 0, 1, or 2"}
+	}
+
+	if Configuration.MQTTNotificationCompressionThreshold < 0 {
+		return &configError{"Invalid MQTTNotificationCompressionThreshold, please specify a non-negative value"}
+	}
+
+	if Configuration.MQTTDataTopics == 0 {
+		Configuration.MQTTDataTopics = 1
+	} else if Configuration.MQTTDataTopics < 0 || Configuration.MQTTDataTopics > MaxMQTTDataTopics {
+		return &configError{fmt.Sprintf("Invalid MQTTDataTopics, please specify a value between 1 and %d", MaxMQTTDataTopics)}
+	}
+
+	if Configuration.AckBatchWindow < 0 {
+		return &configError{"Invalid AckBatchWindow, please specify a non-negative value"}
+	}
+
+	if Configuration.AckBatchMaxSize < 0 {
+		return &configError{"Invalid AckBatchMaxSize, please specify a non-negative value"}
+	}
+	if Configuration.AckBatchMaxSize == 0 {
+		Configuration.AckBatchMaxSize = 100
+	}
+
+	if Configuration.ObjectChunkSize < 0 {
+		return &configError{"ObjectChunkSize can't be negative"}
+	}
+	if Configuration.ObjectChunkSize == 0 {
+		Configuration.ObjectChunkSize = Configuration.MaxDataChunkSize
+	}
+
 	if Configuration.MaxInflightChunks < 1 {
 		Configuration.MaxInflightChunks = 1
 	}
@@ -622,6 +1092,189 @@ func ValidateConfig() error {
 		Configuration.MaxInflightChunks = 64
 	}
 
+	if Configuration.MaxConcurrentTransfersPerDestination < 0 {
+		return &configError{"MaxConcurrentTransfersPerDestination can't be negative"}
+	}
+
+	if Configuration.DataSendRatePerDestination < 0 {
+		return &configError{"DataSendRatePerDestination can't be negative"}
+	}
+	if Configuration.DataSendBurstPerDestination < 0 {
+		return &configError{"DataSendBurstPerDestination can't be negative"}
+	}
+
+	if Configuration.MaxChunkResends < 0 {
+		return &configError{"MaxChunkResends can't be negative"}
+	}
+
+	if Configuration.NotificationFanoutRate < 0 {
+		return &configError{"NotificationFanoutRate can't be negative"}
+	}
+
+	if Configuration.RegistrationNotificationWorkers < 0 {
+		return &configError{"RegistrationNotificationWorkers can't be negative"}
+	} else if Configuration.RegistrationNotificationWorkers == 0 {
+		Configuration.RegistrationNotificationWorkers = 1
+	}
+
+	if Configuration.RegistrationDebounceInterval < 0 {
+		return &configError{"RegistrationDebounceInterval can't be negative"}
+	}
+
+	if Configuration.MaxObjectSize < 0 {
+		return &configError{"MaxObjectSize can't be negative"}
+	}
+
+	if Configuration.OutOfBandTransferThreshold < 0 {
+		return &configError{"OutOfBandTransferThreshold can't be negative"}
+	}
+
+	for _, objectType := range strings.Split(Configuration.OrderedObjectTypes, ",") {
+		if objectType = strings.TrimSpace(objectType); objectType != "" && !IsValidName(objectType) {
+			return &configError{fmt.Sprintf("Invalid object type %s in OrderedObjectTypes", objectType)}
+		}
+	}
+
+	Configuration.CompressionAlgorithm = strings.ToLower(Configuration.CompressionAlgorithm)
+	maxCompressionLevel := 0
+	switch Configuration.CompressionAlgorithm {
+	case "":
+		Configuration.CompressionAlgorithm = CompressionNone
+	case CompressionNone:
+	case CompressionGzip:
+		maxCompressionLevel = 9
+	case CompressionZstd:
+		maxCompressionLevel = 22
+	default:
+		return &configError{"Invalid CompressionAlgorithm, please specify any of: 'none', 'gzip', 'zstd', or leave as empty string"}
+	}
+	if Configuration.CompressionLevel < 0 || Configuration.CompressionLevel > maxCompressionLevel {
+		return &configError{fmt.Sprintf("Invalid CompressionLevel, please specify a value between 0 and %d for %s compression",
+			maxCompressionLevel, Configuration.CompressionAlgorithm)}
+	}
+
+	if Configuration.MaxObjectVersion != "" {
+		if _, err := ParseVersion(Configuration.MaxObjectVersion); err != nil {
+			return &configError{"Invalid MaxObjectVersion, please specify a version of the form major.minor"}
+		}
+	}
+
+	if _, err := DestinationAttributes(); err != nil {
+		return err
+	}
+
+	if Configuration.ChunkIntervalSetThreshold < 0 {
+		return &configError{"ChunkIntervalSetThreshold can't be negative"}
+	}
+
+	if Configuration.MaxChunkBitmapSize < 0 {
+		return &configError{"MaxChunkBitmapSize can't be negative"}
+	}
+
+	if Configuration.DataChunkCacheSizeKB < 0 {
+		return &configError{"DataChunkCacheSizeKB can't be negative"}
+	}
+
+	if Configuration.StorageMaxAttempts < 1 {
+		return &configError{"StorageMaxAttempts must be at least 1"}
+	}
+
+	if Configuration.StorageRetryInterval <= 0 {
+		return &configError{"StorageRetryInterval must be positive"}
+	}
+
+	if Configuration.PriorityWeight < 1 {
+		return &configError{"PriorityWeight must be at least 1"}
+	}
+
+	if Configuration.NumberOfObjectLocks < 0 || Configuration.NumberOfObjectLocks&(Configuration.NumberOfObjectLocks-1) != 0 {
+		return &configError{"NumberOfObjectLocks must be a power of two"}
+	}
+
+	var defaults Config
+	SetDefaultConfig(&defaults)
+	if Configuration.ResendInterval != defaults.ResendInterval {
+		if Configuration.NotificationResendInterval == defaults.NotificationResendInterval {
+			Configuration.NotificationResendInterval = Configuration.ResendInterval
+		}
+		if Configuration.ChunkResendInterval == defaults.ChunkResendInterval {
+			Configuration.ChunkResendInterval = int(Configuration.ResendInterval) * 6
+		}
+	}
+	if Configuration.NotificationResendInterval <= 0 {
+		return &configError{"NotificationResendInterval must be positive"}
+	}
+	if Configuration.ChunkResendInterval <= 0 {
+		return &configError{"ChunkResendInterval must be positive"}
+	}
+
+	if Configuration.ResendJitterPercent < 0 || Configuration.ResendJitterPercent > 100 {
+		return &configError{"ResendJitterPercent must be between 0 and 100"}
+	}
+
+	if Configuration.NotificationMaxAge < 0 {
+		return &configError{"Invalid NotificationMaxAge, please specify a non-negative value"}
+	}
+	if Configuration.MaxNotificationRecordsPerDestination < 0 {
+		return &configError{"Invalid MaxNotificationRecordsPerDestination, please specify a non-negative value"}
+	}
+
+	if Configuration.ReadinessMaxPendingNotificationAge < 0 {
+		return &configError{"Invalid ReadinessMaxPendingNotificationAge, please specify a non-negative value"}
+	}
+	if Configuration.ReadinessMaxActiveTransfers < 0 {
+		return &configError{"Invalid ReadinessMaxActiveTransfers, please specify a non-negative value"}
+	}
+	if Configuration.ShutdownDrainTimeout < 0 {
+		return &configError{"Invalid ShutdownDrainTimeout, please specify a non-negative value"}
+	}
+
+	if Configuration.CircuitBreakerThreshold < 0 {
+		return &configError{"Invalid CircuitBreakerThreshold, please specify a non-negative value"}
+	}
+	if Configuration.CircuitBreakerCooldown < 0 {
+		return &configError{"Invalid CircuitBreakerCooldown, please specify a non-negative value"}
+	}
+
+	if Configuration.ESSHeartbeatInterval < 0 {
+		return &configError{"ESSHeartbeatInterval can't be negative"}
+	}
+
+	if Configuration.TLSReloadInterval < 0 {
+		return &configError{"TLSReloadInterval can't be negative"}
+	}
+
+	if Configuration.DestinationStaleTimeout < 0 {
+		return &configError{"DestinationStaleTimeout can't be negative"}
+	}
+
+	if Configuration.DestinationOfflineTimeout < 0 {
+		return &configError{"DestinationOfflineTimeout can't be negative"}
+	}
+
+	if Configuration.DeliveryDeadlineCheckInterval < 0 {
+		return &configError{"DeliveryDeadlineCheckInterval can't be negative"}
+	}
+
+	if Configuration.WebhookMaxAttempts < 1 {
+		return &configError{"WebhookMaxAttempts must be at least 1"}
+	}
+
+	if Configuration.WebhookRetryInterval <= 0 {
+		return &configError{"WebhookRetryInterval must be positive"}
+	}
+
+	Configuration.DefaultHashAlgorithm = strings.ToLower(Configuration.DefaultHashAlgorithm)
+	switch Configuration.DefaultHashAlgorithm {
+	case SHA1:
+	case SHA256:
+	case SHA512:
+	case "":
+		Configuration.DefaultHashAlgorithm = SHA256
+	default:
+		return &configError{"Invalid DefaultHashAlgorithm, please specify any off: 'sha1', 'sha256', 'sha512', or leave as empty string"}
+	}
+
 	Configuration.StorageProvider = strings.ToLower(Configuration.StorageProvider)
 	if Configuration.NodeType == CSS {
 		if Configuration.StorageProvider == "" {
@@ -648,6 +1301,59 @@ func ValidateConfig() error {
 		}
 	}
 
+	if Configuration.DataEncryptionKey != "" {
+		if !isValidDataEncryptionKey(Configuration.DataEncryptionKey) {
+			return &configError{"Invalid DataEncryptionKey, it must be a hex encoded 16, 24, or 32 bytes key"}
+		}
+		if Configuration.ObjectsDataPath != "" {
+			return &configError{"DataEncryptionKey can't be set when ObjectsDataPath is set"}
+		}
+		if _, err := DataEncryptionKeys(); err != nil {
+			return err
+		}
+	} else if Configuration.PreviousDataEncryptionKeys != "" {
+		return &configError{"PreviousDataEncryptionKeys can't be set when DataEncryptionKey isn't set"}
+	}
+	if Configuration.DataReencryptionInterval < 0 {
+		return &configError{"DataReencryptionInterval can't be negative"}
+	}
+
+	if Configuration.DataWriteAheadLog && (Configuration.NodeType != ESS || Configuration.StorageProvider != Bolt) {
+		return &configError{"DataWriteAheadLog can only be set on an ESS when StorageProvider is 'bolt'"}
+	}
+
+	if Configuration.CompressStoredData {
+		if Configuration.StorageProvider != Bolt {
+			return &configError{"CompressStoredData can only be set when StorageProvider is 'bolt'"}
+		}
+		if Configuration.ObjectsDataPath != "" || Configuration.DataEncryptionKey != "" {
+			return &configError{"CompressStoredData can't be set when ObjectsDataPath or DataEncryptionKey is set"}
+		}
+	}
+
+	if Configuration.S3Endpoint != "" {
+		if Configuration.StorageProvider != Mongo {
+			return &configError{"Invalid S3Endpoint, it can only be set when StorageProvider is 'mongo'"}
+		}
+		if endpoint, err := url.Parse(Configuration.S3Endpoint); err != nil || endpoint.Host == "" ||
+			(endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			return &configError{fmt.Sprintf("Invalid S3Endpoint (%s), please specify an http or https URL", Configuration.S3Endpoint)}
+		}
+		if Configuration.S3Bucket == "" {
+			return &configError{"S3Bucket must be set when S3Endpoint is set"}
+		}
+		if (Configuration.S3AccessKeyID == "") != (Configuration.S3SecretAccessKey == "") {
+			return &configError{"Both S3AccessKeyID and S3SecretAccessKey must be set, or neither"}
+		}
+		if Configuration.S3Region == "" {
+			Configuration.S3Region = "us-east-1"
+		}
+	}
+
+	if Configuration.DeduplicateData && (Configuration.StorageProvider != Mongo || Configuration.S3Endpoint != "") {
+		return &configError{"DeduplicateData can only be set when StorageProvider is 'mongo' and S3Endpoint isn't set"}
+	}
+
 	return nil
 }
 
@@ -663,6 +1369,7 @@ func SetDefaultConfig(config *Config) {
 	config.SecureListeningPort = 8443
 	config.UnsecureListeningPort = 8080
 	config.LeadershipTimeout = 30
+	config.AdvertisedAddress = ""
 	config.AuthenticationHandler = "dummy"
 	config.CSSOnWIoTP = false
 	config.UsingEdgeConnector = false
@@ -671,6 +1378,11 @@ func SetDefaultConfig(config *Config) {
 	config.PersistenceRootPath = "/var/edge-sync-service/persist"
 	config.MQTTCACertificate = "broker/ca/ca.cert.pem"
 	config.MQTTBrokerConnectTimeout = 300
+	config.MQTTQoS = 0
+	config.MQTTNotificationCompressionThreshold = 0
+	config.MQTTDataTopics = 1
+	config.AckBatchWindow = 0
+	config.AckBatchMaxSize = 100
 	config.LogLevel = "INFO"
 	config.LogRootPath = "/var/edge-sync-service/log"
 	config.LogFileName = "sync-service"
@@ -682,10 +1394,51 @@ func SetDefaultConfig(config *Config) {
 	config.LogTraceDestination = "file"
 	config.LogTraceMaintenanceInterval = 60
 	config.ResendInterval = 5
+	config.NotificationResendInterval = config.ResendInterval
+	config.ChunkResendInterval = int(config.ResendInterval) * 6
+	config.ResendJitterPercent = 0
+	config.NotificationMaxAge = 0
+	config.MaxNotificationRecordsPerDestination = 0
+	config.ReadinessMaxPendingNotificationAge = 0
+	config.ReadinessMaxActiveTransfers = 0
+	config.CircuitBreakerThreshold = 0
+	config.CircuitBreakerCooldown = 30
 	config.ESSPingInterval = 1
 	config.RemoveESSRegistrationTime = 30
+	config.ESSHeartbeatInterval = 0
+	config.DestinationStaleTimeout = 0
+	config.DestinationOfflineTimeout = 0
+	config.DeliveryDeadlineCheckInterval = 60
+	config.EscalateOverdueObjects = false
+	config.PreStageObjects = false
+	config.WebhookMaxAttempts = 5
+	config.WebhookRetryInterval = 10
+	config.WebhookDeadLetter = false
 	config.MaxDataChunkSize = 120 * 1024
 	config.MaxInflightChunks = 1
+	config.MaxConcurrentTransfersPerDestination = 0
+	config.DataSendRatePerDestination = 0
+	config.DataSendBurstPerDestination = 0
+	config.MaxChunkResends = 0
+	config.ChunkIntervalSetThreshold = 1024 * 1024 * 1024
+	config.MaxChunkBitmapSize = 16 * 1024 * 1024
+	config.VerifyReceivedDataSize = true
+	config.OutOfBandTransferThreshold = 0
+	config.OrderedObjectTypes = ""
+	config.CompressionAlgorithm = CompressionNone
+	config.CompressionLevel = 0
+	config.SparseDataTransfer = false
+	config.StorageMaxAttempts = 3
+	config.StorageRetryInterval = 100
+	config.PriorityWeight = 4
+	config.NumberOfObjectLocks = 0
+	config.LockStatistics = false
+	config.LockBucketStatistics = false
+	config.NotificationFanoutRate = 0
+	config.RegistrationNotificationWorkers = 4
+	config.RegistrationDebounceInterval = 5
+	config.DefaultHashAlgorithm = SHA256
+	config.SignaturePublicKeysPath = ""
 	config.MongoAddressCsv = "localhost:27017"
 	config.MongoDbName = "d_edge"
 	config.MongoAuthDbName = "admin"
@@ -695,14 +1448,83 @@ func SetDefaultConfig(config *Config) {
 	config.MongoCACertificate = ""
 	config.MongoAllowInvalidCertificates = false
 	config.MongoSessionCacheSize = 1
+	config.S3Region = "us-east-1"
 	config.DatabaseConnectTimeout = 300
 	config.StorageMaintenanceInterval = 30
+	config.DataReencryptionInterval = 60
 	config.ObjectActivationInterval = 30
 	config.CommunicationProtocol = MQTTProtocol
 	config.HTTPPollingInterval = 10
 	config.HTTPCSSUseSSL = false
 	config.HTTPCSSCACertificate = ""
+	config.TLSReloadInterval = 0
 	config.MessagingGroupCacheExpiration = 60
 	config.ShutdownQuiesceTime = 60
+	config.ShutdownDrainTimeout = 0
 	config.ESSConsumedObjectsKept = 1000
+	config.InMemoryMaxDataSizeKB = 0
+	config.DataChunkCacheSizeKB = 0
+}
+
+// IsOrderedObjectType returns true if the objects of the type are delivered in the order in which they were sent
+// (see OrderedObjectTypes)
+func IsOrderedObjectType(objectType string) bool {
+	if Configuration.OrderedObjectTypes == "" {
+		return false
+	}
+	for _, orderedType := range strings.Split(Configuration.OrderedObjectTypes, ",") {
+		if strings.TrimSpace(orderedType) == objectType {
+			return true
+		}
+	}
+	return false
+}
+
+// DataEncryptionKeys returns the keys that encrypt the data of objects, the DataEncryptionKey and the
+// PreviousDataEncryptionKeys, by their IDs
+func DataEncryptionKeys() (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	if Configuration.DataEncryptionKey == "" {
+		return keys, nil
+	}
+	keys[Configuration.DataEncryptionKeyID], _ = hex.DecodeString(Configuration.DataEncryptionKey)
+
+	if Configuration.PreviousDataEncryptionKeys == "" {
+		return keys, nil
+	}
+	for _, pair := range strings.Split(Configuration.PreviousDataEncryptionKeys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || !isValidDataEncryptionKey(parts[1]) {
+			return nil, &configError{"Invalid PreviousDataEncryptionKeys, each key must be an id:key pair with a hex encoded 16, 24, or 32 bytes key"}
+		}
+		if _, ok := keys[parts[0]]; ok {
+			return nil, &configError{fmt.Sprintf("Invalid PreviousDataEncryptionKeys, the key ID '%s' is used more than once", parts[0])}
+		}
+		keys[parts[0]], _ = hex.DecodeString(parts[1])
+	}
+	return keys, nil
+}
+
+// DestinationAttributes returns the runtime attributes of the ESS set in DestinationAttributes
+func DestinationAttributes() (map[string]string, error) {
+	if Configuration.DestinationAttributes == "" {
+		return nil, nil
+	}
+	attributes := make(map[string]string)
+	for _, pair := range strings.Split(Configuration.DestinationAttributes, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || !IsValidName(parts[0]) {
+			return nil, &configError{"Invalid DestinationAttributes, each attribute must be a name=value pair with a name of letters, digits, and !@#%^*-_.~"}
+		}
+		if _, ok := attributes[parts[0]]; ok {
+			return nil, &configError{fmt.Sprintf("Invalid DestinationAttributes, the attribute '%s' is set more than once", parts[0])}
+		}
+		attributes[parts[0]] = parts[1]
+	}
+	return attributes, nil
+}
+
+func isValidDataEncryptionKey(hexKey string) bool {
+	key, err := hex.DecodeString(hexKey)
+	return err == nil && (len(key) == 16 || len(key) == 24 || len(key) == 32)
 }
@@ -52,11 +52,71 @@ type MQTTHealthStatusInfo struct {
 // UsageInfo describes the usage of the sync-service node
 // swagger:model
 type UsageInfo struct {
-	ClientRequests uint64 `json:"clientRequests"`
-	RegisteredESS  uint32 `json:"registeredESS"`
-	StoredObjects  uint32 `json:"storedObjects"`
+	ClientRequests       uint64           `json:"clientRequests"`
+	RegisteredESS        uint32           `json:"registeredESS"`
+	StoredObjects        uint32           `json:"storedObjects"`
+	PendingNotifications uint32           `json:"pendingNotifications"`
+	CompletedTransfers   uint64           `json:"completedTransfers"`
+	TransferredBytes     uint64           `json:"transferredBytes"`
+	Locks                []LockStatistics `json:"locks,omitempty"`
+
+	// RejectedNotificationRecords is the number of new notification records that were rejected, as their destinations
+	// reached MaxNotificationRecordsPerDestination records
+	RejectedNotificationRecords uint64 `json:"rejectedNotificationRecords"`
+
+	// LastTransfers are the most recently completed transfers of objects' data, the most recent first
+	LastTransfers []TransferInfo `json:"lastTransfers,omitempty"`
 }
 
+// TransferInfo describes a completed transfer of an object's data from its origin
+// swagger:model
+type TransferInfo struct {
+	OrgID      string `json:"orgID" bson:"org-id"`
+	ObjectType string `json:"objectType" bson:"object-type"`
+	ObjectID   string `json:"objectID" bson:"object-id"`
+	OriginType string `json:"originType" bson:"origin-type"`
+	OriginID   string `json:"originID" bson:"origin-id"`
+
+	// Size is the number of bytes transferred
+	Size int64 `json:"size" bson:"size"`
+
+	// Duration is the time in milliseconds from the request of the first chunk until the last chunk was received
+	Duration uint64 `json:"duration" bson:"duration"`
+
+	// Rate is the effective transfer rate in bytes per second
+	Rate uint64 `json:"rate" bson:"rate"`
+}
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreakerStatistics describes the circuit breaker of the sends to a destination
+// swagger:model
+type CircuitBreakerStatistics struct {
+	OrgID    string `json:"orgID"`
+	DestType string `json:"destinationType"`
+	DestID   string `json:"destinationID"`
+
+	// State is one of closed, open, or half-open
+	State               string `json:"state"`
+	ConsecutiveFailures uint32 `json:"consecutiveFailures"`
+
+	// Trips is the number of times the circuit breaker opened
+	Trips uint64 `json:"trips"`
+
+	// Rejected is the number of sends that were short-circuited while the circuit breaker was open
+	Rejected uint64 `json:"rejected"`
+}
+
+// maxLastTransfers is the number of recently completed transfers reported in the usage info
+const maxLastTransfers = 20
+
+var lastTransfers []TransferInfo
+
 // HealthStatus describes the health status of the sync-service node
 var HealthStatus HealthStatusInfo
 
@@ -119,6 +179,13 @@ func (hs *HealthStatusInfo) ReconnectedToBroker() {
 	MQTTHealth.DisconnectedFromMQTTBroker = false
 }
 
+// IsConnectedToBroker returns false if the node is disconnected from the MQTT broker
+func (hs *HealthStatusInfo) IsConnectedToBroker() bool {
+	hs.lock()
+	defer hs.unLock()
+	return !MQTTHealth.DisconnectedFromMQTTBroker
+}
+
 // GetLastDisconnectFromBrokerDuration returns the duration of the last disconnect from the MQTT broker
 // In case the node is currently disconnected, LastDisconnectFromBrokerDuration will be 0, and this function
 // has to be called to calculated the duration of the current disconnect.
@@ -185,13 +252,37 @@ func (hs *HealthStatusInfo) ClientRequestReceived() {
 	HealthUsageInfo.ClientRequests++
 }
 
+// NotificationRecordRejected increments the rejected notification records counter
+func (hs *HealthStatusInfo) NotificationRecordRejected() {
+	hs.lock()
+	defer hs.unLock()
+	HealthUsageInfo.RejectedNotificationRecords++
+}
+
+// TransferCompleted records the completion of a transfer of an object's data
+func (hs *HealthStatusInfo) TransferCompleted(transfer TransferInfo) {
+	hs.lock()
+	defer hs.unLock()
+	HealthUsageInfo.CompletedTransfers++
+	HealthUsageInfo.TransferredBytes += uint64(transfer.Size)
+	lastTransfers = append([]TransferInfo{transfer}, lastTransfers...)
+	if len(lastTransfers) > maxLastTransfers {
+		lastTransfers = lastTransfers[:maxLastTransfers]
+	}
+}
+
 // UpdateHealthInfo updates the current health status of the sync service node
-func (hs *HealthStatusInfo) UpdateHealthInfo(details bool, registeredESS uint32, storedObjects uint32) {
+func (hs *HealthStatusInfo) UpdateHealthInfo(details bool, registeredESS uint32, storedObjects uint32, pendingNotifications uint32) {
 	hs.lock()
 	defer hs.unLock()
 
 	HealthUsageInfo.RegisteredESS = registeredESS
 	HealthUsageInfo.StoredObjects = storedObjects
+	HealthUsageInfo.PendingNotifications = pendingNotifications
+	if details {
+		HealthUsageInfo.Locks = GetLocksStatistics()
+		HealthUsageInfo.LastTransfers = append([]TransferInfo(nil), lastTransfers...)
+	}
 
 	DBHealth.DBStatus = Green
 	timeSinceLastError := uint64(0)
@@ -202,9 +293,9 @@ func (hs *HealthStatusInfo) UpdateHealthInfo(details bool, registeredESS uint32,
 	if DBHealth.DisconnectedFromDB {
 		DBHealth.DBStatus = Red
 	} else if DBHealth.DBReadFailures != 0 || DBHealth.DBWriteFailures != 0 {
-		if timeSinceLastError < uint64(Configuration.ResendInterval*12) {
+		if timeSinceLastError < uint64(Configuration.NotificationResendInterval*12) {
 			DBHealth.DBStatus = Red
-		} else if timeSinceLastError < uint64(Configuration.ResendInterval*60) {
+		} else if timeSinceLastError < uint64(Configuration.NotificationResendInterval*60) {
 			DBHealth.DBStatus = Yellow
 		}
 	}
@@ -225,14 +316,14 @@ func (hs *HealthStatusInfo) UpdateHealthInfo(details bool, registeredESS uint32,
 			MQTTHealth.MQTTConnectionStatus = Red
 		} else {
 			if MQTTHealth.SubscribeFailures != 0 {
-				if timeSinceLastSubError < uint64(Configuration.ResendInterval*12) {
+				if timeSinceLastSubError < uint64(Configuration.NotificationResendInterval*12) {
 					MQTTHealth.MQTTConnectionStatus = Red
-				} else if timeSinceLastSubError < uint64(Configuration.ResendInterval*60) {
+				} else if timeSinceLastSubError < uint64(Configuration.NotificationResendInterval*60) {
 					MQTTHealth.MQTTConnectionStatus = Yellow
 				}
 			}
 			if MQTTHealth.PublishFailures != 0 && MQTTHealth.MQTTConnectionStatus == Green &&
-				timeSinceLastPubError < uint64(Configuration.ResendInterval*12) {
+				timeSinceLastPubError < uint64(Configuration.NotificationResendInterval*12) {
 				MQTTHealth.MQTTConnectionStatus = Yellow
 			}
 		}
@@ -0,0 +1,53 @@
+package common
+
+import "encoding/json"
+
+// The meta data of objects is sent between nodes of different versions, and stored by older versions of the sync service.
+// To add a field to MetaData without requiring all the nodes to upgrade at once:
+//   - Add the field, such that older nodes can ignore it.
+//   - Append to metaDataUpgrades a function that sets the field's default in meta data of an older schema,
+//     which doesn't have the field. MetaDataSchemaVersion is the number of upgrades.
+// Unknown fields, sent by nodes of a newer schema, are ignored.
+
+// metaDataUpgrades upgrade meta data from each schema version to the next one: metaDataUpgrades[i] upgrades
+// meta data of schema version i to schema version i+1
+var metaDataUpgrades = []func(metaData *MetaData){
+	// Schema version 1 added the schema version
+	func(metaData *MetaData) {},
+}
+
+// MetaDataSchemaVersion is the current version of the schema of MetaData
+var MetaDataSchemaVersion = len(metaDataUpgrades)
+
+// UpgradeMetaData upgrades meta data of an older schema to the current schema, by setting the defaults
+// of the fields that were added since the meta data's schema version
+func UpgradeMetaData(metaData *MetaData) {
+	if metaData.SchemaVersion < 0 {
+		metaData.SchemaVersion = 0
+	}
+	for version := metaData.SchemaVersion; version < len(metaDataUpgrades); version++ {
+		metaDataUpgrades[version](metaData)
+	}
+	if metaData.SchemaVersion < MetaDataSchemaVersion {
+		metaData.SchemaVersion = MetaDataSchemaVersion
+	}
+}
+
+// MarshalJSON serializes the meta data with the current schema version
+func (metaData MetaData) MarshalJSON() ([]byte, error) {
+	type plainMetaData MetaData
+	metaData.SchemaVersion = MetaDataSchemaVersion
+	return json.Marshal(plainMetaData(metaData))
+}
+
+// UnmarshalJSON parses the meta data and upgrades it to the current schema
+func (metaData *MetaData) UnmarshalJSON(data []byte) error {
+	type plainMetaData MetaData
+	parsed := plainMetaData(*metaData)
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	*metaData = MetaData(parsed)
+	UpgradeMetaData(metaData)
+	return nil
+}
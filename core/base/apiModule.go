@@ -17,6 +17,8 @@ import (
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
+
+	"github.com/google/uuid"
 )
 
 var apiLock sync.RWMutex
@@ -74,6 +76,15 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		}
 	}
 
+	if metaData.DeliverBy != "" {
+		if common.Configuration.NodeType == common.ESS {
+			return &common.InvalidRequest{Message: "Object delivery deadline is disabled on ESS"}
+		}
+		if _, err := time.Parse(time.RFC3339, metaData.DeliverBy); err != nil {
+			return &common.InvalidRequest{Message: "Failed to parse delivery deadline in object's meta data. Error: " + err.Error()}
+		}
+	}
+
 	if metaData.MetaOnly && len(data) != 0 {
 		return &common.InvalidRequest{Message: "Can't update data if MetaOnly is true"}
 	}
@@ -91,6 +102,32 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		return &common.InvalidRequest{Message: "Unsupported char <, > in destinationsList."}
 	}
 
+	if metaData.DestGroup != "" {
+		if common.Configuration.NodeType == common.ESS {
+			return &common.InvalidRequest{Message: "Destination groups are not supported for ESS"}
+		}
+		if metaData.DestType != "" || metaData.DestinationsList != nil || metaData.DestinationPolicy != nil {
+			return &common.InvalidRequest{Message: "Destination group can't be specified with destination type, list, or policy"}
+		}
+		if !common.IsValidName(metaData.DestGroup) {
+			return &common.InvalidRequest{Message: fmt.Sprintf("Destination group (%s) contains invalid characters", metaData.DestGroup)}
+		}
+	}
+
+	if metaData.DestinationAttributes != nil {
+		if common.Configuration.NodeType == common.ESS {
+			return &common.InvalidRequest{Message: "Destination attributes are not supported for ESS"}
+		}
+		if metaData.DestinationPolicy != nil {
+			return &common.InvalidRequest{Message: "Both destination policy and destination attributes are specified"}
+		}
+		for name := range metaData.DestinationAttributes {
+			if !common.IsValidName(name) {
+				return &common.InvalidRequest{Message: fmt.Sprintf("Destination attribute (%s) contains invalid characters", name)}
+			}
+		}
+	}
+
 	if metaData.DestinationPolicy != nil {
 		if metaData.DestType != "" {
 			return &common.InvalidRequest{Message: "Both destination policy and destination type are specified"}
@@ -143,6 +180,36 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		return &common.InvalidRequest{Message: "Object marked as deleted"}
 	}
 
+	if metaData.Hash != "" {
+		if _, err := common.NewHash(metaData.HashAlgorithm); err != nil {
+			return err
+		}
+	}
+
+	if metaData.Priority != common.PriorityNormal && metaData.Priority != common.PriorityHigh {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Invalid priority %d in object's meta data", metaData.Priority)}
+	}
+
+	if metaData.QoS != nil && (*metaData.QoS < 0 || *metaData.QoS > 2) {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Invalid QoS %d in object's meta data", *metaData.QoS)}
+	}
+
+	if metaData.RequiredVersion != "" {
+		if _, err := common.ParseVersion(metaData.RequiredVersion); err != nil {
+			return &common.InvalidRequest{Message: fmt.Sprintf("Invalid required version %s in object's meta data", metaData.RequiredVersion)}
+		}
+	}
+
+	if len(metaData.PatchRanges) != 0 && (metaData.MetaOnly || metaData.NoData || metaData.Link != "") {
+		return &common.InvalidRequest{Message: "Patch ranges can't be used with MetaOnly, NoData, or Link"}
+	}
+	for _, patchRange := range metaData.PatchRanges {
+		if patchRange.Offset < 0 || patchRange.Length <= 0 {
+			return &common.InvalidRequest{Message: fmt.Sprintf("Invalid patch range (offset %d, length %d) in object's meta data",
+				patchRange.Offset, patchRange.Length)}
+		}
+	}
+
 	if metaData.DestinationDataURI != "" {
 		if common.Configuration.NodeType == common.ESS {
 			return &common.InvalidRequest{Message: "Data URI is disabled on CSS"}
@@ -182,6 +249,13 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		metaData.DestOrgID = orgID
 	}
 
+	if metaData.TraceID == "" {
+		metaData.TraceID = uuid.New().String()
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Updating %s %s%s\n", objectType, objectID, common.TraceIDTag(&metaData))
+	}
+
 	if metaData.ExpectedConsumers == 0 {
 		metaData.ExpectedConsumers = 1
 	} else if metaData.ExpectedConsumers == -1 {
@@ -209,13 +283,32 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 	} else if data != nil {
 		metaData.ObjectSize = int64(len(data))
 	}
-	metaData.ChunkSize = common.Configuration.MaxDataChunkSize
+	metaData.ChunkSize = common.Configuration.ObjectChunkSize
+	if metaData.ChunkSize <= 0 {
+		metaData.ChunkSize = common.Configuration.MaxDataChunkSize
+	}
 
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	apiObjectLocks.Lock(lockIndex)
 	defer apiObjectLocks.Unlock(lockIndex)
 
 	common.ObjectLocks.Lock(lockIndex)
+
+	// The patch ranges apply to the data currently stored for the object
+	metaData.PatchBaseDataID = 0
+	if len(metaData.PatchRanges) != 0 {
+		existingMeta, err := store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return err
+		}
+		if existingMeta == nil || existingMeta.NoData || existingMeta.Link != "" {
+			metaData.PatchRanges = nil
+		} else {
+			metaData.PatchBaseDataID = existingMeta.DataID
+		}
+	}
+
 	deletedDestinations, err := store.StoreObject(metaData, data, status)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
@@ -277,6 +370,38 @@ func GetObjectStatus(orgID string, objectType string, objectID string) (string,
 	return store.RetrieveObjectStatus(orgID, objectType, objectID)
 }
 
+// GetObjectTransferProgress returns the progress of receiving the data of an object from the other side
+// Returns nil if the object doesn't exist or wasn't received from the other side
+func GetObjectTransferProgress(orgID string, objectType string, objectID string) (*common.TransferProgress, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In GetObjectTransferProgress. Get progress of %s %s\n", objectType, objectID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.RLock(lockIndex)
+	defer apiObjectLocks.RUnlock(lockIndex)
+
+	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil || metaData == nil {
+		return nil, err
+	}
+
+	if progress, ok := communications.GetTransferProgress(orgID, objectType, objectID, metaData.OriginType, metaData.OriginID); ok {
+		return &progress, nil
+	}
+
+	switch status {
+	case common.PartiallyReceived:
+		// The data hasn't been requested yet, or the node restarted in the middle of the transfer
+		return &common.TransferProgress{TotalBytes: metaData.ObjectSize}, nil
+	case common.CompletelyReceived, common.ObjReceived, common.ObjConsumed:
+		return &common.TransferProgress{ReceivedBytes: metaData.ObjectSize, TotalBytes: metaData.ObjectSize}, nil
+	}
+	return nil, nil
+}
+
 // ListUpdatedObjects provides a list of edge updated objects
 // Call the storage module to get the list of edge updated objects and send it to the app
 func ListUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
@@ -419,7 +544,15 @@ func GetObjectData(orgID string, objectType string, objectID string) (io.Reader,
 	if metaData.SourceDataURI != "" && status == common.ReadyToSend {
 		return dataURI.GetData(metaData.SourceDataURI)
 	}
-	return store.RetrieveObjectData(orgID, objectType, objectID)
+	dataCodec, err := storage.GetObjectDataCodec(store, orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	dataReader, err := store.RetrieveObjectData(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	return dataCodec.NewDecodingReader(dataReader, 0), nil
 }
 
 // GetRemovedDestinationPolicyServicesFromESS get the removedDestinationPolicyServices list
@@ -457,6 +590,16 @@ func PutObjectData(orgID string, objectType string, objectID string, dataReader
 	apiObjectLocks.Lock(lockIndex)
 	defer apiObjectLocks.Unlock(lockIndex)
 
+	// The data replaces the data of an upload in progress
+	if err := removeObjectUpload(orgID, objectType, objectID); err != nil {
+		return false, err
+	}
+	return putObjectData(orgID, objectType, objectID, dataReader)
+}
+
+// putObjectData stores an object's data and notifies its destinations. Must be called while holding the object's API lock.
+func putObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 
 	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
@@ -477,6 +620,12 @@ func PutObjectData(orgID string, objectType string, objectID string, dataReader
 		return false, &common.InvalidRequest{Message: "Can't update data, the NoData flag is set to true"}
 	}
 
+	dataCodec, err := storage.NewObjectDataCodec()
+	if err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return false, err
+	}
+	dataReader = dataCodec.NewEncodingReader(dataReader, 0)
 	if exists, err := store.StoreObjectData(orgID, objectType, objectID, dataReader); err != nil || !exists {
 		common.ObjectLocks.Unlock(lockIndex)
 		return false, err
@@ -577,6 +726,41 @@ func ObjectConsumed(orgID string, objectType string, objectID string) common.Syn
 	return nil
 }
 
+// ObjectPartiallyConsumed is used when an app indicates that it consumed the object's data up to offset
+// Send "partially consumed" notification to the object's origin
+func ObjectPartiallyConsumed(orgID string, objectType string, objectID string, offset int64) common.SyncServiceError {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ObjectPartiallyConsumed. Partially consumed %s %s up to offset %d\n", objectType, objectID, offset)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	common.ObjectLocks.Lock(lockIndex)
+	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	common.ObjectLocks.Unlock(lockIndex)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to find object %s to mark as partially consumed. Error: %s", orgID+":"+objectType+":"+objectID, err.Error())
+		}
+		return err
+	}
+	if status == "" {
+		return &common.InvalidRequest{Message: "Failed to find object to mark as partially consumed"}
+	}
+	if status != common.CompletelyReceived && status != common.ObjReceived {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Invalid attempt to mark object in status %s as partially consumed", status)}
+	}
+	if offset < 0 || offset > metaData.ObjectSize {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Invalid offset %d of an object of size %d", offset, metaData.ObjectSize)}
+	}
+
+	return communications.Comm.SendPartiallyConsumed(metaData, offset)
+}
+
 // ObjectPolicyReceived is called when an application wants to mark an object as having received its
 // destination policy
 func ObjectPolicyReceived(orgID string, objectType string, objectID string) common.SyncServiceError {
@@ -837,7 +1021,7 @@ func DeleteObject(orgID string, objectType string, objectID string) common.SyncS
 			return &common.InvalidRequest{Message: "Can't delete object on the receiving side for ESS"}
 		}
 		// CSS removes them without notifying the other side
-		err = storage.DeleteStoredObject(store, *metaData)
+		err = communications.DeleteStoredObject(*metaData)
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	}
@@ -846,6 +1030,10 @@ func DeleteObject(orgID string, objectType string, objectID string) common.SyncS
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	}
+	if err := removeObjectUpload(orgID, objectType, objectID); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return err
+	}
 
 	if err := store.MarkObjectDeleted(orgID, objectType, objectID); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
@@ -861,6 +1049,23 @@ func DeleteObject(orgID string, objectType string, objectID string) common.SyncS
 	return communications.SendNotifications(notificationsInfo)
 }
 
+// DeleteObjectsWithFilter deletes the objects originated by this node that meet the given conditions
+// Returns the number of objects being deleted
+func DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) (int, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In DeleteObjectsWithFilter. Delete %s %s %s %s\n", objectType, destinationType, destinationID, expirationTimeBefore)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if objectType == "" && destinationType == "" && expirationTimeBefore == "" {
+		return 0, &common.InvalidRequest{Message: "At least one of objectType, destinationType, and expirationTimeBefore must be specified"}
+	}
+
+	return communications.DeleteObjectsWithFilter(orgID, objectType, destinationType, destinationID, expirationTimeBefore)
+}
+
 // ActivateObject activates an inactive object
 // Call the storage module to activate the object and return the response
 func ActivateObject(orgID string, objectType string, objectID string) common.SyncServiceError {
@@ -908,8 +1113,8 @@ func ActivateObject(orgID string, objectType string, objectID string) common.Syn
 	return nil
 }
 
-// ListDestinations lists all destinations
-func ListDestinations(orgID string) ([]common.Destination, common.SyncServiceError) {
+// ListDestinations lists all destinations and the time each of them was last seen
+func ListDestinations(orgID string) ([]common.DestinationInfo, common.SyncServiceError) {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ListDestinations.\n")
 	}
@@ -919,7 +1124,94 @@ func ListDestinations(orgID string) ([]common.Destination, common.SyncServiceErr
 	apiLock.RLock()
 	defer apiLock.RUnlock()
 
-	return store.RetrieveDestinations(orgID, "")
+	return store.RetrieveDestinationsInfo(orgID, "")
+}
+
+// PauseDestination pauses or resumes sending data to the destination.
+// The objects of a paused destination are kept, and their transfers continue when the destination is resumed.
+func PauseDestination(orgID string, destType string, destID string, paused bool) common.SyncServiceError {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In PauseDestination. Destination %s:%s:%s, paused %t\n", orgID, destType, destID, paused)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return &common.InvalidRequest{Message: "ESS doesn't support pausing destinations"}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	if exists, err := store.DestinationExists(orgID, destType, destID); err != nil {
+		return err
+	} else if !exists {
+		return &common.NotFound{}
+	}
+
+	if err := store.UpdateDestinationPaused(orgID, destType, destID, paused); err != nil {
+		return err
+	}
+	if !paused {
+		communications.ResumeDestinationTransfers(orgID, destType, destID)
+	}
+	return nil
+}
+
+// UpdateDestinationGroup adds the destination to the destination group, or removes it from the group.
+// A destination that joins a group is sent the objects of the group.
+func UpdateDestinationGroup(orgID string, destType string, destID string, group string, member bool) common.SyncServiceError {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In UpdateDestinationGroup. Destination %s:%s:%s, group %s, member %t\n", orgID, destType, destID, group, member)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return &common.InvalidRequest{Message: "ESS doesn't support destination groups"}
+	}
+	if !common.IsValidName(group) {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Destination group (%s) contains invalid characters", group)}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	if !member {
+		return store.RemoveDestinationFromGroup(orgID, group, destType, destID)
+	}
+
+	if exists, err := store.DestinationExists(orgID, destType, destID); err != nil {
+		return err
+	} else if !exists {
+		return &common.NotFound{}
+	}
+	dest, err := store.RetrieveDestination(orgID, destType, destID)
+	if err != nil {
+		return err
+	}
+	if err := store.AddDestinationToGroup(orgID, group, destType, destID); err != nil {
+		return err
+	}
+	return communications.SendGroupObjects(*dest, group)
+}
+
+// ListDestinationGroups lists the destination groups the destination is a member of
+func ListDestinationGroups(orgID string, destType string, destID string) ([]string, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ListDestinationGroups. Destination %s:%s:%s\n", orgID, destType, destID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, &common.InvalidRequest{Message: "ESS doesn't support destination groups"}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	return store.RetrieveDestinationGroups(orgID, destType, destID)
 }
 
 // ResendObjects asks the other side to resend all the relevant objects
@@ -936,6 +1228,39 @@ func ResendObjects() common.SyncServiceError {
 	return communications.ResendObjects()
 }
 
+// VerifyObjects asks the CSS to verify the objects received by the ESS, and to resend the objects that don't match if resend is true
+func VerifyObjects(resend bool) common.SyncServiceError {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In VerifyObjects. Resend %t\n", resend)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType == common.CSS {
+		return &common.InvalidRequest{Message: "CSS can't request to verify objects"}
+	}
+	return communications.VerifyObjects(resend)
+}
+
+// GetVerifyReport returns the report of the last verification of the objects of the destination
+func GetVerifyReport(orgID string, destType string, destID string) (*common.VerifyReport, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In GetVerifyReport. Destination %s:%s:%s\n", orgID, destType, destID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, &common.InvalidRequest{Message: "ESS doesn't keep verify reports"}
+	}
+
+	report, ok := communications.GetVerifyReport(orgID, destType, destID)
+	if !ok {
+		return nil, nil
+	}
+	return &report, nil
+}
+
 // Delete the organization
 func deleteOrganization(orgID string) common.SyncServiceError {
 	common.HealthStatus.ClientRequestReceived()
@@ -1052,11 +1377,40 @@ func GetObjectDestinationsStatus(orgID string, objectType string, objectID strin
 	result := make([]common.DestinationsStatus, 0)
 	for _, d := range dests {
 		result = append(result, common.DestinationsStatus{DestType: d.Destination.DestType, DestID: d.Destination.DestID,
-			Status: d.Status, Message: d.Message})
+			Status: d.Status, Message: d.Message, ConsumedOffset: d.ConsumedOffset})
 	}
 	return result, nil
 }
 
+// GetObjectDeliveryStatus gets the destinations of the object and their statuses, along with the number of destinations
+// in each status
+// Returns nil if the object doesn't exist or has no destinations
+func GetObjectDeliveryStatus(orgID string, objectType string, objectID string) (*common.ObjectDeliveryStatus, common.SyncServiceError) {
+	dests, err := GetObjectDestinationsStatus(orgID, objectType, objectID)
+	if err != nil || dests == nil {
+		return nil, err
+	}
+
+	deliveryStatus := common.ObjectDeliveryStatus{Destinations: dests}
+	for _, d := range dests {
+		switch d.Status {
+		case common.Pending, common.Delivering:
+			deliveryStatus.Pending++
+		case common.Delivered:
+			deliveryStatus.Delivered++
+		case common.Consumed:
+			deliveryStatus.Consumed++
+		case common.Deleted:
+			deliveryStatus.Deleted++
+		case common.Error:
+			deliveryStatus.Error++
+		case common.Rejected:
+			deliveryStatus.Rejected++
+		}
+	}
+	return &deliveryStatus, nil
+}
+
 // GetObjectsForDestination gets objects that are in use on a given node
 func GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
 	common.HealthStatus.ClientRequestReceived()
@@ -1070,6 +1424,19 @@ func GetObjectsForDestination(orgID string, destType string, destID string) ([]c
 	return store.GetObjectsForDestination(orgID, destType, destID)
 }
 
+// GetPendingObjectsForDestination gets the objects that are pending delivery to a given node
+func GetPendingObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, nil
+	}
+	return store.RetrievePendingObjects(orgID, destType, destID)
+}
+
 // UpdateObjectDestinations updates object's destinations
 func UpdateObjectDestinations(orgID string, objectType string, objectID string, destinationsList []string) common.SyncServiceError {
 	common.HealthStatus.ClientRequestReceived()
@@ -1140,6 +1507,7 @@ func DeleteWebhook(orgID string, objectType string, url string) common.SyncServi
 }
 
 // RegisterWebhook registers a WebHook
+// To register a webhook for the deletion of objects of the type, pass common.DeletionWebhooksKey(objectType) as the type
 func RegisterWebhook(orgID string, objectType string, webhook string) common.SyncServiceError {
 	common.HealthStatus.ClientRequestReceived()
 
@@ -710,6 +710,15 @@ func testObjectDestinationsAPI(store storage.Storage, t *testing.T) {
 				len(dests), test.expectedDestNumber, test.metaData.ObjectID)
 		}
 
+		deliveryStatus, err := GetObjectDeliveryStatus(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID)
+		if err != nil || deliveryStatus == nil {
+			t.Errorf("GetObjectDeliveryStatus failed (objectID = %s). Error: %v", test.metaData.ObjectID, err)
+		} else if len(deliveryStatus.Destinations) != test.expectedDestNumber ||
+			deliveryStatus.Pending+deliveryStatus.Delivered+deliveryStatus.Consumed+deliveryStatus.Deleted+deliveryStatus.Error+
+				deliveryStatus.Rejected != test.expectedDestNumber {
+			t.Errorf("GetObjectDeliveryStatus returned wrong destinations or counts: %+v (objectID = %s)", *deliveryStatus, test.metaData.ObjectID)
+		}
+
 		// Remove notifications for testing
 		err = store.DeleteNotificationRecords(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, "", "")
 		if err != nil {
@@ -798,6 +807,25 @@ func testObjectDestinationsAPI(store storage.Storage, t *testing.T) {
 		}
 	}
 
+	// The destinations that received and consumed the object are counted
+	if _, err := store.UpdateObjectDeliveryStatus(common.Delivered, "", "myorg777", "type1", "1", "device3", "dev1"); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s", err.Error())
+	}
+	if deliveryStatus, err := GetObjectDeliveryStatus("myorg777", "type1", "1"); err != nil || deliveryStatus == nil ||
+		deliveryStatus.Delivered != 1 || deliveryStatus.Consumed != 0 {
+		t.Errorf("GetObjectDeliveryStatus returned wrong counts of a delivered object: %+v. Error: %v", deliveryStatus, err)
+	}
+	if _, err := store.UpdateObjectDeliveryStatus(common.Consumed, "", "myorg777", "type1", "1", "device3", "dev1"); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s", err.Error())
+	}
+	if deliveryStatus, err := GetObjectDeliveryStatus("myorg777", "type1", "1"); err != nil || deliveryStatus == nil ||
+		deliveryStatus.Delivered != 0 || deliveryStatus.Consumed != 1 || deliveryStatus.Destinations[0].Status != common.Consumed {
+		t.Errorf("GetObjectDeliveryStatus returned wrong counts of a consumed object: %+v. Error: %v", deliveryStatus, err)
+	}
+	if deliveryStatus, err := GetObjectDeliveryStatus("myorg777", "type1", "nosuchobject"); err != nil || deliveryStatus != nil {
+		t.Errorf("GetObjectDeliveryStatus returned the delivery status of an object that doesn't exist")
+	}
+
 }
 
 func TestObjectWithPolicyAPI(t *testing.T) {
@@ -1061,3 +1089,121 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 			len(policyInfo), 1)
 	}
 }
+
+func TestObjectUploadAPI(t *testing.T) {
+	setupDB(common.Bolt)
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	common.Configuration.NodeType = common.ESS
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "upload1", ObjectType: "type1", DestOrgID: "myorg777"}
+	if err := UpdateObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData, []byte("old")); err != nil {
+		t.Errorf("updateObject failed to update (objectID = %s). Error: %s", metaData.ObjectID, err.Error())
+	}
+	storedMeta, _ := store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	instanceID := storedMeta.InstanceID
+
+	checkData := func(expected string) {
+		reader, err := GetObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || reader == nil {
+			t.Errorf("Failed to get the object's data. Error: %v", err)
+			return
+		}
+		data := make([]byte, 100)
+		n, _ := reader.Read(data)
+		if string(data[:n]) != expected {
+			t.Errorf("The object's data is %s instead of %s", string(data[:n]), expected)
+		}
+		store.CloseDataReader(reader)
+	}
+
+	data := []byte("0123456789abcdefghij")
+	size := int64(len(data))
+	putPart := func(offset int64, length int64) *common.UploadProgress {
+		progress, err := PutObjectDataPart(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			bytes.NewReader(data[offset:offset+length]), length, offset, size)
+		if err != nil {
+			t.Errorf("Failed to upload %d bytes at offset %d. Error: %s", length, offset, err.Error())
+		} else if progress == nil {
+			t.Errorf("Failed to upload %d bytes at offset %d: object not found", length, offset)
+		}
+		return progress
+	}
+
+	// An upload starts at offset 0
+	if _, err := PutObjectDataPart(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader(data[5:10]),
+		5, 5, size); err == nil {
+		t.Errorf("An upload that didn't start at offset 0 was accepted")
+	}
+
+	putPart(0, 5)
+	if progress := putPart(10, 5); progress != nil && (progress.Offset != 5 || len(progress.Received) != 2 || progress.Complete) {
+		t.Errorf("Wrong upload progress: offset %d, %d ranges, complete %t", progress.Offset, len(progress.Received), progress.Complete)
+	}
+
+	// The upload resumes from the offset up to which all the data was received
+	if progress, err := GetObjectUploadProgress(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil || progress == nil {
+		t.Errorf("Failed to get the upload progress. Error: %v", err)
+	} else if progress.Offset != 5 || progress.Size != size {
+		t.Errorf("Wrong upload progress: offset %d of %d bytes", progress.Offset, progress.Size)
+	}
+	if progress := putPart(5, 5); progress != nil && (progress.Offset != 15 || len(progress.Received) != 1) {
+		t.Errorf("Wrong upload progress: offset %d, %d ranges", progress.Offset, len(progress.Received))
+	}
+
+	// The object's data is replaced only when the upload completes
+	checkData("old")
+	if progress := putPart(15, 5); progress != nil && !progress.Complete {
+		t.Errorf("The upload wasn't completed")
+	}
+	checkData(string(data))
+	storedMeta, _ = store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if storedMeta.InstanceID == instanceID || storedMeta.ObjectSize != size {
+		t.Errorf("The object wasn't updated with the uploaded data: instance %d, size %d", storedMeta.InstanceID, storedMeta.ObjectSize)
+	}
+	if progress, _ := GetObjectUploadProgress(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); progress != nil {
+		t.Errorf("The completed upload is still in progress")
+	}
+
+	// A cancelled upload doesn't change the object's data
+	putPart(0, 5)
+	if found, err := CancelObjectUpload(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil || !found {
+		t.Errorf("Failed to cancel the upload. Error: %v", err)
+	}
+	if progress, _ := GetObjectUploadProgress(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); progress != nil {
+		t.Errorf("The cancelled upload is still in progress")
+	}
+	checkData(string(data))
+
+	if progress, err := PutObjectDataPart(metaData.DestOrgID, metaData.ObjectType, "none", bytes.NewReader(data), size, 0, size); err != nil ||
+		progress != nil {
+		t.Errorf("Uploaded the data of an object that doesn't exist")
+	}
+}
+
+func TestAddByteRange(t *testing.T) {
+	ranges := make([]common.ByteRange, 0)
+	for _, r := range []common.ByteRange{{Offset: 10, Length: 5}, {Offset: 30, Length: 5}, {Offset: 0, Length: 5},
+		{Offset: 14, Length: 2}, {Offset: 20, Length: 10}, {Offset: 5, Length: 1}} {
+		ranges = addByteRange(ranges, r.Offset, r.Length)
+	}
+	expected := []common.ByteRange{{Offset: 0, Length: 6}, {Offset: 10, Length: 6}, {Offset: 20, Length: 15}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("addByteRange returned %d ranges instead of %d: %v", len(ranges), len(expected), ranges)
+	}
+	for i := range ranges {
+		if ranges[i] != expected[i] {
+			t.Errorf("addByteRange returned a wrong range: %v instead of %v", ranges[i], expected[i])
+		}
+	}
+}
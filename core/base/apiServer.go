@@ -23,9 +23,11 @@ const objectsURL = "/api/v1/objects/"
 const organizationURL = "/api/v1/organizations/"
 const getOrganizationsURL = "/api/v1/organizations"
 const resendURL = "/api/v1/resend"
+const verifyURL = "/api/v1/verify"
 const securityURL = "/api/v1/security/"
 const shutdownURL = "/api/v1/shutdown"
 const healthURL = "/api/v1/health"
+const readinessURL = "/api/v1/health/ready"
 
 const (
 	contentType     = "Content-Type"
@@ -56,6 +58,11 @@ type webhookUpdate struct {
 
 	// URL is the URL to invoke when new information for the object is available
 	URL string `json:"url"`
+
+	// Event is the event that invokes the webhook, either updated (an object was received or updated) or deleted
+	// (a deleted object was removed, the payload is the object's last meta data with deleted set to true)
+	// Optional field, if omitted the webhook is invoked on updates
+	Event string `json:"event,omitempty"`
 }
 
 // organization includes the organization's id and broker address
@@ -89,9 +96,11 @@ func setupAPIServer() {
 	http.Handle(objectsURL, http.StripPrefix(objectsURL, http.HandlerFunc(handleObjects)))
 	http.HandleFunc(shutdownURL, handleShutdown)
 	http.HandleFunc(resendURL, handleResend)
+	http.HandleFunc(verifyURL, handleVerify)
 	http.Handle(getOrganizationsURL, http.StripPrefix(getOrganizationsURL, http.HandlerFunc(handleGetOrganizations)))
 	http.Handle(organizationURL, http.StripPrefix(organizationURL, http.HandlerFunc(handleOrganizations)))
 	http.HandleFunc(healthURL, handleHealth)
+	http.HandleFunc(readinessURL, handleReadiness)
 }
 
 func handleDestinations(writer http.ResponseWriter, request *http.Request) {
@@ -109,11 +118,6 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	if request.Method != http.MethodGet {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
 	var orgID string
 	var parts []string
 	if len(request.URL.Path) != 0 {
@@ -142,12 +146,34 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	if common.Configuration.NodeType == common.CSS && len(parts) == 3 && (parts[2] == "pause" || parts[2] == "resume") {
+		handleDestinationPause(orgID, parts[0], parts[1], parts[2] == "pause", writer, request)
+		return
+	}
+
+	if common.Configuration.NodeType == common.CSS && len(parts) >= 3 && parts[2] == "groups" {
+		handleDestinationGroups(orgID, parts[0], parts[1], parts[3:], writer, request)
+		return
+	}
+
+	if common.Configuration.NodeType == common.CSS && len(parts) == 3 && parts[2] == "verify" {
+		handleDestinationVerifyReport(orgID, parts[0], parts[1], writer, request)
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
 	if len(parts) == 0 || (len(parts) == 1 && len(parts[0]) == 0) {
 		// swagger:operation GET /api/v1/destinations/{orgID} handleDestinations
 		//
 		// List all known destinations.
 		//
 		// Provides a list of destinations for an organization, i.e., ESS nodes (belonging to orgID) that have registered with the CSS.
+		// Each destination includes the time the CSS last received a registration, ping, or heartbeat from it,
+		// and whether sending data to it is paused.
 		// This is a CSS only API.
 		//
 		// ---
@@ -172,7 +198,7 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//     schema:
 		//       type: array
 		//       items:
-		//         "$ref": "#/definitions/Destination"
+		//         "$ref": "#/definitions/DestinationInfo"
 		//   '404':
 		//     description: No destinations found
 		//     schema:
@@ -203,7 +229,8 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//
 		// List all objects that are in use by the destination.
 		//
-		// Provides a list of objects that are in use by the destination ESS node.
+		// Provides a list of objects that are in use by the destination ESS node, or only of the objects
+		// that are pending delivery to it.
 		// This is a CSS only API.
 		//
 		// ---
@@ -231,6 +258,11 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//   description: The destID of the destination to retrieve objects for.
 		//   required: true
 		//   type: string
+		// - name: pending
+		//   in: query
+		//   description: Whether to retrieve only the objects that are pending delivery to the destination
+		//   required: false
+		//   type: boolean
 		//
 		// responses:
 		//   '200':
@@ -247,7 +279,20 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//     description: Failed to retrieve the objects
 		//     schema:
 		//       type: string
-		if objects, err := GetObjectsForDestination(orgID, parts[0], parts[1]); err != nil {
+		pending := false
+		if pendingString := request.URL.Query().Get("pending"); pendingString != "" {
+			var err error
+			pending, err = strconv.ParseBool(pendingString)
+			if err != nil {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		getObjects := GetObjectsForDestination
+		if pending {
+			getObjects = GetPendingObjectsForDestination
+		}
+		if objects, err := getObjects(orgID, parts[0], parts[1]); err != nil {
 			communications.SendErrorResponse(writer, err, "Failed to fetch the objects. Error: ", 0)
 		} else {
 			if len(objects) == 0 {
@@ -269,464 +314,1576 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
-// swagger:operation POST /api/v1/resend handleResend
+// swagger:operation PUT /api/v1/destinations/{orgID}/{destType}/{destID}/pause handleDestinationPause
 //
-// Request to resend objects.
+// Pause sending data to a destination.
 //
-// Used by an ESS to ask the CSS to resend it all the objects (supported only for ESS to CSS requests).
-// An application only needs to use this API in case the data it previously obtained from the ESS was lost.
+// Stop sending data to the destination ESS node, e.g. when it is congested, without deleting its objects.
+// While the destination is paused its requests for data are ignored, and the CSS doesn't ask it to resend data.
+// The paused state is kept across restarts of the CSS and registrations of the ESS.
+// This is a CSS only API.
 //
 // ---
 //
 // tags:
-// - ESS
+// - CSS
 //
 // produces:
 // - text/plain
 //
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination to pause.
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination to pause.
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination to pause.
+//   required: true
+//   type: string
+//
 // responses:
 //   '204':
-//     description: The request will be sent
+//     description: The destination was paused
 //     schema:
 //       type: string
-//   '400':
-//     description: The request is not allowed on Cloud Sync-Service
+//   '404':
+//     description: The destination was not found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to pause the destination
 //     schema:
 //       type: string
-func handleResend(writer http.ResponseWriter, request *http.Request) {
-	setCacheControlHeaders(writer)
 
-	if !common.Running {
-		writer.WriteHeader(http.StatusServiceUnavailable)
-		return
-	}
+// ======================================================================================
 
-	code, _, _ := security.Authenticate(request)
-	if code != security.AuthAdmin && code != security.AuthUser && code != security.AuthSyncAdmin {
-		writer.WriteHeader(http.StatusForbidden)
-		writer.Write(unauthorizedBytes)
+// swagger:operation PUT /api/v1/destinations/{orgID}/{destType}/{destID}/resume handleDestinationPause
+//
+// Resume sending data to a paused destination.
+//
+// The transfers to and from the destination ESS node that were stopped while it was paused continue.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination to resume.
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination to resume.
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination to resume.
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: The destination was resumed
+//     schema:
+//       type: string
+//   '404':
+//     description: The destination was not found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to resume the destination
+//     schema:
+//       type: string
+func handleDestinationPause(orgID string, destType string, destID string, paused bool, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPut {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	if request.Method == http.MethodPost {
-		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleResend\n")
-		}
-		if err := ResendObjects(); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to send resend objects request. Error: ", 0)
+	if err := PauseDestination(orgID, destType, destID, paused); err != nil {
+		if common.IsNotFound(err) {
+			writer.WriteHeader(http.StatusNotFound)
 		} else {
-			writer.WriteHeader(http.StatusNoContent)
+			communications.SendErrorResponse(writer, err, "Failed to update the destination. Error: ", 0)
 		}
 	} else {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writer.WriteHeader(http.StatusNoContent)
 	}
 }
 
-// POST /api/v1/shutdown?essunregister=true
-func handleShutdown(writer http.ResponseWriter, request *http.Request) {
-	setCacheControlHeaders(writer)
-
-	code, _, _ := security.Authenticate(request)
-	if code != security.AuthSyncAdmin {
-		writer.WriteHeader(http.StatusForbidden)
-		writer.Write(unauthorizedBytes)
+// swagger:operation GET /api/v1/destinations/{orgID}/{destType}/{destID}/verify handleDestinationVerifyReport
+//
+// Get the verify report of a destination.
+//
+// Provides the result of the last verification of the objects of the destination ESS node, requested by the ESS
+// with POST /api/v1/verify. The report lists the objects of the ESS that don't match the objects of the CSS.
+// The report is kept in memory by the CSS node that handled the request.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination.
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination.
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination.
+//   required: true
+//   type: string
+//
+// responses:
+//   '200':
+//     description: Verify report response
+//     schema:
+//       "$ref": "#/definitions/VerifyReport"
+//   '404':
+//     description: The destination didn't request to verify its objects
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to retrieve the verify report
+//     schema:
+//       type: string
+func handleDestinationVerifyReport(orgID string, destType string, destID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	if request.Method == http.MethodPost {
-		writer.WriteHeader(http.StatusNoContent)
-
-		restart := strings.ToLower(request.URL.Query().Get("restart"))
-		quiesceString := request.URL.Query().Get("quiesce")
-
-		essUnregister := false
-		if common.Configuration.NodeType == common.ESS {
-			unregisterString := request.URL.Query().Get("essunregister")
-			var err error
-			if unregisterString != "" {
-				essUnregister, err = strconv.ParseBool(unregisterString)
-				if err != nil {
-					writer.WriteHeader(http.StatusBadRequest)
-					return
-				}
-			}
-		}
-
-		go func() {
-			timer := time.NewTimer(time.Duration(1) * time.Second)
-			<-timer.C
-
-			quieceTime := 3
-			if len(quiesceString) != 0 {
-				var quieceTemp int
-				_, err := fmt.Sscanf(quiesceString, "%d", &quieceTemp)
-				if err == nil {
-					quieceTime = quieceTemp
-				}
-			}
-
-			if restart == "true" || restart == "yes" {
-				// If BlockUntilShutdown was called, don't let Stop() unblock
-				blocking := waitingOnBlockChannel
-				waitingOnBlockChannel = false
-				Stop(quieceTime, essUnregister)
-
-				if log.IsLogging(logger.INFO) {
-					log.Info("Restarting the Sync Service")
-				}
-				Start("", false)
-				waitingOnBlockChannel = blocking
-			} else {
-				Stop(quieceTime, essUnregister)
-			}
-		}()
-	} else {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+	report, err := GetVerifyReport(orgID, destType, destID)
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to fetch the verify report. Error: ", 0)
+		return
 	}
-}
-
-func handleObjects(writer http.ResponseWriter, request *http.Request) {
-	setCacheControlHeaders(writer)
-
-	if !common.Running {
-		writer.WriteHeader(http.StatusServiceUnavailable)
+	if report == nil {
+		writer.WriteHeader(http.StatusNotFound)
 		return
 	}
-
-	if len(request.URL.Path) != 0 {
-		parts := strings.Split(request.URL.Path, "/")
-		var orgID string
-		if common.Configuration.NodeType == common.CSS {
-			orgID = parts[0]
-			parts = parts[1:]
-		} else {
-			orgID = common.Configuration.OrgID
+	if data, err := json.MarshalIndent(report, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the verify report. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
 		}
+	}
+}
 
-		if len(parts) == 0 {
-			// GET     /api/v1/objects/orgID?destination_policy=true
-			// GET     /api/v1/objects/orgID?filters=true
-			if request.Method != http.MethodGet {
-				writer.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-
-			// GET     /api/v1/objects/orgID?destination_policy=true, return []common.ObjectDestinationPolicy
-			destPolicyString := request.URL.Query().Get("destination_policy")
-			destPolicy := false
-
-			objectFilterString := request.URL.Query().Get("filters")
-			objectFilter := false
-			var err error
-			if destPolicyString != "" {
-				destPolicy, err = strconv.ParseBool(destPolicyString)
-				if err == nil && destPolicy {
-					handleListObjectsWithDestinationPolicy(orgID, writer, request)
-					return
-				}
-			} else if objectFilterString != "" {
-				// GET     /api/v1/objects/orgID?filters=true&param1=value1&param2=value2.....
-				// this API is to filter objects which have destination policy, and return []common.Metatdata
-				objectFilter, err = strconv.ParseBool(objectFilterString)
-				if err == nil && objectFilter {
+// swagger:operation GET /api/v1/destinations/{orgID}/{destType}/{destID}/groups handleDestinationGroups
+//
+// List the destination groups of a destination.
+//
+// Provides the names of the destination groups the destination ESS node is a member of.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination.
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination.
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination.
+//   required: true
+//   type: string
+//
+// responses:
+//   '200':
+//     description: Destination groups response
+//     schema:
+//       type: array
+//       items:
+//         type: string
+//   '404':
+//     description: The destination isn't a member of any group
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to retrieve the destination groups
+//     schema:
+//       type: string
+
+// ======================================================================================
+
+// swagger:operation PUT /api/v1/destinations/{orgID}/{destType}/{destID}/groups/{group} handleDestinationGroups
+//
+// Add a destination to a destination group.
+//
+// Objects sent to a destination group are delivered to all the members of the group, including members that join the group
+// after the objects were created. The objects of the group are sent to the destination when it is added to the group.
+// Group membership is kept across registrations of the ESS.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination.
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination.
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination.
+//   required: true
+//   type: string
+// - name: group
+//   in: path
+//   description: The name of the destination group.
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: The destination was added to the group
+//     schema:
+//       type: string
+//   '400':
+//     description: The group name is invalid
+//     schema:
+//       type: string
+//   '404':
+//     description: The destination was not found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to add the destination to the group
+//     schema:
+//       type: string
+
+// ======================================================================================
+
+// swagger:operation DELETE /api/v1/destinations/{orgID}/{destType}/{destID}/groups/{group} handleDestinationGroups
+//
+// Remove a destination from a destination group.
+//
+// Objects sent to the group after the destination was removed from it are not delivered to the destination.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination.
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination.
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination.
+//   required: true
+//   type: string
+// - name: group
+//   in: path
+//   description: The name of the destination group.
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: The destination was removed from the group
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to remove the destination from the group
+//     schema:
+//       type: string
+func handleDestinationGroups(orgID string, destType string, destID string, parts []string, writer http.ResponseWriter,
+	request *http.Request) {
+	if len(parts) == 0 || (len(parts) == 1 && len(parts[0]) == 0) {
+		if request.Method != http.MethodGet {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if groups, err := ListDestinationGroups(orgID, destType, destID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to fetch the destination groups. Error: ", 0)
+		} else if len(groups) == 0 {
+			writer.WriteHeader(http.StatusNotFound)
+		} else if data, err := json.MarshalIndent(groups, "", "  "); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to marshal the destination groups. Error: ", 0)
+		} else {
+			writer.Header().Add(contentType, applicationJSON)
+			writer.WriteHeader(http.StatusOK)
+			if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Failed to write response body, error: " + err.Error())
+			}
+		}
+		return
+	}
+
+	if len(parts) != 1 {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if request.Method != http.MethodPut && request.Method != http.MethodDelete {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := UpdateDestinationGroup(orgID, destType, destID, parts[0], request.Method == http.MethodPut); err != nil {
+		if common.IsNotFound(err) {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			communications.SendErrorResponse(writer, err, "Failed to update the destination group. Error: ", 0)
+		}
+	} else {
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// swagger:operation POST /api/v1/resend handleResend
+//
+// Request to resend objects.
+//
+// Used by an ESS to ask the CSS to resend it all the objects (supported only for ESS to CSS requests).
+// An application only needs to use this API in case the data it previously obtained from the ESS was lost.
+//
+// ---
+//
+// tags:
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// responses:
+//   '204':
+//     description: The request will be sent
+//     schema:
+//       type: string
+//   '400':
+//     description: The request is not allowed on Cloud Sync-Service
+//     schema:
+//       type: string
+func handleResend(writer http.ResponseWriter, request *http.Request) {
+	setCacheControlHeaders(writer)
+
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	code, _, _ := security.Authenticate(request)
+	if code != security.AuthAdmin && code != security.AuthUser && code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleResend\n")
+		}
+		if err := ResendObjects(); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to send resend objects request. Error: ", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// swagger:operation POST /api/v1/verify handleVerify
+//
+// Request to verify objects.
+//
+// Used by an ESS to ask the CSS to verify the objects it received (supported only for ESS to CSS requests).
+// The ESS sends the CSS a manifest of its objects, with the instance, the size, and the hash of the data of each object.
+// The CSS compares the manifest with its objects and reports the discrepancies, see
+// GET /api/v1/destinations/{orgID}/{destType}/{destID}/verify.
+// Unlike a resend request, only the objects whose instance or data differ are sent again, and only if requested.
+//
+// ---
+//
+// tags:
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: resend
+//   in: query
+//   description: Whether the CSS should send again the objects that don't match
+//   required: false
+//   type: boolean
+//
+// responses:
+//   '204':
+//     description: The request will be sent
+//     schema:
+//       type: string
+//   '400':
+//     description: The request is not allowed on Cloud Sync-Service
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to verify the objects
+//     schema:
+//       type: string
+func handleVerify(writer http.ResponseWriter, request *http.Request) {
+	setCacheControlHeaders(writer)
+
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	code, _, _ := security.Authenticate(request)
+	if code != security.AuthAdmin && code != security.AuthUser && code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleVerify\n")
+		}
+		resend := false
+		if resendString := request.URL.Query().Get("resend"); resendString != "" {
+			var err error
+			if resend, err = strconv.ParseBool(resendString); err != nil {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if err := VerifyObjects(resend); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to send verify objects request. Error: ", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /api/v1/shutdown?essunregister=true
+func handleShutdown(writer http.ResponseWriter, request *http.Request) {
+	setCacheControlHeaders(writer)
+
+	code, _, _ := security.Authenticate(request)
+	if code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		writer.WriteHeader(http.StatusNoContent)
+
+		restart := strings.ToLower(request.URL.Query().Get("restart"))
+		quiesceString := request.URL.Query().Get("quiesce")
+
+		essUnregister := false
+		if common.Configuration.NodeType == common.ESS {
+			unregisterString := request.URL.Query().Get("essunregister")
+			var err error
+			if unregisterString != "" {
+				essUnregister, err = strconv.ParseBool(unregisterString)
+				if err != nil {
+					writer.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		go func() {
+			timer := time.NewTimer(time.Duration(1) * time.Second)
+			<-timer.C
+
+			quieceTime := 3
+			if len(quiesceString) != 0 {
+				var quieceTemp int
+				_, err := fmt.Sscanf(quiesceString, "%d", &quieceTemp)
+				if err == nil {
+					quieceTime = quieceTemp
+				}
+			}
+
+			if restart == "true" || restart == "yes" {
+				// If BlockUntilShutdown was called, don't let Stop() unblock
+				blocking := waitingOnBlockChannel
+				waitingOnBlockChannel = false
+				Stop(quieceTime, essUnregister)
+
+				if log.IsLogging(logger.INFO) {
+					log.Info("Restarting the Sync Service")
+				}
+				Start("", false)
+				waitingOnBlockChannel = blocking
+			} else {
+				Stop(quieceTime, essUnregister)
+			}
+		}()
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleObjects(writer http.ResponseWriter, request *http.Request) {
+	setCacheControlHeaders(writer)
+
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if len(request.URL.Path) != 0 {
+		parts := strings.Split(request.URL.Path, "/")
+		var orgID string
+		if common.Configuration.NodeType == common.CSS {
+			orgID = parts[0]
+			parts = parts[1:]
+		} else {
+			orgID = common.Configuration.OrgID
+		}
+
+		if len(parts) == 0 {
+			// GET     /api/v1/objects/orgID?destination_policy=true
+			// GET     /api/v1/objects/orgID?filters=true
+			// DELETE  /api/v1/objects/orgID?filters=true
+			if request.Method == http.MethodDelete {
+				handleDeleteObjectsWithFilter(orgID, writer, request)
+				return
+			}
+			if request.Method != http.MethodGet {
+				writer.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			// GET     /api/v1/objects/orgID?destination_policy=true, return []common.ObjectDestinationPolicy
+			destPolicyString := request.URL.Query().Get("destination_policy")
+			destPolicy := false
+
+			objectFilterString := request.URL.Query().Get("filters")
+			objectFilter := false
+			var err error
+			if destPolicyString != "" {
+				destPolicy, err = strconv.ParseBool(destPolicyString)
+				if err == nil && destPolicy {
+					handleListObjectsWithDestinationPolicy(orgID, writer, request)
+					return
+				}
+			} else if objectFilterString != "" {
+				// GET     /api/v1/objects/orgID?filters=true&param1=value1&param2=value2.....
+				// this API is to filter objects which have destination policy, and return []common.Metatdata
+				objectFilter, err = strconv.ParseBool(objectFilterString)
+				if err == nil && objectFilter {
 					handleListObjectsWithFilters(orgID, writer, request)
 					return
 				}
 			}
 			writer.WriteHeader(http.StatusBadRequest)
 			return
-		} else if len(parts) == 1 || (len(parts) == 2 && len(parts[1]) == 0) {
-			// /api/v1/objects/orgID/type
-			// GET - get updated objects
-			// PUT - register/delete a webhook
-			switch request.Method {
-			case http.MethodGet:
+		} else if len(parts) == 1 || (len(parts) == 2 && len(parts[1]) == 0) {
+			// /api/v1/objects/orgID/type
+			// GET - get updated objects
+			// PUT - register/delete a webhook
+			switch request.Method {
+			case http.MethodGet:
+
+				allObjectsString := request.URL.Query().Get("all_objects")
+				allObjects := false
+				if allObjectsString != "" {
+					var err error
+					allObjects, err = strconv.ParseBool(allObjectsString)
+					if err != nil {
+						writer.WriteHeader(http.StatusBadRequest)
+						return
+					}
+				}
+				if allObjects {
+					handleListAllObjects(orgID, parts[0], writer, request)
+				} else {
+					receivedString := request.URL.Query().Get("received")
+					received := false
+					if receivedString != "" {
+						var err error
+						received, err = strconv.ParseBool(receivedString)
+						if err != nil {
+							writer.WriteHeader(http.StatusBadRequest)
+							return
+						}
+					}
+					handleListUpdatedObjects(orgID, parts[0], received, writer, request)
+				}
+			case http.MethodPut:
+				handleWebhook(orgID, parts[0], writer, request)
+			default:
+				writer.WriteHeader(http.StatusMethodNotAllowed)
+			}
+
+		} else if len(parts) == 2 || (len(parts) == 3 && len(parts[2]) == 0) {
+			// GET/DELETE/PUT /api/v1/objects/orgID/type/id
+			handleObjectRequest(orgID, parts[0], parts[1], writer, request)
+
+		} else if len(parts) == 3 || (len(parts) == 4 && len(parts[3]) == 0) {
+			// PUT     /api/v1/objects/orgID/type/id/consumed
+			// PUT     /api/v1/objects/orgID/type/id/deleted
+			// PUT     /api/v1/objects/orgID/type/id/received
+			// PUT     /api/v1/objects/orgID/type/id/activate
+			// GET     /api/v1/objects/orgID/type/id/status
+			// GET/PUT /api/v1/objects/orgID/type/id/data
+			// GET/PUT /api/v1/objects/orgID/type/id/destinations
+			operation := strings.ToLower(parts[2])
+			handleObjectOperation(operation, orgID, parts[0], parts[1], writer, request)
+
+		} else {
+			writer.WriteHeader(http.StatusBadRequest)
+		}
+	} else {
+		writer.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func handleObjectRequest(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	setCacheControlHeaders(writer)
+
+	switch request.Method {
+
+	// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID} handleGetObject
+	//
+	// Get an object.
+	//
+	// Get the metadata of an object of the specified object type and object ID.
+	// The metadata indicates if the objects includes data which can then be obtained using the appropriate API.
+	//
+	// ---
+	//
+	// tags:
+	// - CSS
+	//
+	// produces:
+	// - application/json
+	// - text/plain
+	//
+	// parameters:
+	// - name: orgID
+	//   in: path
+	//   description: The orgID of the object to return.
+	//   required: true
+	//   type: string
+	// - name: objectType
+	//   in: path
+	//   description: The object type of the object to return
+	//   required: true
+	//   type: string
+	// - name: objectID
+	//   in: path
+	//   description: The object ID of the object to return
+	//   required: true
+	//   type: string
+	//
+	// responses:
+	//   '200':
+	//     description: Object response
+	//     schema:
+	//       "$ref": "#/definitions/MetaData"
+	//   '404':
+	//     description: Object not found
+	//     schema:
+	//       type: string
+	//   '500':
+	//     description: Failed to retrieve the object
+	//     schema:
+	//       type: string
+
+	// ======================================================================================
+
+	// swagger:operation GET /api/v1/objects/{objectType}/{objectID} handleGetObject
+	//
+	// Get an object.
+	//
+	// Get the metadata of an object of the specified object type and object ID.
+	// The metadata indicates if the objects includes data which can then be obtained using the appropriate API.
+	//
+	// ---
+	//
+	// tags:
+	// - ESS
+	//
+	// produces:
+	// - application/json
+	// - text/plain
+	//
+	// parameters:
+	// - name: objectType
+	//   in: path
+	//   description: The object type of the object to return
+	//   required: true
+	//   type: string
+	// - name: objectID
+	//   in: path
+	//   description: The object ID of the object to return
+	//   required: true
+	//   type: string
+	//
+	// responses:
+	//   '200':
+	//     description: Object response
+	//     schema:
+	//       "$ref": "#/definitions/MetaData"
+	//   '404':
+	//     description: Object not found
+	//     schema:
+	//       type: string
+	//   '500':
+	//     description: Failed to retrieve the object
+	//     schema:
+	//       type: string
+	case http.MethodGet:
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Get %s %s\n", objectType, objectID)
+		}
+		if code, _ := canUserAccessObject(request, orgID, objectType, objectID, false); code == security.AuthFailed {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write(unauthorizedBytes)
+			return
+		}
+		if metaData, err := GetObject(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+		} else {
+			if metaData == nil {
+				writer.WriteHeader(http.StatusNotFound)
+			} else {
+				if data, err := json.MarshalIndent(metaData, "", "  "); err != nil {
+					communications.SendErrorResponse(writer, err, "Failed to marshal metadata. Error: ", 0)
+				} else {
+					writer.Header().Add(contentType, applicationJSON)
+					writer.WriteHeader(http.StatusOK)
+					if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+						log.Error("Failed to write response body, error: " + err.Error())
+					}
+				}
+			}
+		}
+
+	// swagger:operation DELETE /api/v1/objects/{orgID}/{objectType}/{objectID} handleDeleteObject
+	//
+	// Delete an object.
+	//
+	// Delete the object of the specified object type and object ID.
+	// Destinations of the object will be notified that the object has been deleted.
+	//
+	// ---
+	//
+	// tags:
+	// - CSS
+	//
+	// produces:
+	// - text/plain
+	//
+	// parameters:
+	// - name: orgID
+	//   in: path
+	//   description: The orgID of the object to delete.
+	//   required: true
+	//   type: string
+	// - name: objectType
+	//   in: path
+	//   description: The object type of the object to delete
+	//   required: true
+	//   type: string
+	// - name: objectID
+	//   in: path
+	//   description: The object ID of the object to delete
+	//   required: true
+	//   type: string
+	//
+	// responses:
+	//   '204':
+	//     description: Object deleted
+	//     schema:
+	//       type: string
+	//   '500':
+	//     description: Failed to delete the object
+	//     schema:
+	//       type: string
+
+	// ======================================================================================
+
+	// swagger:operation DELETE /api/v1/objects/{objectType}/{objectID} handleDeleteObject
+	//
+	// Delete an object.
+	//
+	// Delete the object of the specified object type and object ID.
+	// Destinations of the object will be notified that the object has been deleted.
+	//
+	// ---
+	//
+	// tags:
+	// - ESS
+	//
+	// produces:
+	// - text/plain
+	//
+	// parameters:
+	// - name: objectType
+	//   in: path
+	//   description: The object type of the object to delete
+	//   required: true
+	//   type: string
+	// - name: objectID
+	//   in: path
+	//   description: The object ID of the object to delete
+	//   required: true
+	//   type: string
+	//
+	// responses:
+	//   '204':
+	//     description: Object deleted
+	//     schema:
+	//       type: string
+	//   '500':
+	//     description: Failed to delete the object
+	//     schema:
+	//       type: string
+	case http.MethodDelete:
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Delete %s %s\n", objectType, objectID)
+		}
+		if code, _ := canUserAccessObject(request, orgID, objectType, objectID, false); code == security.AuthFailed {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write(unauthorizedBytes)
+			return
+		}
+		if err := DeleteObject(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to delete the object. Error: ", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+
+	case http.MethodPut:
+		handleUpdateObject(orgID, objectType, objectID, writer, request)
+
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// swagger:operation GET /api/v1/objects/{orgID}?filters=true handleListObjectsWithFilters
+//
+// Get objects satisfy the given filters
+//
+// Get the list of objects that satisfy the given filters
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the updated objects to return. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: filters
+//   in: query
+//   description: Must be true to indicate that objects with filters are to be retrieved
+//   required: true
+//   type: boolean
+// - name: destinationPolicy
+//   in: query
+//   description: Must be true to indicate that objects with destinationPolicy are to be retrieved
+//   required: false
+//   type: boolean
+// - name: dpService
+//   in: query
+//   description: The ID of the service (orgID/serviceName) to which objects have affinity,
+//        whose Destination Policy should be fetched.
+//   required: false
+//   type: string
+// - name: dpPropertyName
+//   in: query
+//   description: The property name defined inside destination policy to which objects have affinity,
+//        whose Destination Policy should be fetched.
+//   required: false
+//   type: string
+// - name: since
+//   in: query
+//   description: Objects that have a Destination Policy which was updated since the specified timestamp in RFC3339 should be fetched.
+//   required: false
+//   type: string
+// - name: objectType
+//   in: query
+//   description: Fetch the objects with given object type
+//   required: false
+//   type: string
+// - name: objectID
+//   in: query
+//   description: Fetch the objects with given object id
+//   required: false
+//   type: string
+// - name: destinationType
+//   in: query
+//   description: Fetch the objects with given destination type
+//   required: false
+//   type: string
+// - name: destinationID
+//   in: query
+//   description: Fetch the objects with given destination id
+//   required: false
+//   type: string
+// - name: noData
+//   in: query
+//   description: Fetch the objects with noData marked to true
+//   required: false
+//   type: boolean
+// - name: expirationTimeBefore
+//   in: query
+//   description: Fetch the objects with expiration time before specified timestamp in RFC3339 format
+//   required: false
+//   type: string
+//
+// responses:
+//   '200':
+//     description: Objects response
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/MetaData"
+//   '404':
+//     description: No objects found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to retrieve the objects
+//     schema:
+//       type: string
+func handleListObjectsWithFilters(orgID string, writer http.ResponseWriter, request *http.Request) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleListObjectsWithFilters")
+	}
+	code, userOrgID, _ := security.Authenticate(request)
+	if code != security.AuthSyncAdmin && (code != security.AuthAdmin || userOrgID != orgID) {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	destinationPolicyString := request.URL.Query().Get("destinationPolicy")
+	var destinationPolicy *bool
+	if destinationPolicyString != "" {
+		var err error
+		destinationPolicyValue, err := strconv.ParseBool(destinationPolicyString)
+		destinationPolicy = &destinationPolicyValue
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	dpServiceOrgID := ""
+	dpServiceName := ""
+	dpPropertyName := ""
+	since := int64(0)
+
+	if destinationPolicy != nil && *destinationPolicy == true {
+		dpServiceID := request.URL.Query().Get("dpService")
+		if dpServiceID != "" {
+			parts := strings.SplitN(dpServiceID, "/", 2)
+			if len(parts) < 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			dpServiceOrgID = parts[0]
+			dpServiceName = parts[1]
+		}
+
+		dpPropertyName = request.URL.Query().Get("dpPropertyName")
+
+		sinceString := request.URL.Query().Get("since")
+		if sinceString != "" {
+			var err error
+			sinceTime, err := time.Parse(time.RFC3339, sinceString)
+			if err != nil {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			since = sinceTime.UTC().UnixNano()
+			if since < 1 {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+		}
+	}
+
+	objectType := request.URL.Query().Get("objectType")
+	objectID := ""
+
+	if objectType != "" {
+		objectID = request.URL.Query().Get("objectID")
+	}
+
+	destinationType := request.URL.Query().Get("destinationType")
+	destinationID := ""
+	if destinationType != "" {
+		destinationID = request.URL.Query().Get("destinationID")
+	}
+
+	var noData *bool
+	noDataString := request.URL.Query().Get("noData")
+	if noDataString != "" {
+		var err error
+		noDataVelue, err := strconv.ParseBool(noDataString)
+		noData = &noDataVelue
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
 
-				allObjectsString := request.URL.Query().Get("all_objects")
-				allObjects := false
-				if allObjectsString != "" {
-					var err error
-					allObjects, err = strconv.ParseBool(allObjectsString)
-					if err != nil {
-						writer.WriteHeader(http.StatusBadRequest)
-						return
-					}
-				}
-				if allObjects {
-					handleListAllObjects(orgID, parts[0], writer, request)
-				} else {
-					receivedString := request.URL.Query().Get("received")
-					received := false
-					if receivedString != "" {
-						var err error
-						received, err = strconv.ParseBool(receivedString)
-						if err != nil {
-							writer.WriteHeader(http.StatusBadRequest)
-							return
-						}
-					}
-					handleListUpdatedObjects(orgID, parts[0], received, writer, request)
+	expirationTimeBeforeString := request.URL.Query().Get("expirationTimeBefore")
+	if expirationTimeBeforeString != "" {
+		_, err := time.Parse(time.RFC3339, expirationTimeBeforeString)
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var objects []common.MetaData
+	var err error
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleListObjectsWithFilters, get objects with %s %s %s %s %s %d %s %s %s %s %s %s\n", orgID, destinationPolicyString, dpServiceOrgID, dpServiceName, dpPropertyName, since, objectType, objectID, destinationType, destinationID, noDataString, expirationTimeBeforeString)
+	}
+
+	if objects, err = ListObjectsWithFilters(orgID, destinationPolicy, dpServiceOrgID, dpServiceName, dpPropertyName, since, objectType, objectID, destinationType, destinationID, noData, expirationTimeBeforeString); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to fetch the list of objects with given conditions. Error: ", 0)
+	} else {
+		if len(objects) == 0 {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			if data, err := json.MarshalIndent(objects, "", "  "); err != nil {
+				communications.SendErrorResponse(writer, err, "Failed to marshal the list of objects with a Metadata. Error: ", 0)
+			} else {
+				writer.Header().Add(contentType, applicationJSON)
+				writer.WriteHeader(http.StatusOK)
+				if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+					log.Error("Failed to write response body, error: " + err.Error())
 				}
-			case http.MethodPut:
-				handleWebhook(orgID, parts[0], writer, request)
-			default:
-				writer.WriteHeader(http.StatusMethodNotAllowed)
 			}
+		}
 
-		} else if len(parts) == 2 || (len(parts) == 3 && len(parts[2]) == 0) {
-			// GET/DELETE/PUT /api/v1/objects/orgID/type/id
-			handleObjectRequest(orgID, parts[0], parts[1], writer, request)
+	}
+
+}
+
+// swagger:operation DELETE /api/v1/objects/{orgID}?filters=true handleDeleteObjectsWithFilter
+//
+// Delete objects that satisfy the given filters
+//
+// Delete the objects originated by this node that satisfy the given filters.
+// The destinations that the objects were delivered to are notified that the objects were deleted.
+// At least one of the filters must be specified. The deletion is completed in the background,
+// and is resumed if the Sync Service is restarted before it is completed.
+//
+// ---
+//
+// tags:
+// - CSS
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the objects to delete. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: filters
+//   in: query
+//   description: Must be true to indicate that objects with filters are to be deleted
+//   required: true
+//   type: boolean
+// - name: objectType
+//   in: query
+//   description: Delete the objects with given object type
+//   required: false
+//   type: string
+// - name: destinationType
+//   in: query
+//   description: Delete the objects with given destination type
+//   required: false
+//   type: string
+// - name: destinationID
+//   in: query
+//   description: Delete the objects with given destination id
+//   required: false
+//   type: string
+// - name: expirationTimeBefore
+//   in: query
+//   description: Delete the objects with expiration time before specified timestamp in RFC3339 format
+//   required: false
+//   type: string
+//
+// responses:
+//   '204':
+//     description: The objects are being deleted
+//     schema:
+//       type: string
+//   '400':
+//     description: No filter or an invalid filter was specified
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to delete the objects
+//     schema:
+//       type: string
+func handleDeleteObjectsWithFilter(orgID string, writer http.ResponseWriter, request *http.Request) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleDeleteObjectsWithFilter")
+	}
+	code, userOrgID, _ := security.Authenticate(request)
+	if code != security.AuthSyncAdmin && (code != security.AuthAdmin || userOrgID != orgID) {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
 
-		} else if len(parts) == 3 || (len(parts) == 4 && len(parts[3]) == 0) {
-			// PUT     /api/v1/objects/orgID/type/id/consumed
-			// PUT     /api/v1/objects/orgID/type/id/deleted
-			// PUT     /api/v1/objects/orgID/type/id/received
-			// PUT     /api/v1/objects/orgID/type/id/activate
-			// GET     /api/v1/objects/orgID/type/id/status
-			// GET/PUT /api/v1/objects/orgID/type/id/data
-			// GET/PUT /api/v1/objects/orgID/type/id/destinations
-			operation := strings.ToLower(parts[2])
-			handleObjectOperation(operation, orgID, parts[0], parts[1], writer, request)
+	if filters, err := strconv.ParseBool(request.URL.Query().Get("filters")); err != nil || !filters {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-		} else {
+	objectType := request.URL.Query().Get("objectType")
+	destinationType := request.URL.Query().Get("destinationType")
+	destinationID := ""
+	if destinationType != "" {
+		destinationID = request.URL.Query().Get("destinationID")
+	}
+	expirationTimeBefore := request.URL.Query().Get("expirationTimeBefore")
+	if expirationTimeBefore != "" {
+		if _, err := time.Parse(time.RFC3339, expirationTimeBefore); err != nil {
 			writer.WriteHeader(http.StatusBadRequest)
+			return
 		}
+	}
+
+	if _, err := DeleteObjectsWithFilter(orgID, objectType, destinationType, destinationID, expirationTimeBefore); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to delete the objects with given conditions. Error: ", 0)
 	} else {
-		writer.WriteHeader(http.StatusBadRequest)
+		writer.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleObjectRequest(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	setCacheControlHeaders(writer)
-
-	switch request.Method {
-
-	// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID} handleGetObject
-	//
-	// Get an object.
-	//
-	// Get the metadata of an object of the specified object type and object ID.
-	// The metadata indicates if the objects includes data which can then be obtained using the appropriate API.
-	//
-	// ---
-	//
-	// tags:
-	// - CSS
-	//
-	// produces:
-	// - application/json
-	// - text/plain
-	//
-	// parameters:
-	// - name: orgID
-	//   in: path
-	//   description: The orgID of the object to return.
-	//   required: true
-	//   type: string
-	// - name: objectType
-	//   in: path
-	//   description: The object type of the object to return
-	//   required: true
-	//   type: string
-	// - name: objectID
-	//   in: path
-	//   description: The object ID of the object to return
-	//   required: true
-	//   type: string
-	//
-	// responses:
-	//   '200':
-	//     description: Object response
-	//     schema:
-	//       "$ref": "#/definitions/MetaData"
-	//   '404':
-	//     description: Object not found
-	//     schema:
-	//       type: string
-	//   '500':
-	//     description: Failed to retrieve the object
-	//     schema:
-	//       type: string
-
-	// ======================================================================================
-
-	// swagger:operation GET /api/v1/objects/{objectType}/{objectID} handleGetObject
-	//
-	// Get an object.
-	//
-	// Get the metadata of an object of the specified object type and object ID.
-	// The metadata indicates if the objects includes data which can then be obtained using the appropriate API.
-	//
-	// ---
-	//
-	// tags:
-	// - ESS
-	//
-	// produces:
-	// - application/json
-	// - text/plain
-	//
-	// parameters:
-	// - name: objectType
-	//   in: path
-	//   description: The object type of the object to return
-	//   required: true
-	//   type: string
-	// - name: objectID
-	//   in: path
-	//   description: The object ID of the object to return
-	//   required: true
-	//   type: string
-	//
-	// responses:
-	//   '200':
-	//     description: Object response
-	//     schema:
-	//       "$ref": "#/definitions/MetaData"
-	//   '404':
-	//     description: Object not found
-	//     schema:
-	//       type: string
-	//   '500':
-	//     description: Failed to retrieve the object
-	//     schema:
-	//       type: string
-	case http.MethodGet:
-		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Get %s %s\n", objectType, objectID)
-		}
+func handleObjectOperation(operation string, orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if operation != "deleted" {
 		if code, _ := canUserAccessObject(request, orgID, objectType, objectID, false); code == security.AuthFailed {
 			writer.WriteHeader(http.StatusForbidden)
 			writer.Write(unauthorizedBytes)
 			return
 		}
-		if metaData, err := GetObject(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "", 0)
-		} else {
-			if metaData == nil {
-				writer.WriteHeader(http.StatusNotFound)
-			} else {
-				if data, err := json.MarshalIndent(metaData, "", "  "); err != nil {
-					communications.SendErrorResponse(writer, err, "Failed to marshal metadata. Error: ", 0)
-				} else {
-					writer.Header().Add(contentType, applicationJSON)
-					writer.WriteHeader(http.StatusOK)
-					if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
-						log.Error("Failed to write response body, error: " + err.Error())
-					}
-				}
-			}
+	}
+
+	switch operation {
+	case "consumed":
+		handleObjectConsumed(orgID, objectType, objectID, writer, request)
+	case "partiallyconsumed":
+		handleObjectPartiallyConsumed(orgID, objectType, objectID, writer, request)
+	case "deleted":
+		handleObjectDeleted(orgID, objectType, objectID, writer, request)
+	case "policyreceived":
+		handlePolicyReceived(orgID, objectType, objectID, writer, request)
+	case "received":
+		handleObjectReceived(orgID, objectType, objectID, writer, request)
+	case "activate":
+		handleActivateObject(orgID, objectType, objectID, writer, request)
+	case "status":
+		handleObjectStatus(orgID, objectType, objectID, writer, request)
+	case "progress":
+		handleObjectProgress(orgID, objectType, objectID, writer, request)
+	case "upload":
+		handleObjectUpload(orgID, objectType, objectID, writer, request)
+	case "destinations":
+		handleObjectDestinations(orgID, objectType, objectID, writer, request)
+	case "deliverystatus":
+		handleObjectDeliveryStatus(orgID, objectType, objectID, writer, request)
+	case "data":
+		switch request.Method {
+		case http.MethodGet:
+			handleObjectGetData(orgID, objectType, objectID, writer)
+
+		case http.MethodPut:
+			handleObjectPutData(orgID, objectType, objectID, writer, request)
+
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
 		}
+	default:
+		writer.WriteHeader(http.StatusBadRequest)
+	}
+}
 
-	// swagger:operation DELETE /api/v1/objects/{orgID}/{objectType}/{objectID} handleDeleteObject
-	//
-	// Delete an object.
-	//
-	// Delete the object of the specified object type and object ID.
-	// Destinations of the object will be notified that the object has been deleted.
-	//
-	// ---
-	//
-	// tags:
-	// - CSS
-	//
-	// produces:
-	// - text/plain
-	//
-	// parameters:
-	// - name: orgID
-	//   in: path
-	//   description: The orgID of the object to delete.
-	//   required: true
-	//   type: string
-	// - name: objectType
-	//   in: path
-	//   description: The object type of the object to delete
-	//   required: true
-	//   type: string
-	// - name: objectID
-	//   in: path
-	//   description: The object ID of the object to delete
-	//   required: true
-	//   type: string
-	//
-	// responses:
-	//   '204':
-	//     description: Object deleted
-	//     schema:
-	//       type: string
-	//   '500':
-	//     description: Failed to delete the object
-	//     schema:
-	//       type: string
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/consumed handleObjectConsumed
+//
+// Mark an object as consumed.
+//
+// Mark the object of the specified object type and object ID as having been consumed by the application.
+// After the object is marked as consumed it will not be delivered to the application again (even if the sync service is restarted).
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the object to mark as consumed.
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the object to mark as consumed
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to mark as consumed
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: Object marked as consumed
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to mark the object consumed
+//     schema:
+//       type: string
 
-	// ======================================================================================
+// ======================================================================================
 
-	// swagger:operation DELETE /api/v1/objects/{objectType}/{objectID} handleDeleteObject
-	//
-	// Delete an object.
-	//
-	// Delete the object of the specified object type and object ID.
-	// Destinations of the object will be notified that the object has been deleted.
-	//
-	// ---
-	//
-	// tags:
-	// - ESS
-	//
-	// produces:
-	// - text/plain
-	//
-	// parameters:
-	// - name: objectType
-	//   in: path
-	//   description: The object type of the object to delete
-	//   required: true
-	//   type: string
-	// - name: objectID
-	//   in: path
-	//   description: The object ID of the object to delete
-	//   required: true
-	//   type: string
-	//
-	// responses:
-	//   '204':
-	//     description: Object deleted
-	//     schema:
-	//       type: string
-	//   '500':
-	//     description: Failed to delete the object
-	//     schema:
-	//       type: string
-	case http.MethodDelete:
+// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/consumed handleObjectConsumed
+//
+// Mark an object as consumed.
+//
+// Mark the object of the specified object type and object ID as having been consumed by the application.
+// After the object is marked as consumed it will not be delivered to the application again (even if the sync service is restarted).
+//
+// ---
+//
+// tags:
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: objectType
+//   in: path
+//   description: The object type of the object to mark as consumed
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to mark as consumed
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: Object marked as consumed
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to mark the object consumed
+//     schema:
+//       type: string
+func handleObjectConsumed(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPut {
 		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Delete %s %s\n", objectType, objectID)
-		}
-		if code, _ := canUserAccessObject(request, orgID, objectType, objectID, false); code == security.AuthFailed {
-			writer.WriteHeader(http.StatusForbidden)
-			writer.Write(unauthorizedBytes)
-			return
+			trace.Debug("In handleObjects. Consumed %s %s\n", objectType, objectID)
 		}
-		if err := DeleteObject(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to delete the object. Error: ", 0)
+		if err := ObjectConsumed(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to mark the object as consumed. Error: ", 0)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
 		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
 
-	case http.MethodPut:
-		handleUpdateObject(orgID, objectType, objectID, writer, request)
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/partiallyconsumed handleObjectPartiallyConsumed
+//
+// Mark an object as partially consumed.
+//
+// Report that the application consumed the data of the object of the specified object type and object ID up to the given offset,
+// before it consumed the whole object. The offset is sent to the object's origin, which records it in the object's delivery status
+// for the destination. The object must still be marked as consumed once the application consumed all of its data.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the object to mark as partially consumed.
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the object to mark as partially consumed
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to mark as partially consumed
+//   required: true
+//   type: string
+// - name: offset
+//   in: query
+//   description: The offset up to which the object's data was consumed
+//   required: true
+//   type: integer
+//   format: int64
+//
+// responses:
+//   '204':
+//     description: Object marked as partially consumed
+//     schema:
+//       type: string
+//   '400':
+//     description: The offset is missing or invalid
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to mark the object as partially consumed
+//     schema:
+//       type: string
 
-	default:
+// ======================================================================================
+
+// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/partiallyconsumed handleObjectPartiallyConsumed
+//
+// Mark an object as partially consumed.
+//
+// Report that the application consumed the data of the object of the specified object type and object ID up to the given offset,
+// before it consumed the whole object. The offset is sent to the object's origin, which records it in the object's delivery status
+// for the destination. The object must still be marked as consumed once the application consumed all of its data.
+//
+// ---
+//
+// tags:
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: objectType
+//   in: path
+//   description: The object type of the object to mark as partially consumed
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to mark as partially consumed
+//   required: true
+//   type: string
+// - name: offset
+//   in: query
+//   description: The offset up to which the object's data was consumed
+//   required: true
+//   type: integer
+//   format: int64
+//
+// responses:
+//   '204':
+//     description: Object marked as partially consumed
+//     schema:
+//       type: string
+//   '400':
+//     description: The offset is missing or invalid
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to mark the object as partially consumed
+//     schema:
+//       type: string
+func handleObjectPartiallyConsumed(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPut {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Partially consumed %s %s\n", objectType, objectID)
+	}
+	offset, err := strconv.ParseInt(request.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := ObjectPartiallyConsumed(orgID, objectType, objectID, offset); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to mark the object as partially consumed. Error: ", 0)
+	} else {
+		writer.WriteHeader(http.StatusNoContent)
 	}
 }
 
-// swagger:operation GET /api/v1/objects/{orgID}?filters=true handleListObjectsWithFilters
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/deleted handleObjectDeleted
 //
-// Get objects satisfy the given filters
+// The service confirms object deletion.
 //
-// Get the list of objects that satisfy the given filters
-// This is a CSS only API.
+// Confirm the deletion of the object of the specified object type and object ID by the application.
+// The application should invoke this API after it completed the actions associated with deleting the object.
+//
+// ---
+//
+// tags:
+// - CSS
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the object to confirm its deletion. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the object to confirm its deletion
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to confirm its deletion
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: Object's deletion confirmed
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to confirm the object's deletion
+//     schema:
+//       type: string
+func handleObjectDeleted(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	code, serviceID := canUserAccessObject(request, orgID, objectType, objectID, true)
+	if code == security.AuthFailed {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method == http.MethodPut {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Deleted %s %s\n", objectType, objectID)
+		}
+		if err := ObjectDeleted(serviceID, orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to confirm object's deletion. Error: ", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/policyreceived handlePolicyReceived
+//
+// Mark an object's destination policy as having been received.
+//
+// Mark the object of the specified object type and object ID as having its destination policy received
+// After the object is marked as such it will not be delivered to the application listing objects with
+// a destination policy, unless it adds "received=true" to the query parameters.
 //
 // ---
 //
@@ -734,256 +1891,99 @@ func handleObjectRequest(orgID string, objectType string, objectID string, write
 // - CSS
 //
 // produces:
-// - application/json
 // - text/plain
 //
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the updated objects to return. Present only when working with a CSS, removed from the path when working with an ESS
-//   required: true
-//   type: string
-// - name: filters
-//   in: query
-//   description: Must be true to indicate that objects with filters are to be retrieved
+//   description: The orgID of the object to mark as having its destination policy received.
 //   required: true
-//   type: boolean
-// - name: destinationPolicy
-//   in: query
-//   description: Must be true to indicate that objects with destinationPolicy are to be retrieved
-//   required: false
-//   type: boolean
-// - name: dpService
-//   in: query
-//   description: The ID of the service (orgID/serviceName) to which objects have affinity,
-//        whose Destination Policy should be fetched.
-//   required: false
-//   type: string
-// - name: dpPropertyName
-//   in: query
-//   description: The property name defined inside destination policy to which objects have affinity,
-//        whose Destination Policy should be fetched.
-//   required: false
-//   type: string
-// - name: since
-//   in: query
-//   description: Objects that have a Destination Policy which was updated since the specified timestamp in RFC3339 should be fetched.
-//   required: false
 //   type: string
 // - name: objectType
-//   in: query
-//   description: Fetch the objects with given object type
-//   required: false
+//   in: path
+//   description: The object type of the object to mark as having its destination policy received
+//   required: true
 //   type: string
 // - name: objectID
-//   in: query
-//   description: Fetch the objects with given object id
-//   required: false
-//   type: string
-// - name: destinationType
-//   in: query
-//   description: Fetch the objects with given destination type
-//   required: false
-//   type: string
-// - name: destinationID
-//   in: query
-//   description: Fetch the objects with given destination id
-//   required: false
-//   type: string
-// - name: noData
-//   in: query
-//   description: Fetch the objects with noData marked to true
-//   required: false
-//   type: boolean
-// - name: expirationTimeBefore
-//   in: query
-//   description: Fetch the objects with expiration time before specified timestamp in RFC3339 format
-//   required: false
+//   in: path
+//   description: The object ID of the object to mark as having its destination policy received
+//   required: true
 //   type: string
 //
 // responses:
-//   '200':
-//     description: Objects response
-//     schema:
-//       type: array
-//       items:
-//         "$ref": "#/definitions/MetaData"
-//   '404':
-//     description: No objects found
+//   '204':
+//     description: Object marked as having its destination policy received
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to retrieve the objects
+//     description: Failed to mark the object as having its destination policy received
 //     schema:
 //       type: string
-func handleListObjectsWithFilters(orgID string, writer http.ResponseWriter, request *http.Request) {
-	if trace.IsLogging(logger.DEBUG) {
-		trace.Debug("In handleListObjectsWithFilters")
-	}
-	code, userOrgID, _ := security.Authenticate(request)
-	if code != security.AuthSyncAdmin && (code != security.AuthAdmin || userOrgID != orgID) {
-		writer.WriteHeader(http.StatusForbidden)
-		writer.Write(unauthorizedBytes)
-		return
-	}
-
-	destinationPolicyString := request.URL.Query().Get("destinationPolicy")
-	var destinationPolicy *bool
-	if destinationPolicyString != "" {
-		var err error
-		destinationPolicyValue, err := strconv.ParseBool(destinationPolicyString)
-		destinationPolicy = &destinationPolicyValue
-		if err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-
-	dpServiceOrgID := ""
-	dpServiceName := ""
-	dpPropertyName := ""
-	since := int64(0)
-
-	if destinationPolicy != nil && *destinationPolicy == true {
-		dpServiceID := request.URL.Query().Get("dpService")
-		if dpServiceID != "" {
-			parts := strings.SplitN(dpServiceID, "/", 2)
-			if len(parts) < 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
-				writer.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			dpServiceOrgID = parts[0]
-			dpServiceName = parts[1]
-		}
-
-		dpPropertyName = request.URL.Query().Get("dpPropertyName")
-
-		sinceString := request.URL.Query().Get("since")
-		if sinceString != "" {
-			var err error
-			sinceTime, err := time.Parse(time.RFC3339, sinceString)
-			if err != nil {
-				writer.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			since = sinceTime.UTC().UnixNano()
-			if since < 1 {
-				writer.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-		}
-	}
-
-	objectType := request.URL.Query().Get("objectType")
-	objectID := ""
-
-	if objectType != "" {
-		objectID = request.URL.Query().Get("objectID")
-	}
-
-	destinationType := request.URL.Query().Get("destinationType")
-	destinationID := ""
-	if destinationType != "" {
-		destinationID = request.URL.Query().Get("destinationID")
-	}
-
-	var noData *bool
-	noDataString := request.URL.Query().Get("noData")
-	if noDataString != "" {
-		var err error
-		noDataVelue, err := strconv.ParseBool(noDataString)
-		noData = &noDataVelue
-		if err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-
-	expirationTimeBeforeString := request.URL.Query().Get("expirationTimeBefore")
-	if expirationTimeBeforeString != "" {
-		_, err := time.Parse(time.RFC3339, expirationTimeBeforeString)
-		if err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-
-	var objects []common.MetaData
-	var err error
-
-	if trace.IsLogging(logger.DEBUG) {
-		trace.Debug("In handleListObjectsWithFilters, get objects with %s %s %s %s %s %d %s %s %s %s %s %s\n", orgID, destinationPolicyString, dpServiceOrgID, dpServiceName, dpPropertyName, since, objectType, objectID, destinationType, destinationID, noDataString, expirationTimeBeforeString)
-	}
-
-	if objects, err = ListObjectsWithFilters(orgID, destinationPolicy, dpServiceOrgID, dpServiceName, dpPropertyName, since, objectType, objectID, destinationType, destinationID, noData, expirationTimeBeforeString); err != nil {
-		communications.SendErrorResponse(writer, err, "Failed to fetch the list of objects with given conditions. Error: ", 0)
-	} else {
-		if len(objects) == 0 {
-			writer.WriteHeader(http.StatusNotFound)
-		} else {
-			if data, err := json.MarshalIndent(objects, "", "  "); err != nil {
-				communications.SendErrorResponse(writer, err, "Failed to marshal the list of objects with a Metadata. Error: ", 0)
-			} else {
-				writer.Header().Add(contentType, applicationJSON)
-				writer.WriteHeader(http.StatusOK)
-				if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
-					log.Error("Failed to write response body, error: " + err.Error())
-				}
-			}
-		}
-
-	}
-
-}
-
-func handleObjectOperation(operation string, orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	if operation != "deleted" {
-		if code, _ := canUserAccessObject(request, orgID, objectType, objectID, false); code == security.AuthFailed {
-			writer.WriteHeader(http.StatusForbidden)
-			writer.Write(unauthorizedBytes)
-			return
-		}
-	}
-
-	switch operation {
-	case "consumed":
-		handleObjectConsumed(orgID, objectType, objectID, writer, request)
-	case "deleted":
-		handleObjectDeleted(orgID, objectType, objectID, writer, request)
-	case "policyreceived":
-		handlePolicyReceived(orgID, objectType, objectID, writer, request)
-	case "received":
-		handleObjectReceived(orgID, objectType, objectID, writer, request)
-	case "activate":
-		handleActivateObject(orgID, objectType, objectID, writer, request)
-	case "status":
-		handleObjectStatus(orgID, objectType, objectID, writer, request)
-	case "destinations":
-		handleObjectDestinations(orgID, objectType, objectID, writer, request)
-	case "data":
-		switch request.Method {
-		case http.MethodGet:
-			handleObjectGetData(orgID, objectType, objectID, writer)
 
-		case http.MethodPut:
-			handleObjectPutData(orgID, objectType, objectID, writer, request)
+// ======================================================================================
 
-		default:
-			writer.WriteHeader(http.StatusMethodNotAllowed)
+// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/policyreceived handlePolicyReceived
+//
+// Mark an object's destination policy as having been received.
+//
+// Mark the object of the specified object type and object ID as having its destination policy received
+// After the object is marked as such it will not be delivered to the application listing objects with
+// a destination policy, unless it adds "received=true" to the query parameters.
+//
+// ---
+//
+// tags:
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: objectType
+//   in: path
+//   description: The object type of the object to mark as having its destination policy received
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to mark as having its destination policy received
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: Object marked as having its destination policy received
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to mark the object as having its destination policy received
+//     schema:
+//       type: string
+func handlePolicyReceived(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPut {
+		if common.Configuration.NodeType == common.ESS {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
 		}
-	default:
-		writer.WriteHeader(http.StatusBadRequest)
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Policy Received %s %s\n", objectType, objectID)
+		}
+		if err := ObjectPolicyReceived(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to mark the object's destination policy as having been received. Error: ", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/consumed handleObjectConsumed
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/received handleObjectReceived
 //
-// Mark an object as consumed.
+// Mark an object as received.
 //
-// Mark the object of the specified object type and object ID as having been consumed by the application.
-// After the object is marked as consumed it will not be delivered to the application again (even if the sync service is restarted).
+// Mark the object of the specified object type and object ID as having been received by the application.
+// After the object is marked as received it will only be delivered to the application again if specified in the objects request.
 //
 // ---
 //
@@ -996,38 +1996,38 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the object to mark as consumed.
+//   description: The orgID of the object to mark as received
 //   required: true
 //   type: string
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as consumed
+//   description: The object type of the object to mark as received
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as consumed
+//   description: The object ID of the object to mark as received
 //   required: true
 //   type: string
 //
 // responses:
 //   '204':
-//     description: Object marked as consumed
+//     description: Object marked as received
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to mark the object consumed
+//     description: Failed to mark the object received
 //     schema:
 //       type: string
 
 // ======================================================================================
 
-// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/consumed handleObjectConsumed
+// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/received handleObjectReceived
 //
-// Mark an object as consumed.
+// Mark an object as received.
 //
-// Mark the object of the specified object type and object ID as having been consumed by the application.
-// After the object is marked as consumed it will not be delivered to the application again (even if the sync service is restarted).
+// Mark the object of the specified object type and object ID as having been received by the application.
+// After the object is marked as received it will only be delivered to the application again if specified in the objects request.
 //
 // ---
 //
@@ -1040,31 +2040,31 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 // parameters:
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as consumed
+//   description: The object type of the object to mark as received
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as consumed
+//   description: The object ID of the object to mark as received
 //   required: true
 //   type: string
 //
 // responses:
 //   '204':
-//     description: Object marked as consumed
+//     description: Object marked as received
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to mark the object consumed
+//     description: Failed to mark the object received
 //     schema:
 //       type: string
-func handleObjectConsumed(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+func handleObjectReceived(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
 	if request.Method == http.MethodPut {
 		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Consumed %s %s\n", objectType, objectID)
+			trace.Debug("In handleObjects. Received %s %s\n", objectType, objectID)
 		}
-		if err := ObjectConsumed(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to mark the object as consumed. Error: ", 0)
+		if err := ObjectReceived(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to mark the object as received. Error: ", 0)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
 		}
@@ -1073,18 +2073,18 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, writ
 	}
 }
 
-// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/deleted handleObjectDeleted
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/activate handleActivateObject
 //
-// The service confirms object deletion.
+// Mark an object as active.
 //
-// Confirm the deletion of the object of the specified object type and object ID by the application.
-// The application should invoke this API after it completed the actions associated with deleting the object.
+// Mark the object of the specified object type and object ID as active.
+// An object can be created as inactive which means it is not delivered to its destinations.
+// This API is used to activate such objects and initiate the distribution of the object to its destinations.
 //
 // ---
 //
 // tags:
 // - CSS
-// - ESS
 //
 // produces:
 // - text/plain
@@ -1092,43 +2092,76 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, writ
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the object to confirm its deletion. Present only when working with a CSS, removed from the path when working with an ESS
+//   description: The orgID of the object to mark as active
 //   required: true
 //   type: string
 // - name: objectType
 //   in: path
-//   description: The object type of the object to confirm its deletion
+//   description: The object type of the object to mark as active
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to confirm its deletion
+//   description: The object ID of the object to mark as active
 //   required: true
 //   type: string
 //
 // responses:
 //   '204':
-//     description: Object's deletion confirmed
+//     description: Object marked as active
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to confirm the object's deletion
+//     description: Failed to mark the object active
 //     schema:
 //       type: string
-func handleObjectDeleted(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	code, serviceID := canUserAccessObject(request, orgID, objectType, objectID, true)
-	if code == security.AuthFailed {
-		writer.WriteHeader(http.StatusForbidden)
-		writer.Write(unauthorizedBytes)
-		return
-	}
 
+// ======================================================================================
+
+// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/activate handleActivateObject
+//
+// Mark an object as active.
+//
+// Mark the object of the specified object type and object ID as active.
+// An object can be created as inactive which means it is not delivered to its destinations.
+// This API is used to activate such objects and initiate the distribution of the object to its destinations.
+//
+// ---
+//
+// tags:
+// - ESS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: objectType
+//   in: path
+//   description: The object type of the object to mark as active
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to mark as active
+//   required: true
+//   type: string
+//
+// responses:
+//   '204':
+//     description: Object marked as active
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to mark the object active
+//     schema:
+//       type: string
+func handleActivateObject(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
 	if request.Method == http.MethodPut {
 		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Deleted %s %s\n", objectType, objectID)
+			trace.Debug("In handleObjects. Activate %s %s\n", objectType, objectID)
 		}
-		if err := ObjectDeleted(serviceID, orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to confirm object's deletion. Error: ", 0)
+		if err := ActivateObject(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to mark the object as active. Error: ", 0)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
 		}
@@ -1137,13 +2170,20 @@ func handleObjectDeleted(orgID string, objectType string, objectID string, write
 	}
 }
 
-// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/policyreceived handlePolicyReceived
+// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/status handleObjectStatus
 //
-// Mark an object's destination policy as having been received.
+// Get the status of an object.
+//
+// Get the status of the object of the specified object type and object ID.
+// The status can be one of the following:
+//   notReady - The object is not ready to be sent to destinations.
+//   ready - The object is ready to be sent to destinations.
+//   received - The object's metadata has been received but not all its data.
+//   completelyReceived - The full object (metadata and data) has been received.
+//   signatureRejected - The object's data has been rejected, its signature is missing or doesn't match the data.
+//   consumed - The object has been consumed by the application.
+//   deleted - The object was deleted.
 //
-// Mark the object of the specified object type and object ID as having its destination policy received
-// After the object is marked as such it will not be delivered to the application listing objects with
-// a destination policy, unless it adds "received=true" to the query parameters.
 //
 // ---
 //
@@ -1156,39 +2196,47 @@ func handleObjectDeleted(orgID string, objectType string, objectID string, write
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the object to mark as having its destination policy received.
+//   description: The orgID of the object whose status will be retrieved
 //   required: true
 //   type: string
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as having its destination policy received
+//   description: The object type of the object whose status will be retrieved
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as having its destination policy received
+//   description: The object ID of the object whose status will be retrieved
 //   required: true
 //   type: string
 //
 // responses:
-//   '204':
-//     description: Object marked as having its destination policy received
+//   '200':
+//     description: Object status
 //     schema:
 //       type: string
+//       enum: [notReady, ready, received, completelyReceived, signatureRejected, consumed, deleted]
 //   '500':
-//     description: Failed to mark the object as having its destination policy received
+//     description: Failed to retrieve the object's status
 //     schema:
 //       type: string
 
 // ======================================================================================
 
-// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/policyreceived handlePolicyReceived
+// swagger:operation GET /api/v1/objects/{objectType}/{objectID}/status handleObjectStatus
 //
-// Mark an object's destination policy as having been received.
+// Get the status of an object.
+//
+// Get the status of the object of the specified object type and object ID.
+// The status can be one of the following:
+//   notReady - The object is not ready to be sent to destinations.
+//   ready - The object is ready to be sent to destinations.
+//   received - The object's metadata has been received but not all its data.
+//   completelyReceived - The full object (metadata and data) has been received.
+//   signatureRejected - The object's data has been rejected, its signature is missing or doesn't match the data.
+//   consumed - The object has been consumed by the application.
+//   deleted - The object was deleted.
 //
-// Mark the object of the specified object type and object ID as having its destination policy received
-// After the object is marked as such it will not be delivered to the application listing objects with
-// a destination policy, unless it adds "received=true" to the query parameters.
 //
 // ---
 //
@@ -1201,49 +2249,55 @@ func handleObjectDeleted(orgID string, objectType string, objectID string, write
 // parameters:
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as having its destination policy received
+//   description: The object type of the object whose status will be retrieved
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as having its destination policy received
+//   description: The object ID of the object whose status will be retrieved
 //   required: true
 //   type: string
 //
 // responses:
-//   '204':
-//     description: Object marked as having its destination policy received
+//   '200':
+//     description: Object status
 //     schema:
 //       type: string
+//       enum: [notReady, ready, received, completelyReceived, signatureRejected, consumed, deleted]
 //   '500':
-//     description: Failed to mark the object as having its destination policy received
+//     description: Failed to retrieve the object's status
 //     schema:
 //       type: string
-func handlePolicyReceived(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	if request.Method == http.MethodPut {
-		if common.Configuration.NodeType == common.ESS {
-			writer.WriteHeader(http.StatusBadRequest)
-			return
-		}
+func handleObjectStatus(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodGet {
 		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Policy Received %s %s\n", objectType, objectID)
+			trace.Debug("In handleObjects. Get status of %s %s\n", objectType, objectID)
 		}
-		if err := ObjectPolicyReceived(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to mark the object's destination policy as having been received. Error: ", 0)
+		if status, err := GetObjectStatus(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
 		} else {
-			writer.WriteHeader(http.StatusNoContent)
+			if status == "" {
+				writer.WriteHeader(http.StatusNotFound)
+			} else {
+				writer.Header().Add(contentType, "plain/text")
+				writer.WriteHeader(http.StatusOK)
+				if _, err := writer.Write([]byte(status)); err != nil && log.IsLogging(logger.ERROR) {
+					log.Error("Failed to write response body, error: " + err.Error())
+				}
+			}
 		}
 	} else {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/received handleObjectReceived
+// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/progress handleObjectProgress
 //
-// Mark an object as received.
+// Get the progress of receiving an object.
 //
-// Mark the object of the specified object type and object ID as having been received by the application.
-// After the object is marked as received it will only be delivered to the application again if specified in the objects request.
+// Get the number of bytes received so far of the data of the object of the specified object type and object ID,
+// along with the size of the data and the number of chunks that have been requested but not received yet.
+// Available only for objects received from the other side.
 //
 // ---
 //
@@ -1251,43 +2305,49 @@ func handlePolicyReceived(orgID string, objectType string, objectID string, writ
 // - CSS
 //
 // produces:
+// - application/json
 // - text/plain
 //
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the object to mark as received
+//   description: The orgID of the object whose progress will be retrieved
 //   required: true
 //   type: string
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as received
+//   description: The object type of the object whose progress will be retrieved
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as received
+//   description: The object ID of the object whose progress will be retrieved
 //   required: true
 //   type: string
 //
 // responses:
-//   '204':
-//     description: Object marked as received
+//   '200':
+//     description: Object transfer progress
+//     schema:
+//       "$ref": "#/definitions/TransferProgress"
+//   '404':
+//     description: The object was not found or was not received from the other side
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to mark the object received
+//     description: Failed to retrieve the object's progress
 //     schema:
 //       type: string
 
 // ======================================================================================
 
-// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/received handleObjectReceived
+// swagger:operation GET /api/v1/objects/{objectType}/{objectID}/progress handleObjectProgress
 //
-// Mark an object as received.
+// Get the progress of receiving an object.
 //
-// Mark the object of the specified object type and object ID as having been received by the application.
-// After the object is marked as received it will only be delivered to the application again if specified in the objects request.
+// Get the number of bytes received so far of the data of the object of the specified object type and object ID,
+// along with the size of the data and the number of chunks that have been requested but not received yet.
+// Available only for objects received from the other side.
 //
 // ---
 //
@@ -1295,51 +2355,67 @@ func handlePolicyReceived(orgID string, objectType string, objectID string, writ
 // - ESS
 //
 // produces:
+// - application/json
 // - text/plain
 //
 // parameters:
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as received
+//   description: The object type of the object whose progress will be retrieved
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as received
+//   description: The object ID of the object whose progress will be retrieved
 //   required: true
 //   type: string
 //
 // responses:
-//   '204':
-//     description: Object marked as received
+//   '200':
+//     description: Object transfer progress
+//     schema:
+//       "$ref": "#/definitions/TransferProgress"
+//   '404':
+//     description: The object was not found or was not received from the other side
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to mark the object received
+//     description: Failed to retrieve the object's progress
 //     schema:
 //       type: string
-func handleObjectReceived(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	if request.Method == http.MethodPut {
-		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Received %s %s\n", objectType, objectID)
-		}
-		if err := ObjectReceived(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to mark the object as received. Error: ", 0)
+func handleObjectProgress(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Get progress of %s %s\n", objectType, objectID)
+	}
+	if progress, err := GetObjectTransferProgress(orgID, objectType, objectID); err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+	} else if progress == nil {
+		writer.WriteHeader(http.StatusNotFound)
+	} else {
+		if body, err := json.MarshalIndent(progress, "", "  "); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to marshal object's progress. Error: ", 0)
 		} else {
-			writer.WriteHeader(http.StatusNoContent)
+			writer.Header().Add(contentType, applicationJSON)
+			writer.WriteHeader(http.StatusOK)
+			if _, err := writer.Write(body); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Failed to write response body, error: " + err.Error())
+			}
 		}
-	} else {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/activate handleActivateObject
+// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/upload handleObjectUpload
 //
-// Mark an object as active.
+// Get the progress of an upload of an object's data.
 //
-// Mark the object of the specified object type and object ID as active.
-// An object can be created as inactive which means it is not delivered to its destinations.
-// This API is used to activate such objects and initiate the distribution of the object to its destinations.
+// Get the progress of an upload of the data of the object of the specified object type and object ID in several parts.
+// An interrupted upload resumes from the returned offset.
+// Use DELETE to cancel the upload and remove the parts that were uploaded.
 //
 // ---
 //
@@ -1347,44 +2423,53 @@ func handleObjectReceived(orgID string, objectType string, objectID string, writ
 // - CSS
 //
 // produces:
+// - application/json
 // - text/plain
 //
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the object to mark as active
+//   description: The orgID of the object whose data is uploaded
 //   required: true
 //   type: string
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as active
+//   description: The object type of the object whose data is uploaded
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as active
+//   description: The object ID of the object whose data is uploaded
 //   required: true
 //   type: string
 //
 // responses:
+//   '200':
+//     description: Object data upload progress
+//     schema:
+//       "$ref": "#/definitions/UploadProgress"
 //   '204':
-//     description: Object marked as active
+//     description: The upload was cancelled
+//     schema:
+//       type: string
+//   '404':
+//     description: There is no upload of the object's data in progress
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to mark the object active
+//     description: Failed to retrieve the upload progress
 //     schema:
 //       type: string
 
 // ======================================================================================
 
-// swagger:operation PUT /api/v1/objects/{objectType}/{objectID}/activate handleActivateObject
+// swagger:operation GET /api/v1/objects/{objectType}/{objectID}/upload handleObjectUpload
 //
-// Mark an object as active.
+// Get the progress of an upload of an object's data.
 //
-// Mark the object of the specified object type and object ID as active.
-// An object can be created as inactive which means it is not delivered to its destinations.
-// This API is used to activate such objects and initiate the distribution of the object to its destinations.
+// Get the progress of an upload of the data of the object of the specified object type and object ID in several parts.
+// An interrupted upload resumes from the returned offset.
+// Use DELETE to cancel the upload and remove the parts that were uploaded.
 //
 // ---
 //
@@ -1392,57 +2477,89 @@ func handleObjectReceived(orgID string, objectType string, objectID string, writ
 // - ESS
 //
 // produces:
+// - application/json
 // - text/plain
 //
 // parameters:
 // - name: objectType
 //   in: path
-//   description: The object type of the object to mark as active
+//   description: The object type of the object whose data is uploaded
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object to mark as active
+//   description: The object ID of the object whose data is uploaded
 //   required: true
 //   type: string
 //
 // responses:
+//   '200':
+//     description: Object data upload progress
+//     schema:
+//       "$ref": "#/definitions/UploadProgress"
 //   '204':
-//     description: Object marked as active
+//     description: The upload was cancelled
+//     schema:
+//       type: string
+//   '404':
+//     description: There is no upload of the object's data in progress
 //     schema:
 //       type: string
 //   '500':
-//     description: Failed to mark the object active
+//     description: Failed to retrieve the upload progress
 //     schema:
 //       type: string
-func handleActivateObject(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	if request.Method == http.MethodPut {
+func handleObjectUpload(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
 		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Activate %s %s\n", objectType, objectID)
+			trace.Debug("In handleObjects. Get upload progress of %s %s\n", objectType, objectID)
 		}
-		if err := ActivateObject(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to mark the object as active. Error: ", 0)
+		if progress, err := GetObjectUploadProgress(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+		} else if progress == nil {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			writeUploadProgress(progress, writer)
+		}
+
+	case http.MethodDelete:
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Cancel upload of %s %s\n", objectType, objectID)
+		}
+		if found, err := CancelObjectUpload(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+		} else if !found {
+			writer.WriteHeader(http.StatusNotFound)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
 		}
-	} else {
+
+	default:
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/status handleObjectStatus
-//
-// Get the status of an object.
+func writeUploadProgress(progress *common.UploadProgress, writer http.ResponseWriter) {
+	if body, err := json.MarshalIndent(progress, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the upload progress. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(body); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
+// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/deliverystatus handleObjectDeliveryStatus
 //
-// Get the status of the object of the specified object type and object ID.
-// The status can be one of the following:
-//   notReady - The object is not ready to be sent to destinations.
-//   ready - The object is ready to be sent to destinations.
-//   received - The object's metadata has been received but not all its data.
-//   completelyReceived - The full object (metadata and data) has been received.
-//   consumed - The object has been consumed by the application.
-//   deleted - The object was deleted.
+// Get the delivery status of an object.
 //
+// Get the list of sync service (ESS) nodes which are the destinations of the object of the specified object type and object ID,
+// with the delivery status of the object for each of them, along with the number of destinations in each status
+// (e.g., how many destinations received the object and how many consumed it).
+// This is a CSS only API.
 //
 // ---
 //
@@ -1450,102 +2567,62 @@ func handleActivateObject(orgID string, objectType string, objectID string, writ
 // - CSS
 //
 // produces:
+// - application/json
 // - text/plain
 //
 // parameters:
 // - name: orgID
 //   in: path
-//   description: The orgID of the object whose status will be retrieved
+//   description: The orgID of the object whose delivery status will be retrieved
 //   required: true
 //   type: string
 // - name: objectType
 //   in: path
-//   description: The object type of the object whose status will be retrieved
+//   description: The object type of the object whose delivery status will be retrieved
 //   required: true
 //   type: string
 // - name: objectID
 //   in: path
-//   description: The object ID of the object whose status will be retrieved
+//   description: The object ID of the object whose delivery status will be retrieved
 //   required: true
 //   type: string
 //
 // responses:
 //   '200':
-//     description: Object status
-//     schema:
-//       type: string
-//       enum: [notReady, ready, received, completelyReceived, consumed, deleted]
-//   '500':
-//     description: Failed to retrieve the object's status
+//     description: Object delivery status
 //     schema:
-//       type: string
-
-// ======================================================================================
-
-// swagger:operation GET /api/v1/objects/{objectType}/{objectID}/status handleObjectStatus
-//
-// Get the status of an object.
-//
-// Get the status of the object of the specified object type and object ID.
-// The status can be one of the following:
-//   notReady - The object is not ready to be sent to destinations.
-//   ready - The object is ready to be sent to destinations.
-//   received - The object's metadata has been received but not all its data.
-//   completelyReceived - The full object (metadata and data) has been received.
-//   consumed - The object has been consumed by the application.
-//   deleted - The object was deleted.
-//
-//
-// ---
-//
-// tags:
-// - ESS
-//
-// produces:
-// - text/plain
-//
-// parameters:
-// - name: objectType
-//   in: path
-//   description: The object type of the object whose status will be retrieved
-//   required: true
-//   type: string
-// - name: objectID
-//   in: path
-//   description: The object ID of the object whose status will be retrieved
-//   required: true
-//   type: string
-//
-// responses:
-//   '200':
-//     description: Object status
+//       "$ref": "#/definitions/ObjectDeliveryStatus"
+//   '404':
+//     description: The object was not found or has no destinations
 //     schema:
 //       type: string
-//       enum: [notReady, ready, received, completelyReceived, consumed, deleted]
 //   '500':
-//     description: Failed to retrieve the object's status
+//     description: Failed to retrieve the object's delivery status
 //     schema:
 //       type: string
-func handleObjectStatus(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	if request.Method == http.MethodGet {
-		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleObjects. Get status of %s %s\n", objectType, objectID)
-		}
-		if status, err := GetObjectStatus(orgID, objectType, objectID); err != nil {
-			communications.SendErrorResponse(writer, err, "", 0)
+func handleObjectDeliveryStatus(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Get delivery status of %s %s\n", objectType, objectID)
+	}
+	if deliveryStatus, err := GetObjectDeliveryStatus(orgID, objectType, objectID); err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+	} else if deliveryStatus == nil {
+		writer.WriteHeader(http.StatusNotFound)
+	} else {
+		if body, err := json.MarshalIndent(deliveryStatus, "", "  "); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to marshal object's delivery status. Error: ", 0)
 		} else {
-			if status == "" {
-				writer.WriteHeader(http.StatusNotFound)
-			} else {
-				writer.Header().Add(contentType, "plain/text")
-				writer.WriteHeader(http.StatusOK)
-				if _, err := writer.Write([]byte(status)); err != nil && log.IsLogging(logger.ERROR) {
-					log.Error("Failed to write response body, error: " + err.Error())
-				}
+			writer.Header().Add(contentType, applicationJSON)
+			writer.WriteHeader(http.StatusOK)
+			if _, err := writer.Write(body); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Failed to write response body, error: " + err.Error())
 			}
 		}
-	} else {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
@@ -1830,19 +2907,38 @@ func handleObjectGetData(orgID string, objectType string, objectID string, write
 //   description: The object ID of the object whose data will be updated
 //   required: true
 //   type: string
+// - name: offset
+//   in: query
+//   description: The offset of the uploaded part of the data, when the data is uploaded in several parts.
+//     An upload starts at offset 0, and an interrupted upload resumes from the offset returned in the upload progress.
+//   required: false
+//   type: integer
+// - name: size
+//   in: query
+//   description: The size of the whole data, required when the offset is set
+//   required: false
+//   type: integer
 // - name: payload
 //   in: body
-//   description: The object's new data. When read data bytes from a file, please set application/octet-stream as Content-Type in header.
+//   description: The object's new data, or a part of it when the offset is set. When read data bytes from a file, please set application/octet-stream as Content-Type in header.
 //   required: true
 //   schema:
 //     type: string
 //     format: binary
 //
 // responses:
+//   '200':
+//     description: A part of the object's data was uploaded
+//     schema:
+//       "$ref": "#/definitions/UploadProgress"
 //   '204':
 //     description: Object data updated
 //     schema:
 //       type: string
+//   '400':
+//     description: Invalid offset or size
+//     schema:
+//       type: string
 //   '404':
 //     description: The specified object doesn't exist
 //     schema:
@@ -1883,19 +2979,38 @@ func handleObjectGetData(orgID string, objectType string, objectID string, write
 //   description: The object ID of the object whose data will be updated
 //   required: true
 //   type: string
+// - name: offset
+//   in: query
+//   description: The offset of the uploaded part of the data, when the data is uploaded in several parts.
+//     An upload starts at offset 0, and an interrupted upload resumes from the offset returned in the upload progress.
+//   required: false
+//   type: integer
+// - name: size
+//   in: query
+//   description: The size of the whole data, required when the offset is set
+//   required: false
+//   type: integer
 // - name: payload
 //   in: body
-//   description: The object's new data. When read data bytes from a file, please set application/octet-stream as Content-Type in header.
+//   description: The object's new data, or a part of it when the offset is set. When read data bytes from a file, please set application/octet-stream as Content-Type in header.
 //   required: true
 //   schema:
 //     type: string
 //     format: binary
 //
 // responses:
+//   '200':
+//     description: A part of the object's data was uploaded
+//     schema:
+//       "$ref": "#/definitions/UploadProgress"
 //   '204':
 //     description: Object data updated
 //     schema:
 //       type: string
+//   '400':
+//     description: Invalid offset or size
+//     schema:
+//       type: string
 //   '404':
 //     description: The specified object doesn't exist
 //     schema:
@@ -1908,6 +3023,10 @@ func handleObjectPutData(orgID string, objectType string, objectID string, write
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In handleObjects. Update data %s %s\n", objectType, objectID)
 	}
+	if offsetString := request.URL.Query().Get("offset"); offsetString != "" {
+		handleObjectPutDataPart(orgID, objectType, objectID, offsetString, writer, request)
+		return
+	}
 	if found, err := PutObjectData(orgID, objectType, objectID, request.Body); err == nil {
 		if !found {
 			writer.WriteHeader(http.StatusNotFound)
@@ -1919,6 +3038,32 @@ func handleObjectPutData(orgID string, objectType string, objectID string, write
 	}
 }
 
+func handleObjectPutDataPart(orgID string, objectType string, objectID string, offsetString string, writer http.ResponseWriter,
+	request *http.Request) {
+	offset, err := strconv.ParseInt(offsetString, 10, 64)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.ParseInt(request.URL.Query().Get("size"), 10, 64)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if request.ContentLength < 0 {
+		communications.SendErrorResponse(writer, &common.InvalidRequest{Message: "The length of a part of the data must be set"}, "", 0)
+		return
+	}
+
+	if progress, err := PutObjectDataPart(orgID, objectType, objectID, request.Body, request.ContentLength, offset, size); err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+	} else if progress == nil {
+		writer.WriteHeader(http.StatusNotFound)
+	} else {
+		writeUploadProgress(progress, writer)
+	}
+}
+
 // swagger:operation GET /api/v1/objects/{orgID}/{objectType} handleListObjects
 //
 // Get objects of the specified type.
@@ -2417,7 +3562,8 @@ func handleListObjectsWithDestinationPolicy(orgID string, writer http.ResponseWr
 // Register or delete a webhook.
 //
 // Register or delete a webhook for the specified object type.
-// A webhook is used to process notifications on updates for objects of the specified object type.
+// A webhook is used to process notifications on updates for objects of the specified object type,
+// or on their deletion if the webhook's event is deleted.
 //
 // ---
 //
@@ -2465,7 +3611,8 @@ func handleListObjectsWithDestinationPolicy(orgID string, writer http.ResponseWr
 // Register or delete a webhook.
 //
 // Register or delete a webhook for the specified object type.
-// A webhook is used to process notifications on updates for objects of the specified object type.
+// A webhook is used to process notifications on updates for objects of the specified object type,
+// or on their deletion if the webhook's event is deleted.
 //
 // ---
 //
@@ -2516,16 +3663,23 @@ func handleWebhook(orgID string, objectType string, writer http.ResponseWriter,
 	var payload webhookUpdate
 	err := json.NewDecoder(request.Body).Decode(&payload)
 	if err == nil {
+		key := objectType
+		if strings.EqualFold(payload.Event, common.ObjectDeletedEvent) {
+			key = common.DeletionWebhooksKey(objectType)
+		} else if payload.Event != "" && !strings.EqualFold(payload.Event, common.ObjectUpdatedEvent) {
+			communications.SendErrorResponse(writer, nil, "Invalid webhook event", http.StatusBadRequest)
+			return
+		}
 		if strings.EqualFold(payload.Action, "delete") {
 			if trace.IsLogging(logger.DEBUG) {
-				trace.Debug("In handleObjects. Delete webhook %s\n", objectType)
+				trace.Debug("In handleObjects. Delete webhook %s\n", key)
 			}
-			hookErr = DeleteWebhook(orgID, objectType, payload.URL)
+			hookErr = DeleteWebhook(orgID, key, payload.URL)
 		} else if strings.EqualFold(payload.Action, "register") {
 			if trace.IsLogging(logger.DEBUG) {
-				trace.Debug("In handleObjects. Register webhook %s\n", objectType)
+				trace.Debug("In handleObjects. Register webhook %s\n", key)
 			}
-			hookErr = RegisterWebhook(orgID, objectType, payload.URL)
+			hookErr = RegisterWebhook(orgID, key, payload.URL)
 		}
 		if hookErr == nil {
 			writer.WriteHeader(http.StatusNoContent)
@@ -3322,6 +4476,8 @@ type healthReport struct {
 	DBHealth    common.DBHealthStatusInfo    `json:"dbHealth"`
 	Usage       *common.UsageInfo            `json:"usage,omitempty"`
 	MQTTHealth  *common.MQTTHealthStatusInfo `json:"mqttHealth,omitempty"`
+
+	CircuitBreakers []common.CircuitBreakerStatistics `json:"circuitBreakers,omitempty"`
 }
 
 // swagger:operation GET /api/v1/health handleHealth
@@ -3385,6 +4541,7 @@ func handleHealth(writer http.ResponseWriter, request *http.Request) {
 
 	var registeredESS uint32
 	var storedObjects uint32
+	var pendingNotifications uint32
 	if details {
 		nodes, err := store.GetNumberOfDestinations()
 		if err == nil {
@@ -3394,12 +4551,14 @@ func handleHealth(writer http.ResponseWriter, request *http.Request) {
 		if err == nil {
 			storedObjects = objects
 		}
+		pendingNotifications = uint32(communications.NotificationQueueDepth())
 	}
-	common.HealthStatus.UpdateHealthInfo(details, registeredESS, storedObjects)
+	common.HealthStatus.UpdateHealthInfo(details, registeredESS, storedObjects, pendingNotifications)
 
 	report := healthReport{GeneralInfo: common.HealthStatus, DBHealth: common.DBHealth}
 	if details {
 		report.Usage = &common.HealthUsageInfo
+		report.CircuitBreakers = communications.GetCircuitBreakersStatistics()
 	}
 	if common.Configuration.CommunicationProtocol != common.HTTPProtocol {
 		report.MQTTHealth = &common.MQTTHealth
@@ -3416,6 +4575,65 @@ func handleHealth(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// swagger:operation GET /api/v1/health/ready handleReadiness
+//
+// Get the readiness of the sync service.
+//
+// Get the readiness of the sync service node, based on whether the storage can be reached, whether the transport is
+// connected, and the backlog of transfers and notifications. The readiness doesn't require authentication, so that
+// it can be used as a readiness probe.
+//
+// ---
+//
+// tags:
+// - CSS
+// - ESS
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// responses:
+//   '200':
+//     description: The node is ready
+//     schema:
+//       "$ref": "#/definitions/Readiness"
+//   '503':
+//     description: The node is degraded or can't serve
+//     schema:
+//       "$ref": "#/definitions/Readiness"
+//   '500':
+//     description: Failed to marshal the readiness
+//     schema:
+//       type: string
+func handleReadiness(writer http.ResponseWriter, request *http.Request) {
+	setCacheControlHeaders(writer)
+
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	readiness := communications.HealthStatus()
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleReadiness. Status %s\n", readiness.Status)
+	}
+
+	if data, err := json.MarshalIndent(readiness, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the readiness. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		if readiness.Status == common.Green {
+			writer.WriteHeader(http.StatusOK)
+		} else {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
 // Set HTTP cache control headers for http 1.0 and 1.1 clients.
 func setCacheControlHeaders(writer http.ResponseWriter) {
 	writer.Header().Set("Cache-Control", "no-store")
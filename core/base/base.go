@@ -1,6 +1,7 @@
 package base
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/open-horizon/edge-sync-service/core/security"
 	"github.com/open-horizon/edge-sync-service/core/storage"
 	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
 )
 
@@ -31,9 +33,23 @@ var maintenanceStopChannel chan int
 var pingTicker *time.Ticker
 var pingStopChannel chan int
 
+var heartbeatTicker *time.Ticker
+var heartbeatStopChannel chan int
+
 var removeESSTicker *time.Ticker
 var removeESSStopChannel chan int
 
+var offlineDestinationsTicker *time.Ticker
+var offlineDestinationsStopChannel chan int
+var deliveryDeadlinesTicker *time.Ticker
+var deliveryDeadlinesStopChannel chan int
+
+var dataReencryptionTicker *time.Ticker
+var dataReencryptionStopChannel chan int
+
+var tlsReloadTicker *time.Ticker
+var tlsReloadStopChannel chan int
+
 var waitingOnBlockChannel bool
 var blockChannel chan int
 
@@ -56,7 +72,12 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 	activateStopChannel = make(chan int, 1)
 	maintenanceStopChannel = make(chan int, 1)
 	pingStopChannel = make(chan int, 1)
+	heartbeatStopChannel = make(chan int, 1)
 	removeESSStopChannel = make(chan int, 1)
+	offlineDestinationsStopChannel = make(chan int, 1)
+	deliveryDeadlinesStopChannel = make(chan int, 1)
+	dataReencryptionStopChannel = make(chan int, 1)
+	tlsReloadStopChannel = make(chan int, 1)
 
 	common.ResetGoRoutineCounter()
 
@@ -86,6 +107,10 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 
 	security.Start()
 
+	// The locks created during initialization don't reflect the configured number of locks
+	apiObjectLocks = *common.NewLocks("api")
+	communications.InitLocks()
+
 	if common.Configuration.NodeType == common.CSS {
 		var cssStore storage.Storage
 		if common.Configuration.StorageProvider == common.Mongo {
@@ -107,12 +132,34 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 		}
 	}
 
+	if common.Configuration.DataEncryptionKey != "" {
+		keys, err := common.DataEncryptionKeys()
+		if err != nil {
+			return &common.SetupError{Message: fmt.Sprintf("Failed to create the data codec. Error: %s\n", err.Error())}
+		}
+		keyring, err := storage.NewDataKeyring(keys, common.Configuration.DataEncryptionKeyID)
+		if err != nil {
+			return &common.SetupError{Message: fmt.Sprintf("Failed to create the data codec. Error: %s\n", err.Error())}
+		}
+		storage.RegisterDataCodec(keyring)
+	}
+
 	if err := store.Init(); err != nil {
 		return &common.SetupError{Message: fmt.Sprintf("Failed to initialize storage driver. Error: %s\n", err.Error())}
 	}
+
+	if common.Configuration.DataWriteAheadLog {
+		if err := storage.OpenDataLog(common.Configuration.PersistenceRootPath + "/sync/db/ess-data.wal"); err != nil {
+			return &common.SetupError{Message: fmt.Sprintf("Failed to open the data write-ahead log. Error: %s\n", err.Error())}
+		}
+	}
+	if err := communications.LoadTransferCheckpoint(); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to load the checkpoint of the transfers. Error: %s\n", err.Error())
+	}
 	communications.Store = store
 	security.Store = store
 
+	leader.SetChangeOwnershipCallback(communications.HandOffMovedTransfers)
 	leader.StartLeaderDetermination(store)
 
 	var mqttComm *communications.MQTT
@@ -153,10 +200,16 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 		common.GoRoutineStarted()
 		keepRunning := true
 		for keepRunning {
-			resendTimer = time.NewTimer(time.Second * time.Duration(common.Configuration.ResendInterval))
+			resendTimer = time.NewTimer(time.Second * time.Duration(common.Configuration.NotificationResendInterval))
 			select {
 			case <-resendTimer.C:
 				communications.ResendNotifications()
+				if leader.CheckIfLeader() {
+					communications.RetryWebhooks()
+					communications.RetryObjectCleanups()
+					communications.DeletePendingObjects()
+					communications.EvictObjects()
+				}
 
 			case <-resendStopChannel:
 				keepRunning = false
@@ -194,6 +247,7 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 				select {
 				case <-maintenanceTimer.C:
 					if leader.CheckIfLeader() {
+						communications.DeleteExpiredObjects()
 						store.PerformMaintenance()
 					}
 
@@ -225,6 +279,27 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 		}()
 	}
 
+	if common.Configuration.NodeType == common.ESS && common.Configuration.ESSHeartbeatInterval > 0 {
+		heartbeatTicker = time.NewTicker(time.Second * time.Duration(common.Configuration.ESSHeartbeatInterval))
+		go func() {
+			common.GoRoutineStarted()
+			keepRunning := true
+			for keepRunning {
+				select {
+				case <-heartbeatTicker.C:
+					if common.Registered {
+						communications.Comm.SendHeartbeat()
+					}
+
+				case <-heartbeatStopChannel:
+					keepRunning = false
+				}
+			}
+			heartbeatTicker = nil
+			common.GoRoutineEnded()
+		}()
+	}
+
 	if common.Configuration.NodeType == common.CSS && common.Configuration.RemoveESSRegistrationTime > 0 {
 		removeESSTicker = time.NewTicker(time.Hour * 24 * time.Duration(common.Configuration.RemoveESSRegistrationTime))
 		lastTimestamp := time.Now()
@@ -248,6 +323,100 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 		}()
 	}
 
+	if common.Configuration.NodeType == common.CSS && common.Configuration.DestinationOfflineTimeout > 0 {
+		interval := common.Configuration.DestinationOfflineTimeout / 2
+		if interval == 0 {
+			interval = 1
+		}
+		offlineDestinationsTicker = time.NewTicker(time.Second * time.Duration(interval))
+		go func() {
+			common.GoRoutineStarted()
+			keepRunning := true
+			for keepRunning {
+				select {
+				case <-offlineDestinationsTicker.C:
+					if leader.CheckIfLeader() {
+						if err := communications.ReapOfflineDestinations(); err != nil && log.IsLogging(logger.ERROR) {
+							log.Error("Failed to mark offline destinations. Error: %s\n", err.Error())
+						}
+					}
+
+				case <-offlineDestinationsStopChannel:
+					keepRunning = false
+				}
+			}
+			offlineDestinationsTicker = nil
+			common.GoRoutineEnded()
+		}()
+	}
+
+	if common.Configuration.NodeType == common.CSS && common.Configuration.DeliveryDeadlineCheckInterval > 0 {
+		deliveryDeadlinesTicker = time.NewTicker(time.Second * time.Duration(common.Configuration.DeliveryDeadlineCheckInterval))
+		go func() {
+			common.GoRoutineStarted()
+			keepRunning := true
+			for keepRunning {
+				select {
+				case <-deliveryDeadlinesTicker.C:
+					if leader.CheckIfLeader() {
+						if err := communications.CheckDeliveryDeadlines(); err != nil && log.IsLogging(logger.ERROR) {
+							log.Error("Failed to check the delivery deadlines. Error: %s\n", err.Error())
+						}
+					}
+
+				case <-deliveryDeadlinesStopChannel:
+					keepRunning = false
+				}
+			}
+			deliveryDeadlinesTicker = nil
+			common.GoRoutineEnded()
+		}()
+	}
+
+	if common.Configuration.PreviousDataEncryptionKeys != "" && common.Configuration.DataReencryptionInterval > 0 {
+		dataReencryptionTicker = time.NewTicker(time.Second * time.Duration(common.Configuration.DataReencryptionInterval))
+		go func() {
+			common.GoRoutineStarted()
+			keepRunning := true
+			for keepRunning {
+				select {
+				case <-dataReencryptionTicker.C:
+					if leader.CheckIfLeader() {
+						if err := communications.ReencryptObjectsData(); err != nil && log.IsLogging(logger.ERROR) {
+							log.Error("Failed to re-encrypt the data of objects. Error: %s\n", err.Error())
+						}
+					}
+
+				case <-dataReencryptionStopChannel:
+					keepRunning = false
+				}
+			}
+			dataReencryptionTicker = nil
+			common.GoRoutineEnded()
+		}()
+	}
+
+	if common.Configuration.TLSReloadInterval > 0 {
+		tlsReloadTicker = time.NewTicker(time.Second * time.Duration(common.Configuration.TLSReloadInterval))
+		go func() {
+			common.GoRoutineStarted()
+			keepRunning := true
+			for keepRunning {
+				select {
+				case <-tlsReloadTicker.C:
+					if err := communications.ReloadTLSIfModified(); err != nil && log.IsLogging(logger.ERROR) {
+						log.Error("Failed to reload the TLS configuration. Error: %s\n", err.Error())
+					}
+
+				case <-tlsReloadStopChannel:
+					keepRunning = false
+				}
+			}
+			tlsReloadTicker = nil
+			common.GoRoutineEnded()
+		}()
+	}
+
 	err = startHTTPServer(ipAddress, registerHandlers, swaggerFile)
 	if err == nil {
 		common.Running = true
@@ -316,6 +485,12 @@ func Stop(quiesceTime int, unregisterSelf bool) {
 			<-timer.C
 		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(common.Configuration.ShutdownDrainTimeout)*time.Second)
+		if err := communications.Shutdown(ctx); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to shut down the transfers. Error: %s\n", err.Error())
+		}
+		cancel()
+
 		stopHTTPServing()
 
 		communication.StopCommunication()
@@ -342,14 +517,40 @@ func Stop(quiesceTime int, unregisterSelf bool) {
 			pingTicker.Stop()
 		}
 
+		heartbeatStopChannel <- 1
+		if heartbeatTicker != nil {
+			heartbeatTicker.Stop()
+		}
+
 		removeESSStopChannel <- 1
 		if removeESSTicker != nil {
 			removeESSTicker.Stop()
 		}
 
+		offlineDestinationsStopChannel <- 1
+		if offlineDestinationsTicker != nil {
+			offlineDestinationsTicker.Stop()
+		}
+
+		deliveryDeadlinesStopChannel <- 1
+		if deliveryDeadlinesTicker != nil {
+			deliveryDeadlinesTicker.Stop()
+		}
+
+		dataReencryptionStopChannel <- 1
+		if dataReencryptionTicker != nil {
+			dataReencryptionTicker.Stop()
+		}
+
+		tlsReloadStopChannel <- 1
+		if tlsReloadTicker != nil {
+			tlsReloadTicker.Stop()
+		}
+
 		common.BlockUntilNoRunningGoRoutines()
 
 		store.Stop()
+		storage.CloseDataLog()
 
 		if waitingOnBlockChannel {
 			blockChannel <- 1
@@ -359,6 +560,18 @@ func Stop(quiesceTime int, unregisterSelf bool) {
 	}
 }
 
+// ReloadTLS reloads the TLS certificates and keys used to communicate with the MQTT broker or the CSS, and applies
+// them to the connections established afterward
+func ReloadTLS() common.SyncServiceError {
+	startStopLock.Lock()
+	defer startStopLock.Unlock()
+
+	if !started {
+		return &common.InvalidRequest{Message: "The Sync Service isn't running"}
+	}
+	return communication.ReloadTLS()
+}
+
 // BlockUntilShutdown blocks the current "thread"
 func BlockUntilShutdown() {
 	waitingOnBlockChannel = true
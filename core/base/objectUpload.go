@@ -0,0 +1,285 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/dataURI"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// An application can upload the data of an object in several parts, each written at its offset, so that an upload
+// interrupted by a restart of the application or of the node resumes from the data that was already received.
+// The parts are staged in a file under the PersistenceRootPath, and the received byte ranges are persisted next to it.
+// The object's data is replaced only when all of the uploaded data was received, until then the current data is sent.
+
+const uploadsDir = "/sync/uploads/"
+
+func uploadPath(orgID string, objectType string, objectID string) string {
+	return common.Configuration.PersistenceRootPath + uploadsDir + orgID + "-" + objectType + "-" + objectID
+}
+
+// objectUpload is the persisted state of an upload. The staged data is encoded with the codec of the upload, which is
+// recorded with the state of the upload, as the parts of the upload may be received across restarts of the node.
+type objectUpload struct {
+	common.UploadProgress
+	DataCodec *storage.ObjectDataCodec `json:"data-codec,omitempty"`
+}
+
+// The parts are appended to the file of the data URI's path with a .tmp suffix
+func uploadDataURI(orgID string, objectType string, objectID string) string {
+	return "file://" + uploadPath(orgID, objectType, objectID)
+}
+
+// PutObjectDataPart stores a part of an object's data uploaded by an application. The data is size bytes long, and the part
+// is dataLength bytes at offset. An upload starts at offset 0, and can be resumed from the offset in the returned progress.
+// When all of the data has been received, it is stored as the object's data.
+// Returns nil and no error if the object was not found.
+func PutObjectDataPart(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength int64, offset int64,
+	size int64) (*common.UploadProgress, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In PutObjectDataPart. Update data %s %s (offset %d, length %d, size %d)\n", objectType, objectID,
+			offset, dataLength, size)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if offset < 0 || dataLength < 0 || offset+dataLength > size {
+		return nil, &common.InvalidRequest{Message: fmt.Sprintf("Invalid part of the data: %d bytes at offset %d of data of %d bytes",
+			dataLength, offset, size)}
+	}
+	if dataLength > math.MaxUint32 {
+		return nil, &common.InvalidRequest{Message: fmt.Sprintf("Invalid part of the data: %d bytes is too large", dataLength)}
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil || metaData == nil {
+		return nil, err
+	}
+	if status != common.ReadyToSend && status != common.NotReadyToSend {
+		return nil, &common.InvalidRequest{Message: "Can't update data of the receiving side"}
+	}
+	if metaData.NoData {
+		return nil, &common.InvalidRequest{Message: "Can't update data, the NoData flag is set to true"}
+	}
+
+	upload, err := loadObjectUpload(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if upload != nil && upload.Size != size {
+		if offset != 0 {
+			return nil, &common.InvalidRequest{Message: fmt.Sprintf("The size of the data doesn't match the upload in progress of %d bytes",
+				upload.Size)}
+		}
+		// A new upload replaces the upload in progress
+		upload = nil
+	}
+	isFirstPart := upload == nil
+	if isFirstPart {
+		if offset != 0 {
+			return nil, &common.InvalidRequest{Message: "There is no upload in progress of the object's data, the upload must start at offset 0"}
+		}
+		if err := removeObjectUpload(orgID, objectType, objectID); err != nil {
+			return nil, err
+		}
+		dataCodec, err := storage.NewObjectDataCodec()
+		if err != nil {
+			return nil, err
+		}
+		upload = &objectUpload{UploadProgress: common.UploadProgress{Size: size, Received: make([]common.ByteRange, 0)},
+			DataCodec: dataCodec}
+	}
+
+	if dataLength > 0 {
+		if err := os.MkdirAll(common.Configuration.PersistenceRootPath+uploadsDir, 0750); err != nil {
+			return nil, &common.IOError{Message: "Failed to create the uploads directory. Error: " + err.Error()}
+		}
+		dataReader = upload.DataCodec.NewEncodingReader(dataReader, offset)
+		if err := dataURI.AppendData(uploadDataURI(orgID, objectType, objectID), dataReader, uint32(dataLength), offset, size,
+			isFirstPart, false); err != nil {
+			return nil, err
+		}
+		// The part is recorded as received only after it is durable
+		if err := syncFile(uploadPath(orgID, objectType, objectID) + ".tmp"); err != nil {
+			return nil, err
+		}
+		upload.Received = addByteRange(upload.Received, offset, dataLength)
+	}
+	if len(upload.Received) != 0 && upload.Received[0].Offset == 0 {
+		upload.Offset = upload.Received[0].Length
+	}
+
+	if err := saveObjectUpload(orgID, objectType, objectID, upload); err != nil {
+		return nil, err
+	}
+	if upload.Offset < upload.Size {
+		return &upload.UploadProgress, nil
+	}
+	return completeObjectUpload(orgID, objectType, objectID, upload)
+}
+
+// GetObjectUploadProgress returns the progress of the upload of an object's data by an application.
+// Returns nil if there is no upload of the object's data in progress.
+func GetObjectUploadProgress(orgID string, objectType string, objectID string) (*common.UploadProgress, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In GetObjectUploadProgress. Get upload progress of %s %s\n", objectType, objectID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	upload, err := loadObjectUpload(orgID, objectType, objectID)
+	if err != nil || upload == nil {
+		return nil, err
+	}
+	if upload.Offset >= upload.Size {
+		// All of the data was received, but the node restarted before it was stored as the object's data
+		return completeObjectUpload(orgID, objectType, objectID, upload)
+	}
+	return &upload.UploadProgress, nil
+}
+
+// CancelObjectUpload removes the data received by an upload of an object's data by an application.
+// Returns false if there is no upload of the object's data in progress.
+func CancelObjectUpload(orgID string, objectType string, objectID string) (bool, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In CancelObjectUpload. Cancel upload of %s %s\n", objectType, objectID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	upload, err := loadObjectUpload(orgID, objectType, objectID)
+	if err != nil || upload == nil {
+		return false, err
+	}
+	return true, removeObjectUpload(orgID, objectType, objectID)
+}
+
+// completeObjectUpload stores the uploaded data as the object's data. Must be called while holding the object's API lock.
+func completeObjectUpload(orgID string, objectType string, objectID string, upload *objectUpload) (*common.UploadProgress,
+	common.SyncServiceError) {
+	var dataReader io.Reader = bytes.NewReader(nil)
+	if upload.Size > 0 {
+		fileReader, err := dataURI.GetData(uploadDataURI(orgID, objectType, objectID) + ".tmp")
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := fileReader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		dataReader = upload.DataCodec.NewDecodingReader(fileReader, 0)
+	}
+
+	found, err := putObjectData(orgID, objectType, objectID, dataReader)
+	if !found {
+		if err == nil {
+			// The object was deleted
+			err = removeObjectUpload(orgID, objectType, objectID)
+		}
+		return nil, err
+	}
+
+	// The data was stored even if notifying the destinations failed
+	if removeErr := removeObjectUpload(orgID, objectType, objectID); removeErr != nil && err == nil {
+		err = removeErr
+	}
+	upload.Complete = true
+	return &upload.UploadProgress, err
+}
+
+func loadObjectUpload(orgID string, objectType string, objectID string) (*objectUpload, common.SyncServiceError) {
+	data, err := ioutil.ReadFile(uploadPath(orgID, objectType, objectID) + ".json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, &common.IOError{Message: "Failed to read the state of the upload. Error: " + err.Error()}
+	}
+	var upload objectUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, &common.IOError{Message: "Failed to unmarshal the state of the upload. Error: " + err.Error()}
+	}
+	return &upload, nil
+}
+
+// saveObjectUpload replaces the persisted state of the upload, a crash leaves either the previous or the new state
+func saveObjectUpload(orgID string, objectType string, objectID string, upload *objectUpload) common.SyncServiceError {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return &common.IOError{Message: "Failed to marshal the state of the upload. Error: " + err.Error()}
+	}
+	path := uploadPath(orgID, objectType, objectID) + ".json"
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return &common.IOError{Message: "Failed to write the state of the upload. Error: " + err.Error()}
+	}
+	if err := syncFile(path + ".tmp"); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return &common.IOError{Message: "Failed to rename the state of the upload. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// removeObjectUpload removes the staged data and the state of the upload of the object's data, if there is one
+func removeObjectUpload(orgID string, objectType string, objectID string) common.SyncServiceError {
+	path := uploadPath(orgID, objectType, objectID)
+	for _, file := range []string{path + ".json", path + ".tmp"} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return &common.IOError{Message: "Failed to remove the upload of the object's data. Error: " + err.Error()}
+		}
+	}
+	return nil
+}
+
+func syncFile(path string) common.SyncServiceError {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		return &common.IOError{Message: "Failed to open file to sync it. Error: " + err.Error()}
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return &common.IOError{Message: "Failed to sync file. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// addByteRange adds a range to a sorted list of disjoint ranges, merging it with the ranges it overlaps or is adjacent to
+func addByteRange(ranges []common.ByteRange, offset int64, length int64) []common.ByteRange {
+	end := offset + length
+	// The first range that ends at or after the new range's offset
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].Offset+ranges[i].Length >= offset })
+	j := i
+	for ; j < len(ranges) && ranges[j].Offset <= end; j++ {
+		if ranges[j].Offset < offset {
+			offset = ranges[j].Offset
+		}
+		if rangeEnd := ranges[j].Offset + ranges[j].Length; rangeEnd > end {
+			end = rangeEnd
+		}
+	}
+	merged := append(make([]common.ByteRange, 0, len(ranges)-(j-i)+1), ranges[:i]...)
+	merged = append(merged, common.ByteRange{Offset: offset, Length: end - offset})
+	return append(merged, ranges[j:]...)
+}
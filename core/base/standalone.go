@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/open-horizon/edge-sync-service/core/security"
 
@@ -122,10 +124,24 @@ func StandaloneSyncService(auth security.Authentication) {
 		}
 	} else {
 		log.Info("The Sync Service has started")
+		reloadTLSOnHangup()
 		BlockUntilShutdown()
 	}
 }
 
+// reloadTLSOnHangup reloads the TLS certificates and keys of the transports whenever a SIGHUP signal is received
+func reloadTLSOnHangup() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := ReloadTLS(); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Failed to reload the TLS configuration. Error: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
 func censorAndDumpConfig() {
 	toBeCensored := []*string{&common.Configuration.ServerCertificate, &common.Configuration.ServerKey,
 		&common.Configuration.HTTPCSSCACertificate,
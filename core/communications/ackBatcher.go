@@ -0,0 +1,75 @@
+package communications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// When AckBatchWindow is set, the acks of received and consumed notifications to the same destination are collected
+// for up to AckBatchWindow milliseconds, and sent together in one message. A batch that reaches AckBatchMaxSize acks
+// is sent right away. An ack that is lost (e.g., because the batch failed to be sent) is recovered by the resend
+// of the notification that it acknowledges.
+
+type ackBatch struct {
+	orgID    string
+	destType string
+	destID   string
+	acks     []common.AckEntry
+	timer    *time.Timer
+}
+
+// The batches of acks that wait to be sent, by their destinations
+var ackBatches = make(map[string]*ackBatch)
+var ackBatchesLock sync.Mutex
+
+// sendAck sends the ack of a received or consumed notification to the destination, or adds it to the destination's batch
+// of acks if acks are batched and the destination supports batched acks
+func sendAck(command string, destType string, destID string, instanceID int64, dataID int64,
+	metaData *common.MetaData) common.SyncServiceError {
+	window := common.Configuration.AckBatchWindow
+	if window <= 0 || messageVersionForDestination(metaData.DestOrgID, destType, destID).Less(common.AckBatchVersion) {
+		return Comm.SendNotificationMessage(command, destType, destID, instanceID, dataID, metaData)
+	}
+
+	ack := common.AckEntry{Command: command, ObjectType: metaData.ObjectType, ObjectID: metaData.ObjectID,
+		OriginType: metaData.OriginType, OriginID: metaData.OriginID, InstanceID: instanceID, DataID: dataID}
+	key := metaData.DestOrgID + ":" + destType + ":" + destID
+
+	ackBatchesLock.Lock()
+	batch, ok := ackBatches[key]
+	if !ok {
+		batch = &ackBatch{orgID: metaData.DestOrgID, destType: destType, destID: destID}
+		ackBatches[key] = batch
+		batch.timer = time.AfterFunc(time.Millisecond*time.Duration(window), func() { flushAckBatch(key, batch) })
+	}
+	batch.acks = append(batch.acks, ack)
+	if len(batch.acks) < common.Configuration.AckBatchMaxSize {
+		ackBatchesLock.Unlock()
+		return nil
+	}
+	// The batch is full
+	delete(ackBatches, key)
+	batch.timer.Stop()
+	ackBatchesLock.Unlock()
+
+	return Comm.SendAckBatch(batch.orgID, batch.destType, batch.destID, batch.acks)
+}
+
+// flushAckBatch sends the batch of acks when its window expires, unless it was already sent because it was full
+func flushAckBatch(key string, batch *ackBatch) {
+	ackBatchesLock.Lock()
+	if ackBatches[key] != batch {
+		ackBatchesLock.Unlock()
+		return
+	}
+	delete(ackBatches, key)
+	ackBatchesLock.Unlock()
+
+	if err := Comm.SendAckBatch(batch.orgID, batch.destType, batch.destID, batch.acks); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to send a batch of %d acks to %s. Error: %s\n", len(batch.acks), key, err)
+	}
+}
@@ -0,0 +1,112 @@
+package communications
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+type ackRecordingComm struct {
+	TestComm
+	lock    sync.Mutex
+	acks    []string
+	batches [][]common.AckEntry
+}
+
+func (communication *ackRecordingComm) SendNotificationMessage(notificationTopic string, destType string,
+	destID string, instanceID int64, dataID int64, metaData *common.MetaData) common.SyncServiceError {
+	communication.lock.Lock()
+	defer communication.lock.Unlock()
+	communication.acks = append(communication.acks, metaData.ObjectID)
+	return nil
+}
+
+func (communication *ackRecordingComm) SendAckBatch(orgID string, destType string, destID string,
+	acks []common.AckEntry) common.SyncServiceError {
+	communication.lock.Lock()
+	defer communication.lock.Unlock()
+	communication.batches = append(communication.batches, acks)
+	return nil
+}
+
+func (communication *ackRecordingComm) sent() (int, [][]common.AckEntry) {
+	communication.lock.Lock()
+	defer communication.lock.Unlock()
+	return len(communication.acks), communication.batches
+}
+
+func TestAckBatching(t *testing.T) {
+	nodeType := common.Configuration.NodeType
+	ackBatchWindow := common.Configuration.AckBatchWindow
+	ackBatchMaxSize := common.Configuration.AckBatchMaxSize
+	defer func() {
+		common.Configuration.NodeType = nodeType
+		common.Configuration.AckBatchWindow = ackBatchWindow
+		common.Configuration.AckBatchMaxSize = ackBatchMaxSize
+		setCSSMessageVersion(common.MinMessageVersion)
+	}()
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.AckBatchMaxSize = 3
+
+	tests := []struct {
+		window         int
+		cssVersion     common.SyncServiceVersion
+		acks           int
+		immediate      int
+		batchSizes     []int
+		beforeFlushing int
+	}{
+		// Batching is disabled
+		{0, common.Version, 5, 5, nil, 0},
+		// The CSS doesn't support batched acks
+		{50, common.MinMessageVersion, 5, 5, nil, 0},
+		// Full batches are sent right away, the remaining acks when the window expires
+		{50, common.Version, 7, 0, []int{3, 3, 1}, 2},
+		{50, common.Version, 2, 0, []int{2}, 0},
+	}
+
+	for i, test := range tests {
+		comm := &ackRecordingComm{}
+		Comm = comm
+		common.Configuration.AckBatchWindow = test.window
+		setCSSMessageVersion(test.cssVersion)
+
+		for j := 0; j < test.acks; j++ {
+			metaData := &common.MetaData{DestOrgID: "myorg", ObjectType: "type1", ObjectID: "object" + strconv.Itoa(j),
+				OriginType: common.Configuration.DestinationType, OriginID: common.Configuration.DestinationID, InstanceID: int64(j + 1)}
+			if err := sendAck(common.AckReceived, "cloud", "cloud", metaData.InstanceID, 0, metaData); err != nil {
+				t.Errorf("Test %d: sendAck failed. Error: %s", i, err.Error())
+			}
+		}
+
+		immediate, batches := comm.sent()
+		if len(batches) != test.beforeFlushing {
+			t.Errorf("Test %d: %d batches were sent before the window expired, instead of %d", i, len(batches), test.beforeFlushing)
+		}
+		time.Sleep(time.Millisecond * time.Duration(test.window*4))
+		immediate, batches = comm.sent()
+		if immediate != test.immediate {
+			t.Errorf("Test %d: %d acks were sent immediately, instead of %d", i, immediate, test.immediate)
+		}
+		if len(batches) != len(test.batchSizes) {
+			t.Errorf("Test %d: %d batches were sent, instead of %d", i, len(batches), len(test.batchSizes))
+			continue
+		}
+		objectIndex := 0
+		for j, batch := range batches {
+			if len(batch) != test.batchSizes[j] {
+				t.Errorf("Test %d: batch %d has %d acks, instead of %d", i, j, len(batch), test.batchSizes[j])
+			}
+			for _, ack := range batch {
+				if ack.Command != common.AckReceived || ack.ObjectID != "object"+strconv.Itoa(objectIndex) ||
+					ack.InstanceID != int64(objectIndex+1) {
+					t.Errorf("Test %d: batch %d has an unexpected ack %s of %s (instance %d)", i, j, ack.Command, ack.ObjectID, ack.InstanceID)
+				}
+				objectIndex++
+			}
+		}
+	}
+}
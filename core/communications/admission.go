@@ -0,0 +1,51 @@
+package communications
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// An AdmissionPolicy decides whether an object received from the other side is admitted, for example by its size,
+// type, labels (e.g., its description or destination policy), or its organization's limits. It is called with the
+// object's meta data before anything is stored or allocated for the object, so it must be fast.
+// If it returns an error, the object is rejected, and the error's message is sent to the object's sender as the reason.
+// The sender marks the object's notification and delivery status for the receiver as rejected.
+type AdmissionPolicy func(metaData common.MetaData) error
+
+var admissionPolicy AdmissionPolicy
+var admissionPolicyLock sync.RWMutex
+
+// RegisterAdmissionPolicy registers the admission policy of the objects received from the other side, replacing the
+// current policy. A nil policy removes the current policy, and all the objects are admitted.
+func RegisterAdmissionPolicy(policy AdmissionPolicy) {
+	admissionPolicyLock.Lock()
+	admissionPolicy = policy
+	admissionPolicyLock.Unlock()
+}
+
+// admitObject applies the admission policy to the object received from the other side. If the object is rejected,
+// its sender is notified with the reason, and an error is returned.
+func admitObject(metaData common.MetaData) common.SyncServiceError {
+	admissionPolicyLock.RLock()
+	policy := admissionPolicy
+	admissionPolicyLock.RUnlock()
+	if policy == nil {
+		return nil
+	}
+
+	rejection := policy(metaData)
+	if rejection == nil {
+		return nil
+	}
+	reason := rejection.Error()
+	if err := Comm.SendFeedbackMessage(common.AdmissionRejectedCode, 0, reason, &metaData, true); err != nil &&
+		log.IsLogging(logger.ERROR) {
+		log.Error("Error in handleUpdate: failed to send feedback. Error: %s\n", err)
+	}
+	return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: the admission policy rejected %s %s. %s\n",
+		metaData.ObjectType, metaData.ObjectID, reason), category: ErrInvalidData}
+}
@@ -0,0 +1,94 @@
+package communications
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestAdmissionPolicy(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	defer RegisterAdmissionPolicy(nil)
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	RegisterAdmissionPolicy(func(metaData common.MetaData) error {
+		if metaData.ObjectType == "forbidden" {
+			return errors.New("objects of type forbidden aren't admitted")
+		}
+		return nil
+	})
+
+	rejected := common.MetaData{ObjectID: "rejected", ObjectType: "forbidden", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 1024, ChunkSize: 1024, InstanceID: 10, DataID: 10}
+	if err := handleUpdate(rejected, 10); err == nil || !IsInvalidData(err) {
+		t.Errorf("handleUpdate didn't reject an object that the admission policy rejected")
+	}
+	if storedMetaData, err := Store.RetrieveObject(rejected.DestOrgID, rejected.ObjectType, rejected.ObjectID); err != nil || storedMetaData != nil {
+		t.Errorf("The rejected object was stored")
+	}
+
+	admitted := rejected
+	admitted.ObjectID = "admitted"
+	admitted.ObjectType = "type1"
+	if err := handleUpdate(admitted, 10); err != nil {
+		t.Errorf("handleUpdate failed. Error: %s", err.Error())
+	}
+	if storedMetaData, err := Store.RetrieveObject(admitted.DestOrgID, admitted.ObjectType, admitted.ObjectID); err != nil || storedMetaData == nil {
+		t.Errorf("The admitted object wasn't stored")
+	}
+
+	// All the objects are admitted without a policy
+	RegisterAdmissionPolicy(nil)
+	rejected.InstanceID++
+	if err := handleUpdate(rejected, 10); err != nil {
+		t.Errorf("handleUpdate failed without an admission policy. Error: %s", err.Error())
+	}
+}
+
+func TestAdmissionRejectedFeedback(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.CSS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+	Comm = &TestComm{}
+
+	notification := common.Notification{ObjectID: "rejected", ObjectType: "forbidden", DestOrgID: "someorg", DestType: "device",
+		DestID: "dev1", Status: common.Update, InstanceID: 10}
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+		return
+	}
+
+	// The rejected object isn't sent again, even if the feedback asks for a retry
+	if err := handleFeedback(notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType,
+		notification.DestID, notification.InstanceID, 0, common.AdmissionRejectedCode, 60, "rejected by policy"); err != nil {
+		t.Errorf("handleFeedback failed. Error: %s", err.Error())
+	}
+	stored, err := Store.RetrieveNotificationRecord(notification.DestOrgID, notification.ObjectType, notification.ObjectID,
+		notification.DestType, notification.DestID)
+	if err != nil || stored == nil {
+		t.Errorf("Failed to retrieve the notification record. Error: %v", err)
+	} else if stored.Status != common.Rejected || stored.ResendTime != 0 {
+		t.Errorf("The status of the notification of a rejected object is %s (resend time %d)", stored.Status, stored.ResendTime)
+	}
+}
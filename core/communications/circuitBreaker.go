@@ -0,0 +1,151 @@
+package communications
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// When CircuitBreakerThreshold is set, the sends to each destination go through the destination's circuit breaker.
+// The circuit breaker opens after CircuitBreakerThreshold consecutive transport failures, and while it is open the
+// sends fail immediately with a circuit open error instead of waiting for the transport to fail. After
+// CircuitBreakerCooldown seconds the circuit breaker is half-open: one send is let through to probe the destination,
+// and the circuit breaker closes if the probe succeeds, or opens again if it fails.
+// A circuit breaker is created on the first failure to send to its destination.
+
+type circuitBreaker struct {
+	orgID    string
+	destType string
+	destID   string
+	state    string
+	failures uint32
+	openTime time.Time
+	trips    uint64
+	rejected uint64
+}
+
+// The circuit breakers, by their destinations
+var circuitBreakers = make(map[string]*circuitBreaker)
+var circuitBreakersLock sync.Mutex
+
+// circuitOpenError is returned for a send that was short-circuited because the destination's circuit breaker is open
+type circuitOpenError struct {
+	message string
+}
+
+func (e *circuitOpenError) Error() string {
+	return e.message
+}
+
+// Unwrap returns ErrCircuitOpen, the category of short-circuited sends
+func (e *circuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// sendThroughCircuitBreaker calls send, unless the destination's circuit breaker is open, and records whether it
+// failed to reach the destination
+func sendThroughCircuitBreaker(orgID string, destType string, destID string, send func() common.SyncServiceError) common.SyncServiceError {
+	if common.Configuration.CircuitBreakerThreshold <= 0 || destType == "" {
+		return send()
+	}
+
+	key := orgID + ":" + destType + ":" + destID
+	if !allowSend(key) {
+		return &circuitOpenError{fmt.Sprintf("The circuit breaker of %s is open, the send was short-circuited", key)}
+	}
+	err := send()
+	recordSendResult(key, orgID, destType, destID, err)
+	return err
+}
+
+// allowSend returns false if the destination's circuit breaker is open, or half-open with a probe in flight.
+// A circuit breaker whose cooldown has expired becomes half-open, and the send is the probe.
+func allowSend(key string) bool {
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+
+	breaker, ok := circuitBreakers[key]
+	if !ok {
+		return true
+	}
+	switch breaker.state {
+	case common.CircuitOpen:
+		if time.Since(breaker.openTime) >= time.Duration(common.Configuration.CircuitBreakerCooldown)*time.Second {
+			breaker.state = common.CircuitHalfOpen
+			return true
+		}
+	case common.CircuitHalfOpen:
+	default:
+		return true
+	}
+	breaker.rejected++
+	return false
+}
+
+// recordSendResult updates the destination's circuit breaker with the result of a send.
+// Only transport failures count, any other error means that the destination was reached.
+func recordSendResult(key string, orgID string, destType string, destID string, err common.SyncServiceError) {
+	failed := err != nil && errorCategory(err) == ErrTransportFailure
+
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+
+	breaker, ok := circuitBreakers[key]
+	if !failed {
+		if ok && breaker.state != common.CircuitClosed {
+			if log.IsLogging(logger.INFO) {
+				log.Info("The circuit breaker of %s closed\n", key)
+			}
+			breaker.state = common.CircuitClosed
+		}
+		if ok {
+			breaker.failures = 0
+		}
+		return
+	}
+
+	if !ok {
+		breaker = &circuitBreaker{orgID: orgID, destType: destType, destID: destID, state: common.CircuitClosed}
+		circuitBreakers[key] = breaker
+	}
+	breaker.failures++
+	if breaker.state == common.CircuitHalfOpen ||
+		(breaker.state == common.CircuitClosed && breaker.failures >= uint32(common.Configuration.CircuitBreakerThreshold)) {
+		if breaker.state == common.CircuitClosed {
+			breaker.trips++
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("The circuit breaker of %s opened after %d consecutive failures\n", key, breaker.failures)
+			}
+		}
+		breaker.state = common.CircuitOpen
+		breaker.openTime = time.Now()
+	}
+}
+
+// GetCircuitBreakersStatistics returns the statistics of the circuit breakers of the destinations, sorted by destination
+func GetCircuitBreakersStatistics() []common.CircuitBreakerStatistics {
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+
+	statistics := make([]common.CircuitBreakerStatistics, 0, len(circuitBreakers))
+	for _, breaker := range circuitBreakers {
+		statistics = append(statistics, common.CircuitBreakerStatistics{OrgID: breaker.orgID, DestType: breaker.destType,
+			DestID: breaker.destID, State: breaker.state, ConsecutiveFailures: breaker.failures, Trips: breaker.trips,
+			Rejected: breaker.rejected})
+	}
+	sort.Slice(statistics, func(i, j int) bool {
+		if statistics[i].OrgID != statistics[j].OrgID {
+			return statistics[i].OrgID < statistics[j].OrgID
+		}
+		if statistics[i].DestType != statistics[j].DestType {
+			return statistics[i].DestType < statistics[j].DestType
+		}
+		return statistics[i].DestID < statistics[j].DestID
+	})
+	return statistics
+}
@@ -0,0 +1,104 @@
+package communications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	threshold := common.Configuration.CircuitBreakerThreshold
+	cooldown := common.Configuration.CircuitBreakerCooldown
+	defer func() {
+		common.Configuration.CircuitBreakerThreshold = threshold
+		common.Configuration.CircuitBreakerCooldown = cooldown
+		circuitBreakersLock.Lock()
+		circuitBreakers = make(map[string]*circuitBreaker)
+		circuitBreakersLock.Unlock()
+	}()
+	common.Configuration.CircuitBreakerThreshold = 3
+	common.Configuration.CircuitBreakerCooldown = 30
+
+	var sendErr common.SyncServiceError
+	sends := 0
+	send := func() common.SyncServiceError {
+		sends++
+		return sendErr
+	}
+	statistics := func() common.CircuitBreakerStatistics {
+		for _, breaker := range GetCircuitBreakersStatistics() {
+			if breaker.OrgID == "myorg" && breaker.DestType == "device" && breaker.DestID == "dev1" {
+				return breaker
+			}
+		}
+		return common.CircuitBreakerStatistics{State: common.CircuitClosed}
+	}
+	expireCooldown := func() {
+		circuitBreakersLock.Lock()
+		circuitBreakers["myorg:device:dev1"].openTime = time.Now().Add(-time.Minute)
+		circuitBreakersLock.Unlock()
+	}
+
+	tests := []struct {
+		sendErr  common.SyncServiceError
+		expire   bool
+		sent     bool
+		state    string
+		failures uint32
+		trips    uint64
+		rejected uint64
+	}{
+		{&Error{"Failed to send"}, false, true, common.CircuitClosed, 1, 0, 0},
+		// Errors of the other side aren't transport failures
+		{&common.NotFound{}, false, true, common.CircuitClosed, 0, 0, 0},
+		{&Error{"Failed to send"}, false, true, common.CircuitClosed, 1, 0, 0},
+		{&Error{"Failed to send"}, false, true, common.CircuitClosed, 2, 0, 0},
+		{&Error{"Failed to send"}, false, true, common.CircuitOpen, 3, 1, 0},
+		// Sends are short-circuited while the circuit breaker is open
+		{nil, false, false, common.CircuitOpen, 3, 1, 1},
+		{nil, false, false, common.CircuitOpen, 3, 1, 2},
+		// The probe fails
+		{&Error{"Failed to send"}, true, true, common.CircuitOpen, 4, 1, 2},
+		{nil, false, false, common.CircuitOpen, 4, 1, 3},
+		// The probe succeeds
+		{nil, true, true, common.CircuitClosed, 0, 1, 3},
+		{nil, false, true, common.CircuitClosed, 0, 1, 3},
+	}
+
+	for i, test := range tests {
+		if test.expire {
+			expireCooldown()
+		}
+		sendErr = test.sendErr
+		sendsBefore := sends
+		err := sendThroughCircuitBreaker("myorg", "device", "dev1", send)
+		if sent := sends > sendsBefore; sent != test.sent {
+			t.Errorf("Test %d: sent is %t instead of %t", i, sent, test.sent)
+		}
+		if test.sent && err != test.sendErr {
+			t.Errorf("Test %d: the error of the send wasn't returned", i)
+		}
+		if !test.sent && (!IsCircuitOpen(err) || !IsTransportFailure(err)) {
+			t.Errorf("Test %d: a short-circuited send didn't return a circuit open error. Error: %v", i, err)
+		}
+		breaker := statistics()
+		if breaker.State != test.state || breaker.ConsecutiveFailures != test.failures || breaker.Trips != test.trips ||
+			breaker.Rejected != test.rejected {
+			t.Errorf("Test %d: the circuit breaker is %s with %d failures, %d trips and %d rejected sends, instead of %s with %d failures, %d trips and %d rejected sends",
+				i, breaker.State, breaker.ConsecutiveFailures, breaker.Trips, breaker.Rejected, test.state, test.failures,
+				test.trips, test.rejected)
+		}
+	}
+
+	// The circuit breakers are per destination
+	if err := sendThroughCircuitBreaker("myorg", "device", "dev2", send); err != nil {
+		t.Errorf("The send to another destination failed. Error: %s", err)
+	}
+
+	// A handler's error keeps the circuit open category
+	err := &notificationHandlerError{message: "Failed", category: sendFailureCategory(&circuitOpenError{"open"})}
+	if !IsCircuitOpen(err) {
+		t.Errorf("The handler's error isn't a circuit open error")
+	}
+}
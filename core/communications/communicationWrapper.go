@@ -37,6 +37,21 @@ func (communication *Wrapper) StopCommunication() common.SyncServiceError {
 	return err2
 }
 
+// ReloadTLS reloads the TLS certificates and keys from disk, and applies them to the connections established afterward
+func (communication *Wrapper) ReloadTLS() common.SyncServiceError {
+	var err1, err2 error
+	if communication.httpComm != nil {
+		err1 = communication.httpComm.ReloadTLS()
+	}
+	if communication.mqttComm != nil {
+		err2 = communication.mqttComm.ReloadTLS()
+	}
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
 func (communication *Wrapper) selectCommunicator(protocol string, orgID string, destType string, destID string) (Communicator, common.SyncServiceError) {
 	var comm Communicator
 	var err common.SyncServiceError
@@ -73,7 +88,9 @@ func (communication *Wrapper) SendNotificationMessage(notificationTopic string,
 	if err != nil {
 		return err
 	}
-	return comm.SendNotificationMessage(notificationTopic, destType, destID, instanceID, dataID, metaData)
+	return sendThroughCircuitBreaker(metaData.DestOrgID, destType, destID, func() common.SyncServiceError {
+		return comm.SendNotificationMessage(notificationTopic, destType, destID, instanceID, dataID, metaData)
+	})
 }
 
 // SendFeedbackMessage sends a feedback message from the ESS to the CSS or from the CSS to the ESS
@@ -94,6 +111,17 @@ func (communication *Wrapper) SendErrorMessage(err common.SyncServiceError, meta
 	return comm.SendErrorMessage(err, metaData, sendToOrigin)
 }
 
+// SendPartiallyConsumed notifies the object's origin that the data of the object was consumed up to offset
+func (communication *Wrapper) SendPartiallyConsumed(metaData *common.MetaData, offset int64) common.SyncServiceError {
+	comm, err := communication.selectCommunicator("", metaData.DestOrgID, metaData.OriginType, metaData.OriginID)
+	if err != nil {
+		return err
+	}
+	return sendThroughCircuitBreaker(metaData.DestOrgID, metaData.OriginType, metaData.OriginID, func() common.SyncServiceError {
+		return comm.SendPartiallyConsumed(metaData, offset)
+	})
+}
+
 // Register sends a registration message to be sent by an ESS
 func (communication *Wrapper) Register() common.SyncServiceError {
 	comm, err := communication.selectCommunicator(common.Configuration.CommunicationProtocol, "", "", "")
@@ -112,6 +140,15 @@ func (communication *Wrapper) RegisterAck(destination common.Destination) common
 	return comm.RegisterAck(destination)
 }
 
+// RegisterDenied sends a message from the CSS to an ESS that its registration was denied, with the reason
+func (communication *Wrapper) RegisterDenied(destination common.Destination, reason string) common.SyncServiceError {
+	comm, err := communication.selectCommunicator(destination.Communication, "", "", "")
+	if err != nil {
+		return err
+	}
+	return comm.RegisterDenied(destination, reason)
+}
+
 // RegisterAsNew send a notification from a CSS to a ESS that the ESS has to send a registerNew message in order
 // to register
 func (communication *Wrapper) RegisterAsNew(destination common.Destination) common.SyncServiceError {
@@ -162,22 +199,47 @@ func (communication *Wrapper) SendPing() common.SyncServiceError {
 	return comm.SendPing()
 }
 
+// SendHeartbeat sends a heartbeat message from ESS to CSS
+func (communication *Wrapper) SendHeartbeat() common.SyncServiceError {
+	comm, err := communication.selectCommunicator(common.Configuration.CommunicationProtocol, "", "", "")
+	if err != nil {
+		return err
+	}
+	return comm.SendHeartbeat()
+}
+
 // GetData requests data to be sent from the CSS to the ESS or from the ESS to the CSS
 func (communication *Wrapper) GetData(metaData common.MetaData, offset int64) common.SyncServiceError {
 	comm, err := communication.selectCommunicator("", metaData.DestOrgID, metaData.OriginType, metaData.OriginID)
 	if err != nil {
 		return err
 	}
-	return comm.GetData(metaData, offset)
+	return sendThroughCircuitBreaker(metaData.DestOrgID, metaData.OriginType, metaData.OriginID, func() common.SyncServiceError {
+		return comm.GetData(metaData, offset)
+	})
+}
+
+// GetDataRange requests count consecutive chunks, starting at offset, to be sent from the CSS to the ESS or from the ESS to the CSS
+func (communication *Wrapper) GetDataRange(metaData common.MetaData, offset int64, count int) common.SyncServiceError {
+	comm, err := communication.selectCommunicator("", metaData.DestOrgID, metaData.OriginType, metaData.OriginID)
+	if err != nil {
+		return err
+	}
+	return sendThroughCircuitBreaker(metaData.DestOrgID, metaData.OriginType, metaData.OriginID, func() common.SyncServiceError {
+		return comm.GetDataRange(metaData, offset, count)
+	})
 }
 
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
-func (communication *Wrapper) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
-	comm, err := communication.selectCommunicator("", orgID, destType, destID)
+func (communication *Wrapper) SendData(metaData *common.MetaData, destType string, destID string, message []byte, chunked bool,
+	done func()) common.SyncServiceError {
+	comm, err := communication.selectCommunicator("", metaData.DestOrgID, destType, destID)
 	if err != nil {
 		return err
 	}
-	return comm.SendData(orgID, destType, destID, message, chunked)
+	return sendThroughCircuitBreaker(metaData.DestOrgID, destType, destID, func() common.SyncServiceError {
+		return comm.SendData(metaData, destType, destID, message, chunked, done)
+	})
 }
 
 // ResendObjects requests to resend all the relevant objects
@@ -199,6 +261,26 @@ func (communication *Wrapper) SendAckResendObjects(destination common.Destinatio
 	return comm.SendAckResendObjects(destination)
 }
 
+// SendVerifyRequest sends the manifest of the objects of the ESS to the CSS, to verify them
+func (communication *Wrapper) SendVerifyRequest(manifest []common.ManifestEntry, resend bool) common.SyncServiceError {
+	comm, err := communication.selectCommunicator("", "", "", "")
+	if err != nil {
+		return err
+	}
+	return comm.SendVerifyRequest(manifest, resend)
+}
+
+// SendAckBatch sends a batch of acks of received and consumed notifications to the destination
+func (communication *Wrapper) SendAckBatch(orgID string, destType string, destID string, acks []common.AckEntry) common.SyncServiceError {
+	comm, err := communication.selectCommunicator("", orgID, destType, destID)
+	if err != nil {
+		return err
+	}
+	return sendThroughCircuitBreaker(orgID, destType, destID, func() common.SyncServiceError {
+		return comm.SendAckBatch(orgID, destType, destID, acks)
+	})
+}
+
 // UpdateOrganization adds or updates an organization
 func (communication *Wrapper) UpdateOrganization(org common.Organization, timestamp time.Time) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS || common.Configuration.CommunicationProtocol == common.HTTPProtocol {
@@ -19,6 +19,9 @@ type Communicator interface {
 	// StopCommunication stops communications
 	StopCommunication() common.SyncServiceError
 
+	// ReloadTLS reloads the TLS certificates and keys from disk, and applies them to the connections established afterward
+	ReloadTLS() common.SyncServiceError
+
 	// SendNotificationMessage sends a notification message from the CSS to the ESS or from the ESS to the CSS
 	SendNotificationMessage(notificationTopic string, destType string, destID string, instanceID int64, dataID int64, metaData *common.MetaData) common.SyncServiceError
 
@@ -28,6 +31,9 @@ type Communicator interface {
 	// SendErrorMessage sends an error message from the ESS to the CSS or from the CSS to the ESS
 	SendErrorMessage(err common.SyncServiceError, metaData *common.MetaData, sendToOrigin bool) common.SyncServiceError
 
+	// SendPartiallyConsumed notifies the object's origin that the data of the object was consumed up to offset
+	SendPartiallyConsumed(metaData *common.MetaData, offset int64) common.SyncServiceError
+
 	// Register sends a registration message to be sent by an ESS
 	Register() common.SyncServiceError
 
@@ -37,6 +43,9 @@ type Communicator interface {
 	// HandleRegAck handles a registration acknowledgement message from the CSS
 	HandleRegAck()
 
+	// RegisterDenied sends a message from the CSS to an ESS that its registration was denied, with the reason
+	RegisterDenied(destination common.Destination, reason string) common.SyncServiceError
+
 	// RegisterAsNew send a notification from a CSS to a ESS that the ESS has to send a registerNew message in order
 	// to register
 	RegisterAsNew(destination common.Destination) common.SyncServiceError
@@ -50,11 +59,19 @@ type Communicator interface {
 	// SendPing sends a ping message from ESS to CSS
 	SendPing() common.SyncServiceError
 
+	// SendHeartbeat sends a heartbeat message from ESS to CSS
+	SendHeartbeat() common.SyncServiceError
+
 	// GetData requests data to be sent from the CSS to the ESS or from the ESS to the CSS
 	GetData(metaData common.MetaData, offset int64) common.SyncServiceError
 
-	// SendData sends data from the CSS to the ESS or from the ESS to the CSS
-	SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError
+	// GetDataRange requests count consecutive chunks, starting at offset, to be sent from the CSS to the ESS or from the ESS to the CSS
+	GetDataRange(metaData common.MetaData, offset int64, count int) common.SyncServiceError
+
+	// SendData sends data from the CSS to the ESS or from the ESS to the CSS.
+	// If done is not nil, it is called when the communicator no longer uses the message, and its buffer can be reused.
+	// A communicator that doesn't call done only prevents the buffer from being reused.
+	SendData(metaData *common.MetaData, destType string, destID string, message []byte, chunked bool, done func()) common.SyncServiceError
 
 	// ResendObjects requests to resend all the relevant objects
 	ResendObjects() common.SyncServiceError
@@ -62,6 +79,12 @@ type Communicator interface {
 	// SendAckResendObjects sends ack to resend objects request
 	SendAckResendObjects(destination common.Destination) common.SyncServiceError
 
+	// SendVerifyRequest sends the manifest of the objects of the ESS to the CSS, to verify them
+	SendVerifyRequest(manifest []common.ManifestEntry, resend bool) common.SyncServiceError
+
+	// SendAckBatch sends a batch of acks of received and consumed notifications to the destination
+	SendAckBatch(orgID string, destType string, destID string, acks []common.AckEntry) common.SyncServiceError
+
 	// UpdateOrganization adds or updates an organization
 	UpdateOrganization(org common.Organization, timestamp time.Time) common.SyncServiceError
 
@@ -84,6 +107,11 @@ func (e *Error) Error() string {
 	return e.message
 }
 
+// Unwrap returns ErrTransportFailure, the category of communication errors
+func (e *Error) Unwrap() error {
+	return ErrTransportFailure
+}
+
 // ignoredByHandler error is returned if a notification is ignored by the notification handler
 type ignoredByHandler struct {
 	message string
@@ -118,9 +146,19 @@ func SendErrorResponse(writer http.ResponseWriter, err error, message string, st
 			statusCode = http.StatusInternalServerError
 		case *storage.NotConnected:
 			statusCode = http.StatusServiceUnavailable
+		case *common.NotLeader:
+			statusCode = http.StatusMisdirectedRequest
+			if address := err.(*common.NotLeader).LeaderAddress; address != "" {
+				writer.Header().Set("X-Sync-Service-Leader", address)
+			}
 		case *ignoredByHandler:
 			statusCode = http.StatusConflict
-		case *Error:
+		case *notificationHandlerError:
+			statusCode = http.StatusInternalServerError
+			if IsUnauthorized(err) {
+				statusCode = http.StatusForbidden
+			}
+		case *Error, *circuitOpenError:
 			// Don't return an error if it's a communication error
 			statusCode = http.StatusNoContent
 			message = ""
@@ -0,0 +1,216 @@
+package communications
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// The data of data messages is compressed with the algorithm set in CompressionAlgorithm, if the other side supports it.
+// Each side reports the algorithms that it supports when registering (the ESS) or acking the registration (the CSS), and
+// the sender falls back to the most preferred algorithm that both sides support. The algorithm is written in the
+// compression field of the data message, which is only sent to peers that reported that they support compression.
+
+// A Compressor compresses and decompresses the data of data messages with a compression algorithm
+type Compressor interface {
+	// Compress returns the compressed data, level 0 is the default level of the algorithm
+	Compress(data []byte, level int) ([]byte, error)
+
+	// Decompress returns the decompressed data, and fails if it is larger than maxSize bytes
+	Decompress(data []byte, maxSize int64) ([]byte, error)
+}
+
+// compressionIDs are the values of the compression field of data messages
+var compressionIDs = map[string]uint32{common.CompressionGzip: 1, common.CompressionZstd: 2}
+
+var compressors = map[string]Compressor{common.CompressionGzip: gzipCompressor{}}
+var compressorsLock sync.RWMutex
+
+// RegisterCompressor registers the compressor of a compression algorithm (gzip or zstd), replacing its current compressor.
+// gzip is supported by default, zstd is supported once its compressor is registered (e.g., one based on
+// github.com/klauspost/compress/zstd). A nil compressor removes the current compressor.
+// The compressors must be registered before the sync service is started, as they are reported to the other side
+// when registering.
+func RegisterCompressor(algorithm string, compressor Compressor) common.SyncServiceError {
+	if _, ok := compressionIDs[algorithm]; !ok {
+		return &Error{fmt.Sprintf("Unsupported compression algorithm %s", algorithm)}
+	}
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	if compressor == nil {
+		delete(compressors, algorithm)
+	} else {
+		compressors[algorithm] = compressor
+	}
+	return nil
+}
+
+func getCompressor(algorithm string) Compressor {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	return compressors[algorithm]
+}
+
+func compressionAlgorithm(id uint32) string {
+	for algorithm, algorithmID := range compressionIDs {
+		if algorithmID == id {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// supportedCompressionAlgorithms returns the comma separated list of the compression algorithms that have a compressor,
+// from the most to the least preferred
+func supportedCompressionAlgorithms() string {
+	supported := make([]string, 0)
+	for i := len(common.CompressionAlgorithms) - 1; i >= 0; i-- {
+		if algorithm := common.CompressionAlgorithms[i]; getCompressor(algorithm) != nil {
+			supported = append(supported, algorithm)
+		}
+	}
+	return strings.Join(supported, ",")
+}
+
+// negotiateCompression returns the compression algorithm to use with a peer that supports the algorithms in the comma
+// separated list: CompressionAlgorithm if the peer supports it, otherwise the most preferred algorithm that both sides
+// support and that isn't preferred over CompressionAlgorithm
+func negotiateCompression(peerAlgorithms string) string {
+	if peerAlgorithms == "" {
+		return common.CompressionNone
+	}
+	peerSupports := make(map[string]bool)
+	for _, algorithm := range strings.Split(peerAlgorithms, ",") {
+		peerSupports[strings.TrimSpace(algorithm)] = true
+	}
+
+	configured := false
+	for i := len(common.CompressionAlgorithms) - 1; i > 0; i-- {
+		algorithm := common.CompressionAlgorithms[i]
+		if algorithm == common.Configuration.CompressionAlgorithm {
+			configured = true
+		}
+		if configured && peerSupports[algorithm] && getCompressor(algorithm) != nil {
+			return algorithm
+		}
+	}
+	return common.CompressionNone
+}
+
+// ESS: the compression algorithms that the CSS that acknowledged the registration supports
+var cssCompressionAlgorithms string
+var cssCompressionAlgorithmsLock sync.RWMutex
+
+// ESS: keep the compression algorithms reported by the CSS that acknowledged the registration
+func setCSSCompressionAlgorithms(algorithms string) {
+	cssCompressionAlgorithmsLock.Lock()
+	cssCompressionAlgorithms = algorithms
+	cssCompressionAlgorithmsLock.Unlock()
+}
+
+// compressionForDestination returns the compression algorithm of the data messages sent to the destination
+func compressionForDestination(orgID string, destType string, destID string) string {
+	if common.Configuration.CompressionAlgorithm == common.CompressionNone || common.Configuration.CompressionAlgorithm == "" {
+		return common.CompressionNone
+	}
+	if common.Configuration.NodeType == common.ESS {
+		cssCompressionAlgorithmsLock.RLock()
+		defer cssCompressionAlgorithmsLock.RUnlock()
+		return negotiateCompression(cssCompressionAlgorithms)
+	}
+
+	dest, err := Store.RetrieveDestination(orgID, destType, destID)
+	if err != nil || dest == nil {
+		return common.CompressionNone
+	}
+	return negotiateCompression(dest.CompressionAlgorithms)
+}
+
+// compressData returns the data compressed with the algorithm, and false if the data isn't compressed
+// (no compression, the compression failed, or the data didn't get smaller)
+func compressData(data []byte, algorithm string) ([]byte, bool) {
+	if algorithm == common.CompressionNone || len(data) == 0 {
+		return nil, false
+	}
+	compressor := getCompressor(algorithm)
+	if compressor == nil {
+		return nil, false
+	}
+	// CompressionLevel is the level of the configured algorithm, the algorithms negotiated instead of it use their default level
+	level := 0
+	if algorithm == common.Configuration.CompressionAlgorithm {
+		level = common.Configuration.CompressionLevel
+	}
+	compressed, err := compressor.Compress(data, level)
+	if err != nil {
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to compress data with %s, sending it uncompressed. Error: %s\n", algorithm, err)
+		}
+		return nil, false
+	}
+	if len(compressed) >= len(data) {
+		return nil, false
+	}
+	return compressed, true
+}
+
+// decompressData returns the data of a data message decompressed with the algorithm of the compression field.
+// It fails if the decompressed data is larger than maxSize bytes.
+func decompressData(data []byte, id uint32, maxSize int64) ([]byte, error) {
+	algorithm := compressionAlgorithm(id)
+	if algorithm == "" {
+		return nil, fmt.Errorf("unknown compression algorithm %d", id)
+	}
+	compressor := getCompressor(algorithm)
+	if compressor == nil {
+		return nil, fmt.Errorf("unsupported compression algorithm %s", algorithm)
+	}
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	return compressor.Decompress(data, maxSize)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte, level int) ([]byte, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var compressed bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&compressed, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, maxSize int64) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > maxSize {
+		return nil, fmt.Errorf("the decompressed data is larger than %d bytes", maxSize)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,142 @@
+package communications
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestNegotiateCompression(t *testing.T) {
+	algorithm := common.Configuration.CompressionAlgorithm
+	defer func() {
+		common.Configuration.CompressionAlgorithm = algorithm
+		RegisterCompressor(common.CompressionZstd, nil)
+	}()
+
+	if err := RegisterCompressor("lz4", gzipCompressor{}); err == nil {
+		t.Errorf("A compressor of an unsupported algorithm was registered")
+	}
+	if supported := supportedCompressionAlgorithms(); supported != common.CompressionGzip {
+		t.Errorf("Wrong supported algorithms without a zstd compressor: %s", supported)
+	}
+
+	tests := []struct {
+		configured     string
+		peerAlgorithms string
+		zstd           bool
+		expected       string
+	}{
+		{common.CompressionZstd, "zstd,gzip", true, common.CompressionZstd},
+		{common.CompressionZstd, "gzip", true, common.CompressionGzip},
+		{common.CompressionZstd, "zstd,gzip", false, common.CompressionGzip},
+		{common.CompressionGzip, "zstd,gzip", true, common.CompressionGzip},
+		{common.CompressionGzip, "zstd", true, common.CompressionNone},
+		{common.CompressionZstd, "", true, common.CompressionNone},
+		{common.CompressionNone, "zstd,gzip", true, common.CompressionNone},
+	}
+	for i, test := range tests {
+		common.Configuration.CompressionAlgorithm = test.configured
+		if test.zstd {
+			// The data isn't really compressed with zstd, only the negotiation is tested
+			RegisterCompressor(common.CompressionZstd, gzipCompressor{})
+		} else {
+			RegisterCompressor(common.CompressionZstd, nil)
+		}
+		if negotiated := negotiateCompression(test.peerAlgorithms); negotiated != test.expected {
+			t.Errorf("Test %d: negotiated %s instead of %s", i, negotiated, test.expected)
+		}
+	}
+
+	RegisterCompressor(common.CompressionZstd, gzipCompressor{})
+	if supported := supportedCompressionAlgorithms(); supported != "zstd,gzip" {
+		t.Errorf("Wrong supported algorithms with a zstd compressor: %s", supported)
+	}
+}
+
+func TestCompressedDataMessage(t *testing.T) {
+	file, err := ioutil.TempFile("", "compresseddata")
+	if err != nil {
+		t.Errorf("Failed to create file. Error: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	data := bytes.Repeat([]byte("compressible data "), 50)
+	file.Write(data)
+	file.Close()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", InstanceID: 5,
+		ObjectSize: int64(len(data)), SourceDataURI: "file://" + file.Name()}
+	tests := []struct {
+		compression string
+		offset      int64
+		size        int
+		compressed  bool
+	}{
+		{common.CompressionGzip, 0, len(data), true},
+		{common.CompressionGzip, int64(len(data) - 4), 8, false}, // Data that doesn't get smaller is sent uncompressed
+		{common.CompressionNone, 0, len(data), false},
+	}
+	message := new(bytes.Buffer)
+	for i, test := range tests {
+		message.Reset()
+		dataMessage, length, _, err := readDataMessage(message, metaData, test.offset, test.size, nil, nil, common.Version, test.compression)
+		if err != nil {
+			t.Errorf("Test %d: readDataMessage failed. Error: %s", i, err.Error())
+			continue
+		}
+		_, _, _, dataReader, dataLength, offset, _, compression, _, err := parseDataMessage(dataMessage)
+		if err != nil {
+			t.Errorf("Test %d: failed to parse the data message. Error: %s", i, err.Error())
+			continue
+		}
+		received, _ := ioutil.ReadAll(dataReader)
+		if !test.compressed {
+			if compression != 0 || !bytes.Equal(received, data[offset:offset+int64(length)]) {
+				t.Errorf("Test %d: the data was compressed (%d)", i, compression)
+			}
+			continue
+		}
+		if compression != compressionIDs[test.compression] || int(dataLength) >= length {
+			t.Errorf("Test %d: the data wasn't compressed with %s (compression %d, length %d)", i, test.compression, compression, dataLength)
+			continue
+		}
+		decompressed, err := decompressData(received, compression, metaData.ObjectSize-offset)
+		if err != nil || !bytes.Equal(decompressed, data) {
+			t.Errorf("Test %d: the decompressed data doesn't match the data. Error: %v", i, err)
+		}
+		if _, err := decompressData(received, compression, int64(length-1)); err == nil {
+			t.Errorf("Test %d: data larger than the object was decompressed", i)
+		}
+	}
+
+	if _, err := decompressData([]byte("data"), 99, 100); err == nil {
+		t.Errorf("Data of an unknown compression algorithm was decompressed")
+	}
+
+	// A truncated compressed data message is rejected
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+	Comm = &TestComm{}
+	received := metaData
+	received.SourceDataURI = ""
+	if _, err := Store.StoreObject(received, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	message.Reset()
+	dataMessage, _, _, err := readDataMessage(message, metaData, 0, len(data), nil, nil, common.Version, common.CompressionGzip)
+	if err != nil {
+		t.Errorf("readDataMessage failed. Error: %s", err.Error())
+	} else if _, err := handleData(dataMessage[:len(dataMessage)-4]); err == nil || !IsInvalidData(err) {
+		t.Errorf("handleData didn't reject a truncated compressed data message. Error: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package communications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// dataRateLimiter paces the data messages sent to each destination, according to common.Configuration.DataSendRatePerDestination.
+// It is a token bucket per destination, kept as the time at which the bucket of the destination is full again:
+// sending size bytes moves that time by size/rate, and the bytes may be sent once it is at most burst/rate ahead of now.
+type dataRateLimiter struct {
+	lock      sync.Mutex
+	fullTimes map[string]time.Time
+	lastPrune time.Time
+}
+
+var dataSendLimiter = dataRateLimiter{fullTimes: make(map[string]time.Time)}
+
+// reserve reserves sending size bytes to the destination, and returns how long the caller has to wait before sending them.
+// The reservations of a destination are served in the order they were made.
+func (limiter *dataRateLimiter) reserve(orgID string, destType string, destID string, size int) time.Duration {
+	rate := int64(common.Configuration.DataSendRatePerDestination)
+	if rate <= 0 {
+		return 0
+	}
+	burst := int64(common.Configuration.DataSendBurstPerDestination)
+	if burst <= 0 {
+		burst = rate
+	}
+	sendTime := func(bytes int64) time.Duration {
+		return time.Duration(bytes * int64(time.Second) / rate)
+	}
+
+	key := orgID + ":" + destType + ":" + destID
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+	limiter.prune(now)
+
+	fullTime := limiter.fullTimes[key]
+	if fullTime.Before(now) {
+		fullTime = now
+	}
+	fullTime = fullTime.Add(sendTime(int64(size)))
+	limiter.fullTimes[key] = fullTime
+
+	if delay := fullTime.Sub(now) - sendTime(burst); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// prune removes the buckets that are full, i.e., of destinations that no data was sent to recently.
+// Must be called while holding the limiter's lock.
+func (limiter *dataRateLimiter) prune(now time.Time) {
+	if now.Sub(limiter.lastPrune) < time.Minute {
+		return
+	}
+	limiter.lastPrune = now
+	for key, fullTime := range limiter.fullTimes {
+		if !fullTime.After(now) {
+			delete(limiter.fullTimes, key)
+		}
+	}
+}
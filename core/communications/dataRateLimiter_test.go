@@ -0,0 +1,54 @@
+package communications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestDataRateLimiter(t *testing.T) {
+	rate := common.Configuration.DataSendRatePerDestination
+	burst := common.Configuration.DataSendBurstPerDestination
+	defer func() {
+		common.Configuration.DataSendRatePerDestination = rate
+		common.Configuration.DataSendBurstPerDestination = burst
+	}()
+
+	limiter := dataRateLimiter{fullTimes: make(map[string]time.Time)}
+
+	common.Configuration.DataSendRatePerDestination = 0
+	if delay := limiter.reserve("myorg", "device", "dev1", 1000000); delay != 0 {
+		t.Errorf("Data was delayed by %s without a rate limit", delay)
+	}
+
+	common.Configuration.DataSendRatePerDestination = 1000
+	common.Configuration.DataSendBurstPerDestination = 2000
+
+	// The burst is sent at once
+	for i := 0; i < 2; i++ {
+		if delay := limiter.reserve("myorg", "device", "dev1", 1000); delay != 0 {
+			t.Errorf("Data within the burst was delayed by %s", delay)
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		delay := limiter.reserve("myorg", "device", "dev1", 1000)
+		if delay <= time.Duration(i)*time.Second-100*time.Millisecond || delay > time.Duration(i)*time.Second {
+			t.Errorf("Data beyond the burst was delayed by %s instead of %ds", delay, i)
+		}
+	}
+
+	// Other destinations aren't affected
+	if delay := limiter.reserve("myorg", "device", "dev2", 2000); delay != 0 {
+		t.Errorf("Data of another destination was delayed by %s", delay)
+	}
+
+	// The burst defaults to the bytes of one second
+	common.Configuration.DataSendBurstPerDestination = 0
+	if delay := limiter.reserve("myorg", "device", "dev3", 1000); delay != 0 {
+		t.Errorf("Data within the default burst was delayed by %s", delay)
+	}
+	if delay := limiter.reserve("myorg", "device", "dev3", 500); delay <= 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Errorf("Data beyond the default burst was delayed by %s instead of 500ms", delay)
+	}
+}
@@ -0,0 +1,77 @@
+package communications
+
+import (
+	"io"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// maxReencryptedObjects is the maximal number of objects whose data is re-encrypted by each call to ReencryptObjectsData
+const maxReencryptedObjects = 10
+
+// ReencryptObjectsData re-encrypts with the current data encryption key the data of a few objects whose data is
+// encrypted with a previous key, so that the objects are gradually moved to the current key.
+// Should be called only by the leader.
+func ReencryptObjectsData() common.SyncServiceError {
+	keyring := storage.GetDataKeyring()
+	if keyring == nil {
+		return nil
+	}
+
+	objects, err := Store.RetrieveObjectsWithOtherDataKey(keyring.CurrentKeyID())
+	if err != nil {
+		return &Error{"Failed to retrieve the objects to re-encrypt. Error: " + err.Error()}
+	}
+	for i, metaData := range objects {
+		if i == maxReencryptedObjects {
+			break
+		}
+		if err := reencryptObjectData(keyring, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil &&
+			log.IsLogging(logger.ERROR) {
+			log.Error("Failed to re-encrypt the data of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType,
+				metaData.ObjectID, err)
+		}
+	}
+	return nil
+}
+
+func reencryptObjectData(keyring *storage.DataKeyring, orgID string, objectType string, objectID string) common.SyncServiceError {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	// The data of an object that is being received is re-encrypted after all of its chunks are stored with its codec
+	_, status, err := Store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil || status == "" || status == common.PartiallyReceived {
+		return err
+	}
+	previousCodec, err := Store.RetrieveObjectDataCodec(orgID, objectType, objectID)
+	if err != nil || (previousCodec != nil && previousCodec.KeyID == keyring.CurrentKeyID()) {
+		return err
+	}
+	dataCodec, err := storage.NewObjectDataCodec()
+	if err != nil {
+		return err
+	}
+
+	// The data is streamed from the stored copy, decoded with its codec, to a new copy encoded with the new codec
+	dataReader, err := Store.RetrieveObjectData(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	var reencryptingReader io.Reader
+	if dataReader != nil {
+		defer Store.CloseDataReader(dataReader)
+		reencryptingReader = dataCodec.NewEncodingReader(previousCodec.NewDecodingReader(dataReader, 0), 0)
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Re-encrypting the data of %s:%s:%s with the data encryption key %s", orgID, objectType, objectID,
+			keyring.CurrentKeyID())
+	}
+	return Store.StoreReencryptedObjectData(orgID, objectType, objectID, dataCodec, reencryptingReader)
+}
@@ -0,0 +1,65 @@
+package communications
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestReencryptObjectsData(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	var err error
+	Store, err = setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+	defer storage.RegisterDataCodec(nil)
+
+	keys := map[string][]byte{"": []byte("0123456789abcdef"), "2": []byte("fedcba9876543210")}
+	previousKeyring, err := storage.NewDataKeyring(map[string][]byte{"": keys[""]}, "")
+	if err != nil {
+		t.Fatalf("NewDataKeyring failed. Error: %s", err.Error())
+	}
+	storage.RegisterDataCodec(previousKeyring)
+
+	plain := bytes.Repeat([]byte("0123456789"), 30)
+	for _, objectID := range []string{"1", "2", "3"} {
+		metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: "reencryptorg", ObjectSize: int64(len(plain))}
+		if _, err := Store.StoreObject(metaData, plain, common.CompletelyReceived); err != nil {
+			t.Errorf("Failed to store object. Error: %s", err.Error())
+		}
+	}
+
+	keyring, err := storage.NewDataKeyring(keys, "2")
+	if err != nil {
+		t.Fatalf("NewDataKeyring failed. Error: %s", err.Error())
+	}
+	storage.RegisterDataCodec(keyring)
+	if err := ReencryptObjectsData(); err != nil {
+		t.Errorf("ReencryptObjectsData failed. Error: %s", err.Error())
+	}
+
+	for _, objectID := range []string{"1", "2", "3"} {
+		dataCodec, err := Store.RetrieveObjectDataCodec("reencryptorg", "type1", objectID)
+		if err != nil || dataCodec == nil || dataCodec.KeyID != "2" {
+			t.Errorf("The data of object %s wasn't re-encrypted", objectID)
+			continue
+		}
+		dataReader, err := Store.RetrieveObjectData("reencryptorg", "type1", objectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve the data of object %s", objectID)
+			continue
+		}
+		data, _ := ioutil.ReadAll(dataCodec.NewDecodingReader(dataReader, 0))
+		if !bytes.Equal(data, plain) {
+			t.Errorf("Wrong data decoded for object %s", objectID)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package communications
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// A DataURLPresigner returns a presigned URL from which the destination downloads the data of the object directly, for
+// example a presigned GET URL of an S3 or MinIO bucket that holds the object's data. It is called when the update
+// notification of an object larger than OutOfBandTransferThreshold is sent to the destination
+// (see common.Configuration.OutOfBandTransferThreshold). If it returns an empty URL or an error, the data is sent in chunks.
+type DataURLPresigner func(metaData common.MetaData, destType string, destID string) (string, error)
+
+var dataURLPresigner DataURLPresigner
+var dataURLPresignerLock sync.RWMutex
+
+// RegisterDataURLPresigner registers the presigner of the data URLs of large objects, replacing the current presigner.
+// A nil presigner removes the current presigner.
+func RegisterDataURLPresigner(presigner DataURLPresigner) {
+	dataURLPresignerLock.Lock()
+	dataURLPresigner = presigner
+	dataURLPresignerLock.Unlock()
+}
+
+// withDataURL returns the meta data to send in the update notification of the object to the destination. The meta data
+// of an object larger than OutOfBandTransferThreshold is copied, and its DataURL is set to the presigned URL of its data.
+func withDataURL(metaData *common.MetaData, destType string, destID string) *common.MetaData {
+	threshold := common.Configuration.OutOfBandTransferThreshold
+	if threshold <= 0 || metaData == nil || metaData.ObjectSize <= threshold || metaData.NoData || metaData.MetaOnly ||
+		metaData.Link != "" || len(metaData.PatchRanges) != 0 {
+		return metaData
+	}
+	dataURLPresignerLock.RLock()
+	presigner := dataURLPresigner
+	dataURLPresignerLock.RUnlock()
+	if presigner == nil {
+		return metaData
+	}
+
+	dataURL, err := presigner(*metaData, destType, destID)
+	if err != nil {
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to presign the data URL of %s:%s:%s for %s %s, its data is sent in chunks. Error: %s\n",
+				metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID, err)
+		}
+		return metaData
+	}
+	if dataURL == "" {
+		return metaData
+	}
+	metaDataWithURL := *metaData
+	metaDataWithURL.DataURL = dataURL
+	return &metaDataWithURL
+}
+
+// fetchDataURL downloads the data of an object from the data URL that its origin provided in the update notification,
+// and stores it as the object's data. When all of the data is stored, the receipt of the object is completed like the
+// receipt of the last chunk of its data. If the data can't be downloaded (e.g., the URL expired), it is requested
+// from the origin in chunks.
+func fetchDataURL(metaData common.MetaData, dataURL string, maxInflightChunks int) common.SyncServiceError {
+	if !beginFetch(metaData) {
+		// The update was resent while the data is being downloaded
+		return nil
+	}
+	defer endFetch(metaData)
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Downloading the data of %s %s from its data URL%s\n", metaData.ObjectType, metaData.ObjectID,
+			common.TraceIDTag(&metaData))
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	stored, err := storeDataURL(metaData, dataURL, lockIndex)
+	if err != nil {
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to download the data of %s:%s:%s from its data URL, requesting it in chunks. %s\n",
+				metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, err)
+		}
+		common.ObjectLocks.Lock(lockIndex)
+		receiving := isReceivingInstance(metaData)
+		common.ObjectLocks.Unlock(lockIndex)
+		if !receiving {
+			return nil
+		}
+		return requestObjectData(metaData, maxInflightChunks)
+	}
+	if !stored {
+		return nil
+	}
+
+	common.ObjectLocks.Lock(lockIndex)
+	if !isReceivingInstance(metaData) {
+		common.ObjectLocks.Unlock(lockIndex)
+		return nil
+	}
+	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, receivedObjectStatus(metaData)); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: fmt.Sprintf("Error in fetchDataURL: %s\n", err)}
+	}
+	return completeObjectReceipt(metaData, lockIndex)
+}
+
+// storeDataURL stores the data downloaded from the data URL. Only http and https URLs are downloaded, a data URL
+// provided by the origin doesn't refer to the receiver's own files.
+// It returns false and no error if the object was updated or deleted while its data was downloaded.
+func storeDataURL(metaData common.MetaData, dataURL string, lockIndex uint32) (bool, common.SyncServiceError) {
+	link, err := url.Parse(dataURL)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Invalid data URL. Error: %s", err)}
+	}
+	if scheme := strings.ToLower(link.Scheme); scheme != "http" && scheme != "https" {
+		return false, &Error{fmt.Sprintf("Unsupported data URL scheme %s", link.Scheme)}
+	}
+
+	dataReader, size, err := fetchHTTPLink(link)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to download the data. Error: %s", err)}
+	}
+	defer dataReader.Close()
+
+	if size >= 0 && size != metaData.ObjectSize {
+		return false, &Error{fmt.Sprintf("The size of the data (%d) doesn't match the size of the object (%d)", size, metaData.ObjectSize)}
+	}
+	return storeFetchedData(metaData, dataReader, metaData.ObjectSize, lockIndex)
+}
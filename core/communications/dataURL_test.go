@@ -0,0 +1,146 @@
+package communications
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestFetchDataURL(t *testing.T) {
+	common.InitObjectLocks()
+	maxObjectSize := common.Configuration.MaxObjectSize
+	maxDataChunkSize := common.Configuration.MaxDataChunkSize
+	defer func() {
+		common.Configuration.MaxObjectSize = maxObjectSize
+		common.Configuration.MaxDataChunkSize = maxDataChunkSize
+	}()
+	common.Configuration.MaxObjectSize = 0
+	common.Configuration.MaxDataChunkSize = 4
+
+	Comm = &TestComm{}
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	data := []byte("data of the object from its data URL")
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/presigned" {
+			// The URL expired
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writer.Write(data)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		dataURL    string
+		objectSize int64
+		downloaded bool
+	}{
+		{server.URL + "/presigned", int64(len(data)), true},
+		{server.URL + "/expired", int64(len(data)), false},
+		{server.URL + "/presigned", int64(len(data) + 1), false},
+		{"file:///etc/hosts", int64(len(data)), false},
+	}
+	for i, test := range tests {
+		metaData := common.MetaData{ObjectID: "presigned", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: test.objectSize,
+			ChunkSize: 4, OriginType: common.Configuration.DestinationType, OriginID: "origin", InstanceID: int64(i + 1)}
+		Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+		if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+			continue
+		}
+		if err := fetchDataURL(metaData, test.dataURL, 1); err != nil {
+			t.Errorf("fetchDataURL failed in test %d. Error: %s", i, err.Error())
+			continue
+		}
+
+		status, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			t.Errorf("RetrieveObjectStatus failed. Error: %s", err.Error())
+			continue
+		}
+		notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.OriginType, metaData.OriginID)
+		if err != nil || notification == nil {
+			t.Errorf("Test %d: no notification record", i)
+			continue
+		}
+		if !test.downloaded {
+			// The data is requested in chunks
+			if status != common.PartiallyReceived || notification.Status != common.Getdata {
+				t.Errorf("Test %d: the status of an object whose data wasn't downloaded is %s, and its notification's status is %s",
+					i, status, notification.Status)
+			}
+			continue
+		}
+		if status != common.CompletelyReceived || notification.Status != common.Received {
+			t.Errorf("Test %d: the status of an object whose data was downloaded is %s, and its notification's status is %s",
+				i, status, notification.Status)
+			continue
+		}
+		dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("Test %d: failed to retrieve the object's data", i)
+			continue
+		}
+		if storedData, _ := ioutil.ReadAll(dataReader); !bytes.Equal(storedData, data) {
+			t.Errorf("Test %d: the stored data (%s) doesn't match the downloaded data", i, string(storedData))
+		}
+	}
+}
+
+func TestWithDataURL(t *testing.T) {
+	threshold := common.Configuration.OutOfBandTransferThreshold
+	defer func() {
+		common.Configuration.OutOfBandTransferThreshold = threshold
+		RegisterDataURLPresigner(nil)
+	}()
+	common.Configuration.OutOfBandTransferThreshold = 100
+
+	metaData := &common.MetaData{ObjectID: "large", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1000}
+	if withDataURL(metaData, "device", "dev1").DataURL != "" {
+		t.Errorf("A data URL was set without a presigner")
+	}
+
+	RegisterDataURLPresigner(func(metaData common.MetaData, destType string, destID string) (string, error) {
+		if destID == "failed" {
+			return "", errors.New("failed to presign")
+		}
+		return "https://bucket/" + metaData.ObjectID + "?for=" + destID, nil
+	})
+	if sent := withDataURL(metaData, "device", "dev1"); sent.DataURL != "https://bucket/large?for=dev1" {
+		t.Errorf("Wrong data URL: %s", sent.DataURL)
+	}
+	if metaData.DataURL != "" {
+		t.Errorf("The data URL was set in the object's meta data")
+	}
+	if withDataURL(metaData, "device", "failed").DataURL != "" {
+		t.Errorf("A data URL was set although the presigner failed")
+	}
+
+	small := &common.MetaData{ObjectID: "small", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 100}
+	if withDataURL(small, "device", "dev1").DataURL != "" {
+		t.Errorf("A data URL was set for an object that isn't larger than the threshold")
+	}
+	metaOnly := &common.MetaData{ObjectID: "large", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1000, MetaOnly: true}
+	if withDataURL(metaOnly, "device", "dev1").DataURL != "" {
+		t.Errorf("A data URL was set for a meta data only update")
+	}
+
+	common.Configuration.OutOfBandTransferThreshold = 0
+	if withDataURL(metaData, "device", "dev1").DataURL != "" {
+		t.Errorf("A data URL was set although out of band transfers are disabled")
+	}
+}
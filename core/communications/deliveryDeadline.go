@@ -0,0 +1,102 @@
+package communications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// overdueDeliveries holds the instances of the objects that were reported as overdue to each destination,
+// keyed by the notification IDs, so that each overdue delivery is reported once
+var overdueDeliveries = make(map[string]int64)
+var overdueDeliveriesLock sync.Mutex
+
+// isDeliveryOverdue returns true if the delivery status of an object whose deadline passed means that the destination
+// didn't receive it. Objects that were rejected by the destination are never received, and aren't reported.
+func isDeliveryOverdue(status string) bool {
+	return status == common.Pending || status == common.Delivering || status == common.Error
+}
+
+// CheckDeliveryDeadlines reports the destinations that didn't receive objects by the objects' delivery deadlines
+// (DeliverBy) in notification events with the DeliveryOverdue status. Each destination is reported once for each
+// instance of an object. If EscalateOverdueObjects is set, the priority of the overdue objects is raised to high.
+// Should be called only by the leader.
+func CheckDeliveryDeadlines() common.SyncServiceError {
+	if common.Configuration.NodeType != common.CSS {
+		return nil
+	}
+
+	objects, err := Store.GetOverdueObjects()
+	if err != nil {
+		return &Error{"Failed to retrieve the overdue objects. Error: " + err.Error()}
+	}
+
+	overdueDeliveriesLock.Lock()
+	defer overdueDeliveriesLock.Unlock()
+
+	overdue := make(map[string]int64)
+	for _, metaData := range objects {
+		destinations, err := Store.GetObjectDestinationsList(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to retrieve the destinations of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType,
+					metaData.ObjectID, err)
+			}
+			continue
+		}
+
+		laggards := 0
+		for _, dest := range destinations {
+			if !isDeliveryOverdue(dest.Status) {
+				continue
+			}
+			laggards++
+			destType := dest.Destination.DestType
+			destID := dest.Destination.DestID
+			id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
+			overdue[id] = metaData.InstanceID
+			if instanceID, ok := overdueDeliveries[id]; ok && instanceID == metaData.InstanceID {
+				continue
+			}
+			reportOverdueDelivery(metaData, destType, destID)
+		}
+
+		if laggards > 0 && common.Configuration.EscalateOverdueObjects && metaData.Priority != common.PriorityHigh {
+			if err := Store.UpdateObjectPriority(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.PriorityHigh); err != nil {
+				if log.IsLogging(logger.ERROR) {
+					log.Error("Failed to raise the priority of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType,
+						metaData.ObjectID, err)
+				}
+			} else if log.IsLogging(logger.INFO) {
+				log.Info("Raised the priority of the overdue object %s:%s:%s\n", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+			}
+		}
+	}
+
+	// The deliveries that aren't overdue any more are forgotten
+	overdueDeliveries = overdue
+	return nil
+}
+
+// reportOverdueDelivery reports that the destination didn't receive the object by its delivery deadline
+func reportOverdueDelivery(metaData common.MetaData, destType string, destID string) {
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("%s %s didn't receive %s:%s:%s by its delivery deadline %s\n", destType, destID, metaData.DestOrgID,
+			metaData.ObjectType, metaData.ObjectID, metaData.DeliverBy)
+	}
+	if !hasNotificationEventSubscriptions() {
+		return
+	}
+
+	previousStatus := ""
+	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
+	if err == nil && notification != nil {
+		previousStatus = notification.Status
+	}
+	publishNotificationEvent(NotificationEvent{OrgID: metaData.DestOrgID, ObjectType: metaData.ObjectType, ObjectID: metaData.ObjectID,
+		DestType: destType, DestID: destID, InstanceID: metaData.InstanceID, DataID: metaData.DataID, PreviousStatus: previousStatus,
+		Status: common.DeliveryOverdue, Timestamp: time.Now()})
+}
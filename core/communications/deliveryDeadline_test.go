@@ -0,0 +1,92 @@
+package communications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestCheckDeliveryDeadlines(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.InitObjectLocks()
+	escalate := common.Configuration.EscalateOverdueObjects
+	defer func() { common.Configuration.EscalateOverdueObjects = escalate }()
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	for _, destID := range []string{"dev1", "dev2"} {
+		dest := common.Destination{DestOrgID: "deadlineorg", DestType: "device", DestID: destID, Communication: common.MQTTProtocol}
+		if err := Store.StoreDestination(dest); err != nil {
+			t.Errorf("Failed to store destination. Error: %s", err.Error())
+		}
+	}
+
+	overdue := common.MetaData{ObjectID: "overdue", ObjectType: "type1", DestOrgID: "deadlineorg", DestType: "device",
+		DeliverBy: time.Now().Add(-time.Minute).Format(time.RFC3339), Priority: 5}
+	notDue := overdue
+	notDue.ObjectID = "notDue"
+	notDue.DeliverBy = time.Now().Add(time.Hour).Format(time.RFC3339)
+	for _, metaData := range []common.MetaData{overdue, notDue} {
+		if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+			t.Errorf("Failed to store object. Error: %s", err.Error())
+		}
+	}
+
+	// dev2 received the object in time, only dev1 is reported
+	if _, err := Store.UpdateObjectDeliveryStatus(common.Delivered, "", overdue.DestOrgID, overdue.ObjectType, overdue.ObjectID,
+		overdue.DestType, "dev2"); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s", err.Error())
+	}
+
+	subscription := SubscribeToNotificationEvents(10)
+	defer UnsubscribeFromNotificationEvents(subscription)
+
+	common.Configuration.EscalateOverdueObjects = true
+	if err := CheckDeliveryDeadlines(); err != nil {
+		t.Errorf("CheckDeliveryDeadlines failed. Error: %s", err.Error())
+	}
+	select {
+	case event := <-subscription.Events:
+		if event.Status != common.DeliveryOverdue || event.ObjectID != overdue.ObjectID || event.DestID != "dev1" {
+			t.Errorf("Wrong event: %s %s %s", event.Status, event.ObjectID, event.DestID)
+		}
+	default:
+		t.Errorf("The overdue delivery wasn't reported")
+	}
+	if len(subscription.Events) != 0 {
+		t.Errorf("Reported %d more overdue deliveries", len(subscription.Events))
+	}
+
+	metaData, err := Store.RetrieveObject(overdue.DestOrgID, overdue.ObjectType, overdue.ObjectID)
+	if err != nil || metaData == nil {
+		t.Errorf("Failed to retrieve object")
+	} else if metaData.Priority != common.PriorityHigh {
+		t.Errorf("The priority of the overdue object is %d instead of %d", metaData.Priority, common.PriorityHigh)
+	}
+	metaData, err = Store.RetrieveObject(notDue.DestOrgID, notDue.ObjectType, notDue.ObjectID)
+	if err != nil || metaData == nil {
+		t.Errorf("Failed to retrieve object")
+	} else if metaData.Priority != notDue.Priority {
+		t.Errorf("The priority of the object that isn't overdue was changed to %d", metaData.Priority)
+	}
+
+	// The overdue delivery is reported once
+	if err := CheckDeliveryDeadlines(); err != nil {
+		t.Errorf("CheckDeliveryDeadlines failed. Error: %s", err.Error())
+	}
+	if len(subscription.Events) != 0 {
+		t.Errorf("The overdue delivery was reported again")
+	}
+}
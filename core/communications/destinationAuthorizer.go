@@ -0,0 +1,103 @@
+package communications
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// A DestinationAuthorizer decides which destinations may register with the CSS, and which objects they may receive,
+// for example by their organization, their type and ID, or their attributes. It is called by the CSS only, so it must be fast.
+type DestinationAuthorizer interface {
+	// AuthorizeRegistration is called with a destination that registers with the CSS in its organization (dest.DestOrgID),
+	// before the destination is stored. If it returns an error, the registration is denied, and the error's message is
+	// sent to the destination as the reason.
+	AuthorizeRegistration(dest common.Destination) error
+
+	// AuthorizeObject is called before the update notification of the object is sent to a registered destination.
+	// If it returns an error, the object isn't sent to the destination, and the object's delivery status for the
+	// destination is marked as rejected with the error's message as the reason.
+	AuthorizeObject(dest common.Destination, metaData common.MetaData) error
+}
+
+var destinationAuthorizer DestinationAuthorizer
+var destinationAuthorizerLock sync.RWMutex
+
+// RegisterDestinationAuthorizer registers the authorizer of the destinations, replacing the current authorizer.
+// A nil authorizer removes the current authorizer, and all the destinations and objects are authorized.
+func RegisterDestinationAuthorizer(authorizer DestinationAuthorizer) {
+	destinationAuthorizerLock.Lock()
+	destinationAuthorizer = authorizer
+	destinationAuthorizerLock.Unlock()
+}
+
+func getDestinationAuthorizer() DestinationAuthorizer {
+	destinationAuthorizerLock.RLock()
+	defer destinationAuthorizerLock.RUnlock()
+	return destinationAuthorizer
+}
+
+// authorizeRegistration applies the destination authorizer to a destination that registers with the CSS.
+// If the registration is denied, the destination is notified with the reason, and an error is returned.
+func authorizeRegistration(dest common.Destination) common.SyncServiceError {
+	authorizer := getDestinationAuthorizer()
+	if authorizer == nil {
+		return nil
+	}
+
+	denial := authorizer.AuthorizeRegistration(dest)
+	if denial == nil {
+		return nil
+	}
+	reason := denial.Error()
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Denied the registration of %s %s %s. %s\n", dest.DestOrgID, dest.DestType, dest.DestID, reason)
+	}
+	if err := Comm.RegisterDenied(dest, reason); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in handleRegistration: failed to send registration denial. Error: %s\n", err)
+	}
+	return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration: denied the registration of %s %s %s. %s\n",
+		dest.DestOrgID, dest.DestType, dest.DestID, reason), category: ErrUnauthorized}
+}
+
+// authorizeObjectDelivery applies the destination authorizer to the update notification of an object.
+// If the destination may not receive the object, the object's delivery status and notification record for the destination
+// are marked as rejected, so that the notification isn't resent, and false is returned.
+func authorizeObjectDelivery(notification common.NotificationInfo) bool {
+	authorizer := getDestinationAuthorizer()
+	if authorizer == nil || common.Configuration.NodeType != common.CSS || notification.MetaData == nil {
+		return true
+	}
+
+	metaData := notification.MetaData
+	dest := common.Destination{DestOrgID: metaData.DestOrgID, DestType: notification.DestType, DestID: notification.DestID}
+	if stored, err := Store.RetrieveDestination(metaData.DestOrgID, notification.DestType, notification.DestID); err == nil && stored != nil {
+		dest = *stored
+	}
+	denial := authorizer.AuthorizeObject(dest, *metaData)
+	if denial == nil {
+		return true
+	}
+	reason := denial.Error()
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Not sending %s:%s:%s to %s %s, the destination isn't authorized to receive it. %s\n", metaData.DestOrgID,
+			metaData.ObjectType, metaData.ObjectID, notification.DestType, notification.DestID, reason)
+	}
+	if _, err := Store.UpdateObjectDeliveryStatus(common.Rejected, reason, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		notification.DestType, notification.DestID); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update the delivery status of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType,
+			metaData.ObjectID, err)
+	}
+	if err := updateNotificationRecord(
+		common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
+			DestOrgID: metaData.DestOrgID, DestID: notification.DestID, DestType: notification.DestType, Status: common.Rejected,
+			InstanceID: notification.InstanceID, DataID: notification.DataID},
+	); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update the notification record of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType,
+			metaData.ObjectID, err)
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package communications
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// The creation time (in seconds since the epoch) of the oldest notification found pending by the last periodic
+// resend of notifications, zero if there is none
+var oldestPendingNotificationTime int64
+
+// Readiness describes whether the node is ready to serve, based on its internal state
+// swagger:model
+type Readiness struct {
+	// Status is green if the node is ready, yellow if it is degraded, and red if it can't serve
+	Status string `json:"status"`
+
+	// StoreConnected is false if the storage can't be reached
+	StoreConnected bool `json:"storeConnected"`
+
+	// TransportConnected is false if the node is disconnected from the MQTT broker, or if an ESS that
+	// communicates over HTTP isn't registered with the CSS
+	TransportConnected bool `json:"transportConnected"`
+
+	// ActiveTransfers is the number of transfers of objects' data being received by the node
+	ActiveTransfers int `json:"activeTransfers"`
+
+	// OldestPendingNotificationAge is the age in seconds of the oldest notification that is pending, as found by
+	// the last periodic resend of notifications
+	OldestPendingNotificationAge int64 `json:"oldestPendingNotificationAge"`
+
+	// Reasons explain why the node isn't green
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// HealthStatus returns the readiness of the node: red if the storage or the transport are disconnected or the node is
+// shutting down, yellow if the backlog of transfers or notifications exceeds the readiness limits, and green otherwise
+func HealthStatus() Readiness {
+	readiness := Readiness{StoreConnected: Store.IsConnected(), TransportConnected: isTransportConnected()}
+
+	notificationLock.RLock()
+	readiness.ActiveTransfers = len(notificationChunks)
+	notificationLock.RUnlock()
+
+	if oldest := atomic.LoadInt64(&oldestPendingNotificationTime); oldest != 0 {
+		if age := time.Now().Unix() - oldest; age > 0 {
+			readiness.OldestPendingNotificationAge = age
+		}
+	}
+
+	readiness.Status = common.Green
+	if !readiness.StoreConnected {
+		readiness.Status = common.Red
+		readiness.Reasons = append(readiness.Reasons, "The storage can't be reached")
+	}
+	if !readiness.TransportConnected {
+		readiness.Status = common.Red
+		readiness.Reasons = append(readiness.Reasons, "The transport is disconnected")
+	}
+	if IsShuttingDown() {
+		readiness.Status = common.Red
+		readiness.Reasons = append(readiness.Reasons, "The node is shutting down")
+	}
+	if readiness.Status == common.Red {
+		return readiness
+	}
+
+	if common.Configuration.ReadinessMaxActiveTransfers > 0 &&
+		readiness.ActiveTransfers > common.Configuration.ReadinessMaxActiveTransfers {
+		readiness.Status = common.Yellow
+		readiness.Reasons = append(readiness.Reasons, fmt.Sprintf("%d active transfers exceed the limit of %d",
+			readiness.ActiveTransfers, common.Configuration.ReadinessMaxActiveTransfers))
+	}
+	if common.Configuration.ReadinessMaxPendingNotificationAge > 0 &&
+		readiness.OldestPendingNotificationAge > int64(common.Configuration.ReadinessMaxPendingNotificationAge) {
+		readiness.Status = common.Yellow
+		readiness.Reasons = append(readiness.Reasons, fmt.Sprintf("A notification has been pending for %d seconds, above the limit of %d",
+			readiness.OldestPendingNotificationAge, common.Configuration.ReadinessMaxPendingNotificationAge))
+	}
+	return readiness
+}
+
+func isTransportConnected() bool {
+	if common.Configuration.CommunicationProtocol != common.HTTPProtocol {
+		return common.HealthStatus.IsConnectedToBroker()
+	}
+	if common.Configuration.NodeType == common.ESS {
+		return common.Registered
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package communications
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestHealthStatus(t *testing.T) {
+	nodeType := common.Configuration.NodeType
+	protocol := common.Configuration.CommunicationProtocol
+	maxTransfers := common.Configuration.ReadinessMaxActiveTransfers
+	maxAge := common.Configuration.ReadinessMaxPendingNotificationAge
+	registered := common.Registered
+	defer func() {
+		common.Configuration.NodeType = nodeType
+		common.Configuration.CommunicationProtocol = protocol
+		common.Configuration.ReadinessMaxActiveTransfers = maxTransfers
+		common.Configuration.ReadinessMaxPendingNotificationAge = maxAge
+		common.Registered = registered
+		atomic.StoreInt64(&oldestPendingNotificationTime, 0)
+	}()
+
+	// Count only the transfers of this test, not those left behind by other tests
+	notificationLock.Lock()
+	chunks := notificationChunks
+	notificationChunks = make(map[string]notificationChunksInfo)
+	notificationLock.Unlock()
+	defer func() {
+		notificationLock.Lock()
+		notificationChunks = chunks
+		notificationLock.Unlock()
+	}()
+
+	Store = &storage.InMemoryStorage{}
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.CommunicationProtocol = common.HTTPProtocol
+	common.Configuration.ReadinessMaxActiveTransfers = 1
+	common.Configuration.ReadinessMaxPendingNotificationAge = 60
+
+	readiness := HealthStatus()
+	if readiness.Status != common.Green || !readiness.StoreConnected || !readiness.TransportConnected ||
+		len(readiness.Reasons) != 0 {
+		t.Errorf("The idle node isn't ready: %+v", readiness)
+	}
+
+	// Transfers above the limit
+	notificationLock.Lock()
+	notificationChunks["health1"] = notificationChunksInfo{}
+	notificationChunks["health2"] = notificationChunksInfo{}
+	notificationLock.Unlock()
+	readiness = HealthStatus()
+	if readiness.Status != common.Yellow || readiness.ActiveTransfers < 2 || len(readiness.Reasons) != 1 {
+		t.Errorf("The node with transfers above the limit isn't degraded: %+v", readiness)
+	}
+	common.Configuration.ReadinessMaxActiveTransfers = 0
+	if readiness = HealthStatus(); readiness.Status != common.Green {
+		t.Errorf("The number of transfers was checked without a limit: %+v", readiness)
+	}
+
+	// An old pending notification
+	atomic.StoreInt64(&oldestPendingNotificationTime, time.Now().Unix()-10)
+	if readiness = HealthStatus(); readiness.Status != common.Green || readiness.OldestPendingNotificationAge < 10 {
+		t.Errorf("The node with a recent pending notification isn't ready: %+v", readiness)
+	}
+	atomic.StoreInt64(&oldestPendingNotificationTime, time.Now().Unix()-120)
+	if readiness = HealthStatus(); readiness.Status != common.Yellow || readiness.OldestPendingNotificationAge < 120 {
+		t.Errorf("The node with an old pending notification isn't degraded: %+v", readiness)
+	}
+
+	// An ESS that isn't registered can't serve
+	common.Configuration.NodeType = common.ESS
+	common.Registered = false
+	if readiness = HealthStatus(); readiness.Status != common.Red || readiness.TransportConnected {
+		t.Errorf("The unregistered ESS isn't red: %+v", readiness)
+	}
+	common.Registered = true
+	if readiness = HealthStatus(); readiness.Status != common.Yellow || !readiness.TransportConnected {
+		t.Errorf("The registered ESS isn't degraded: %+v", readiness)
+	}
+}
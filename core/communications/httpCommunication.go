@@ -17,6 +17,7 @@ import (
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/dataURI"
 	"github.com/open-horizon/edge-sync-service/core/security"
+	"github.com/open-horizon/edge-sync-service/core/storage"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -26,6 +27,7 @@ const registerURL = "/spi/v1/register/"
 const registerNewURL = "/spi/v1/register-new/"
 const unregisterURL = "/spi/v1/unregister/"
 const pingURL = "/spi/v1/ping/"
+const heartbeatURL = "/spi/v1/heartbeat/"
 const objectRequestURL = "/spi/v1/objects/"
 
 var unauthorizedBytes = []byte("Unauthorized")
@@ -37,6 +39,7 @@ type HTTP struct {
 	httpPollTimer       *time.Timer
 	httpPollStopChannel chan int
 	requestWrapper      *httpRequestWrapper
+	tlsConfig           *reloadableTLSConfig
 }
 
 type updateMessage struct {
@@ -50,6 +53,15 @@ type feedbackMessage struct {
 	Reason        string
 }
 
+type partiallyConsumedMessage struct {
+	Offset int64
+}
+
+type verifyMessage struct {
+	Manifest []common.ManifestEntry
+	Resend   bool
+}
+
 // StartCommunication starts communications
 func (communication *HTTP) StartCommunication() common.SyncServiceError {
 	if common.Configuration.NodeType == common.CSS {
@@ -57,30 +69,18 @@ func (communication *HTTP) StartCommunication() common.SyncServiceError {
 		http.Handle(registerNewURL, http.StripPrefix(registerNewURL, http.HandlerFunc(communication.handleRegisterNew)))
 		http.Handle(unregisterURL, http.StripPrefix(unregisterURL, http.HandlerFunc(communication.handleUnregister)))
 		http.Handle(pingURL, http.StripPrefix(pingURL, http.HandlerFunc(communication.handlePing)))
+		http.Handle(heartbeatURL, http.StripPrefix(heartbeatURL, http.HandlerFunc(communication.handleHeartbeat)))
 		http.Handle(objectRequestURL, http.StripPrefix(objectRequestURL, http.HandlerFunc(communication.handleObjects)))
 	} else {
 		communication.httpClient = http.Client{Transport: &http.Transport{}}
 		if common.Configuration.HTTPCSSUseSSL && len(common.Configuration.HTTPCSSCACertificate) > 0 {
-			var caFile string
-			if strings.HasPrefix(common.Configuration.HTTPCSSCACertificate, "/") {
-				caFile = common.Configuration.HTTPCSSCACertificate
-			} else {
-				caFile = common.Configuration.PersistenceRootPath + common.Configuration.HTTPCSSCACertificate
-			}
-
-			certificate, err := ioutil.ReadFile(caFile)
+			setTLSLoadTime(time.Now())
+			tlsConfig, err := newHTTPTLSConfig()
 			if err != nil {
-				if _, ok := err.(*os.PathError); ok {
-					// The HTTP CA Certificate is likely a value rather than a path
-					certificate = []byte(common.Configuration.HTTPCSSCACertificate)
-				} else {
-					return err
-				}
+				return err
 			}
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM(certificate)
-			tlsConfig := &tls.Config{RootCAs: caCertPool}
-			communication.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+			communication.tlsConfig = newReloadableTLSConfig(tlsConfig)
+			communication.httpClient.Transport = &http.Transport{TLSClientConfig: communication.tlsConfig.clientConfig()}
 		}
 		communication.httpPollStopChannel = make(chan int, 1)
 		communication.requestWrapper = newHTTPRequestWrapper(communication.httpClient)
@@ -90,6 +90,39 @@ func (communication *HTTP) StartCommunication() common.SyncServiceError {
 	return nil
 }
 
+// newHTTPTLSConfig loads the TLS configuration of the connections to the CSS
+func newHTTPTLSConfig() (*tls.Config, common.SyncServiceError) {
+	certificate, err := ioutil.ReadFile(tlsFilePath(common.Configuration.HTTPCSSCACertificate))
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			// The HTTP CA Certificate is likely a value rather than a path
+			certificate = []byte(common.Configuration.HTTPCSSCACertificate)
+		} else {
+			return nil, err
+		}
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(certificate)
+	return &tls.Config{RootCAs: caCertPool}, nil
+}
+
+// ReloadTLS reloads the CA certificate of the CSS, and applies it to the connections established afterward.
+// If it fails to load, the previous one remains in use.
+func (communication *HTTP) ReloadTLS() common.SyncServiceError {
+	if communication.tlsConfig == nil {
+		return nil
+	}
+	tlsConfig, err := newHTTPTLSConfig()
+	if err != nil {
+		return &Error{"Failed to reload the TLS configuration of the CSS connections. Error: " + err.Error()}
+	}
+	communication.tlsConfig.store(tlsConfig)
+	if log.IsLogging(logger.INFO) {
+		log.Info("Reloaded the TLS configuration of the CSS connections\n")
+	}
+	return nil
+}
+
 func (communication *HTTP) startPolling() {
 	configuredInterval := int(common.Configuration.HTTPPollingInterval) * 1000
 	go func() {
@@ -197,7 +230,7 @@ func (communication *HTTP) handleGetUpdates(writer http.ResponseWriter, request
 			}
 			continue
 		}
-		if metaData == nil || metaData.InstanceID != n.InstanceID {
+		if metaData == nil || common.CompareInstances(metaData.InstanceID, metaData.InstanceSequence, n.InstanceID, n.InstanceSequence) != 0 {
 			continue
 		}
 
@@ -215,6 +248,10 @@ func (communication *HTTP) handleGetUpdates(writer http.ResponseWriter, request
 			status = common.Received
 		}
 		metaData.DestID = n.DestID
+		metaData = withOrderSequence(metaData, n.DestType, n.DestID, n.OrderSequence, status)
+		if status == common.Update {
+			metaData = withDataURL(metaData, n.DestType, n.DestID)
+		}
 		message := updateMessage{status, *metaData}
 		payload = append(payload, message)
 	}
@@ -260,7 +297,7 @@ func (communication *HTTP) SendNotificationMessage(notificationTopic string, des
 		defer common.ObjectLocks.Unlock(lockIndex)
 		notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 			DestOrgID: metaData.DestOrgID, DestID: destID, DestType: destType, Status: status, InstanceID: instanceID, DataID: dataID}
-		return Store.UpdateNotificationRecord(notification)
+		return updateNotificationRecord(notification)
 	}
 
 	url := buildObjectURL(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, instanceID, dataID, notificationTopic)
@@ -362,10 +399,32 @@ func (communication *HTTP) handleRegisterOrPing(url string, writer http.Response
 				return
 			}
 		}
+		var availableSpace int64
+		if availableSpaceString := request.URL.Query().Get("available-space"); availableSpaceString != "" {
+			var err error
+			availableSpace, err = strconv.ParseInt(availableSpaceString, 10, 64)
+			if err != nil || availableSpace < 0 {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		var attributes map[string]string
+		for _, attribute := range request.URL.Query()["attribute"] {
+			parts := strings.SplitN(attribute, "=", 2)
+			if len(parts) != 2 || !common.IsValidName(parts[0]) {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if attributes == nil {
+				attributes = make(map[string]string)
+			}
+			attributes[parts[0]] = parts[1]
+		}
 		var err error
 		destination := common.Destination{DestOrgID: orgID, DestType: destType, DestID: destID, Communication: common.HTTPProtocol,
 			// The version is 1.0 as the URL is /spi/v1/register...
-			CodeVersion: "1.0"}
+			CodeVersion: "1.0", MaxObjectVersion: request.URL.Query().Get("max-object-version"), AvailableSpace: availableSpace,
+			Attributes: attributes}
 		switch url {
 		case registerURL:
 			err = handleRegistration(destination, persistentStorage)
@@ -373,6 +432,8 @@ func (communication *HTTP) handleRegisterOrPing(url string, writer http.Response
 			err = handleRegisterNew(destination, persistentStorage)
 		case pingURL:
 			err = handlePing(destination)
+		case heartbeatURL:
+			err = handleHeartbeat(destination)
 		}
 		if err == nil {
 			writer.WriteHeader(http.StatusNoContent)
@@ -446,6 +507,10 @@ func (communication *HTTP) handlePing(writer http.ResponseWriter, request *http.
 	communication.handleRegisterOrPing(pingURL, writer, request)
 }
 
+func (communication *HTTP) handleHeartbeat(writer http.ResponseWriter, request *http.Request) {
+	communication.handleRegisterOrPing(heartbeatURL, writer, request)
+}
+
 func (communication *HTTP) registerOrPing(url string) common.SyncServiceError {
 	if common.Configuration.NodeType != common.ESS {
 		return nil
@@ -455,6 +520,17 @@ func (communication *HTTP) registerOrPing(url string) common.SyncServiceError {
 	request, err := http.NewRequest("PUT", requestURL, nil)
 	q := request.URL.Query() // Get a copy of the query values.
 	q.Add("persistent-storage", strconv.FormatBool(Store.IsPersistent()))
+	if common.Configuration.MaxObjectVersion != "" {
+		q.Add("max-object-version", common.Configuration.MaxObjectVersion)
+	}
+	if availableSpace := reportedAvailableSpace(); availableSpace != 0 {
+		q.Add("available-space", strconv.FormatInt(availableSpace, 10))
+	}
+	// The attributes were validated with the configuration
+	attributes, _ := common.DestinationAttributes()
+	for name, value := range attributes {
+		q.Add("attribute", name+"="+value)
+	}
 	request.URL.RawQuery = q.Encode() // Encode and assign back to the original query.
 
 	security.AddIdentityToSPIRequest(request, requestURL)
@@ -545,6 +621,12 @@ func (communication *HTTP) RegisterAck(destination common.Destination) common.Sy
 	return nil
 }
 
+// RegisterDenied sends a message from the CSS to an ESS that its registration was denied, with the reason.
+// With HTTP the denial is the response to the registration request.
+func (communication *HTTP) RegisterDenied(destination common.Destination, reason string) common.SyncServiceError {
+	return nil
+}
+
 // RegisterAsNew send a notification from a CSS to a ESS that the ESS has to send a registerNew message in order
 // to register
 func (communication *HTTP) RegisterAsNew(destination common.Destination) common.SyncServiceError {
@@ -566,6 +648,11 @@ func (communication *HTTP) SendPing() common.SyncServiceError {
 	return communication.registerOrPing(pingURL)
 }
 
+// SendHeartbeat sends a heartbeat message from ESS to CSS
+func (communication *HTTP) SendHeartbeat() common.SyncServiceError {
+	return communication.registerOrPing(heartbeatURL)
+}
+
 // GetData requests data to be sent from the CSS to the ESS
 func (communication *HTTP) GetData(metaData common.MetaData, offset int64) common.SyncServiceError {
 	if common.Configuration.NodeType != common.ESS {
@@ -596,7 +683,8 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 		return &common.NotFound{}
 	}
 	if response.StatusCode != http.StatusOK {
-		return &notificationHandlerError{"Error in GetData: failed to receive data from the other side"}
+		return &notificationHandlerError{message: "Error in GetData: failed to receive data from the other side",
+			category: ErrTransportFailure}
 	}
 
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
@@ -608,7 +696,13 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 			return err
 		}
 	} else {
-		found, err := Store.StoreObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, response.Body)
+		dataCodec, err := storage.NewObjectDataCodec()
+		if err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return err
+		}
+		dataReader := dataCodec.NewEncodingReader(response.Body, 0)
+		found, err := Store.StoreObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dataReader)
 		if err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
 			return err
@@ -617,7 +711,26 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 			return &Error{"Failed to store object's data."}
 		}
 	}
-	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.CompletelyReceived); err != nil {
+	if metaData.Hash != "" {
+		if err := verifyObjectData(metaData); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return &Error{fmt.Sprintf("Error in GetData: failed to verify data. Error: %s\n", err)}
+		}
+	}
+	if reason, err := signatureRejectionReason(metaData); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &Error{fmt.Sprintf("Error in GetData: failed to verify signature. Error: %s\n", err)}
+	} else if reason != "" {
+		err := rejectObjectData(metaData, reason)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			return &Error{fmt.Sprintf("Error in GetData: failed to reject data. Error: %s\n", err)}
+		}
+		// The CSS stops sending the object, and marks its delivery as failed
+		return communication.SendNotificationMessage(common.Cancel, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+			metaData.DataID, &metaData)
+	}
+	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, receivedObjectStatus(metaData)); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return &Error{fmt.Sprintf("Error in GetData: %s\n", err)}
 	}
@@ -633,12 +746,91 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 		return err
 	}
 
-	callWebhooks(&metaData)
+	deliverReceivedObject(&metaData)
+	return nil
+}
+
+// GetDataRange requests count consecutive chunks, starting at offset, to be sent from the CSS to the ESS.
+// A range at the beginning of the data is received with the rest of the data, as GetData receives the whole data.
+// Other ranges are requested with a Range header, and their chunks are handled like the chunks of data messages.
+func (communication *HTTP) GetDataRange(metaData common.MetaData, offset int64, count int) common.SyncServiceError {
+	if common.Configuration.NodeType != common.ESS {
+		return nil
+	}
+	if offset == 0 || metaData.ChunkSize <= 0 {
+		return communication.GetData(metaData, offset)
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("In http.GetDataRange %s %s (offset %d, count %d)", metaData.ObjectType, metaData.ObjectID, offset, count)
+	}
+
+	if count < 1 {
+		count = 1
+	}
+	if err := updateGetDataRangeNotification(metaData, metaData.OriginType, metaData.OriginID, offset, count); err != nil {
+		return err
+	}
+
+	end := offset + int64(count)*int64(metaData.ChunkSize)
+	url := buildObjectURL(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID, metaData.DataID, common.Data)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return &Error{"Failed to create data request. Error: " + err.Error()}
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end-1))
+	security.AddIdentityToSPIRequest(request, url)
+
+	response, err := communication.requestWrapper.do(request)
+	if err != nil {
+		return &Error{"Error in GetDataRange: failed to get data. Error: " + err.Error()}
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The other side ignored the range and sent the whole data
+		if _, err := io.CopyN(ioutil.Discard, response.Body, offset); err != nil {
+			return &notificationHandlerError{message: "Error in GetDataRange: failed to receive data from the other side. Error: " + err.Error(),
+				category: ErrTransportFailure}
+		}
+	case http.StatusNotFound:
+		return &common.NotFound{}
+	default:
+		return &notificationHandlerError{message: "Error in GetDataRange: failed to receive data from the other side",
+			category: ErrTransportFailure}
+	}
+
+	chunk := make([]byte, metaData.ChunkSize)
+	for ; offset < end; offset += int64(metaData.ChunkSize) {
+		length, readErr := io.ReadFull(response.Body, chunk)
+		if length > 0 {
+			dataMessage, err := buildDataMessage(metaData, chunk[:length], length, offset)
+			if err != nil {
+				return err
+			}
+			if _, err := handleData(dataMessage); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			// The range ends at the end of the data
+			break
+		}
+		if readErr != nil {
+			return &notificationHandlerError{message: "Error in GetDataRange: failed to receive data from the other side. Error: " + readErr.Error(),
+				category: ErrTransportFailure}
+		}
+	}
 	return nil
 }
 
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
-func (communication *HTTP) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
+func (communication *HTTP) SendData(metaData *common.MetaData, destType string, destID string, message []byte, chunked bool,
+	done func()) common.SyncServiceError {
+	if done != nil {
+		done()
+	}
 	return nil
 }
 
@@ -840,6 +1032,11 @@ func (communication *HTTP) handleObjects(writer http.ResponseWriter, request *ht
 			err = handleAckConsumed(orgID, objectType, objectID, destType, destID, instanceID, dataID)
 		case common.Received:
 			err = handleObjectReceived(orgID, objectType, objectID, destType, destID, instanceID, dataID)
+		case common.PartiallyConsumed:
+			payload := partiallyConsumedMessage{}
+			if err = json.NewDecoder(request.Body).Decode(&payload); err == nil {
+				err = handleObjectPartiallyConsumed(orgID, objectType, objectID, destType, destID, instanceID, dataID, payload.Offset)
+			}
 		case common.Feedback:
 
 			payload := feedbackMessage{}
@@ -865,11 +1062,20 @@ func (communication *HTTP) handleObjects(writer http.ResponseWriter, request *ht
 			}
 		case common.AckDeleted:
 			err = handleAckObjectDeleted(orgID, objectType, objectID, destType, destID, instanceID)
+		case common.Cancel:
+			err = handleCancelTransfer(orgID, objectType, objectID, destType, destID, instanceID)
 
 		case common.Resend:
 			err = handleResendRequest(common.Destination{DestOrgID: orgID, DestID: destID, DestType: destType,
 				Communication: common.HTTPProtocol})
 
+		case common.Verify:
+			payload := verifyMessage{}
+			if err = json.NewDecoder(request.Body).Decode(&payload); err == nil {
+				err = handleVerifyRequest(common.Destination{DestOrgID: orgID, DestID: destID, DestType: destType,
+					Communication: common.HTTPProtocol}, payload.Manifest, payload.Resend)
+			}
+
 		default:
 			writer.WriteHeader(http.StatusBadRequest)
 			return
@@ -906,34 +1112,41 @@ func (communication *HTTP) handlePutData(orgID string, objectType string, object
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 
-	if found, err := Store.StoreObjectData(orgID, objectType, objectID, request.Body); err != nil {
+	dataCodec, err := storage.NewObjectDataCodec()
+	if err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return err
+	}
+	dataReader := dataCodec.NewEncodingReader(request.Body, 0)
+	if found, err := Store.StoreObjectData(orgID, objectType, objectID, dataReader); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	} else if !found {
 		common.ObjectLocks.Unlock(lockIndex)
 		return &common.InvalidRequest{Message: "Failed to find object to set data"}
 	}
-	if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived); err != nil {
+
+	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil || metaData == nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return &common.InvalidRequest{Message: "Failed to find object to set data"}
 	}
-
-	if metaData, err := Store.RetrieveObject(orgID, objectType, objectID); err == nil && metaData != nil {
-		handleDataReceived(*metaData)
-		notificationsInfo, err := PrepareObjectStatusNotification(*metaData, common.Received)
+	if err := Store.UpdateObjectStatus(orgID, objectType, objectID, receivedObjectStatus(*metaData)); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		if err != nil {
-			return err
-		}
-		if err := SendNotifications(notificationsInfo); err != nil {
-			return err
-		}
+		return err
+	}
 
-		callWebhooks(metaData)
-	} else {
-		common.ObjectLocks.Unlock(lockIndex)
-		return &common.InvalidRequest{Message: "Failed to find object to set data"}
+	handleDataReceived(*metaData)
+	notificationsInfo, err := PrepareObjectStatusNotification(*metaData, common.Received)
+	common.ObjectLocks.Unlock(lockIndex)
+	if err != nil {
+		return err
+	}
+	if err := SendNotifications(notificationsInfo); err != nil {
+		return err
 	}
+
+	deliverReceivedObject(metaData)
 	return nil
 }
 
@@ -943,15 +1156,33 @@ func (communication *HTTP) handleGetData(orgID string, objectType string, object
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
+	dataCodec, err := storage.GetObjectDataCodec(Store, orgID, objectType, objectID)
+	if err != nil {
+		SendErrorResponse(writer, err, "", 0)
+		return
+	}
 	if dataReader, err := Store.RetrieveObjectData(orgID, objectType, objectID); err != nil {
 		SendErrorResponse(writer, err, "", 0)
 	} else {
 		if dataReader == nil {
 			writer.WriteHeader(http.StatusNotFound)
 		} else {
+			data := dataCodec.NewDecodingReader(dataReader, 0)
+			status := http.StatusOK
+			if start, end, ok := parseDataRange(request.Header.Get("Range")); ok {
+				// The ESS requests the chunks in the range again
+				if _, err := io.CopyN(ioutil.Discard, data, start); err != nil && err != io.EOF {
+					Store.CloseDataReader(dataReader)
+					SendErrorResponse(writer, &Error{"Failed to read data. Error: " + err.Error()}, "", 0)
+					return
+				}
+				data = io.LimitReader(data, end-start+1)
+				writer.Header().Add("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, end))
+				status = http.StatusPartialContent
+			}
 			writer.Header().Add("Content-Type", "application/octet-stream")
-			writer.WriteHeader(http.StatusOK)
-			if _, err := io.Copy(writer, dataReader); err != nil {
+			writer.WriteHeader(status)
+			if _, err := io.Copy(writer, data); err != nil {
 				SendErrorResponse(writer, err, "", 0)
 			}
 			if err := Store.CloseDataReader(dataReader); err != nil {
@@ -959,11 +1190,31 @@ func (communication *HTTP) handleGetData(orgID string, objectType string, object
 			}
 			notification := common.Notification{ObjectID: objectID, ObjectType: objectType,
 				DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.Data, InstanceID: instanceID, DataID: dataID}
-			Store.UpdateNotificationRecord(notification)
+			updateNotificationRecord(notification)
 		}
 	}
 }
 
+// parseDataRange parses a Range header of a single range of bytes, and returns the first and the last offsets of the range
+func parseDataRange(header string) (int64, int64, bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(header, "bytes="), "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
 func (communication *HTTP) pushData(metaData *common.MetaData) common.SyncServiceError {
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	common.ObjectLocks.RLock(lockIndex)
@@ -976,7 +1227,12 @@ func (communication *HTTP) pushData(metaData *common.MetaData) common.SyncServic
 	if metaData.SourceDataURI != "" {
 		dataReader, err = dataURI.GetData(metaData.SourceDataURI)
 	} else {
+		var dataCodec *storage.ObjectDataCodec
+		if dataCodec, err = storage.GetObjectDataCodec(Store, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+			return err
+		}
 		dataReader, err = Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		dataReader = dataCodec.NewDecodingReader(dataReader, 0)
 	}
 	if err != nil {
 		return err
@@ -1008,7 +1264,7 @@ func (communication *HTTP) ResendObjects() common.SyncServiceError {
 		return nil
 	}
 
-	url := buildResendURL(common.Configuration.OrgID)
+	url := buildOrgRequestURL(common.Configuration.OrgID, common.Resend)
 	request, err := http.NewRequest("PUT", url, nil)
 	security.AddIdentityToSPIRequest(request, url)
 
@@ -1032,6 +1288,49 @@ func (communication *HTTP) SendAckResendObjects(destination common.Destination)
 	return nil
 }
 
+// SendAckBatch sends a batch of acks of received and consumed notifications to the destination.
+// Each ack is sent in its own request.
+func (communication *HTTP) SendAckBatch(orgID string, destType string, destID string, acks []common.AckEntry) common.SyncServiceError {
+	for _, ack := range acks {
+		metaData := &common.MetaData{ObjectType: ack.ObjectType, ObjectID: ack.ObjectID, DestOrgID: orgID, DestType: destType, DestID: destID,
+			OriginType: ack.OriginType, OriginID: ack.OriginID, InstanceID: ack.InstanceID, DataID: ack.DataID}
+		if err := communication.SendNotificationMessage(ack.Command, destType, destID, ack.InstanceID, ack.DataID, metaData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendVerifyRequest sends the manifest of the objects of the ESS to the CSS, to verify them
+func (communication *HTTP) SendVerifyRequest(manifest []common.ManifestEntry, resend bool) common.SyncServiceError {
+	if common.Configuration.NodeType != common.ESS {
+		return nil
+	}
+
+	body, err := json.Marshal(verifyMessage{Manifest: manifest, Resend: resend})
+	if err != nil {
+		return &Error{"Failed to marshal payload. Error: " + err.Error()}
+	}
+
+	url := buildOrgRequestURL(common.Configuration.OrgID, common.Verify)
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return &Error{"Failed to create HTTP request to verify objects. Error: " + err.Error()}
+	}
+	request.ContentLength = int64(len(body))
+	security.AddIdentityToSPIRequest(request, url)
+
+	response, err := communication.requestWrapper.do(request)
+	if err != nil {
+		return &Error{"Failed to send HTTP request to verify objects. Error: " + err.Error()}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return communication.createError(response, "verify objects")
+}
+
 // ChangeLeadership changes the leader
 func (communication *HTTP) ChangeLeadership(isLeader bool) common.SyncServiceError {
 	// communication.isLeader = isLeader
@@ -1107,6 +1406,41 @@ func (communication *HTTP) SendErrorMessage(err common.SyncServiceError, metaDat
 	return communication.SendFeedbackMessage(code, retryInterval, reason, metaData, sendToOrigin)
 }
 
+// SendPartiallyConsumed notifies the object's origin that the data of the object was consumed up to offset
+func (communication *HTTP) SendPartiallyConsumed(metaData *common.MetaData, offset int64) common.SyncServiceError {
+	if common.Configuration.NodeType != common.ESS {
+		// In HTTP the CSS can't notify the ESS, the partial consumption is only reported by the final consumed notification
+		return nil
+	}
+
+	url := buildObjectURL(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID, metaData.DataID,
+		common.PartiallyConsumed)
+
+	body, err := json.MarshalIndent(partiallyConsumedMessage{offset}, "", "  ")
+	if err != nil {
+		return &Error{"Failed to marshal payload. Error: " + err.Error()}
+	}
+
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return &Error{"Failed to create HTTP request. Error: " + err.Error()}
+	}
+	request.ContentLength = int64(len(body))
+
+	security.AddIdentityToSPIRequest(request, url)
+
+	response, err := communication.requestWrapper.do(request)
+	if err != nil {
+		return &Error{"Failed to send HTTP request. Error: " + err.Error()}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return communication.createError(response, "send partially consumed notification")
+}
+
 func buildObjectURL(orgID string, objectType string, objectID string, instanceID int64, dataID int64, topic string) string {
 	// common.HTTPCSSURL + objectRequestURL + orgID + "/" + objectType + "/" + objectID + "/" + instanceID + "/" + dataID + "/" + topic
 	var strBuilder strings.Builder
@@ -1127,15 +1461,15 @@ func buildObjectURL(orgID string, objectType string, objectID string, instanceID
 	return strBuilder.String()
 }
 
-func buildResendURL(orgID string) string {
-	// common.HTTPCSSURL + objectRequestURL + orgID + "/" + common.Resend
+func buildOrgRequestURL(orgID string, action string) string {
+	// common.HTTPCSSURL + objectRequestURL + orgID + "/" + action
 	var strBuilder strings.Builder
-	strBuilder.Grow(len(common.HTTPCSSURL) + len(objectRequestURL) + len(orgID) + len(common.Resend) + 1)
+	strBuilder.Grow(len(common.HTTPCSSURL) + len(objectRequestURL) + len(orgID) + len(action) + 1)
 	strBuilder.WriteString(common.HTTPCSSURL)
 	strBuilder.WriteString(objectRequestURL)
 	strBuilder.WriteString(orgID)
 	strBuilder.WriteByte('/')
-	strBuilder.WriteString(common.Resend)
+	strBuilder.WriteString(action)
 	return strBuilder.String()
 }
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
@@ -610,3 +611,78 @@ func (writer *httpCommTestResponseWriter) Write(p []byte) (int, error) {
 func (writer *httpCommTestResponseWriter) WriteHeader(statusCode int) {
 	writer.statusCode = statusCode
 }
+
+func TestSendErrorResponseNotLeader(t *testing.T) {
+	tests := []struct {
+		err     *common.NotLeader
+		message string
+	}{
+		{&common.NotLeader{Message: "Only the leader can handle this."}, "Only the leader can handle this.\n"},
+		{&common.NotLeader{Message: "Only the leader can handle this.", LeaderAddress: "https://css1:8443"},
+			"Only the leader can handle this. The leader is at https://css1:8443\n"},
+	}
+
+	for _, test := range tests {
+		writer := httptest.NewRecorder()
+		SendErrorResponse(writer, test.err, "", 0)
+		if writer.Code != http.StatusMisdirectedRequest {
+			t.Errorf("SendErrorResponse returned status %d instead of %d", writer.Code, http.StatusMisdirectedRequest)
+		}
+		if leaderAddress := writer.Header().Get("X-Sync-Service-Leader"); leaderAddress != test.err.LeaderAddress {
+			t.Errorf("SendErrorResponse returned the leader address %s instead of %s", leaderAddress, test.err.LeaderAddress)
+		}
+		if body := writer.Body.String(); body != test.message {
+			t.Errorf("SendErrorResponse returned %q instead of %q", body, test.message)
+		}
+	}
+}
+
+func TestHTTPGetDataRange(t *testing.T) {
+	common.InitObjectLocks()
+	savedStore := Store
+	defer func() { Store = savedStore }()
+
+	var err error
+	Store, err = setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	metaData := common.MetaData{ObjectID: "range", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 10, InstanceID: 1}
+	if _, err := Store.StoreObject(metaData, []byte("0123456789"), common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+		return
+	}
+
+	tests := []struct {
+		rangeHeader string
+		statusCode  int
+		body        string
+	}{
+		{"", http.StatusOK, "0123456789"},
+		{"bytes=3-6", http.StatusPartialContent, "3456"},
+		// A range past the end of the data is cut at the end of the data
+		{"bytes=8-15", http.StatusPartialContent, "89"},
+		// An invalid range is ignored
+		{"bytes=6-3", http.StatusOK, "0123456789"},
+		{"bytes=3-", http.StatusOK, "0123456789"},
+	}
+	comm := &HTTP{}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, "", nil)
+		if test.rangeHeader != "" {
+			request.Header.Set("Range", test.rangeHeader)
+		}
+		writer := httptest.NewRecorder()
+		comm.handleGetData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "device", "dev1", metaData.InstanceID,
+			metaData.DataID, writer, request)
+		if writer.Code != test.statusCode {
+			t.Errorf("Range %q: handleGetData returned status %d instead of %d", test.rangeHeader, writer.Code, test.statusCode)
+		}
+		if body := writer.Body.String(); body != test.body {
+			t.Errorf("Range %q: handleGetData returned %q instead of %q", test.rangeHeader, body, test.body)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package communications
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// A LinkFetcher opens the data that an object's link refers to, so that the receiving node stores it as the object's data
+// (see common.Configuration.FetchLinkedData). It returns the data and its size, or -1 if the size isn't known.
+type LinkFetcher func(link *url.URL) (io.ReadCloser, int64, error)
+
+var linkFetchers = map[string]LinkFetcher{
+	"http":  fetchHTTPLink,
+	"https": fetchHTTPLink,
+	"file":  fetchFileLink,
+}
+var linkFetchersLock sync.RWMutex
+
+// The instances of the objects whose linked data, or data from a data URL, is being fetched, by the objects' notification IDs
+var linkFetches = make(map[string]int64)
+var linkFetchesLock sync.Mutex
+
+var linkHTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, ResponseHeaderTimeout: time.Minute}}
+
+// RegisterLinkFetcher registers the fetcher of the links with the scheme, replacing the current fetcher of the scheme.
+// A nil fetcher removes the fetcher of the scheme.
+func RegisterLinkFetcher(scheme string, fetcher LinkFetcher) {
+	linkFetchersLock.Lock()
+	defer linkFetchersLock.Unlock()
+
+	if fetcher == nil {
+		delete(linkFetchers, strings.ToLower(scheme))
+	} else {
+		linkFetchers[strings.ToLower(scheme)] = fetcher
+	}
+}
+
+func fetchHTTPLink(link *url.URL) (io.ReadCloser, int64, error) {
+	response, err := linkHTTPClient.Get(link.String())
+	if err != nil {
+		return nil, 0, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, 0, &Error{fmt.Sprintf("The link returned HTTP status %s", response.Status)}
+	}
+	return response.Body, response.ContentLength, nil
+}
+
+func fetchFileLink(link *url.URL) (io.ReadCloser, int64, error) {
+	file, err := os.Open(link.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// fetchLinkedData fetches the data of an object that was received with a link, and stores it as the object's data.
+// When all of the data is stored, the object is marked as completely received. If the data can't be fetched,
+// the transfer of the object's data fails (see GetFailedTransfers), and the object's origin is notified with an error feedback.
+func fetchLinkedData(metaData common.MetaData) common.SyncServiceError {
+	if !beginFetch(metaData) {
+		// The update was resent while the data is being fetched
+		return nil
+	}
+	defer endFetch(metaData)
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Fetching the linked data of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	stored, err := storeLinkedData(metaData, lockIndex)
+	if err != nil {
+		return failLinkedData(metaData, lockIndex, err.Error())
+	}
+	if !stored {
+		return nil
+	}
+
+	common.ObjectLocks.Lock(lockIndex)
+	if !isReceivingInstance(metaData) {
+		common.ObjectLocks.Unlock(lockIndex)
+		return nil
+	}
+	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, receivedObjectStatus(metaData)); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: fmt.Sprintf("Error in fetchLinkedData: %s\n", err)}
+	}
+	notificationsInfo, err := PrepareObjectStatusNotification(metaData, common.Received)
+	common.ObjectLocks.Unlock(lockIndex)
+	if err != nil {
+		return err
+	}
+	if err := SendNotifications(notificationsInfo); err != nil {
+		return err
+	}
+	deliverReceivedObject(&metaData)
+
+	return nil
+}
+
+// beginFetch records that the data of the object's instance is being fetched. It returns false if it is already being fetched.
+func beginFetch(metaData common.MetaData) bool {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	linkFetchesLock.Lock()
+	defer linkFetchesLock.Unlock()
+	if instanceID, ok := linkFetches[id]; ok && instanceID == metaData.InstanceID {
+		return false
+	}
+	linkFetches[id] = metaData.InstanceID
+	return true
+}
+
+func endFetch(metaData common.MetaData) {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	linkFetchesLock.Lock()
+	if linkFetches[id] == metaData.InstanceID {
+		delete(linkFetches, id)
+	}
+	linkFetchesLock.Unlock()
+}
+
+// storeLinkedData stores the data of the object's link in chunks of MaxDataChunkSize bytes.
+// It returns false and no error if the object was updated or deleted while its data was fetched.
+func storeLinkedData(metaData common.MetaData, lockIndex uint32) (bool, common.SyncServiceError) {
+	link, err := url.Parse(metaData.Link)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Invalid link. Error: %s", err)}
+	}
+	linkFetchersLock.RLock()
+	fetcher := linkFetchers[strings.ToLower(link.Scheme)]
+	linkFetchersLock.RUnlock()
+	if fetcher == nil {
+		return false, &Error{fmt.Sprintf("Unsupported link scheme %s", link.Scheme)}
+	}
+
+	linkReader, size, err := fetcher(link)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to fetch the linked data. Error: %s", err)}
+	}
+	defer linkReader.Close()
+
+	return storeFetchedData(metaData, linkReader, size, lockIndex)
+}
+
+// storeFetchedData stores the fetched data of the object in chunks of MaxDataChunkSize bytes. The size of the data is -1
+// if it isn't known. It returns false and no error if the object was updated or deleted while its data was fetched.
+func storeFetchedData(metaData common.MetaData, linkReader io.Reader, size int64, lockIndex uint32) (bool, common.SyncServiceError) {
+	maxSize := common.Configuration.MaxObjectSize
+	if maxSize > 0 && size > maxSize {
+		return false, &Error{fmt.Sprintf("The size of the data (%d) exceeds the maximum object size (%d)", size, maxSize)}
+	}
+	var dataReader io.Reader = linkReader
+	if maxSize > 0 {
+		// One more byte than allowed is read to detect data that exceeds the maximum size
+		dataReader = io.LimitReader(linkReader, maxSize+1)
+	}
+	bufferedReader := bufio.NewReader(dataReader)
+
+	// The linked data is a new copy of the object's data, all its chunks are encoded with the same codec
+	dataCodec, codecErr := storage.NewObjectDataCodec()
+	if codecErr != nil {
+		return false, codecErr
+	}
+
+	chunk := make([]byte, common.Configuration.MaxDataChunkSize)
+	for offset := int64(0); ; {
+		n, err := io.ReadFull(bufferedReader, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, &Error{fmt.Sprintf("Failed to read the data. Error: %s", err)}
+		}
+		if maxSize > 0 && offset+int64(n) > maxSize {
+			return false, &Error{fmt.Sprintf("The size of the data exceeds the maximum object size (%d)", maxSize)}
+		}
+		_, err = bufferedReader.Peek(1)
+		if err != nil && err != io.EOF {
+			return false, &Error{fmt.Sprintf("Failed to read the data. Error: %s", err)}
+		}
+		isLastChunk := err == io.EOF
+
+		total := size
+		if total < offset+int64(n) {
+			total = offset + int64(n)
+		}
+		common.ObjectLocks.Lock(lockIndex)
+		if !isReceivingInstance(metaData) {
+			common.ObjectLocks.Unlock(lockIndex)
+			return false, nil
+		}
+		appendErr := appendObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dataCodec,
+			bytes.NewReader(chunk[:n]), uint32(n), offset, total, offset == 0, isLastChunk)
+		common.ObjectLocks.Unlock(lockIndex)
+		if appendErr != nil {
+			return false, &Error{fmt.Sprintf("Failed to store the data. Error: %s", appendErr)}
+		}
+
+		if isLastChunk {
+			return true, nil
+		}
+		offset += int64(n)
+	}
+}
+
+// failLinkedData fails the transfer of the object's linked data, and notifies the object's origin
+func failLinkedData(metaData common.MetaData, lockIndex uint32, reason string) common.SyncServiceError {
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Failed to receive the linked data of %s:%s:%s. %s\n", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, reason)
+	}
+
+	common.ObjectLocks.Lock(lockIndex)
+	if !isReceivingInstance(metaData) {
+		common.ObjectLocks.Unlock(lockIndex)
+		return nil
+	}
+	if err := updateNotificationRecord(
+		common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType, DestOrgID: metaData.DestOrgID,
+			DestType: metaData.OriginType, DestID: metaData.OriginID, Status: common.TransferFailed,
+			InstanceID: metaData.InstanceID, InstanceSequence: metaData.InstanceSequence, DataID: metaData.DataID},
+	); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update notification record. Error: %s\n", err)
+	}
+	common.ObjectLocks.Unlock(lockIndex)
+
+	if err := Comm.SendFeedbackMessage(common.LinkErrorCode, 0, reason, &metaData, true); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in fetchLinkedData: failed to send feedback. Error: %s\n", err),
+			category: ErrTransportFailure}
+	}
+	return nil
+}
+
+// isReceivingInstance returns true if the stored object is the instance of the object whose data is being received.
+// Must be called while holding the object's lock.
+func isReceivingInstance(metaData common.MetaData) bool {
+	storedMetaData, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || storedMetaData == nil || status != common.PartiallyReceived {
+		return false
+	}
+	return common.CompareInstances(storedMetaData.InstanceID, storedMetaData.InstanceSequence,
+		metaData.InstanceID, metaData.InstanceSequence) == 0
+}
@@ -0,0 +1,107 @@
+package communications
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestFetchLinkedData(t *testing.T) {
+	maxObjectSize := common.Configuration.MaxObjectSize
+	maxDataChunkSize := common.Configuration.MaxDataChunkSize
+	defer func() {
+		common.Configuration.MaxObjectSize = maxObjectSize
+		common.Configuration.MaxDataChunkSize = maxDataChunkSize
+	}()
+	common.Configuration.MaxObjectSize = 0
+	common.Configuration.MaxDataChunkSize = 4
+
+	Comm = &TestComm{}
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	file, err := ioutil.TempFile("", "linked")
+	if err != nil {
+		t.Errorf("Failed to create the linked file. Error: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	data := []byte("linked data of the object")
+	file.Write(data)
+	file.Close()
+
+	RegisterLinkFetcher("test", func(link *url.URL) (io.ReadCloser, int64, error) {
+		// The size of the data isn't known
+		return ioutil.NopCloser(bytes.NewReader(data)), -1, nil
+	})
+	defer RegisterLinkFetcher("test", nil)
+
+	tests := []struct {
+		link          string
+		maxObjectSize int64
+		fetched       bool
+	}{
+		{"file://" + file.Name(), 0, true},
+		{"test://linked", 0, true},
+		{"file://" + file.Name(), int64(len(data)), true},
+		{"file://" + file.Name(), int64(len(data) - 1), false},
+		{"test://linked", int64(len(data) - 1), false},
+		{"file://" + file.Name() + ".missing", 0, false},
+		{"unknown://linked", 0, false},
+	}
+	for i, test := range tests {
+		common.Configuration.MaxObjectSize = test.maxObjectSize
+		metaData := common.MetaData{ObjectID: "linked", ObjectType: "type1", DestOrgID: "myorg", Link: test.link,
+			OriginType: common.Configuration.DestinationType, OriginID: "origin", InstanceID: int64(i + 1)}
+		if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+			continue
+		}
+		if err := fetchLinkedData(metaData); err != nil {
+			t.Errorf("fetchLinkedData failed in test %d. Error: %s", i, err.Error())
+			continue
+		}
+
+		status, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			t.Errorf("RetrieveObjectStatus failed. Error: %s", err.Error())
+			continue
+		}
+		notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.OriginType, metaData.OriginID)
+		if err != nil || notification == nil {
+			t.Errorf("Test %d: no notification record", i)
+			continue
+		}
+		if !test.fetched {
+			if status != common.PartiallyReceived || notification.Status != common.TransferFailed {
+				t.Errorf("Test %d: the status of an object whose linked data wasn't fetched is %s, and its notification's status is %s",
+					i, status, notification.Status)
+			}
+			continue
+		}
+		if status != common.CompletelyReceived || notification.Status != common.Received {
+			t.Errorf("Test %d: the status of an object whose linked data was fetched is %s, and its notification's status is %s",
+				i, status, notification.Status)
+			continue
+		}
+		dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("Test %d: failed to retrieve the object's data", i)
+			continue
+		}
+		if storedData, _ := ioutil.ReadAll(dataReader); !bytes.Equal(storedData, data) {
+			t.Errorf("Test %d: the stored data (%s) doesn't match the linked data", i, string(storedData))
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package communications
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -25,12 +27,21 @@ type messagePayload struct {
 	Command            string                    `json:"command"`
 	Meta               common.MetaData           `json:"meta,omitempty"`
 	Offset             int64                     `json:"offset,omitempty"`
+	Count              int                       `json:"count,omitempty"`
 	Destination        common.Destination        `json:"destination,omitempty"`
 	PersistentStorage  bool                      `json:"persistent,omitempty"`
 	FeedbackCode       int                       `json:"feedback-code,omitempty"`
 	FeedbackFromOrigin bool                      `json:"feedback-from-origin,omitempty"`
 	RetryInterval      int32                     `json:"retry,omitempty"`
 	Reason             string                    `json:"reason,omitempty"`
+	Manifest           []common.ManifestEntry    `json:"manifest,omitempty"`
+	Resend             bool                      `json:"resend,omitempty"`
+	Acks               []common.AckEntry         `json:"acks,omitempty"`
+	// CompressionAlgorithms are the compression algorithms of data messages that the CSS supports, sent in the
+	// registration ack
+	CompressionAlgorithms string `json:"compression-algorithms,omitempty"`
+	// DataTopics is the number of topics across which the CSS receives chunked data, sent in the registration ack
+	DataTopics int `json:"data-topics,omitempty"`
 }
 
 type brokerAddresses struct {
@@ -45,7 +56,7 @@ type clientInfo struct {
 	timestamp time.Time
 }
 
-type publishMessageFunc func(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError
+type publishMessageFunc func(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError
 
 // MQTT is the struct for MQTT based communications between a CSS and an ESS
 type MQTT struct {
@@ -55,6 +66,8 @@ type MQTT struct {
 	topics                  map[string]byte
 	topic                   string
 	leaderTopic             string
+	leaderDataTopics        []string
+	dataStripe              uint32
 	isCheckingDB            bool
 	checkStopChannel        chan int
 	checkForUpdatesTicker   *time.Ticker
@@ -66,6 +79,7 @@ type MQTT struct {
 	lastTimestamp           time.Time
 	publishMessage          publishMessageFunc
 	serverURIs              [][]string
+	tlsConfig               *reloadableTLSConfig
 	lock                    sync.RWMutex
 }
 
@@ -135,12 +149,15 @@ func (context *mqttClientContext) parallelMessageHandler(client mqtt.Client, msg
 	if command == common.Getdata || command == common.Data {
 		context.communicator.dataQ <- &messageInfo
 	} else if command == common.AckRegister {
+		setCSSMessageVersion(messageInfo.messagePayload.Version)
+		setCSSCompressionAlgorithms(messageInfo.messagePayload.CompressionAlgorithms)
+		setCSSDataTopics(messageInfo.messagePayload.DataTopics)
 		handleRegAck()
 	} else if command == common.AckResend {
 		handleAckResend()
 	} else {
 		var orgID, destType, destID string
-		if command == common.Register || command == common.Resend {
+		if command == common.Register || command == common.Resend || command == common.Verify {
 			dest := messageInfo.messagePayload.Destination
 			orgID = dest.DestOrgID
 			destType = dest.DestType
@@ -163,7 +180,17 @@ func parseMessage(msg mqtt.Message, messageInfo *messageHandlerInfo) bool {
 		messageInfo.messagePayload.Command = common.Data
 		messageInfo.payload = payload
 	} else {
-		if err := json.Unmarshal(payload, &messageInfo.messagePayload); err != nil {
+		messageJSON := payload
+		if bytes.HasPrefix(payload, gzipMagic) {
+			var err error
+			if messageJSON, err = decompressNotificationMessage(payload); err != nil {
+				if log.IsLogging(logger.ERROR) {
+					log.Error("Failed to decompress notification message. Error: %s", err.Error())
+				}
+				return false
+			}
+		}
+		if err := json.Unmarshal(messageJSON, &messageInfo.messagePayload); err != nil {
 			err = &Error{"Failed to unmarshal payload. Error: %s" + err.Error()}
 			if log.IsLogging(logger.ERROR) {
 				log.Error(err.Error())
@@ -176,7 +203,7 @@ func parseMessage(msg mqtt.Message, messageInfo *messageHandlerInfo) bool {
 			}
 			return false
 		}
-		if messageInfo.messagePayload.Version != common.Version {
+		if !common.IsSupportedMessageVersion(messageInfo.messagePayload.Version) {
 			if log.IsLogging(logger.ERROR) {
 				log.Error("Received message with unsupported version")
 			}
@@ -198,17 +225,18 @@ func processMessage(messageInfo *messageHandlerInfo) {
 	meta := &messagePayload.Meta
 
 	if common.Configuration.NodeType == common.CSS && messagePayload.Command != common.Data &&
-		messagePayload.Command != common.Register && messagePayload.Command != common.RegisterNew && messagePayload.Command != common.Ping {
+		messagePayload.Command != common.Register && messagePayload.Command != common.RegisterNew && messagePayload.Command != common.Ping &&
+		messagePayload.Command != common.Heartbeat {
 		destType := meta.OriginType
 		destID := meta.OriginID
 		destOrgID := meta.DestOrgID
 		if messagePayload.Command == common.Updated || messagePayload.Command == common.Consumed ||
-			messagePayload.Command == common.Received || messagePayload.Command == common.AckDelete ||
-			messagePayload.Command == common.Deleted || messagePayload.Command == common.Getdata ||
+			messagePayload.Command == common.PartiallyConsumed || messagePayload.Command == common.Received ||
+			messagePayload.Command == common.AckDelete || messagePayload.Command == common.Deleted || messagePayload.Command == common.Getdata || messagePayload.Command == common.Cancel ||
 			(messagePayload.Command == common.Feedback && !messagePayload.FeedbackFromOrigin) {
 			destType = meta.DestType
 			destID = meta.DestID
-		} else if messagePayload.Command == common.Resend {
+		} else if messagePayload.Command == common.Resend || messagePayload.Command == common.Verify {
 			destType = messagePayload.Destination.DestType
 			destID = messagePayload.Destination.DestID
 			destOrgID = messagePayload.Destination.DestOrgID
@@ -223,9 +251,16 @@ func processMessage(messageInfo *messageHandlerInfo) {
 	case common.Register:
 		err = handleRegistration(messagePayload.Destination, messagePayload.PersistentStorage)
 	case common.AckRegister:
+		setCSSMessageVersion(messagePayload.Version)
+		setCSSCompressionAlgorithms(messagePayload.CompressionAlgorithms)
+		setCSSDataTopics(messagePayload.DataTopics)
 		handleRegAck()
+	case common.RegisterDenied:
+		handleRegDenied(messagePayload.Reason)
 	case common.Ping:
 		err = handlePing(messagePayload.Destination)
+	case common.Heartbeat:
+		err = handleHeartbeat(messagePayload.Destination)
 	case common.RegisterNew:
 		if err = context.communicator.storeMessagingGroup(context.client, messagePayload.Destination.DestOrgID); err == nil {
 			err = handleRegisterNew(messagePayload.Destination, messagePayload.PersistentStorage)
@@ -233,8 +268,9 @@ func processMessage(messageInfo *messageHandlerInfo) {
 	case common.RegisterAsNew:
 		err = handleRegisterAsNew()
 	case common.Update:
-		if int64(meta.ChunkSize) < meta.ObjectSize && !leader.CheckIfLeader() {
-			err = &Error{"Non-leader received update message with chunked data, ignoring."}
+		if int64(meta.ChunkSize) < meta.ObjectSize && !leader.CheckIfOwner(meta.DestOrgID, meta.ObjectType, meta.ObjectID) {
+			err = leader.NotOwnerError(fmt.Sprintf("This CSS instance doesn't own %s:%s:%s, only its owner can receive its chunked data.",
+				meta.DestOrgID, meta.ObjectType, meta.ObjectID), meta.DestOrgID, meta.ObjectType, meta.ObjectID)
 		} else {
 			err = handleUpdate(*meta, common.Configuration.MaxInflightChunks)
 			if err != nil && !isIgnoredByHandler(err) {
@@ -245,6 +281,9 @@ func processMessage(messageInfo *messageHandlerInfo) {
 		err = handleObjectUpdated(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.DestType, meta.DestID, meta.InstanceID, meta.DataID)
 	case common.Consumed:
 		err = handleObjectConsumed(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.DestType, meta.DestID, meta.InstanceID, meta.DataID)
+	case common.PartiallyConsumed:
+		err = handleObjectPartiallyConsumed(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.DestType, meta.DestID, meta.InstanceID,
+			meta.DataID, messagePayload.Offset)
 	case common.AckConsumed:
 		err = handleAckConsumed(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.OriginType, meta.OriginID, meta.InstanceID, meta.DataID)
 	case common.Received:
@@ -260,19 +299,26 @@ func processMessage(messageInfo *messageHandlerInfo) {
 	case common.AckDeleted:
 		err = handleAckObjectDeleted(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.OriginType, meta.OriginID, meta.InstanceID)
 	case common.Getdata:
-		err = handleGetData(messagePayload.Meta, messagePayload.Offset)
+		err = handleGetData(messagePayload.Meta, messagePayload.Offset, messagePayload.Count)
 		if err != nil && (isIgnoredByHandler(err) || common.IsNotFound(err)) {
 			context.communicator.SendErrorMessage(&common.NotFound{}, &messagePayload.Meta, false)
 		}
 	case common.Data:
 		meta, err = handleData(payload)
-		if meta != nil && err != nil && !isIgnoredByHandler(err) {
+		// A chunk that a replica can't handle is requested again by the object's owner
+		if meta != nil && err != nil && !isIgnoredByHandler(err) && !common.IsNotLeader(err) {
 			context.communicator.SendErrorMessage(err, meta, true)
 		}
 	case common.Resend:
 		err = handleResendRequest(messagePayload.Destination)
 	case common.AckResend:
 		err = handleAckResend()
+	case common.Verify:
+		err = handleVerifyRequest(messagePayload.Destination, messagePayload.Manifest, messagePayload.Resend)
+	case common.AckBatch:
+		err = handleAckBatch(meta.DestOrgID, messagePayload.Acks)
+	case common.Cancel:
+		err = handleCancelTransfer(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.DestType, meta.DestID, meta.InstanceID)
 	case common.Feedback:
 		destType := meta.DestType
 		destID := meta.DestID
@@ -286,7 +332,13 @@ func processMessage(messageInfo *messageHandlerInfo) {
 		err = &Error{"Received message that doesn't match any subscription."}
 	}
 
-	if err != nil && !isIgnoredByHandler(err) {
+	if common.IsNotLeader(err) || IsCircuitOpen(err) {
+		// Another CSS instance, the leader or the object's owner, handles the message,
+		// or the reply is sent when the other side's notification is resent after it recovers
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug(err.Error())
+		}
+	} else if err != nil && !isIgnoredByHandler(err) {
 		if log.IsLogging(logger.ERROR) {
 			log.Error(err.Error())
 		}
@@ -366,26 +418,21 @@ func (communication *MQTT) getClient(orgID string) (mqtt.Client, common.SyncServ
 	return clientInfo.client, nil
 }
 
-func newTLSConfig() *tls.Config {
+// newTLSConfig loads the TLS configuration of the connections to the MQTT broker.
+// If a certificate or the key fails to load, the error is returned along with the configuration without them.
+func newTLSConfig() (*tls.Config, common.SyncServiceError) {
 	tlsConfig := tls.Config{}
+	var loadError common.SyncServiceError
 
 	if common.Configuration.MQTTCACertificate != "" {
 		certpool := x509.NewCertPool()
-		var caCert string
-		if strings.HasPrefix(common.Configuration.MQTTCACertificate, "/") {
-			caCert = common.Configuration.MQTTCACertificate
-		} else {
-			caCert = common.Configuration.PersistenceRootPath + common.Configuration.MQTTCACertificate
-		}
-		pemCerts, err := ioutil.ReadFile(caCert)
+		pemCerts, err := ioutil.ReadFile(tlsFilePath(common.Configuration.MQTTCACertificate))
 		if err != nil {
 			if _, ok := err.(*os.PathError); ok {
 				pemCerts = []byte(common.Configuration.MQTTCACertificate)
 				err = nil
 			} else {
-				if log.IsLogging(logger.ERROR) {
-					log.Error(err.Error())
-				}
+				loadError = err
 			}
 		}
 		if err == nil {
@@ -395,28 +442,15 @@ func newTLSConfig() *tls.Config {
 	}
 
 	if common.Configuration.MQTTSSLCert != "" && common.Configuration.MQTTSSLKey != "" {
-		var cert, key string
-		if strings.HasPrefix(common.Configuration.MQTTSSLCert, "/") {
-			cert = common.Configuration.MQTTSSLCert
-		} else {
-			cert = common.Configuration.PersistenceRootPath + common.Configuration.MQTTSSLCert
-		}
-		if strings.HasPrefix(common.Configuration.MQTTSSLKey, "/") {
-			key = common.Configuration.MQTTSSLKey
-		} else {
-			key = common.Configuration.PersistenceRootPath + common.Configuration.MQTTSSLKey
-		}
-
-		clientCert, err := tls.LoadX509KeyPair(cert, key)
+		clientCert, err := tls.LoadX509KeyPair(tlsFilePath(common.Configuration.MQTTSSLCert),
+			tlsFilePath(common.Configuration.MQTTSSLKey))
 		if err != nil {
 			if _, ok := err.(*os.PathError); ok {
 				// The ServerCertificate and ServerKey are likely pem file contents
 				clientCert, err = tls.X509KeyPair([]byte(common.Configuration.MQTTSSLCert), []byte(common.Configuration.MQTTSSLKey))
 			}
 			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error(err.Error())
-				}
+				loadError = err
 			}
 		}
 
@@ -430,7 +464,7 @@ func newTLSConfig() *tls.Config {
 		tlsConfig.InsecureSkipVerify = true
 	}
 
-	return &tlsConfig
+	return &tlsConfig, loadError
 }
 
 func (communication *MQTT) createClients() ([]clientInfo, common.SyncServiceError) {
@@ -442,7 +476,8 @@ func (communication *MQTT) createClients() ([]clientInfo, common.SyncServiceErro
 	// mqtt.CRITICAL = debugLogger
 
 	communication.topics = make(map[string]byte, 0)
-	qos := byte(0)
+	// Subscribe with the highest QoS, so that messages are delivered with the QoS they were published with
+	qos := byte(2)
 
 	if common.Configuration.NodeType == common.ESS {
 		if common.Configuration.CSSOnWIoTP {
@@ -473,11 +508,22 @@ func (communication *MQTT) createClients() ([]clientInfo, common.SyncServiceErro
 			communication.publishMessage = communication.publishCSSOutsideWIoTP
 		}
 
-		if communication.isLeader {
-			communication.topics[communication.leaderTopic] = qos
+		// The chunked data is received on the leader topic, and on its stripes when it is striped across several topics
+		communication.leaderDataTopics = dataStripeTopics(communication.leaderTopic, "sync-cmd-leader")
+
+		// When the ownership of the objects is sharded, every CSS instance receives the chunked data of the objects it owns
+		if communication.isLeader || leader.IsOwnershipSharded() {
+			for _, topic := range communication.leaderDataTopics {
+				communication.topics[topic] = qos
+			}
 		}
 	}
 	communication.topics[communication.topic] = qos
+	if common.Configuration.NodeType == common.ESS {
+		for _, topic := range dataStripeTopics(communication.topic, "sync-cmd") {
+			communication.topics[topic] = qos
+		}
+	}
 
 	clients := make([]clientInfo, 0)
 	usernames := make([]string, 0)
@@ -598,7 +644,7 @@ func (context *mqttClientContext) createAndConnectClient(clientInfo clientInfo,
 	opts.Password = password
 
 	if common.Configuration.MQTTUseSSL {
-		opts.SetTLSConfig(newTLSConfig())
+		opts.SetTLSConfig(context.communicator.tlsConfig.clientConfig())
 	}
 	for _, serverURI := range servers {
 		if trace.IsLogging(logger.TRACE) {
@@ -741,11 +787,27 @@ func (context *mqttClientContext) onReconnect(client mqtt.Client) {
 	}
 }
 
-func publish(client mqtt.Client, topic string, payload []byte) common.SyncServiceError {
+// publish publishes the payload on the topic. If done is not nil, it is called when the client no longer uses the payload,
+// which may be after publish returns if the publish didn't complete in time.
+func publish(client mqtt.Client, topic string, payload []byte, qos byte, done func()) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Publishing on topic: %s\n", topic)
 	}
-	if token := client.Publish(topic, 0, false, payload); token.WaitTimeout(time.Duration(10*time.Second)) && token.Error() != nil {
+	token := client.Publish(topic, qos, false, payload)
+	if !token.WaitTimeout(time.Duration(10 * time.Second)) {
+		if done != nil {
+			// The client keeps the payload until the publish completes, e.g., to resend it after a reconnection
+			go func() {
+				token.Wait()
+				done()
+			}()
+		}
+		return nil
+	}
+	if done != nil {
+		done()
+	}
+	if token.Error() != nil {
 		common.HealthStatus.PublishFailed()
 		message := fmt.Sprintf("Failed to publish on topic %s. Error: ", topic)
 		return &Error{message + token.Error().Error()}
@@ -753,6 +815,53 @@ func publish(client mqtt.Client, topic string, payload []byte) common.SyncServic
 	return nil
 }
 
+// objectQoS returns the QoS of the messages of the object, the QoS of the object's meta data if it is set,
+// and MQTTQoS otherwise
+func objectQoS(metaData *common.MetaData) byte {
+	if metaData != nil && metaData.QoS != nil {
+		return byte(*metaData.QoS)
+	}
+	return byte(common.Configuration.MQTTQoS)
+}
+
+// Compressed notification messages are gzip streams, they are told apart from JSON messages by the gzip header
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressNotificationMessage compresses the serialized notification message if it isn't smaller than
+// MQTTNotificationCompressionThreshold and the other side, that uses the specified message version, supports compressed notifications.
+// The message is sent uncompressed if compressing it doesn't make it smaller.
+func compressNotificationMessage(messageJSON []byte, version common.SyncServiceVersion) []byte {
+	threshold := common.Configuration.MQTTNotificationCompressionThreshold
+	if threshold == 0 || len(messageJSON) < threshold || version.Less(common.CompressedNotificationsVersion) {
+		return messageJSON
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(messageJSON); err != nil {
+		return messageJSON
+	}
+	if err := writer.Close(); err != nil {
+		return messageJSON
+	}
+	if compressed.Len() >= len(messageJSON) {
+		return messageJSON
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Compressed notification message from %d to %d bytes\n", len(messageJSON), compressed.Len())
+	}
+	return compressed.Bytes()
+}
+
+func decompressNotificationMessage(payload []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
 func subscribe(client mqtt.Client, topics map[string]byte) common.SyncServiceError {
 	if topics == nil {
 		return &Error{"Failed to subscribe: no topics provided"}
@@ -795,6 +904,15 @@ func (communication *MQTT) StartCommunication() common.SyncServiceError {
 		}
 	}
 
+	if common.Configuration.MQTTUseSSL {
+		setTLSLoadTime(time.Now())
+		tlsConfig, err := newTLSConfig()
+		if err != nil && log.IsLogging(logger.ERROR) {
+			log.Error(err.Error())
+		}
+		communication.tlsConfig = newReloadableTLSConfig(tlsConfig)
+	}
+
 	communication.isLeader = leader.CheckIfLeader()
 	clients, err := communication.createClients()
 	if err != nil {
@@ -847,13 +965,31 @@ func (communication *MQTT) StopCommunication() common.SyncServiceError {
 	return nil
 }
 
+// ReloadTLS reloads the TLS certificates and key used to connect to the MQTT broker, and applies them to the
+// connections established afterward. If they fail to load, the previous ones remain in use.
+func (communication *MQTT) ReloadTLS() common.SyncServiceError {
+	if communication.tlsConfig == nil {
+		return nil
+	}
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return &Error{"Failed to reload the TLS configuration of the MQTT broker connections. Error: " + err.Error()}
+	}
+	communication.tlsConfig.store(tlsConfig)
+	if log.IsLogging(logger.INFO) {
+		log.Info("Reloaded the TLS configuration of the MQTT broker connections\n")
+	}
+	return nil
+}
+
 // Publish messages from the ESS to the CSS on the WIoTP through the Edge Connector
-func (communication *MQTT) publishESSOnWIoTPEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) publishESSOnWIoTPEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError {
 	client := communication.clients[0].client
 	topicType := "sync-cmd"
 	if chunked {
 		topicType = "sync-cmd-leader"
 	}
+	topicType = dataTopicType(topicType, stripe)
 
 	// "$IBUS-1/src/SYNC/dst/CC_DNS/type/app/topic/iotintdev-1/type/" +
 	// 	common.Configuration.DestinationType + "/id/" + common.Configuration.DestinationID + "/sync/" + topicType
@@ -867,16 +1003,17 @@ func (communication *MQTT) publishESSOnWIoTPEC(orgID string, destType string, de
 	strBuilder.WriteString(topicType)
 	topic := strBuilder.String()
 
-	return publish(client, topic, dataJSON)
+	return publish(client, topic, dataJSON, qos, done)
 }
 
 // Publish messages from the ESS to the CSS on the WIoTP not through the Edge Connector
-func (communication *MQTT) publishESSOnWIoTPNotEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) publishESSOnWIoTPNotEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError {
 	client := communication.clients[0].client
 	topicType := "sync-cmd"
 	if chunked {
 		topicType = "sync-cmd-leader"
 	}
+	topicType = dataTopicType(topicType, stripe)
 
 	// "iotintdev-1/type/" + common.Configuration.DestinationType + "/id/" + common.Configuration.DestinationID + "/sync/" + topicType
 	var strBuilder strings.Builder
@@ -889,16 +1026,17 @@ func (communication *MQTT) publishESSOnWIoTPNotEC(orgID string, destType string,
 	strBuilder.WriteString(topicType)
 	topic := strBuilder.String()
 
-	return publish(client, topic, dataJSON)
+	return publish(client, topic, dataJSON, qos, done)
 }
 
 // Publish messages from the ESS to the CSS outside the WIoTP through the Edge Connector
-func (communication *MQTT) publishESSOutsideWIoTPEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) publishESSOutsideWIoTPEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError {
 	client := communication.clients[0].client
 	topicType := "sync-cmd"
 	if chunked {
 		topicType = "sync-cmd-leader"
 	}
+	topicType = dataTopicType(topicType, stripe)
 
 	// "$IBUS-1/src/SYNC/dst/CC_DNS/type/app/topic/iot-2/type/" + common.Configuration.DestinationType +
 	//	"/id/" + common.Configuration.DestinationID + "/evt/" + topicType + "/fmt/bin"
@@ -913,16 +1051,17 @@ func (communication *MQTT) publishESSOutsideWIoTPEC(orgID string, destType strin
 	strBuilder.WriteString("/fmt/bin")
 	topic := strBuilder.String()
 
-	return publish(client, topic, dataJSON)
+	return publish(client, topic, dataJSON, qos, done)
 }
 
 // Publish messages from the ESS to the CSS otside the WIoTP not through the Edge Connector
-func (communication *MQTT) publishESSOutsideWIoTPNotEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) publishESSOutsideWIoTPNotEC(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError {
 	client := communication.clients[0].client
 	topicType := "sync-cmd"
 	if chunked {
 		topicType = "sync-cmd-leader"
 	}
+	topicType = dataTopicType(topicType, stripe)
 
 	// "iot-2/type/" + common.Configuration.DestinationType + "/id/" + common.Configuration.DestinationID + "/evt/" + topicType + "/fmt/bin"
 	var strBuilder strings.Builder
@@ -936,11 +1075,11 @@ func (communication *MQTT) publishESSOutsideWIoTPNotEC(orgID string, destType st
 	strBuilder.WriteString("/fmt/bin")
 	topic := strBuilder.String()
 
-	return publish(client, topic, dataJSON)
+	return publish(client, topic, dataJSON, qos, done)
 }
 
 // Publish messages from the CSS on the WIoTP to the ESS
-func (communication *MQTT) publishCSSOnWIoTP(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) publishCSSOnWIoTP(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError {
 	client, err := communication.getClient(orgID)
 	if err != nil {
 		return err
@@ -957,7 +1096,7 @@ func (communication *MQTT) publishCSSOnWIoTP(orgID string, destType string, dest
 		return nil
 	}
 
-	// "iotint-1/" + orgID + "/type/" + destType + "/id/" + destID + "/sync/sync-cmd"
+	// "iotint-1/" + orgID + "/type/" + destType + "/id/" + destID + "/sync/" + topicType
 	var strBuilder strings.Builder
 	strBuilder.Grow(len(orgID) + len(destType) + len(destID) + 40)
 	strBuilder.WriteString("iotint-1/")
@@ -966,14 +1105,15 @@ func (communication *MQTT) publishCSSOnWIoTP(orgID string, destType string, dest
 	strBuilder.WriteString(destType)
 	strBuilder.WriteString("/id/")
 	strBuilder.WriteString(destID)
-	strBuilder.WriteString("/sync/sync-cmd")
+	strBuilder.WriteString("/sync/")
+	strBuilder.WriteString(dataTopicType("sync-cmd", stripe))
 	topic := strBuilder.String()
 
-	return publish(client, topic, dataJSON)
+	return publish(client, topic, dataJSON, qos, done)
 }
 
 // Publish messages from the CSS outside the WIoTP to the ESS
-func (communication *MQTT) publishCSSOutsideWIoTP(orgID string, destType string, destID string, dataJSON []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) publishCSSOutsideWIoTP(orgID string, destType string, destID string, dataJSON []byte, chunked bool, stripe int, qos byte, done func()) common.SyncServiceError {
 	client, err := communication.getClient(orgID)
 	if err != nil {
 		return err
@@ -990,23 +1130,26 @@ func (communication *MQTT) publishCSSOutsideWIoTP(orgID string, destType string,
 		return nil
 	}
 
-	// "iot-2/type/" + destType + "/id/" + destID + "/cmd/sync-cmd/fmt/bin"
+	// "iot-2/type/" + destType + "/id/" + destID + "/cmd/" + topicType + "/fmt/bin"
 	var strBuilder strings.Builder
 	strBuilder.Grow(len(destType) + len(destID) + 40)
 	strBuilder.WriteString("iot-2/type/")
 	strBuilder.WriteString(destType)
 	strBuilder.WriteString("/id/")
 	strBuilder.WriteString(destID)
-	strBuilder.WriteString("/cmd/sync-cmd/fmt/bin")
+	strBuilder.WriteString("/cmd/")
+	strBuilder.WriteString(dataTopicType("sync-cmd", stripe))
+	strBuilder.WriteString("/fmt/bin")
 	topic := strBuilder.String()
 
-	return publish(client, topic, dataJSON)
+	return publish(client, topic, dataJSON, qos, done)
 }
 
 // SendNotificationMessage sends a notification message from the CSS to the ESS or from the ESS to the CSS
 func (communication *MQTT) SendNotificationMessage(notificationTopic string, destType string, destID string, instanceID int64, dataID int64,
 	metaData *common.MetaData) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: notificationTopic, Meta: *metaData}
+	version := messageVersionForDestination(metaData.DestOrgID, destType, destID)
+	messagePayload := &messagePayload{Version: version, Command: notificationTopic, Meta: *metaData}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{"Failed to send notification. Error: " + err.Error()}
@@ -1014,16 +1157,24 @@ func (communication *MQTT) SendNotificationMessage(notificationTopic string, des
 	if log.IsLogging(logger.TRACE) {
 		log.Trace("Sending %s notification", notificationTopic)
 	}
+	messageJSON = compressNotificationMessage(messageJSON, version)
 	chunked := false
 	if notificationTopic == common.Update && metaData.ObjectSize > int64(metaData.ChunkSize) {
 		chunked = true
 	}
-	return communication.publishMessage(metaData.DestOrgID, destType, destID, messageJSON, chunked)
+	return communication.publishMessage(metaData.DestOrgID, destType, destID, messageJSON, chunked, 0, objectQoS(metaData), nil)
 }
 
 // SendFeedbackMessage sends a feedback message from the ESS to the CSS or from the CSS to the ESS
 func (communication *MQTT) SendFeedbackMessage(code int, retryInterval int32, reason string, metaData *common.MetaData, sendToOrigin bool) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: common.Feedback, Meta: *metaData, FeedbackCode: code,
+	destType := metaData.DestType
+	destID := metaData.DestID
+	if sendToOrigin {
+		destType = metaData.OriginType
+		destID = metaData.OriginID
+	}
+	messagePayload := &messagePayload{Version: messageVersionForDestination(metaData.DestOrgID, destType, destID),
+		Command: common.Feedback, Meta: *metaData, FeedbackCode: code,
 		FeedbackFromOrigin: !sendToOrigin, RetryInterval: retryInterval, Reason: reason}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
@@ -1033,14 +1184,7 @@ func (communication *MQTT) SendFeedbackMessage(code int, retryInterval int32, re
 	if log.IsLogging(logger.TRACE) {
 		log.Trace("Sending feedback notification")
 	}
-
-	destType := metaData.DestType
-	destID := metaData.DestID
-	if sendToOrigin {
-		destType = metaData.OriginType
-		destID = metaData.OriginID
-	}
-	return communication.publishMessage(metaData.DestOrgID, destType, destID, messageJSON, false)
+	return communication.publishMessage(metaData.DestOrgID, destType, destID, messageJSON, false, 0, objectQoS(metaData), nil)
 }
 
 // SendErrorMessage sends an error message from the ESS to the CSS or from the CSS to the ESS
@@ -1049,15 +1193,34 @@ func (communication *MQTT) SendErrorMessage(err common.SyncServiceError, metaDat
 	return communication.SendFeedbackMessage(code, retryInterval, reason, metaData, sendToOrigin)
 }
 
+// SendPartiallyConsumed notifies the object's origin that the data of the object was consumed up to offset
+func (communication *MQTT) SendPartiallyConsumed(metaData *common.MetaData, offset int64) common.SyncServiceError {
+	messagePayload := &messagePayload{Version: messageVersionForDestination(metaData.DestOrgID, metaData.OriginType, metaData.OriginID),
+		Command: common.PartiallyConsumed, Meta: *metaData, Offset: offset}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{"Failed to send notification. Error: " + err.Error()}
+	}
+
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending partially consumed notification")
+	}
+	return communication.publishMessage(metaData.DestOrgID, metaData.OriginType, metaData.OriginID, messageJSON, false, 0, objectQoS(metaData), nil)
+}
+
 func (communication *MQTT) sendRegisterOrPing(command string) common.SyncServiceError {
 	if common.Configuration.NodeType != common.ESS {
 		return nil
 	}
+	// The attributes were validated with the configuration
+	attributes, _ := common.DestinationAttributes()
 	destination := common.Destination{
 		DestOrgID: common.Configuration.OrgID, DestType: common.Configuration.DestinationType, DestID: common.Configuration.DestinationID,
-		Communication: common.MQTTProtocol, CodeVersion: common.VersionAsString()}
-	messagePayload := &messagePayload{Version: common.Version, Command: command, Destination: destination,
-		PersistentStorage: Store.IsPersistent()}
+		Communication: common.MQTTProtocol, CodeVersion: common.VersionAsString(), MaxObjectVersion: common.Configuration.MaxObjectVersion,
+		AvailableSpace: reportedAvailableSpace(), CompressionAlgorithms: supportedCompressionAlgorithms(),
+		DataTopics: common.Configuration.MQTTDataTopics, Attributes: attributes}
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: command, Destination: destination, PersistentStorage: Store.IsPersistent()}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{fmt.Sprintf("Failed to %s. Error: %s", command, err.Error())}
@@ -1066,7 +1229,7 @@ func (communication *MQTT) sendRegisterOrPing(command string) common.SyncService
 		log.Trace("Sending %s", command)
 	}
 	return communication.publishMessage(common.Configuration.OrgID, common.Configuration.DestinationType, common.Configuration.DestinationID,
-		messageJSON, false)
+		messageJSON, false, 0, objectQoS(nil), nil)
 }
 
 // Register sends a registration message to be sent by an ESS  or from the CSS to the ESS
@@ -1083,7 +1246,8 @@ func (communication *MQTT) unregister(command string) common.SyncServiceError {
 }
 
 func (communication *MQTT) sendNotificationWithDestination(command string, destination common.Destination) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: command}
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: command}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{fmt.Sprintf("Failed to send %s. Error: %s", command, err.Error())}
@@ -1091,12 +1255,36 @@ func (communication *MQTT) sendNotificationWithDestination(command string, desti
 	if log.IsLogging(logger.TRACE) {
 		log.Trace("Sending %s", command)
 	}
-	return communication.publishMessage(destination.DestOrgID, destination.DestType, destination.DestID, messageJSON, false)
+	return communication.publishMessage(destination.DestOrgID, destination.DestType, destination.DestID, messageJSON, false, 0, objectQoS(nil), nil)
 }
 
-// RegisterAck sends a registration acknowledgement message from the CSS
+// RegisterAck sends a registration acknowledgement message from the CSS, with the compression algorithms that the CSS supports
+// and the number of topics across which it receives chunked data
 func (communication *MQTT) RegisterAck(destination common.Destination) common.SyncServiceError {
-	return communication.sendNotificationWithDestination(common.AckRegister, destination)
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: common.AckRegister, CompressionAlgorithms: supportedCompressionAlgorithms(), DataTopics: common.Configuration.MQTTDataTopics}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to send %s. Error: %s", common.AckRegister, err.Error())}
+	}
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending %s", common.AckRegister)
+	}
+	return communication.publishMessage(destination.DestOrgID, destination.DestType, destination.DestID, messageJSON, false, 0, objectQoS(nil), nil)
+}
+
+// RegisterDenied sends a message from the CSS to an ESS that its registration was denied, with the reason
+func (communication *MQTT) RegisterDenied(destination common.Destination, reason string) common.SyncServiceError {
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: common.RegisterDenied, Reason: reason}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to send %s. Error: %s", common.RegisterDenied, err.Error())}
+	}
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending %s", common.RegisterDenied)
+	}
+	return communication.publishMessage(destination.DestOrgID, destination.DestType, destination.DestID, messageJSON, false, 0, objectQoS(nil), nil)
 }
 
 // RegisterNew sends a new registration message to be sent by an ESS
@@ -1120,9 +1308,23 @@ func (communication *MQTT) SendPing() common.SyncServiceError {
 	return communication.sendRegisterOrPing(common.Ping)
 }
 
+// SendHeartbeat sends a heartbeat message from ESS to CSS
+func (communication *MQTT) SendHeartbeat() common.SyncServiceError {
+	return communication.sendRegisterOrPing(common.Heartbeat)
+}
+
 // GetData requests data to be sent from the CSS to the ESS or from the ESS to the CSS
 func (communication *MQTT) GetData(metaData common.MetaData, offset int64) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: common.Getdata, Meta: metaData, Offset: offset}
+	return communication.GetDataRange(metaData, offset, 1)
+}
+
+// GetDataRange requests count consecutive chunks, starting at offset, to be sent from the CSS to the ESS or from the ESS to the CSS
+func (communication *MQTT) GetDataRange(metaData common.MetaData, offset int64, count int) common.SyncServiceError {
+	messagePayload := &messagePayload{Version: messageVersionForDestination(metaData.DestOrgID, metaData.OriginType, metaData.OriginID),
+		Command: common.Getdata, Meta: metaData, Offset: offset}
+	if count > 1 {
+		messagePayload.Count = count
+	}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{"Failed to send get data notification. Error: " + err.Error()}
@@ -1131,19 +1333,24 @@ func (communication *MQTT) GetData(metaData common.MetaData, offset int64) commo
 		log.Trace("Sending getdata notification")
 	}
 	if err = communication.publishMessage(metaData.DestOrgID, metaData.OriginType, metaData.OriginID,
-		messageJSON, false); err != nil {
+		messageJSON, false, 0, objectQoS(&metaData), nil); err != nil {
 		return err
 	}
-	err = updateGetDataNotification(metaData, metaData.OriginType, metaData.OriginID, offset)
+	err = updateGetDataRangeNotification(metaData, metaData.OriginType, metaData.OriginID, offset, count)
 	return err
 }
 
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
-func (communication *MQTT) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
+func (communication *MQTT) SendData(metaData *common.MetaData, destType string, destID string, message []byte, chunked bool,
+	done func()) common.SyncServiceError {
 	if log.IsLogging(logger.TRACE) {
 		log.Trace("Sending data")
 	}
-	return communication.publishMessage(orgID, destType, destID, message, chunked)
+	stripe := 0
+	if chunked {
+		stripe = communication.nextDataStripe(metaData.DestOrgID, destType, destID)
+	}
+	return communication.publishMessage(metaData.DestOrgID, destType, destID, message, chunked, stripe, objectQoS(metaData), done)
 }
 
 // ResendObjects requests to resend all the relevant objects
@@ -1151,7 +1358,8 @@ func (communication *MQTT) ResendObjects() common.SyncServiceError {
 	destination := common.Destination{
 		DestOrgID: common.Configuration.OrgID, DestType: common.Configuration.DestinationType, DestID: common.Configuration.DestinationID,
 		Communication: common.MQTTProtocol}
-	messagePayload := &messagePayload{Version: common.Version, Command: common.Resend, Destination: destination}
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: common.Resend, Destination: destination}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{"Failed to send resend objects notification. Error: " + err.Error()}
@@ -1160,12 +1368,13 @@ func (communication *MQTT) ResendObjects() common.SyncServiceError {
 		log.Trace("Sending resend objects request")
 	}
 	return communication.publishMessage(common.Configuration.OrgID,
-		common.Configuration.DestinationType, common.Configuration.DestinationID, messageJSON, false)
+		common.Configuration.DestinationType, common.Configuration.DestinationID, messageJSON, false, 0, objectQoS(nil), nil)
 }
 
 // SendAckResendObjects sends ack to resend objects request
 func (communication *MQTT) SendAckResendObjects(destination common.Destination) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: common.AckResend, Destination: destination}
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: common.AckResend, Destination: destination}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{"Failed to send ack resend objects notification. Error: " + err.Error()}
@@ -1174,7 +1383,43 @@ func (communication *MQTT) SendAckResendObjects(destination common.Destination)
 		log.Trace("Sending ackresend")
 	}
 	return communication.publishMessage(common.Configuration.OrgID,
-		destination.DestType, destination.DestID, messageJSON, false)
+		destination.DestType, destination.DestID, messageJSON, false, 0, objectQoS(nil), nil)
+}
+
+// SendVerifyRequest sends the manifest of the objects of the ESS to the CSS, to verify them
+func (communication *MQTT) SendVerifyRequest(manifest []common.ManifestEntry, resend bool) common.SyncServiceError {
+	destination := common.Destination{
+		DestOrgID: common.Configuration.OrgID, DestType: common.Configuration.DestinationType, DestID: common.Configuration.DestinationID,
+		Communication: common.MQTTProtocol}
+	messagePayload := &messagePayload{Version: messageVersionForDestination(destination.DestOrgID, destination.DestType, destination.DestID),
+		Command: common.Verify, Destination: destination, Manifest: manifest, Resend: resend}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{"Failed to send verify objects notification. Error: " + err.Error()}
+	}
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending verify objects request")
+	}
+	return communication.publishMessage(common.Configuration.OrgID,
+		common.Configuration.DestinationType, common.Configuration.DestinationID, messageJSON, false, 0, objectQoS(nil), nil)
+}
+
+// SendAckBatch sends a batch of acks of received and consumed notifications to the destination
+func (communication *MQTT) SendAckBatch(orgID string, destType string, destID string, acks []common.AckEntry) common.SyncServiceError {
+	version := messageVersionForDestination(orgID, destType, destID)
+	messagePayload := &messagePayload{Version: version, Command: common.AckBatch,
+		Meta: common.MetaData{DestOrgID: orgID, DestType: destType, DestID: destID,
+			OriginType: common.Configuration.DestinationType, OriginID: common.Configuration.DestinationID},
+		Acks: acks}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{"Failed to send ack batch. Error: " + err.Error()}
+	}
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending batch of %d acks", len(acks))
+	}
+	messageJSON = compressNotificationMessage(messageJSON, version)
+	return communication.publishMessage(orgID, destType, destID, messageJSON, false, 0, objectQoS(nil), nil)
 }
 
 // ChangeLeadership changes the leader
@@ -1183,18 +1428,24 @@ func (nodeContext *mqttContext) changeLeadership(isLeader bool) common.SyncServi
 		return nil
 	}
 	communication := nodeContext.communicator
-	if !communication.isLeader && isLeader {
+	// When the ownership of the objects is sharded, the instance stays subscribed to chunked data messages
+	sharded := leader.IsOwnershipSharded()
+	if !communication.isLeader && isLeader && !sharded {
 		// Subscribe to chunked data messages
-		communication.topics[communication.leaderTopic] = 0
+		for _, topic := range communication.leaderDataTopics {
+			communication.topics[topic] = 0
+		}
 		for _, context := range nodeContext.contexts {
 			context.subscribe()
 		}
-	} else if communication.isLeader && !isLeader {
+	} else if communication.isLeader && !isLeader && !sharded {
 		// Unsubscribe
-		delete(communication.topics, communication.leaderTopic)
+		for _, topic := range communication.leaderDataTopics {
+			delete(communication.topics, topic)
+		}
 		for _, clientInfo := range communication.clients {
 			client := clientInfo.client
-			if token := client.Unsubscribe(communication.leaderTopic); token.WaitTimeout(time.Duration(10*time.Second)) && token.Error() != nil {
+			if token := client.Unsubscribe(communication.leaderDataTopics...); token.WaitTimeout(time.Duration(10*time.Second)) && token.Error() != nil {
 				if exists, _, _ := communication.checkIfOrgExists(client); !exists {
 					continue
 				}
@@ -0,0 +1,115 @@
+package communications
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestCompressNotificationMessage(t *testing.T) {
+	threshold := common.Configuration.MQTTNotificationCompressionThreshold
+	defer func() { common.Configuration.MQTTNotificationCompressionThreshold = threshold }()
+
+	metaData := common.MetaData{ObjectID: "compressed", ObjectType: "type1", DestOrgID: "someorg", DestType: "device",
+		Description: string(bytes.Repeat([]byte("description "), 100))}
+	messageJSON, err := json.Marshal(&messagePayload{Version: common.Version, Command: common.Update, Meta: metaData})
+	if err != nil {
+		t.Fatalf("Failed to marshal the notification. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		threshold  int
+		version    common.SyncServiceVersion
+		compressed bool
+	}{
+		{0, common.Version, false},
+		{len(messageJSON) + 1, common.Version, false},
+		{len(messageJSON), common.MinMessageVersion, false},
+		{len(messageJSON), common.CompressedNotificationsVersion, true},
+		{100, common.Version, true},
+	}
+	for _, test := range tests {
+		common.Configuration.MQTTNotificationCompressionThreshold = test.threshold
+		message := compressNotificationMessage(messageJSON, test.version)
+		if !test.compressed {
+			if !bytes.Equal(message, messageJSON) {
+				t.Errorf("The notification was compressed (threshold %d, version %v)", test.threshold, test.version)
+			}
+			continue
+		}
+		if !bytes.HasPrefix(message, gzipMagic) || len(message) >= len(messageJSON) {
+			t.Errorf("The notification wasn't compressed (threshold %d, version %v)", test.threshold, test.version)
+			continue
+		}
+		decompressed, err := decompressNotificationMessage(message)
+		if err != nil {
+			t.Errorf("Failed to decompress the notification. Error: %s", err.Error())
+		} else if !bytes.Equal(decompressed, messageJSON) {
+			t.Errorf("The decompressed notification is different from the original one")
+		}
+	}
+
+	if _, err := decompressNotificationMessage(append(append([]byte{}, gzipMagic...), '{')); err == nil {
+		t.Errorf("Decompressed a corrupted notification")
+	}
+}
+
+func TestDataStripeTopics(t *testing.T) {
+	dataTopics := common.Configuration.MQTTDataTopics
+	nodeType := common.Configuration.NodeType
+	defer func() {
+		common.Configuration.MQTTDataTopics = dataTopics
+		common.Configuration.NodeType = nodeType
+		setCSSDataTopics(0)
+	}()
+
+	common.Configuration.MQTTDataTopics = 3
+	topics := dataStripeTopics("iot-2/type/+/id/+/evt/sync-cmd-leader/fmt/bin", "sync-cmd-leader")
+	expected := []string{"iot-2/type/+/id/+/evt/sync-cmd-leader/fmt/bin", "iot-2/type/+/id/+/evt/sync-cmd-leader-1/fmt/bin",
+		"iot-2/type/+/id/+/evt/sync-cmd-leader-2/fmt/bin"}
+	if len(topics) != len(expected) {
+		t.Fatalf("Wrong number of stripe topics: %v", topics)
+	}
+	for i, topic := range topics {
+		if topic != expected[i] {
+			t.Errorf("Stripe %d: topic %s instead of %s", i, topic, expected[i])
+		}
+	}
+	topics = dataStripeTopics("iotint-1/myorg/type/device/id/dev1/sync/sync-cmd", "sync-cmd")
+	if len(topics) != 3 || topics[2] != "iotint-1/myorg/type/device/id/dev1/sync/sync-cmd-2" {
+		t.Errorf("Wrong stripe topics: %v", topics)
+	}
+
+	common.Configuration.NodeType = common.ESS
+	communication := &MQTT{}
+	tests := []struct {
+		dataTopics    int
+		cssDataTopics int
+		expected      int
+	}{
+		{3, 0, 1}, // The CSS didn't report its data topics
+		{3, 2, 2},
+		{3, 5, 3},
+		{1, 5, 1},
+	}
+	for i, test := range tests {
+		common.Configuration.MQTTDataTopics = test.dataTopics
+		setCSSDataTopics(test.cssDataTopics)
+		if dataTopics := dataTopicsForDestination("myorg", "device", "dev1"); dataTopics != test.expected {
+			t.Errorf("Test %d: %d data topics instead of %d", i, dataTopics, test.expected)
+		}
+		stripes := make(map[int]bool)
+		for j := 0; j < 2*test.expected; j++ {
+			stripe := communication.nextDataStripe("myorg", "device", "dev1")
+			if stripe < 0 || stripe >= test.expected {
+				t.Errorf("Test %d: stripe %d out of range", i, stripe)
+			}
+			stripes[stripe] = true
+		}
+		if len(stripes) != test.expected {
+			t.Errorf("Test %d: the chunks were sent on %d stripes instead of %d", i, len(stripes), test.expected)
+		}
+	}
+}
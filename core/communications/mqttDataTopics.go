@@ -0,0 +1,87 @@
+package communications
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// The chunks of the data of objects can be striped across several MQTT topics, so that the broker can deliver them
+// in parallel. Stripe 0 is the topic that carries the chunks when they aren't striped (sync-cmd from the CSS,
+// sync-cmd-leader from the ESS), and stripe i is that topic with the suffix -i. Each side subscribes to the stripes
+// of the number of topics set in MQTTDataTopics, and reports it when registering (the ESS) or acking the
+// registration (the CSS). The sender stripes the chunks round robin across the smaller of the two numbers.
+// The receiver handles a chunk by its offset, regardless of the topic it arrived on, so tracking the chunks in flight,
+// requesting missing chunks, and resending chunks work the same way with a single topic and with several topics.
+
+// ESS: the number of topics across which the CSS that acknowledged the registration receives chunked data
+var cssDataTopics int
+var cssDataTopicsLock sync.RWMutex
+
+// ESS: keep the number of data topics reported by the CSS that acknowledged the registration
+func setCSSDataTopics(dataTopics int) {
+	cssDataTopicsLock.Lock()
+	cssDataTopics = dataTopics
+	cssDataTopicsLock.Unlock()
+}
+
+// dataTopicsForDestination returns the number of topics across which the chunked data sent to the destination is striped
+func dataTopicsForDestination(orgID string, destType string, destID string) int {
+	dataTopics := common.Configuration.MQTTDataTopics
+	if dataTopics <= 1 {
+		return 1
+	}
+
+	peerDataTopics := 0
+	if common.Configuration.NodeType == common.ESS {
+		cssDataTopicsLock.RLock()
+		peerDataTopics = cssDataTopics
+		cssDataTopicsLock.RUnlock()
+	} else if dest, err := Store.RetrieveDestination(orgID, destType, destID); err == nil && dest != nil {
+		peerDataTopics = dest.DataTopics
+	}
+
+	// A peer that didn't report the number of its data topics only receives chunked data on a single topic
+	if peerDataTopics < dataTopics {
+		dataTopics = peerDataTopics
+	}
+	if dataTopics < 1 {
+		return 1
+	}
+	return dataTopics
+}
+
+// nextDataStripe returns the stripe of the next chunk of data sent to the destination
+func (communication *MQTT) nextDataStripe(orgID string, destType string, destID string) int {
+	dataTopics := dataTopicsForDestination(orgID, destType, destID)
+	if dataTopics == 1 {
+		return 0
+	}
+	return int(atomic.AddUint32(&communication.dataStripe, 1) % uint32(dataTopics))
+}
+
+// dataTopicType returns the type of the topic of the stripe
+func dataTopicType(topicType string, stripe int) string {
+	if stripe == 0 {
+		return topicType
+	}
+	return topicType + "-" + strconv.Itoa(stripe)
+}
+
+// dataStripeTopics returns the topics of all the stripes of the topic, the topic itself first
+func dataStripeTopics(topic string, topicType string) []string {
+	topics := []string{topic}
+	index := strings.LastIndex(topic, "/"+topicType)
+	if index < 0 {
+		return topics
+	}
+	prefix := topic[:index+1]
+	suffix := topic[index+1+len(topicType):]
+	for stripe := 1; stripe < common.Configuration.MQTTDataTopics; stripe++ {
+		topics = append(topics, prefix+dataTopicType(topicType, stripe)+suffix)
+	}
+	return topics
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/leader"
+	"github.com/open-horizon/edge-sync-service/core/storage"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -21,9 +25,50 @@ func (e *invalidNotification) Error() string {
 	return e.message
 }
 
+// fanoutLimiter paces the notifications sent when the objects of a destination are resent.
+// It is shared by all the destinations, and hands out send slots in the order they were requested.
+type fanoutLimiter struct {
+	lock     sync.Mutex
+	nextSlot time.Time
+	waiting  int32
+}
+
+var notificationFanoutLimiter fanoutLimiter
+
+// wait blocks until the caller may send the next notification, according to common.Configuration.NotificationFanoutRate
+func (limiter *fanoutLimiter) wait() {
+	if common.Configuration.NotificationFanoutRate <= 0 {
+		return
+	}
+	interval := time.Second / time.Duration(common.Configuration.NotificationFanoutRate)
+
+	limiter.lock.Lock()
+	now := time.Now()
+	if limiter.nextSlot.Before(now) {
+		limiter.nextSlot = now
+	}
+	slot := limiter.nextSlot
+	limiter.nextSlot = slot.Add(interval)
+	limiter.lock.Unlock()
+
+	if delay := slot.Sub(now); delay > 0 {
+		atomic.AddInt32(&limiter.waiting, 1)
+		time.Sleep(delay)
+		atomic.AddInt32(&limiter.waiting, -1)
+	}
+}
+
+// NotificationQueueDepth returns the number of notifications waiting to be sent because of the notification fan-out limit
+func NotificationQueueDepth() int {
+	return int(atomic.LoadInt32(&notificationFanoutLimiter.waiting))
+}
+
 // PrepareObjectNotifications sends notifications to object’s destinations
 // This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
 func PrepareObjectNotifications(metaData common.MetaData) ([]common.NotificationInfo, common.SyncServiceError) {
+	if err := expandDestinationGroup(metaData); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to expand the destination group %s. Error: %s", metaData.DestGroup, err.Error())
+	}
 	destinations, err := Store.GetObjectDestinations(metaData)
 	if err == nil {
 		err = Store.UpdateObjectDelivering(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
@@ -35,6 +80,54 @@ func PrepareObjectNotifications(metaData common.MetaData) ([]common.Notification
 	return nil, nil
 }
 
+// expandDestinationGroup sets the destinations of an object sent to a destination group to the current members of the group.
+// The delivery status of destinations that remain members of the group is kept.
+func expandDestinationGroup(metaData common.MetaData) common.SyncServiceError {
+	if common.Configuration.NodeType != common.CSS || metaData.DestGroup == "" {
+		return nil
+	}
+
+	members, err := Store.RetrieveGroupMembers(metaData.DestOrgID, metaData.DestGroup)
+	if err != nil {
+		return err
+	}
+	destinationsList := make([]string, 0, len(members))
+	for _, member := range members {
+		if common.MatchDestinationAttributes(metaData.DestinationAttributes, member.Attributes) {
+			destinationsList = append(destinationsList, member.DestType+":"+member.DestID)
+		}
+	}
+	_, _, _, _, err = Store.UpdateObjectDestinations(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destinationsList)
+	return err
+}
+
+// SendGroupObjects sends the objects of the destination group to a destination that joined the group
+func SendGroupObjects(dest common.Destination, group string) common.SyncServiceError {
+	objects, err := Store.RetrieveObjects(dest.DestOrgID, dest.DestType, dest.DestID, common.ResendUndelivered)
+	if err != nil {
+		return err
+	}
+
+	destinations := []common.Destination{dest}
+	for _, metaData := range objects {
+		if metaData.DestGroup != group {
+			continue
+		}
+		notificationFanoutLimiter.wait()
+		lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			return err
+		}
+		if err := SendNotifications(notificationsInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // PrepareDeleteNotifications prepares the delete notification message
 // This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
 func PrepareDeleteNotifications(metaData common.MetaData) ([]common.NotificationInfo, common.SyncServiceError) {
@@ -65,12 +158,25 @@ func prepareNotifications(topic string, metaData common.MetaData, destinations [
 
 	// Create an initial notification record for each destination
 	for _, destination := range destinations {
+		if topic == common.Update {
+			if reason := unsupportedObjectVersion(metaData, destination); reason != "" {
+				skipUnsupportedObject(metaData, destination, reason)
+				continue
+			}
+		}
+
+		sequence, err := orderSequence(topic, metaData, destination.DestType, destination.DestID)
+		if err != nil {
+			return nil, err
+		}
+
 		notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 			DestOrgID: metaData.DestOrgID, DestID: destination.DestID, DestType: destination.DestType,
-			Status: topic, InstanceID: metaData.InstanceID, DataID: metaData.DataID}
+			Status: topic, InstanceID: metaData.InstanceID, InstanceSequence: metaData.InstanceSequence, DataID: metaData.DataID,
+			OrderSequence: sequence}
 
 		// Store the notification records in storage as part of the object
-		if err := Store.UpdateNotificationRecord(notification); err != nil {
+		if err := updateNotificationRecord(notification); err != nil {
 			return nil, err
 		}
 
@@ -79,12 +185,91 @@ func prepareNotifications(topic string, metaData common.MetaData, destinations [
 		metaData.DestID = destination.DestID
 
 		notificationInfo := common.NotificationInfo{NotificationTopic: topic, DestType: metaData.DestType, DestID: metaData.DestID,
-			InstanceID: metaData.InstanceID, DataID: metaData.DataID, MetaData: &metaData}
+			InstanceID: metaData.InstanceID, DataID: metaData.DataID, OrderSequence: sequence, MetaData: &metaData}
 		result = append(result, notificationInfo)
 	}
 	return result, nil
 }
 
+// unsupportedObjectVersion returns why the destination can't use the object, or an empty string if it can.
+// Objects that require a version of objects' formats are sent only to destinations that reported supporting it
+// when they registered (for CSS).
+func unsupportedObjectVersion(metaData common.MetaData, destination common.Destination) string {
+	if metaData.RequiredVersion == "" || common.Configuration.NodeType != common.CSS {
+		return ""
+	}
+	required, err := common.ParseVersion(metaData.RequiredVersion)
+	if err != nil {
+		return fmt.Sprintf("The object requires an invalid version %s", metaData.RequiredVersion)
+	}
+
+	// The destination's capabilities are taken from its last registration
+	if dest, err := Store.RetrieveDestination(metaData.DestOrgID, destination.DestType, destination.DestID); err == nil && dest != nil {
+		destination = *dest
+	}
+	if destination.MaxObjectVersion == "" {
+		return fmt.Sprintf("The object requires version %s, the destination didn't report the versions of objects it supports",
+			metaData.RequiredVersion)
+	}
+	supported, err := common.ParseVersion(destination.MaxObjectVersion)
+	if err != nil || supported.Less(required) {
+		return fmt.Sprintf("The object requires version %s, the destination supports versions up to %s", metaData.RequiredVersion,
+			destination.MaxObjectVersion)
+	}
+	return ""
+}
+
+// skipUnsupportedObject marks the delivery of an object to a destination that can't use it as failed
+func skipUnsupportedObject(metaData common.MetaData, destination common.Destination, reason string) {
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Not sending %s:%s:%s to %s %s. %s\n", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			destination.DestType, destination.DestID, reason)
+	}
+	if _, err := Store.UpdateObjectDeliveryStatus(common.Error, reason, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		destination.DestType, destination.DestID); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update object's delivery status. Error: %s\n", err)
+	}
+}
+
+// insufficientDestinationSpace returns why the object's data doesn't fit in the storage space that the destination
+// reported as available, or an empty string if it fits or the destination didn't report its available space (for CSS)
+func insufficientDestinationSpace(metaData *common.MetaData, destType string, destID string) string {
+	if common.Configuration.NodeType != common.CSS || metaData == nil || destType == "" || metaData.NoData || metaData.MetaOnly ||
+		metaData.Link != "" || metaData.ObjectSize <= 0 {
+		return ""
+	}
+	dest, err := Store.RetrieveDestination(metaData.DestOrgID, destType, destID)
+	if err != nil || dest == nil || dest.AvailableSpace == 0 || metaData.ObjectSize <= dest.AvailableSpace {
+		return ""
+	}
+	return fmt.Sprintf("Waiting for storage space on the destination, the object's data is %d bytes and the destination reported %d bytes available",
+		metaData.ObjectSize, dest.AvailableSpace)
+}
+
+// deferNotificationForSpace leaves the update notification of an object that doesn't fit in the destination's storage
+// pending, and sets the object's delivery status to the destination to pending with the reason. The notification is
+// resent by the periodic resend of notifications, and sent once the destination reports enough available space.
+func deferNotificationForSpace(metaData *common.MetaData, destType string, destID string, reason string) {
+	if _, err := Store.UpdateObjectDeliveryStatus(common.Pending, reason, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		destType, destID); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update object's delivery status. Error: %s\n", err)
+	}
+}
+
+// reportedAvailableSpace returns the storage space available for objects' data that the ESS reports to the CSS,
+// and zero if it is unknown
+func reportedAvailableSpace() int64 {
+	space, err := Store.AvailableSpace()
+	if err != nil || space < 0 {
+		return 0
+	}
+	if space == 0 {
+		// Zero means that the space isn't reported
+		return 1
+	}
+	return space
+}
+
 // PrepareUpdateNotification prepares the notification message from object's meta data
 // This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
 func PrepareUpdateNotification(metaData common.MetaData, destinations []common.Destination) ([]common.NotificationInfo, common.SyncServiceError) {
@@ -96,10 +281,10 @@ func PrepareUpdateNotification(metaData common.MetaData, destinations []common.D
 func PrepareObjectStatusNotification(metaData common.MetaData, status string) ([]common.NotificationInfo, common.SyncServiceError) {
 	notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 		DestOrgID: metaData.DestOrgID, DestID: metaData.OriginID, DestType: metaData.OriginType,
-		Status: status, InstanceID: metaData.InstanceID, DataID: metaData.DataID}
+		Status: status, InstanceID: metaData.InstanceID, InstanceSequence: metaData.InstanceSequence, DataID: metaData.DataID}
 
 	// Store the notification records in storage as part of the object
-	if err := Store.UpdateNotificationRecord(notification); err != nil {
+	if err := updateNotificationRecord(notification); err != nil {
 		return nil, err
 	}
 
@@ -111,14 +296,110 @@ func PrepareObjectStatusNotification(metaData common.MetaData, status string) ([
 // SendNotifications calls the communication to send the notification messages
 func SendNotifications(notifications []common.NotificationInfo) common.SyncServiceError {
 	for _, notification := range notifications {
+		if notification.MetaData != nil && isDestinationStale(notification.MetaData.DestOrgID, notification.DestType, notification.DestID) {
+			// The notification record stays pending, it is sent when the destination is seen again
+			if trace.IsLogging(logger.TRACE) {
+				trace.Trace("Deferring %s notification to stale destination %s %s\n", notification.NotificationTopic,
+					notification.DestType, notification.DestID)
+			}
+			continue
+		}
+		if notification.MetaData != nil && isDestinationOffline(notification.MetaData.DestOrgID, notification.DestType, notification.DestID) {
+			// The notification record stays pending, it is sent when the destination registers again
+			if trace.IsLogging(logger.TRACE) {
+				trace.Trace("Suspending %s notification to offline destination %s %s\n", notification.NotificationTopic,
+					notification.DestType, notification.DestID)
+			}
+			continue
+		}
+		if notification.NotificationTopic == common.Update && !authorizeObjectDelivery(notification) {
+			continue
+		}
+		if notification.NotificationTopic == common.Update {
+			if reason := insufficientDestinationSpace(notification.MetaData, notification.DestType, notification.DestID); reason != "" {
+				if log.IsLogging(logger.WARNING) {
+					log.Warning("Deferring the update notification of %s:%s:%s to %s %s. %s\n", notification.MetaData.DestOrgID,
+						notification.MetaData.ObjectType, notification.MetaData.ObjectID, notification.DestType, notification.DestID, reason)
+				}
+				deferNotificationForSpace(notification.MetaData, notification.DestType, notification.DestID, reason)
+				continue
+			}
+		}
+		metaData := withOrderSequence(notification.MetaData, notification.DestType, notification.DestID, notification.OrderSequence,
+			notification.NotificationTopic)
+		if notification.NotificationTopic == common.Update {
+			metaData = withDataURL(metaData, notification.DestType, notification.DestID)
+		}
 		if err := Comm.SendNotificationMessage(notification.NotificationTopic, notification.DestType, notification.DestID,
-			notification.InstanceID, notification.DataID, notification.MetaData); err != nil {
+			notification.InstanceID, notification.DataID, metaData); err != nil {
+			if IsCircuitOpen(err) {
+				// The notification record stays pending, it is resent after the destination recovers
+				if trace.IsLogging(logger.DEBUG) {
+					trace.Debug("Deferring %s notification to %s %s. %s\n", notification.NotificationTopic,
+						notification.DestType, notification.DestID, err)
+				}
+				continue
+			}
 			return &Error{err.Error()}
 		}
 	}
 	return nil
 }
 
+// isDestinationStale returns true if the CSS hasn't seen the destination for longer than DestinationStaleTimeout
+func isDestinationStale(orgID string, destType string, destID string) bool {
+	if common.Configuration.NodeType != common.CSS || common.Configuration.DestinationStaleTimeout == 0 || destType == "" {
+		return false
+	}
+	lastSeen, err := Store.RetrieveDestinationLastSeen(orgID, destType, destID)
+	if err != nil || lastSeen.IsZero() {
+		return false
+	}
+	return time.Since(lastSeen) > time.Duration(common.Configuration.DestinationStaleTimeout)*time.Second
+}
+
+// isDestinationOffline returns true if the destination was marked as offline by ReapOfflineDestinations
+func isDestinationOffline(orgID string, destType string, destID string) bool {
+	if common.Configuration.NodeType != common.CSS || destType == "" {
+		return false
+	}
+	offline, err := Store.RetrieveDestinationOffline(orgID, destType, destID)
+	return err == nil && offline
+}
+
+// ReapOfflineDestinations marks the destinations that the CSS hasn't seen for longer than DestinationOfflineTimeout
+// as offline. The notifications to an offline destination are suspended until it registers again.
+// Should be called only by the leader.
+func ReapOfflineDestinations() common.SyncServiceError {
+	if common.Configuration.NodeType != common.CSS || common.Configuration.DestinationOfflineTimeout == 0 {
+		return nil
+	}
+
+	dests, err := Store.RetrieveDestinationsInfo("", "")
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to retrieve the destinations. Error: %s", err.Error())}
+	}
+
+	timeout := time.Duration(common.Configuration.DestinationOfflineTimeout) * time.Second
+	for _, dest := range dests {
+		if dest.Offline || dest.LastSeen.IsZero() || time.Since(dest.LastSeen) <= timeout {
+			continue
+		}
+		if err := Store.UpdateDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID, true); err != nil {
+			if storage.IsNotFound(err) {
+				// The destination was removed
+				continue
+			}
+			return &Error{fmt.Sprintf("Failed to mark the destination as offline. Error: %s", err.Error())}
+		}
+		if log.IsLogging(logger.INFO) {
+			log.Info("Destination is offline, not seen since %s: %s %s %s\n", dest.LastSeen.Format(time.RFC3339),
+				dest.DestOrgID, dest.DestType, dest.DestID)
+		}
+	}
+	return nil
+}
+
 func resendNotificationsForDestination(dest common.Destination, resendReceivedObjects bool) common.SyncServiceError {
 	notifications, err := Store.RetrieveNotifications(dest.DestOrgID, dest.DestType, dest.DestID, resendReceivedObjects)
 	if err != nil {
@@ -129,8 +410,30 @@ func resendNotificationsForDestination(dest common.Destination, resendReceivedOb
 		return &invalidNotification{message}
 	}
 
+	// The periodic resend of a replica only requests the data of the objects that it owns (see leader.CheckIfOwner)
+	dataRequestsOnly := dest.DestType == "" && !leader.CheckIfLeader()
+
+	// The periodic resend records the creation time of the oldest notification that is still pending
+	var oldestCreationTime int64
+	if dest.DestType == "" {
+		defer func() { atomic.StoreInt64(&oldestPendingNotificationTime, oldestCreationTime) }()
+	}
+
 	if len(notifications) > 0 {
 		for _, notification := range notifications {
+			if dataRequestsOnly && notification.Status != common.Getdata {
+				continue
+			}
+			if dest.DestType == "" && (isDestinationStale(notification.DestOrgID, notification.DestType, notification.DestID) ||
+				isDestinationOffline(notification.DestOrgID, notification.DestType, notification.DestID)) {
+				continue
+			}
+			if dest.DestType == "" && notification.CreationTime != 0 &&
+				(oldestCreationTime == 0 || notification.CreationTime < oldestCreationTime) {
+				oldestCreationTime = notification.CreationTime
+			}
+			notificationFanoutLimiter.wait()
+
 			// Retrieve the notification in case it was changed since the call to RetrieveNotifications
 			lockIndex := common.HashStrings(notification.DestOrgID, notification.ObjectType, notification.ObjectID)
 			common.ObjectLocks.Lock(lockIndex)
@@ -167,18 +470,19 @@ func resendNotificationsForDestination(dest common.Destination, resendReceivedOb
 
 			switch n.Status {
 			case common.Getdata:
-				if status != common.PartiallyReceived {
+				if status != common.PartiallyReceived || !leader.CheckIfOwner(n.DestOrgID, n.ObjectType, n.ObjectID) {
 					common.ObjectLocks.Unlock(lockIndex)
 					continue
 				}
 				common.ObjectLocks.Unlock(lockIndex)
 				Comm.LockDataChunks(lockIndex, metaData)
 				offsets := getOffsetsToResend(*n, *metaData)
-				for _, offset := range offsets {
+				for _, chunks := range getChunkRanges(*metaData, offsets) {
 					if trace.IsLogging(logger.TRACE) {
-						trace.Trace("Resending GetData request for offset %d of %s:%s:%s\n", offset, n.DestOrgID, n.ObjectType, n.ObjectID)
+						trace.Trace("Resending GetData request for %d chunks at offset %d of %s:%s:%s\n", chunks.count, chunks.offset,
+							n.DestOrgID, n.ObjectType, n.ObjectID)
 					}
-					if err = Comm.GetData(*metaData, offset); err != nil {
+					if err = Comm.GetDataRange(*metaData, chunks.offset, chunks.count); err != nil {
 						if common.IsNotFound(err) {
 							deleteObjectInfo("", "", "", n.DestType, n.DestID, metaData, true)
 						}
@@ -199,19 +503,38 @@ func resendNotificationsForDestination(dest common.Destination, resendReceivedOb
 				// Send update notification for this object.
 				n.Status = common.Update
 				n.ResendTime = 0
-				if err := Store.UpdateNotificationRecord(*n); err != nil && log.IsLogging(logger.ERROR) {
+				if err := updateNotificationRecord(*n); err != nil && log.IsLogging(logger.ERROR) {
 					log.Error("Failed to update notification record. Error: " + err.Error())
 				}
 				common.ObjectLocks.Unlock(lockIndex)
 				metaData.DestType = n.DestType
 				metaData.DestID = n.DestID
-				err = Comm.SendNotificationMessage(common.Update, dest.DestType, dest.DestID, metaData.InstanceID, metaData.DataID, metaData)
+				if deferResentUpdateForSpace(metaData, n.DestType, n.DestID) {
+					continue
+				}
+				metaData = withOrderSequence(metaData, dest.DestType, dest.DestID, n.OrderSequence, common.Update)
+				err = Comm.SendNotificationMessage(common.Update, dest.DestType, dest.DestID, metaData.InstanceID, metaData.DataID,
+					withDataURL(metaData, dest.DestType, dest.DestID))
 			default:
 				common.ObjectLocks.Unlock(lockIndex)
 				metaData.DestType = n.DestType
 				metaData.DestID = n.DestID
+				if n.Status == common.Update {
+					if deferResentUpdateForSpace(metaData, n.DestType, n.DestID) {
+						continue
+					}
+					metaData = withDataURL(metaData, n.DestType, n.DestID)
+				}
+				metaData = withOrderSequence(metaData, n.DestType, n.DestID, n.OrderSequence, n.Status)
 				err = Comm.SendNotificationMessage(n.Status, n.DestType, n.DestID, n.InstanceID, n.DataID, metaData)
 			}
+			if IsCircuitOpen(err) {
+				// The destination's circuit breaker is open, the other destinations are still resent
+				if trace.IsLogging(logger.DEBUG) {
+					trace.Debug("Error in resendNotificationsForDestination. Error: %s\n", err)
+				}
+				continue
+			}
 			if err != nil {
 				message := fmt.Sprintf("Error in resendNotificationsForDestination. Error: %s\n", err)
 				if log.IsLogging(logger.ERROR) {
@@ -225,6 +548,21 @@ func resendNotificationsForDestination(dest common.Destination, resendReceivedOb
 	return nil
 }
 
+// deferResentUpdateForSpace returns true if the resend of the object's update notification to the destination is deferred
+// because the object doesn't fit in the destination's storage
+func deferResentUpdateForSpace(metaData *common.MetaData, destType string, destID string) bool {
+	reason := insufficientDestinationSpace(metaData, destType, destID)
+	if reason == "" {
+		return false
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deferring the resend of the update notification of %s:%s:%s to %s %s. %s\n", metaData.DestOrgID,
+			metaData.ObjectType, metaData.ObjectID, destType, destID, reason)
+	}
+	deferNotificationForSpace(metaData, destType, destID, reason)
+	return true
+}
+
 // ResendNotifications resends notications that haven't been acknowledged
 func ResendNotifications() common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS && !common.Registered {
@@ -239,7 +577,7 @@ func ResendNotifications() common.SyncServiceError {
 		Comm.ResendObjects()
 	}
 
-	if leader.CheckIfLeader() {
+	if leader.CheckIfLeader() || leader.IsOwnershipSharded() {
 		if trace.IsLogging(logger.TRACE) {
 			trace.Trace("About to resend notifications.")
 		}
@@ -291,14 +629,315 @@ func ActivateObjects() {
 	}
 }
 
+// DeleteExpiredObjects deletes the objects originated by this node whose expiration time has passed.
+// Destinations that the object was already (possibly partially) delivered to are notified that the object was deleted.
+func DeleteExpiredObjects() {
+	objects, err := Store.GetExpiredObjects()
+	if err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in DeleteExpiredObjects, failed to retrieve objects. Error: %s\n", err)
+	}
+	for _, object := range objects {
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Deleting expired object %s:%s:%s", object.DestOrgID, object.ObjectType, object.ObjectID)
+		}
+		lockIndex := common.HashStrings(object.DestOrgID, object.ObjectType, object.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+
+		storedObject, status, err := Store.RetrieveObjectAndStatus(object.DestOrgID, object.ObjectType, object.ObjectID)
+		if err != nil || storedObject == nil || (status != common.NotReadyToSend && status != common.ReadyToSend) ||
+			storedObject.Expiration != object.Expiration {
+			common.ObjectLocks.Unlock(lockIndex)
+			continue
+		}
+
+		notificationsInfo, err := deleteOriginatedObject(*storedObject)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Error in DeleteExpiredObjects: %s\n", err)
+			}
+			continue
+		}
+
+		if err := SendNotifications(notificationsInfo); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in DeleteExpiredObjects: %s\n", err)
+		}
+	}
+}
+
+// DeleteObjectsWithFilter deletes the objects originated by this node that meet the given conditions, and returns
+// the number of objects being deleted. The objects are first marked as pending deletion in the storage, so that an
+// interrupted deletion is resumed by DeletePendingObjects.
+func DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) (int, common.SyncServiceError) {
+	count, err := Store.DeleteObjectsWithFilter(orgID, objectType, destinationType, destinationID, expirationTimeBefore)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 && leader.CheckIfLeader() {
+		DeletePendingObjects()
+	}
+	return count, nil
+}
+
+// DeletePendingObjects completes the deletion of the objects marked as pending deletion.
+// The Delete notifications are sent after all the objects are deleted, grouped by destination.
+func DeletePendingObjects() {
+	objects, err := Store.RetrieveObjectsPendingDeletion()
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in DeletePendingObjects, failed to retrieve objects. Error: %s\n", err)
+		}
+		return
+	}
+
+	destinations := make([]string, 0)
+	notificationsByDestination := make(map[string][]common.NotificationInfo)
+	for _, object := range objects {
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Deleting object %s:%s:%s", object.DestOrgID, object.ObjectType, object.ObjectID)
+		}
+		lockIndex := common.HashStrings(object.DestOrgID, object.ObjectType, object.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+
+		// Skip objects that were updated or deleted since they were retrieved
+		storedObject, status, err := Store.RetrieveObjectAndStatus(object.DestOrgID, object.ObjectType, object.ObjectID)
+		if err != nil || storedObject == nil || (status != common.NotReadyToSend && status != common.ReadyToSend) ||
+			storedObject.InstanceID != object.InstanceID {
+			common.ObjectLocks.Unlock(lockIndex)
+			continue
+		}
+
+		notificationsInfo, err := deleteOriginatedObject(*storedObject)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Error in DeletePendingObjects: %s\n", err)
+			}
+			continue
+		}
+
+		for _, notificationInfo := range notificationsInfo {
+			key := notificationInfo.DestType + ":" + notificationInfo.DestID
+			if _, ok := notificationsByDestination[key]; !ok {
+				destinations = append(destinations, key)
+			}
+			notificationsByDestination[key] = append(notificationsByDestination[key], notificationInfo)
+		}
+	}
+
+	for _, key := range destinations {
+		if err := SendNotifications(notificationsByDestination[key]); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in DeletePendingObjects: %s\n", err)
+		}
+	}
+}
+
+// deleteOriginatedObject deletes an object originated by this node, and returns the Delete notifications for the
+// destinations that the object was already (possibly partially) delivered to.
+// The notification records are stored before the object is marked as deleted, so they are resent if sending fails.
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func deleteOriginatedObject(metaData common.MetaData) ([]common.NotificationInfo, common.SyncServiceError) {
+	destinations, err := Store.GetObjectDestinationsList(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to retrieve destinations. Error: %s", err)}
+	}
+	for _, dest := range destinations {
+		removeNotificationChunksInfo(metaData, dest.Destination.DestType, dest.Destination.DestID)
+	}
+	if err := Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "", ""); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to delete notification records. Error: %s", err)}
+	}
+
+	notificationsInfo, err := PrepareNotificationsForDestinations(metaData, destinations, common.Delete)
+	if err != nil {
+		return nil, err
+	}
+	if len(notificationsInfo) == 0 {
+		// The object wasn't delivered to any destination, remove it
+		return nil, DeleteStoredObject(metaData)
+	}
+
+	if err := storage.DeleteStoredData(Store, metaData); err != nil {
+		return nil, err
+	}
+	if err := Store.MarkObjectDeleted(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		return nil, err
+	}
+	err = Store.ResetObjectRemainingConsumers(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil && trace.IsLogging(logger.TRACE) {
+		trace.Trace("Error in deleteOriginatedObject: %s \n", err)
+	}
+	return notificationsInfo, nil
+}
+
+// DeleteStoredObject removes a deleted object from the storage, and calls the webhooks registered for the deletion of
+// objects of its type. An object is removed once, so the webhooks are called once for each deletion. They are called
+// in the background, as the callers hold the object's lock.
+func DeleteStoredObject(metaData common.MetaData) common.SyncServiceError {
+	if err := storage.DeleteStoredObject(Store, metaData); err != nil {
+		return err
+	}
+	go callDeletionWebhooks(metaData)
+	return nil
+}
+
+// deleteStoredObjectWithRetry removes an object from the storage when cleaning up after it, where a failure can't be
+// reported to the caller. If the removal fails, it is queued in the storage and retried by RetryObjectCleanups until
+// it succeeds, so that a transient storage error doesn't leave the object behind.
+// The caller should hold the object's lock.
+func deleteStoredObjectWithRetry(metaData common.MetaData) {
+	if err := storage.DeleteStoredObject(Store, metaData); err != nil {
+		objectCleanupFailed(common.ObjectCleanup{MetaData: metaData, Attempts: 1}, err)
+	}
+}
+
+// RetryObjectCleanups retries the removals of objects from the storage that failed. A removal is done once:
+// it is dropped when the object is removed, or if the object was already removed or replaced by a new instance.
+// Should be called only by the leader.
+func RetryObjectCleanups() {
+	cleanups, err := Store.RetrieveObjectCleanups()
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in RetryObjectCleanups, failed to retrieve object cleanups. Error: %s\n", err)
+		}
+		return
+	}
+
+	for _, cleanup := range cleanups {
+		retryObjectCleanup(cleanup)
+	}
+}
+
+func retryObjectCleanup(cleanup common.ObjectCleanup) {
+	metaData := cleanup.MetaData
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	storedObject, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err == nil && storedObject != nil && storedObject.InstanceID == metaData.InstanceID {
+		err = storage.DeleteStoredObject(Store, metaData)
+	}
+	if err != nil {
+		cleanup.Attempts++
+		objectCleanupFailed(cleanup, err)
+		return
+	}
+
+	if err := Store.DeleteObjectCleanup(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil &&
+		log.IsLogging(logger.ERROR) {
+		log.Error("Error in RetryObjectCleanups, failed to delete object cleanup. Error: %s\n", err)
+	}
+}
+
+// objectCleanupFailed queues a failed removal of an object to be retried
+func objectCleanupFailed(cleanup common.ObjectCleanup, err error) {
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Failed to remove %s:%s:%s from the storage (attempt %d), will retry. Error: %s\n", cleanup.MetaData.DestOrgID,
+			cleanup.MetaData.ObjectType, cleanup.MetaData.ObjectID, cleanup.Attempts, err)
+	}
+	if err := Store.StoreObjectCleanup(cleanup); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to store the cleanup of %s:%s:%s, the object may be left in the storage. Error: %s\n",
+			cleanup.MetaData.DestOrgID, cleanup.MetaData.ObjectType, cleanup.MetaData.ObjectID, err)
+	}
+}
+
+// EvictObjects removes the objects that the storage evicts to keep the size of its data below its limit, together with
+// their notification records and the state of their transfers
+func EvictObjects() {
+	evictionLock.Lock()
+	defer evictionLock.Unlock()
+
+	objects, err := Store.RetrieveObjectsToEvict()
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in EvictObjects, failed to retrieve objects to evict. Error: %s\n", err)
+		}
+		return
+	}
+
+	for _, metaData := range objects {
+		lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		stored, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err == nil && stored != nil && (status == common.ObjReceived || status == common.ObjConsumed || status == common.ConsumedByDest) &&
+			common.CompareInstances(stored.InstanceID, stored.InstanceSequence, metaData.InstanceID, metaData.InstanceSequence) == 0 {
+			deleteStoredObjectWithRetry(*stored)
+			if err := Store.DeleteNotificationRecords(stored.DestOrgID, stored.ObjectType, stored.ObjectID, "", ""); err != nil &&
+				log.IsLogging(logger.ERROR) {
+				log.Error("Error in EvictObjects, failed to delete notification records. Error: %s\n", err)
+			}
+			removeNotificationChunksInfo(*stored, stored.OriginType, stored.OriginID)
+			if trace.IsLogging(logger.INFO) {
+				trace.Info("Evicted %s:%s:%s from the storage\n", stored.DestOrgID, stored.ObjectType, stored.ObjectID)
+			}
+		}
+		common.ObjectLocks.Unlock(lockIndex)
+	}
+}
+
 // ResendObjects requests to resend all the relevant objects
 func ResendObjects() common.SyncServiceError {
 	common.ResendAcked = false
 	return Comm.ResendObjects()
 }
 
+// VerifyObjects sends the manifest of the objects received by the ESS to the CSS, which reports the objects that
+// don't match its objects. If resend is true, the CSS sends these objects again.
+func VerifyObjects(resend bool) common.SyncServiceError {
+	objects, err := Store.RetrieveReceivedObjects()
+	if err != nil {
+		return err
+	}
+
+	manifest := make([]common.ManifestEntry, 0, len(objects))
+	for _, metaData := range objects {
+		entry := common.ManifestEntry{ObjectType: metaData.ObjectType, ObjectID: metaData.ObjectID, InstanceID: metaData.InstanceID,
+			ObjectSize: metaData.ObjectSize}
+		if !metaData.NoData && metaData.Link == "" && metaData.ObjectSize > 0 {
+			entry.HashAlgorithm = metaData.HashAlgorithm
+			if entry.HashAlgorithm == "" {
+				entry.HashAlgorithm = common.Configuration.DefaultHashAlgorithm
+			}
+			lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+			common.ObjectLocks.RLock(lockIndex)
+			entry.Hash, entry.ObjectSize, err = hashObjectData(metaData, metaData.DestinationDataURI, entry.HashAlgorithm)
+			common.ObjectLocks.RUnlock(lockIndex)
+			if err != nil {
+				if log.IsLogging(logger.ERROR) {
+					log.Error("Failed to hash the data of %s:%s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err)
+				}
+				// The CSS reports the object as a data discrepancy
+				entry.Hash = ""
+				entry.ObjectSize = -1
+			}
+		}
+		manifest = append(manifest, entry)
+	}
+	return Comm.SendVerifyRequest(manifest, resend)
+}
+
+// maxWebhookRetryBackoff is the longest time to wait between attempts of a failed webhook call
+const maxWebhookRetryBackoff = time.Hour
+
+// callWebhooks calls the webhooks registered for the object's type. The webhooks are stored keyed by the object type,
+// so only the webhooks of the object's type are retrieved, and the object is marshaled only if there are any.
+// The payload is the object's meta data, its trace ID correlates the call with the trace messages of the object's transfers.
 func callWebhooks(metaData *common.MetaData) {
-	if webhooks, err := Store.RetrieveWebhooks(metaData.DestOrgID, metaData.ObjectType); err == nil {
+	postToWebhooks(metaData.ObjectType, metaData)
+}
+
+// callDeletionWebhooks calls the webhooks registered for the deletion of objects of the object's type.
+// The payload is the object's last-known meta data, marked as deleted.
+func callDeletionWebhooks(metaData common.MetaData) {
+	metaData.Deleted = true
+	postToWebhooks(common.DeletionWebhooksKey(metaData.ObjectType), &metaData)
+}
+
+// postToWebhooks posts the meta data to the webhooks stored under the key, retrying the failed calls later
+func postToWebhooks(key string, metaData *common.MetaData) {
+	if webhooks, err := Store.RetrieveWebhooks(metaData.DestOrgID, key); err == nil {
 		body, err := json.MarshalIndent(metaData, "", "  ")
 		if err != nil {
 			if log.IsLogging(logger.ERROR) {
@@ -307,27 +946,101 @@ func callWebhooks(metaData *common.MetaData) {
 			return
 		}
 		for _, url := range webhooks {
-			request, err := http.NewRequest("POST", url, bytes.NewReader(body))
-			request.ContentLength = int64(len(body))
-			request.Header.Add("Content-Type", "Application/JSON")
-			response, err := http.DefaultClient.Do(request)
-			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error("Error in callWebhooks, failed to post meta data to %s: %s\n", url, err)
-				}
-				continue
+			if err := postWebhook(url, body); err != nil {
+				webhookFailed(common.WebhookDelivery{URL: url, MetaData: *metaData, Attempts: 1}, err)
 			}
-			if response.StatusCode != http.StatusOK &&
-				response.StatusCode != http.StatusNoContent &&
-				log.IsLogging(logger.ERROR) {
-				log.Error("Error in callWebhooks: received status: %d for %s\n", response.StatusCode, url)
-			}
-			err = response.Body.Close()
-			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error("Error in callWebhooks, failed to close response body")
-				}
+		}
+	}
+}
+
+// RetryWebhooks retries the webhook calls that failed and are due for another attempt
+func RetryWebhooks() {
+	deliveries, err := Store.RetrieveWebhookDeliveries(false)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in RetryWebhooks, failed to retrieve webhook deliveries. Error: %s\n", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, delivery := range deliveries {
+		if delivery.NextAttempt.After(now) {
+			continue
+		}
+		body, err := json.MarshalIndent(delivery.MetaData, "", "  ")
+		if err == nil {
+			err = postWebhook(delivery.URL, body)
+		}
+		if err == nil {
+			if err := Store.DeleteWebhookDelivery(delivery); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Error in RetryWebhooks, failed to delete webhook delivery. Error: %s\n", err)
 			}
+			continue
+		}
+		delivery.Attempts++
+		webhookFailed(delivery, err)
+	}
+}
+
+// webhookFailed schedules the next attempt of a failed webhook call. If the call failed WebhookMaxAttempts times,
+// it is dead-lettered or discarded.
+func webhookFailed(delivery common.WebhookDelivery, err error) {
+	if delivery.Attempts >= common.Configuration.WebhookMaxAttempts {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in callWebhooks, giving up on %s for %s:%s:%s after %d attempts. Error: %s\n", delivery.URL,
+				delivery.MetaData.DestOrgID, delivery.MetaData.ObjectType, delivery.MetaData.ObjectID, delivery.Attempts, err)
+		}
+		if common.Configuration.WebhookDeadLetter {
+			delivery.DeadLetter = true
+			err = Store.StoreWebhookDelivery(delivery)
+		} else {
+			err = Store.DeleteWebhookDelivery(delivery)
+		}
+		if err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in callWebhooks, failed to update webhook delivery. Error: %s\n", err)
 		}
+		return
+	}
+
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Failed to call webhook %s for %s:%s:%s (attempt %d), will retry. Error: %s\n", delivery.URL,
+			delivery.MetaData.DestOrgID, delivery.MetaData.ObjectType, delivery.MetaData.ObjectID, delivery.Attempts, err)
+	}
+	delivery.NextAttempt = time.Now().Add(webhookRetryBackoff(delivery.Attempts))
+	if err := Store.StoreWebhookDelivery(delivery); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in callWebhooks, failed to store webhook delivery. Error: %s\n", err)
+	}
+}
+
+// webhookRetryBackoff returns the time to wait after the given number of failed attempts
+func webhookRetryBackoff(attempts int) time.Duration {
+	backoff := time.Duration(common.Configuration.WebhookRetryInterval) * time.Second
+	for i := 1; i < attempts && backoff < maxWebhookRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxWebhookRetryBackoff {
+		backoff = maxWebhookRetryBackoff
 	}
+	return backoff
+}
+
+func postWebhook(url string, body []byte) error {
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = int64(len(body))
+	request.Header.Add("Content-Type", "Application/JSON")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	if err := response.Body.Close(); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in callWebhooks, failed to close response body")
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return &Error{fmt.Sprintf("received status: %d", response.StatusCode)}
+	}
+	return nil
 }
@@ -0,0 +1,222 @@
+package communications
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// NotificationEvent describes a change of the status of a notification record
+type NotificationEvent struct {
+	OrgID      string
+	ObjectType string
+	ObjectID   string
+	DestType   string
+	DestID     string
+	InstanceID int64
+	DataID     int64
+
+	// PreviousStatus is empty if the notification record didn't exist.
+	// Status is common.DeliveryOverdue in the events that report that the destination didn't receive the object by its
+	// delivery deadline, PreviousStatus is then the current status of the notification record.
+	PreviousStatus string
+	Status         string
+	Timestamp      time.Time
+}
+
+// NotificationEventSubscription receives the notification events published after it was created
+type NotificationEventSubscription struct {
+	// Events delivers the events. It is closed when the subscription is cancelled.
+	Events <-chan NotificationEvent
+
+	events  chan NotificationEvent
+	dropped uint64
+}
+
+// Dropped returns the number of events that were dropped because the subscriber didn't keep up with them
+func (subscription *NotificationEventSubscription) Dropped() uint64 {
+	notificationEventsLock.RLock()
+	defer notificationEventsLock.RUnlock()
+	return subscription.dropped
+}
+
+var notificationEventSubscriptions map[*NotificationEventSubscription]bool
+var notificationEventsLock sync.RWMutex
+
+func init() {
+	notificationEventSubscriptions = make(map[*NotificationEventSubscription]bool)
+}
+
+// SubscribeToNotificationEvents subscribes to the changes of the status of notification records.
+// Up to bufferSize events are buffered for the subscriber, later events are dropped until the subscriber reads
+// the buffered ones. Publishing an event never waits for a subscriber.
+func SubscribeToNotificationEvents(bufferSize int) *NotificationEventSubscription {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	events := make(chan NotificationEvent, bufferSize)
+	subscription := &NotificationEventSubscription{Events: events, events: events}
+
+	notificationEventsLock.Lock()
+	notificationEventSubscriptions[subscription] = true
+	notificationEventsLock.Unlock()
+	return subscription
+}
+
+// UnsubscribeFromNotificationEvents cancels the subscription and closes its events channel
+func UnsubscribeFromNotificationEvents(subscription *NotificationEventSubscription) {
+	notificationEventsLock.Lock()
+	defer notificationEventsLock.Unlock()
+
+	if notificationEventSubscriptions[subscription] {
+		delete(notificationEventSubscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+func hasNotificationEventSubscriptions() bool {
+	notificationEventsLock.RLock()
+	defer notificationEventsLock.RUnlock()
+	return len(notificationEventSubscriptions) != 0
+}
+
+func publishNotificationEvent(event NotificationEvent) {
+	// The write lock protects the dropped counters, sending to a buffered channel with default never blocks
+	notificationEventsLock.Lock()
+	defer notificationEventsLock.Unlock()
+
+	for subscription := range notificationEventSubscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped++
+			if trace.IsLogging(logger.TRACE) {
+				trace.Trace("Dropped notification event of %s:%s:%s, the subscriber's buffer is full\n", event.OrgID,
+					event.ObjectType, event.ObjectID)
+			}
+		}
+	}
+}
+
+// updateNotificationRecord stores the notification record and publishes the change of its status to the subscribers
+// of notification events
+func updateNotificationRecord(notification common.Notification) common.SyncServiceError {
+	recordCreation := (common.Configuration.NotificationMaxAge > 0 || common.Configuration.ReadinessMaxPendingNotificationAge > 0) &&
+		notification.CreationTime == 0
+	publish := hasNotificationEventSubscriptions()
+	limited := common.Configuration.MaxNotificationRecordsPerDestination > 0
+	ordered := notification.OrderSequence == 0 && common.IsOrderedObjectType(notification.ObjectType)
+	if !publish && !recordCreation && !limited && !ordered {
+		return Store.UpdateNotificationRecord(notification)
+	}
+
+	previousStatus := ""
+	previousInstanceID := int64(0)
+	previous, err := Store.RetrieveNotificationRecord(notification.DestOrgID, notification.ObjectType, notification.ObjectID,
+		notification.DestType, notification.DestID)
+	if err == nil && previous != nil {
+		previousStatus = previous.Status
+		previousInstanceID = previous.InstanceID
+		if recordCreation && previous.InstanceID == notification.InstanceID && !isStaleNotification(previous) {
+			// The record of the same instance keeps its creation time, unless it's stale
+			notification.CreationTime = previous.CreationTime
+		}
+		if ordered && previous.InstanceID == notification.InstanceID {
+			// The record of the same instance keeps its order sequence
+			notification.OrderSequence = previous.OrderSequence
+		}
+	} else if err == nil && limited {
+		if err := checkNotificationRecordsLimit(notification); err != nil {
+			return err
+		}
+	}
+	if recordCreation && notification.CreationTime == 0 {
+		notification.CreationTime = time.Now().Unix()
+	}
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		return err
+	}
+	if publish && (previousStatus != notification.Status || previousInstanceID != notification.InstanceID) {
+		publishNotificationEvent(NotificationEvent{OrgID: notification.DestOrgID, ObjectType: notification.ObjectType,
+			ObjectID: notification.ObjectID, DestType: notification.DestType, DestID: notification.DestID,
+			InstanceID: notification.InstanceID, DataID: notification.DataID, PreviousStatus: previousStatus,
+			Status: notification.Status, Timestamp: time.Now()})
+	}
+	return nil
+}
+
+// checkNotificationRecordsLimit returns an error if the destination of a new notification record already has
+// MaxNotificationRecordsPerDestination records, so that a misbehaving destination can't grow the storage without bounds
+func checkNotificationRecordsLimit(notification common.Notification) common.SyncServiceError {
+	count, err := Store.GetNumberOfNotificationRecords(notification.DestOrgID, notification.DestType, notification.DestID)
+	if err != nil {
+		return err
+	}
+	if count < uint32(common.Configuration.MaxNotificationRecordsPerDestination) {
+		return nil
+	}
+
+	common.HealthStatus.NotificationRecordRejected()
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Rejected the notification record of %s:%s:%s for %s %s, the destination has %d notification records\n",
+			notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType, notification.DestID, count)
+	}
+	return &notificationHandlerError{message: fmt.Sprintf("The destination %s %s reached the limit of %d notification records",
+		notification.DestType, notification.DestID, common.Configuration.MaxNotificationRecordsPerDestination)}
+}
+
+// WaitForStatus waits until the status of the notification record of the object for the destination becomes targetStatus,
+// e.g., until the object is received (common.ReceivedByDestination) or consumed (common.ConsumedByDestination) by the destination.
+// It returns true if the status was reached, and false if it wasn't reached within the timeout.
+// An object that was consumed by the destination is considered received by it.
+func WaitForStatus(orgID string, objectType string, objectID string, destType string, destID string, targetStatus string,
+	timeout time.Duration) (bool, common.SyncServiceError) {
+	// Subscribe before checking the current status, so that no transition is missed
+	subscription := SubscribeToNotificationEvents(waitForStatusBufferSize)
+	defer UnsubscribeFromNotificationEvents(subscription)
+
+	isStatusReached := func() (bool, common.SyncServiceError) {
+		notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+		if err != nil {
+			return false, err
+		}
+		return notification != nil && statusReached(notification.Status, targetStatus), nil
+	}
+	if reached, err := isStatusReached(); reached || err != nil {
+		return reached, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	dropped := uint64(0)
+	for {
+		select {
+		case event := <-subscription.Events:
+			if event.OrgID == orgID && event.ObjectType == objectType && event.ObjectID == objectID &&
+				event.DestType == destType && event.DestID == destID && statusReached(event.Status, targetStatus) {
+				return true, nil
+			}
+			// The transition may have been dropped while the buffer was full of events of other objects
+			if current := subscription.Dropped(); current != dropped {
+				dropped = current
+				if reached, err := isStatusReached(); reached || err != nil {
+					return reached, err
+				}
+			}
+		case <-timer.C:
+			return false, nil
+		}
+	}
+}
+
+// The number of events buffered for WaitForStatus, the events of all the objects are published to it
+const waitForStatusBufferSize = 64
+
+func statusReached(status string, targetStatus string) bool {
+	return status == targetStatus || (targetStatus == common.ReceivedByDestination && status == common.ConsumedByDestination)
+}
@@ -0,0 +1,161 @@
+package communications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestNotificationEvents(t *testing.T) {
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	subscription := SubscribeToNotificationEvents(2)
+
+	notification := common.Notification{ObjectID: "events", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1",
+		DestType: "device", Status: common.Update, InstanceID: 10}
+	for _, status := range []string{common.Update, common.Update, common.Updated, common.Data} {
+		notification.Status = status
+		if err := updateNotificationRecord(notification); err != nil {
+			t.Errorf("updateNotificationRecord failed. Error: %s", err.Error())
+		}
+	}
+
+	// The record was stored although the buffer is full
+	if record, _ := Store.RetrieveNotificationRecord(notification.DestOrgID, notification.ObjectType, notification.ObjectID,
+		notification.DestType, notification.DestID); record == nil || record.Status != common.Data {
+		t.Errorf("The last notification record wasn't stored")
+	}
+
+	expected := []struct {
+		previousStatus string
+		status         string
+	}{{"", common.Update}, {common.Update, common.Updated}}
+	for _, transition := range expected {
+		event := <-subscription.Events
+		if event.PreviousStatus != transition.previousStatus || event.Status != transition.status || event.ObjectID != "events" {
+			t.Errorf("Wrong event: %s -> %s instead of %s -> %s", event.PreviousStatus, event.Status,
+				transition.previousStatus, transition.status)
+		}
+	}
+	if dropped := subscription.Dropped(); dropped != 1 {
+		t.Errorf("Dropped %d events instead of 1", dropped)
+	}
+
+	UnsubscribeFromNotificationEvents(subscription)
+	if _, ok := <-subscription.Events; ok {
+		t.Errorf("The events channel wasn't closed")
+	}
+	notification.Status = common.ReceivedByDestination
+	if err := updateNotificationRecord(notification); err != nil {
+		t.Errorf("updateNotificationRecord failed. Error: %s", err.Error())
+	}
+}
+
+func TestNotificationRecordsLimit(t *testing.T) {
+	maxRecords := common.Configuration.MaxNotificationRecordsPerDestination
+	defer func() { common.Configuration.MaxNotificationRecordsPerDestination = maxRecords }()
+	common.Configuration.MaxNotificationRecordsPerDestination = 2
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	rejected := common.HealthUsageInfo.RejectedNotificationRecords
+	notification := common.Notification{ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+		Status: common.Update, InstanceID: 10}
+	for _, objectID := range []string{"1", "2"} {
+		notification.ObjectID = objectID
+		if err := updateNotificationRecord(notification); err != nil {
+			t.Errorf("updateNotificationRecord failed. Error: %s", err.Error())
+		}
+	}
+
+	// A new record of the destination is rejected
+	notification.ObjectID = "3"
+	if err := updateNotificationRecord(notification); err == nil {
+		t.Errorf("A notification record above the limit was stored")
+	}
+	if record, _ := Store.RetrieveNotificationRecord(notification.DestOrgID, notification.ObjectType, notification.ObjectID,
+		notification.DestType, notification.DestID); record != nil {
+		t.Errorf("The rejected notification record was stored")
+	}
+	if common.HealthUsageInfo.RejectedNotificationRecords != rejected+1 {
+		t.Errorf("The rejected notification record wasn't counted")
+	}
+
+	// The existing records are updated, and the records of other destinations are stored
+	notification.ObjectID = "1"
+	notification.Status = common.Updated
+	if err := updateNotificationRecord(notification); err != nil {
+		t.Errorf("updateNotificationRecord of an existing record failed. Error: %s", err.Error())
+	}
+	notification.ObjectID = "3"
+	notification.DestID = "dev2"
+	if err := updateNotificationRecord(notification); err != nil {
+		t.Errorf("updateNotificationRecord of another destination failed. Error: %s", err.Error())
+	}
+}
+
+func TestWaitForStatus(t *testing.T) {
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	notification := common.Notification{ObjectID: "wait", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1",
+		DestType: "device", Status: common.Data, InstanceID: 10}
+	if err := updateNotificationRecord(notification); err != nil {
+		t.Errorf("updateNotificationRecord failed. Error: %s", err.Error())
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// An event of another object doesn't end the wait
+		other := notification
+		other.ObjectID = "other"
+		other.Status = common.ReceivedByDestination
+		updateNotificationRecord(other)
+
+		notification.Status = common.ReceivedByDestination
+		updateNotificationRecord(notification)
+	}()
+	if reached, err := WaitForStatus("myorg", "type1", "wait", "device", "dev1", common.ReceivedByDestination, 5*time.Second); err != nil {
+		t.Errorf("WaitForStatus failed. Error: %s", err.Error())
+	} else if !reached {
+		t.Errorf("WaitForStatus timed out although the status was reached")
+	}
+
+	// The status was already reached
+	if reached, _ := WaitForStatus("myorg", "type1", "wait", "device", "dev1", common.ReceivedByDestination, time.Millisecond); !reached {
+		t.Errorf("WaitForStatus timed out although the status was already reached")
+	}
+
+	start := time.Now()
+	if reached, _ := WaitForStatus("myorg", "type1", "wait", "device", "dev1", common.ConsumedByDestination,
+		50*time.Millisecond); reached {
+		t.Errorf("WaitForStatus returned that a status that wasn't reached was reached")
+	} else if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("WaitForStatus returned before the timeout")
+	}
+
+	// A consumed object was received
+	notification.Status = common.ConsumedByDestination
+	updateNotificationRecord(notification)
+	if reached, _ := WaitForStatus("myorg", "type1", "wait", "device", "dev1", common.ReceivedByDestination, time.Millisecond); !reached {
+		t.Errorf("WaitForStatus didn't consider a consumed object received")
+	}
+}
@@ -3,10 +3,16 @@ package communications
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"os"
+	"io/ioutil"
+	"math"
+	"math/rand"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,43 +25,176 @@ import (
 	"github.com/open-horizon/edge-utilities/logger/trace"
 )
 
+// Error categories of the errors returned by the notification handlers.
+// Use IsNotificationNotFound, IsInstanceMismatch, IsTransportFailure, IsCircuitOpen, IsInvalidData, and IsUnauthorized to check
+// the category of an error.
+var (
+	// ErrNotificationNotFound is the category of errors caused by a missing notification record or transfer state
+	ErrNotificationNotFound = errors.New("notification not found")
+
+	// ErrInstanceMismatch is the category of errors caused by a message of another instance of the object,
+	// or a message that doesn't match the status of the notification record
+	ErrInstanceMismatch = errors.New("instance mismatch")
+
+	// ErrTransportFailure is the category of errors caused by a failure to send a message to the other side
+	ErrTransportFailure = errors.New("transport failure")
+
+	// ErrCircuitOpen is the category of errors caused by a send that was short-circuited because the circuit breaker
+	// of the other side is open
+	ErrCircuitOpen = errors.New("circuit open")
+
+	// ErrInvalidData is the category of errors caused by a data message that is malformed or doesn't match the object
+	ErrInvalidData = errors.New("invalid data")
+
+	// ErrUnauthorized is the category of errors caused by a destination that the destination authorizer denied
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
 type notificationHandlerError struct {
-	message string
+	message  string
+	category error
 }
 
 func (e *notificationHandlerError) Error() string {
 	return e.message
 }
 
+// Unwrap returns the category of the error, if any
+func (e *notificationHandlerError) Unwrap() error {
+	return e.category
+}
+
+// errorCategory returns the category of the error, or nil if the error doesn't have one
+func errorCategory(err error) error {
+	switch e := err.(type) {
+	case *notificationHandlerError:
+		return e.category
+	case *Error:
+		return ErrTransportFailure
+	case *circuitOpenError:
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// sendFailureCategory returns the category of a handler's error caused by a failure to send a message
+func sendFailureCategory(err error) error {
+	if IsCircuitOpen(err) {
+		return ErrCircuitOpen
+	}
+	return ErrTransportFailure
+}
+
+// IsNotificationNotFound returns true if the error is caused by a missing notification record or transfer state
+func IsNotificationNotFound(err error) bool {
+	return errorCategory(err) == ErrNotificationNotFound
+}
+
+// IsInstanceMismatch returns true if the error is caused by a message that doesn't match the notification record
+func IsInstanceMismatch(err error) bool {
+	return errorCategory(err) == ErrInstanceMismatch
+}
+
+// IsTransportFailure returns true if the error is caused by a failure to send a message to the other side,
+// including a send that was short-circuited
+func IsTransportFailure(err error) bool {
+	category := errorCategory(err)
+	return category == ErrTransportFailure || category == ErrCircuitOpen
+}
+
+// IsCircuitOpen returns true if the error is caused by a send that was short-circuited because the circuit breaker
+// of the other side is open. The error is transient, the send is retried when the notification is resent.
+func IsCircuitOpen(err error) bool {
+	return errorCategory(err) == ErrCircuitOpen
+}
+
+// IsInvalidData returns true if the error is caused by invalid data
+func IsInvalidData(err error) bool {
+	return errorCategory(err) == ErrInvalidData
+}
+
+// IsUnauthorized returns true if the error is caused by a destination that the destination authorizer denied
+func IsUnauthorized(err error) bool {
+	return errorCategory(err) == ErrUnauthorized
+}
+
 type notificationChunksInfo struct {
 	maxRequestedOffset int64
 	maxReceivedOffset  int64
 	receivedDataSize   int64
-	chunkResendTimes   map[int64]int64 // This map holds resend time per in-flight chunk (keyed by the offset)
-	chunksReceived     []byte          // This byte array holds a bit per chunk indicating its arrival
+	chunkResendTimes   map[int64]int64   // This map holds resend time per in-flight chunk (keyed by the offset)
+	chunkRequestCounts map[int64]int     // This map holds the number of times each in-flight chunk was requested
+	chunksReceived     []byte            // This byte array holds a bit per chunk indicating its arrival
+	receivedIntervals  *chunkIntervalSet // Used instead of chunksReceived for objects larger than ChunkIntervalSetThreshold
 	chunkSize          int
 	resendTime         int64
+	baseOffset         int64 // The offset of the first requested chunk, the bitmap starts at this chunk
+	dataSize           int64 // The number of bytes to receive, less than the object's size in a patch update
+	objectSize         int64
+	patchRanges        []common.ByteRange
+	priority           int
+	startTime          time.Time // The time the first chunk was requested
+	failed             bool      // A chunk was requested more than MaxChunkResends times, its chunks aren't requested anymore
+	verifyFailures     int       // The number of times the received data failed verification and was requested again
+
+	// The codec of the received copy of the data, set when the first chunk is stored
+	dataCodec *storage.ObjectDataCodec
+
+	// The lengths of the received parts of the chunks that are split across data messages,
+	// keyed by the offsets of the chunk and of the part
+	chunkParts map[int64]map[int64]int64
 }
 
 var registerAsNew bool
 var notificationLock sync.RWMutex
 var consumedLock sync.RWMutex
+var evictionLock sync.Mutex
 var dataChunksLocks common.Locks
 var notificationChunks map[string]notificationChunksInfo
 
+// pendingTransfer is an update of an object whose data waits for a free transfer slot
+type pendingTransfer struct {
+	metaData          common.MetaData
+	maxInflightChunks int
+}
+
+// transferSlots holds the objects whose data is being received from each origin (keyed by the origin), and pendingTransfers
+// holds the updates that wait for a free slot, in the order they were received.
+// They are used only if MaxConcurrentTransfersPerDestination is set.
+var transferSlots map[string]map[string]bool
+var pendingTransfers map[string][]pendingTransfer
+var transferSlotsLock sync.Mutex
+
+// verifyReports holds the report of the last verification of the objects of each destination, keyed by the destination
+var verifyReports map[string]common.VerifyReport
+var verifyReportsLock sync.RWMutex
+
 func init() {
 	notificationChunks = make(map[string]notificationChunksInfo)
+	verifyReports = make(map[string]common.VerifyReport)
+	transferSlots = make(map[string]map[string]bool)
+	pendingTransfers = make(map[string][]pendingTransfer)
 	dataChunksLocks = *common.NewLocks("notification")
 }
 
+// InitLocks initializes the data chunks locks with the configured number of locks, and clears the shutdown of a previous run
+func InitLocks() {
+	dataChunksLocks = *common.NewLocks("notification")
+	resetShutdown()
+}
+
 // CSS: handle ESS registration
 func handleRegistration(dest common.Destination, persistentStorage bool) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
-		return &notificationHandlerError{"ESS cannot register other services"}
+		return &notificationHandlerError{message: "ESS cannot register other services"}
 	}
 
 	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
-		return &notificationHandlerError{("Error in handleRegistration: destination contains invalid characters")}
+		return &notificationHandlerError{message: ("Error in handleRegistration: destination contains invalid characters")}
+	}
+
+	if err := authorizeRegistration(dest); err != nil {
+		return err
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -64,46 +203,165 @@ func handleRegistration(dest common.Destination, persistentStorage bool) common.
 
 	reconnection, err := Store.DestinationExists(dest.DestOrgID, dest.DestType, dest.DestID)
 	if err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to check destination's existence. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration: failed to check destination's existence. Error: %s\n", err)}
 	}
+	offline := reconnection && isDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID)
 
 	if !reconnection {
 		if err := Comm.RegisterAsNew(dest); err != nil {
-			return &notificationHandlerError{"Error in handleRegistration: failed to send register as new notification. Error: " + err.Error()}
+			return &notificationHandlerError{message: "Error in handleRegistration: failed to send register as new notification. Error: " + err.Error(),
+				category: sendFailureCategory(err)}
 		}
 		return &ignoredByHandler{}
 	}
 
-	// Add to the destinations list
+	// The objects that match the attributes of the destination are sent to it if they changed
+	var previousAttributes map[string]string
+	if previous, err := Store.RetrieveDestination(dest.DestOrgID, dest.DestType, dest.DestID); err == nil && previous != nil {
+		previousAttributes = previous.Attributes
+	}
+
+	// Add to the destinations list, storing the destination marks it as online
 	if err := Store.StoreDestination(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to store destination. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration: failed to store destination. Error: %s\n", err)}
+	}
+	if err := Store.UpdateDestinationMessageVersion(dest, negotiateDestinationMessageVersion(dest)); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration: failed to store message version. Error: %s\n", err)}
 	}
 
 	// Ack
 	if err := Comm.RegisterAck(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to send ack. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration: failed to send ack. Error: %s\n", err),
+			category: sendFailureCategory(err)}
 	}
 
 	// If a reconnection, go through the notifications and resend those that have not been acknowledged
 	if log.IsLogging(logger.INFO) {
 		log.Info("Reconnection of: %s %s %s\n", dest.DestOrgID, dest.DestType, dest.DestID)
+		if offline {
+			log.Info("Resuming the suspended notifications of the offline destination %s %s %s\n", dest.DestOrgID,
+				dest.DestType, dest.DestID)
+		}
+	}
+
+	key := dest.DestOrgID + ":" + dest.DestType + ":" + dest.DestID
+	if !beginRegistrationResend(key, !persistentStorage) {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("The notifications of %s were recently resent, coalescing the registration\n", key)
+		}
+		return sendObjectsMatchingAttributes(dest, previousAttributes)
+	}
+	resendReceivedObjects := !persistentStorage
+	for {
+		if err := resendNotificationsForDestination(dest, resendReceivedObjects); err != nil {
+			endRegistrationResend(key, true)
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration. Error: %s\n", err)}
+		}
+		var again bool
+		if again, resendReceivedObjects = endRegistrationResend(key, false); !again {
+			break
+		}
 	}
 
-	if err := resendNotificationsForDestination(dest, !persistentStorage); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration. Error: %s\n", err)}
+	return sendObjectsMatchingAttributes(dest, previousAttributes)
+}
+
+// sendObjectsMatchingAttributes sends a destination that registered again with different attributes the objects
+// that weren't sent to it before, and are sent to the destinations with its new attributes
+func sendObjectsMatchingAttributes(dest common.Destination, previousAttributes map[string]string) common.SyncServiceError {
+	if len(previousAttributes) == len(dest.Attributes) && common.MatchDestinationAttributes(previousAttributes, dest.Attributes) {
+		return nil
 	}
 
-	return nil
+	if log.IsLogging(logger.INFO) {
+		log.Info("The attributes of %s %s %s changed, sending it the objects that match them\n", dest.DestOrgID, dest.DestType, dest.DestID)
+	}
+	objects, err := Store.RetrieveObjects(dest.DestOrgID, dest.DestType, dest.DestID, common.ResendNew)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegistration: failed to retrieve the objects. Error: %s\n", err)}
+	}
+	return notifyNewDestination(dest, objects)
+}
+
+// registrationResend is the state of the resend of the notifications of a destination after its registration
+type registrationResend struct {
+	running   bool
+	completed time.Time
+
+	// again is true if the destination registered again while the notifications were resent,
+	// resendReceivedObjects is true if any of these registrations lost the received objects
+	again                 bool
+	resendReceivedObjects bool
+}
+
+// registrationResends holds the resends of the notifications of the destinations that registered, keyed by the destinations
+var registrationResends = make(map[string]*registrationResend)
+var registrationResendsLock sync.Mutex
+
+// beginRegistrationResend returns true if the notifications of the destination that registered have to be resent.
+// A registration is coalesced with a resend of the destination that is running, or that completed less than
+// RegistrationDebounceInterval seconds ago, unless the received objects have to be resent (the destination lost them).
+func beginRegistrationResend(key string, resendReceivedObjects bool) bool {
+	registrationResendsLock.Lock()
+	defer registrationResendsLock.Unlock()
+
+	resend, ok := registrationResends[key]
+	if !ok {
+		resend = &registrationResend{}
+		registrationResends[key] = resend
+	}
+	if resend.running {
+		resend.again = true
+		resend.resendReceivedObjects = resend.resendReceivedObjects || resendReceivedObjects
+		return false
+	}
+	if !resend.completed.IsZero() && !resendReceivedObjects &&
+		time.Since(resend.completed) < time.Duration(common.Configuration.RegistrationDebounceInterval)*time.Second {
+		return false
+	}
+	resend.running = true
+	return true
+}
+
+// endRegistrationResend ends the resend of the notifications of the destination. It returns true if the destination
+// registered again while the notifications were resent, then the notifications have to be resent again, and whether
+// the received objects have to be resent as well.
+// A failed resend isn't repeated, and doesn't delay the resend of the next registration.
+func endRegistrationResend(key string, failed bool) (bool, bool) {
+	registrationResendsLock.Lock()
+	defer registrationResendsLock.Unlock()
+
+	resend, ok := registrationResends[key]
+	if !ok {
+		return false, false
+	}
+	if failed {
+		delete(registrationResends, key)
+		return false, false
+	}
+	if resend.again {
+		resendReceivedObjects := resend.resendReceivedObjects
+		resend.again = false
+		resend.resendReceivedObjects = false
+		return true, resendReceivedObjects
+	}
+	resend.running = false
+	resend.completed = time.Now()
+	return false, false
 }
 
 // CSS: handle registration of a new ESS
 func handleRegisterNew(dest common.Destination, persistentStorage bool) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
-		return &notificationHandlerError{"ESS cannot register other services"}
+		return &notificationHandlerError{message: "ESS cannot register other services"}
 	}
 
 	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
-		return &notificationHandlerError{("Error in handleRegisterNew: destination contains invalid characters")}
+		return &notificationHandlerError{message: ("Error in handleRegisterNew: destination contains invalid characters")}
+	}
+
+	if err := authorizeRegistration(dest); err != nil {
+		return err
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -112,7 +370,10 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 
 	// Add to the destinations list
 	if err := Store.StoreDestination(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to store destination. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegisterNew: failed to store destination. Error: %s\n", err)}
+	}
+	if err := Store.UpdateDestinationMessageVersion(dest, negotiateDestinationMessageVersion(dest)); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegisterNew: failed to store message version. Error: %s\n", err)}
 	}
 
 	if log.IsLogging(logger.INFO) {
@@ -121,7 +382,8 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 
 	// Ack
 	if err := Comm.RegisterAck(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to send ack. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegisterNew: failed to send ack. Error: %s\n", err),
+			category: sendFailureCategory(err)}
 	}
 
 	resend := common.ResendDelivered
@@ -133,35 +395,85 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 		return err
 	}
 
-	if len(objects) > 0 {
-		destinations := make([]common.Destination, 1)
-		destinations[0] = dest
-		for _, metaData := range objects {
-			lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
-			common.ObjectLocks.Lock(lockIndex)
-			notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
-			common.ObjectLocks.Unlock(lockIndex)
-			if err == nil {
-				if err := SendNotifications(notificationsInfo); err != nil {
-					return err
+	return notifyNewDestination(dest, objects)
+}
+
+// maxAggregatedErrors is the number of errors whose messages are included in an aggregated error
+const maxAggregatedErrors = 5
+
+// notifyNewDestination sends the update notifications of the objects to a newly registered destination,
+// the notifications of up to RegistrationNotificationWorkers objects concurrently.
+// A failure to notify of an object doesn't stop the notifications of the other objects, the errors are aggregated.
+func notifyNewDestination(dest common.Destination, objects []common.MetaData) common.SyncServiceError {
+	if len(objects) == 0 {
+		return nil
+	}
+	destinations := []common.Destination{dest}
+
+	notify := func(metaData common.MetaData) common.SyncServiceError {
+		notificationFanoutLimiter.wait()
+		// The object lock keeps the object's notification record consistent with the concurrent updates of the object
+		lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			return err
+		}
+		return SendNotifications(notificationsInfo)
+	}
+
+	workers := common.Configuration.RegistrationNotificationWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(objects) {
+		workers = len(objects)
+	}
+
+	var failures []error
+	var failuresLock sync.Mutex
+	var waitGroup sync.WaitGroup
+	jobs := make(chan common.MetaData)
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for metaData := range jobs {
+				if err := notify(metaData); err != nil {
+					failuresLock.Lock()
+					failures = append(failures, fmt.Errorf("%s:%s:%s: %s", metaData.DestOrgID, metaData.ObjectType,
+						metaData.ObjectID, strings.TrimSpace(err.Error())))
+					failuresLock.Unlock()
 				}
-			} else {
-				return err
 			}
-		}
+		}()
 	}
+	for _, metaData := range objects {
+		jobs <- metaData
+	}
+	close(jobs)
+	waitGroup.Wait()
 
-	return nil
+	if len(failures) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, maxAggregatedErrors)
+	for i := 0; i < len(failures) && i < maxAggregatedErrors; i++ {
+		messages = append(messages, failures[i].Error())
+	}
+	return &notificationHandlerError{message: fmt.Sprintf("Error in handleRegisterNew: failed to notify %s %s of %d of %d objects. Errors: %s\n",
+		dest.DestType, dest.DestID, len(failures), len(objects), strings.Join(messages, "; "))}
 }
 
 // CSS: handle ESS unregister
 func handleUnregistration(dest common.Destination) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
-		return &notificationHandlerError{"Error: Only CSS can handle the unregistration"}
+		return &notificationHandlerError{message: "Error: Only CSS can handle the unregistration"}
 	}
 
 	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
-		return &notificationHandlerError{("Error in handleUnregistration: destination contains invalid characters")}
+		return &notificationHandlerError{message: ("Error in handleUnregistration: destination contains invalid characters")}
 	}
 
 	if trace.IsLogging(logger.DEBUG) {
@@ -208,11 +520,11 @@ func handleUnregistration(dest common.Destination) common.SyncServiceError {
 // CSS: handle ESS ping
 func handlePing(dest common.Destination) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
-		return &notificationHandlerError{"ESS received ping"}
+		return &notificationHandlerError{message: "ESS received ping"}
 	}
 
 	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
-		return &notificationHandlerError{("Error in handlePing: destination contains invalid characters")}
+		return &notificationHandlerError{message: ("Error in handlePing: destination contains invalid characters")}
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -221,24 +533,97 @@ func handlePing(dest common.Destination) common.SyncServiceError {
 
 	err := Store.UpdateDestinationLastPingTime(dest)
 	if err == nil {
-		return nil
+		if err := updateDestinationAvailableSpace(dest); err != nil {
+			return err
+		}
+		return updateDestinationLastSeen(dest)
 	}
 
 	if !storage.IsNotFound(err) {
-		return &notificationHandlerError{fmt.Sprintf("Error in handlePing: failed to update destination's last ping time. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handlePing: failed to update destination's last ping time. Error: %s\n", err)}
 	}
 
 	// Received ping from a destination that is not in the database
 	if err := Comm.RegisterAsNew(dest); err != nil {
-		return &notificationHandlerError{"Error in handlePing: failed to send register as new notification. Error: " + err.Error()}
+		return &notificationHandlerError{message: "Error in handlePing: failed to send register as new notification. Error: " + err.Error(),
+			category: sendFailureCategory(err)}
+	}
+	return &ignoredByHandler{}
+}
+
+// CSS: handle ESS heartbeat
+func handleHeartbeat(dest common.Destination) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return &notificationHandlerError{message: "ESS received heartbeat"}
+	}
+
+	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
+		return &notificationHandlerError{message: ("Error in handleHeartbeat: destination contains invalid characters")}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling heartbeat of %s %s\n", dest.DestType, dest.DestID)
+	}
+
+	err := updateDestinationLastSeen(dest)
+	if err == nil {
+		return updateDestinationAvailableSpace(dest)
+	}
+	if !storage.IsNotFound(err) {
+		return err
+	}
+
+	// Received heartbeat from a destination that is not in the database
+	if err := Comm.RegisterAsNew(dest); err != nil {
+		return &notificationHandlerError{message: "Error in handleHeartbeat: failed to send register as new notification. Error: " + err.Error(),
+			category: sendFailureCategory(err)}
 	}
 	return &ignoredByHandler{}
 }
 
+// updateDestinationAvailableSpace records the storage space that the destination reported as available, if it reported it.
+// The update notifications of objects that were deferred because they didn't fit are sent by the periodic resend.
+func updateDestinationAvailableSpace(dest common.Destination) common.SyncServiceError {
+	if dest.AvailableSpace == 0 {
+		return nil
+	}
+	if err := Store.UpdateDestinationAvailableSpace(dest); err != nil && !storage.IsNotFound(err) {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in updateDestinationAvailableSpace: failed to update destination's available space. Error: %s\n", err)}
+	}
+	return nil
+}
+
+// updateDestinationLastSeen records that the destination was seen. If the destination was stale,
+// the notifications that were deferred while it was stale are resent. The notifications to an offline
+// destination are resent only when it registers again.
+func updateDestinationLastSeen(dest common.Destination) common.SyncServiceError {
+	stale := isDestinationStale(dest.DestOrgID, dest.DestType, dest.DestID) &&
+		!isDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID)
+
+	if err := Store.UpdateDestinationLastSeen(dest); err != nil {
+		if storage.IsNotFound(err) {
+			return err
+		}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in updateDestinationLastSeen: failed to update destination's last seen time. Error: %s\n", err)}
+	}
+
+	if !stale {
+		return nil
+	}
+
+	if log.IsLogging(logger.INFO) {
+		log.Info("Stale destination is seen again: %s %s %s\n", dest.DestOrgID, dest.DestType, dest.DestID)
+	}
+	if err := resendNotificationsForDestination(dest, false); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in updateDestinationLastSeen. Error: %s\n", err)}
+	}
+	return nil
+}
+
 // Prepare to register as a new ESS and send a registerNew message
 func handleRegisterAsNew() common.SyncServiceError {
 	if common.Configuration.NodeType == common.CSS {
-		return &notificationHandlerError{"CSS received registerAsNew"}
+		return &notificationHandlerError{message: "CSS received registerAsNew"}
 	}
 
 	// Cleanup
@@ -266,6 +651,91 @@ func handleRegisterAsNew() common.SyncServiceError {
 	return nil
 }
 
+// negotiateDestinationMessageVersion returns the message version to use with a registering destination,
+// based on the code version it registered with
+func negotiateDestinationMessageVersion(dest common.Destination) common.SyncServiceVersion {
+	peerVersion, err := common.ParseVersion(dest.CodeVersion)
+	if err != nil {
+		return common.MinMessageVersion
+	}
+	return common.NegotiateMessageVersion(peerVersion)
+}
+
+// ESS: the message version to use with the CSS, negotiated when the CSS acknowledged the registration
+var cssMessageVersion = common.MinMessageVersion
+var cssMessageVersionLock sync.RWMutex
+
+// ESS: negotiate the message version with the CSS that acknowledged the registration
+func setCSSMessageVersion(version common.SyncServiceVersion) {
+	cssMessageVersionLock.Lock()
+	cssMessageVersion = common.NegotiateMessageVersion(version)
+	cssMessageVersionLock.Unlock()
+}
+
+// isDestinationPaused returns true if sending data to the destination was paused by an operator (for CSS)
+func isDestinationPaused(orgID string, destType string, destID string) bool {
+	if common.Configuration.NodeType == common.ESS || destID == "" {
+		return false
+	}
+
+	paused, err := Store.RetrieveDestinationPaused(orgID, destType, destID)
+	return err == nil && paused
+}
+
+// ResumeDestinationTransfers re-arms the resend times of the transfers from the destination, so that the chunks
+// that weren't requested while the destination was paused are requested again in the next resend scan
+func ResumeDestinationTransfers(orgID string, destType string, destID string) {
+	prefix := orgID + ":"
+	suffix := ":" + destType + ":" + destID
+
+	notificationLock.Lock()
+	defer notificationLock.Unlock()
+
+	currentTime := resendClock.Now().Unix()
+	for id, chunksInfo := range notificationChunks {
+		if strings.HasPrefix(id, prefix) && strings.HasSuffix(id, suffix) {
+			chunksInfo.resendTime = currentTime
+			notificationChunks[id] = chunksInfo
+		}
+	}
+}
+
+// messageVersionForDestination returns the message version to use when sending messages to the destination
+func messageVersionForDestination(orgID string, destType string, destID string) common.SyncServiceVersion {
+	if common.Configuration.NodeType == common.ESS {
+		cssMessageVersionLock.RLock()
+		defer cssMessageVersionLock.RUnlock()
+		return cssMessageVersion
+	}
+
+	version, err := Store.RetrieveDestinationMessageVersion(orgID, destType, destID)
+	if err != nil || version == (common.SyncServiceVersion{}) {
+		// Destinations that registered before the message version was negotiated
+		return common.MinMessageVersion
+	}
+	return version
+}
+
+// retrieveNotificationRecord retrieves the notification record that a message received for the object is matched against.
+// A record older than NotificationMaxAge is stale and treated as absent.
+func retrieveNotificationRecord(orgID string, objectType string, objectID string, destType string,
+	destID string) (*common.Notification, common.SyncServiceError) {
+	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	if err != nil || notification == nil || !isStaleNotification(notification) {
+		return notification, err
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Ignoring the stale notification record of %s %s for %s %s\n", objectType, objectID, destType, destID)
+	}
+	return nil, nil
+}
+
+// isStaleNotification returns true if the notification record was created more than NotificationMaxAge seconds ago
+func isStaleNotification(notification *common.Notification) bool {
+	maxAge := int64(common.Configuration.NotificationMaxAge)
+	return maxAge > 0 && notification.CreationTime != 0 && time.Now().Unix()-notification.CreationTime > maxAge
+}
+
 func handleRegAck() {
 	common.Registered = true
 	if registerAsNew {
@@ -304,22 +774,84 @@ func handleRegAck() {
 	Comm.HandleRegAck()
 }
 
+// handleRegDenied handles the denial of the registration of the ESS by the CSS, the ESS stays unregistered
+func handleRegDenied(reason string) {
+	common.Registered = false
+	if log.IsLogging(logger.ERROR) {
+		log.Error("The CSS denied the registration of %s %s. Reason: %s\n", common.Configuration.DestinationType,
+			common.Configuration.DestinationID, reason)
+	}
+}
+
 // Handle a notification about object update
 func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Handling update of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+		trace.Trace("Handling update of %s %s%s\n", metaData.ObjectType, metaData.ObjectID, common.TraceIDTag(&metaData))
+	}
+
+	// The meta data is upgraded when it is parsed, unless the communicator didn't parse it as JSON
+	common.UpgradeMetaData(&metaData)
+
+	// The data URL is used for this update only, it isn't stored with the object
+	dataURL := metaData.DataURL
+	metaData.DataURL = ""
+
+	// The held objects of the type don't wait for the updates that the origin no longer has in flight
+	if metaData.OrderBase != 0 {
+		deliverHeldObjects(metaData.DestOrgID, metaData.ObjectType, metaData.OriginType, metaData.OriginID, metaData.OrderBase)
+	}
+
+	// Reject objects larger than the maximum object size, or whose received chunks would take a bitmap larger than
+	// the maximum bitmap size, before anything is allocated for receiving their data
+	reason := ""
+	if (metaData.Link == "" || common.Configuration.FetchLinkedData) && !metaData.NoData {
+		if common.Configuration.MaxObjectSize > 0 && metaData.ObjectSize > common.Configuration.MaxObjectSize {
+			reason = fmt.Sprintf("The size of the object (%d) exceeds the maximum object size (%d)", metaData.ObjectSize,
+				common.Configuration.MaxObjectSize)
+		} else {
+			reason = checkChunkBitmapSize(metaData)
+		}
+	}
+	if reason != "" {
+		if err := Comm.SendFeedbackMessage(common.ObjectSizeErrorCode, 0, reason, &metaData, true); err != nil &&
+			log.IsLogging(logger.ERROR) {
+			log.Error("Error in handleUpdate: failed to send feedback. Error: %s\n", err)
+		}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: rejected %s %s. %s\n",
+			metaData.ObjectType, metaData.ObjectID, reason), category: ErrInvalidData}
+	}
+
+	// Reject objects that the admission policy doesn't admit
+	if err := admitObject(metaData); err != nil {
+		return err
+	}
+
+	// Reject objects that were relayed back to this node
+	if isInOriginChain(metaData.OriginChain, common.Configuration.DestinationType, common.Configuration.DestinationID) {
+		reason := fmt.Sprintf("The object was already relayed through this node (%s/%s)", common.Configuration.DestinationType,
+			common.Configuration.DestinationID)
+		if err := Comm.SendFeedbackMessage(common.OriginLoopErrorCode, 0, reason, &metaData, true); err != nil &&
+			log.IsLogging(logger.ERROR) {
+			log.Error("Error in handleUpdate: failed to send feedback. Error: %s\n", err)
+		}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: rejected %s %s. %s\n",
+			metaData.ObjectType, metaData.ObjectID, reason), category: ErrInvalidData}
 	}
+	metaData.OriginChain = appendOriginHop(metaData.OriginChain, metaData.OriginType, metaData.OriginID)
 
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	common.ObjectLocks.Lock(lockIndex)
 
 	notificationDataID := int64(-1)
+	merged := false
+	mergedStatus := ""
 	if notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
 		metaData.OriginType, metaData.OriginID); err == nil && notification != nil {
-		if notification.InstanceID >= metaData.InstanceID {
+		if common.CompareInstances(notification.InstanceID, notification.InstanceSequence,
+			metaData.InstanceID, metaData.InstanceSequence) >= 0 {
 			// This object has been sent already, ignore
 			if trace.IsLogging(logger.TRACE) {
-				trace.Trace("Ignoring object update of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+				trace.Trace("Ignoring object update of %s %s%s\n", metaData.ObjectType, metaData.ObjectID, common.TraceIDTag(&metaData))
 			}
 
 			common.ObjectLocks.Unlock(lockIndex)
@@ -330,9 +862,12 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 
 			return &ignoredByHandler{}
 		}
-		Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
-			metaData.OriginType, metaData.OriginID)
-		removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+		// A metadata only update is merged into the stored object, the transfer of its data (if any) goes on
+		if mergedStatus, merged = mergedUpdateStatus(metaData, *notification); !merged {
+			Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+				metaData.OriginType, metaData.OriginID)
+			removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+		}
 		notificationDataID = notification.DataID
 	}
 
@@ -343,17 +878,30 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 	status := common.PartiallyReceived
 	// For new objects notification.DataID will be -1, so we will send getdata for MetaOnly.
 	// metaData.DataID will be 0 for the old code versions, we don't want to ask for data in this case.
-	if metaData.Link != "" || metaData.NoData || (metaData.MetaOnly && (metaData.DataID == notificationDataID || metaData.DataID == 0)) {
+	// The data of objects with a link is fetched from the link if FetchLinkedData is set.
+	if (metaData.Link != "" && !common.Configuration.FetchLinkedData) || metaData.NoData || (metaData.MetaOnly && (metaData.DataID == notificationDataID || metaData.DataID == 0)) {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Set status to completelyReceived for %s %s%s\n", metaData.ObjectType, metaData.ObjectID, common.TraceIDTag(&metaData))
+		}
+		status = common.CompletelyReceived
+	}
+	// An empty object has no data to request, its empty data is stored along with its meta data
+	empty := isEmptyObject(metaData)
+	if empty {
 		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("Set status to completelyReceived for %s %s\n", metaData.ObjectType, metaData.ObjectID)
+			trace.Debug("%s %s is empty, set status to completelyReceived%s\n", metaData.ObjectType, metaData.ObjectID,
+				common.TraceIDTag(&metaData))
 		}
 		status = common.CompletelyReceived
 	}
+	if merged {
+		status = mergedStatus
+	}
 
 	existingMeta, existingLastDestinationPolicyServices, err := Store.RetrieveObjectAndRemovedDestinationPolicyServices(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to get existing ESS object and existingLastDestinationPolicyServices. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to get existing ESS object and existingLastDestinationPolicyServices. Error: %s\n", err)}
 	}
 	if existingMeta == nil {
 		if trace.IsLogging(logger.DEBUG) {
@@ -364,10 +912,56 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 		trace.Debug("existingLastDestinationPolicyServices length: %d\n", len(existingLastDestinationPolicyServices))
 	}
 
+	if status == common.PartiallyReceived && !merged && hasObjectData(existingMeta, metaData) {
+		// The stored data is the data of the update (e.g., the update was resent after a reconnect), don't request it again
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("The data of %s %s is already stored, set status to completelyReceived%s\n", metaData.ObjectType, metaData.ObjectID,
+				common.TraceIDTag(&metaData))
+		}
+		metaData.MetaOnly = true
+		status = common.CompletelyReceived
+	}
+
+	if len(metaData.PatchRanges) != 0 && status == common.PartiallyReceived {
+		metaData.PatchRanges = getPatchRanges(existingMeta, metaData)
+		if metaData.PatchRanges != nil && metaData.DestinationDataURI != "" {
+			if err := dataURI.PrepareDataPatch(metaData.DestinationDataURI, metaData.ObjectSize); err != nil {
+				metaData.PatchRanges = nil
+			}
+		}
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Patch update of %s %s with %d ranges\n", metaData.ObjectType, metaData.ObjectID, len(metaData.PatchRanges))
+		}
+	} else {
+		metaData.PatchRanges = nil
+	}
+
+	if status == common.CompletelyReceived {
+		status = receivedObjectStatus(metaData)
+	}
+
 	// Store the object
-	if _, err := Store.StoreObject(metaData, nil, status); err != nil {
-		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to store object. Error: %s\n", err)}
+	if merged {
+		if err := Store.UpdateObjectMetadataOnly(metaData, status); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to update object's meta data. Error: %s\n", err)}
+		}
+	} else {
+		var data []byte
+		if empty {
+			if metaData.DestinationDataURI != "" {
+				if _, err := dataURI.StoreData(metaData.DestinationDataURI, bytes.NewReader(nil), 0); err != nil {
+					common.ObjectLocks.Unlock(lockIndex)
+					return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to store empty data. Error: %s\n", err)}
+				}
+			} else {
+				data = []byte{}
+			}
+		}
+		if _, err := Store.StoreObject(metaData, data, status); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to store object. Error: %s\n", err)}
+		}
 	}
 
 	// update the RemovedDestinationPolicyServices for ESS
@@ -407,46 +1001,459 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 
 			if err = Store.UpdateRemovedDestinationPolicyServices(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, existingLastDestinationPolicyServices); err != nil {
 				common.ObjectLocks.Unlock(lockIndex)
-				return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to update removedDestinationPolicyServices. Error: %s\n", err)}
+				return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to update removedDestinationPolicyServices. Error: %s\n", err)}
 			}
 		}
 
 	}
 
-	if status == common.CompletelyReceived {
+	if empty {
+		return completeObjectReceipt(metaData, lockIndex)
+	}
+
+	if status == common.CompletelyReceived || status == common.HeldInOrder {
 		notificationsInfo, err := PrepareObjectStatusNotification(metaData, common.Received)
 		common.ObjectLocks.Unlock(lockIndex)
 		if err != nil {
 			return err
 		}
+		if status == common.HeldInOrder {
+			defer deliverHeldObjects(metaData.DestOrgID, metaData.ObjectType, metaData.OriginType, metaData.OriginID, metaData.OrderBase)
+		}
 		return SendNotifications(notificationsInfo)
 	}
 
-	common.ObjectLocks.Unlock(lockIndex)
-
-	// Call Notification module to send notification to object’s sender
-	if err := Comm.SendNotificationMessage(common.Updated, metaData.OriginType, metaData.OriginID, metaData.InstanceID, metaData.DataID,
-		&metaData); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to send notification. Error: %s\n", err)}
-	}
-
-	Comm.LockDataChunks(lockIndex, &metaData)
-	defer Comm.UnlockDataChunks(lockIndex, &metaData)
-	if metaData.ChunkSize <= 0 || metaData.ObjectSize <= 0 {
-		if err := Comm.GetData(metaData, 0); err != nil {
-			return err
+	if merged {
+		// The data of the object keeps being received. The notification record moves to the new instance, so that the data
+		// requested for the new instance is accepted.
+		err := updateNotificationRecord(
+			common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType, DestOrgID: metaData.DestOrgID,
+				DestID: metaData.OriginID, DestType: metaData.OriginType, Status: common.Getdata, InstanceID: metaData.InstanceID,
+				InstanceSequence: metaData.InstanceSequence, DataID: metaData.DataID})
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to update notification record. Error: %s\n", err)}
 		}
-	} else {
-		var offset int64
-		for i := 0; i < maxInflightChunks && offset < metaData.ObjectSize; i++ {
-			if err := Comm.GetData(metaData, offset); err != nil {
-				return err
-			}
-			offset += int64(metaData.ChunkSize)
+		if err := Comm.SendNotificationMessage(common.Updated, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+			metaData.DataID, &metaData); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to send notification. Error: %s\n", err),
+				category: sendFailureCategory(err)}
 		}
+		return nil
 	}
 
-	return nil
+	if IsShuttingDown() {
+		// No new transfers are started while shutting down. The update isn't acknowledged, so the origin resends it.
+		common.ObjectLocks.Unlock(lockIndex)
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Shutting down, the data of %s %s isn't requested%s\n", metaData.ObjectType, metaData.ObjectID,
+				common.TraceIDTag(&metaData))
+		}
+		return nil
+	}
+
+	if metaData.Link != "" {
+		// The data is fetched from the link rather than requested from the origin
+		common.ObjectLocks.Unlock(lockIndex)
+		if err := Comm.SendNotificationMessage(common.Updated, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+			metaData.DataID, &metaData); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to send notification. Error: %s\n", err),
+				category: sendFailureCategory(err)}
+		}
+		go func() {
+			if err := fetchLinkedData(metaData); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error(err.Error())
+			}
+		}()
+		return nil
+	}
+
+	if dataURL != "" && metaData.DestinationDataURI == "" {
+		// The data is downloaded from the data URL that the origin provided rather than requested in chunks
+		common.ObjectLocks.Unlock(lockIndex)
+		if err := Comm.SendNotificationMessage(common.Updated, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+			metaData.DataID, &metaData); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to send notification. Error: %s\n", err),
+				category: sendFailureCategory(err)}
+		}
+		go func() {
+			if err := fetchDataURL(metaData, dataURL, maxInflightChunks); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error(err.Error())
+			}
+		}()
+		return nil
+	}
+
+	if !acquireTransferSlot(metaData, maxInflightChunks) {
+		// The update isn't acknowledged until the transfer starts, so the origin keeps resending it
+		common.ObjectLocks.Unlock(lockIndex)
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("The data of %s %s waits for a free transfer slot%s\n", metaData.ObjectType, metaData.ObjectID,
+				common.TraceIDTag(&metaData))
+		}
+		return nil
+	}
+
+	common.ObjectLocks.Unlock(lockIndex)
+
+	return requestObjectData(metaData, maxInflightChunks)
+}
+
+// isEmptyObject returns true if the object has data, and its data is empty. Unlike an object without data (NoData) or
+// a meta data only update (MetaOnly), the empty data of an empty object is stored and can be read by the applications.
+func isEmptyObject(metaData common.MetaData) bool {
+	return metaData.ObjectSize == 0 && !metaData.NoData && !metaData.MetaOnly && metaData.Link == "" && len(metaData.PatchRanges) == 0
+}
+
+// completeObjectReceipt completes the receipt of an object whose data wasn't received in chunks (an empty object, or an object
+// whose data was downloaded from its data URL) like the receipt of the last chunk of an object's data: the object's signature
+// is verified, the origin is notified that the object was received, and the webhooks are called.
+// Must be called while holding the object's lock, which it releases.
+func completeObjectReceipt(metaData common.MetaData, lockIndex uint32) common.SyncServiceError {
+	if reason, err := signatureRejectionReason(metaData); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to verify signature. Error: %s\n", err)}
+	} else if reason != "" {
+		err := rejectObjectData(metaData, reason)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to reject data. Error: %s\n", err)}
+		}
+		// The origin stops sending the object, and marks its delivery as failed
+		if err := Comm.SendNotificationMessage(common.Cancel, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+			metaData.DataID, &metaData); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to notify the origin. Error: %s\n", err),
+				category: sendFailureCategory(err)}
+		}
+		return nil
+	}
+
+	notificationsInfo, err := PrepareObjectStatusNotification(metaData, common.Received)
+	common.ObjectLocks.Unlock(lockIndex)
+	if err != nil {
+		return err
+	}
+	if err := SendNotifications(notificationsInfo); err != nil {
+		return err
+	}
+	deliverReceivedObject(&metaData)
+	return nil
+}
+
+// mergedUpdateStatus returns the status of the stored object once the metadata only update is merged into it, or false if
+// the update isn't merged. The update is merged if the data that is stored, or is being received, is the update's data.
+// The data of an object that is being received keeps being received, otherwise the object is completely received.
+// Must be called while holding the object's lock.
+func mergedUpdateStatus(metaData common.MetaData, notification common.Notification) (string, bool) {
+	if !metaData.MetaOnly || metaData.Link != "" || metaData.DataID == 0 || metaData.DataID != notification.DataID {
+		return "", false
+	}
+	storedMetaData, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || storedMetaData == nil || storedMetaData.DataID != metaData.DataID {
+		return "", false
+	}
+	switch status {
+	case common.PartiallyReceived:
+		if notification.Status == common.Getdata {
+			return status, true
+		}
+	case common.CompletelyReceived, common.HeldInOrder, common.ObjReceived, common.ObjConsumed:
+		return common.CompletelyReceived, true
+	}
+	return "", false
+}
+
+// isInOriginChain returns true if the node is in the origin chain of an object
+func isInOriginChain(chain []common.OriginHop, nodeType string, nodeID string) bool {
+	for _, hop := range chain {
+		if hop.Type == nodeType && hop.ID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// appendOriginHop appends the sender of an object to its origin chain, unless the sender already appended itself
+func appendOriginHop(chain []common.OriginHop, originType string, originID string) []common.OriginHop {
+	if originType == "" && originID == "" {
+		return chain
+	}
+	if last := len(chain) - 1; last >= 0 && chain[last].Type == originType && chain[last].ID == originID {
+		return chain
+	}
+	result := make([]common.OriginHop, len(chain), len(chain)+1)
+	copy(result, chain)
+	return append(result, common.OriginHop{Type: originType, ID: originID})
+}
+
+// hasObjectData returns true if the stored object holds the complete data of the update
+func hasObjectData(existingMeta *common.MetaData, metaData common.MetaData) bool {
+	// metaData.DataID will be 0 for the old code versions
+	if existingMeta == nil || metaData.DataID == 0 || existingMeta.DataID != metaData.DataID ||
+		existingMeta.NoData || existingMeta.Link != "" || existingMeta.DestinationDataURI != "" {
+		return false
+	}
+	if common.CompareInstances(existingMeta.InstanceID, existingMeta.InstanceSequence, metaData.InstanceID, metaData.InstanceSequence) > 0 {
+		return false
+	}
+	existingStatus, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return false
+	}
+	return existingStatus == common.CompletelyReceived || existingStatus == common.HeldInOrder || existingStatus == common.ObjReceived
+}
+
+// requestObjectData acknowledges the update of the object and requests the first chunks of its data from its origin
+func requestObjectData(metaData common.MetaData, maxInflightChunks int) common.SyncServiceError {
+	// Call Notification module to send notification to object’s sender
+	if err := Comm.SendNotificationMessage(common.Updated, metaData.OriginType, metaData.OriginID, metaData.InstanceID, metaData.DataID,
+		&metaData); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleUpdate: failed to send notification. Error: %s\n", err),
+			category: sendFailureCategory(err)}
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	Comm.LockDataChunks(lockIndex, &metaData)
+	defer Comm.UnlockDataChunks(lockIndex, &metaData)
+	for _, offset := range getInitialChunkOffsets(metaData, getPriorityShare(metaData, maxInflightChunks)) {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acquireTransferSlot returns true if the data of the object can be requested from its origin without exceeding
+// MaxConcurrentTransfersPerDestination. Otherwise, the update is queued until a transfer from the origin completes.
+func acquireTransferSlot(metaData common.MetaData, maxInflightChunks int) bool {
+	limit := common.Configuration.MaxConcurrentTransfersPerDestination
+	if limit <= 0 {
+		return true
+	}
+	origin := metaData.DestOrgID + ":" + metaData.OriginType + ":" + metaData.OriginID
+	object := metaData.ObjectType + ":" + metaData.ObjectID
+
+	transferSlotsLock.Lock()
+	defer transferSlotsLock.Unlock()
+
+	slots := transferSlots[origin]
+	if slots[object] {
+		return true
+	}
+	pending := pendingTransfers[origin]
+	for i, transfer := range pending {
+		if transfer.metaData.ObjectType == metaData.ObjectType && transfer.metaData.ObjectID == metaData.ObjectID {
+			// A newer update of a waiting object replaces the waiting update
+			pending[i] = pendingTransfer{metaData, maxInflightChunks}
+			return false
+		}
+	}
+	if len(slots) < limit {
+		if slots == nil {
+			slots = make(map[string]bool)
+			transferSlots[origin] = slots
+		}
+		slots[object] = true
+		return true
+	}
+	pendingTransfers[origin] = append(pending, pendingTransfer{metaData, maxInflightChunks})
+	return false
+}
+
+// releaseTransferSlot frees the transfer slot of the object, if it holds one, and starts the transfer of the next
+// object that waits for a slot of the origin
+func releaseTransferSlot(orgID string, objectType string, objectID string, originType string, originID string) {
+	origin := orgID + ":" + originType + ":" + originID
+	object := objectType + ":" + objectID
+
+	transferSlotsLock.Lock()
+	slots := transferSlots[origin]
+	if !slots[object] {
+		transferSlotsLock.Unlock()
+		return
+	}
+	delete(slots, object)
+	var next *pendingTransfer
+	if pending := pendingTransfers[origin]; len(pending) > 0 {
+		next = &pending[0]
+		slots[next.metaData.ObjectType+":"+next.metaData.ObjectID] = true
+		if len(pending) == 1 {
+			delete(pendingTransfers, origin)
+		} else {
+			pendingTransfers[origin] = pending[1:]
+		}
+	}
+	if len(slots) == 0 {
+		delete(transferSlots, origin)
+	}
+	transferSlotsLock.Unlock()
+
+	if next != nil {
+		// Called while the lock of the completed object is held, the next object is locked by another goroutine
+		go startPendingTransfer(*next)
+	}
+}
+
+// removePendingTransfer removes the update of the object from the updates that wait for a free transfer slot, if it waits
+func removePendingTransfer(metaData common.MetaData) {
+	origin := metaData.DestOrgID + ":" + metaData.OriginType + ":" + metaData.OriginID
+
+	transferSlotsLock.Lock()
+	defer transferSlotsLock.Unlock()
+
+	pending := pendingTransfers[origin]
+	for i, transfer := range pending {
+		if transfer.metaData.ObjectType == metaData.ObjectType && transfer.metaData.ObjectID == metaData.ObjectID {
+			if len(pending) == 1 {
+				delete(pendingTransfers, origin)
+			} else {
+				pendingTransfers[origin] = append(pending[:i:i], pending[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// startPendingTransfer requests the data of an object that waited for a free transfer slot
+func startPendingTransfer(transfer pendingTransfer) {
+	metaData := transfer.metaData
+	if IsShuttingDown() {
+		return
+	}
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.Lock(lockIndex)
+	storedMeta, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.Unlock(lockIndex)
+
+	if err != nil || storedMeta == nil || status != common.PartiallyReceived ||
+		common.CompareInstances(storedMeta.InstanceID, storedMeta.InstanceSequence, metaData.InstanceID, metaData.InstanceSequence) != 0 {
+		// The object was updated or deleted while it waited
+		releaseTransferSlot(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		return
+	}
+
+	if err := requestObjectData(metaData, transfer.maxInflightChunks); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to request the data of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, err)
+		}
+		id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		notificationLock.RLock()
+		_, ok := notificationChunks[id]
+		notificationLock.RUnlock()
+		if !ok {
+			// No chunk was requested, the update is resent by the origin
+			releaseTransferSlot(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		}
+	}
+}
+
+// getPatchRanges returns the byte ranges of the updated object's data to request from its origin, or nil if the whole data
+// has to be requested. The data can be patched only if this node holds the data that the object's patch ranges apply to.
+// The stored data isn't patched if a data codec is registered, as the patched ranges would be encoded again with the key
+// stream of the existing copy of the data.
+// The returned ranges are sorted by their offsets, and include the data appended beyond the previous size of the object.
+func getPatchRanges(existingMeta *common.MetaData, metaData common.MetaData) []common.ByteRange {
+	if existingMeta == nil || existingMeta.DataID != metaData.PatchBaseDataID || existingMeta.NoData || existingMeta.Link != "" ||
+		existingMeta.ObjectSize <= 0 || existingMeta.DestinationDataURI != metaData.DestinationDataURI || metaData.ChunkSize <= 0 || metaData.ObjectSize <= 0 {
+		return nil
+	}
+	if metaData.DestinationDataURI == "" && (!Store.SupportsDataPatch() || storage.HasDataCodec()) {
+		return nil
+	}
+	status, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || (status != common.CompletelyReceived && status != common.HeldInOrder && status != common.ObjReceived &&
+		status != common.ConsumedByDest) {
+		return nil
+	}
+	// Over HTTP the data is always transferred as a whole
+	protocol := common.Configuration.CommunicationProtocol
+	if common.Configuration.NodeType == common.CSS {
+		if protocol, err = Store.RetrieveDestinationProtocol(metaData.DestOrgID, metaData.OriginType, metaData.OriginID); err != nil {
+			return nil
+		}
+	}
+	if protocol == common.HTTPProtocol {
+		return nil
+	}
+
+	ranges := make([]common.ByteRange, 0, len(metaData.PatchRanges)+1)
+	for _, patchRange := range metaData.PatchRanges {
+		if patchRange.Offset < 0 || patchRange.Length <= 0 || patchRange.Offset >= metaData.ObjectSize {
+			continue
+		}
+		if patchRange.Offset+patchRange.Length > metaData.ObjectSize {
+			patchRange.Length = metaData.ObjectSize - patchRange.Offset
+		}
+		ranges = append(ranges, patchRange)
+	}
+	if existingMeta.ObjectSize < metaData.ObjectSize {
+		ranges = append(ranges, common.ByteRange{Offset: existingMeta.ObjectSize, Length: metaData.ObjectSize - existingMeta.ObjectSize})
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Offset < ranges[j].Offset })
+	return ranges
+}
+
+// firstChunkOffset returns the offset of the first chunk of the object's data to request from its origin
+func firstChunkOffset(metaData common.MetaData) int64 {
+	if len(metaData.PatchRanges) == 0 || metaData.ChunkSize <= 0 {
+		return 0
+	}
+	offset := metaData.PatchRanges[0].Offset
+	return offset - offset%int64(metaData.ChunkSize)
+}
+
+// nextChunkOffset returns the offset of the chunk to request after the chunk at offset, and false if there are no more chunks.
+// In a patch update only the chunks that overlap the patch ranges are requested.
+func nextChunkOffset(metaData common.MetaData, offset int64) (int64, bool) {
+	chunkSize := int64(metaData.ChunkSize)
+	next := offset + chunkSize
+	if len(metaData.PatchRanges) == 0 {
+		return next, next < metaData.ObjectSize
+	}
+	for _, patchRange := range metaData.PatchRanges {
+		if patchRange.Offset+patchRange.Length <= next {
+			continue
+		}
+		if start := patchRange.Offset - patchRange.Offset%chunkSize; start > next {
+			next = start
+		}
+		return next, true
+	}
+	return 0, false
+}
+
+// getInitialChunkOffsets returns the offsets of the first maxInflightChunks chunks of the object's data to request from its origin
+func getInitialChunkOffsets(metaData common.MetaData, maxInflightChunks int) []int64 {
+	if metaData.ChunkSize <= 0 || metaData.ObjectSize <= 0 {
+		return []int64{0}
+	}
+	offsets := make([]int64, 0, maxInflightChunks)
+	offset, ok := firstChunkOffset(metaData), true
+	for i := 0; i < maxInflightChunks && ok; i++ {
+		offsets = append(offsets, offset)
+		offset, ok = nextChunkOffset(metaData, offset)
+	}
+	return offsets
+}
+
+// getDataSizeToReceive returns the number of bytes of the object's data requested from its origin
+func getDataSizeToReceive(metaData common.MetaData) int64 {
+	if len(metaData.PatchRanges) == 0 || metaData.ChunkSize <= 0 {
+		return metaData.ObjectSize
+	}
+	var size int64
+	for offset, ok := firstChunkOffset(metaData), true; ok; offset, ok = nextChunkOffset(metaData, offset) {
+		if end := offset + int64(metaData.ChunkSize); end > metaData.ObjectSize {
+			size += metaData.ObjectSize - offset
+		} else {
+			size += int64(metaData.ChunkSize)
+		}
+	}
+	return size
 }
 
 // Handle a notification that an object's update was received by the other side
@@ -460,11 +1467,12 @@ func handleObjectUpdated(orgID string, objectType string, objectID string, destT
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil || notification == nil {
-		return &notificationHandlerError{"Error in handleObjectUpdated: no notification to update."}
+		return &notificationHandlerError{message: "Error in handleObjectUpdated: no notification to update.",
+			category: ErrNotificationNotFound}
 	}
-	if notification.InstanceID != instanceID || (notification.Status != common.Update && notification.Status != common.UpdatePending) {
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 || (notification.Status != common.Update && notification.Status != common.UpdatePending) {
 		// This notification doesn't match the existing notification record, ignore
 		if trace.IsLogging(logger.TRACE) {
 			trace.Trace("Ignoring object updated of %s %s\n", objectType, objectID)
@@ -472,7 +1480,7 @@ func handleObjectUpdated(orgID string, objectType string, objectID string, destT
 		return &ignoredByHandler{}
 	}
 
-	Store.UpdateNotificationRecord(
+	updateNotificationRecord(
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
 			DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.Updated, InstanceID: instanceID, DataID: dataID})
 
@@ -495,22 +1503,22 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectConsumed: failed to retrieve notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectConsumed: failed to retrieve notification record. Error: %s\n", err)}
 	}
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectConsumed: failed to retrieve object. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectConsumed: failed to retrieve object. Error: %s\n", err)}
 	}
-	if notification == nil || metaData == nil || notification.InstanceID != instanceID ||
+	if notification == nil || metaData == nil || common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 ||
 		(notification.Status != common.Data && notification.Status != common.Updated && notification.Status != common.ReceivedByDestination) {
 		// Something went wrong: we can't retrieve the notification or the object, or the received notification doesn't
 		// match the existing notification record
 		if trace.IsLogging(logger.TRACE) {
-			trace.Trace("Ignoring object consumed of %s %s\n", objectType, objectID)
+			trace.Trace("Ignoring object consumed of %s %s%s\n", objectType, objectID, common.TraceIDTag(metaData))
 		}
 		common.ObjectLocks.Unlock(lockIndex)
 		// Send ack to prevent future resends of this notification
@@ -519,6 +1527,9 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 				OriginType: common.Configuration.DestinationType, OriginID: common.Configuration.DestinationID, InstanceID: instanceID, DataID: dataID})
 		return &ignoredByHandler{}
 	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("%s %s was consumed by %s %s%s\n", objectType, objectID, destType, destID, common.TraceIDTag(metaData))
+	}
 
 	if common.Configuration.NodeType == common.ESS {
 		// On ESS we keep consumed objects up to ESSConsumedObjectsKept, and then we remove the oldest
@@ -542,10 +1553,9 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 					index := common.HashStrings(objectToDelete.DestOrgID, objectToDelete.ObjectType, objectToDelete.ObjectID)
 					common.ObjectLocks.ConditionalLock(index, lockIndex)
 					stored, status, err := Store.RetrieveObjectAndStatus(objectToDelete.DestOrgID, objectToDelete.ObjectType, objectToDelete.ObjectID)
-					if err == nil && status == common.ConsumedByDest && stored.InstanceID == objectToDelete.InstanceID {
-						if err = storage.DeleteStoredObject(Store, objectToDelete); err != nil && log.IsLogging(logger.ERROR) {
-							log.Error("Error in handleObjectConsumed: failed to delete stored object. Error: %s\n", err)
-						}
+					if err == nil && status == common.ConsumedByDest && common.CompareInstances(stored.InstanceID, stored.InstanceSequence,
+						objectToDelete.InstanceID, objectToDelete.InstanceSequence) == 0 {
+						deleteStoredObjectWithRetry(objectToDelete)
 					}
 					common.ObjectLocks.ConditionalUnlock(index, lockIndex)
 				}
@@ -569,24 +1579,64 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 			log.Error("Error in handleObjectConsumed: failed to mark object as delivered to the destination. Error: %s\n", err)
 		}
 		// Mark the corresponding update notification as "consumed by destination"
-		if err := Store.UpdateNotificationRecord(
+		if err := updateNotificationRecord(
 			common.Notification{ObjectID: objectID, ObjectType: objectType,
 				DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.ConsumedByDestination,
 				InstanceID: instanceID, DataID: dataID},
 		); err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
-			return &notificationHandlerError{fmt.Sprintf("Error in handleObjectConsumed: failed to update notification record. Error: %s\n", err)}
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectConsumed: failed to update notification record. Error: %s\n", err)}
 		}
 	}
 
 	common.ObjectLocks.Unlock(lockIndex)
 
 	// Send ack
-	if err := Comm.SendNotificationMessage(common.AckConsumed, destType, destID, instanceID, dataID, metaData); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectConsumed: failed to send notification. Error: %s\n",
-			err)}
+	if err := sendAck(common.AckConsumed, destType, destID, instanceID, dataID, metaData); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectConsumed: failed to send notification. Error: %s\n",
+			err), category: sendFailureCategory(err)}
+	}
+
+	return nil
+}
+
+// Handle a notification that the other side consumed an object's data up to offset, before consuming the whole object.
+// The consumed offset is recorded in the object's delivery status for the destination. The notification isn't acked:
+// if it is lost, a later notification reports a greater offset, and the object is eventually marked as consumed.
+func handleObjectPartiallyConsumed(orgID string, objectType string, objectID string, destType string, destID string,
+	instanceID int64, dataID int64, offset int64) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling object partially consumed of %s %s up to offset %d\n", objectType, objectID, offset)
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectPartiallyConsumed: failed to retrieve notification record. Error: %s\n", err)}
+	}
+	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectPartiallyConsumed: failed to retrieve object. Error: %s\n", err)}
+	}
+	if notification == nil || metaData == nil || common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 ||
+		(notification.Status != common.Data && notification.Status != common.Updated && notification.Status != common.ReceivedByDestination) {
+		// The notification doesn't match the existing notification record, or the object was already consumed
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Ignoring object partially consumed of %s %s%s\n", objectType, objectID, common.TraceIDTag(metaData))
+		}
+		return &ignoredByHandler{}
+	}
+	if offset < 0 || offset > metaData.ObjectSize {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectPartiallyConsumed: invalid offset %d of %s %s of size %d",
+			offset, objectType, objectID, metaData.ObjectSize), category: ErrInvalidData}
 	}
 
+	if err := Store.UpdateObjectConsumedOffset(orgID, objectType, objectID, destType, destID, offset); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectPartiallyConsumed: failed to update the consumed offset. Error: %s\n", err)}
+	}
 	return nil
 }
 
@@ -600,11 +1650,12 @@ func handleAckConsumed(orgID string, objectType string, objectID string, destTyp
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil || notification == nil {
-		return &notificationHandlerError{"Error in handleAckConsumed: no notification to update."}
+		return &notificationHandlerError{message: "Error in handleAckConsumed: no notification to update.",
+			category: ErrNotificationNotFound}
 	}
-	if notification.InstanceID != instanceID || (notification.Status != common.Consumed && notification.Status != common.ConsumedPending) {
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 || (notification.Status != common.Consumed && notification.Status != common.ConsumedPending) {
 		// This notification doesn't match the existing notification record, ignore
 		if trace.IsLogging(logger.TRACE) {
 			trace.Trace("Ignoring ack consumed of %s %s\n", objectType, objectID)
@@ -613,20 +1664,17 @@ func handleAckConsumed(orgID string, objectType string, objectID string, destTyp
 	}
 
 	// Mark the notification as ackconsumed
-	if err := Store.UpdateNotificationRecord(
+	if err := updateNotificationRecord(
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
 			DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.AckConsumed, InstanceID: instanceID, DataID: dataID},
 	); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleAckConsumed: failed to update notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleAckConsumed: failed to update notification record. Error: %s\n", err)}
 	}
 
 	// Delete the object
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err == nil && metaData != nil {
-		err = storage.DeleteStoredObject(Store, *metaData)
-		if err != nil && log.IsLogging(logger.ERROR) {
-			log.Error("Error in handleAckConsumed: failed to delete stored object. Error: %s\n", err)
-		}
+		deleteStoredObjectWithRetry(*metaData)
 	}
 	err = Store.DeleteNotificationRecords(orgID, objectType, objectID, "", "")
 	if err != nil && log.IsLogging(logger.ERROR) {
@@ -646,23 +1694,23 @@ func handleObjectReceived(orgID string, objectType string, objectID string, dest
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectReceived: failed to retrieve notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectReceived: failed to retrieve notification record. Error: %s\n", err)}
 	}
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectReceived: failed to retrieve object. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectReceived: failed to retrieve object. Error: %s\n", err)}
 	}
-	if notification == nil || metaData == nil || notification.InstanceID != instanceID ||
+	if notification == nil || metaData == nil || common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 ||
 		(notification.Status != common.Data && notification.Status != common.Updated &&
 			notification.Status != common.Update && notification.Status != common.UpdatePending) {
 		// Something went wrong: we can't retrieve the notification or the object, or the received notification doesn't
 		// match the existing notification record
 		if trace.IsLogging(logger.TRACE) {
-			trace.Trace("Ignoring object received of %s %s\n", objectType, objectID)
+			trace.Trace("Ignoring object received of %s %s%s\n", objectType, objectID, common.TraceIDTag(metaData))
 		}
 		common.ObjectLocks.Unlock(lockIndex)
 		// Send ack to prevent future resends of this notification
@@ -671,6 +1719,9 @@ func handleObjectReceived(orgID string, objectType string, objectID string, dest
 				OriginType: common.Configuration.DestinationType, OriginID: common.Configuration.DestinationID, InstanceID: instanceID, DataID: dataID})
 		return &ignoredByHandler{}
 	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("%s %s was received by %s %s%s\n", objectType, objectID, destType, destID, common.TraceIDTag(metaData))
+	}
 
 	// Mark that the object was delivered to this destination
 	_, err = Store.UpdateObjectDeliveryStatus(common.Delivered, "", orgID, objectType, objectID, destType, destID)
@@ -678,20 +1729,20 @@ func handleObjectReceived(orgID string, objectType string, objectID string, dest
 		log.Error("Error in handleObjectReceived: failed to mark object as delivered to the destination. Error: %s\n", err)
 	}
 	// Mark the corresponding update notification as "received by destination"
-	if err := Store.UpdateNotificationRecord(
+	if err := updateNotificationRecord(
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
 			DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.ReceivedByDestination, InstanceID: instanceID, DataID: dataID},
 	); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectReceived: failed to update notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectReceived: failed to update notification record. Error: %s\n", err)}
 	}
 
 	common.ObjectLocks.Unlock(lockIndex)
 
 	// Send ack
-	if err := Comm.SendNotificationMessage(common.AckReceived, destType, destID, instanceID, dataID, metaData); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectReceived: failed to send notification. Error: %s\n",
-			err)}
+	if err := sendAck(common.AckReceived, destType, destID, instanceID, dataID, metaData); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectReceived: failed to send notification. Error: %s\n",
+			err), category: sendFailureCategory(err)}
 	}
 
 	return nil
@@ -707,11 +1758,12 @@ func handleAckObjectReceived(orgID string, objectType string, objectID string, d
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil || notification == nil {
-		return &notificationHandlerError{"Error in handleAckObjectReceived: no notification to update."}
+		return &notificationHandlerError{message: "Error in handleAckObjectReceived: no notification to update.",
+			category: ErrNotificationNotFound}
 	}
-	if notification.InstanceID != instanceID || (notification.Status != common.Received && notification.Status != common.ReceivedPending) {
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 || (notification.Status != common.Received && notification.Status != common.ReceivedPending) {
 		// This notification doesn't match the existing notification record, ignore
 		if trace.IsLogging(logger.TRACE) {
 			trace.Trace("Ignoring ack received of %s %s\n", objectType, objectID)
@@ -720,20 +1772,51 @@ func handleAckObjectReceived(orgID string, objectType string, objectID string, d
 	}
 
 	// Mark the notification as ackreceived
-	if err := Store.UpdateNotificationRecord(
+	if err := updateNotificationRecord(
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
 			DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.AckReceived, InstanceID: instanceID, DataID: dataID},
 	); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleAckObjectReceived: failed to update notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleAckObjectReceived: failed to update notification record. Error: %s\n", err)}
 	}
 
 	return nil
 }
 
+// Handle a batch of acks of received and consumed notifications sent together by the other side
+func handleAckBatch(orgID string, acks []common.AckEntry) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling batch of %d acks\n", len(acks))
+	}
+
+	var result common.SyncServiceError
+	for _, ack := range acks {
+		var err common.SyncServiceError
+		switch ack.Command {
+		case common.AckReceived:
+			err = handleAckObjectReceived(orgID, ack.ObjectType, ack.ObjectID, ack.OriginType, ack.OriginID, ack.InstanceID, ack.DataID)
+		case common.AckConsumed:
+			err = handleAckConsumed(orgID, ack.ObjectType, ack.ObjectID, ack.OriginType, ack.OriginID, ack.InstanceID, ack.DataID)
+		default:
+			err = &notificationHandlerError{message: fmt.Sprintf("Error in handleAckBatch: invalid ack %s of %s %s\n",
+				ack.Command, ack.ObjectType, ack.ObjectID)}
+		}
+		if err == nil || isIgnoredByHandler(err) {
+			continue
+		}
+		// The remaining acks are handled, the first error is returned and the others are logged
+		if result == nil {
+			result = err
+		} else if log.IsLogging(logger.ERROR) {
+			log.Error(err.Error())
+		}
+	}
+	return result
+}
+
 // Handle a notification about object delete
 func handleDelete(metaData common.MetaData) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Handling delete of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+		trace.Trace("Handling delete of %s %s%s\n", metaData.ObjectType, metaData.ObjectID, common.TraceIDTag(&metaData))
 	}
 
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
@@ -746,7 +1829,7 @@ func handleDelete(metaData common.MetaData) common.SyncServiceError {
 			metaData.Deleted = true
 			if _, err := Store.StoreObject(metaData, nil, common.ObjDeleted); err != nil {
 				common.ObjectLocks.Unlock(lockIndex)
-				return &notificationHandlerError{fmt.Sprintf("Error in handleDelete: failed to recreate deleted object. Error: %s\n", err)}
+				return &notificationHandlerError{message: fmt.Sprintf("Error in handleDelete: failed to recreate deleted object. Error: %s\n", err)}
 			}
 		} else {
 			if trace.IsLogging(logger.TRACE) {
@@ -771,23 +1854,33 @@ func handleDelete(metaData common.MetaData) common.SyncServiceError {
 		}
 	}
 
-	// Delete object's notifications
+	// Delete object's notifications, and cancel the transfer of its data if it is being received.
+	// The chunks that arrive later are ignored (see handleData).
 	Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "", "")
 	removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+	removePendingTransfer(metaData)
+	storage.ForgetDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 
 	common.ObjectLocks.Unlock(lockIndex)
 
+	// The held objects of the type don't wait for the deleted object
+	if metaData.OrderBase != 0 {
+		deliverHeldObjects(metaData.DestOrgID, metaData.ObjectType, metaData.OriginType, metaData.OriginID, metaData.OrderBase)
+	}
+
 	if sendDeleted {
 		if err := Comm.SendNotificationMessage(common.Deleted, metaData.OriginType, metaData.OriginID,
 			metaData.InstanceID, metaData.DataID, &metaData); err != nil {
-			return &notificationHandlerError{fmt.Sprintf("Error in handleDelete: failed to send notification. Error: %s\n", err)}
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleDelete: failed to send notification. Error: %s\n", err),
+				category: sendFailureCategory(err)}
 		}
 	}
 
 	// Send ack
 	if err := Comm.SendNotificationMessage(common.AckDelete, metaData.OriginType, metaData.OriginID, metaData.InstanceID, metaData.DataID,
 		&metaData); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleDelete: failed to send notification. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleDelete: failed to send notification. Error: %s\n", err),
+			category: sendFailureCategory(err)}
 	}
 
 	return nil
@@ -803,11 +1896,11 @@ func handleAckDelete(orgID string, objectType string, objectID string, destType
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil || notification == nil {
-		return &notificationHandlerError{"Error in handleAckDelete: no notification to update."}
+		return &notificationHandlerError{message: "Error in handleAckDelete: no notification to update.", category: ErrNotificationNotFound}
 	}
-	if notification.InstanceID != instanceID ||
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 ||
 		(notification.Status != common.Delete && notification.Status != common.DeletePending && notification.Status != common.Deleted) {
 		// This notification doesn't match the existing notification record, ignore
 		if trace.IsLogging(logger.TRACE) {
@@ -817,11 +1910,11 @@ func handleAckDelete(orgID string, objectType string, objectID string, destType
 	}
 
 	// Mark the notification as ackdelete
-	if err := Store.UpdateNotificationRecord(
+	if err := updateNotificationRecord(
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
 			DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.AckDelete, InstanceID: instanceID, DataID: dataID},
 	); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleAckDelete: failed to update notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleAckDelete: failed to update notification record. Error: %s\n", err)}
 	}
 
 	// Mark object destination status as deleted by the destination
@@ -833,9 +1926,9 @@ func handleAckDelete(orgID string, objectType string, objectID string, destType
 		// Delete the object
 		metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 		if err == nil && metaData != nil {
-			return storage.DeleteStoredObject(Store, *metaData)
+			return DeleteStoredObject(*metaData)
 		}
-		return &notificationHandlerError{fmt.Sprintf("Error in handleAckDelete: failed to find object. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleAckDelete: failed to find object. Error: %s\n", err)}
 	}
 	return nil
 }
@@ -843,18 +1936,19 @@ func handleAckDelete(orgID string, objectType string, objectID string, destType
 // Handle a notification that an object was deleted by the other side
 func handleObjectDeleted(metaData common.MetaData) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Handling object deleted of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+		trace.Trace("Handling object deleted of %s %s%s\n", metaData.ObjectType, metaData.ObjectID, common.TraceIDTag(&metaData))
 	}
 
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	common.ObjectLocks.Lock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType, metaData.DestID)
+	notification, err := retrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType, metaData.DestID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectDeleted: failed to retrieve notification record. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectDeleted: failed to retrieve notification record. Error: %s\n", err)}
 	}
-	if notification == nil || notification.InstanceID != metaData.InstanceID ||
+	if notification == nil || common.CompareInstances(notification.InstanceID, notification.InstanceSequence,
+		metaData.InstanceID, metaData.InstanceSequence) != 0 ||
 		(notification.Status != common.Delete && notification.Status != common.DeletePending && notification.Status != common.AckDelete) {
 		// Something went wrong: we can't retrieve the notification or the object, or the received notification doesn't
 		// match the existing notification record
@@ -879,7 +1973,8 @@ func handleObjectDeleted(metaData common.MetaData) common.SyncServiceError {
 	// Send ack
 	if err := Comm.SendNotificationMessage(common.AckDeleted, metaData.DestType, metaData.DestID, metaData.InstanceID, metaData.DataID,
 		&metaData); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectDeleted: failed to send notification. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleObjectDeleted: failed to send notification. Error: %s\n", err),
+			category: sendFailureCategory(err)}
 	}
 
 	return nil
@@ -895,11 +1990,12 @@ func handleAckObjectDeleted(orgID string, objectType string, objectID string, de
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
 	if err != nil || notification == nil {
-		return &notificationHandlerError{"Error in handleAckObjectDeleted: no notification to update."}
+		return &notificationHandlerError{message: "Error in handleAckObjectDeleted: no notification to update.",
+			category: ErrNotificationNotFound}
 	}
-	if notification.InstanceID != instanceID || (notification.Status != common.Deleted && notification.Status != common.DeletedPending) {
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 || (notification.Status != common.Deleted && notification.Status != common.DeletedPending) {
 		// This notification doesn't match the existing notification record, ignore
 		if trace.IsLogging(logger.TRACE) {
 			trace.Trace("Ignoring ack object deleted of %s %s\n", objectType, objectID)
@@ -916,10 +2012,10 @@ func handleAckObjectDeleted(orgID string, objectType string, objectID string, de
 	// Delete the object
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err == nil && metaData != nil {
-		return storage.DeleteStoredObject(Store, *metaData)
+		return DeleteStoredObject(*metaData)
 	}
 
-	return &notificationHandlerError{fmt.Sprintf("Error in handleAckObjectDeleted: failed to find object. Error: %s\n", err)}
+	return &notificationHandlerError{message: fmt.Sprintf("Error in handleAckObjectDeleted: failed to find object. Error: %s\n", err)}
 }
 
 func handleResendRequest(dest common.Destination) common.SyncServiceError {
@@ -929,30 +2025,86 @@ func handleResendRequest(dest common.Destination) common.SyncServiceError {
 
 	// Send ack
 	if err := Comm.SendAckResendObjects(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleResendRequest: failed to send ack. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleResendRequest: failed to send ack. Error: %s\n", err),
+			category: sendFailureCategory(err)}
 	}
 
 	objects, err := Store.RetrieveObjects(dest.DestOrgID, dest.DestType, dest.DestID, common.ResendAll)
 	if err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
 	}
 
 	if len(objects) > 0 {
 		destinations := make([]common.Destination, 1)
 		destinations[0] = dest
 		for _, metaData := range objects {
+			notificationFanoutLimiter.wait()
 			notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
 			if err != nil {
-				return &notificationHandlerError{fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
+				return &notificationHandlerError{message: fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
 			}
 			if err := SendNotifications(notificationsInfo); err != nil {
-				return &notificationHandlerError{fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
+				return &notificationHandlerError{message: fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
 			}
 		}
 	}
 	return nil
 }
 
+// ResendObjectToDestination sends the object to the destination again, without waiting for the periodic resend of
+// the notifications or for the destination to register again (for CSS). The object's notification record for the
+// destination is reset, and its update notification is sent as to a newly registered destination.
+// Nothing is sent if the object or the destination doesn't exist, or if the object isn't sent to the destination.
+func ResendObjectToDestination(orgID string, objectType string, objectID string, destType string, destID string) common.SyncServiceError {
+	if common.Configuration.NodeType != common.CSS {
+		return &notificationHandlerError{message: "Error in ResendObjectToDestination: only a CSS can resend objects to destinations"}
+	}
+
+	var dest *common.Destination
+	if exists, err := Store.DestinationExists(orgID, destType, destID); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in ResendObjectToDestination: failed to retrieve destination. Error: %s\n", err)}
+	} else if exists {
+		if dest, err = Store.RetrieveDestination(orgID, destType, destID); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in ResendObjectToDestination: failed to retrieve destination. Error: %s\n", err)}
+		}
+	}
+	metaData, status, err := Store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in ResendObjectToDestination: failed to retrieve object. Error: %s\n", err)}
+	}
+	if dest == nil || metaData == nil || metaData.Deleted || status != common.ReadyToSend {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Not resending %s:%s:%s to %s %s, the object or the destination doesn't exist\n", orgID, objectType, objectID,
+				destType, destID)
+		}
+		return nil
+	}
+
+	destinations, err := Store.GetObjectDestinationsList(orgID, objectType, objectID)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in ResendObjectToDestination: failed to retrieve object's destinations. Error: %s\n", err)}
+	}
+	found := false
+	for _, destination := range destinations {
+		if destination.Destination.DestType == destType && destination.Destination.DestID == destID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Not resending %s:%s:%s to %s %s, the object isn't sent to the destination\n", orgID, objectType, objectID,
+				destType, destID)
+		}
+		return nil
+	}
+
+	if log.IsLogging(logger.INFO) {
+		log.Info("Resending %s:%s:%s to %s %s\n", orgID, objectType, objectID, destType, destID)
+	}
+	return notifyNewDestination(*dest, []common.MetaData{*metaData})
+}
+
 func handleAckResend() common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Handling ack resend objects\n")
@@ -961,39 +2113,179 @@ func handleAckResend() common.SyncServiceError {
 	return nil
 }
 
-// Handle a feedback notification
-func handleFeedback(orgID string, objectType string, objectID string, destType string, destID string,
-	instanceID int64, dataID int64, code int, retryInterval int32, reason string) common.SyncServiceError {
+// CSS: handle a request of an ESS to verify its objects against the manifest of the objects it stores.
+// The objects that don't match are reported, and sent again to the ESS if resend is true.
+func handleVerifyRequest(dest common.Destination, manifest []common.ManifestEntry, resend bool) common.SyncServiceError {
+	if common.Configuration.NodeType != common.CSS {
+		return &notificationHandlerError{message: "ESS received verify request"}
+	}
 	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Handling feedback of %s %s\n", objectType, objectID)
+		trace.Trace("Handling verify objects request for %s/%s/%s (%d objects)\n", dest.DestOrgID, dest.DestType, dest.DestID, len(manifest))
 	}
 
-	lockIndex := common.HashStrings(orgID, objectType, objectID)
-	common.ObjectLocks.Lock(lockIndex)
-	defer common.ObjectLocks.Unlock(lockIndex)
-
-	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
-	if err != nil || notification == nil {
-		return &notificationHandlerError{"Error in handleFeedback: no notification to update."}
-	}
-	if notification.InstanceID != instanceID {
-		// This notification doesn't match the existing notification record, ignore
-		if trace.IsLogging(logger.TRACE) {
-			trace.Trace("Ignoring feedback of %s %s\n", objectType, objectID)
+	report := common.VerifyReport{DestOrgID: dest.DestOrgID, DestType: dest.DestType, DestID: dest.DestID, Timestamp: time.Now(),
+		VerifiedObjects: len(manifest), Discrepancies: make([]common.ObjectDiscrepancy, 0)}
+	objectsToResend := make([]common.MetaData, 0)
+	addDiscrepancy := func(metaData *common.MetaData, objectType string, objectID string, reason string) {
+		report.Discrepancies = append(report.Discrepancies, common.ObjectDiscrepancy{ObjectType: objectType, ObjectID: objectID,
+			Reason: reason, Resent: resend && metaData != nil})
+		if resend && metaData != nil {
+			objectsToResend = append(objectsToResend, *metaData)
 		}
-		return &ignoredByHandler{}
 	}
 
-	if code == common.InvalidObject {
-		deleteObjectInfo(orgID, objectType, objectID, destType, destID, nil, notification.Status == common.Getdata)
-	} else {
-		status := ""
-		if common.IsErrorFeedback(code) {
-			status = common.Error
+	reported := make(map[string]bool, len(manifest))
+	for _, entry := range manifest {
+		reported[entry.ObjectType+":"+entry.ObjectID] = true
+		metaData, err := Store.RetrieveObject(dest.DestOrgID, entry.ObjectType, entry.ObjectID)
+		if err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleVerifyRequest. Error: %s\n", err)}
 		}
-		_, err = Store.UpdateObjectDeliveryStatus(status, reason, orgID, objectType, objectID, destType, destID)
-		if err != nil && log.IsLogging(logger.ERROR) {
-			log.Error("Error in handleFeedback: failed to update destination status. Error: %s\n", err)
+		if metaData == nil || metaData.Deleted {
+			addDiscrepancy(nil, entry.ObjectType, entry.ObjectID, common.DiscrepancyUnknown)
+		} else if reason := compareManifestEntry(*metaData, entry); reason != "" {
+			addDiscrepancy(metaData, entry.ObjectType, entry.ObjectID, reason)
+		}
+	}
+
+	// The objects that the destination received and doesn't have any more
+	objects, err := Store.GetObjectsForDestination(dest.DestOrgID, dest.DestType, dest.DestID)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleVerifyRequest. Error: %s\n", err)}
+	}
+	for _, object := range objects {
+		if (object.Status != common.Delivered && object.Status != common.Consumed) || reported[object.ObjectType+":"+object.ObjectID] {
+			continue
+		}
+		metaData, err := Store.RetrieveObject(dest.DestOrgID, object.ObjectType, object.ObjectID)
+		if err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleVerifyRequest. Error: %s\n", err)}
+		}
+		if metaData != nil && !metaData.Deleted {
+			addDiscrepancy(metaData, object.ObjectType, object.ObjectID, common.DiscrepancyMissing)
+		}
+	}
+
+	verifyReportsLock.Lock()
+	verifyReports[dest.DestOrgID+":"+dest.DestType+":"+dest.DestID] = report
+	verifyReportsLock.Unlock()
+
+	if log.IsLogging(logger.INFO) {
+		log.Info("Verified %d objects of %s/%s/%s, found %d discrepancies\n", len(manifest), dest.DestOrgID, dest.DestType, dest.DestID,
+			len(report.Discrepancies))
+	}
+
+	destinations := []common.Destination{dest}
+	for _, metaData := range objectsToResend {
+		notificationFanoutLimiter.wait()
+		notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
+		if err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleVerifyRequest. Error: %s\n", err)}
+		}
+		if err := SendNotifications(notificationsInfo); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleVerifyRequest. Error: %s\n", err)}
+		}
+	}
+	return nil
+}
+
+// compareManifestEntry compares an entry of the manifest of an ESS with the object of the CSS.
+// It returns the reason of the discrepancy, or an empty string if they match.
+func compareManifestEntry(metaData common.MetaData, entry common.ManifestEntry) string {
+	if entry.InstanceID != metaData.InstanceID {
+		return common.DiscrepancyInstance
+	}
+	if metaData.NoData || metaData.Link != "" {
+		return ""
+	}
+	if entry.ObjectSize != metaData.ObjectSize {
+		return common.DiscrepancyData
+	}
+	if entry.Hash == "" {
+		return ""
+	}
+
+	algorithm := metaData.HashAlgorithm
+	if algorithm == "" {
+		algorithm = common.Configuration.DefaultHashAlgorithm
+	}
+	expected := metaData.Hash
+	if expected == "" || !strings.EqualFold(algorithm, entry.HashAlgorithm) {
+		// The hash in the metadata can't be compared, hash the stored data
+		hash, _, err := hashObjectData(metaData, metaData.SourceDataURI, entry.HashAlgorithm)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to hash the data of %s:%s:%s. Error: %s\n", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, err)
+			}
+			return ""
+		}
+		expected = hash
+	}
+	if !strings.EqualFold(expected, entry.Hash) {
+		return common.DiscrepancyData
+	}
+	return ""
+}
+
+// GetVerifyReport returns the report of the last verification of the objects of the destination.
+// It returns false if the destination didn't ask to verify its objects.
+func GetVerifyReport(orgID string, destType string, destID string) (common.VerifyReport, bool) {
+	verifyReportsLock.RLock()
+	defer verifyReportsLock.RUnlock()
+	report, ok := verifyReports[orgID+":"+destType+":"+destID]
+	return report, ok
+}
+
+// Handle a feedback notification
+func handleFeedback(orgID string, objectType string, objectID string, destType string, destID string,
+	instanceID int64, dataID int64, code int, retryInterval int32, reason string) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling feedback of %s %s\n", objectType, objectID)
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	if err != nil || notification == nil {
+		return &notificationHandlerError{message: "Error in handleFeedback: no notification to update.", category: ErrNotificationNotFound}
+	}
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 {
+		// This notification doesn't match the existing notification record, ignore
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Ignoring feedback of %s %s\n", objectType, objectID)
+		}
+		return &ignoredByHandler{}
+	}
+
+	if code == common.GoingAwayCode {
+		// The destination is shutting down, the notification is resent after the retry interval
+		notification.ResendTime = time.Now().Unix() + int64(retryInterval)
+		if err := updateNotificationRecord(*notification); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in handleFeedback: failed to update notification record. Error: %s\n", err)}
+		}
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("%s %s is going away, resending the notification of %s %s in %d seconds\n", destType, destID, objectType,
+				objectID, retryInterval)
+		}
+		return nil
+	}
+
+	if code == common.InvalidObject {
+		deleteObjectInfo(orgID, objectType, objectID, destType, destID, nil, notification.Status == common.Getdata)
+	} else {
+		status := ""
+		if code == common.AdmissionRejectedCode {
+			// The destination's admission policy rejected the object, it isn't sent again
+			status = common.Rejected
+			retryInterval = 0
+		} else if common.IsErrorFeedback(code) {
+			status = common.Error
+		}
+		_, err = Store.UpdateObjectDeliveryStatus(status, reason, orgID, objectType, objectID, destType, destID)
+		if err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in handleFeedback: failed to update destination status. Error: %s\n", err)
 		}
 
 		if common.IsErrorFeedback(code) {
@@ -1003,12 +2295,12 @@ func handleFeedback(orgID string, objectType string, objectID string, destType s
 				resendTime = time.Now().Unix() + int64(retryInterval)
 			}
 			// Mark the corresponding notification as error
-			if err := Store.UpdateNotificationRecord(
+			if err := updateNotificationRecord(
 				common.Notification{ObjectID: objectID, ObjectType: objectType,
 					DestOrgID: orgID, DestID: destID, DestType: destType, Status: status,
 					InstanceID: instanceID, ResendTime: resendTime, DataID: dataID},
 			); err != nil {
-				return &notificationHandlerError{fmt.Sprintf("Error in handleFeedback: failed to update notification record. Error: %s\n", err)}
+				return &notificationHandlerError{message: fmt.Sprintf("Error in handleFeedback: failed to update notification record. Error: %s\n", err)}
 			}
 		}
 	}
@@ -1016,14 +2308,94 @@ func handleFeedback(orgID string, objectType string, objectID string, destType s
 	return nil
 }
 
-func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError) {
-	orgID, objectType, objectID, dataReader, dataLength, offset, instanceID, err := parseDataMessage(dataMessage)
+// CancelObjectTransfer cancels receiving the data of an object from its origin.
+// The object's transfer state and notification records are removed, so that data that is still received for the object
+// is ignored. The object is kept as partially received until a new instance of the object is received.
+// If notifyOrigin is true, the origin is notified to stop sending the object's data.
+func CancelObjectTransfer(orgID string, objectType string, objectID string, notifyOrigin bool) common.SyncServiceError {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+
+	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err != nil {
-		return nil, &notificationHandlerError{fmt.Sprintf("Error in handleData: failed to parse data. Error: %s\n", err.Error())}
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: fmt.Sprintf("Error in CancelObjectTransfer: failed to retrieve object. Error: %s\n", err)}
+	}
+	if metaData == nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: "Error in CancelObjectTransfer: object not found.", category: ErrNotificationNotFound}
+	}
+	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, metaData.OriginType, metaData.OriginID)
+	if err != nil || notification == nil || (notification.Status != common.Getdata && notification.Status != common.TransferFailed) {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: "Error in CancelObjectTransfer: the object's data is not being received.",
+			category: ErrNotificationNotFound}
+	}
+
+	removeNotificationChunksInfo(*metaData, metaData.OriginType, metaData.OriginID)
+	storage.ForgetDataChunks(orgID, objectType, objectID)
+	if err := Store.DeleteNotificationRecords(orgID, objectType, objectID, metaData.OriginType, metaData.OriginID); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &notificationHandlerError{message: fmt.Sprintf("Error in CancelObjectTransfer: failed to delete notification records. Error: %s\n", err)}
+	}
+	common.ObjectLocks.Unlock(lockIndex)
+
+	if log.IsLogging(logger.INFO) {
+		log.Info("Cancelled the transfer of %s:%s:%s from %s %s\n", orgID, objectType, objectID, metaData.OriginType, metaData.OriginID)
+	}
+
+	if notifyOrigin {
+		if err := Comm.SendNotificationMessage(common.Cancel, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+			metaData.DataID, metaData); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in CancelObjectTransfer: failed to notify the origin. Error: %s\n", err),
+				category: sendFailureCategory(err)}
+		}
 	}
+	return nil
+}
 
+// Handle a notification that the destination cancelled receiving the object's data
+func handleCancelTransfer(orgID string, objectType string, objectID string, destType string, destID string, instanceID int64) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Handling data of %s %s offset %d\n", objectType, objectID, offset)
+		trace.Trace("Handling cancel of the transfer of %s %s\n", objectType, objectID)
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	notification, err := retrieveNotificationRecord(orgID, objectType, objectID, destType, destID)
+	if err != nil || notification == nil {
+		return &notificationHandlerError{message: "Error in handleCancelTransfer: no notification to cancel.", category: ErrNotificationNotFound}
+	}
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 {
+		// This notification doesn't match the existing notification record, ignore
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Ignoring cancel of the transfer of %s %s\n", objectType, objectID)
+		}
+		return &ignoredByHandler{}
+	}
+
+	deleteNotificationChunksInfo(orgID, objectType, objectID, destType, destID)
+	if err := Store.DeleteNotificationRecords(orgID, objectType, objectID, destType, destID); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in handleCancelTransfer: failed to delete notification records. Error: %s\n", err)}
+	}
+	if _, err := Store.UpdateObjectDeliveryStatus(common.Error, "The transfer was cancelled by the destination", orgID, objectType, objectID,
+		destType, destID); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in handleCancelTransfer: failed to update destination status. Error: %s\n", err)
+	}
+	return nil
+}
+
+func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError) {
+	orgID, objectType, objectID, dataReader, dataLength, offset, instanceID, compression, zeroFill, err := parseDataMessage(dataMessage)
+	if err != nil {
+		if diagnostic, ok := err.(*DataMessageError); ok && trace.IsLogging(logger.TRACE) {
+			trace.Trace("Failed to parse data message of %d bytes: field %s at position %d, expected %d, actual %d\n",
+				len(dataMessage), diagnostic.Field, diagnostic.Position, diagnostic.Expected, diagnostic.Actual)
+		}
+		return nil, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to parse data. Error: %s\n", err.Error()),
+			category: ErrInvalidData}
 	}
 
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
@@ -1032,40 +2404,106 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 
 	common.ObjectLocks.Lock(lockIndex)
 
-	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
+	metaData, status, err := Store.RetrieveObjectAndStatus(orgID, objectType, objectID)
 	if err != nil || metaData == nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return nil, &notificationHandlerError{"Error in handleData: failed to find meta data.\n"}
+		return nil, &notificationHandlerError{message: "Error in handleData: failed to find meta data.\n"}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling data of %s %s offset %d%s\n", objectType, objectID, offset, common.TraceIDTag(metaData))
+	}
+
+	// The transfer of a deleted object, or of a superseded instance, was cancelled. Its late chunks are ignored.
+	if status == common.ObjDeleted || common.CompareInstances(instanceID, 0, metaData.InstanceID, 0) < 0 {
+		common.ObjectLocks.Unlock(lockIndex)
+		return metaData, &ignoredByHandler{message: fmt.Sprintf("Ignoring data of instance %d of %s %s, the object was deleted or updated",
+			instanceID, objectType, objectID)}
+	}
+
+	if compression != 0 {
+		// The decompressed data can't extend beyond the end of the object
+		compressed := make([]byte, dataLength)
+		if _, err := io.ReadFull(dataReader, compressed); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to read compressed data. Error: %s\n", err),
+				category: ErrInvalidData}
+		}
+		data, err := decompressData(compressed, compression, metaData.ObjectSize-offset)
+		if err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to decompress data. Error: %s\n", err),
+				category: ErrInvalidData}
+		}
+		dataReader = bytes.NewReader(data)
+		dataLength = uint32(len(data))
+	}
+	if zeroFill != 0 {
+		// The zeros of a zero-fill data message are received like data, only they aren't written where the storage
+		// stores them sparsely
+		dataReader = storage.NewZeroReader(zeroFill)
+		dataLength = uint32(zeroFill)
 	}
 
 	total, err := checkNotificationRecord(*metaData, metaData.OriginType, metaData.OriginID, instanceID,
-		common.Getdata, offset)
+		common.Getdata, offset, dataLength)
 	if err != nil {
 		// This notification doesn't match the existing notification record, ignore
 		if trace.IsLogging(logger.INFO) {
-			trace.Info("Ignoring data of %s %s (%s)\n", objectType, objectID, err.Error())
+			trace.Info("Ignoring data of %s %s (%s)%s\n", objectType, objectID, err.Error(), common.TraceIDTag(metaData))
 		}
 		common.ObjectLocks.Unlock(lockIndex)
-		return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: checkNotificationRecord failed. Error: %s\n", err.Error())}
+		return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: checkNotificationRecord failed. Error: %s\n", err.Error()),
+			category: errorCategory(err)}
 	}
 
-	isFirstChunk := total == 0
-	isLastChunk := total+int64(dataLength) >= metaData.ObjectSize
+	// A chunk that was requested again (e.g. after a resend) may be delivered more than once.
+	// Its data was already written, so it is not written again, and it doesn't complete the object.
+	// A data message may carry several chunks or a part of a chunk, so only the data that wasn't received yet is counted.
+	// In a patch update the chunks overwrite the existing data, so none of them is the first chunk
+	newDataSize := getNewDataSize(*metaData, offset, int64(dataLength))
+	alreadyReceived := newDataSize == 0 && dataLength != 0
+	isFirstChunk := total == 0 && len(metaData.PatchRanges) == 0
+	isLastChunk := !alreadyReceived && total+newDataSize >= getDataSizeToReceive(*metaData)
 
-	if (offset != 0 || !isFirstChunk || !isLastChunk) && common.Configuration.NodeType == common.CSS && !leader.CheckIfLeader() {
+	if (offset != 0 || !isFirstChunk || !isLastChunk) && common.Configuration.NodeType == common.CSS &&
+		!leader.CheckIfOwner(orgID, objectType, objectID) {
 		common.ObjectLocks.Unlock(lockIndex)
-		return metaData, &notificationHandlerError{"Only the leader node can handle chunked data"}
+		return metaData, leader.NotOwnerError(fmt.Sprintf("This CSS instance doesn't own %s:%s:%s, only its owner can receive its chunked data.",
+			orgID, objectType, objectID), orgID, objectType, objectID)
 	}
 
-	if dataLength != 0 {
-		if metaData.DestinationDataURI != "" {
+	if dataLength != 0 && !alreadyReceived {
+		// The checksum of the chunk is logged, so that a chunk torn by a crash is detected when the transfer is resumed
+		checksum := crc32.NewIEEE()
+		dataReader = io.TeeReader(dataReader, checksum)
+		dataCodec, err := getReceivedDataCodec(*metaData, isFirstChunk)
+		if err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to get the data codec. Error: %s\n", err)}
+		}
+		if zeroFill != 0 {
+			// The zeros are read only for the checksum
+			if _, err := io.Copy(ioutil.Discard, dataReader); err != nil {
+				common.ObjectLocks.Unlock(lockIndex)
+				return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to read zero-fill data. Error: %s\n", err),
+					category: ErrInvalidData}
+			}
+			if err := appendZeroData(*metaData, dataCodec, dataLength, offset, isFirstChunk, isLastChunk); err != nil {
+				common.ObjectLocks.Unlock(lockIndex)
+				if storage.IsDiscarded(err) {
+					return metaData, nil
+				}
+				return metaData, err
+			}
+		} else if metaData.DestinationDataURI != "" {
 			if err := dataURI.AppendData(metaData.DestinationDataURI, dataReader, dataLength, offset, metaData.ObjectSize,
 				isFirstChunk, isLastChunk); err != nil {
 				common.ObjectLocks.Unlock(lockIndex)
 				return metaData, err
 			}
 		} else {
-			if err := Store.AppendObjectData(orgID, objectType, objectID, dataReader, dataLength, offset, metaData.ObjectSize,
+			if err := appendObjectData(orgID, objectType, objectID, dataCodec, dataReader, dataLength, offset, metaData.ObjectSize,
 				isFirstChunk, isLastChunk); err != nil {
 				if storage.IsDiscarded(err) {
 					common.ObjectLocks.Unlock(lockIndex)
@@ -1075,20 +2513,79 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 				return metaData, err
 			}
 		}
+		if err := storage.LogDataChunk(orgID, objectType, objectID, metaData.InstanceID, offset, int64(dataLength),
+			checksum.Sum32()); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, err
+		}
 	}
 
-	maxRequestedOffset, err := handleChunkReceived(*metaData, offset, int64(dataLength))
+	maxRequestedOffset, completedChunks, err := handleChunkReceived(*metaData, offset, int64(dataLength))
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return metaData, &notificationHandlerError{"Error in handleData: handleChunkReceived failed. Error: " + err.Error()}
+		return metaData, &notificationHandlerError{message: "Error in handleData: handleChunkReceived failed. Error: " + err.Error(),
+			category: errorCategory(err)}
 	}
 
 	if isLastChunk {
+		transfer := getTransferInfo(*metaData)
+		receivedDataSize := getReceivedDataSize(*metaData)
+		verifyFailures := getVerifyFailures(*metaData)
+
+		verifyErr := verifyReceivedDataSize(*metaData, receivedDataSize)
+		if verifyErr == nil && metaData.Hash != "" {
+			verifyErr = verifyObjectData(*metaData)
+		}
 		removeNotificationChunksInfo(*metaData, metaData.OriginType, metaData.OriginID)
+		storage.ForgetDataChunks(orgID, objectType, objectID)
+		if verifyErr != nil {
+			// The data is requested again also if it couldn't be read, as no more chunks of it will arrive
+			verifyFailures++
+			if maxResends := common.Configuration.MaxChunkResends; maxResends > 0 && verifyFailures > maxResends {
+				failDataVerification(*metaData, lockIndex, verifyErr.Error())
+				return metaData, nil
+			}
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to verify data of %s:%s:%s, requesting the data again. Error: %s\n", orgID, objectType, objectID, verifyErr)
+			}
+			if len(metaData.PatchRanges) != 0 && IsInvalidData(verifyErr) {
+				// The patched data is corrupted, request the whole data
+				metaData.PatchRanges = nil
+				if _, err := Store.StoreObject(*metaData, nil, common.PartiallyReceived); err != nil {
+					common.ObjectLocks.Unlock(lockIndex)
+					return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: %s\n", err)}
+				}
+			}
+			common.ObjectLocks.Unlock(lockIndex)
+			if err := Comm.GetData(*metaData, 0); err != nil {
+				return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to request data. Error: %s\n", err),
+					category: sendFailureCategory(err)}
+			}
+			setVerifyFailures(*metaData, verifyFailures)
+			return metaData, nil
+		}
+
+		if reason, err := signatureRejectionReason(*metaData); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to verify signature. Error: %s\n", err)}
+		} else if reason != "" {
+			err := rejectObjectData(*metaData, reason)
+			common.ObjectLocks.Unlock(lockIndex)
+			if err != nil {
+				return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to reject data. Error: %s\n", err)}
+			}
+			// The origin stops sending the object, and marks its delivery as failed
+			if err := Comm.SendNotificationMessage(common.Cancel, metaData.OriginType, metaData.OriginID, metaData.InstanceID,
+				metaData.DataID, metaData); err != nil {
+				return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to notify the origin. Error: %s\n", err),
+					category: sendFailureCategory(err)}
+			}
+			return metaData, nil
+		}
 
-		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived); err != nil {
+		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, receivedObjectStatus(*metaData)); err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
-			return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: %s\n", err)}
+			return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: %s\n", err)}
 		}
 		notificationsInfo, err := PrepareObjectStatusNotification(*metaData, common.Received)
 		common.ObjectLocks.Unlock(lockIndex)
@@ -1099,437 +2596,949 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 			return metaData, err
 		}
 
-		callWebhooks(metaData)
+		webhookMetaData := *metaData
+		if transfer != nil {
+			if log.IsLogging(logger.INFO) {
+				log.Info("Received data of %s:%s:%s from %s:%s, %d bytes in %d ms (%d bytes/sec)%s\n", orgID, objectType, objectID,
+					transfer.OriginType, transfer.OriginID, transfer.Size, transfer.Duration, transfer.Rate, common.TraceIDTag(metaData))
+			}
+			common.HealthStatus.TransferCompleted(*transfer)
+			webhookMetaData.Transfer = transfer
+		}
+		deliverReceivedObject(&webhookMetaData)
+
+		// Make room for the received data in a storage with a size limit
+		EvictObjects()
 
 		return metaData, nil
 	}
 
 	common.ObjectLocks.Unlock(lockIndex)
 
-	newOffset := maxRequestedOffset + int64(metaData.ChunkSize)
-	if newOffset < metaData.ObjectSize {
+	// A chunk is requested for each chunk that was completed, a part of a chunk doesn't complete it
+	newOffset := maxRequestedOffset
+	for i := 0; i < completedChunks; i++ {
+		var ok bool
+		newOffset, ok = nextChunkOffset(*metaData, newOffset)
+		for ok && isChunkReceived(*metaData, newOffset) {
+			// The chunk was written before a restart (see reconcileLoggedDataChunks)
+			newOffset, ok = nextChunkOffset(*metaData, newOffset)
+		}
+		if !ok {
+			break
+		}
 		// get next chunk
 		if err := Comm.GetData(*metaData, newOffset); err != nil {
-			return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: failed to request data. Error: %s\n", err)}
+			return metaData, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to request data. Error: %s\n", err),
+				category: sendFailureCategory(err)}
 		}
 	}
 
 	return metaData, nil
 }
 
-func handleGetData(metaData common.MetaData, offset int64) common.SyncServiceError {
-	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Handling data request for %s %s (offset %d)\n", metaData.ObjectType, metaData.ObjectID, offset)
+// getTransferInfo returns the duration and the rate of the transfer of the object's data, whose last chunk was received.
+// It returns nil if the object's data is not being received.
+func getTransferInfo(metaData common.MetaData) *common.TransferInfo {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	chunksInfo, ok := notificationChunks[id]
+	notificationLock.RUnlock()
+	if !ok || chunksInfo.startTime.IsZero() {
+		return nil
 	}
 
-	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
-	common.ObjectLocks.RLock(lockIndex)
+	elapsed := resendClock.Now().Sub(chunksInfo.startTime)
+	transfer := common.TransferInfo{OrgID: metaData.DestOrgID, ObjectType: metaData.ObjectType, ObjectID: metaData.ObjectID,
+		OriginType: metaData.OriginType, OriginID: metaData.OriginID, Size: chunksInfo.dataSize,
+		Duration: uint64(elapsed / time.Millisecond)}
+	if elapsed > 0 {
+		transfer.Rate = uint64(float64(chunksInfo.dataSize) / elapsed.Seconds())
+	}
+	return &transfer
+}
 
-	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
-		metaData.DestType, metaData.DestID)
-	if err != nil || notification == nil {
-		common.ObjectLocks.RUnlock(lockIndex)
-		return &ignoredByHandler{}
+// getVerifyFailures returns the number of times the data of the object that is being received failed verification
+func getVerifyFailures(metaData common.MetaData) int {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+	return notificationChunks[id].verifyFailures
+}
+
+// setVerifyFailures keeps the number of times the data of the object failed verification in the state of the transfer
+// of the data that was requested again
+func setVerifyFailures(metaData common.MetaData, verifyFailures int) {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.Lock()
+	if chunksInfo, ok := notificationChunks[id]; ok {
+		chunksInfo.verifyFailures = verifyFailures
+		notificationChunks[id] = chunksInfo
 	}
-	if notification.InstanceID != metaData.InstanceID ||
-		(notification.Status != common.Update && notification.Status != common.Updated && notification.Status != common.Data) {
-		// This notification doesn't match the existing notification record, ignore
-		if trace.IsLogging(logger.TRACE) {
-			trace.Trace("Ignoring get data request of %s %s\n", metaData.ObjectType, metaData.ObjectID)
-		}
-		common.ObjectLocks.RUnlock(lockIndex)
-		return &ignoredByHandler{}
+	notificationLock.Unlock()
+}
+
+// failDataVerification fails the transfer of the object's data after the data failed verification more than MaxChunkResends
+// times. Must be called while holding the object's lock, which it releases.
+func failDataVerification(metaData common.MetaData, lockIndex uint32, reason string) {
+	if err := updateNotificationRecord(
+		common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType, DestOrgID: metaData.DestOrgID,
+			DestType: metaData.OriginType, DestID: metaData.OriginID, Status: common.TransferFailed,
+			InstanceID: metaData.InstanceID, InstanceSequence: metaData.InstanceSequence, DataID: metaData.DataID},
+	); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update notification record. Error: %s\n", err)
 	}
+	common.ObjectLocks.Unlock(lockIndex)
+	releaseTransferSlot(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
 
-	var objectData []byte
-	var length int
-	var eof bool
-	if metaData.SourceDataURI != "" {
-		objectData, eof, length, err = dataURI.GetDataChunk(metaData.SourceDataURI, common.Configuration.MaxDataChunkSize,
-			offset)
-	} else {
-		objectData, eof, length, err = Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
-			common.Configuration.MaxDataChunkSize, offset)
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Failed to receive the data of %s:%s:%s, the data failed verification too many times. %s\n", metaData.DestOrgID,
+			metaData.ObjectType, metaData.ObjectID, reason)
 	}
+}
+
+// verifyObjectData reads the fully assembled data of the object and compares its hash with the hash in the metadata
+func verifyObjectData(metaData common.MetaData) common.SyncServiceError {
+	actual, size, err := hashObjectData(metaData, metaData.DestinationDataURI, metaData.HashAlgorithm)
 	if err != nil {
-		common.ObjectLocks.RUnlock(lockIndex)
 		return err
 	}
 
-	dataMessage, err := buildDataMessage(metaData, objectData, length, offset)
-	if err != nil {
-		common.ObjectLocks.RUnlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleGetData: failed to build data message. %s\n", err)}
+	if size != metaData.ObjectSize {
+		return &notificationHandlerError{message: fmt.Sprintf("Data size mismatch: expected=%d, received=%d", metaData.ObjectSize, size),
+			category: ErrInvalidData}
 	}
-
-	if err := Store.UpdateNotificationRecord(
-		common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
-			DestOrgID: metaData.DestOrgID, DestID: metaData.DestID, DestType: metaData.DestType,
-			Status: common.Data, InstanceID: metaData.InstanceID, DataID: metaData.DataID},
-	); err != nil {
-		common.ObjectLocks.RUnlock(lockIndex)
-		return &notificationHandlerError{fmt.Sprintf("Error in handleData: failed to update notification record. Error: %s\n", err)}
+	if !strings.EqualFold(actual, metaData.Hash) {
+		return &notificationHandlerError{message: fmt.Sprintf("Data hash mismatch: expected=%s, received=%s", metaData.Hash, actual),
+			category: ErrInvalidData}
 	}
+	return nil
+}
 
-	common.ObjectLocks.RUnlock(lockIndex)
-
-	chunked := false
-	if offset != 0 || !eof {
-		chunked = true
+// verifyReceivedDataSize verifies that the sizes of the received chunks of the object's data add up to the size of
+// the data requested from its origin, i.e., that no chunk was short, oversized, or counted twice
+func verifyReceivedDataSize(metaData common.MetaData, receivedDataSize int64) common.SyncServiceError {
+	// The data of an object that isn't chunked is received in a single message, whose size is verified when it is received
+	if !common.Configuration.VerifyReceivedDataSize || metaData.ChunkSize <= 0 {
+		return nil
 	}
-	// Send data
-	if err := Comm.SendData(metaData.DestOrgID, metaData.DestType, metaData.DestID, dataMessage, chunked); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleGetData: failed to send notification. Error: %s\n", err)}
+	if expected := getDataSizeToReceive(metaData); receivedDataSize != expected {
+		return &notificationHandlerError{message: fmt.Sprintf("Received data size mismatch: expected=%d, received=%d", expected, receivedDataSize),
+			category: ErrInvalidData}
 	}
-
 	return nil
 }
 
-const (
-	orgIDField      = 1
-	objectTypeField = 2
-	objectIDField   = 3
-	offsetField     = 4
-	dataField       = 5
-	instanceIDField = 6
-	fieldCount      = 6
-)
-
-func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, offset int64) ([]byte, common.SyncServiceError) {
-	message := new(bytes.Buffer)
-
-	// magic
-	var value = common.Magic
-	err := binary.Write(message, binary.BigEndian, value)
+// hashObjectData reads the data of the object and returns its hex encoded hash, computed with the given algorithm, and its size.
+// The data is read from uri if it is set, and from the storage otherwise.
+func hashObjectData(metaData common.MetaData, uri string, algorithm string) (string, int64, common.SyncServiceError) {
+	digest, size, err := digestObjectData(metaData, uri, algorithm)
 	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write magic to data message. Error: " + err.Error()}
+		return "", 0, err
 	}
+	return hex.EncodeToString(digest), size, nil
+}
 
-	// version
-	value = common.Version.Major
-	err = binary.Write(message, binary.BigEndian, value)
+// digestObjectData reads the data of the object chunk by chunk and returns its hash, computed with the given algorithm, and its size.
+// The data is read from uri if it is set, and from the storage otherwise.
+func digestObjectData(metaData common.MetaData, uri string, algorithm string) ([]byte, int64, common.SyncServiceError) {
+	dataHash, err := common.NewHash(algorithm)
 	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write version to data message. Error: " + err.Error()}
+		return nil, 0, err
 	}
 
-	value = common.Version.Minor
-	err = binary.Write(message, binary.BigEndian, value)
-	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write version to data message. Error: " + err.Error()}
+	var dataCodec *storage.ObjectDataCodec
+	if uri == "" {
+		if dataCodec, err = storage.GetObjectDataCodec(Store, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+			return nil, 0, err
+		}
 	}
 
-	// fieldCount
-	value = fieldCount
-	err = binary.Write(message, binary.BigEndian, value)
-	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write field count to data message. Error: " + err.Error()}
+	var offset int64
+	for {
+		var data []byte
+		var length int
+		var eof bool
+		if uri != "" {
+			data, eof, length, err = dataURI.GetDataChunk(uri, common.Configuration.MaxDataChunkSize, offset)
+		} else {
+			data, eof, length, err = Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+				common.Configuration.MaxDataChunkSize, offset)
+			if err == nil {
+				dataCodec.Decode(offset, data[:length])
+			}
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		dataHash.Write(data[:length])
+		offset += int64(length)
+		if eof || length == 0 {
+			break
+		}
 	}
+	return dataHash.Sum(nil), offset, nil
+}
 
-	// org id
-	orgID := []byte(metaData.DestOrgID)
+// handleGetData sends count consecutive chunks of the object's data starting at offset.
+// A count of zero or one sends a single chunk.
+func handleGetData(metaData common.MetaData, offset int64, count int) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling data request for %s %s (offset %d, count %d)%s\n", metaData.ObjectType, metaData.ObjectID, offset, count,
+			common.TraceIDTag(&metaData))
+	}
 
-	// field type
-	value = orgIDField
-	err = binary.Write(message, binary.BigEndian, value)
-	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+	if isDestinationPaused(metaData.DestOrgID, metaData.DestType, metaData.DestID) {
+		// The destination requests the data again when its resend time expires
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Ignoring data request of %s %s, the destination is paused%s\n", metaData.ObjectType, metaData.ObjectID,
+				common.TraceIDTag(&metaData))
+		}
+		return nil
 	}
 
-	// length
-	value = uint32(len(orgID))
-	err = binary.Write(message, binary.BigEndian, value)
-	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write field length to data message. Error: " + err.Error()}
+	if count < 1 {
+		count = 1
 	}
 
-	// org ID data
-	err = binary.Write(message, binary.BigEndian, orgID)
-	if err != nil {
-		return nil, &notificationHandlerError{"Failed to write org ID to data message. Error: " + err.Error()}
+	// The codec of the stored data is looked up once for all the chunks of the request
+	var dataCodec *storage.ObjectDataCodec
+	if metaData.SourceDataURI == "" {
+		var err common.SyncServiceError
+		if dataCodec, err = storage.GetObjectDataCodec(Store, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+			return err
+		}
 	}
 
-	// object type
-	objectType := []byte(metaData.ObjectType)
-
-	// field type
-	value = objectTypeField
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+	// Consecutive chunks are read with one data reader, instead of seeking to each chunk, unless the chunks are cached
+	var dataReader storage.ObjectDataReader
+	if count > 1 && metaData.SourceDataURI == "" && common.Configuration.DataChunkCacheSizeKB <= 0 {
+		var err error
+		if dataReader, err = Store.OpenObjectDataReader(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, offset); err != nil {
+			return err
+		}
+		defer dataReader.Close()
 	}
 
-	// length
-	value = uint32(len(objectType))
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field length to data message. Error: " + err.Error()}
+	chunkSize := int64(metaData.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = int64(common.Configuration.MaxDataChunkSize)
 	}
+	end := offset + int64(count)*chunkSize
 
-	// type data
-	if err = binary.Write(message, binary.BigEndian, objectType); err != nil {
-		return nil, &notificationHandlerError{"Failed to write object type to data message. Error: " + err.Error()}
-	}
+	messageVersion := messageVersionForDestination(metaData.DestOrgID, metaData.DestType, metaData.DestID)
+	compression := compressionForDestination(metaData.DestOrgID, metaData.DestType, metaData.DestID)
+	return sendDataMessages(metaData, offset, end, false, dataCodec, dataReader, messageVersion, compression)
+}
 
-	// object id
-	objectID := []byte(metaData.ObjectID)
+// sendDataMessages sends the object's data from offset up to end in data messages. If reserved is true, sending the first
+// data message was already reserved in the rate limit of the destination.
+// When the rate limit of the destination requires waiting, the rest of the data is sent later, instead of blocking
+// the handling of the messages of other destinations. The destination requests only the chunks in its inflight window,
+// so the data waiting to be sent to it is bounded by the window.
+// The data is compressed with the compression algorithm negotiated with the destination.
+func sendDataMessages(metaData common.MetaData, offset int64, end int64, reserved bool, dataCodec *storage.ObjectDataCodec,
+	dataReader storage.ObjectDataReader, messageVersion common.SyncServiceVersion, compression string) common.SyncServiceError {
+	for offset < end {
+		size := dataMessageSize(metaData, offset, end)
+		if !reserved {
+			if delay := dataSendLimiter.reserve(metaData.DestOrgID, metaData.DestType, metaData.DestID, size); delay > 0 {
+				deferDataMessages(metaData, offset, end, delay, messageVersion, compression)
+				return nil
+			}
+		}
+		reserved = false
 
-	// field type
-	value = objectIDField
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+		length, eof, err := sendDataChunk(metaData, offset, size, dataCodec, dataReader, messageVersion, compression)
+		if err != nil {
+			return err
+		}
+		if eof || length == 0 {
+			break
+		}
+		offset += int64(length)
 	}
 
-	// length
-	value = uint32(len(objectID))
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field length to data message. Error: " + err.Error()}
-	}
+	return nil
+}
+
+// deferDataMessages sends the object's data from offset up to end after delay, sending the first data message was reserved
+// in the rate limit of the destination. The data is read without the data reader of the request, which is closed by then,
+// and the codec of the data is looked up again, as the data may have been re-encrypted in the meantime.
+func deferDataMessages(metaData common.MetaData, offset int64, end int64, delay time.Duration, messageVersion common.SyncServiceVersion,
+	compression string) {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deferring data of %s %s (offset %d) by %s, the data rate limit of %s %s was reached\n", metaData.ObjectType,
+			metaData.ObjectID, offset, delay, metaData.DestType, metaData.DestID)
+	}
+	time.AfterFunc(delay, func() {
+		var dataCodec *storage.ObjectDataCodec
+		var err common.SyncServiceError
+		if metaData.SourceDataURI == "" {
+			dataCodec, err = storage.GetObjectDataCodec(Store, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		}
+		if err == nil {
+			err = sendDataMessages(metaData, offset, end, true, dataCodec, nil, messageVersion, compression)
+		}
+		if err != nil && !isIgnoredByHandler(err) && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to send deferred data of %s %s (offset %d). Error: %s", metaData.ObjectType, metaData.ObjectID,
+				offset, err.Error())
+		}
+	})
+}
 
-	// ID data
-	if err = binary.Write(message, binary.BigEndian, objectID); err != nil {
-		return nil, &notificationHandlerError{"Failed to write object ID to data message. Error: " + err.Error()}
+// dataMessageSize returns the size of the data to send in the data message at offset, up to end.
+// A data message carries as many whole chunks as fit in MaxDataChunkSize, and chunks larger than MaxDataChunkSize
+// are split across several data messages, so that a data message never carries a part of more than one chunk.
+func dataMessageSize(metaData common.MetaData, offset int64, end int64) int {
+	size := int64(common.Configuration.MaxDataChunkSize)
+	if chunkSize := int64(metaData.ChunkSize); chunkSize > 0 {
+		if size >= chunkSize {
+			size -= size % chunkSize
+		} else if chunkEnd := offset - offset%chunkSize + chunkSize; offset+size > chunkEnd {
+			size = chunkEnd - offset
+		}
 	}
+	if offset+size > end {
+		size = end - offset
+	}
+	return int(size)
+}
 
-	// offset
-	// field type
-	value = offsetField
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+// sendDataChunk reads size bytes of the object's data at offset and sends them to the requesting side in one data message.
+// If dataReader is not nil, the data is read from it, and it must be positioned at offset. The data is decoded with dataCodec.
+func sendDataChunk(metaData common.MetaData, offset int64, size int, dataCodec *storage.ObjectDataCodec,
+	dataReader storage.ObjectDataReader, messageVersion common.SyncServiceVersion, compression string) (int, bool, common.SyncServiceError) {
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.RLock(lockIndex)
+
+	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		metaData.DestType, metaData.DestID)
+	if err != nil || notification == nil {
+		common.ObjectLocks.RUnlock(lockIndex)
+		return 0, false, &ignoredByHandler{}
 	}
+	if common.CompareInstances(notification.InstanceID, notification.InstanceSequence,
+		metaData.InstanceID, metaData.InstanceSequence) != 0 ||
+		(notification.Status != common.Update && notification.Status != common.Updated && notification.Status != common.Data) {
+		// This notification doesn't match the existing notification record, ignore
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Ignoring get data request of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+		}
+		common.ObjectLocks.RUnlock(lockIndex)
+		return 0, false, &ignoredByHandler{}
+	}
+
+	message := dataMessageBuffers.Get().(*bytes.Buffer)
+	message.Reset()
+	releaseMessage := func() { dataMessageBuffers.Put(message) }
 
-	// offset length
-	value = uint32(binary.Size(offset))
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write offset length to data message. Error: " + err.Error()}
+	dataMessage, length, eof, err := readDataMessage(message, metaData, offset, size, dataCodec, dataReader, messageVersion, compression)
+	if err != nil {
+		releaseMessage()
+		common.ObjectLocks.RUnlock(lockIndex)
+		return 0, false, err
 	}
 
-	// offset
-	if err = binary.Write(message, binary.BigEndian, offset); err != nil {
-		return nil, &notificationHandlerError{"Failed to write offset to data message. Error: " + err.Error()}
+	if err := updateNotificationRecord(
+		common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
+			DestOrgID: metaData.DestOrgID, DestID: metaData.DestID, DestType: metaData.DestType,
+			Status: common.Data, InstanceID: metaData.InstanceID, InstanceSequence: metaData.InstanceSequence, DataID: metaData.DataID},
+	); err != nil {
+		releaseMessage()
+		common.ObjectLocks.RUnlock(lockIndex)
+		return 0, false, &notificationHandlerError{message: fmt.Sprintf("Error in handleData: failed to update notification record. Error: %s\n", err)}
 	}
 
-	// instance ID
-	// field type
-	value = instanceIDField
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+	common.ObjectLocks.RUnlock(lockIndex)
+
+	chunked := false
+	if offset != 0 || !eof {
+		chunked = true
+	}
+	// Send data
+	if err := Comm.SendData(&metaData, metaData.DestType, metaData.DestID, dataMessage, chunked, releaseMessage); err != nil {
+		return 0, false, &notificationHandlerError{message: fmt.Sprintf("Error in handleGetData: failed to send notification. Error: %s\n", err),
+			category: sendFailureCategory(err)}
 	}
 
-	// instance ID length
-	value = uint32(binary.Size(metaData.InstanceID))
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write instance ID length to data message. Error: " + err.Error()}
+	return length, eof, nil
+}
+
+// dataMessageBuffers pools the buffers of the data messages that are sent, a buffer is put back in the pool when
+// the communicator no longer uses its message
+var dataMessageBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readDataMessage reads size bytes of the object's data at offset, and builds a data message of them in message.
+// Data of a SourceDataURI is read directly into the message, other data is decoded with dataCodec after it is read from the storage.
+// If compression isn't none, the data is compressed unless it doesn't get smaller.
+// If SparseDataTransfer is set and the message version supports it, data that is all zeros is sent as a zero-fill data message.
+// Returns the data message, which is backed by message, the length of the data, and whether the end of the data was reached.
+func readDataMessage(message *bytes.Buffer, metaData common.MetaData, offset int64, size int, dataCodec *storage.ObjectDataCodec,
+	dataReader storage.ObjectDataReader, messageVersion common.SyncServiceVersion, compression string) ([]byte, int, bool, common.SyncServiceError) {
+	var objectData []byte
+	var length int
+	var eof bool
+	var err common.SyncServiceError
+	if metaData.SourceDataURI == "" {
+		var cached bool
+		objectData, eof, cached = storage.GetCachedDataChunk(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.InstanceID, offset, size)
+		if cached {
+			length = len(objectData)
+		} else {
+			if dataReader != nil {
+				objectData, eof, length, err = dataReader.NextChunk(size)
+			} else {
+				objectData, eof, length, err = Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+					size, offset)
+			}
+			if err != nil {
+				return nil, 0, false, err
+			}
+			objectData = objectData[:length]
+			dataCodec.Decode(offset, objectData)
+			storage.CacheDataChunk(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID, offset, size,
+				objectData, eof)
+		}
+		size = length
+	} else if compression != common.CompressionNone {
+		// The data is compressed, so it is read into a buffer of its own
+		objectData = make([]byte, size)
+		if eof, length, err = dataURI.ReadDataChunk(metaData.SourceDataURI, objectData, offset); err != nil {
+			return nil, 0, false, err
+		}
+		objectData = objectData[:length]
+		size = length
 	}
 
-	// instance ID
-	if err = binary.Write(message, binary.BigEndian, metaData.InstanceID); err != nil {
-		return nil, &notificationHandlerError{"Failed to write instance ID to data message. Error: " + err.Error()}
+	// The data of a SourceDataURI is read directly into the message only if it isn't compressed
+	dataRead := metaData.SourceDataURI == "" || compression != common.CompressionNone
+	if dataRead {
+		if length != 0 && common.Configuration.SparseDataTransfer && !messageVersion.Less(common.ZeroFillVersion) &&
+			isZeroData(objectData) {
+			writeDataMessageHeader(message, metaData, 0, offset, messageVersion, binary.BigEndian, common.CompressionNone, int64(length))
+			return message.Bytes(), length, eof, nil
+		}
+		if compressed, ok := compressData(objectData, compression); ok {
+			writeDataMessageHeader(message, metaData, len(compressed), offset, messageVersion, binary.BigEndian, compression, 0)
+			message.Write(compressed)
+			return message.Bytes(), length, eof, nil
+		}
 	}
 
-	// field type
-	value = dataField
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+	writeDataMessageHeader(message, metaData, size, offset, messageVersion, binary.BigEndian, common.CompressionNone, 0)
+	headerLength := message.Len()
+	if dataRead {
+		message.Write(objectData)
+		return message.Bytes(), length, eof, nil
 	}
 
-	// data length
-	value = uint32(dataLength)
-	if err = binary.Write(message, binary.BigEndian, value); err != nil {
-		return nil, &notificationHandlerError{"Failed to write data length to data message. Error: " + err.Error()}
+	// The data is read into the capacity of the message after the header, the data length is updated if less data was read
+	message.Grow(size)
+	dataMessage := message.Bytes()[:headerLength+size]
+	if eof, length, err = dataURI.ReadDataChunk(metaData.SourceDataURI, dataMessage[headerLength:], offset); err != nil {
+		return nil, 0, false, err
 	}
+	if length != size {
+		binary.BigEndian.PutUint32(dataMessage[headerLength-4:headerLength], uint32(length))
+	}
+	return dataMessage[:headerLength+length], length, eof, nil
+}
 
-	// data
-	if dataLength != 0 {
-		err = binary.Write(message, binary.BigEndian, data)
-		if err != nil {
-			return nil, &notificationHandlerError{"Failed to write data to data message. Error: " + err.Error()}
+// isZeroData returns true if all the data is zeros
+func isZeroData(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
 		}
 	}
+	return true
+}
+
+const (
+	orgIDField      = 1
+	objectTypeField = 2
+	objectIDField   = 3
+	offsetField     = 4
+	dataField       = 5
+	instanceIDField = 6
+	fieldCount      = 6
+
+	// compressionField is written, in addition to the other fields, only in data messages whose data is compressed.
+	// Its value is the ID of the compression algorithm (see compressionIDs).
+	compressionField = 7
 
+	// zeroFillField is written, in addition to the other fields, only in zero-fill data messages, whose data field is empty.
+	// Its value is the number of zeros at the offset of the message, that the receiver stores as the object's data.
+	zeroFillField = 8
+)
+
+// byteOrderMark is an optional part of the fixed header of data messages, placed after the version.
+// It is written in the byte order of the message, so it is read as byteOrderMark from big-endian messages
+// and as its byte swap from little-endian messages.
+// Messages without it (e.g. from older peers) are big-endian.
+// The magic number is symmetric, so it is checked before the byte order is known.
+const byteOrderMark = uint32(0x0000FEFF)
+
+func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, offset int64) ([]byte, common.SyncServiceError) {
+	return buildDataMessageWithByteOrder(metaData, data, dataLength, offset, common.Version, binary.BigEndian)
+}
+
+// buildDataMessageWithByteOrder builds a data message of the specified message version using the specified byte order.
+// Big-endian messages are built without a byte order mark, to be understood by peers that don't support it.
+func buildDataMessageWithByteOrder(metaData common.MetaData, data []byte, dataLength int, offset int64,
+	version common.SyncServiceVersion, byteOrder binary.ByteOrder) ([]byte, common.SyncServiceError) {
+	message := bytes.NewBuffer(make([]byte, 0, dataMessageHeaderSize(metaData)+len(data)))
+	writeDataMessageHeader(message, metaData, dataLength, offset, version, byteOrder, common.CompressionNone, 0)
+	if dataLength != 0 {
+		message.Write(data)
+	}
 	return message.Bytes(), nil
 }
 
+// writeDataMessageHeader writes all of the data message, except for the data itself, to message. The data length is
+// the last field of the header, so that the data can be read directly into the message after the header.
+// If compression isn't none, the data length is the length of the compressed data.
+// If zeroFill isn't 0, the message is a zero-fill data message of zeroFill zeros, and its data length must be 0.
+// The fields are written through a scratch buffer rather than with binary.Write, that allocates for every value.
+func writeDataMessageHeader(message *bytes.Buffer, metaData common.MetaData, dataLength int, offset int64,
+	version common.SyncServiceVersion, byteOrder binary.ByteOrder, compression string, zeroFill int64) {
+	var scratch [8]byte
+	writeUint32 := func(value uint32) {
+		byteOrder.PutUint32(scratch[:4], value)
+		message.Write(scratch[:4])
+	}
+	writeInt64Field := func(fieldType uint32, value int64) {
+		writeUint32(fieldType)
+		writeUint32(8)
+		byteOrder.PutUint64(scratch[:], uint64(value))
+		message.Write(scratch[:])
+	}
+	writeStringField := func(fieldType uint32, value string) {
+		writeUint32(fieldType)
+		writeUint32(uint32(len(value)))
+		message.WriteString(value)
+	}
+
+	message.Grow(dataMessageHeaderSize(metaData))
+	writeUint32(common.Magic)
+	writeUint32(version.Major)
+	writeUint32(version.Minor)
+	if byteOrder != binary.BigEndian {
+		writeUint32(byteOrderMark)
+	}
+	compressionID, compressed := compressionIDs[compression]
+	count := uint32(fieldCount)
+	if compressed {
+		count++
+	}
+	if zeroFill != 0 {
+		count++
+	}
+	writeUint32(count)
+	writeStringField(orgIDField, metaData.DestOrgID)
+	writeStringField(objectTypeField, metaData.ObjectType)
+	writeStringField(objectIDField, metaData.ObjectID)
+	writeInt64Field(offsetField, offset)
+	writeInt64Field(instanceIDField, metaData.InstanceID)
+	if compressed {
+		writeUint32(compressionField)
+		writeUint32(4)
+		writeUint32(compressionID)
+	}
+	if zeroFill != 0 {
+		writeInt64Field(zeroFillField, zeroFill)
+	}
+
+	// The data field's type and length, the data follows them
+	writeUint32(dataField)
+	writeUint32(uint32(dataLength))
+}
+
+// dataMessageHeaderSize returns the maximal size of the header of a data message of the object
+func dataMessageHeaderSize(metaData common.MetaData) int {
+	// magic, version, byte order mark, field count, the types and lengths of the fields (including the compression
+	// and zero-fill fields), the offset, instance ID and zero-fill length, and the compression algorithm
+	return 5*4 + (fieldCount+2)*2*4 + 3*8 + 4 + len(metaData.DestOrgID) + len(metaData.ObjectType) + len(metaData.ObjectID)
+}
+
+// DataMessageError describes why a data message failed to parse
+type DataMessageError struct {
+	// Field is the name of the part of the message that failed to parse
+	Field string
+	// Position is the position in the message of the part that failed to parse
+	Position int64
+	// Expected and Actual are the expected and the actual lengths (or values) of the part that failed to parse
+	Expected int64
+	Actual   int64
+	message  string
+}
+
+func (e *DataMessageError) Error() string {
+	return fmt.Sprintf("%s (field=%s, position=%d, expected=%d, actual=%d)", e.message, e.Field, e.Position, e.Expected, e.Actual)
+}
+
+// ValidateDataMessage parses a data message the same way it is parsed when it is received, without handling it.
+// It returns nil if the message is valid, and a *DataMessageError describing the first failure otherwise.
+func ValidateDataMessage(message []byte) error {
+	if _, _, _, _, _, _, _, _, _, err := parseDataMessage(message); err != nil {
+		return err
+	}
+	return nil
+}
+
+func swapUint32(value uint32) uint32 {
+	return value<<24 | (value<<8)&0x00FF0000 | (value>>8)&0x0000FF00 | value>>24
+}
+
+func dataFieldName(fieldType uint32) string {
+	switch int(fieldType) {
+	case orgIDField:
+		return "orgID"
+	case objectTypeField:
+		return "objectType"
+	case objectIDField:
+		return "objectID"
+	case offsetField:
+		return "offset"
+	case dataField:
+		return "data"
+	case instanceIDField:
+		return "instanceID"
+	case compressionField:
+		return "compression"
+	case zeroFillField:
+		return "zeroFill"
+	}
+	return fmt.Sprintf("unknown(%d)", fieldType)
+}
+
+// parseDataMessage parses a data message. If the data is compressed, compression is the ID of its compression algorithm,
+// and the data reader and length are of the compressed data. If the message is a zero-fill data message, zeroFill is
+// the number of zeros at offset, and the data is empty.
 func parseDataMessage(message []byte) (orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
-	offset int64, instanceID int64, err common.SyncServiceError) {
+	offset int64, instanceID int64, compression uint32, zeroFill int64, err common.SyncServiceError) {
 	var (
 		magicValue   uint32
 		versionMajor uint32
 		versionMinor uint32
+		mark         uint32
 		fieldCount   uint32
 		fieldType    uint32
 		fieldLength  uint32
-		rawString    []byte
-		count        int
 		dataOffset   int64
+		dataSeen     bool
 	)
 
+	var byteOrder binary.ByteOrder = binary.BigEndian
 	messageReader := bytes.NewReader(message)
-	if err = binary.Read(messageReader, binary.BigEndian, &magicValue); err != nil {
+	position := func() int64 {
+		return int64(len(message)) - int64(messageReader.Len())
+	}
+	// checkLength verifies that the message has length more bytes for the field
+	checkLength := func(field string, length int64) common.SyncServiceError {
+		if remaining := int64(messageReader.Len()); remaining < length {
+			return &DataMessageError{Field: field, Position: position(), Expected: length, Actual: remaining,
+				message: "Data message is too short"}
+		}
+		return nil
+	}
+	// The values are decoded from the message itself, rather than with binary.Read or into scratch slices,
+	// that allocate for every field
+	readUint32 := func(field string, value *uint32) common.SyncServiceError {
+		if err := checkLength(field, 4); err != nil {
+			return err
+		}
+		*value = byteOrder.Uint32(message[position():])
+		messageReader.Seek(4, io.SeekCurrent)
+		return nil
+	}
+	readInt64 := func(field string, length uint32, value *int64) common.SyncServiceError {
+		if length != 8 {
+			return &DataMessageError{Field: field, Position: position(), Expected: 8, Actual: int64(length),
+				message: fmt.Sprintf("Invalid length of the %s field", field)}
+		}
+		if err := checkLength(field, int64(length)); err != nil {
+			return err
+		}
+		*value = int64(byteOrder.Uint64(message[position():]))
+		messageReader.Seek(8, io.SeekCurrent)
+		return nil
+	}
+	readString := func(field string, length uint32) (string, common.SyncServiceError) {
+		if err := checkLength(field, int64(length)); err != nil {
+			return "", err
+		}
+		start := position()
+		messageReader.Seek(int64(length), io.SeekCurrent)
+		return string(message[start : start+int64(length)]), nil
+	}
+	if err = readUint32("magic", &magicValue); err != nil {
 		return
 	}
 	if magicValue != common.Magic {
-		err = &notificationHandlerError{"Invalid data."}
+		err = &DataMessageError{Field: "magic", Position: 0, Expected: int64(common.Magic), Actual: int64(magicValue), message: "Invalid data."}
 		return
 	}
 
-	if err = binary.Read(messageReader, binary.BigEndian, &versionMajor); err != nil {
+	// The version is decoded once the byte order is known
+	if err = readUint32("versionMajor", &versionMajor); err != nil {
 		return
 	}
-	if versionMajor != common.Version.Major {
-		err = &notificationHandlerError{"Wrong data version."}
+	if err = readUint32("versionMinor", &versionMinor); err != nil {
 		return
 	}
-	if err = binary.Read(messageReader, binary.BigEndian, &versionMinor); err != nil {
+
+	if messageReader.Len() >= 4 {
+		mark = binary.BigEndian.Uint32(message[position():])
+		switch mark {
+		case byteOrderMark:
+			messageReader.Seek(4, io.SeekCurrent)
+		case swapUint32(byteOrderMark):
+			byteOrder = binary.LittleEndian
+			versionMajor = swapUint32(versionMajor)
+			versionMinor = swapUint32(versionMinor)
+			messageReader.Seek(4, io.SeekCurrent)
+		default:
+			// No byte order mark, this is the field count of a big-endian message
+		}
+	}
+
+	// Any version between common.MinMessageVersion and common.Version is accepted
+	if versionMajor < common.MinMessageVersion.Major || versionMajor > common.Version.Major {
+		err = &DataMessageError{Field: "versionMajor", Position: 4, Expected: int64(common.Version.Major),
+			Actual: int64(versionMajor), message: "Wrong data version."}
 		return
 	}
-	if versionMinor != common.Version.Minor {
-		err = &notificationHandlerError{"Wrong data version."}
+	if !common.IsSupportedMessageVersion(common.SyncServiceVersion{Major: versionMajor, Minor: versionMinor}) {
+		err = &DataMessageError{Field: "versionMinor", Position: 8, Expected: int64(common.Version.Minor),
+			Actual: int64(versionMinor), message: "Wrong data version."}
 		return
 	}
 
-	if err = binary.Read(messageReader, binary.BigEndian, &fieldCount); err != nil {
+	if err = readUint32("fieldCount", &fieldCount); err != nil {
 		return
 	}
 
 	for i := 0; i < int(fieldCount); i++ {
-		if err = binary.Read(messageReader, binary.BigEndian, &fieldType); err != nil {
+		if err = readUint32("fieldType", &fieldType); err != nil {
 			return
 		}
-		if err = binary.Read(messageReader, binary.BigEndian, &fieldLength); err != nil {
+		field := dataFieldName(fieldType)
+		if err = readUint32(field+" length", &fieldLength); err != nil {
 			return
 		}
 
 		switch int(fieldType) {
 		case objectTypeField:
-			rawString = make([]byte, fieldLength)
-			count, err = messageReader.Read(rawString)
-			if err != nil {
-				return
-			}
-			if count != int(fieldLength) {
-				err = &notificationHandlerError{fmt.Sprintf("Read %d bytes for the object type, instead of %d", count, fieldLength)}
-				return
-			}
-			objectType = string(rawString)
+			objectType, err = readString(field, fieldLength)
 
 		case orgIDField:
-			rawString = make([]byte, fieldLength)
-			count, err = messageReader.Read(rawString)
-			if err != nil {
-				return
-			}
-			if count != int(fieldLength) {
-				err = &notificationHandlerError{fmt.Sprintf("Read %d bytes for the org ID, instead of %d", count, fieldLength)}
-				return
-			}
-			orgID = string(rawString)
+			orgID, err = readString(field, fieldLength)
 
 		case objectIDField:
-			rawString = make([]byte, fieldLength)
-			count, err = messageReader.Read(rawString)
-			if err != nil {
-				return
-			}
-			if count != int(fieldLength) {
-				err = &notificationHandlerError{fmt.Sprintf("Read %d bytes for the object id, instead of %d", count, fieldLength)}
-				return
-			}
-			objectID = string(rawString)
+			objectID, err = readString(field, fieldLength)
 
 		case offsetField:
-			if fieldLength != uint32(binary.Size(offset)) {
-				err = &notificationHandlerError{fmt.Sprintf("Length field for offset wasn't %d, it was %d", uint32(binary.Size(offset)),
-					fieldLength)}
-				return
-			}
-			if err = binary.Read(messageReader, binary.BigEndian, &offset); err != nil {
-				return
-			}
+			err = readInt64(field, fieldLength, &offset)
 
 		case instanceIDField:
-			if fieldLength != uint32(binary.Size(instanceID)) {
-				err = &notificationHandlerError{fmt.Sprintf("Length field for instance ID wasn't %d, it was %d", uint32(binary.Size(instanceID)),
-					fieldLength)}
-				return
-			}
-			if err = binary.Read(messageReader, binary.BigEndian, &instanceID); err != nil {
-				return
+			err = readInt64(field, fieldLength, &instanceID)
+
+		case compressionField:
+			if fieldLength != 4 {
+				err = &DataMessageError{Field: field, Position: position(), Expected: 4, Actual: int64(fieldLength),
+					message: fmt.Sprintf("Invalid length of the %s field", field)}
+			} else {
+				err = readUint32(field, &compression)
 			}
 
+		case zeroFillField:
+			err = readInt64(field, fieldLength, &zeroFill)
+
 		case dataField:
 			dataLength = fieldLength
-			dataOffset, err = messageReader.Seek(0, os.SEEK_CUR)
-			if err != nil {
-				return
-			}
-			_, err = messageReader.Seek(int64(fieldLength), os.SEEK_CUR)
-			if err != nil {
-				return
+			dataOffset = position()
+			dataSeen = true
+			if err = checkLength(field, int64(fieldLength)); err == nil {
+				messageReader.Seek(int64(fieldLength), io.SeekCurrent)
 			}
 
 		default:
 			if trace.IsLogging(logger.TRACE) {
 				trace.Trace("parseDataMessage encoutered an unrecognized field of type: %d, the Type/Length/Value is ignored\n", fieldType)
 			}
-			_, err = messageReader.Seek(int64(fieldLength), os.SEEK_CUR)
-			if err != nil {
-				return
+			if err = checkLength(field, int64(fieldLength)); err == nil {
+				messageReader.Seek(int64(fieldLength), io.SeekCurrent)
 			}
 		}
+		if err != nil {
+			return
+		}
 	}
 
-	if objectType == "" || objectID == "" || dataOffset == 0 {
-		err = &notificationHandlerError{"Invalid data message\n"}
-		return
+	switch {
+	case objectType == "":
+		err = &DataMessageError{Field: "objectType", Position: position(), message: "Invalid data message, missing object type"}
+	case objectID == "":
+		err = &DataMessageError{Field: "objectID", Position: position(), message: "Invalid data message, missing object ID"}
+	case !dataSeen:
+		err = &DataMessageError{Field: "data", Position: position(), message: "Invalid data message, missing data"}
+	case zeroFill < 0 || zeroFill > math.MaxUint32:
+		err = &DataMessageError{Field: "zeroFill", Position: position(), Actual: zeroFill,
+			message: "Invalid data message, invalid zero-fill length"}
+	case zeroFill != 0 && (dataLength != 0 || compression != 0):
+		err = &DataMessageError{Field: "zeroFill", Position: position(), Actual: int64(dataLength),
+			message: "Invalid data message, a zero-fill data message with data"}
 	}
-
-	_, err = messageReader.Seek(dataOffset, os.SEEK_SET)
 	if err != nil {
 		return
 	}
 
+	messageReader.Seek(dataOffset, io.SeekStart)
 	dataReader = io.LimitReader(messageReader, int64(dataLength))
 	return
 }
 
+// appendObjectData appends a chunk of data, encoded with the codec of the received data, to the stored object's data.
+// Appends that fail with a transient storage error are retried up to StorageMaxAttempts times, waiting StorageRetryInterval
+// milliseconds, doubled after each failed attempt, between the attempts. Other errors are returned immediately.
+func appendObjectData(orgID string, objectType string, objectID string, dataCodec *storage.ObjectDataCodec, dataReader io.Reader,
+	dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if common.Configuration.StorageMaxAttempts <= 1 {
+		encodingReader := dataCodec.NewEncodingReader(dataReader, offset)
+		return Store.AppendObjectData(orgID, objectType, objectID, encodingReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	}
+
+	// The data reader can't be rewound, read the chunk once so that it can be appended again
+	data := make([]byte, dataLength)
+	if _, err := io.ReadFull(dataReader, data); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Failed to read the data. Error: %s\n", err), category: ErrInvalidData}
+	}
+
+	backoff := time.Duration(common.Configuration.StorageRetryInterval) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		encodingReader := dataCodec.NewEncodingReader(bytes.NewReader(data), offset)
+		err := Store.AppendObjectData(orgID, objectType, objectID, encodingReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+		if err == nil || !storage.IsTransient(err) || attempt >= common.Configuration.StorageMaxAttempts {
+			return err
+		}
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to append the data at offset %d of %s:%s:%s (attempt %d), retrying in %s. Error: %s\n", offset,
+				orgID, objectType, objectID, attempt, backoff, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// appendZeroData appends a chunk of length zeros to the object's data. The zeros aren't written where the storage
+// stores them sparsely, unless a data codec is registered, as the stored data of the zeros is encoded.
+func appendZeroData(metaData common.MetaData, dataCodec *storage.ObjectDataCodec, length uint32, offset int64, isFirstChunk bool,
+	isLastChunk bool) common.SyncServiceError {
+	if metaData.DestinationDataURI != "" {
+		return dataURI.AppendZeroData(metaData.DestinationDataURI, length, offset, isLastChunk)
+	}
+	if dataCodec != nil {
+		return appendObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dataCodec,
+			storage.NewZeroReader(int64(length)), length, offset, metaData.ObjectSize, isFirstChunk, isLastChunk)
+	}
+	return Store.AppendObjectZeroData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, length, offset, metaData.ObjectSize,
+		isFirstChunk, isLastChunk)
+}
+
 // checkNotificationRecord checks notification's instanceID, status and offset.
 // It returns the expected size of the data and no error if everything is OK, and 0 and an error if not.
 func checkNotificationRecord(metaData common.MetaData, destType string, destID string, instanceID int64,
-	status string, offset int64) (int64, common.SyncServiceError) {
+	status string, offset int64, dataLength uint32) (int64, common.SyncServiceError) {
 
-	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+	if err := checkChunkOffset(metaData, offset, dataLength); err != nil {
+		return 0, err
+	}
+
+	notification, err := retrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
 		destType, destID)
 	if err != nil {
 		return 0, err
 	}
 	if notification == nil {
-		return 0, &notificationHandlerError{"No notification"}
+		return 0, &notificationHandlerError{message: "No notification", category: ErrNotificationNotFound}
 	}
 
-	if notification.InstanceID != instanceID {
-		return 0, &notificationHandlerError{fmt.Sprintf("InstanceID mismatch: expected=%d, received=%d", notification.InstanceID, instanceID)}
+	if common.CompareInstances(notification.InstanceID, 0, instanceID, 0) != 0 {
+		return 0, &notificationHandlerError{message: fmt.Sprintf("InstanceID mismatch: expected=%d, received=%d", notification.InstanceID, instanceID),
+			category: ErrInstanceMismatch}
 	}
 	if notification.Status != status {
-		return 0, &notificationHandlerError{fmt.Sprintf("Status mismatch: expected=%s, received=%s", notification.Status, status)}
+		return 0, &notificationHandlerError{message: fmt.Sprintf("Status mismatch: expected=%s, received=%s", notification.Status, status),
+			category: ErrInstanceMismatch}
 	}
 	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
 	notificationLock.RLock()
 	chunksInfo, ok := notificationChunks[id]
 	notificationLock.RUnlock()
 	if !ok {
-		return 0, &notificationHandlerError{"No notification chunk info"}
+		return 0, &notificationHandlerError{message: "No notification chunk info", category: ErrNotificationNotFound}
 	}
-	if _, ok := chunksInfo.chunkResendTimes[offset]; !ok {
-		return 0, &notificationHandlerError{fmt.Sprintf("Offset mismatch: %d not found in set of inflight requests", offset)}
+	// The chunk at the start of the data must have been requested. The data may carry the chunks that follow it,
+	// a sender whose data messages are larger than the chunk size sends them without their own requests.
+	chunk := chunksInfo.coveredChunks(offset, int64(dataLength))[0]
+	if _, ok := chunksInfo.chunkResendTimes[chunk]; !ok {
+		return 0, &notificationHandlerError{message: fmt.Sprintf("Offset mismatch: %d not found in set of inflight requests", chunk),
+			category: ErrInvalidData}
 	}
-	if len(chunksInfo.chunksReceived) == 0 {
-		return 0, &notificationHandlerError{"Invalid chunks info"}
+	if len(chunksInfo.chunksReceived) == 0 && chunksInfo.receivedIntervals == nil {
+		return 0, &notificationHandlerError{message: "Invalid chunks info", category: ErrInvalidData}
 	}
 	return chunksInfo.receivedDataSize, nil
 }
 
+// checkChunkOffset verifies that received data is either a part of one chunk, or whole chunks that start on a chunk boundary,
+// and that it doesn't extend beyond the end of the object
+func checkChunkOffset(metaData common.MetaData, offset int64, dataLength uint32) common.SyncServiceError {
+	if offset < 0 {
+		return &notificationHandlerError{message: fmt.Sprintf("Invalid offset: %d is negative", offset), category: ErrInvalidData}
+	}
+	if chunkSize := int64(metaData.ChunkSize); chunkSize > 0 {
+		end := offset + int64(dataLength)
+		chunkEnd := offset - offset%chunkSize + chunkSize
+		if end > chunkEnd && (offset%chunkSize != 0 || (end%chunkSize != 0 && end != metaData.ObjectSize)) {
+			return &notificationHandlerError{message: fmt.Sprintf("Invalid offset: data at offset %d of size %d is not aligned to the chunk size %d",
+				offset, dataLength, metaData.ChunkSize), category: ErrInvalidData}
+		}
+	}
+	if offset+int64(dataLength) > metaData.ObjectSize {
+		return &notificationHandlerError{message: fmt.Sprintf("Invalid offset: chunk at offset %d of size %d extends beyond the object size %d",
+			offset, dataLength, metaData.ObjectSize), category: ErrInvalidData}
+	}
+	return nil
+}
+
 func updateGetDataNotification(metaData common.MetaData, destType string, destID string, offset int64) common.SyncServiceError {
 	return updateNotificationChunkInfo(true, metaData, destType, destID, offset)
 }
 
+// updateGetDataRangeNotification records count consecutive chunks, starting at offset, as requested
+func updateGetDataRangeNotification(metaData common.MetaData, destType string, destID string, offset int64, count int) common.SyncServiceError {
+	if err := updateGetDataNotification(metaData, destType, destID, offset); err != nil {
+		return err
+	}
+	if metaData.ChunkSize <= 0 {
+		return nil
+	}
+	for i := 1; i < count; i++ {
+		offset += int64(metaData.ChunkSize)
+		if offset >= metaData.ObjectSize {
+			break
+		}
+		if err := updateNotificationChunkInfo(false, metaData, destType, destID, offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func updateNotificationChunkInfo(createNotification bool, metaData common.MetaData, destType string, destID string, offset int64) common.SyncServiceError {
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	common.ObjectLocks.Lock(lockIndex)
@@ -1542,24 +3551,40 @@ func updateNotificationChunkInfo(createNotification bool, metaData common.MetaDa
 
 	if !ok {
 		if createNotification {
-			err := Store.UpdateNotificationRecord(
+			err := updateNotificationRecord(
 				common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 					DestOrgID: metaData.DestOrgID, DestID: destID, DestType: destType,
-					Status: common.Getdata, InstanceID: metaData.InstanceID, DataID: metaData.DataID})
+					Status: common.Getdata, InstanceID: metaData.InstanceID, InstanceSequence: metaData.InstanceSequence,
+					DataID: metaData.DataID})
 			if err != nil {
-				return &notificationHandlerError{fmt.Sprintf("Failed to update notification record. Error: %s\n", err)}
+				return &notificationHandlerError{message: fmt.Sprintf("Failed to update notification record. Error: %s\n", err)}
 			}
 		}
 
-		chunksInfo = notificationChunksInfo{chunkSize: metaData.ChunkSize, chunkResendTimes: make(map[int64]int64)}
+		if reason := checkChunkBitmapSize(metaData); reason != "" {
+			return &notificationHandlerError{message: fmt.Sprintf("Failed to track the received chunks of %s %s. %s\n",
+				metaData.ObjectType, metaData.ObjectID, reason), category: ErrInvalidData}
+		}
+
+		chunksInfo = notificationChunksInfo{chunkSize: metaData.ChunkSize, chunkResendTimes: make(map[int64]int64),
+			chunkRequestCounts: make(map[int64]int), baseOffset: firstChunkOffset(metaData), dataSize: getDataSizeToReceive(metaData), objectSize: metaData.ObjectSize,
+			patchRanges: metaData.PatchRanges, priority: metaData.Priority, startTime: resendClock.Now()}
 		if chunksInfo.chunkSize > 0 {
-			numberOfBytes := int(((metaData.ObjectSize/int64(chunksInfo.chunkSize) + 1) / 8) + 1)
-			chunksInfo.chunksReceived = make([]byte, numberOfBytes)
+			numberOfBytes := chunkBitmapSize(metaData)
+			if usesChunkIntervalSet(metaData) {
+				chunksInfo.receivedIntervals = &chunkIntervalSet{size: numberOfBytes * 8}
+			} else {
+				chunksInfo.chunksReceived = make([]byte, numberOfBytes)
+			}
 		}
 	}
 
-	resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	resendTime := chunkResendTime()
 	chunksInfo.chunkResendTimes[offset] = resendTime
+	if chunksInfo.chunkRequestCounts == nil {
+		chunksInfo.chunkRequestCounts = make(map[int64]int)
+	}
+	chunksInfo.chunkRequestCounts[offset]++
 
 	if chunksInfo.maxRequestedOffset < offset {
 		chunksInfo.maxRequestedOffset = offset
@@ -1572,6 +3597,59 @@ func updateNotificationChunkInfo(createNotification bool, metaData common.MetaDa
 	return nil
 }
 
+// chunkBitmapSize returns the number of bytes of the bitmap with a bit per chunk of the object's data to receive,
+// sized by the chunk size of the object. In a patch update the bitmap covers only the extent of the patch ranges.
+func chunkBitmapSize(metaData common.MetaData) int64 {
+	if metaData.ChunkSize <= 0 {
+		return 0
+	}
+	extent := metaData.ObjectSize
+	if len(metaData.PatchRanges) != 0 {
+		extent = 0
+		for _, patchRange := range metaData.PatchRanges {
+			if end := patchRange.Offset + patchRange.Length; end > extent {
+				extent = end
+			}
+		}
+	}
+	extent -= firstChunkOffset(metaData)
+	if extent < 0 {
+		extent = 0
+	}
+	return ((extent/int64(metaData.ChunkSize) + 1) / 8) + 1
+}
+
+// usesChunkIntervalSet returns true if the received chunks of the object's data are tracked as a set of intervals
+// instead of a bitmap
+func usesChunkIntervalSet(metaData common.MetaData) bool {
+	threshold := common.Configuration.ChunkIntervalSetThreshold
+	return threshold > 0 && metaData.ObjectSize > threshold
+}
+
+// checkChunkBitmapSize returns the reason to reject the object if the bitmap of its received chunks would exceed
+// MaxChunkBitmapSize, or an empty string otherwise
+func checkChunkBitmapSize(metaData common.MetaData) string {
+	maxSize := common.Configuration.MaxChunkBitmapSize
+	if maxSize <= 0 || usesChunkIntervalSet(metaData) {
+		return ""
+	}
+	if size := chunkBitmapSize(metaData); size > maxSize {
+		return fmt.Sprintf("The bitmap of the received chunks of the object (%d bytes for a chunk size of %d) exceeds the maximum bitmap size (%d)",
+			size, metaData.ChunkSize, maxSize)
+	}
+	return ""
+}
+
+// chunkResendTime returns the time at which unreceived chunks are requested again: ChunkResendInterval seconds from now,
+// plus a random jitter of up to ResendJitterPercent of that interval
+func chunkResendTime() int64 {
+	interval := int64(common.Configuration.ChunkResendInterval)
+	if jitter := interval * int64(common.Configuration.ResendJitterPercent) / 100; jitter > 0 {
+		interval += rand.Int63n(jitter + 1)
+	}
+	return resendClock.Now().Unix() + interval
+}
+
 func removeNotificationChunksInfo(metaData common.MetaData, destType string, destID string) {
 	deleteNotificationChunksInfo(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
 }
@@ -1581,99 +3659,705 @@ func deleteNotificationChunksInfo(orgID string, objectType string, objectID stri
 	notificationLock.Lock()
 	delete(notificationChunks, id)
 	notificationLock.Unlock()
+
+	releaseTransferSlot(orgID, objectType, objectID, destType, destID)
+}
+
+// getReceivedDataCodec returns the codec that encodes the received data of the object. The first chunk starts a new copy
+// of the data, with a new codec, and the following chunks use its codec, which is looked up in the store if the transfer
+// was resumed.
+func getReceivedDataCodec(metaData common.MetaData, isFirstChunk bool) (*storage.ObjectDataCodec, common.SyncServiceError) {
+	if metaData.DestinationDataURI != "" || !storage.HasDataCodec() {
+		return nil, nil
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.Lock()
+	defer notificationLock.Unlock()
+
+	chunksInfo, ok := notificationChunks[id]
+	if ok && chunksInfo.dataCodec != nil && !isFirstChunk {
+		return chunksInfo.dataCodec, nil
+	}
+	var dataCodec *storage.ObjectDataCodec
+	var err common.SyncServiceError
+	if isFirstChunk {
+		dataCodec, err = storage.NewObjectDataCodec()
+	} else {
+		dataCodec, err = Store.RetrieveObjectDataCodec(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		chunksInfo.dataCodec = dataCodec
+		notificationChunks[id] = chunksInfo
+	}
+	return dataCodec, nil
 }
 
-func handleChunkReceived(metaData common.MetaData, offset int64, size int64) (int64, common.SyncServiceError) {
+// handleChunkReceived records the data at offset as received. The data is either a part of one chunk, or one or more whole chunks.
+// It returns the largest requested offset and the number of chunks that the data completed.
+func handleChunkReceived(metaData common.MetaData, offset int64, size int64) (int64, int, common.SyncServiceError) {
 	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
 	notificationLock.RLock()
 	chunksInfo, ok := notificationChunks[id]
 	notificationLock.RUnlock()
 	if !ok {
-		return 0, &notificationHandlerError{"Chunks info not found"}
+		return 0, 0, &notificationHandlerError{message: "Chunks info not found", category: ErrNotificationNotFound}
 	}
 
-	if _, ok := chunksInfo.chunkResendTimes[offset]; !ok {
-		return 0, &notificationHandlerError{"Chunk's resend time not found"}
+	// Only the chunk at the start of the data was necessarily requested, see checkNotificationRecord
+	chunks := chunksInfo.coveredChunks(offset, size)
+	if _, ok := chunksInfo.chunkResendTimes[chunks[0]]; !ok {
+		return 0, 0, &notificationHandlerError{message: "Chunk's resend time not found", category: ErrNotificationNotFound}
 	}
-	delete(chunksInfo.chunkResendTimes, offset)
-
-	// The chunksInfo.chunksReceived byte array holds a bit per chunk (identified by its offset), so each byte holds the bits of 8 chunks.
-	// To access the bit of a given chunk:
-	//  offset/chunkSize is the chunkIndex
-	//  chunkIndex/8 is the byteIndex
-	//  chunkIndex&7 is the bitIndex
-	//  (1 << bitIndex) is the bitMask which has 1 at bitIndex
-	chunkIndex := uint(offset / int64(chunksInfo.chunkSize))
-	byteIndex := chunkIndex >> 3
-	bitIndex := chunkIndex & 7
-	bitMask := byte(1 << bitIndex)
-	if chunksInfo.chunksReceived[byteIndex]&bitMask == 0 {
-		chunksInfo.receivedDataSize += size
-		chunksInfo.chunksReceived[byteIndex] |= bitMask
-	} else {
-		if trace.IsLogging(logger.INFO) {
-			trace.Info("Chunk with offset %d of object %s:%s:%s already received.\n", offset,
-				metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	for _, chunk := range chunks {
+		if !chunksInfo.isChunkInRange(chunk) {
+			return 0, 0, &notificationHandlerError{message: fmt.Sprintf("Chunk with offset %d is outside of the requested data", chunk),
+				category: ErrInvalidData}
 		}
 	}
 
-	if chunksInfo.maxReceivedOffset < offset {
-		chunksInfo.maxReceivedOffset = offset
+	completed := 0
+	for _, chunk := range chunks {
+		if chunksInfo.isChunkPart(chunk, offset, size) {
+			if !chunksInfo.addChunkPart(chunk, offset, size) {
+				continue
+			}
+			chunksInfo.receivedDataSize += size
+			if chunksInfo.chunkPartsSize(chunk) < chunksInfo.chunkLength(chunk) {
+				continue
+			}
+			delete(chunksInfo.chunkParts, chunk)
+			chunksInfo.markChunk(chunk)
+		} else {
+			partsSize := chunksInfo.chunkPartsSize(chunk)
+			delete(chunksInfo.chunkParts, chunk)
+			if chunksInfo.markChunk(chunk) {
+				chunksInfo.receivedDataSize += chunksInfo.chunkLength(chunk) - partsSize
+			} else {
+				if trace.IsLogging(logger.INFO) {
+					trace.Info("Chunk with offset %d of object %s:%s:%s already received.\n", chunk,
+						metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+				}
+			}
+		}
+
+		delete(chunksInfo.chunkResendTimes, chunk)
+		delete(chunksInfo.chunkRequestCounts, chunk)
+		completed++
+		if chunksInfo.maxReceivedOffset < chunk {
+			chunksInfo.maxReceivedOffset = chunk
+		}
 	}
 
-	chunksInfo.resendTime = time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	chunksInfo.resendTime = chunkResendTime()
 	notificationLock.Lock()
 	notificationChunks[id] = chunksInfo
 	notificationLock.Unlock()
 
-	return chunksInfo.maxRequestedOffset, nil
+	return chunksInfo.maxRequestedOffset, completed, nil
+}
+
+// coveredChunks returns the offsets of the chunks that the data at offset overlaps
+func (chunksInfo *notificationChunksInfo) coveredChunks(offset int64, size int64) []int64 {
+	chunkSize := int64(chunksInfo.chunkSize)
+	if chunkSize <= 0 {
+		return []int64{offset}
+	}
+	chunks := []int64{offset - offset%chunkSize}
+	for chunk := chunks[0] + chunkSize; chunk < offset+size; chunk += chunkSize {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// chunkLength returns the length of the chunk at offset, the last chunk of the object may be shorter
+func (chunksInfo *notificationChunksInfo) chunkLength(offset int64) int64 {
+	length := int64(chunksInfo.chunkSize)
+	if offset+length > chunksInfo.objectSize {
+		length = chunksInfo.objectSize - offset
+	}
+	return length
+}
+
+// isChunkPart returns true if the data at offset is only a part of the chunk
+func (chunksInfo *notificationChunksInfo) isChunkPart(chunk int64, offset int64, size int64) bool {
+	return chunksInfo.chunkSize > 0 && (offset > chunk || offset+size < chunk+chunksInfo.chunkLength(chunk))
+}
+
+// addChunkPart records a received part of the chunk. It returns false if the part was already received.
+func (chunksInfo *notificationChunksInfo) addChunkPart(chunk int64, offset int64, size int64) bool {
+	if chunksInfo.chunkParts == nil {
+		chunksInfo.chunkParts = make(map[int64]map[int64]int64)
+	}
+	parts, ok := chunksInfo.chunkParts[chunk]
+	if !ok {
+		parts = make(map[int64]int64)
+		chunksInfo.chunkParts[chunk] = parts
+	}
+	if _, ok := parts[offset]; ok {
+		return false
+	}
+	parts[offset] = size
+	return true
+}
+
+// chunkPartsSize returns the number of bytes of the received parts of the chunk
+func (chunksInfo *notificationChunksInfo) chunkPartsSize(chunk int64) int64 {
+	var size int64
+	for _, length := range chunksInfo.chunkParts[chunk] {
+		size += length
+	}
+	return size
+}
+
+// newDataSize returns the number of bytes of the data at offset that weren't received yet
+func (chunksInfo *notificationChunksInfo) newDataSize(offset int64, size int64) int64 {
+	if chunksInfo.chunkSize <= 0 {
+		return size
+	}
+	var newSize int64
+	for _, chunk := range chunksInfo.coveredChunks(offset, size) {
+		if chunksInfo.isChunkMarked(chunk) {
+			continue
+		}
+		if chunksInfo.isChunkPart(chunk, offset, size) {
+			if _, ok := chunksInfo.chunkParts[chunk][offset]; !ok {
+				newSize += size
+			}
+		} else {
+			newSize += chunksInfo.chunkLength(chunk) - chunksInfo.chunkPartsSize(chunk)
+		}
+	}
+	return newSize
+}
+
+// chunkBit returns the position of the bit of the chunk at offset in the chunks received bitmap.
+// The chunksInfo.chunksReceived byte array holds a bit per chunk (identified by its offset), so each byte holds the bits of 8 chunks.
+// To access the bit of a given chunk:
+//
+//	offset/chunkSize is the chunkIndex
+//	chunkIndex/8 is the byteIndex
+//	chunkIndex&7 is the bitIndex
+//	(1 << bitIndex) is the bitMask which has 1 at bitIndex
+func chunkBit(chunkSize int, offset int64) (uint, byte) {
+	chunkIndex := uint(offset / int64(chunkSize))
+	byteIndex := chunkIndex >> 3
+	bitIndex := chunkIndex & 7
+	return byteIndex, byte(1 << bitIndex)
+}
+
+// isChunkInRange returns true if the chunk at offset can be marked as received
+func (chunksInfo *notificationChunksInfo) isChunkInRange(offset int64) bool {
+	if chunksInfo.chunkSize <= 0 || offset < chunksInfo.baseOffset {
+		return false
+	}
+	if chunksInfo.receivedIntervals != nil {
+		return (offset-chunksInfo.baseOffset)/int64(chunksInfo.chunkSize) < chunksInfo.receivedIntervals.size
+	}
+	byteIndex, _ := chunkBit(chunksInfo.chunkSize, offset-chunksInfo.baseOffset)
+	return int(byteIndex) < len(chunksInfo.chunksReceived)
+}
+
+// isChunkMarked returns true if the chunk at offset is marked as received
+func (chunksInfo *notificationChunksInfo) isChunkMarked(offset int64) bool {
+	if !chunksInfo.isChunkInRange(offset) {
+		return false
+	}
+	if chunksInfo.receivedIntervals != nil {
+		return chunksInfo.receivedIntervals.contains((offset - chunksInfo.baseOffset) / int64(chunksInfo.chunkSize))
+	}
+	byteIndex, bitMask := chunkBit(chunksInfo.chunkSize, offset-chunksInfo.baseOffset)
+	return chunksInfo.chunksReceived[byteIndex]&bitMask != 0
+}
+
+// markChunk marks the chunk at offset as received. The chunk must be in range (see isChunkInRange).
+// It returns false if the chunk was already marked.
+func (chunksInfo *notificationChunksInfo) markChunk(offset int64) bool {
+	if chunksInfo.receivedIntervals != nil {
+		return chunksInfo.receivedIntervals.add((offset - chunksInfo.baseOffset) / int64(chunksInfo.chunkSize))
+	}
+	byteIndex, bitMask := chunkBit(chunksInfo.chunkSize, offset-chunksInfo.baseOffset)
+	if chunksInfo.chunksReceived[byteIndex]&bitMask != 0 {
+		return false
+	}
+	chunksInfo.chunksReceived[byteIndex] |= bitMask
+	return true
+}
+
+// chunkInterval is a range of consecutive chunk indexes, from start up to, but not including, end
+type chunkInterval struct {
+	start int64
+	end   int64
+}
+
+// chunkIntervalSet holds the indexes of the received chunks as a sorted list of disjoint, non adjacent intervals.
+// The chunks of an object are mostly received in order, so the set holds a few intervals, while the bitmap of
+// a very large object takes a bit per chunk for the whole transfer.
+type chunkIntervalSet struct {
+	intervals []chunkInterval
+	size      int64 // The number of chunks the set can hold
+}
+
+func (set *chunkIntervalSet) contains(index int64) bool {
+	i := sort.Search(len(set.intervals), func(i int) bool { return set.intervals[i].end > index })
+	return i < len(set.intervals) && set.intervals[i].start <= index
+}
+
+// add adds index to the set, it returns false if the index is already in the set
+func (set *chunkIntervalSet) add(index int64) bool {
+	// The first interval that contains index, or ends right before it, or starts after it
+	i := sort.Search(len(set.intervals), func(i int) bool { return set.intervals[i].end >= index })
+	if i < len(set.intervals) {
+		interval := &set.intervals[i]
+		switch {
+		case interval.start <= index && index < interval.end:
+			return false
+		case interval.end == index:
+			interval.end++
+			if i+1 < len(set.intervals) && set.intervals[i+1].start == interval.end {
+				// The gap between the intervals is closed
+				interval.end = set.intervals[i+1].end
+				set.intervals = append(set.intervals[:i+1], set.intervals[i+2:]...)
+			}
+			return true
+		case interval.start == index+1:
+			interval.start = index
+			return true
+		}
+	}
+	set.intervals = append(set.intervals, chunkInterval{})
+	copy(set.intervals[i+1:], set.intervals[i:])
+	set.intervals[i] = chunkInterval{start: index, end: index + 1}
+	return true
+}
+
+// getNewDataSize returns the number of bytes of the data at offset of the object's data that weren't received yet from the object's origin
+func getNewDataSize(metaData common.MetaData, offset int64, size int64) int64 {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	chunksInfo, ok := notificationChunks[id]
+	if !ok {
+		return size
+	}
+	return chunksInfo.newDataSize(offset, size)
+}
+
+// getReceivedDataSize returns the number of bytes of the object's data that were received from the object's origin
+func getReceivedDataSize(metaData common.MetaData) int64 {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	return notificationChunks[id].receivedDataSize
+}
+
+// isChunkReceived returns true if the chunk at offset of the object's data was already received from the object's origin
+func isChunkReceived(metaData common.MetaData, offset int64) bool {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	chunksInfo, ok := notificationChunks[id]
+	if !ok {
+		return false
+	}
+	return chunksInfo.isChunkMarked(offset)
+}
+
+// GetTransferProgress returns the progress of receiving the data of the object from the specified origin.
+// It returns false if the object's data is not being received.
+func GetTransferProgress(orgID string, objectType string, objectID string, destType string, destID string) (common.TransferProgress, bool) {
+	// The chunks info maps are updated under the object lock
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.RLock(lockIndex)
+	defer common.ObjectLocks.RUnlock(lockIndex)
+
+	id := common.CreateNotificationID(orgID, objectType, objectID, destType, destID)
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	chunksInfo, ok := notificationChunks[id]
+	if !ok {
+		return common.TransferProgress{}, false
+	}
+	return common.TransferProgress{ReceivedBytes: chunksInfo.receivedDataSize, TotalBytes: chunksInfo.dataSize,
+		InflightChunks: len(chunksInfo.chunkResendTimes)}, true
+}
+
+// ActiveTransfer describes a transfer of an object's data that is being received by this node
+type ActiveTransfer struct {
+	OrgID      string
+	ObjectType string
+	ObjectID   string
+
+	// DestType and DestID identify the node the data is received from, the destination of the notification
+	DestType string
+	DestID   string
+
+	ReceivedBytes  int64
+	TotalBytes     int64
+	InflightChunks int
+
+	// NextResend is the earliest time at which a chunk is requested again, zero if no resend is scheduled
+	NextResend time.Time
+
+	// StartTime is the time the first chunk was requested
+	StartTime time.Time
+
+	// Failed is true if a chunk was requested too many times (see MaxChunkResends), and the transfer was stopped
+	Failed bool
+}
+
+// ListActiveTransfers returns a snapshot of all the transfers of objects' data that are being received by this node,
+// sorted by the objects and their origins
+func ListActiveTransfers() []ActiveTransfer {
+	notificationLock.RLock()
+	ids := make([]string, 0, len(notificationChunks))
+	transfers := make(map[string]ActiveTransfer, len(notificationChunks))
+	for id, chunksInfo := range notificationChunks {
+		transfer := ActiveTransfer{ReceivedBytes: chunksInfo.receivedDataSize, TotalBytes: chunksInfo.dataSize,
+			InflightChunks: len(chunksInfo.chunkResendTimes), StartTime: chunksInfo.startTime, Failed: chunksInfo.failed}
+		nextResend := chunksInfo.resendTime
+		for _, resendTime := range chunksInfo.chunkResendTimes {
+			if resendTime < nextResend || nextResend == 0 {
+				nextResend = resendTime
+			}
+		}
+		if nextResend != 0 {
+			transfer.NextResend = time.Unix(nextResend, 0)
+		}
+		ids = append(ids, id)
+		transfers[id] = transfer
+	}
+	notificationLock.RUnlock()
+
+	sort.Strings(ids)
+	result := make([]ActiveTransfer, 0, len(ids))
+	for _, id := range ids {
+		transfer := transfers[id]
+		var ok bool
+		transfer.OrgID, transfer.ObjectType, transfer.ObjectID, transfer.DestType, transfer.DestID, ok = splitNotificationID(id)
+		if !ok {
+			continue
+		}
+		result = append(result, transfer)
+	}
+	return result
+}
+
+// splitNotificationID returns the organization, object type, object ID, destination type and destination ID
+// of a notification ID created by common.CreateNotificationID
+func splitNotificationID(id string) (string, string, string, string, string, bool) {
+	// The object's ID may contain colons, the other parts of the notification ID may not
+	parts := strings.Split(id, ":")
+	if len(parts) < 5 {
+		return "", "", "", "", "", false
+	}
+	last := len(parts) - 1
+	return parts[0], parts[1], strings.Join(parts[2:last-1], ":"), parts[last-1], parts[last], true
+}
+
+// HandOffMovedTransfers is called when the objects are reassigned to the CSS instances (see leader.CheckIfOwner).
+// The instance stops receiving the data of the objects that it no longer owns. The instance that now owns such an object
+// requests its data in the next resend of notifications, as after a restart.
+func HandOffMovedTransfers() {
+	notificationLock.RLock()
+	moved := make([]string, 0)
+	for id := range notificationChunks {
+		if orgID, objectType, objectID, _, _, ok := splitNotificationID(id); ok && !leader.CheckIfOwner(orgID, objectType, objectID) {
+			moved = append(moved, id)
+		}
+	}
+	notificationLock.RUnlock()
+
+	for _, id := range moved {
+		orgID, objectType, objectID, originType, originID, _ := splitNotificationID(id)
+		lockIndex := common.HashStrings(orgID, objectType, objectID)
+		common.ObjectLocks.Lock(lockIndex)
+		deleteNotificationChunksInfo(orgID, objectType, objectID, originType, originID)
+		common.ObjectLocks.Unlock(lockIndex)
+		if log.IsLogging(logger.INFO) {
+			log.Info("Handing off the transfer of the data of %s:%s:%s to its new owner\n", orgID, objectType, objectID)
+		}
+	}
+}
+
+// ChunkState describes the state of receiving the chunks of an object's data, for debugging stuck transfers
+type ChunkState struct {
+	ChunkSize        int
+	DataSize         int64
+	ReceivedDataSize int64
+
+	// Received and Missing are the byte ranges of the requested data whose chunks were received or not received yet
+	Received []common.ByteRange
+	Missing  []common.ByteRange
+
+	// Inflight are the chunks that were requested but not received yet
+	Inflight []InflightChunk
+}
+
+// InflightChunk describes a chunk that was requested but not received yet
+type InflightChunk struct {
+	Offset int64
+
+	// ResendIn is the time left until the chunk is requested again, negative if the resend is overdue
+	ResendIn time.Duration
+
+	// Requests is the number of times the chunk was requested
+	Requests int
+}
+
+// DumpChunkState returns the state of receiving the chunks of the notification with the given ID
+// (see common.CreateNotificationID). It returns false if the object's data is not being received.
+func DumpChunkState(notificationID string) (ChunkState, bool) {
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	chunksInfo, ok := notificationChunks[notificationID]
+	if !ok {
+		return ChunkState{}, false
+	}
+
+	state := ChunkState{ChunkSize: chunksInfo.chunkSize, DataSize: chunksInfo.dataSize, ReceivedDataSize: chunksInfo.receivedDataSize,
+		Received: make([]common.ByteRange, 0), Missing: make([]common.ByteRange, 0), Inflight: make([]InflightChunk, 0)}
+
+	if chunksInfo.chunkSize > 0 && chunksInfo.objectSize > 0 {
+		metaData := common.MetaData{ChunkSize: chunksInfo.chunkSize, ObjectSize: chunksInfo.objectSize, PatchRanges: chunksInfo.patchRanges}
+		for offset, ok := firstChunkOffset(metaData), true; ok; offset, ok = nextChunkOffset(metaData, offset) {
+			length := int64(chunksInfo.chunkSize)
+			if offset+length > chunksInfo.objectSize {
+				length = chunksInfo.objectSize - offset
+			}
+			if chunksInfo.isChunkMarked(offset) {
+				state.Received = appendByteRange(state.Received, offset, length)
+			} else {
+				state.Missing = appendByteRange(state.Missing, offset, length)
+			}
+		}
+	}
+
+	now := resendClock.Now().Unix()
+	for offset, resendTime := range chunksInfo.chunkResendTimes {
+		state.Inflight = append(state.Inflight, InflightChunk{Offset: offset, ResendIn: time.Duration(resendTime-now) * time.Second,
+			Requests: chunksInfo.chunkRequestCounts[offset]})
+	}
+	sort.Slice(state.Inflight, func(i, j int) bool { return state.Inflight[i].Offset < state.Inflight[j].Offset })
+
+	return state, true
+}
+
+// appendByteRange appends a range to a list of ranges, merging it with the last range if they are adjacent
+func appendByteRange(ranges []common.ByteRange, offset int64, length int64) []common.ByteRange {
+	if last := len(ranges) - 1; last >= 0 && ranges[last].Offset+ranges[last].Length == offset {
+		ranges[last].Length += length
+		return ranges
+	}
+	return append(ranges, common.ByteRange{Offset: offset, Length: length})
 }
 
 func handleDataReceived(metaData common.MetaData) {
 	removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
 }
 
+// chunkRange is a range of consecutive chunks of an object's data that are requested together
+type chunkRange struct {
+	offset int64
+	count  int
+}
+
+// getChunkRanges groups the offsets of the chunks of the object's data into ranges of consecutive chunks,
+// so that the chunks of each range are requested in one request
+func getChunkRanges(metaData common.MetaData, offsets []int64) []chunkRange {
+	sorted := make([]int64, len(offsets))
+	copy(sorted, offsets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ranges := make([]chunkRange, 0, len(sorted))
+	for _, offset := range sorted {
+		if last := len(ranges) - 1; last >= 0 && metaData.ChunkSize > 0 &&
+			ranges[last].offset+int64(ranges[last].count)*int64(metaData.ChunkSize) == offset {
+			ranges[last].count++
+			continue
+		}
+		ranges = append(ranges, chunkRange{offset: offset, count: 1})
+	}
+	return ranges
+}
+
 func getOffsetsToResend(notification common.Notification, metaData common.MetaData) []int64 {
 	offsets := make([]int64, 0)
 
+	if isDestinationPaused(notification.DestOrgID, notification.DestType, notification.DestID) {
+		return offsets
+	}
+
 	id := common.GetNotificationID(notification)
 	notificationLock.RLock()
 	chunksInfo, ok := notificationChunks[id]
-	notificationLock.RUnlock()
 	if !ok {
+		notificationLock.RUnlock()
 		return getOffsetsForResendFromScratch(notification, metaData)
 	}
+	if chunksInfo.failed {
+		notificationLock.RUnlock()
+		return offsets
+	}
+	// The resend policy gets a copy of the state of the transfer, so that it can't change it
+	snapshot := newResendSnapshot(notification, chunksInfo)
+	notificationLock.RUnlock()
+
+	offsets, requests := offsetsToResend(snapshot)
 
-	// The code below checks for missing chunks, i.e., chunks that have been requested but not received (e.g., lost in the network)
-	// We do this when chunksInfo.resendTime is less than the current time, meaning no chunks were received during that period.
-	// Otherwise, we may still want to ask to resend chunks, if they were received out of order.
-	// To check this efficiently (without scanning the map each time) the code maintains two parameters:
-	//  1. maxRequestedOffset - the largest offset that has been requested (updated when a new offset is requested)
-	//  2. maxReceivedOffset - the largest offset that has been received (updated when a new chunk with a larger offset is received)
-	// Information about the chunks that have been requested but not yet received is stored in the chunksInfo.chunkResendTimes.
-	// When the chunks arrive without any gaps (maxRequestedOffset-maxReceivedOffset)/chunkSize should be equal to the number of
-	// elements in the chunkResendTimes map.
-	// If the number of elements in the map, i.e. len(chunksInfo.chunkResendTimes), is larger, it means that one or more chunks has not
-	// been received or that chunks have been received out of order.
-	// In such cases we want to scan the map and see if a chunk has to be re-requested.
-	currentTime := time.Now().Unix()
-	if chunksInfo.resendTime <= currentTime ||
-		(chunksInfo.chunkSize > 0 &&
-			int(chunksInfo.maxRequestedOffset-chunksInfo.maxReceivedOffset)/chunksInfo.chunkSize < len(chunksInfo.chunkResendTimes)) {
-		for offset, resendTime := range chunksInfo.chunkResendTimes {
-			if resendTime <= currentTime {
-				offsets = append(offsets, offset)
+	// The requests of a chunk are counted whether it is requested again because its resend time expired or because
+	// chunks were received out of order
+	if maxResends := common.Configuration.MaxChunkResends; maxResends > 0 {
+		for _, offset := range offsets {
+			if requests[offset] > maxResends {
+				failTransfer(notification, metaData, offset, requests[offset])
+				return make([]int64, 0)
 			}
 		}
 	}
+
+	// The chunks of a normal priority object that aren't requested again now are requested in the next scans
+	if share := getPriorityShare(metaData, len(offsets)); share < len(offsets) {
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		offsets = offsets[:share]
+	}
 	return offsets
 }
 
+// failTransfer stops requesting the chunks of the object's data after the chunk at offset was requested too many times.
+// The object, its received data, and the state of the transfer are kept for inspection, see RetryFailedTransfer.
+func failTransfer(notification common.Notification, metaData common.MetaData, offset int64, requests int) {
+	lockIndex := common.HashStrings(notification.DestOrgID, notification.ObjectType, notification.ObjectID)
+	common.ObjectLocks.Lock(lockIndex)
+
+	id := common.GetNotificationID(notification)
+	notificationLock.Lock()
+	if chunksInfo, ok := notificationChunks[id]; ok {
+		chunksInfo.failed = true
+		notificationChunks[id] = chunksInfo
+	}
+	notificationLock.Unlock()
+
+	notification.Status = common.TransferFailed
+	if err := updateNotificationRecord(notification); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to update notification record. Error: %s\n", err)
+	}
+	common.ObjectLocks.Unlock(lockIndex)
+
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Failed to receive the data of %s:%s:%s, the chunk at offset %d was requested %d times\n", notification.DestOrgID,
+			notification.ObjectType, notification.ObjectID, offset, requests)
+	}
+	releaseTransferSlot(notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType, notification.DestID)
+}
+
+// GetFailedTransfers returns the notification records of the objects of the organization (of all the organizations if orgID
+// is empty) whose data failed to be received since a chunk was requested more than MaxChunkResends times, since their
+// data failed verification more than MaxChunkResends times, or since their linked data couldn't be fetched
+func GetFailedTransfers(orgID string) ([]common.Notification, common.SyncServiceError) {
+	return Store.RetrieveNotificationsWithStatus(orgID, common.TransferFailed)
+}
+
+// RetryFailedTransfer resumes receiving the data of an object whose transfer failed.
+// The chunks that weren't received are requested again in the next resend of notifications, and linked data is fetched again.
+func RetryFailedTransfer(orgID string, objectType string, objectID string) common.SyncServiceError {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in RetryFailedTransfer: failed to retrieve object. Error: %s\n", err)}
+	}
+	if metaData == nil {
+		return &notificationHandlerError{message: "Error in RetryFailedTransfer: object not found.", category: ErrNotificationNotFound}
+	}
+	notification, err := Store.RetrieveNotificationRecord(orgID, objectType, objectID, metaData.OriginType, metaData.OriginID)
+	if err != nil || notification == nil || notification.Status != common.TransferFailed {
+		return &notificationHandlerError{message: "Error in RetryFailedTransfer: the transfer of the object's data didn't fail.",
+			category: ErrNotificationNotFound}
+	}
+
+	if metaData.Link != "" && common.Configuration.FetchLinkedData {
+		// The linked data is fetched again
+		if err := Store.DeleteNotificationRecords(orgID, objectType, objectID, metaData.OriginType, metaData.OriginID); err != nil {
+			return &notificationHandlerError{message: fmt.Sprintf("Error in RetryFailedTransfer: failed to delete notification record. Error: %s\n", err)}
+		}
+		go func(metaData common.MetaData) {
+			if err := fetchLinkedData(metaData); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error(err.Error())
+			}
+		}(*metaData)
+		return nil
+	}
+
+	notification.Status = common.Getdata
+	if err := updateNotificationRecord(*notification); err != nil {
+		return &notificationHandlerError{message: fmt.Sprintf("Error in RetryFailedTransfer: failed to update notification record. Error: %s\n", err)}
+	}
+
+	id := common.GetNotificationID(*notification)
+	notificationLock.Lock()
+	if chunksInfo, ok := notificationChunks[id]; ok {
+		chunksInfo.failed = false
+		chunksInfo.chunkRequestCounts = make(map[int64]int)
+		for offset := range chunksInfo.chunkResendTimes {
+			chunksInfo.chunkResendTimes[offset] = 0
+		}
+		chunksInfo.resendTime = 0
+		notificationChunks[id] = chunksInfo
+	}
+	notificationLock.Unlock()
+
+	if log.IsLogging(logger.INFO) {
+		log.Info("Retrying the transfer of the data of %s:%s:%s\n", orgID, objectType, objectID)
+	}
+	return nil
+}
+
+// getPriorityShare returns the number of the object's chunks to request out of count chunks.
+// While the data of high priority objects is being received, normal priority objects get 1/PriorityWeight of the chunks.
+func getPriorityShare(metaData common.MetaData, count int) int {
+	if metaData.Priority == common.PriorityHigh || common.Configuration.PriorityWeight <= 1 || count <= 1 ||
+		!isHighPriorityTransferActive() {
+		return count
+	}
+	if share := count / common.Configuration.PriorityWeight; share > 1 {
+		return share
+	}
+	return 1
+}
+
+// isHighPriorityTransferActive returns true if the data of a high priority object is being received
+func isHighPriorityTransferActive() bool {
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	for _, chunksInfo := range notificationChunks {
+		if chunksInfo.priority == common.PriorityHigh {
+			return true
+		}
+	}
+	return false
+}
+
 // Handle the case of resending get data notification after node restart, i.e. there is no chunksInfo for the notification
 // Can be only called after obtaining a notification lock
 func getOffsetsForResendFromScratch(notification common.Notification, metaData common.MetaData) []int64 {
 	offsets := make([]int64, 0)
 
+	if IsShuttingDown() {
+		// The transfer is resumed after the restart
+		return offsets
+	}
+
 	protocol, err := Store.RetrieveDestinationProtocol(notification.DestOrgID, notification.DestType, notification.DestID)
 	if err != nil {
 		if log.IsLogging(logger.ERROR) {
@@ -1695,18 +4379,96 @@ func getOffsetsForResendFromScratch(notification common.Notification, metaData c
 		return offsets
 	}
 
-	if metaData.ChunkSize <= 0 || metaData.ObjectSize <= 0 {
-		offsets = append(offsets, 0)
-	} else {
-		var offset int64
-		for i := 0; i < maxInflightChunks && offset < metaData.ObjectSize; i++ {
+	if !reconcileLoggedDataChunks(notification, metaData) {
+		return append(offsets, getInitialChunkOffsets(metaData, getPriorityShare(metaData, maxInflightChunks))...)
+	}
+
+	// Request only the chunks that weren't written before the restart
+	count := getPriorityShare(metaData, maxInflightChunks)
+	for offset, ok := firstChunkOffset(metaData), true; ok && len(offsets) < count; offset, ok = nextChunkOffset(metaData, offset) {
+		if !isChunkReceived(metaData, offset) {
 			offsets = append(offsets, offset)
-			offset += int64(metaData.ChunkSize)
 		}
 	}
 	return offsets
 }
 
+// reconcileLoggedDataChunks marks the chunks of the object's data that the data write-ahead log records as written
+// before a restart as received, so that they are not requested again.
+// The chunks of data that is appended to a data URI are marked only if they are verified on disk, torn chunks are requested again.
+// The last chunk of the data is never marked, since receiving it completes the object.
+// It returns false if there are no such chunks.
+func reconcileLoggedDataChunks(notification common.Notification, metaData common.MetaData) bool {
+	if metaData.ChunkSize <= 0 {
+		return false
+	}
+	chunks := storage.GetLoggedDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID)
+	if len(chunks) == 0 {
+		return false
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	if metaData.DestinationDataURI != "" {
+		verified := make([]storage.LoggedDataChunk, 0, len(chunks))
+		for _, chunk := range chunks {
+			ok, err := dataURI.VerifyAt(metaData.DestinationDataURI, chunk.Offset, chunk.Length, chunk.Checksum)
+			if err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Failed to verify the data at offset %d of %s:%s:%s. Error: %s\n", chunk.Offset, metaData.DestOrgID,
+					metaData.ObjectType, metaData.ObjectID, err)
+			}
+			if ok {
+				verified = append(verified, chunk)
+			} else if trace.IsLogging(logger.DEBUG) {
+				trace.Debug("The data at offset %d of %s %s is torn, requesting it again\n", chunk.Offset, metaData.ObjectType, metaData.ObjectID)
+			}
+		}
+		chunks = verified
+	}
+
+	id := common.GetNotificationID(notification)
+	notificationLock.Lock()
+	defer notificationLock.Unlock()
+
+	chunksInfo, ok := notificationChunks[id]
+	if !ok {
+		return false
+	}
+	lastOffset := firstChunkOffset(metaData)
+	for offset, ok := nextChunkOffset(metaData, lastOffset); ok; offset, ok = nextChunkOffset(metaData, offset) {
+		lastOffset = offset
+	}
+	// A logged data message may hold several chunks or a part of a chunk, a chunk is marked once all its data was logged
+	loggedSizes := make(map[int64]int64)
+	for _, chunk := range chunks {
+		for _, offset := range chunksInfo.coveredChunks(chunk.Offset, chunk.Length) {
+			start, end := offset, offset+chunksInfo.chunkLength(offset)
+			if chunk.Offset > start {
+				start = chunk.Offset
+			}
+			if chunk.Offset+chunk.Length < end {
+				end = chunk.Offset + chunk.Length
+			}
+			loggedSizes[offset] += end - start
+		}
+	}
+	for offset, size := range loggedSizes {
+		if offset < chunksInfo.baseOffset || offset >= lastOffset || size < chunksInfo.chunkLength(offset) {
+			continue
+		}
+		if !chunksInfo.isChunkInRange(offset) || !chunksInfo.markChunk(offset) {
+			continue
+		}
+		chunksInfo.receivedDataSize += chunksInfo.chunkLength(offset)
+		delete(chunksInfo.chunkResendTimes, offset)
+		delete(chunksInfo.chunkRequestCounts, offset)
+	}
+	notificationChunks[id] = chunksInfo
+	return true
+}
+
 func deleteObjectInfo(orgID string, objectType string, objectID string, destType string, destID string,
 	metaData *common.MetaData, deleteObject bool) {
 	if deleteObject {
@@ -1719,7 +4481,7 @@ func deleteObjectInfo(orgID string, objectType string, objectID string, destType
 			}
 		}
 		if objectToDelete != nil {
-			storage.DeleteStoredObject(Store, *objectToDelete)
+			deleteStoredObjectWithRetry(*objectToDelete)
 		}
 		deleteNotificationChunksInfo(orgID, objectType, objectID, destType, destID)
 	}
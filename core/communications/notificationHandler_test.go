@@ -1,9 +1,24 @@
 package communications
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/storage"
@@ -88,17 +103,6 @@ func TestNotificationHandler(t *testing.T) {
 		0, 0, 0, dataField, 0, 0, 0, 7, ' ', 'w', 'o', 'r', 'l', 'd', '!',
 		0, 0, 0, instanceIDField, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 16,
 	}
-	data4 := []byte{1, 1, 1, 1, // magic
-		0, 0, 0, byte(common.Version.Major),
-		0, 0, 0, byte(common.Version.Minor),
-		0, 0, 0, fieldCount,
-		0, 0, 0, orgIDField, 0, 0, 0, 7, 's', 'o', 'm', 'e', 'o', 'r', 'g',
-		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
-		0, 0, 0, objectIDField, 0, 0, 0, 1, '5',
-		0, 0, 0, offsetField, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, dataField, 0, 0, 0, 0,
-		0, 0, 0, instanceIDField, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 17,
-	}
 
 	tests := []struct {
 		metaData       common.MetaData
@@ -130,7 +134,7 @@ func TestNotificationHandler(t *testing.T) {
 			common.PartiallyReceived, 16, data2, data3, 5, "hello world!"},
 		{common.MetaData{ObjectID: "5", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 17, DataID: 17,
 			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2", ObjectSize: 0, ChunkSize: 4096},
-			common.PartiallyReceived, 17, data4, nil, 0, ""},
+			common.CompletelyReceived, 17, nil, nil, 0, ""},
 	}
 
 	// TODO: add instance ID checks
@@ -415,7 +419,7 @@ func TestNotificationHandler(t *testing.T) {
 			// Get data
 			if row.metaData.DestType != "" {
 				// Can't check handleGetData with destinations list
-				if err := handleGetData(row.metaData, row.metaData.InstanceID); err != nil {
+				if err := handleGetData(row.metaData, row.metaData.InstanceID, 1); err != nil {
 					t.Errorf("handleGetData failed (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 				} else {
 					notification, err := Store.RetrieveNotificationRecord(row.metaData.DestOrgID, row.metaData.ObjectType, row.metaData.ObjectID,
@@ -709,7 +713,7 @@ func testPingAndRegisterNew(storageType string, t *testing.T) {
 		} else if len(storedDests) != 1 {
 			t.Errorf("GetObjectDestinationsList returned %d destinations instead of 1.", len(storedDests))
 		} else {
-			if storedDests[0].Destination != dest {
+			if !reflect.DeepEqual(storedDests[0].Destination, dest) {
 				t.Errorf("GetObjectDestinationsList returned incorrect destination.")
 			}
 			if storedDests[0].Status != common.Delivering {
@@ -775,13 +779,83 @@ func testPingAndRegisterNew(storageType string, t *testing.T) {
 	}
 }
 
-func TestRegisterAsNew(t *testing.T) {
-	testRegisterAsNew(common.Bolt, t)
-	testRegisterAsNew(common.InMemory, t)
+type failingNotificationComm struct {
+	TestComm
+	lock   sync.Mutex
+	sent   map[string]bool
+	failed map[string]bool
 }
 
-func testRegisterAsNew(storageType string, t *testing.T) {
-	common.Configuration.NodeType = common.ESS
+func (communication *failingNotificationComm) SendNotificationMessage(notificationTopic string, destType string,
+	destID string, instanceID int64, dataID int64, metaData *common.MetaData) common.SyncServiceError {
+	communication.lock.Lock()
+	defer communication.lock.Unlock()
+	if communication.failed[metaData.ObjectID] {
+		return &Error{"Failed to send"}
+	}
+	communication.sent[metaData.ObjectID] = true
+	return nil
+}
+
+func TestNotifyNewDestination(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	workers := common.Configuration.RegistrationNotificationWorkers
+	defer func() { common.Configuration.RegistrationNotificationWorkers = workers }()
+	common.Configuration.RegistrationNotificationWorkers = 4
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	comm := &failingNotificationComm{sent: make(map[string]bool), failed: map[string]bool{"3": true, "17": true}}
+	Comm = comm
+
+	dest := common.Destination{DestOrgID: "neworg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	objects := make([]common.MetaData, 0)
+	for i := 0; i < 20; i++ {
+		metaData := common.MetaData{ObjectID: strconv.Itoa(i), ObjectType: "type1", DestOrgID: dest.DestOrgID,
+			DestType: dest.DestType, DestID: dest.DestID}
+		if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+		}
+		objects = append(objects, metaData)
+	}
+
+	err = notifyNewDestination(dest, objects)
+	if err == nil {
+		t.Errorf("notifyNewDestination didn't return the failures to notify")
+	} else if !strings.Contains(err.Error(), "of 2 of 20 objects") || !strings.Contains(err.Error(), "neworg:type1:3") ||
+		!strings.Contains(err.Error(), "neworg:type1:17") {
+		t.Errorf("notifyNewDestination returned a wrong error: %s", err.Error())
+	}
+
+	// The failures didn't stop the notifications of the other objects
+	for _, metaData := range objects {
+		if !comm.failed[metaData.ObjectID] && !comm.sent[metaData.ObjectID] {
+			t.Errorf("The notification of object %s wasn't sent", metaData.ObjectID)
+		}
+		notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			dest.DestType, dest.DestID)
+		if err != nil || notification == nil || notification.Status != common.Update {
+			t.Errorf("No update notification record for object %s", metaData.ObjectID)
+		}
+		Store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	}
+}
+
+func TestHeartbeatAndStaleDestination(t *testing.T) {
+	testHeartbeatAndStaleDestination(common.Bolt, t)
+	testHeartbeatAndStaleDestination(common.Mongo, t)
+}
+
+func testHeartbeatAndStaleDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.DestinationStaleTimeout = 1
+	defer func() { common.Configuration.DestinationStaleTimeout = 0 }()
 
 	var err error
 	Store, err = setUpStorage(storageType)
@@ -796,124 +870,181 @@ func testRegisterAsNew(storageType string, t *testing.T) {
 		t.Errorf("Failed to start communication. Error: %s", err.Error())
 	}
 
-	tests := []struct {
-		metaData           common.MetaData
-		status             string
-		data               []byte
-		notificationStatus string
-	}{
-		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "regorg",
-			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
-			common.CompletelyReceived, []byte("hello"), ""},
-		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "regorg",
-			DestID: "dev1", DestType: "type2", OriginID: "123", OriginType: "type2"},
-			common.PartiallyReceived, []byte("hello"), ""},
-		{common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "regorg",
-			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
-			common.ReadyToSend, nil, common.Update},
-		{common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: "regorg",
-			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
-			common.ReadyToSend, nil, common.Update},
-		{common.MetaData{ObjectID: "5", ObjectType: "type1", DestOrgID: "regorg",
-			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
-			common.NotReadyToSend, nil, ""},
+	dest := common.Destination{DestOrgID: "heartbeatorg", DestType: "device", DestID: "dev1",
+		Communication: common.MQTTProtocol}
+	if err := Store.DeleteDestination(dest.DestOrgID, dest.DestType, dest.DestID); err != nil {
+		t.Errorf("DeleteDestination failed. Error: %s", err.Error())
 	}
 
-	for _, test := range tests {
-		if _, err := Store.StoreObject(test.metaData, test.data, test.status); err != nil {
-			t.Errorf("StoreObject failed. Error: %s", err.Error())
-		}
+	if err := handleHeartbeat(dest); err == nil || !isIgnoredByHandler(err) {
+		t.Errorf("handleHeartbeat for non-existing destination wasn't ignored")
+	}
 
-		if test.notificationStatus != "" {
-			notification := common.Notification{ObjectID: test.metaData.ObjectID, ObjectType: test.metaData.ObjectType,
-				DestOrgID: test.metaData.DestOrgID, DestID: test.metaData.DestID, DestType: test.metaData.DestType,
-				Status: test.notificationStatus, InstanceID: 0}
+	if err := Store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	if isDestinationStale(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Newly registered destination is stale")
+	}
 
-			if err := Store.UpdateNotificationRecord(notification); err != nil {
-				t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
-			}
-		}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: dest.DestOrgID,
+		DestType: dest.DestType, DestID: dest.DestID}
+	if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Errorf("StoreObject failed. Error: %s", err.Error())
 	}
 
-	if err := handleRegisterAsNew(); err != nil {
-		t.Errorf("handleRegisterAsNew failed. Error: %s", err.Error())
-	} else {
-		if !registerAsNew {
-			t.Errorf("registerAsNew is false after handleRegisterAsNew")
-		}
-		if common.Registered {
-			t.Errorf("Registered is true after handleRegisterAsNew")
-		}
-		for _, test := range tests {
-			object, err := Store.RetrieveObject(test.metaData.DestOrgID, test.metaData.ObjectType,
-				test.metaData.ObjectID)
-			if err != nil && !common.IsNotFound(err) {
-				t.Errorf("RetrieveObject failed (objectID = %s). Error: %s", test.metaData.ObjectID, err.Error())
-			} else {
-				switch test.status {
-				case common.PartiallyReceived:
-					if object != nil {
-						t.Errorf("Object (objectID = %s) was not deleted", test.metaData.ObjectID)
-					}
+	time.Sleep(1500 * time.Millisecond)
+	if !isDestinationStale(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Destination that wasn't seen is not stale")
+	}
 
-				case common.CompletelyReceived:
-					if Store.IsPersistent() && object == nil {
-						t.Errorf("Object (objectID = %s) was deleted", test.metaData.ObjectID)
-					}
-					if !Store.IsPersistent() && object != nil {
-						t.Errorf("Object (objectID = %s) was not deleted", test.metaData.ObjectID)
-					}
+	// The notification to the stale destination is deferred, the record remains pending
+	notifications, err := PrepareObjectNotifications(metaData)
+	if err != nil {
+		t.Errorf("PrepareObjectNotifications failed. Error: %s", err.Error())
+	} else if err := SendNotifications(notifications); err != nil {
+		t.Errorf("SendNotifications failed. Error: %s", err.Error())
+	}
+	if notification, err := Store.RetrieveNotificationRecord(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		dest.DestType, dest.DestID); err != nil || notification == nil {
+		t.Errorf("No notification record for the stale destination")
+	} else if notification.Status != common.Update {
+		t.Errorf("Wrong notification status: %s instead of update", notification.Status)
+	}
 
-				case common.ReadyToSend:
-					if object == nil {
-						t.Errorf("Object (objectID = %s) was deleted", test.metaData.ObjectID)
-					}
+	if err := handleHeartbeat(dest); err != nil {
+		t.Errorf("handleHeartbeat failed. Error: %s", err.Error())
+	}
+	if isDestinationStale(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Destination is stale after a heartbeat")
+	}
 
-				case common.NotReadyToSend:
-					if object == nil {
-						t.Errorf("Object (objectID = %s) was deleted", test.metaData.ObjectID)
-					}
-				}
+	if dests, err := Store.RetrieveDestinationsInfo(dest.DestOrgID, ""); err != nil {
+		t.Errorf("RetrieveDestinationsInfo failed. Error: %s", err.Error())
+	} else if len(dests) != 1 {
+		t.Errorf("RetrieveDestinationsInfo returned %d destinations instead of 1", len(dests))
+	} else if time.Since(dests[0].LastSeen) > time.Second {
+		t.Errorf("RetrieveDestinationsInfo returned an old last seen time: %s", dests[0].LastSeen)
+	}
 
-				notification, err := Store.RetrieveNotificationRecord(test.metaData.DestOrgID, test.metaData.ObjectType,
-					test.metaData.ObjectID, test.metaData.DestType, test.metaData.DestID)
-				if err == nil && notification != nil {
-					t.Errorf("Notification exists (objectID = %s)", test.metaData.ObjectID)
-				}
-			}
-		}
+	if err := Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "", ""); err != nil {
+		t.Errorf("DeleteNotificationRecords failed. Error: %s", err.Error())
+	}
+	if err := Store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		t.Errorf("DeleteStoredObject failed. Error: %s", err.Error())
+	}
+	if err := Store.DeleteDestination(dest.DestOrgID, dest.DestType, dest.DestID); err != nil {
+		t.Errorf("DeleteDestination failed. Error: %s", err.Error())
 	}
+}
 
-	handleRegAck()
-	if registerAsNew {
-		t.Errorf("registerAsNew is true after handleRegAck")
+func TestPausedDestination(t *testing.T) {
+	testPausedDestination(common.Bolt, t)
+	testPausedDestination(common.Mongo, t)
+}
+
+func testPausedDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+
+	var err error
+	Store, err = setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
 	}
-	if !common.Registered {
-		t.Errorf("Registered is false after handleRegAck")
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
 	}
-	for _, test := range tests {
-		if test.status == common.ReadyToSend {
-			notification, err := Store.RetrieveNotificationRecord(test.metaData.DestOrgID, test.metaData.ObjectType,
-				test.metaData.ObjectID, test.metaData.DestType, test.metaData.DestID)
-			if err != nil && !storage.IsNotFound(err) {
-				t.Errorf("An error occurred in notification fetch (objectID = %s). Error: %s", test.metaData.ObjectID, err.Error())
-			} else {
-				if notification == nil {
-					t.Errorf("No notification record (objectID = %s)", test.metaData.ObjectID)
-				} else if notification.Status != common.Update {
-					t.Errorf("Wrong notification status: %s instead of update (objectID = %s)", notification.Status,
-						test.metaData.ObjectID)
-				}
-			}
-		}
+
+	dest := common.Destination{DestOrgID: "pauseorg", DestType: "device", DestID: "dev1",
+		Communication: common.MQTTProtocol}
+	if err := Store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	defer Store.DeleteDestination(dest.DestOrgID, dest.DestType, dest.DestID)
+
+	// A chunk that was requested from the destination, and whose resend time hasn't expired yet
+	notification := common.Notification{ObjectID: "1", ObjectType: "type1", DestOrgID: dest.DestOrgID,
+		DestType: dest.DestType, DestID: dest.DestID, Status: common.Getdata}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: dest.DestOrgID, DestType: dest.DestType,
+		DestID: dest.DestID, ObjectSize: 100}
+	id := common.GetNotificationID(notification)
+	notificationLock.Lock()
+	notificationChunks[id] = notificationChunksInfo{chunkSize: 10, maxRequestedOffset: 10,
+		chunkResendTimes: map[int64]int64{0: 0}, resendTime: time.Now().Unix() + 100}
+	notificationLock.Unlock()
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 0 {
+		t.Errorf("getOffsetsToResend returned %d offsets before the resend time", len(offsets))
+	}
+
+	if err := Store.UpdateDestinationPaused(dest.DestOrgID, dest.DestType, dest.DestID, true); err != nil {
+		t.Errorf("UpdateDestinationPaused failed. Error: %s", err.Error())
+	}
+	if !isDestinationPaused(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Paused destination is not paused")
+	}
+	if err := handleGetData(metaData, 0, 1); err != nil {
+		t.Errorf("handleGetData of paused destination failed. Error: %s", err.Error())
+	}
+
+	// The destination stays paused when it registers again
+	if err := Store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	if infos, err := Store.RetrieveDestinationsInfo(dest.DestOrgID, dest.DestType); err != nil {
+		t.Errorf("RetrieveDestinationsInfo failed. Error: %s", err.Error())
+	} else if len(infos) != 1 || !infos[0].Paused {
+		t.Errorf("RetrieveDestinationsInfo didn't return the paused destination")
+	}
+
+	notificationLock.Lock()
+	chunksInfo := notificationChunks[id]
+	chunksInfo.resendTime = 0
+	notificationChunks[id] = chunksInfo
+	notificationLock.Unlock()
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 0 {
+		t.Errorf("getOffsetsToResend returned %d offsets for a paused destination", len(offsets))
+	}
+
+	// Resuming the destination re-arms the resend time
+	notificationLock.Lock()
+	chunksInfo = notificationChunks[id]
+	chunksInfo.resendTime = time.Now().Unix() + 100
+	notificationChunks[id] = chunksInfo
+	notificationLock.Unlock()
+	if err := Store.UpdateDestinationPaused(dest.DestOrgID, dest.DestType, dest.DestID, false); err != nil {
+		t.Errorf("UpdateDestinationPaused failed. Error: %s", err.Error())
+	}
+	ResumeDestinationTransfers(dest.DestOrgID, dest.DestType, dest.DestID)
+	if isDestinationPaused(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Resumed destination is paused")
+	}
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 1 || offsets[0] != 0 {
+		t.Errorf("getOffsetsToResend returned %v instead of the offset of the requested chunk", offsets)
 	}
 }
 
-func TestRegisterDestinationValidity(t *testing.T) {
-	common.Configuration.NodeType = common.ESS
+func TestOfflineDestination(t *testing.T) {
+	testOfflineDestination(common.Bolt, t)
+	testOfflineDestination(common.Mongo, t)
+}
+
+func testOfflineDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.DestinationOfflineTimeout = 1
+	defer func() { common.Configuration.DestinationOfflineTimeout = 0 }()
 
 	var err error
-	Store, err = setUpStorage(common.Mongo)
+	Store, err = setUpStorage(storageType)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -925,43 +1056,2992 @@ func TestRegisterDestinationValidity(t *testing.T) {
 		t.Errorf("Failed to start communication. Error: %s", err.Error())
 	}
 
-	tests := []struct {
-		dest common.Destination
-	}{
-		{common.Destination{DestOrgID: "testorg", DestType: "device%", DestID: "dev1", Communication: common.MQTTProtocol}},
-		{common.Destination{DestOrgID: "testorg", DestType: "device", DestID: "dev1//", Communication: common.MQTTProtocol}},
-		{common.Destination{DestOrgID: "testorg", DestType: "device[", DestID: "dev1}", Communication: common.MQTTProtocol}},
+	dest := common.Destination{DestOrgID: "offlineorg", DestType: "device", DestID: "dev1",
+		Communication: common.MQTTProtocol}
+	if err := Store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
 	}
+	defer Store.DeleteDestination(dest.DestOrgID, dest.DestType, dest.DestID)
 
-	for _, test := range tests {
-		if err := handleRegisterNew(test.dest, false); err == nil {
-			t.Errorf("handleRegisterNew registered destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
-		}
-		if err := handleRegistration(test.dest, false); err == nil {
-			t.Errorf("handleRegistration handled destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
-		}
-		if err := handlePing(test.dest); err == nil {
-			t.Errorf("handlePing handled destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
-		}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: dest.DestOrgID,
+		DestType: dest.DestType, DestID: dest.DestID}
+	if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Errorf("StoreObject failed. Error: %s", err.Error())
+	}
+	defer func() {
+		Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "", "")
+		Store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	}()
+
+	if err := ReapOfflineDestinations(); err != nil {
+		t.Errorf("ReapOfflineDestinations failed. Error: %s", err.Error())
+	}
+	if isDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Newly registered destination is offline")
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if err := ReapOfflineDestinations(); err != nil {
+		t.Errorf("ReapOfflineDestinations failed. Error: %s", err.Error())
+	}
+	if !isDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Destination that wasn't seen is not offline")
+	}
+	if infos, err := Store.RetrieveDestinationsInfo(dest.DestOrgID, dest.DestType); err != nil {
+		t.Errorf("RetrieveDestinationsInfo failed. Error: %s", err.Error())
+	} else if len(infos) != 1 || !infos[0].Offline {
+		t.Errorf("RetrieveDestinationsInfo didn't return the offline destination")
+	}
+
+	// The notification to the offline destination is suspended, the record remains pending
+	notifications, err := PrepareObjectNotifications(metaData)
+	if err != nil {
+		t.Errorf("PrepareObjectNotifications failed. Error: %s", err.Error())
+	} else if err := SendNotifications(notifications); err != nil {
+		t.Errorf("SendNotifications failed. Error: %s", err.Error())
+	}
+	if notification, err := Store.RetrieveNotificationRecord(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		dest.DestType, dest.DestID); err != nil || notification == nil {
+		t.Errorf("No notification record for the offline destination")
+	} else if notification.Status != common.Update {
+		t.Errorf("Wrong notification status: %s instead of update", notification.Status)
+	}
+
+	// A heartbeat doesn't bring the destination back online, only a registration does
+	if err := handleHeartbeat(dest); err != nil {
+		t.Errorf("handleHeartbeat failed. Error: %s", err.Error())
+	}
+	if !isDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Destination is online after a heartbeat")
+	}
+
+	if err := handleRegistration(dest, true); err != nil {
+		t.Errorf("handleRegistration failed. Error: %s", err.Error())
+	}
+	if isDestinationOffline(dest.DestOrgID, dest.DestType, dest.DestID) {
+		t.Errorf("Destination is offline after it registered again")
 	}
 }
 
-func setUpStorage(storageType string) (storage.Storage, error) {
-	var store storage.Storage
-	if storageType == common.InMemory {
-		store = &storage.Cache{Store: &storage.InMemoryStorage{}}
-	} else if storageType == common.Bolt {
-		dir, _ := os.Getwd()
-		common.Configuration.PersistenceRootPath = dir + "/persist"
-		boltStore := &storage.BoltStorage{}
-		boltStore.Cleanup(true)
-		store = &storage.Cache{Store: boltStore}
-	} else {
-		common.Configuration.MongoDbName = "d_test_db"
-		store = &storage.Cache{Store: &storage.MongoStorage{}}
+func TestHandleVerifyRequest(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.InitObjectLocks()
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
 	}
-	if err := store.Init(); err != nil {
-		return nil, &Error{fmt.Sprintf("Failed to initialize storage driver. Error: %s\n", err.Error())}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	dest := common.Destination{DestOrgID: "verifyorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+
+	manifest := make([]common.ManifestEntry, 0)
+	for _, objectID := range []string{"1", "2", "3", "4"} {
+		metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: dest.DestOrgID, DestType: dest.DestType,
+			DestID: dest.DestID, ObjectSize: 5}
+		if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s", objectID, err.Error())
+		}
+		stored, err := Store.RetrieveObject(dest.DestOrgID, "type1", objectID)
+		if err != nil || stored == nil {
+			t.Errorf("Failed to retrieve object %s", objectID)
+			continue
+		}
+		hash, _, err := hashObjectData(*stored, "", common.SHA256)
+		if err != nil {
+			t.Errorf("hashObjectData failed. Error: %s", err.Error())
+		}
+		entry := common.ManifestEntry{ObjectType: "type1", ObjectID: objectID, InstanceID: stored.InstanceID, ObjectSize: 5,
+			HashAlgorithm: common.SHA256, Hash: hash}
+		switch objectID {
+		case "2":
+			entry.InstanceID++
+		case "3":
+			entry.Hash = "0123"
+		case "4":
+			// Delivered to the destination, but missing from its manifest
+			if err := Store.UpdateNotificationRecord(common.Notification{ObjectID: objectID, ObjectType: "type1",
+				DestOrgID: dest.DestOrgID, DestType: dest.DestType, DestID: dest.DestID, Status: common.ReceivedByDestination,
+				InstanceID: stored.InstanceID}); err != nil {
+				t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+			}
+			continue
+		}
+		manifest = append(manifest, entry)
+	}
+	manifest = append(manifest, common.ManifestEntry{ObjectType: "type1", ObjectID: "5", InstanceID: 1})
+
+	if _, ok := GetVerifyReport(dest.DestOrgID, dest.DestType, dest.DestID); ok {
+		t.Errorf("GetVerifyReport returned a report before the verification")
+	}
+	if err := handleVerifyRequest(dest, manifest, true); err != nil {
+		t.Errorf("handleVerifyRequest failed. Error: %s", err.Error())
+	}
+
+	report, ok := GetVerifyReport(dest.DestOrgID, dest.DestType, dest.DestID)
+	if !ok {
+		t.Errorf("GetVerifyReport didn't return the report")
+		return
+	}
+	if report.VerifiedObjects != 4 {
+		t.Errorf("The report has %d verified objects instead of 4", report.VerifiedObjects)
+	}
+	expected := map[string]common.ObjectDiscrepancy{
+		"2": {ObjectType: "type1", ObjectID: "2", Reason: common.DiscrepancyInstance, Resent: true},
+		"3": {ObjectType: "type1", ObjectID: "3", Reason: common.DiscrepancyData, Resent: true},
+		"4": {ObjectType: "type1", ObjectID: "4", Reason: common.DiscrepancyMissing, Resent: true},
+		"5": {ObjectType: "type1", ObjectID: "5", Reason: common.DiscrepancyUnknown, Resent: false},
+	}
+	if len(report.Discrepancies) != len(expected) {
+		t.Errorf("The report has %d discrepancies instead of %d: %v", len(report.Discrepancies), len(expected), report.Discrepancies)
+	}
+	for _, discrepancy := range report.Discrepancies {
+		if discrepancy != expected[discrepancy.ObjectID] {
+			t.Errorf("Wrong discrepancy: %+v instead of %+v", discrepancy, expected[discrepancy.ObjectID])
+		}
+	}
+
+	// Only the objects that don't match are sent again
+	for _, objectID := range []string{"2", "3", "4"} {
+		notification, err := Store.RetrieveNotificationRecord(dest.DestOrgID, "type1", objectID, dest.DestType, dest.DestID)
+		if err != nil || notification == nil || notification.Status != common.Update {
+			t.Errorf("Object %s wasn't sent again", objectID)
+		}
+	}
+	if notification, _ := Store.RetrieveNotificationRecord(dest.DestOrgID, "type1", "1", dest.DestType, dest.DestID); notification != nil {
+		t.Errorf("Object 1 was sent again")
+	}
+}
+
+func TestResendObjectToDestination(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.InitObjectLocks()
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	dest := common.Destination{DestOrgID: "resendorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: dest.DestOrgID, DestType: dest.DestType,
+		DestID: dest.DestID, ObjectSize: 5}
+	if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	stored, err := Store.RetrieveObject(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || stored == nil {
+		t.Errorf("Failed to retrieve object")
+		return
+	}
+
+	// The object was consumed by the destination, and is sent to it again
+	if err := Store.UpdateNotificationRecord(common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
+		DestOrgID: dest.DestOrgID, DestType: dest.DestType, DestID: dest.DestID, Status: common.AckConsumed,
+		InstanceID: stored.InstanceID}); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+	}
+	if err := ResendObjectToDestination(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID, dest.DestType, dest.DestID); err != nil {
+		t.Errorf("ResendObjectToDestination failed. Error: %s", err.Error())
+	}
+	notification, err := Store.RetrieveNotificationRecord(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID, dest.DestType, dest.DestID)
+	if err != nil || notification == nil || notification.Status != common.Update || notification.InstanceID != stored.InstanceID {
+		t.Errorf("The object wasn't sent to the destination again: %+v", notification)
+	}
+
+	// Nothing is sent for an object or a destination that doesn't exist, or to a destination the object isn't sent to
+	tests := []struct {
+		objectID string
+		destID   string
+	}{
+		{"2", dest.DestID},
+		{metaData.ObjectID, "dev2"},
+	}
+	for _, test := range tests {
+		if err := ResendObjectToDestination(dest.DestOrgID, metaData.ObjectType, test.objectID, dest.DestType, test.destID); err != nil {
+			t.Errorf("ResendObjectToDestination(%s, %s) failed. Error: %s", test.objectID, test.destID, err.Error())
+		}
+		if notification, _ := Store.RetrieveNotificationRecord(dest.DestOrgID, metaData.ObjectType, test.objectID, dest.DestType,
+			test.destID); notification != nil {
+			t.Errorf("ResendObjectToDestination(%s, %s) sent a notification", test.objectID, test.destID)
+		}
+	}
+	dev3 := common.Destination{DestOrgID: dest.DestOrgID, DestType: dest.DestType, DestID: "dev3", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dev3, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	if err := ResendObjectToDestination(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID, dev3.DestType, dev3.DestID); err != nil {
+		t.Errorf("ResendObjectToDestination failed. Error: %s", err.Error())
+	}
+	if notification, _ := Store.RetrieveNotificationRecord(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID, dev3.DestType,
+		dev3.DestID); notification != nil {
+		t.Errorf("ResendObjectToDestination sent a notification to a destination the object isn't sent to")
+	}
+}
+
+func TestRegisterNewWithPreStagedObjects(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.InitObjectLocks()
+	defer func() { common.Configuration.PreStageObjects = false }()
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	dev1 := common.Destination{DestOrgID: "prestageorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dev1, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+
+	// dev9 isn't registered, the object can be pre-staged for it only if PreStageObjects is set
+	preStaged := common.MetaData{ObjectID: "prestaged", ObjectType: "type1", DestOrgID: dev1.DestOrgID, NoData: true,
+		DestinationsList: []string{"device:dev1", "device:dev9"}}
+	common.Configuration.PreStageObjects = false
+	if _, err := Store.StoreObject(preStaged, nil, common.ReadyToSend); err == nil {
+		t.Errorf("An object was stored with a destination that isn't registered")
+	}
+	common.Configuration.PreStageObjects = true
+	if _, err := Store.StoreObject(preStaged, nil, common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	other := common.MetaData{ObjectID: "other", ObjectType: "type1", DestOrgID: dev1.DestOrgID, NoData: true,
+		DestinationsList: []string{"device:dev1"}}
+	if _, err := Store.StoreObject(other, nil, common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if dests, err := Store.GetObjectDestinationsList(dev1.DestOrgID, preStaged.ObjectType, preStaged.ObjectID); err != nil ||
+		len(dests) != 1 {
+		t.Errorf("The pre-staged object has %d destinations instead of 1", len(dests))
+	}
+
+	// The first registration of dev9 delivers only the objects pre-staged for it
+	dev9 := common.Destination{DestOrgID: dev1.DestOrgID, DestType: "device", DestID: "dev9", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dev9, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	notification, err := Store.RetrieveNotificationRecord(dev9.DestOrgID, preStaged.ObjectType, preStaged.ObjectID, dev9.DestType,
+		dev9.DestID)
+	if err != nil || notification == nil || notification.Status != common.Update {
+		t.Errorf("The pre-staged object wasn't sent to the new destination: %+v", notification)
+	}
+	if notification, _ := Store.RetrieveNotificationRecord(dev9.DestOrgID, other.ObjectType, other.ObjectID, dev9.DestType,
+		dev9.DestID); notification != nil {
+		t.Errorf("An object that wasn't pre-staged for the new destination was sent to it")
+	}
+	if dests, err := Store.GetObjectDestinationsList(dev1.DestOrgID, preStaged.ObjectType, preStaged.ObjectID); err != nil ||
+		len(dests) != 2 {
+		t.Errorf("The pre-staged object has %d destinations instead of 2", len(dests))
+	}
+}
+
+func TestRegistrationWithDestinationAttributes(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.InitObjectLocks()
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	dev1 := common.Destination{DestOrgID: "attributesorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol,
+		Attributes: map[string]string{"region": "eu", "firmware": "2.1"}}
+	if err := handleRegisterNew(dev1, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+
+	euObject := common.MetaData{ObjectID: "eu", ObjectType: "type1", DestOrgID: dev1.DestOrgID, DestType: "device", NoData: true,
+		DestinationAttributes: map[string]string{"region": "eu"}}
+	usObject := common.MetaData{ObjectID: "us", ObjectType: "type1", DestOrgID: dev1.DestOrgID, DestType: "device", NoData: true,
+		DestinationAttributes: map[string]string{"region": "us", "firmware": "2.1"}}
+	for _, metaData := range []common.MetaData{euObject, usObject} {
+		if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+			t.Errorf("Failed to store object. Error: %s", err.Error())
+		}
+	}
+	if dests, err := Store.GetObjectDestinationsList(dev1.DestOrgID, euObject.ObjectType, euObject.ObjectID); err != nil ||
+		len(dests) != 1 {
+		t.Errorf("The object that matches the destination's attributes has %d destinations instead of 1", len(dests))
+	}
+	if dests, err := Store.GetObjectDestinationsList(dev1.DestOrgID, usObject.ObjectType, usObject.ObjectID); err != nil ||
+		len(dests) != 0 {
+		t.Errorf("The object that doesn't match the destination's attributes has %d destinations instead of 0", len(dests))
+	}
+
+	// The destination registers again in another region, and gets the objects of that region
+	dev1.Attributes = map[string]string{"region": "us", "firmware": "2.1"}
+	if err := handleRegistration(dev1, true); err != nil {
+		t.Errorf("handleRegistration failed. Error: %s", err.Error())
+	}
+	if dest, err := Store.RetrieveDestination(dev1.DestOrgID, dev1.DestType, dev1.DestID); err != nil || dest == nil ||
+		dest.Attributes["region"] != "us" {
+		t.Errorf("The destination's attributes weren't updated: %+v", dest)
+	}
+	notification, err := Store.RetrieveNotificationRecord(dev1.DestOrgID, usObject.ObjectType, usObject.ObjectID, dev1.DestType,
+		dev1.DestID)
+	if err != nil || notification == nil || notification.Status != common.Update {
+		t.Errorf("The object that matches the destination's new attributes wasn't sent to it: %+v", notification)
+	}
+	if dests, err := Store.GetObjectDestinationsList(dev1.DestOrgID, usObject.ObjectType, usObject.ObjectID); err != nil ||
+		len(dests) != 1 {
+		t.Errorf("The object that matches the destination's new attributes has %d destinations instead of 1", len(dests))
+	}
+}
+
+type testDestinationAuthorizer struct{}
+
+func (authorizer testDestinationAuthorizer) AuthorizeRegistration(dest common.Destination) error {
+	if dest.DestID == "intruder" {
+		return &Error{"Unknown node"}
+	}
+	return nil
+}
+
+func (authorizer testDestinationAuthorizer) AuthorizeObject(dest common.Destination, metaData common.MetaData) error {
+	if metaData.ObjectID == "secret" && dest.DestID != "dev1" {
+		return &Error{"Not cleared for secrets"}
+	}
+	return nil
+}
+
+func TestDestinationAuthorizer(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.InitObjectLocks()
+	RegisterDestinationAuthorizer(testDestinationAuthorizer{})
+	defer RegisterDestinationAuthorizer(nil)
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	// The registration of an unknown node is denied before it is stored
+	intruder := common.Destination{DestOrgID: "authorizerorg", DestType: "device", DestID: "intruder", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(intruder, false); err == nil || !IsUnauthorized(err) {
+		t.Errorf("handleRegisterNew didn't deny the registration of an unauthorized destination")
+	}
+	if err := handleRegistration(intruder, false); err == nil || !IsUnauthorized(err) {
+		t.Errorf("handleRegistration didn't deny the registration of an unauthorized destination")
+	}
+	if exists, err := Store.DestinationExists(intruder.DestOrgID, intruder.DestType, intruder.DestID); err != nil || exists {
+		t.Errorf("The unauthorized destination was stored")
+	}
+
+	dev1 := common.Destination{DestOrgID: intruder.DestOrgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dev1, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	for _, objectID := range []string{"secret", "public"} {
+		metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: dev1.DestOrgID, DestType: "device", NoData: true}
+		if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+			t.Errorf("Failed to store object. Error: %s", err.Error())
+		}
+	}
+
+	// A destination receives only the objects that it is authorized to receive
+	dev2 := common.Destination{DestOrgID: dev1.DestOrgID, DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dev2, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	expected := map[string]string{"secret": common.Rejected, "public": common.Update}
+	for objectID, status := range expected {
+		notification, err := Store.RetrieveNotificationRecord(dev2.DestOrgID, "type1", objectID, dev2.DestType, dev2.DestID)
+		if err != nil || notification == nil || notification.Status != status {
+			t.Errorf("The notification of %s has status %+v instead of %s", objectID, notification, status)
+		}
+	}
+}
+
+func TestRegisterAsNew(t *testing.T) {
+	testRegisterAsNew(common.Bolt, t)
+	testRegisterAsNew(common.InMemory, t)
+}
+
+func testRegisterAsNew(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+
+	var err error
+	Store, err = setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		metaData           common.MetaData
+		status             string
+		data               []byte
+		notificationStatus string
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "regorg",
+			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
+			common.CompletelyReceived, []byte("hello"), ""},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "regorg",
+			DestID: "dev1", DestType: "type2", OriginID: "123", OriginType: "type2"},
+			common.PartiallyReceived, []byte("hello"), ""},
+		{common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "regorg",
+			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
+			common.ReadyToSend, nil, common.Update},
+		{common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: "regorg",
+			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
+			common.ReadyToSend, nil, common.Update},
+		{common.MetaData{ObjectID: "5", ObjectType: "type1", DestOrgID: "regorg",
+			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2"},
+			common.NotReadyToSend, nil, ""},
+	}
+
+	for _, test := range tests {
+		if _, err := Store.StoreObject(test.metaData, test.data, test.status); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+		}
+
+		if test.notificationStatus != "" {
+			notification := common.Notification{ObjectID: test.metaData.ObjectID, ObjectType: test.metaData.ObjectType,
+				DestOrgID: test.metaData.DestOrgID, DestID: test.metaData.DestID, DestType: test.metaData.DestType,
+				Status: test.notificationStatus, InstanceID: 0}
+
+			if err := Store.UpdateNotificationRecord(notification); err != nil {
+				t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+			}
+		}
+	}
+
+	if err := handleRegisterAsNew(); err != nil {
+		t.Errorf("handleRegisterAsNew failed. Error: %s", err.Error())
+	} else {
+		if !registerAsNew {
+			t.Errorf("registerAsNew is false after handleRegisterAsNew")
+		}
+		if common.Registered {
+			t.Errorf("Registered is true after handleRegisterAsNew")
+		}
+		for _, test := range tests {
+			object, err := Store.RetrieveObject(test.metaData.DestOrgID, test.metaData.ObjectType,
+				test.metaData.ObjectID)
+			if err != nil && !common.IsNotFound(err) {
+				t.Errorf("RetrieveObject failed (objectID = %s). Error: %s", test.metaData.ObjectID, err.Error())
+			} else {
+				switch test.status {
+				case common.PartiallyReceived:
+					if object != nil {
+						t.Errorf("Object (objectID = %s) was not deleted", test.metaData.ObjectID)
+					}
+
+				case common.CompletelyReceived:
+					if Store.IsPersistent() && object == nil {
+						t.Errorf("Object (objectID = %s) was deleted", test.metaData.ObjectID)
+					}
+					if !Store.IsPersistent() && object != nil {
+						t.Errorf("Object (objectID = %s) was not deleted", test.metaData.ObjectID)
+					}
+
+				case common.ReadyToSend:
+					if object == nil {
+						t.Errorf("Object (objectID = %s) was deleted", test.metaData.ObjectID)
+					}
+
+				case common.NotReadyToSend:
+					if object == nil {
+						t.Errorf("Object (objectID = %s) was deleted", test.metaData.ObjectID)
+					}
+				}
+
+				notification, err := Store.RetrieveNotificationRecord(test.metaData.DestOrgID, test.metaData.ObjectType,
+					test.metaData.ObjectID, test.metaData.DestType, test.metaData.DestID)
+				if err == nil && notification != nil {
+					t.Errorf("Notification exists (objectID = %s)", test.metaData.ObjectID)
+				}
+			}
+		}
+	}
+
+	handleRegAck()
+	if registerAsNew {
+		t.Errorf("registerAsNew is true after handleRegAck")
+	}
+	if !common.Registered {
+		t.Errorf("Registered is false after handleRegAck")
+	}
+	for _, test := range tests {
+		if test.status == common.ReadyToSend {
+			notification, err := Store.RetrieveNotificationRecord(test.metaData.DestOrgID, test.metaData.ObjectType,
+				test.metaData.ObjectID, test.metaData.DestType, test.metaData.DestID)
+			if err != nil && !storage.IsNotFound(err) {
+				t.Errorf("An error occurred in notification fetch (objectID = %s). Error: %s", test.metaData.ObjectID, err.Error())
+			} else {
+				if notification == nil {
+					t.Errorf("No notification record (objectID = %s)", test.metaData.ObjectID)
+				} else if notification.Status != common.Update {
+					t.Errorf("Wrong notification status: %s instead of update (objectID = %s)", notification.Status,
+						test.metaData.ObjectID)
+				}
+			}
+		}
+	}
+}
+
+func TestRegisterDestinationValidity(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+
+	var err error
+	Store, err = setUpStorage(common.Mongo)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		dest common.Destination
+	}{
+		{common.Destination{DestOrgID: "testorg", DestType: "device%", DestID: "dev1", Communication: common.MQTTProtocol}},
+		{common.Destination{DestOrgID: "testorg", DestType: "device", DestID: "dev1//", Communication: common.MQTTProtocol}},
+		{common.Destination{DestOrgID: "testorg", DestType: "device[", DestID: "dev1}", Communication: common.MQTTProtocol}},
+	}
+
+	for _, test := range tests {
+		if err := handleRegisterNew(test.dest, false); err == nil {
+			t.Errorf("handleRegisterNew registered destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
+		}
+		if err := handleRegistration(test.dest, false); err == nil {
+			t.Errorf("handleRegistration handled destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
+		}
+		if err := handlePing(test.dest); err == nil {
+			t.Errorf("handlePing handled destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
+		}
+		if err := handleHeartbeat(test.dest); err == nil {
+			t.Errorf("handleHeartbeat handled destination with invalid type (%s) or id (%s)", test.dest.DestType, test.dest.DestID)
+		}
+	}
+}
+
+func TestHandleDataInvalidOffsets(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "offsets", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 12, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	for _, offset := range []int64{0, 5, 10} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+
+	tests := []struct {
+		name   string
+		offset int64
+		data   string
+	}{
+		{"negative", -5, "hello"},
+		{"misaligned", 3, "hello"},
+		{"beyond EOF", 10, "hello"},
+		{"starting beyond EOF", 15, "he"},
+	}
+
+	for _, row := range tests {
+		message, err := buildDataMessage(metaData, []byte(row.data), len(row.data), row.offset)
+		if err != nil {
+			t.Errorf("Failed to build data message (%s offset). Error: %s", row.name, err.Error())
+			continue
+		}
+		if _, err := handleData(message); err == nil {
+			t.Errorf("handleData accepted %s offset %d", row.name, row.offset)
+		} else if !IsInvalidData(err) {
+			t.Errorf("handleData of %s offset %d didn't return an invalid data error. Error: %s", row.name, row.offset, err.Error())
+		}
+
+		chunksInfo, ok := notificationChunks[id]
+		if !ok {
+			t.Errorf("No chunks info after %s offset", row.name)
+			continue
+		}
+		if chunksInfo.receivedDataSize != 0 {
+			t.Errorf("Received data size changed after %s offset: %d instead of 0", row.name, chunksInfo.receivedDataSize)
+		}
+		if len(chunksInfo.chunkResendTimes) != 3 {
+			t.Errorf("Inflight chunks changed after %s offset: %d instead of 3", row.name, len(chunksInfo.chunkResendTimes))
+		}
+		for _, b := range chunksInfo.chunksReceived {
+			if b != 0 {
+				t.Errorf("Chunk marked as received after %s offset", row.name)
+			}
+		}
+	}
+
+	// The final chunk is shorter than the chunk size
+	message, err := buildDataMessage(metaData, []byte("d!"), 2, 10)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed for a valid final chunk. Error: %s", err.Error())
+	} else if chunksInfo := notificationChunks[id]; chunksInfo.receivedDataSize != 2 {
+		t.Errorf("Wrong received data size: %d instead of 2", chunksInfo.receivedDataSize)
+	}
+}
+
+// flakyStore fails to append data with the given errors, before appending it
+type flakyStore struct {
+	storage.Storage
+	errors   []error
+	attempts int
+	data     []byte
+}
+
+func (store *flakyStore) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
+	offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	store.attempts++
+	if len(store.errors) > 0 {
+		err := store.errors[0]
+		store.errors = store.errors[1:]
+		return err
+	}
+	store.data, _ = ioutil.ReadAll(dataReader)
+	return nil
+}
+
+func TestAppendObjectDataRetry(t *testing.T) {
+	maxAttempts := common.Configuration.StorageMaxAttempts
+	retryInterval := common.Configuration.StorageRetryInterval
+	savedStore := Store
+	defer func() {
+		common.Configuration.StorageMaxAttempts = maxAttempts
+		common.Configuration.StorageRetryInterval = retryInterval
+		Store = savedStore
+	}()
+	common.Configuration.StorageMaxAttempts = 3
+	common.Configuration.StorageRetryInterval = 1
+
+	transient := &storage.NotConnected{}
+	permanent := &storage.Error{}
+	tests := []struct {
+		name     string
+		errors   []error
+		attempts int
+		fail     bool
+	}{
+		{"no errors", nil, 1, false},
+		{"transient errors", []error{transient, transient}, 3, false},
+		{"too many transient errors", []error{transient, transient, transient}, 3, true},
+		{"permanent error", []error{permanent, transient}, 1, true},
+	}
+	for _, test := range tests {
+		store := &flakyStore{errors: test.errors}
+		Store = store
+		err := appendObjectData("someorg", "type1", "retry", nil, bytes.NewReader([]byte("hello")), 5, 0, 5, true, true)
+		if test.fail != (err != nil) {
+			t.Errorf("appendObjectData with %s returned %v", test.name, err)
+		}
+		if store.attempts != test.attempts {
+			t.Errorf("appendObjectData with %s appended the data %d times instead of %d", test.name, store.attempts, test.attempts)
+		}
+		if !test.fail && string(store.data) != "hello" {
+			t.Errorf("appendObjectData with %s appended %s", test.name, string(store.data))
+		}
+	}
+}
+
+func TestReceivedDataCodec(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	codec, err := storage.NewAESCTRCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewAESCTRCodec failed. Error: %s", err.Error())
+	}
+	storage.RegisterDataCodec(codec)
+	defer storage.RegisterDataCodec(nil)
+
+	plain := bytes.Repeat([]byte("0123456789"), 20)
+	metaData := common.MetaData{ObjectID: "codec", ObjectType: "type1", DestOrgID: "someorg", OriginType: "cloud", OriginID: "cloud",
+		ObjectSize: int64(len(plain))}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Fatalf("Failed to store object. Error: %s", err.Error())
+	}
+
+	// The second chunk is encoded with the codec of the first chunk, which is looked up in the store
+	for _, offset := range []int64{0, 100} {
+		dataCodec, err := getReceivedDataCodec(metaData, offset == 0)
+		if err != nil || dataCodec == nil {
+			t.Fatalf("getReceivedDataCodec failed at offset %d. Error: %v", offset, err)
+		}
+		if err := appendObjectData("someorg", "type1", "codec", dataCodec, bytes.NewReader(plain[offset:offset+100]), 100, offset,
+			metaData.ObjectSize, offset == 0, offset != 0); err != nil {
+			t.Errorf("appendObjectData failed at offset %d. Error: %s", offset, err.Error())
+		}
+	}
+
+	dataCodec, err := Store.RetrieveObjectDataCodec("someorg", "type1", "codec")
+	if err != nil || dataCodec == nil {
+		t.Fatalf("The codec of the received data wasn't stored")
+	}
+	dataReader, err := Store.RetrieveObjectData("someorg", "type1", "codec")
+	if err != nil || dataReader == nil {
+		t.Fatalf("Failed to retrieve the data")
+	}
+	data, _ := ioutil.ReadAll(dataCodec.NewDecodingReader(dataReader, 0))
+	if !bytes.Equal(data, plain) {
+		t.Errorf("Wrong data decoded")
+	}
+	digest := sha256.Sum256(plain)
+	if dataHash, _, err := hashObjectData(metaData, "", common.SHA256); err != nil || dataHash != hex.EncodeToString(digest[:]) {
+		t.Errorf("hashObjectData didn't decode the data")
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "categories", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := checkNotificationRecord(metaData, metaData.OriginType, metaData.OriginID, 20, common.Getdata, 0, 5); !IsNotificationNotFound(err) {
+		t.Errorf("checkNotificationRecord without a notification didn't return a notification not found error")
+	}
+
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if err := Comm.GetData(metaData, 0); err != nil {
+		t.Errorf("GetData failed. Error: %s", err.Error())
+	}
+	if _, err := checkNotificationRecord(metaData, metaData.OriginType, metaData.OriginID, 21, common.Getdata, 0, 5); !IsInstanceMismatch(err) {
+		t.Errorf("checkNotificationRecord of another instance didn't return an instance mismatch error")
+	}
+	if _, err := checkNotificationRecord(metaData, metaData.OriginType, metaData.OriginID, 20, common.Getdata, 5, 5); !IsInvalidData(err) {
+		t.Errorf("checkNotificationRecord of a chunk that wasn't requested didn't return an invalid data error")
+	}
+	if _, err := checkNotificationRecord(metaData, metaData.OriginType, metaData.OriginID, 20, common.Getdata, 0, 5); err != nil {
+		t.Errorf("checkNotificationRecord failed. Error: %s", err.Error())
+	}
+
+	if !IsTransportFailure(&Error{"Failed to send"}) {
+		t.Errorf("Communication error isn't a transport failure")
+	}
+	if IsTransportFailure(&notificationHandlerError{message: "Failed"}) || IsNotificationNotFound(nil) {
+		t.Errorf("Error without a category has a category")
+	}
+}
+
+func TestHandleDataDuplicateChunk(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "duplicate", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	for _, offset := range []int64{0, 5} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+
+	message, err := buildDataMessage(metaData, []byte("hello"), 5, 0)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+
+	// The chunk is requested again (e.g. after a resend) and delivered twice, the second copy must not be written
+	if err := Comm.GetData(metaData, 0); err != nil {
+		t.Errorf("GetData failed. Error: %s", err.Error())
+	}
+	message, err = buildDataMessage(metaData, []byte("HELLO"), 5, 0)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed for a duplicate chunk. Error: %s", err.Error())
+	}
+	if chunksInfo := notificationChunks[id]; chunksInfo.receivedDataSize != 5 {
+		t.Errorf("Wrong received data size after a duplicate chunk: %d instead of 5", chunksInfo.receivedDataSize)
+	}
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.PartiallyReceived {
+		t.Errorf("Wrong status after a duplicate chunk: %s instead of %s", status, common.PartiallyReceived)
+	}
+
+	message, err = buildDataMessage(metaData, []byte("world"), 5, 5)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.CompletelyReceived {
+		t.Errorf("Wrong status: %s instead of %s", status, common.CompletelyReceived)
+	}
+	data, _, length, err := Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 100, 0)
+	if err != nil {
+		t.Errorf("Failed to read object data. Error: %s", err.Error())
+	} else if string(data[:length]) != "helloworld" {
+		t.Errorf("Wrong object data: %s instead of helloworld", string(data[:length]))
+	}
+}
+
+func TestZeroFillDataMessages(t *testing.T) {
+	testZeroFillDataMessages(common.Bolt, t)
+	testZeroFillDataMessages(common.InMemory, t)
+}
+
+func testZeroFillDataMessages(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	defer func() { common.Configuration.SparseDataTransfer = false }()
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	// Data that is all zeros is sent as a zero-fill data message only to peers that support it
+	source := common.MetaData{ObjectID: "sparse-source", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 5}
+	if _, err := Store.StoreObject(source, []byte("hello\x00\x00\x00\x00\x00"), common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	versions := []struct {
+		sparse   bool
+		version  common.SyncServiceVersion
+		zeroFill int64
+	}{
+		{true, common.ZeroFillVersion, 5},
+		{true, common.AckBatchVersion, 0},
+		{false, common.ZeroFillVersion, 0},
+	}
+	for _, test := range versions {
+		common.Configuration.SparseDataTransfer = test.sparse
+		for _, offset := range []int64{0, 5} {
+			dataMessage, length, _, err := readDataMessage(new(bytes.Buffer), source, offset, 5, nil, nil, test.version, common.CompressionNone)
+			if err != nil {
+				t.Errorf("readDataMessage(%d) failed. Error: %s", offset, err.Error())
+				continue
+			}
+			_, _, _, _, dataLength, _, _, _, zeroFill, err := parseDataMessage(dataMessage)
+			expected := int64(0)
+			if offset == 5 {
+				expected = test.zeroFill
+			}
+			if err != nil || length != 5 || zeroFill != expected || int64(dataLength)+zeroFill != 5 {
+				t.Errorf("Wrong data message at %d (version %v): data length %d, zero-fill %d instead of %d", offset,
+					test.version, dataLength, zeroFill, expected)
+			}
+		}
+	}
+
+	metaData := common.MetaData{ObjectID: "sparse", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 25, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	for offset := int64(0); offset < metaData.ObjectSize; offset += 5 {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+
+	zeroFillMessage := func(offset int64, length int64) []byte {
+		message := new(bytes.Buffer)
+		writeDataMessageHeader(message, metaData, 0, offset, common.Version, binary.BigEndian, common.CompressionNone, length)
+		return message.Bytes()
+	}
+	messages := []struct {
+		message  []byte
+		received int64
+	}{
+		{zeroFillMessage(5, 10), 10},
+		{nil, 15},
+		{zeroFillMessage(20, 5), 20},
+	}
+	messages[1].message, _ = buildDataMessage(metaData, []byte("world"), 5, 15)
+	for _, test := range messages {
+		if _, err := handleData(test.message); err != nil {
+			t.Errorf("handleData failed. Error: %s", err.Error())
+		}
+		notificationLock.RLock()
+		chunksInfo := notificationChunks[id]
+		notificationLock.RUnlock()
+		if chunksInfo.receivedDataSize != test.received {
+			t.Errorf("Wrong received data size: %d instead of %d", chunksInfo.receivedDataSize, test.received)
+		}
+	}
+
+	// The zeros of the last chunk don't complete the object before its first chunk is received
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.PartiallyReceived {
+		t.Errorf("Wrong status: %s instead of %s", status, common.PartiallyReceived)
+	}
+	message, _ := buildDataMessage(metaData, []byte("hello"), 5, 0)
+	if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.CompletelyReceived {
+		t.Errorf("Wrong status: %s instead of %s", status, common.CompletelyReceived)
+	}
+	expected := "hello\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00world\x00\x00\x00\x00\x00"
+	data, _, length, err := Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 100, 0)
+	if err != nil {
+		t.Errorf("Failed to read object data. Error: %s", err.Error())
+	} else if string(data[:length]) != expected {
+		t.Errorf("Wrong object data: %q instead of %q", string(data[:length]), expected)
+	}
+
+	// A zero-fill data message can't carry data
+	invalid := new(bytes.Buffer)
+	writeDataMessageHeader(invalid, metaData, 5, 0, common.Version, binary.BigEndian, common.CompressionNone, 5)
+	invalid.WriteString("hello")
+	if err := ValidateDataMessage(invalid.Bytes()); err == nil {
+		t.Errorf("ValidateDataMessage accepted a zero-fill data message with data")
+	}
+}
+
+func TestVerifyReceivedDataSize(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	verify := common.Configuration.VerifyReceivedDataSize
+	defer func() { common.Configuration.VerifyReceivedDataSize = verify }()
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	type dataMessage struct {
+		data   string
+		offset int64
+		status string
+	}
+	tests := []struct {
+		name     string
+		verify   bool
+		size     int64
+		chunk    int
+		messages []dataMessage
+		resent   bool
+	}{
+		// A short final chunk is only a part of the chunk, the object is complete once the rest of the chunk is received
+		{"short", true, 12, 5, []dataMessage{{"hello", 0, common.PartiallyReceived}, {"world", 5, common.PartiallyReceived},
+			{"!", 10, common.PartiallyReceived}, {"?", 11, common.CompletelyReceived}}, false},
+		// Overlapping parts of a chunk add up to more than the object's size, the data is requested again
+		{"mismatch", true, 10, 10, []dataMessage{{"hellow", 0, common.PartiallyReceived}, {"oworld", 4, common.PartiallyReceived}}, true},
+		{"unverified", false, 10, 10, []dataMessage{{"hellow", 0, common.PartiallyReceived}, {"oworld", 4, common.CompletelyReceived}}, false},
+	}
+	for _, test := range tests {
+		common.Configuration.VerifyReceivedDataSize = test.verify
+		metaData := common.MetaData{ObjectID: test.name, ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+			OriginID: "123", OriginType: "type2", ObjectSize: test.size, ChunkSize: test.chunk, InstanceID: 20, DataID: 20}
+		if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+			t.Errorf("Test %s: failed to store object. Error: %s", test.name, err.Error())
+			continue
+		}
+		for offset := int64(0); offset < test.size; offset += int64(test.chunk) {
+			if err := Comm.GetData(metaData, offset); err != nil {
+				t.Errorf("Test %s: GetData failed (offset = %d). Error: %s", test.name, offset, err.Error())
+			}
+		}
+
+		for _, message := range test.messages {
+			encoded, err := buildDataMessage(metaData, []byte(message.data), len(message.data), message.offset)
+			if err != nil {
+				t.Errorf("Test %s: failed to build data message. Error: %s", test.name, err.Error())
+				continue
+			}
+			if _, err := handleData(encoded); err != nil {
+				t.Errorf("Test %s: handleData failed (offset = %d). Error: %s", test.name, message.offset, err.Error())
+			}
+			if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != message.status {
+				t.Errorf("Test %s: wrong status after the data at offset %d: %s instead of %s", test.name, message.offset, status, message.status)
+			}
+		}
+
+		// The data that failed the verification is requested again from the beginning
+		id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		notificationLock.RLock()
+		chunksInfo, ok := notificationChunks[id]
+		notificationLock.RUnlock()
+		if test.resent {
+			if _, requested := chunksInfo.chunkResendTimes[0]; !ok || !requested || chunksInfo.receivedDataSize != 0 {
+				t.Errorf("Test %s: the data wasn't requested again", test.name)
+			}
+		} else if ok {
+			t.Errorf("Test %s: the transfer wasn't completed", test.name)
+		}
+		removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+	}
+}
+
+func TestDataVerificationFailures(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	maxResends := common.Configuration.MaxChunkResends
+	defer func() { common.Configuration.MaxChunkResends = maxResends }()
+	common.Configuration.MaxChunkResends = 2
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	digest := sha256.Sum256([]byte("helloworld"))
+	metaData := common.MetaData{ObjectID: "verify", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 10, InstanceID: 20, DataID: 20,
+		HashAlgorithm: common.SHA256, Hash: hex.EncodeToString(digest[:])}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+		return
+	}
+	if err := Comm.GetData(metaData, 0); err != nil {
+		t.Errorf("GetData failed. Error: %s", err.Error())
+	}
+	defer removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+
+	// The data is corrupted every time it is sent
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	for attempt := 1; attempt <= common.Configuration.MaxChunkResends+1; attempt++ {
+		encoded, err := buildDataMessage(metaData, []byte("hellowrold"), 10, 0)
+		if err != nil {
+			t.Errorf("Attempt %d: failed to build data message. Error: %s", attempt, err.Error())
+			continue
+		}
+		if _, err := handleData(encoded); err != nil {
+			t.Errorf("Attempt %d: handleData failed. Error: %s", attempt, err.Error())
+		}
+
+		notificationLock.RLock()
+		chunksInfo, ok := notificationChunks[id]
+		notificationLock.RUnlock()
+		notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.OriginType, metaData.OriginID)
+		if err != nil || notification == nil {
+			t.Errorf("Attempt %d: failed to retrieve notification record. Error: %v", attempt, err)
+			continue
+		}
+		if attempt <= common.Configuration.MaxChunkResends {
+			// The data is requested again
+			if !ok || chunksInfo.verifyFailures != attempt || notification.Status == common.TransferFailed {
+				t.Errorf("Attempt %d: the data wasn't requested again", attempt)
+			}
+		} else if ok || notification.Status != common.TransferFailed {
+			// The transfer fails
+			t.Errorf("Attempt %d: the transfer didn't fail, notification status: %s", attempt, notification.Status)
+		}
+	}
+}
+
+func TestCancelObjectTransfer(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "cancel", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if err := CancelObjectTransfer(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, true); !IsNotificationNotFound(err) {
+		t.Errorf("CancelObjectTransfer of an object whose data is not being received returned %v", err)
+	}
+
+	for _, offset := range []int64{0, 5} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	message, err := buildDataMessage(metaData, []byte("hello"), 5, 0)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+
+	if err := CancelObjectTransfer(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, true); err != nil {
+		t.Errorf("CancelObjectTransfer failed. Error: %s", err.Error())
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	_, ok := notificationChunks[id]
+	notificationLock.RUnlock()
+	if ok {
+		t.Errorf("The chunks info of a cancelled transfer wasn't removed")
+	}
+	if notification, _ := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		metaData.OriginType, metaData.OriginID); notification != nil {
+		t.Errorf("The notification record of a cancelled transfer wasn't removed")
+	}
+
+	// Data that is still received for the cancelled transfer is ignored
+	message, err = buildDataMessage(metaData, []byte("world"), 5, 5)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); !IsNotificationNotFound(err) {
+		t.Errorf("handleData of a cancelled transfer returned %v", err)
+	}
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.PartiallyReceived {
+		t.Errorf("Wrong status after a cancelled transfer: %s instead of %s", status, common.PartiallyReceived)
+	}
+
+	// The other side stops sending the object when the destination cancels its transfer
+	notification := common.Notification{ObjectID: "cancel2", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev2", DestType: "device",
+		Status: common.Updated, InstanceID: 30}
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+	}
+	if err := handleCancelTransfer(notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType,
+		notification.DestID, 29); !isIgnoredByHandler(err) {
+		t.Errorf("handleCancelTransfer of another instance returned %v", err)
+	}
+	if err := handleCancelTransfer(notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType,
+		notification.DestID, 30); err != nil {
+		t.Errorf("handleCancelTransfer failed. Error: %s", err.Error())
+	}
+	if record, _ := Store.RetrieveNotificationRecord(notification.DestOrgID, notification.ObjectType, notification.ObjectID,
+		notification.DestType, notification.DestID); record != nil {
+		t.Errorf("The notification record of a cancelled transfer wasn't removed by the sender")
+	}
+}
+
+func TestDeleteDuringTransfer(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	checkDeleted := func(metaData common.MetaData) {
+		id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		notificationLock.RLock()
+		_, ok := notificationChunks[id]
+		notificationLock.RUnlock()
+		if ok {
+			t.Errorf("The chunks info of %s wasn't removed", metaData.ObjectID)
+		}
+		if notification, _ := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.OriginType, metaData.OriginID); notification != nil {
+			t.Errorf("The notification record of %s wasn't removed", metaData.ObjectID)
+		}
+		if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.ObjDeleted {
+			t.Errorf("Wrong status of %s: %s instead of %s", metaData.ObjectID, status, common.ObjDeleted)
+		}
+	}
+	startTransfer := func(objectID string) common.MetaData {
+		metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+			OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, DataID: 20}
+		if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+			t.Errorf("Failed to store object. Error: %s", err.Error())
+		}
+		for _, offset := range []int64{0, 5} {
+			if err := Comm.GetData(metaData, offset); err != nil {
+				t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+			}
+		}
+		return metaData
+	}
+
+	// The chunks that arrive after the delete are ignored
+	metaData := startTransfer("delete1")
+	if message, err := buildDataMessage(metaData, []byte("hello"), 5, 0); err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+	if err := handleDelete(metaData); err != nil {
+		t.Errorf("handleDelete failed. Error: %s", err.Error())
+	}
+	checkDeleted(metaData)
+	if message, err := buildDataMessage(metaData, []byte("world"), 5, 5); err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); !isIgnoredByHandler(err) {
+		t.Errorf("handleData of a deleted object returned %v", err)
+	}
+	checkDeleted(metaData)
+
+	// The chunks of the deleted instance are ignored after the object is updated again
+	updated := metaData
+	updated.InstanceID = 21
+	updated.DataID = 21
+	if _, err := Store.StoreObject(updated, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if message, err := buildDataMessage(metaData, []byte("world"), 5, 5); err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); !isIgnoredByHandler(err) {
+		t.Errorf("handleData of a superseded instance returned %v", err)
+	}
+
+	// The outcome of a delete that races with the data is the same, whichever is handled first
+	for i := 0; i < 20; i++ {
+		metaData := startTransfer("delete" + strconv.Itoa(i+2))
+		messages := make([][]byte, 0)
+		for _, offset := range []int64{0, 5} {
+			message, err := buildDataMessage(metaData, []byte("hello"), 5, offset)
+			if err != nil {
+				t.Errorf("Failed to build data message. Error: %s", err.Error())
+				return
+			}
+			messages = append(messages, message)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(len(messages) + 1)
+		for _, message := range messages {
+			go func(message []byte) {
+				defer wg.Done()
+				if _, err := handleData(message); err != nil && !isIgnoredByHandler(err) {
+					t.Errorf("handleData failed. Error: %s", err.Error())
+				}
+			}(message)
+		}
+		go func() {
+			defer wg.Done()
+			if err := handleDelete(metaData); err != nil {
+				t.Errorf("handleDelete failed. Error: %s", err.Error())
+			}
+		}()
+		wg.Wait()
+		checkDeleted(metaData)
+	}
+}
+
+func TestFailedTransfer(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.MaxChunkResends = 1
+	defer func() { common.Configuration.MaxChunkResends = 0 }()
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "failed", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	for _, offset := range []int64{0, 5} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	expireResendTimes := func() {
+		notificationLock.Lock()
+		chunksInfo := notificationChunks[id]
+		for offset := range chunksInfo.chunkResendTimes {
+			chunksInfo.chunkResendTimes[offset] = 0
+		}
+		chunksInfo.resendTime = 0
+		notificationChunks[id] = chunksInfo
+		notificationLock.Unlock()
+	}
+	retrieveNotification := func() common.Notification {
+		notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.OriginType, metaData.OriginID)
+		if err != nil || notification == nil {
+			t.Fatalf("Failed to retrieve the notification record. Error: %v", err)
+		}
+		return *notification
+	}
+
+	expireResendTimes()
+	if offsets := getOffsetsToResend(retrieveNotification(), metaData); len(offsets) != 2 {
+		t.Errorf("getOffsetsToResend returned %d offsets instead of 2", len(offsets))
+	}
+	if err := Comm.GetData(metaData, 0); err != nil {
+		t.Errorf("GetData failed. Error: %s", err.Error())
+	}
+
+	// The chunk at offset 0 was requested again once, the transfer fails instead of requesting it a third time
+	expireResendTimes()
+	if offsets := getOffsetsToResend(retrieveNotification(), metaData); len(offsets) != 0 {
+		t.Errorf("getOffsetsToResend returned %d offsets of a failed transfer", len(offsets))
+	}
+	if notification := retrieveNotification(); notification.Status != common.TransferFailed {
+		t.Errorf("Wrong notification status: %s instead of %s", notification.Status, common.TransferFailed)
+	}
+	if failed, err := GetFailedTransfers(metaData.DestOrgID); err != nil || len(failed) != 1 || failed[0].ObjectID != metaData.ObjectID {
+		t.Errorf("GetFailedTransfers returned %v, %v", failed, err)
+	}
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.PartiallyReceived {
+		t.Errorf("Wrong status of the object of a failed transfer: %s instead of %s", status, common.PartiallyReceived)
+	}
+	if state, ok := DumpChunkState(id); !ok || len(state.Inflight) != 2 || state.Inflight[0].Requests != 2 {
+		t.Errorf("The state of the failed transfer wasn't kept: %v", state)
+	}
+
+	if err := RetryFailedTransfer(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		t.Errorf("RetryFailedTransfer failed. Error: %s", err.Error())
+	}
+	if err := RetryFailedTransfer(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); !IsNotificationNotFound(err) {
+		t.Errorf("RetryFailedTransfer of a transfer that didn't fail returned %v", err)
+	}
+	if offsets := getOffsetsToResend(retrieveNotification(), metaData); len(offsets) != 2 {
+		t.Errorf("getOffsetsToResend returned %d offsets of a retried transfer instead of 2", len(offsets))
+	}
+	removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+}
+
+func TestMaxConcurrentTransfers(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	protocol := common.Configuration.CommunicationProtocol
+	common.Configuration.CommunicationProtocol = common.MQTTProtocol
+	common.Configuration.MaxConcurrentTransfersPerDestination = 1
+	defer func() {
+		common.Configuration.CommunicationProtocol = protocol
+		common.Configuration.MaxConcurrentTransfersPerDestination = 0
+	}()
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	hasChunksInfo := func(metaData common.MetaData) bool {
+		id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		notificationLock.RLock()
+		defer notificationLock.RUnlock()
+		_, ok := notificationChunks[id]
+		return ok
+	}
+
+	metaData1 := common.MetaData{ObjectID: "slot1", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 5, ChunkSize: 5, InstanceID: 10, DataID: 10}
+	metaData2 := metaData1
+	metaData2.ObjectID = "slot2"
+
+	for _, metaData := range []common.MetaData{metaData1, metaData2} {
+		if err := handleUpdate(metaData, 1); err != nil {
+			t.Errorf("handleUpdate failed (objectID = %s). Error: %s", metaData.ObjectID, err.Error())
+		}
+	}
+	if !hasChunksInfo(metaData1) {
+		t.Errorf("The data of the first object wasn't requested")
+	}
+	if hasChunksInfo(metaData2) {
+		t.Errorf("The data of the second object was requested while the first object's data is being received")
+	}
+	// A resent update of a waiting object keeps waiting
+	if err := handleUpdate(metaData2, 1); err != nil {
+		t.Errorf("handleUpdate failed (objectID = %s). Error: %s", metaData2.ObjectID, err.Error())
+	}
+	if hasChunksInfo(metaData2) {
+		t.Errorf("The data of the second object was requested after its update was resent")
+	}
+
+	message, err := buildDataMessage(metaData1, []byte("hello"), 5, 0)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+
+	// The data of the waiting object is requested once the first transfer completes
+	for i := 0; i < 100 && !hasChunksInfo(metaData2); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !hasChunksInfo(metaData2) {
+		t.Errorf("The data of the second object wasn't requested after the first transfer completed")
+	}
+
+	removeNotificationChunksInfo(metaData2, metaData2.OriginType, metaData2.OriginID)
+	transferSlotsLock.Lock()
+	if len(transferSlots) != 0 || len(pendingTransfers) != 0 {
+		t.Errorf("Transfer slots weren't released: %d origins with slots, %d origins with waiting transfers",
+			len(transferSlots), len(pendingTransfers))
+	}
+	transferSlotsLock.Unlock()
+}
+
+func TestHandleUpdateStoredData(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	protocol := common.Configuration.CommunicationProtocol
+	common.Configuration.CommunicationProtocol = common.MQTTProtocol
+	defer func() { common.Configuration.CommunicationProtocol = protocol }()
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		objectID     string
+		status       string
+		dataID       int64
+		requestsData bool
+	}{
+		// The update was resent, the stored data is kept
+		{"same", common.CompletelyReceived, 10, false},
+		{"sameReceived", common.ObjReceived, 10, false},
+		// The data was changed
+		{"changed", common.CompletelyReceived, 20, true},
+		// The stored data is incomplete
+		{"partial", common.PartiallyReceived, 10, true},
+	}
+
+	for _, test := range tests {
+		metaData := common.MetaData{ObjectID: test.objectID, ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+			OriginID: "123", OriginType: "type2", ObjectSize: 5, ChunkSize: 5, InstanceID: 10, DataID: 10}
+		if _, err := Store.StoreObject(metaData, []byte("hello"), test.status); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s", test.objectID, err.Error())
+			continue
+		}
+
+		metaData.InstanceID = 20
+		metaData.DataID = test.dataID
+		if err := handleUpdate(metaData, 1); err != nil {
+			t.Errorf("handleUpdate failed (objectID = %s). Error: %s", test.objectID, err.Error())
+			continue
+		}
+
+		id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		if _, ok := notificationChunks[id]; ok != test.requestsData {
+			t.Errorf("Data requested: %t instead of %t (objectID = %s)", ok, test.requestsData, test.objectID)
+		}
+		removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+		if test.requestsData {
+			continue
+		}
+
+		storedMeta, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || storedMeta == nil {
+			t.Errorf("Failed to retrieve object (objectID = %s). Error: %v", test.objectID, err)
+			continue
+		}
+		if status != common.CompletelyReceived || storedMeta.InstanceID != 20 {
+			t.Errorf("Wrong status or instance: %s, %d (objectID = %s)", status, storedMeta.InstanceID, test.objectID)
+		}
+		dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("The stored data wasn't kept (objectID = %s). Error: %v", test.objectID, err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(dataReader); string(data) != "hello" {
+			t.Errorf("Wrong data: %s instead of hello (objectID = %s)", string(data), test.objectID)
+		}
+	}
+}
+
+func TestHandleUpdateOriginChain(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	destinationType := common.Configuration.DestinationType
+	destinationID := common.Configuration.DestinationID
+	common.Configuration.DestinationType = "device"
+	common.Configuration.DestinationID = "dev1"
+	defer func() {
+		common.Configuration.DestinationType = destinationType
+		common.Configuration.DestinationID = destinationID
+	}()
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "chain", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "gw1", OriginType: "gateway", NoData: true, InstanceID: 10,
+		OriginChain: []common.OriginHop{{Type: "cloud", ID: "css1"}}}
+	if err := handleUpdate(metaData, 1); err != nil {
+		t.Errorf("handleUpdate failed. Error: %s", err.Error())
+	}
+	storedMeta, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || storedMeta == nil {
+		t.Errorf("Failed to retrieve object. Error: %v", err)
+	} else if len(storedMeta.OriginChain) != 2 || storedMeta.OriginChain[0].ID != "css1" || storedMeta.OriginChain[1].Type != "gateway" ||
+		storedMeta.OriginChain[1].ID != "gw1" {
+		t.Errorf("Wrong origin chain: %v", storedMeta.OriginChain)
+	}
+
+	// An object that was already relayed through this node is rejected
+	metaData.ObjectID = "loop"
+	metaData.OriginChain = []common.OriginHop{{Type: "device", ID: "dev1"}, {Type: "cloud", ID: "css1"}}
+	if err := handleUpdate(metaData, 1); !IsInvalidData(err) {
+		t.Errorf("handleUpdate of an object relayed back to this node returned %v", err)
+	}
+	if storedMeta, _ := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); storedMeta != nil {
+		t.Errorf("An object relayed back to this node was stored")
+	}
+}
+
+func TestHandleUpdatePatch(t *testing.T) {
+	testHandleUpdatePatch(common.InMemory, t)
+	testHandleUpdatePatch(common.Bolt, t)
+}
+
+func testHandleUpdatePatch(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	protocol := common.Configuration.CommunicationProtocol
+	common.Configuration.CommunicationProtocol = common.MQTTProtocol
+	defer func() { common.Configuration.CommunicationProtocol = protocol }()
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		objectID        string
+		patchBaseDataID int64
+		offsets         []int64
+		chunks          map[int64]string
+		data            string
+	}{
+		// The changed range and the appended data are requested, the rest of the data is kept
+		{"patch", 10, []int64{5, 15}, map[int64]string{5: "56XY9", 15: "fg"}, "0123456XY9abcdefg"},
+		// The data that the patch applies to isn't stored, the whole data is requested
+		{"mismatch", 9, []int64{0, 5, 10, 15}, map[int64]string{0: "01234", 5: "56XY9", 10: "abcde", 15: "fg"}, "0123456XY9abcdefg"},
+	}
+
+	for _, test := range tests {
+		metaData := common.MetaData{ObjectID: test.objectID, ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+			OriginID: "123", OriginType: "type2", ObjectSize: 15, ChunkSize: 5, InstanceID: 10, DataID: 10}
+		if _, err := Store.StoreObject(metaData, []byte("0123456789abcde"), common.CompletelyReceived); err != nil {
+			t.Errorf("Failed to store object. Error: %s", err.Error())
+			continue
+		}
+
+		metaData.InstanceID = 20
+		metaData.DataID = 20
+		metaData.ObjectSize = 17
+		metaData.PatchRanges = []common.ByteRange{{Offset: 6, Length: 2}}
+		metaData.PatchBaseDataID = test.patchBaseDataID
+		if err := handleUpdate(metaData, 10); err != nil {
+			t.Errorf("handleUpdate failed (objectID = %s). Error: %s", test.objectID, err.Error())
+			continue
+		}
+
+		id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+		chunksInfo, ok := notificationChunks[id]
+		if !ok {
+			t.Errorf("No chunks info (objectID = %s)", test.objectID)
+			continue
+		}
+		if len(chunksInfo.chunkResendTimes) != len(test.offsets) {
+			t.Errorf("Wrong number of requested chunks: %d instead of %d (objectID = %s)", len(chunksInfo.chunkResendTimes),
+				len(test.offsets), test.objectID)
+		}
+		for _, offset := range test.offsets {
+			if _, ok := chunksInfo.chunkResendTimes[offset]; !ok {
+				t.Errorf("Chunk at offset %d wasn't requested (objectID = %s)", offset, test.objectID)
+			}
+		}
+
+		storedMetaData, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || storedMetaData == nil {
+			t.Errorf("Failed to retrieve object (objectID = %s)", test.objectID)
+			continue
+		}
+		for _, offset := range test.offsets {
+			chunk := test.chunks[offset]
+			message, err := buildDataMessage(*storedMetaData, []byte(chunk), len(chunk), offset)
+			if err != nil {
+				t.Errorf("Failed to build data message. Error: %s", err.Error())
+			} else if _, err := handleData(message); err != nil {
+				t.Errorf("handleData failed (objectID = %s, offset = %d). Error: %s", test.objectID, offset, err.Error())
+			}
+		}
+
+		if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.CompletelyReceived {
+			t.Errorf("Wrong status: %s instead of %s (objectID = %s)", status, common.CompletelyReceived, test.objectID)
+		}
+		data, _, length, err := Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 100, 0)
+		if err != nil {
+			t.Errorf("Failed to read object data. Error: %s", err.Error())
+		} else if string(data[:length]) != test.data {
+			t.Errorf("Wrong object data: %s instead of %s (objectID = %s)", string(data[:length]), test.data, test.objectID)
+		}
+	}
+}
+
+func TestHandleUpdateMetaOnly(t *testing.T) {
+	testHandleUpdateMetaOnly(common.InMemory, t)
+	testHandleUpdateMetaOnly(common.Bolt, t)
+}
+
+func testHandleUpdateMetaOnly(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	protocol := common.Configuration.CommunicationProtocol
+	common.Configuration.CommunicationProtocol = common.MQTTProtocol
+	defer func() { common.Configuration.CommunicationProtocol = protocol }()
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "metaonly", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, InstanceSequence: 1, DataID: 20}
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate failed. Error: %s", err.Error())
+		return
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+	message, err := buildDataMessage(metaData, []byte("01234"), 5, 0)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData failed. Error: %s", err.Error())
+	}
+
+	// A metadata only update of the data being received is merged, the transfer goes on
+	metaData.InstanceID = 21
+	metaData.InstanceSequence = 2
+	metaData.MetaOnly = true
+	metaData.Description = "updated"
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate of a metadata only update failed. Error: %s", err.Error())
+	}
+	storedMetaData, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if storedMetaData == nil || storedMetaData.Description != "updated" || storedMetaData.InstanceID != 21 ||
+		storedMetaData.DataID != 20 || storedMetaData.ObjectSize != 10 {
+		t.Errorf("The metadata only update wasn't merged: %+v", storedMetaData)
+		return
+	}
+	if status != common.PartiallyReceived {
+		t.Errorf("Wrong status after a metadata only update: %s instead of %s", status, common.PartiallyReceived)
+	}
+	notificationLock.RLock()
+	chunksInfo, ok := notificationChunks[id]
+	notificationLock.RUnlock()
+	if !ok || chunksInfo.receivedDataSize != 5 {
+		t.Errorf("The received chunks were discarded by a metadata only update")
+	}
+	if record, _ := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType,
+		metaData.OriginID); record == nil || record.InstanceID != 21 || record.Status != common.Getdata {
+		t.Errorf("The notification record wasn't moved to the new instance: %+v", record)
+	}
+
+	message, err = buildDataMessage(*storedMetaData, []byte("56789"), 5, 5)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+	} else if _, err := handleData(message); err != nil {
+		t.Errorf("handleData after a metadata only update failed. Error: %s", err.Error())
+	}
+	if _, status, _ := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.CompletelyReceived {
+		t.Errorf("Wrong status: %s instead of %s", status, common.CompletelyReceived)
+	}
+
+	// A metadata only update of a received object keeps its data
+	metaData.InstanceID = 22
+	metaData.InstanceSequence = 3
+	metaData.Description = "updated again"
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate of a metadata only update failed. Error: %s", err.Error())
+	}
+	storedMetaData, status, _ = Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if storedMetaData == nil || storedMetaData.Description != "updated again" || status != common.CompletelyReceived {
+		t.Errorf("The metadata only update of a received object wasn't merged")
+	}
+	data, _, length, err := Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 100, 0)
+	if err != nil {
+		t.Errorf("Failed to read object data. Error: %s", err.Error())
+	} else if string(data[:length]) != "0123456789" {
+		t.Errorf("Wrong object data after a metadata only update: %s", string(data[:length]))
+	}
+}
+
+func TestHandleUpdateEmptyObject(t *testing.T) {
+	testHandleUpdateEmptyObject(common.InMemory, t)
+	testHandleUpdateEmptyObject(common.Bolt, t)
+}
+
+func testHandleUpdateEmptyObject(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	if err := Store.AddWebhook("someorg", "emptytype", server.URL); err != nil {
+		t.Errorf("AddWebhook failed. Error: %s", err.Error())
+	}
+
+	// An empty object is completely received without requesting its data, and its empty data can be read
+	metaData := common.MetaData{ObjectID: "empty", ObjectType: "emptytype", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 0, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate of an empty object failed. Error: %s", err.Error())
+	}
+	if status, _ := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.CompletelyReceived {
+		t.Errorf("Wrong status of an empty object: %s instead of %s", status, common.CompletelyReceived)
+	}
+	if record, _ := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType,
+		metaData.OriginID); record == nil || record.Status != common.Received {
+		t.Errorf("The origin wasn't notified that the empty object was received: %+v", record)
+	}
+	if dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil || dataReader == nil {
+		t.Errorf("No data for an empty object. Error: %v", err)
+	} else {
+		if data, _ := ioutil.ReadAll(dataReader); len(data) != 0 {
+			t.Errorf("The data of an empty object isn't empty: %s", string(data))
+		}
+		Store.CloseDataReader(dataReader)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("The webhook was called %d times for an empty object", atomic.LoadInt32(&calls))
+	}
+
+	// An object without data is completely received without data and without calling the webhooks
+	metaData.ObjectID = "nodata"
+	metaData.NoData = true
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate of an object without data failed. Error: %s", err.Error())
+	}
+	if status, _ := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.CompletelyReceived {
+		t.Errorf("Wrong status of an object without data: %s instead of %s", status, common.CompletelyReceived)
+	}
+	if dataReader, _ := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); dataReader != nil {
+		t.Errorf("An object without data has data")
+		Store.CloseDataReader(dataReader)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("The webhook was called for an object without data")
+	}
+}
+
+func TestReadDataMessageFromSourceDataURI(t *testing.T) {
+	file, err := ioutil.TempFile("", "sourcedata")
+	if err != nil {
+		t.Errorf("Failed to create file. Error: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	data := []byte("0123456789abcdefghij")
+	file.Write(data)
+	file.Close()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", InstanceID: 5,
+		SourceDataURI: "file://" + file.Name()}
+	tests := []struct {
+		offset int64
+		size   int
+		data   string
+		eof    bool
+	}{
+		{0, 8, "01234567", false},
+		{12, 8, "cdefghij", true},
+		{16, 8, "ghij", true}, // The data length is updated when less data is read
+	}
+	message := new(bytes.Buffer)
+	for _, test := range tests {
+		message.Reset()
+		dataMessage, length, eof, err := readDataMessage(message, metaData, test.offset, test.size, nil, nil, common.Version, common.CompressionNone)
+		if err != nil {
+			t.Errorf("readDataMessage(%d, %d) failed. Error: %s", test.offset, test.size, err.Error())
+			continue
+		}
+		if length != len(test.data) || eof != test.eof {
+			t.Errorf("readDataMessage(%d, %d) returned length %d and eof %t", test.offset, test.size, length, eof)
+		}
+		_, _, objectID, dataReader, dataLength, offset, _, _, _, err := parseDataMessage(dataMessage)
+		if err != nil {
+			t.Errorf("Failed to parse the data message. Error: %s", err.Error())
+			continue
+		}
+		received, _ := ioutil.ReadAll(dataReader)
+		if objectID != metaData.ObjectID || offset != test.offset || int(dataLength) != len(test.data) ||
+			string(received) != test.data {
+			t.Errorf("Wrong data message: %s at offset %d (length %d) instead of %s", string(received), offset, dataLength, test.data)
+		}
+	}
+}
+
+func TestDataMessageSize(t *testing.T) {
+	maxDataChunkSize := common.Configuration.MaxDataChunkSize
+	defer func() { common.Configuration.MaxDataChunkSize = maxDataChunkSize }()
+
+	metaData := common.MetaData{ObjectSize: 100, ChunkSize: 10}
+	tests := []struct {
+		maxDataChunkSize int
+		offset           int64
+		end              int64
+		size             int
+	}{
+		{10, 0, 100, 10},
+		{25, 0, 100, 20}, // Whole chunks are packed in one data message
+		{25, 90, 100, 10},
+		{4, 0, 10, 4}, // A chunk is split across data messages
+		{4, 8, 10, 2},
+		{4, 10, 20, 4},
+	}
+	for _, test := range tests {
+		common.Configuration.MaxDataChunkSize = test.maxDataChunkSize
+		if size := dataMessageSize(metaData, test.offset, test.end); size != test.size {
+			t.Errorf("dataMessageSize(%d, %d) with MaxDataChunkSize %d returned %d instead of %d", test.offset, test.end,
+				test.maxDataChunkSize, size, test.size)
+		}
+	}
+
+	checks := []struct {
+		offset int64
+		length uint32
+		valid  bool
+	}{
+		{0, 10, true}, {10, 20, true}, {80, 20, true}, {4, 4, true}, {8, 2, true},
+		{5, 10, false}, {0, 15, false}, {95, 10, false},
+	}
+	for _, check := range checks {
+		if err := checkChunkOffset(metaData, check.offset, check.length); (err == nil) != check.valid {
+			t.Errorf("checkChunkOffset(%d, %d) returned %v", check.offset, check.length, err)
+		}
+	}
+}
+
+func TestSplitAndPackedChunks(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "parts", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 25, ChunkSize: 10, InstanceID: 20, DataID: 20}
+	for _, offset := range []int64{0, 10, 20} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+
+	// The first chunk is split across three data messages, one of them is received twice
+	tests := []struct {
+		offset    int64
+		size      int64
+		newSize   int64
+		completed int
+	}{
+		{0, 4, 4, 0},
+		{0, 4, 0, 0},
+		{4, 4, 4, 0},
+		{8, 2, 2, 1},
+		// The last two chunks are packed in one data message
+		{10, 15, 15, 2},
+	}
+	for _, test := range tests {
+		if newSize := getNewDataSize(metaData, test.offset, test.size); newSize != test.newSize {
+			t.Errorf("getNewDataSize(%d, %d) returned %d instead of %d", test.offset, test.size, newSize, test.newSize)
+		}
+		_, completed, err := handleChunkReceived(metaData, test.offset, test.size)
+		if err != nil {
+			t.Errorf("handleChunkReceived(%d, %d) failed. Error: %s", test.offset, test.size, err.Error())
+		} else if completed != test.completed {
+			t.Errorf("handleChunkReceived(%d, %d) completed %d chunks instead of %d", test.offset, test.size, completed, test.completed)
+		}
+	}
+
+	notificationLock.RLock()
+	chunksInfo := notificationChunks[id]
+	notificationLock.RUnlock()
+	if chunksInfo.receivedDataSize != 25 || len(chunksInfo.chunkResendTimes) != 0 || len(chunksInfo.chunkParts) != 0 {
+		t.Errorf("Wrong state after receiving the data: received %d bytes, %d in-flight chunks, %d split chunks",
+			chunksInfo.receivedDataSize, len(chunksInfo.chunkResendTimes), len(chunksInfo.chunkParts))
+	}
+	for _, offset := range []int64{0, 10, 20} {
+		if !isChunkReceived(metaData, offset) {
+			t.Errorf("The chunk at offset %d wasn't marked as received", offset)
+		}
+	}
+}
+
+func TestDumpChunkState(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "dump", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 22, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	if _, ok := DumpChunkState(id); ok {
+		t.Errorf("DumpChunkState returned the state of a transfer that didn't start")
+	}
+
+	for _, offset := range []int64{0, 5, 10} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	for _, offset := range []int64{0, 10} {
+		message, err := buildDataMessage(metaData, []byte("hello"), 5, offset)
+		if err != nil {
+			t.Errorf("Failed to build data message. Error: %s", err.Error())
+		} else if _, err := handleData(message); err != nil {
+			t.Errorf("handleData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+
+	state, ok := DumpChunkState(id)
+	if !ok {
+		t.Errorf("DumpChunkState didn't return the state of the transfer")
+		return
+	}
+	expectedReceived := []common.ByteRange{{Offset: 0, Length: 5}, {Offset: 10, Length: 5}}
+	expectedMissing := []common.ByteRange{{Offset: 5, Length: 5}, {Offset: 15, Length: 7}}
+	if fmt.Sprint(state.Received) != fmt.Sprint(expectedReceived) {
+		t.Errorf("Wrong received ranges: %v instead of %v", state.Received, expectedReceived)
+	}
+	if fmt.Sprint(state.Missing) != fmt.Sprint(expectedMissing) {
+		t.Errorf("Wrong missing ranges: %v instead of %v", state.Missing, expectedMissing)
+	}
+	if state.ReceivedDataSize != 10 || state.DataSize != 22 {
+		t.Errorf("Wrong data sizes: received %d of %d instead of 10 of 22", state.ReceivedDataSize, state.DataSize)
+	}
+	// handleData requests the next chunks as the chunks arrive
+	if len(state.Inflight) == 0 || state.Inflight[0].Offset != 5 || state.Inflight[0].ResendIn <= 0 {
+		t.Errorf("Wrong inflight chunks: %v", state.Inflight)
+	}
+}
+
+func TestListActiveTransfers(t *testing.T) {
+	id := common.CreateNotificationID("someorg", "type1", "with:colons", "type2", "123")
+	notificationLock.Lock()
+	notificationChunks[id] = notificationChunksInfo{receivedDataSize: 10, dataSize: 22,
+		chunkResendTimes: map[int64]int64{5: 200, 15: 100}, resendTime: 200}
+	notificationLock.Unlock()
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+
+	found := false
+	for _, transfer := range ListActiveTransfers() {
+		if transfer.ObjectID != "with:colons" {
+			continue
+		}
+		found = true
+		if transfer.OrgID != "someorg" || transfer.ObjectType != "type1" || transfer.DestType != "type2" || transfer.DestID != "123" {
+			t.Errorf("Wrong transfer: %+v", transfer)
+		}
+		if transfer.ReceivedBytes != 10 || transfer.TotalBytes != 22 || transfer.InflightChunks != 2 {
+			t.Errorf("Wrong progress: received %d of %d, %d inflight chunks", transfer.ReceivedBytes, transfer.TotalBytes,
+				transfer.InflightChunks)
+		}
+		if transfer.NextResend.Unix() != 100 {
+			t.Errorf("Wrong next resend time: %s", transfer.NextResend)
+		}
+	}
+	if !found {
+		t.Errorf("ListActiveTransfers didn't return the transfer")
+	}
+}
+
+func TestTransferInfo(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "transfer", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 10, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if transfer := getTransferInfo(metaData); transfer != nil {
+		t.Errorf("getTransferInfo returned the info of a transfer that didn't start")
+	}
+
+	if err := Comm.GetData(metaData, 0); err != nil {
+		t.Errorf("GetData failed. Error: %s", err.Error())
+	}
+	time.Sleep(10 * time.Millisecond)
+	transfer := getTransferInfo(metaData)
+	if transfer == nil {
+		t.Errorf("getTransferInfo didn't return the info of the transfer")
+	} else if transfer.Size != 10 || transfer.Duration < 10 || transfer.Rate == 0 || transfer.OriginID != metaData.OriginID {
+		t.Errorf("Wrong transfer info: %+v", *transfer)
+	}
+
+	completed := common.HealthUsageInfo.CompletedTransfers
+	for _, offset := range []int64{0, 5} {
+		message, err := buildDataMessage(metaData, []byte("hello"), 5, offset)
+		if err != nil {
+			t.Errorf("Failed to build data message. Error: %s", err.Error())
+		} else if _, err := handleData(message); err != nil {
+			t.Errorf("handleData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+
+	if common.HealthUsageInfo.CompletedTransfers != completed+1 {
+		t.Errorf("The completed transfer wasn't counted")
+	}
+	common.HealthStatus.UpdateHealthInfo(true, 0, 0, 0)
+	if transfers := common.HealthUsageInfo.LastTransfers; len(transfers) == 0 || transfers[0].ObjectID != metaData.ObjectID ||
+		transfers[0].Size != 10 {
+		t.Errorf("The completed transfer isn't reported in the last transfers: %v", transfers)
+	}
+}
+
+func TestChunkIntervalSet(t *testing.T) {
+	set := &chunkIntervalSet{size: 100}
+	for _, index := range []int64{5, 3, 4, 10, 0, 8, 9, 1, 2} {
+		if !set.add(index) {
+			t.Errorf("add(%d) returned false for a new index", index)
+		}
+	}
+	if set.add(4) || set.add(10) {
+		t.Errorf("add returned true for an index already in the set")
+	}
+	expected := []chunkInterval{{0, 6}, {8, 11}}
+	if len(set.intervals) != len(expected) {
+		t.Errorf("The set has %d intervals instead of %d: %v", len(set.intervals), len(expected), set.intervals)
+	} else {
+		for i, interval := range set.intervals {
+			if interval != expected[i] {
+				t.Errorf("Wrong interval %d: %v instead of %v", i, interval, expected[i])
+			}
+		}
+	}
+	for index := int64(0); index < 12; index++ {
+		if contains := set.contains(index); contains != (index < 6 || (index >= 8 && index < 11)) {
+			t.Errorf("contains(%d) returned %t", index, contains)
+		}
+	}
+
+	// The received chunks of a large object are tracked by the same operations as with a bitmap
+	for _, intervals := range []bool{false, true} {
+		chunksInfo := notificationChunksInfo{chunkSize: 10, baseOffset: 20}
+		if intervals {
+			chunksInfo.receivedIntervals = &chunkIntervalSet{size: 8}
+		} else {
+			chunksInfo.chunksReceived = make([]byte, 1)
+		}
+		if chunksInfo.isChunkInRange(10) || chunksInfo.isChunkInRange(100) || !chunksInfo.isChunkInRange(90) {
+			t.Errorf("Wrong range of the received chunks (intervals = %t)", intervals)
+		}
+		if !chunksInfo.markChunk(40) || chunksInfo.markChunk(40) {
+			t.Errorf("markChunk failed (intervals = %t)", intervals)
+		}
+		if !chunksInfo.isChunkMarked(40) || chunksInfo.isChunkMarked(30) || chunksInfo.isChunkMarked(100) {
+			t.Errorf("isChunkMarked failed (intervals = %t)", intervals)
+		}
+	}
+}
+
+// The received chunks state of a 100GB object with 4KB chunks, while the first 64 chunks are received out of order
+const (
+	benchmarkObjectSize = 100 * 1024 * 1024 * 1024
+	benchmarkChunkSize  = 4 * 1024
+)
+
+func benchmarkReceivedChunks(b *testing.B, intervals bool) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		numberOfBytes := int(((benchmarkObjectSize/benchmarkChunkSize + 1) / 8) + 1)
+		chunksInfo := notificationChunksInfo{chunkSize: benchmarkChunkSize}
+		if intervals {
+			chunksInfo.receivedIntervals = &chunkIntervalSet{size: int64(numberOfBytes) * 8}
+		} else {
+			chunksInfo.chunksReceived = make([]byte, numberOfBytes)
+		}
+		for chunk := int64(0); chunk < 64; chunk++ {
+			chunksInfo.markChunk((chunk ^ 1) * benchmarkChunkSize)
+		}
+	}
+}
+
+func BenchmarkReceivedChunksBitmap(b *testing.B) {
+	benchmarkReceivedChunks(b, false)
+}
+
+func BenchmarkReceivedChunksIntervalSet(b *testing.B) {
+	benchmarkReceivedChunks(b, true)
+}
+
+func TestChunkResendTimeJitter(t *testing.T) {
+	resendInterval := common.Configuration.ChunkResendInterval
+	jitterPercent := common.Configuration.ResendJitterPercent
+	defer func() {
+		common.Configuration.ChunkResendInterval = resendInterval
+		common.Configuration.ResendJitterPercent = jitterPercent
+	}()
+	common.Configuration.ChunkResendInterval = 60
+
+	for _, percent := range []int{0, 50, 100} {
+		common.Configuration.ResendJitterPercent = percent
+		maxDelay := int64(60 + 60*percent/100)
+		for i := 0; i < 100; i++ {
+			now := time.Now().Unix()
+			delay := chunkResendTime() - now
+			if delay < 60 || delay > maxDelay+1 {
+				t.Errorf("Resend delay %d is out of range [60, %d] (jitter = %d%%)", delay, maxDelay, percent)
+				break
+			}
+		}
+	}
+}
+
+func TestPriorityShare(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	weight := common.Configuration.PriorityWeight
+	defer func() { common.Configuration.PriorityWeight = weight }()
+	common.Configuration.PriorityWeight = 4
+
+	normal := common.MetaData{ObjectID: "normal", ObjectType: "type1", DestOrgID: "someorg", ObjectSize: 100, ChunkSize: 10}
+	high := common.MetaData{ObjectID: "high", ObjectType: "type1", DestOrgID: "someorg", ObjectSize: 100, ChunkSize: 10,
+		Priority: common.PriorityHigh}
+	if share := getPriorityShare(normal, 8); share != 8 {
+		t.Errorf("getPriorityShare returned %d instead of 8 without high priority transfers", share)
+	}
+
+	notification := common.Notification{ObjectID: normal.ObjectID, ObjectType: normal.ObjectType, DestOrgID: normal.DestOrgID,
+		DestType: "device", DestID: "dev1", Status: common.Getdata}
+	normalID := common.GetNotificationID(notification)
+	highID := common.CreateNotificationID(high.DestOrgID, high.ObjectType, high.ObjectID, "device", "dev1")
+	notificationLock.Lock()
+	notificationChunks[normalID] = notificationChunksInfo{chunkSize: 10, chunkResendTimes: map[int64]int64{0: 0, 10: 0, 20: 0, 30: 0}}
+	notificationChunks[highID] = notificationChunksInfo{chunkSize: 10, chunkResendTimes: map[int64]int64{0: 0},
+		priority: common.PriorityHigh}
+	notificationLock.Unlock()
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, normalID)
+		delete(notificationChunks, highID)
+		notificationLock.Unlock()
+	}()
+
+	tests := []struct {
+		metaData common.MetaData
+		count    int
+		expected int
+	}{
+		{normal, 8, 2}, {normal, 3, 1}, {normal, 1, 1}, {high, 8, 8}, {high, 1, 1},
+	}
+	for _, test := range tests {
+		if share := getPriorityShare(test.metaData, test.count); share != test.expected {
+			t.Errorf("getPriorityShare(%s, %d) returned %d instead of %d", test.metaData.ObjectID, test.count, share, test.expected)
+		}
+	}
+
+	// The normal priority object resends only its first chunk while the high priority object is received
+	if offsets := getOffsetsToResend(notification, normal); len(offsets) != 1 || offsets[0] != 0 {
+		t.Errorf("getOffsetsToResend returned %v instead of [0]", offsets)
+	}
+
+	notificationLock.Lock()
+	delete(notificationChunks, highID)
+	notificationLock.Unlock()
+	if offsets := getOffsetsToResend(notification, normal); len(offsets) != 4 {
+		t.Errorf("getOffsetsToResend returned %d offsets instead of 4 after the high priority transfer", len(offsets))
+	}
+}
+
+func TestHandleUpdateMaxObjectSize(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	maxObjectSize := common.Configuration.MaxObjectSize
+	defer func() { common.Configuration.MaxObjectSize = maxObjectSize }()
+	common.Configuration.MaxObjectSize = 1024 * 1024
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	// The bitmap of received chunks of this object would take 32GB
+	metaData := common.MetaData{ObjectID: "huge", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 1 << 48, ChunkSize: 1024, InstanceID: 10, DataID: 10}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err = handleUpdate(metaData, 10)
+	runtime.ReadMemStats(&after)
+	if err == nil || !IsInvalidData(err) {
+		t.Errorf("handleUpdate didn't reject an object larger than MaxObjectSize")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1024*1024 {
+		t.Errorf("handleUpdate allocated %d bytes for a rejected object", allocated)
+	}
+
+	if storedMetaData, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil || storedMetaData != nil {
+		t.Errorf("The rejected object was stored")
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	_, ok := notificationChunks[id]
+	notificationLock.RUnlock()
+	if ok {
+		t.Errorf("Chunks info was created for the rejected object")
+	}
+
+	// Objects within the limit are accepted
+	metaData.ObjectID = "small"
+	metaData.ObjectSize = 4096
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate failed. Error: %s", err.Error())
+	}
+}
+
+func TestHandleUpdateMaxChunkBitmapSize(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	maxObjectSize := common.Configuration.MaxObjectSize
+	threshold := common.Configuration.ChunkIntervalSetThreshold
+	maxBitmapSize := common.Configuration.MaxChunkBitmapSize
+	defer func() {
+		common.Configuration.MaxObjectSize = maxObjectSize
+		common.Configuration.ChunkIntervalSetThreshold = threshold
+		common.Configuration.MaxChunkBitmapSize = maxBitmapSize
+	}()
+	common.Configuration.MaxObjectSize = 0
+	common.Configuration.ChunkIntervalSetThreshold = 0
+	common.Configuration.MaxChunkBitmapSize = 1024
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	// With a chunk size of one byte, the bitmap of received chunks of this object would take 128KB
+	metaData := common.MetaData{ObjectID: "tiny-chunks", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 1024 * 1024, ChunkSize: 1, InstanceID: 10, DataID: 10}
+	if err := handleUpdate(metaData, 10); err == nil || !IsInvalidData(err) {
+		t.Errorf("handleUpdate didn't reject an object whose bitmap exceeds MaxChunkBitmapSize")
+	}
+	if storedMetaData, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil || storedMetaData != nil {
+		t.Errorf("The rejected object was stored")
+	}
+	if err := updateGetDataNotification(metaData, metaData.OriginType, metaData.OriginID, 0); err == nil || !IsInvalidData(err) {
+		t.Errorf("updateGetDataNotification didn't fail for an object whose bitmap exceeds MaxChunkBitmapSize")
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	notificationLock.RLock()
+	_, ok := notificationChunks[id]
+	notificationLock.RUnlock()
+	if ok {
+		t.Errorf("Chunks info was created for the rejected object")
+	}
+
+	// The set of intervals that tracks the chunks of large objects isn't limited
+	common.Configuration.ChunkIntervalSetThreshold = 1024
+	if reason := checkChunkBitmapSize(metaData); reason != "" {
+		t.Errorf("checkChunkBitmapSize rejected an object tracked by a set of intervals: %s", reason)
+	}
+	common.Configuration.ChunkIntervalSetThreshold = 0
+
+	// The same object with a larger chunk size is accepted
+	metaData.ObjectID = "large-chunks"
+	metaData.ChunkSize = 1024
+	if size := chunkBitmapSize(metaData); size != 129 {
+		t.Errorf("chunkBitmapSize returned %d instead of 129", size)
+	}
+	if err := handleUpdate(metaData, 10); err != nil {
+		t.Errorf("handleUpdate failed. Error: %s", err.Error())
+	}
+}
+
+func TestValidateDataMessage(t *testing.T) {
+	metaData := common.MetaData{ObjectID: "validate", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 20}
+	message, err := buildDataMessage(metaData, []byte("hello"), 5, 0)
+	if err != nil {
+		t.Errorf("Failed to build data message. Error: %s", err.Error())
+		return
+	}
+	if err := ValidateDataMessage(message); err != nil {
+		t.Errorf("ValidateDataMessage failed for a valid message. Error: %s", err.Error())
+	}
+
+	badMagic := make([]byte, len(message))
+	copy(badMagic, message)
+	badMagic[0]++
+
+	tests := []struct {
+		name     string
+		message  []byte
+		field    string
+		expected int64
+		actual   int64
+	}{
+		{"empty", []byte{}, "magic", 4, 0},
+		{"bad magic", badMagic, "magic", int64(common.Magic), int64(common.Magic) + 1<<24},
+		{"truncated field length", message[:20], "orgID length", 4, 0},
+		{"truncated org ID", message[:26], "orgID", 7, 2},
+		{"truncated data", message[:len(message)-3], "data", 5, 2},
+	}
+
+	for _, row := range tests {
+		err := ValidateDataMessage(row.message)
+		if err == nil {
+			t.Errorf("ValidateDataMessage accepted a message with %s", row.name)
+			continue
+		}
+		diagnostic, ok := err.(*DataMessageError)
+		if !ok {
+			t.Errorf("ValidateDataMessage returned %T instead of *DataMessageError for a message with %s", err, row.name)
+			continue
+		}
+		if diagnostic.Field != row.field || diagnostic.Expected != row.expected || diagnostic.Actual != row.actual {
+			t.Errorf("Wrong diagnostic for a message with %s: field=%s expected=%d actual=%d instead of field=%s expected=%d actual=%d",
+				row.name, diagnostic.Field, diagnostic.Expected, diagnostic.Actual, row.field, row.expected, row.actual)
+		}
+	}
+}
+
+func TestDataMessageByteOrder(t *testing.T) {
+	metaData := common.MetaData{ObjectID: "order", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 20}
+	for _, byteOrder := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		message, err := buildDataMessageWithByteOrder(metaData, []byte("hello"), 5, 10, common.Version, byteOrder)
+		if err != nil {
+			t.Errorf("Failed to build %s data message. Error: %s", byteOrder, err.Error())
+			continue
+		}
+		if len(message) > dataMessageHeaderSize(metaData)+5 {
+			t.Errorf("The %s data message is longer than its estimated size: %d", byteOrder, len(message))
+		}
+		orgID, objectType, objectID, dataReader, dataLength, offset, instanceID, _, _, err := parseDataMessage(message)
+		if err != nil {
+			t.Errorf("Failed to parse %s data message. Error: %s", byteOrder, err.Error())
+			continue
+		}
+		if orgID != metaData.DestOrgID || objectType != metaData.ObjectType || objectID != metaData.ObjectID ||
+			offset != 10 || instanceID != metaData.InstanceID || dataLength != 5 {
+			t.Errorf("Wrong fields in %s data message: %s %s %s offset=%d instanceID=%d dataLength=%d", byteOrder,
+				orgID, objectType, objectID, offset, instanceID, dataLength)
+		}
+		if data, _ := ioutil.ReadAll(dataReader); string(data) != "hello" {
+			t.Errorf("Wrong data in %s data message: %s", byteOrder, string(data))
+		}
+	}
+}
+
+func TestDataMessageFieldOrder(t *testing.T) {
+	header := []byte{1, 1, 1, 1, // magic
+		0, 0, 0, byte(common.Version.Major),
+		0, 0, 0, byte(common.Version.Minor),
+	}
+	// The data field is the first field, followed by an unknown field
+	reordered := append(append([]byte{}, header...),
+		0, 0, 0, 7,
+		0, 0, 0, dataField, 0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o',
+		0, 0, 0, 99, 0, 0, 0, 2, 'x', 'y',
+		0, 0, 0, instanceIDField, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 12,
+		0, 0, 0, objectIDField, 0, 0, 0, 1, '1',
+		0, 0, 0, offsetField, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 10,
+		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
+		0, 0, 0, orgIDField, 0, 0, 0, 7, 's', 'o', 'm', 'e', 'o', 'r', 'g',
+	)
+	orgID, objectType, objectID, dataReader, dataLength, offset, instanceID, _, _, err := parseDataMessage(reordered)
+	if err != nil {
+		t.Errorf("Failed to parse a data message with reordered fields. Error: %s", err.Error())
+		return
+	}
+	if orgID != "someorg" || objectType != "type1" || objectID != "1" || offset != 10 || instanceID != 12 || dataLength != 5 {
+		t.Errorf("Wrong fields in a data message with reordered fields: %s %s %s offset=%d instanceID=%d dataLength=%d",
+			orgID, objectType, objectID, offset, instanceID, dataLength)
+	}
+	if data, _ := ioutil.ReadAll(dataReader); string(data) != "hello" {
+		t.Errorf("Wrong data in a data message with reordered fields: %s", string(data))
+	}
+
+	// A data message without a data field is rejected
+	noData := append(append([]byte{}, header...),
+		0, 0, 0, 2,
+		0, 0, 0, objectIDField, 0, 0, 0, 1, '1',
+		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
+	)
+	err = ValidateDataMessage(noData)
+	if diagnostic, ok := err.(*DataMessageError); !ok || diagnostic.Field != "data" {
+		t.Errorf("ValidateDataMessage didn't reject a data message without data. Error: %v", err)
+	}
+}
+
+func setUpStorage(storageType string) (storage.Storage, error) {
+	var store storage.Storage
+	if storageType == common.InMemory {
+		store = &storage.Cache{Store: &storage.InMemoryStorage{}}
+	} else if storageType == common.Bolt {
+		dir, _ := os.Getwd()
+		common.Configuration.PersistenceRootPath = dir + "/persist"
+		boltStore := &storage.BoltStorage{}
+		boltStore.Cleanup(true)
+		store = &storage.Cache{Store: boltStore}
+	} else {
+		common.Configuration.MongoDbName = "d_test_db"
+		store = &storage.Cache{Store: &storage.MongoStorage{}}
+	}
+	if err := store.Init(); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to initialize storage driver. Error: %s\n", err.Error())}
 	}
 	return store, nil
 }
+
+func TestGetChunkRanges(t *testing.T) {
+	metaData := common.MetaData{ObjectID: "ranges", ObjectType: "type1", DestOrgID: "someorg", ObjectSize: 100, ChunkSize: 10}
+	tests := []struct {
+		offsets  []int64
+		expected []chunkRange
+	}{
+		{[]int64{}, []chunkRange{}},
+		{[]int64{30}, []chunkRange{{30, 1}}},
+		// Consecutive chunks are requested together, regardless of the order of their offsets
+		{[]int64{20, 0, 10, 50, 60, 90}, []chunkRange{{0, 3}, {50, 2}, {90, 1}}},
+	}
+	for _, test := range tests {
+		if ranges := getChunkRanges(metaData, test.offsets); !reflect.DeepEqual(ranges, test.expected) {
+			t.Errorf("getChunkRanges(%v) returned %v instead of %v", test.offsets, ranges, test.expected)
+		}
+	}
+
+	// Without a chunk size each chunk is requested alone
+	metaData.ChunkSize = 0
+	if ranges := getChunkRanges(metaData, []int64{0, 10}); len(ranges) != 2 {
+		t.Errorf("getChunkRanges returned %v without a chunk size", ranges)
+	}
+}
+
+func TestDataMessageVersion(t *testing.T) {
+	version := common.Version
+	defer func() { common.Version = version }()
+	common.Version = common.SyncServiceVersion{Major: common.MinMessageVersion.Major, Minor: common.MinMessageVersion.Minor + 1}
+
+	metaData := common.MetaData{ObjectID: "version", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 20}
+	tests := []struct {
+		version   common.SyncServiceVersion
+		supported bool
+	}{
+		{common.MinMessageVersion, true},
+		{common.Version, true},
+		{common.SyncServiceVersion{Major: common.Version.Major, Minor: common.Version.Minor + 1}, false},
+		{common.SyncServiceVersion{Major: common.Version.Major + 1}, false},
+	}
+	for _, test := range tests {
+		message, err := buildDataMessageWithByteOrder(metaData, []byte("hello"), 5, 0, test.version, binary.BigEndian)
+		if err != nil {
+			t.Errorf("Failed to build data message. Error: %s", err.Error())
+			continue
+		}
+		if err := ValidateDataMessage(message); test.supported && err != nil {
+			t.Errorf("Data message of version %v wasn't accepted. Error: %s", test.version, err.Error())
+		} else if !test.supported && err == nil {
+			t.Errorf("Data message of unsupported version %v was accepted", test.version)
+		}
+	}
+
+	// The version negotiated with a destination is the older of the versions
+	dest := common.Destination{DestOrgID: "someorg", DestType: "device", DestID: "dev1", CodeVersion: "1.0"}
+	if negotiated := negotiateDestinationMessageVersion(dest); negotiated != common.MinMessageVersion {
+		t.Errorf("Negotiated message version %v instead of %v", negotiated, common.MinMessageVersion)
+	}
+	dest.CodeVersion = "9.9"
+	if negotiated := negotiateDestinationMessageVersion(dest); negotiated != common.Version {
+		t.Errorf("Negotiated message version %v instead of %v", negotiated, common.Version)
+	}
+	dest.CodeVersion = ""
+	if negotiated := negotiateDestinationMessageVersion(dest); negotiated != common.MinMessageVersion {
+		t.Errorf("Negotiated message version %v instead of %v for a destination without a code version", negotiated,
+			common.MinMessageVersion)
+	}
+}
+
+// Data messages of 4KB chunks, built in pooled buffers as they are sent
+func BenchmarkBuildDataMessage(b *testing.B) {
+	metaData := common.MetaData{ObjectID: "benchmark", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 20}
+	data := make([]byte, benchmarkChunkSize)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		message := dataMessageBuffers.Get().(*bytes.Buffer)
+		message.Reset()
+		writeDataMessageHeader(message, metaData, len(data), int64(i)*benchmarkChunkSize, common.Version, binary.BigEndian, common.CompressionNone, 0)
+		message.Write(data)
+		dataMessageBuffers.Put(message)
+	}
+}
+
+func BenchmarkParseDataMessage(b *testing.B) {
+	metaData := common.MetaData{ObjectID: "benchmark", ObjectType: "type1", DestOrgID: "someorg", InstanceID: 20}
+	message, err := buildDataMessage(metaData, make([]byte, benchmarkChunkSize), benchmarkChunkSize, 0)
+	if err != nil {
+		b.Fatalf("Failed to build data message. Error: %s", err.Error())
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, _, _, _, _, _, err := parseDataMessage(message); err != nil {
+			b.Fatalf("Failed to parse data message. Error: %s", err.Error())
+		}
+	}
+}
+
+func TestStaleNotificationRecord(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	notificationMaxAge := common.Configuration.NotificationMaxAge
+	defer func() { common.Configuration.NotificationMaxAge = notificationMaxAge }()
+	common.Configuration.NotificationMaxAge = 60
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+	Comm = &TestComm{}
+
+	metaData := common.MetaData{ObjectID: "stale", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		InstanceID: 40}
+	if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	storedMetaData, _ := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if storedMetaData == nil {
+		t.Errorf("Failed to retrieve the stored object")
+		return
+	}
+	instanceID := storedMetaData.InstanceID
+
+	// A record created before the maximal age doesn't match a replayed message
+	notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType, DestOrgID: metaData.DestOrgID,
+		DestID: metaData.DestID, DestType: metaData.DestType, Status: common.Updated, InstanceID: instanceID,
+		CreationTime: time.Now().Unix() - 120}
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+	}
+	if err := handleObjectReceived(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType, metaData.DestID,
+		instanceID, 0); !isIgnoredByHandler(err) {
+		t.Errorf("handleObjectReceived with a stale notification record returned %v", err)
+	}
+	if record, _ := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType,
+		metaData.DestID); record == nil || record.Status != common.Updated {
+		t.Errorf("A stale notification record was updated")
+	}
+
+	// A new record gets its creation time, which is kept while the status of the instance changes
+	notification.CreationTime = 0
+	if err := updateNotificationRecord(notification); err != nil {
+		t.Errorf("updateNotificationRecord failed. Error: %s", err.Error())
+	}
+	record, _ := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType,
+		metaData.DestID)
+	if record == nil || record.CreationTime == 0 {
+		t.Errorf("The creation time of a notification record wasn't set")
+		return
+	}
+	creationTime := record.CreationTime
+	if err := handleObjectReceived(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType, metaData.DestID,
+		instanceID, 0); err != nil {
+		t.Errorf("handleObjectReceived failed. Error: %s", err.Error())
+	}
+	record, _ = Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.DestType,
+		metaData.DestID)
+	if record == nil || record.Status != common.ReceivedByDestination {
+		t.Errorf("The notification record wasn't updated by handleObjectReceived")
+	} else if record.CreationTime != creationTime {
+		t.Errorf("The creation time of the notification record changed from %d to %d", creationTime, record.CreationTime)
+	}
+}
+
+func TestRegistrationResend(t *testing.T) {
+	interval := common.Configuration.RegistrationDebounceInterval
+	defer func() {
+		common.Configuration.RegistrationDebounceInterval = interval
+		registrationResendsLock.Lock()
+		delete(registrationResends, "myorg:device:reg1")
+		registrationResendsLock.Unlock()
+	}()
+	common.Configuration.RegistrationDebounceInterval = 60
+	key := "myorg:device:reg1"
+
+	if !beginRegistrationResend(key, false) {
+		t.Errorf("The first registration didn't resend the notifications")
+	}
+	// Registrations while the notifications are resent are coalesced into one more resend
+	if beginRegistrationResend(key, false) || beginRegistrationResend(key, true) {
+		t.Errorf("A registration resent the notifications while they were resent")
+	}
+	if again, resendReceivedObjects := endRegistrationResend(key, false); !again || !resendReceivedObjects {
+		t.Errorf("The coalesced registrations didn't resend the notifications again, again: %t, received objects: %t",
+			again, resendReceivedObjects)
+	}
+	if again, _ := endRegistrationResend(key, false); again {
+		t.Errorf("The notifications were resent again without a registration")
+	}
+
+	// Within the debounce interval only the registrations of a destination that lost its objects resend the notifications
+	if beginRegistrationResend(key, false) {
+		t.Errorf("A registration within the debounce interval resent the notifications")
+	}
+	if !beginRegistrationResend(key, true) {
+		t.Errorf("A registration of a destination that lost its objects didn't resend the notifications")
+	}
+
+	// A failed resend doesn't delay the next registration
+	endRegistrationResend(key, true)
+	if !beginRegistrationResend(key, false) {
+		t.Errorf("The registration after a failed resend didn't resend the notifications")
+	}
+	endRegistrationResend(key, false)
+
+	common.Configuration.RegistrationDebounceInterval = 0
+	if !beginRegistrationResend(key, false) {
+		t.Errorf("A registration without a debounce interval didn't resend the notifications")
+	}
+	endRegistrationResend(key, false)
+}
+
+func TestObjectPartiallyConsumed(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.CSS
+
+	store, err := setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+	Comm = &TestComm{}
+
+	dest := common.Destination{DestOrgID: "someorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := Store.StoreDestination(dest); err != nil {
+		t.Errorf("Failed to store destination. Error: %s", err.Error())
+	}
+	metaData := common.MetaData{ObjectID: "partial", ObjectType: "type1", DestOrgID: dest.DestOrgID, DestType: dest.DestType,
+		DestID: dest.DestID, ObjectSize: 100}
+	if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	storedMetaData, _ := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if storedMetaData == nil {
+		t.Errorf("Failed to retrieve the stored object")
+		return
+	}
+	instanceID := storedMetaData.InstanceID
+	notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType, DestOrgID: metaData.DestOrgID,
+		DestID: dest.DestID, DestType: dest.DestType, Status: common.Updated, InstanceID: instanceID}
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+	}
+
+	consumedOffset := func() int64 {
+		dests, err := Store.GetObjectDestinationsList(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || len(dests) != 1 {
+			t.Errorf("GetObjectDestinationsList failed. Error: %v", err)
+			return -1
+		}
+		return dests[0].ConsumedOffset
+	}
+
+	tests := []struct {
+		offset     int64
+		instanceID int64
+		expected   int64
+	}{
+		{40, instanceID, 40},
+		// The consumed offset doesn't go back
+		{20, instanceID, 40},
+		{100, instanceID, 100},
+		// A notification of another instance is ignored
+		{100, instanceID + 1, 100},
+	}
+	for _, test := range tests {
+		err := handleObjectPartiallyConsumed(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dest.DestType, dest.DestID,
+			test.instanceID, 0, test.offset)
+		if test.instanceID != instanceID {
+			if !isIgnoredByHandler(err) {
+				t.Errorf("handleObjectPartiallyConsumed of another instance returned %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("handleObjectPartiallyConsumed failed (offset = %d). Error: %s", test.offset, err.Error())
+		}
+		if offset := consumedOffset(); offset != test.expected {
+			t.Errorf("Wrong consumed offset after offset %d: %d instead of %d", test.offset, offset, test.expected)
+		}
+	}
+
+	if err := handleObjectPartiallyConsumed(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dest.DestType, dest.DestID,
+		instanceID, 0, 101); !IsInvalidData(err) {
+		t.Errorf("handleObjectPartiallyConsumed with an offset beyond the object's size returned %v", err)
+	}
+
+	// Once the object was consumed, partial consumption is ignored
+	notification.Status = common.ConsumedByDestination
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s", err.Error())
+	}
+	if err := handleObjectPartiallyConsumed(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dest.DestType, dest.DestID,
+		instanceID, 0, 50); !isIgnoredByHandler(err) {
+		t.Errorf("handleObjectPartiallyConsumed of a consumed object returned %v", err)
+	}
+}
@@ -1,7 +1,11 @@
 package communications
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -282,3 +286,558 @@ func TestActivateObjects(t *testing.T) {
 		t.Errorf("RetrieveObjects returned %d objects instead of 3\n", len(objects))
 	}
 }
+
+func TestWebhookRetry(t *testing.T) {
+	maxAttempts := common.Configuration.WebhookMaxAttempts
+	retryInterval := common.Configuration.WebhookRetryInterval
+	deadLetter := common.Configuration.WebhookDeadLetter
+	defer func() {
+		common.Configuration.WebhookMaxAttempts = maxAttempts
+		common.Configuration.WebhookRetryInterval = retryInterval
+		common.Configuration.WebhookDeadLetter = deadLetter
+	}()
+	common.Configuration.WebhookMaxAttempts = 3
+	common.Configuration.WebhookRetryInterval = 60
+	common.Configuration.WebhookDeadLetter = false
+
+	var err error
+	Store, err = setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	var calls int32
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "webhooktype", DestOrgID: "myorg"}
+	if err := Store.AddWebhook(metaData.DestOrgID, metaData.ObjectType, server.URL); err != nil {
+		t.Errorf("AddWebhook failed. Error: %s", err.Error())
+	}
+
+	// The failed call is kept for a retry
+	callWebhooks(&metaData)
+	deliveries, err := Store.RetrieveWebhookDeliveries(false)
+	if err != nil {
+		t.Errorf("RetrieveWebhookDeliveries failed. Error: %s", err.Error())
+	} else if len(deliveries) != 1 || deliveries[0].Attempts != 1 {
+		t.Errorf("Failed webhook call wasn't stored for a retry")
+	}
+
+	// The retry is not due yet
+	RetryWebhooks()
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Webhook was retried before the backoff expired")
+	}
+
+	// Fail again, then succeed
+	makeWebhookDeliveriesDue(t)
+	RetryWebhooks()
+	if deliveries, _ := Store.RetrieveWebhookDeliveries(false); len(deliveries) != 1 || deliveries[0].Attempts != 2 {
+		t.Errorf("Failed webhook retry wasn't rescheduled")
+	} else if backoff := time.Until(deliveries[0].NextAttempt); backoff < 110*time.Second {
+		t.Errorf("Webhook retry backoff wasn't doubled: %s", backoff)
+	}
+	atomic.StoreInt32(&failing, 0)
+	makeWebhookDeliveriesDue(t)
+	RetryWebhooks()
+	if deliveries, _ := Store.RetrieveWebhookDeliveries(false); len(deliveries) != 0 {
+		t.Errorf("Successful webhook retry wasn't removed")
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Webhook was called %d times instead of 3", atomic.LoadInt32(&calls))
+	}
+
+	// A call that fails WebhookMaxAttempts times is dead-lettered
+	atomic.StoreInt32(&failing, 1)
+	common.Configuration.WebhookMaxAttempts = 1
+	common.Configuration.WebhookDeadLetter = true
+	callWebhooks(&metaData)
+	if deliveries, _ := Store.RetrieveWebhookDeliveries(false); len(deliveries) != 0 {
+		t.Errorf("Webhook call was retried after WebhookMaxAttempts attempts")
+	}
+	if deliveries, _ := Store.RetrieveWebhookDeliveries(true); len(deliveries) != 1 {
+		t.Errorf("Webhook call wasn't dead-lettered")
+	} else if err := Store.DeleteWebhookDelivery(deliveries[0]); err != nil {
+		t.Errorf("DeleteWebhookDelivery failed. Error: %s", err.Error())
+	}
+}
+
+func makeWebhookDeliveriesDue(t *testing.T) {
+	deliveries, err := Store.RetrieveWebhookDeliveries(false)
+	if err != nil {
+		t.Errorf("RetrieveWebhookDeliveries failed. Error: %s", err.Error())
+		return
+	}
+	for _, delivery := range deliveries {
+		delivery.NextAttempt = time.Now().Add(-time.Second)
+		if err := Store.StoreWebhookDelivery(delivery); err != nil {
+			t.Errorf("StoreWebhookDelivery failed. Error: %s", err.Error())
+		}
+	}
+}
+
+// failingDeleteStore fails to remove objects until it is told to succeed
+type failingDeleteStore struct {
+	storage.Storage
+	failing bool
+}
+
+func (store *failingDeleteStore) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if store.failing {
+		return &Error{"Transient storage error"}
+	}
+	return store.Storage.DeleteStoredObject(orgID, objectType, objectID)
+}
+
+func TestObjectCleanupRetry(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	common.InitObjectLocks()
+	savedStore := Store
+	defer func() { Store = savedStore }()
+
+	memoryStore, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer memoryStore.Stop()
+	store := &failingDeleteStore{Storage: memoryStore, failing: true}
+	Store = store
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "cleanuptype", DestOrgID: "myorg", NoData: true, InstanceID: 1}
+	if _, err := Store.StoreObject(metaData, nil, common.ObjConsumed); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+
+	// The failed removal is queued, and retried until it succeeds
+	deleteStoredObjectWithRetry(metaData)
+	if cleanups, err := Store.RetrieveObjectCleanups(); err != nil {
+		t.Errorf("RetrieveObjectCleanups failed. Error: %s", err.Error())
+	} else if len(cleanups) != 1 || cleanups[0].Attempts != 1 {
+		t.Errorf("Failed removal wasn't queued for a retry")
+	}
+	RetryObjectCleanups()
+	if cleanups, _ := Store.RetrieveObjectCleanups(); len(cleanups) != 1 || cleanups[0].Attempts != 2 {
+		t.Errorf("Failed removal retry wasn't queued again")
+	}
+	store.failing = false
+	RetryObjectCleanups()
+	if cleanups, _ := Store.RetrieveObjectCleanups(); len(cleanups) != 0 {
+		t.Errorf("Successful removal retry wasn't removed from the queue")
+	}
+	if stored, _ := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); stored != nil {
+		t.Errorf("The object wasn't removed by the retry")
+	}
+
+	// A queued removal doesn't remove a new instance of the object
+	store.failing = true
+	if _, err := Store.StoreObject(metaData, nil, common.ObjConsumed); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	deleteStoredObjectWithRetry(metaData)
+	newInstance := metaData
+	newInstance.InstanceID = 2
+	if _, err := Store.StoreObject(newInstance, nil, common.ObjReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	store.failing = false
+	RetryObjectCleanups()
+	if cleanups, _ := Store.RetrieveObjectCleanups(); len(cleanups) != 0 {
+		t.Errorf("Stale removal wasn't removed from the queue")
+	}
+	if stored, _ := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); stored == nil ||
+		stored.InstanceID != newInstance.InstanceID {
+		t.Errorf("The new instance of the object was removed by a stale removal")
+	}
+}
+
+func TestEvictObjects(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	common.InitObjectLocks()
+	common.Configuration.InMemoryMaxDataSizeKB = 1
+	defer func() { common.Configuration.InMemoryMaxDataSizeKB = 0 }()
+	savedStore := Store
+	defer func() { Store = savedStore }()
+
+	var err error
+	Store, err = setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	data := make([]byte, 1024)
+	received := common.MetaData{ObjectID: "1", ObjectType: "evicttype", DestOrgID: "myorg", OriginType: "type2", OriginID: "123",
+		ObjectSize: 1024, InstanceID: 1}
+	if _, err := Store.StoreObject(received, data, common.ObjReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	notification := common.Notification{ObjectID: received.ObjectID, ObjectType: received.ObjectType, DestOrgID: received.DestOrgID,
+		DestType: received.OriginType, DestID: received.OriginID, Status: common.AckReceived, InstanceID: received.InstanceID}
+	if err := Store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("Failed to store notification record. Error: %s", err.Error())
+	}
+	partial := common.MetaData{ObjectID: "2", ObjectType: "evicttype", DestOrgID: "myorg", OriginType: "type2", OriginID: "123",
+		ObjectSize: 2048, ChunkSize: 1024, InstanceID: 1}
+	if _, err := Store.StoreObject(partial, data, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if err := updateNotificationChunkInfo(true, partial, partial.OriginType, partial.OriginID, 1024); err != nil {
+		t.Errorf("Failed to update chunks info. Error: %s", err.Error())
+	}
+	defer removeNotificationChunksInfo(partial, partial.OriginType, partial.OriginID)
+
+	// The received object is removed with its notification record, the object that is being received is kept
+	EvictObjects()
+	if stored, _ := Store.RetrieveObject(received.DestOrgID, received.ObjectType, received.ObjectID); stored != nil {
+		t.Errorf("The received object wasn't evicted")
+	}
+	if stored, _ := Store.RetrieveNotificationRecord(received.DestOrgID, received.ObjectType, received.ObjectID,
+		received.OriginType, received.OriginID); stored != nil {
+		t.Errorf("The notification record of the evicted object wasn't removed")
+	}
+	if stored, _ := Store.RetrieveObject(partial.DestOrgID, partial.ObjectType, partial.ObjectID); stored == nil {
+		t.Errorf("The object that is being received was evicted")
+	}
+	id := common.CreateNotificationID(partial.DestOrgID, partial.ObjectType, partial.ObjectID, partial.OriginType, partial.OriginID)
+	notificationLock.RLock()
+	_, ok := notificationChunks[id]
+	notificationLock.RUnlock()
+	if !ok {
+		t.Errorf("The chunks info of the object that is being received was removed")
+	}
+}
+
+func TestDeletionWebhooks(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	var err error
+	Store, err = setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	calls := make(chan common.MetaData, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var metaData common.MetaData
+		json.NewDecoder(request.Body).Decode(&metaData)
+		if request.URL.Path == "/updated" {
+			metaData.ObjectType = "updated"
+		}
+		calls <- metaData
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "deletiontype", DestOrgID: "myorg", OriginType: "type2",
+		OriginID: "2", InstanceID: 5, Deleted: true}
+	if err := Store.AddWebhook(metaData.DestOrgID, metaData.ObjectType, server.URL+"/updated"); err != nil {
+		t.Errorf("AddWebhook failed. Error: %s", err.Error())
+	}
+	if err := Store.AddWebhook(metaData.DestOrgID, common.DeletionWebhooksKey(metaData.ObjectType), server.URL+"/deleted"); err != nil {
+		t.Errorf("AddWebhook failed. Error: %s", err.Error())
+	}
+	if _, err := Store.StoreObject(metaData, nil, common.ObjDeleted); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if err := Store.UpdateNotificationRecord(common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
+		DestOrgID: metaData.DestOrgID, DestID: metaData.OriginID, DestType: metaData.OriginType, Status: common.Deleted,
+		InstanceID: metaData.InstanceID}); err != nil {
+		t.Errorf("Failed to store notification record. Error: %s", err.Error())
+	}
+
+	// The deletion webhook is called with the object's meta data once the object is removed
+	if err := handleAckObjectDeleted(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType,
+		metaData.OriginID, metaData.InstanceID); err != nil {
+		t.Errorf("handleAckObjectDeleted failed. Error: %s", err.Error())
+	}
+	select {
+	case called := <-calls:
+		if called.ObjectType != metaData.ObjectType || called.ObjectID != metaData.ObjectID || !called.Deleted {
+			t.Errorf("The deletion webhook was called with wrong meta data: %+v", called)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("The deletion webhook wasn't called")
+	}
+
+	// A repeated ack doesn't call the webhook again
+	if err := handleAckObjectDeleted(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType,
+		metaData.OriginID, metaData.InstanceID); err == nil {
+		t.Errorf("handleAckObjectDeleted of a removed object didn't fail")
+	}
+	select {
+	case called := <-calls:
+		t.Errorf("A webhook was called again for the same deletion: %+v", called)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The webhook of a type that has none for deletions isn't called
+	metaData.ObjectType = "othertype"
+	if _, err := Store.StoreObject(metaData, nil, common.ObjDeleted); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if err := DeleteStoredObject(metaData); err != nil {
+		t.Errorf("DeleteStoredObject failed. Error: %s", err.Error())
+	}
+	select {
+	case called := <-calls:
+		t.Errorf("A webhook was called for a type without deletion webhooks: %+v", called)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDeleteObjectsWithFilter(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup(true)
+	Store = boltStore
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start MQTT communication. Error: %s", err.Error())
+	}
+	common.InitObjectLocks()
+
+	dest := common.Destination{DestOrgID: "myorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s\n", err.Error())
+	}
+
+	objects := []common.MetaData{
+		common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device", NoData: true},
+		common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device", NoData: true},
+		common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device", NoData: true},
+		common.MetaData{ObjectID: "4", ObjectType: "type2", DestOrgID: "myorg", DestID: "dev1", DestType: "device", NoData: true},
+	}
+	for _, metaData := range objects {
+		if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", metaData.ObjectID, err.Error())
+		}
+	}
+	for _, objectID := range []string{"1", "3"} {
+		if _, err := Store.UpdateObjectDeliveryStatus(common.Delivered, "", "myorg", "type1", objectID, "device", "dev1"); err != nil {
+			t.Errorf("Failed to update delivery status (objectID = %s). Error: %s\n", objectID, err.Error())
+		}
+	}
+
+	if count, err := DeleteObjectsWithFilter("myorg", "type1", "", "", ""); err != nil {
+		t.Errorf("DeleteObjectsWithFilter failed. Error: %s\n", err.Error())
+	} else if count != 3 {
+		t.Errorf("DeleteObjectsWithFilter marked %d objects instead of 3\n", count)
+	}
+
+	// The delivered objects are marked as deleted and their destination is notified, the others are removed
+	for _, objectID := range []string{"1", "3"} {
+		if status, err := Store.RetrieveObjectStatus("myorg", "type1", objectID); err != nil || status != common.ObjDeleted {
+			t.Errorf("The status of object %s is %s instead of %s\n", objectID, status, common.ObjDeleted)
+		}
+		notification, err := Store.RetrieveNotificationRecord("myorg", "type1", objectID, "device", "dev1")
+		if err != nil || notification == nil || notification.Status != common.Delete {
+			t.Errorf("No delete notification for object %s\n", objectID)
+		}
+	}
+	if metaData, err := Store.RetrieveObject("myorg", "type1", "2"); err != nil || metaData != nil {
+		t.Errorf("Undelivered object wasn't removed\n")
+	}
+	if status, err := Store.RetrieveObjectStatus("myorg", "type2", "4"); err != nil || status != common.ReadyToSend {
+		t.Errorf("The status of the unmatched object is %s instead of %s\n", status, common.ReadyToSend)
+	}
+	if pending, err := Store.RetrieveObjectsPendingDeletion(); err != nil || len(pending) != 0 {
+		t.Errorf("RetrieveObjectsPendingDeletion returned %d objects after the deletion\n", len(pending))
+	}
+
+	// An interrupted deletion is resumed
+	if count, err := Store.DeleteObjectsWithFilter("myorg", "", "device", "dev1", ""); err != nil || count != 1 {
+		t.Errorf("Store.DeleteObjectsWithFilter marked %d objects instead of 1\n", count)
+	}
+	if pending, err := Store.RetrieveObjectsPendingDeletion(); err != nil || len(pending) != 1 {
+		t.Errorf("RetrieveObjectsPendingDeletion returned %d objects instead of 1\n", len(pending))
+	}
+	DeletePendingObjects()
+	if metaData, err := Store.RetrieveObject("myorg", "type2", "4"); err != nil || metaData != nil {
+		t.Errorf("The pending object wasn't removed\n")
+	}
+}
+
+func TestRequiredObjectVersion(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup(true)
+	Store = boltStore
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start MQTT communication. Error: %s", err.Error())
+	}
+	common.InitObjectLocks()
+
+	destinations := []common.Destination{
+		common.Destination{DestOrgID: "versionorg", DestType: "device", DestID: "old", Communication: common.MQTTProtocol},
+		common.Destination{DestOrgID: "versionorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol,
+			MaxObjectVersion: "1.5"},
+		common.Destination{DestOrgID: "versionorg", DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol,
+			MaxObjectVersion: "2.1"},
+	}
+	for _, dest := range destinations {
+		if err := handleRegisterNew(dest, false); err != nil {
+			t.Errorf("handleRegisterNew failed. Error: %s\n", err.Error())
+		}
+	}
+
+	tests := []struct {
+		metaData     common.MetaData
+		destinations []string
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "versionorg", DestType: "device", NoData: true},
+			[]string{"dev1", "dev2", "old"}},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "versionorg", DestType: "device", NoData: true,
+			RequiredVersion: "1.5"}, []string{"dev1", "dev2"}},
+		{common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "versionorg", DestType: "device", NoData: true,
+			RequiredVersion: "2.0"}, []string{"dev2"}},
+	}
+	for _, test := range tests {
+		if _, err := Store.StoreObject(test.metaData, nil, common.ReadyToSend); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+			continue
+		}
+		notifications, err := PrepareObjectNotifications(test.metaData)
+		if err != nil {
+			t.Errorf("PrepareObjectNotifications failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+			continue
+		}
+		sent := make(map[string]bool)
+		for _, notification := range notifications {
+			sent[notification.DestID] = true
+		}
+		if len(sent) != len(test.destinations) {
+			t.Errorf("Prepared %d notifications instead of %d (objectID = %s)\n", len(sent), len(test.destinations), test.metaData.ObjectID)
+		}
+		for _, destID := range test.destinations {
+			if !sent[destID] {
+				t.Errorf("No notification was prepared for %s (objectID = %s)\n", destID, test.metaData.ObjectID)
+			}
+		}
+
+		// The delivery to the destinations that can't use the object failed
+		statuses, err := Store.GetObjectDestinationsList("versionorg", "type1", test.metaData.ObjectID)
+		if err != nil {
+			t.Errorf("GetObjectDestinationsList failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+		for _, status := range statuses {
+			if !sent[status.Destination.DestID] && (status.Status != common.Error || status.Message == "") {
+				t.Errorf("The delivery status for %s is %s instead of %s (objectID = %s)\n", status.Destination.DestID, status.Status,
+					common.Error, test.metaData.ObjectID)
+			}
+		}
+	}
+}
+
+func TestDestinationAvailableSpace(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup(true)
+	Store = boltStore
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start MQTT communication. Error: %s", err.Error())
+	}
+	common.InitObjectLocks()
+
+	dest := common.Destination{DestOrgID: "spaceorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol,
+		AvailableSpace: 100}
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s\n", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: dest.DestOrgID, DestType: dest.DestType,
+		DestID: dest.DestID, ObjectSize: 200}
+	if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+
+	// The notification of an object that doesn't fit is deferred, the record remains pending
+	notifications, err := PrepareObjectNotifications(metaData)
+	if err != nil {
+		t.Errorf("PrepareObjectNotifications failed. Error: %s\n", err.Error())
+	} else if err := SendNotifications(notifications); err != nil {
+		t.Errorf("SendNotifications failed. Error: %s\n", err.Error())
+	}
+	if notification, err := Store.RetrieveNotificationRecord(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		dest.DestType, dest.DestID); err != nil || notification == nil || notification.Status != common.Update {
+		t.Errorf("No pending update notification record for the destination without space")
+	}
+	statuses, err := Store.GetObjectDestinationsList(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || len(statuses) != 1 {
+		t.Errorf("GetObjectDestinationsList failed. Error: %v\n", err)
+	} else if statuses[0].Status != common.Pending || statuses[0].Message == "" {
+		t.Errorf("Wrong delivery status: %s (%s) instead of pending with a reason\n", statuses[0].Status, statuses[0].Message)
+	}
+
+	// A heartbeat reports more space, the object fits
+	dest.AvailableSpace = 1000
+	if err := handleHeartbeat(dest); err != nil {
+		t.Errorf("handleHeartbeat failed. Error: %s\n", err.Error())
+	}
+	if stored, err := Store.RetrieveDestination(dest.DestOrgID, dest.DestType, dest.DestID); err != nil || stored == nil ||
+		stored.AvailableSpace != 1000 {
+		t.Errorf("The destination's available space wasn't updated")
+	}
+	if reason := insufficientDestinationSpace(&metaData, dest.DestType, dest.DestID); reason != "" {
+		t.Errorf("The object doesn't fit after the destination reported more space: %s\n", reason)
+	}
+
+	// Once the object is sent the reason is cleared
+	if _, err := PrepareObjectNotifications(metaData); err != nil {
+		t.Errorf("PrepareObjectNotifications failed. Error: %s\n", err.Error())
+	}
+	statuses, err = Store.GetObjectDestinationsList(dest.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || len(statuses) != 1 {
+		t.Errorf("GetObjectDestinationsList failed. Error: %v\n", err)
+	} else if statuses[0].Status != common.Delivering || statuses[0].Message != "" {
+		t.Errorf("Wrong delivery status: %s (%s) instead of delivering\n", statuses[0].Status, statuses[0].Message)
+	}
+
+	// Destinations that don't report their space get the object
+	dest.DestID = "dev2"
+	dest.AvailableSpace = 0
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s\n", err.Error())
+	}
+	if reason := insufficientDestinationSpace(&metaData, dest.DestType, dest.DestID); reason != "" {
+		t.Errorf("The object doesn't fit in a destination that didn't report its space: %s\n", reason)
+	}
+}
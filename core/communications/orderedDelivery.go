@@ -0,0 +1,177 @@
+package communications
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The objects of the types listed in OrderedObjectTypes are delivered to the applications of each destination in the
+// order in which they were sent. The origin numbers the updates of the objects of such a type that it sends to each
+// destination (the order sequence), and the destination holds a received object until all the updates numbered before it
+// were delivered. Updates that are never delivered (the object was deleted or updated again) leave gaps in the sequence.
+// Every notification of the origin carries the lowest order sequence it still has in flight to the destination (the order
+// base), and the destination doesn't wait for the updates before it.
+
+// orderedDeliveryLock serializes the delivery of held objects. It is always acquired before the objects' locks.
+var orderedDeliveryLock sync.Mutex
+
+// orderSequence returns the order sequence of the notification of the object to the destination, or 0 if the object's
+// type isn't delivered in order. An update is assigned the next order sequence, unless its notification already has one.
+// Must be called while holding the object's lock.
+func orderSequence(topic string, metaData common.MetaData, destType string, destID string) (int64, common.SyncServiceError) {
+	if (topic != common.Update && topic != common.Delete) || !common.IsOrderedObjectType(metaData.ObjectType) {
+		return 0, nil
+	}
+	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
+	if err != nil {
+		return 0, err
+	}
+	if notification != nil && notification.InstanceID == metaData.InstanceID && notification.OrderSequence != 0 {
+		return notification.OrderSequence, nil
+	}
+	if topic != common.Update {
+		return 0, nil
+	}
+	return Store.IncrementOrderSequence(metaData.DestOrgID, metaData.ObjectType, destType, destID)
+}
+
+// isInFlightInOrder returns true if the destination didn't receive the update of the notification yet
+func isInFlightInOrder(status string) bool {
+	return status == common.Update || status == common.UpdatePending || status == common.Updated || status == common.Data
+}
+
+// withOrderSequence returns the meta data to send in the update or delete notification of an object whose type is
+// delivered in order. The meta data is copied, and its OrderSequence (updates only) and OrderBase are set.
+func withOrderSequence(metaData *common.MetaData, destType string, destID string, sequence int64, topic string) *common.MetaData {
+	if metaData == nil {
+		return metaData
+	}
+	if sequence == 0 {
+		if metaData.OrderSequence == 0 && metaData.OrderBase == 0 {
+			return metaData
+		}
+		// The object was received in order from its origin, it isn't sent in order
+		unorderedMetaData := *metaData
+		unorderedMetaData.OrderSequence = 0
+		unorderedMetaData.OrderBase = 0
+		return &unorderedMetaData
+	}
+
+	orderedMetaData := *metaData
+	if topic == common.Update {
+		orderedMetaData.OrderSequence = sequence
+		orderedMetaData.OrderBase = sequence
+	} else {
+		// The deleted object isn't waited for
+		orderedMetaData.OrderSequence = 0
+		orderedMetaData.OrderBase = sequence + 1
+	}
+
+	notifications, err := Store.RetrieveOrderedNotifications(metaData.DestOrgID, metaData.ObjectType, destType, destID)
+	if err != nil {
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to retrieve the ordered notifications of %s:%s for %s %s. Error: %s\n", metaData.DestOrgID,
+				metaData.ObjectType, destType, destID, err)
+		}
+		// The destination doesn't skip any gaps
+		orderedMetaData.OrderBase = 0
+		return &orderedMetaData
+	}
+	for _, notification := range notifications {
+		if notification.OrderSequence < orderedMetaData.OrderBase && isInFlightInOrder(notification.Status) {
+			orderedMetaData.OrderBase = notification.OrderSequence
+		}
+	}
+	return &orderedMetaData
+}
+
+// receivedObjectStatus returns the status of a completely received object, objects delivered in order are held until
+// the objects sent before them are delivered
+func receivedObjectStatus(metaData common.MetaData) string {
+	if metaData.OrderSequence != 0 {
+		return common.HeldInOrder
+	}
+	return common.CompletelyReceived
+}
+
+// deliverReceivedObject delivers the completely received object to the applications, an object delivered in order is
+// delivered along with the held objects that may be delivered.
+// Must be called without holding any object lock.
+func deliverReceivedObject(metaData *common.MetaData) {
+	if metaData.OrderSequence == 0 {
+		callWebhooks(metaData)
+		return
+	}
+	deliverHeldObjects(metaData.DestOrgID, metaData.ObjectType, metaData.OriginType, metaData.OriginID, metaData.OrderBase)
+}
+
+// deliverHeldObjects delivers, in their order, the held objects of the type that were received from the origin and
+// whose preceding objects were delivered. The updates before base aren't waited for.
+// Must be called without holding any object lock.
+func deliverHeldObjects(orgID string, objectType string, originType string, originID string, base int64) {
+	orderedDeliveryLock.Lock()
+	defer orderedDeliveryLock.Unlock()
+
+	if err := deliverHeldObjectsHelper(orgID, objectType, originType, originID, base); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to deliver the held objects of %s:%s. Error: %s\n", orgID, objectType, err)
+	}
+}
+
+func deliverHeldObjectsHelper(orgID string, objectType string, originType string, originID string, base int64) common.SyncServiceError {
+	delivered, err := Store.RetrieveDeliveredOrderSequence(orgID, objectType, originType, originID)
+	if err != nil {
+		return err
+	}
+	initial := delivered
+	if base > delivered+1 {
+		delivered = base - 1
+	}
+
+	heldObjects, err := Store.RetrieveObjectsWithStatus(orgID, objectType, common.HeldInOrder)
+	if err != nil {
+		return err
+	}
+	sort.Slice(heldObjects, func(i, j int) bool { return heldObjects[i].OrderSequence < heldObjects[j].OrderSequence })
+
+	for _, held := range heldObjects {
+		if held.OriginType != originType || held.OriginID != originID {
+			continue
+		}
+		if held.OrderSequence > delivered+1 {
+			break
+		}
+		lockIndex := common.HashStrings(held.DestOrgID, held.ObjectType, held.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		metaData, status, err := Store.RetrieveObjectAndStatus(held.DestOrgID, held.ObjectType, held.ObjectID)
+		if err != nil || metaData == nil || status != common.HeldInOrder || metaData.InstanceID != held.InstanceID {
+			// The object was updated or deleted meanwhile
+			common.ObjectLocks.Unlock(lockIndex)
+			continue
+		}
+		if err := Store.UpdateObjectStatus(held.DestOrgID, held.ObjectType, held.ObjectID, common.CompletelyReceived); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return &Error{fmt.Sprintf("Failed to update the status of %s. Error: %s", held.ObjectID, err)}
+		}
+		common.ObjectLocks.Unlock(lockIndex)
+
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Delivering %s %s, order sequence %d%s\n", held.ObjectType, held.ObjectID, held.OrderSequence,
+				common.TraceIDTag(metaData))
+		}
+		callWebhooks(metaData)
+		if held.OrderSequence > delivered {
+			delivered = held.OrderSequence
+		}
+	}
+
+	if delivered != initial {
+		return Store.UpdateDeliveredOrderSequence(orgID, objectType, originType, originID, delivered)
+	}
+	return nil
+}
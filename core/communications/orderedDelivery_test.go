@@ -0,0 +1,149 @@
+package communications
+
+import (
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestDeliverHeldObjects(t *testing.T) {
+	Comm = &TestComm{}
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	held := func(id string, sequence int64) common.MetaData {
+		metaData := common.MetaData{ObjectID: id, ObjectType: "ordered", DestOrgID: "myorg", NoData: true,
+			OriginType: "device", OriginID: "dev1", InstanceID: sequence, OrderSequence: sequence}
+		if _, err := Store.StoreObject(metaData, nil, receivedObjectStatus(metaData)); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+		}
+		return metaData
+	}
+	checkStatus := func(id string, expected string) {
+		status, err := Store.RetrieveObjectStatus("myorg", "ordered", id)
+		if err != nil {
+			t.Errorf("RetrieveObjectStatus failed. Error: %s", err.Error())
+		} else if status != expected {
+			t.Errorf("The status of %s is %s instead of %s", id, status, expected)
+		}
+	}
+
+	// Objects received before the objects sent before them are held
+	held("obj2", 2)
+	held("obj3", 3)
+	deliverHeldObjects("myorg", "ordered", "device", "dev1", 0)
+	checkStatus("obj2", common.HeldInOrder)
+	checkStatus("obj3", common.HeldInOrder)
+
+	first := held("obj1", 1)
+	first.OrderBase = 1
+	deliverReceivedObject(&first)
+	checkStatus("obj1", common.CompletelyReceived)
+	checkStatus("obj2", common.CompletelyReceived)
+	checkStatus("obj3", common.CompletelyReceived)
+	if delivered, err := Store.RetrieveDeliveredOrderSequence("myorg", "ordered", "device", "dev1"); err != nil || delivered != 3 {
+		t.Errorf("The delivered order sequence is %d instead of 3", delivered)
+	}
+
+	// The objects of other origins are delivered separately
+	other := common.MetaData{ObjectID: "other", ObjectType: "ordered", DestOrgID: "myorg", NoData: true,
+		OriginType: "device", OriginID: "dev2", InstanceID: 2, OrderSequence: 2}
+	Store.StoreObject(other, nil, common.HeldInOrder)
+	deliverHeldObjects("myorg", "ordered", "device", "dev1", 0)
+	checkStatus("other", common.HeldInOrder)
+
+	// The objects don't wait for the updates that were superseded or deleted
+	held("obj5", 5)
+	deliverHeldObjects("myorg", "ordered", "device", "dev1", 0)
+	checkStatus("obj5", common.HeldInOrder)
+	deliverHeldObjects("myorg", "ordered", "device", "dev1", 5)
+	checkStatus("obj5", common.CompletelyReceived)
+
+	// Objects that aren't delivered in order aren't held
+	if status := receivedObjectStatus(common.MetaData{ObjectID: "unordered", ObjectType: "type1"}); status != common.CompletelyReceived {
+		t.Errorf("The status of an unordered object is %s", status)
+	}
+}
+
+func TestWithOrderSequence(t *testing.T) {
+	orderedObjectTypes := common.Configuration.OrderedObjectTypes
+	defer func() {
+		common.Configuration.OrderedObjectTypes = orderedObjectTypes
+	}()
+	common.Configuration.OrderedObjectTypes = "type1, ordered"
+
+	Comm = &TestComm{}
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	metaData := func(id string, instanceID int64) common.MetaData {
+		return common.MetaData{ObjectID: id, ObjectType: "ordered", DestOrgID: "myorg", InstanceID: instanceID}
+	}
+	sequences := make(map[string]int64)
+	for i, id := range []string{"obj1", "obj2", "obj3"} {
+		notificationsInfo, err := prepareNotifications(common.Update, metaData(id, 1),
+			[]common.Destination{{DestOrgID: "myorg", DestType: "device", DestID: "dev1"}})
+		if err != nil || len(notificationsInfo) != 1 {
+			t.Errorf("prepareNotifications failed. Error: %v", err)
+			return
+		}
+		if notificationsInfo[0].OrderSequence != int64(i+1) {
+			t.Errorf("The order sequence of %s is %d instead of %d", id, notificationsInfo[0].OrderSequence, i+1)
+		}
+		sequences[id] = notificationsInfo[0].OrderSequence
+	}
+
+	// The sequence of the same instance is kept
+	notificationsInfo, err := prepareNotifications(common.Update, metaData("obj1", 1),
+		[]common.Destination{{DestOrgID: "myorg", DestType: "device", DestID: "dev1"}})
+	if err != nil || notificationsInfo[0].OrderSequence != sequences["obj1"] {
+		t.Errorf("The order sequence of a resent update changed")
+	}
+
+	// obj1 was received by the destination, obj2 is in flight
+	updateNotificationRecord(common.Notification{ObjectID: "obj1", ObjectType: "ordered", DestOrgID: "myorg",
+		DestType: "device", DestID: "dev1", Status: common.ReceivedByDestination, InstanceID: 1})
+	if notification, _ := Store.RetrieveNotificationRecord("myorg", "ordered", "obj1", "device", "dev1"); notification == nil ||
+		notification.OrderSequence != sequences["obj1"] {
+		t.Errorf("The notification record didn't keep its order sequence")
+	}
+
+	obj3 := metaData("obj3", 1)
+	sent := withOrderSequence(&obj3, "device", "dev1", sequences["obj3"], common.Update)
+	if sent.OrderSequence != sequences["obj3"] || sent.OrderBase != sequences["obj2"] {
+		t.Errorf("Wrong order sequence (%d) or base (%d) of an update", sent.OrderSequence, sent.OrderBase)
+	}
+	if obj3.OrderSequence != 0 {
+		t.Errorf("The order sequence was set in the object's meta data")
+	}
+
+	// The deletion of obj2 isn't waited for
+	notificationsInfo, err = prepareNotifications(common.Delete, metaData("obj2", 1),
+		[]common.Destination{{DestOrgID: "myorg", DestType: "device", DestID: "dev1"}})
+	if err != nil || notificationsInfo[0].OrderSequence != sequences["obj2"] {
+		t.Errorf("The delete notification doesn't have the order sequence of the update")
+		return
+	}
+	deleted := withOrderSequence(notificationsInfo[0].MetaData, "device", "dev1", notificationsInfo[0].OrderSequence, common.Delete)
+	if deleted.OrderSequence != 0 || deleted.OrderBase != sequences["obj3"] {
+		t.Errorf("Wrong order sequence (%d) or base (%d) of a delete", deleted.OrderSequence, deleted.OrderBase)
+	}
+
+	// Objects received in order aren't sent in order by the receiver
+	received := metaData("received", 1)
+	received.OrderSequence = 5
+	received.OrderBase = 4
+	if unordered := withOrderSequence(&received, "device", "dev1", 0, common.Update); unordered.OrderSequence != 0 || unordered.OrderBase != 0 {
+		t.Errorf("The order sequence of a received object was sent")
+	}
+}
@@ -0,0 +1,143 @@
+package communications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// ResendPolicy decides which of the chunks of an object's data that were requested but not received are requested again.
+// It is called by the periodic resend of notifications while the data chunks of the object are locked, with a snapshot
+// of the state of the transfer. Changing the snapshot has no effect on the transfer.
+type ResendPolicy interface {
+	// OffsetsToResend returns the offsets of the chunks to request again. Offsets of chunks that aren't in flight are ignored.
+	OffsetsToResend(snapshot ResendSnapshot) []int64
+}
+
+// ResendSnapshot is a copy of the state of receiving the data of an object from its origin
+type ResendSnapshot struct {
+	Notification common.Notification
+
+	ChunkSize        int
+	DataSize         int64
+	ReceivedDataSize int64
+
+	// MaxRequestedOffset and MaxReceivedOffset are the largest offsets of the chunks that were requested and received
+	MaxRequestedOffset int64
+	MaxReceivedOffset  int64
+
+	// ResendTime is the time (in seconds since the epoch) the chunks are considered lost if no chunk was received until then
+	ResendTime int64
+
+	// ChunkResendTimes maps the offsets of the in-flight chunks to the times (in seconds since the epoch) they should be
+	// requested again, and ChunkRequests maps them to the number of times they were requested
+	ChunkResendTimes map[int64]int64
+	ChunkRequests    map[int64]int
+
+	// CurrentTime is the time of the snapshot in seconds since the epoch
+	CurrentTime int64
+	StartTime   time.Time
+}
+
+// DefaultResendPolicy requests again the in-flight chunks whose resend time has passed, if no chunk was received
+// until the resend time of the transfer or chunks were received out of order
+type DefaultResendPolicy struct{}
+
+// OffsetsToResend returns the offsets of the chunks to request again
+func (policy DefaultResendPolicy) OffsetsToResend(snapshot ResendSnapshot) []int64 {
+	// The code below checks for missing chunks, i.e., chunks that have been requested but not received (e.g., lost in the network)
+	// We do this when ResendTime is less than the current time, meaning no chunks were received during that period.
+	// Otherwise, we may still want to ask to resend chunks, if they were received out of order.
+	// To check this efficiently (without scanning the map each time) the code maintains two parameters:
+	//  1. MaxRequestedOffset - the largest offset that has been requested (updated when a new offset is requested)
+	//  2. MaxReceivedOffset - the largest offset that has been received (updated when a new chunk with a larger offset is received)
+	// When the chunks arrive without any gaps (MaxRequestedOffset-MaxReceivedOffset)/ChunkSize should be equal to the number of
+	// elements in the ChunkResendTimes map.
+	// If the number of elements in the map is larger, it means that one or more chunks has not
+	// been received or that chunks have been received out of order.
+	// In such cases we want to scan the map and see if a chunk has to be re-requested.
+	offsets := make([]int64, 0)
+	if snapshot.ResendTime <= snapshot.CurrentTime ||
+		(snapshot.ChunkSize > 0 &&
+			int(snapshot.MaxRequestedOffset-snapshot.MaxReceivedOffset)/snapshot.ChunkSize < len(snapshot.ChunkResendTimes)) {
+		for offset, resendTime := range snapshot.ChunkResendTimes {
+			if resendTime <= snapshot.CurrentTime {
+				offsets = append(offsets, offset)
+			}
+		}
+	}
+	return offsets
+}
+
+var resendPolicy ResendPolicy = DefaultResendPolicy{}
+var resendPolicyLock sync.RWMutex
+
+// SetResendPolicy sets the policy that decides which chunks are requested again. nil restores the default policy.
+// The MaxChunkResends limit and the share of normal priority objects still apply to the chunks the policy returns.
+func SetResendPolicy(policy ResendPolicy) {
+	if policy == nil {
+		policy = DefaultResendPolicy{}
+	}
+	resendPolicyLock.Lock()
+	resendPolicy = policy
+	resendPolicyLock.Unlock()
+}
+
+func getResendPolicy() ResendPolicy {
+	resendPolicyLock.RLock()
+	defer resendPolicyLock.RUnlock()
+	return resendPolicy
+}
+
+// clock is the source of the current time of the resend timing of the chunks of objects' data.
+// Tests replace it to advance the time without sleeping.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+var resendClock clock = realClock{}
+
+// Must be called while holding notificationLock
+func newResendSnapshot(notification common.Notification, chunksInfo notificationChunksInfo) ResendSnapshot {
+	snapshot := ResendSnapshot{Notification: notification, ChunkSize: chunksInfo.chunkSize, DataSize: chunksInfo.dataSize,
+		ReceivedDataSize: chunksInfo.receivedDataSize, MaxRequestedOffset: chunksInfo.maxRequestedOffset,
+		MaxReceivedOffset: chunksInfo.maxReceivedOffset, ResendTime: chunksInfo.resendTime,
+		ChunkResendTimes: make(map[int64]int64, len(chunksInfo.chunkResendTimes)),
+		ChunkRequests:    make(map[int64]int, len(chunksInfo.chunkResendTimes)),
+		CurrentTime:      resendClock.Now().Unix(), StartTime: chunksInfo.startTime}
+	for offset, resendTime := range chunksInfo.chunkResendTimes {
+		snapshot.ChunkResendTimes[offset] = resendTime
+		snapshot.ChunkRequests[offset] = chunksInfo.chunkRequestCounts[offset]
+	}
+	return snapshot
+}
+
+// offsetsToResend returns the offsets of the in-flight chunks that the resend policy chose to request again,
+// and the number of times each of them was requested
+func offsetsToResend(snapshot ResendSnapshot) ([]int64, map[int64]int) {
+	// The in-flight chunks are collected before the policy is called, since the policy may change the snapshot
+	inflight := make(map[int64]int, len(snapshot.ChunkResendTimes))
+	for offset := range snapshot.ChunkResendTimes {
+		inflight[offset] = snapshot.ChunkRequests[offset]
+	}
+
+	chosen := getResendPolicy().OffsetsToResend(snapshot)
+	offsets := make([]int64, 0, len(chosen))
+	requests := make(map[int64]int, len(chosen))
+	for _, offset := range chosen {
+		if count, ok := inflight[offset]; ok {
+			// Each chunk is requested again once
+			delete(inflight, offset)
+			offsets = append(offsets, offset)
+			requests[offset] = count
+		}
+	}
+	return offsets, requests
+}
@@ -0,0 +1,152 @@
+package communications
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+type testResendPolicy struct {
+	offsets   []int64
+	snapshots []ResendSnapshot
+}
+
+func (policy *testResendPolicy) OffsetsToResend(snapshot ResendSnapshot) []int64 {
+	policy.snapshots = append(policy.snapshots, snapshot)
+
+	// Changing the snapshot must not change the state of the transfer
+	snapshot.ChunkResendTimes[100] = 0
+	delete(snapshot.ChunkResendTimes, 0)
+	snapshot.ChunkRequests[10] = 1000
+	return policy.offsets
+}
+
+func TestResendPolicy(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	maxChunkResends := common.Configuration.MaxChunkResends
+	common.Configuration.MaxChunkResends = 5
+	defer func() { common.Configuration.MaxChunkResends = maxChunkResends }()
+
+	notification := common.Notification{ObjectID: "policy", ObjectType: "type1", DestOrgID: "someorg",
+		DestType: "device", DestID: "dev1", Status: common.Getdata}
+	metaData := common.MetaData{ObjectID: "policy", ObjectType: "type1", DestOrgID: "someorg", ObjectSize: 100}
+	id := common.GetNotificationID(notification)
+	notificationLock.Lock()
+	notificationChunks[id] = notificationChunksInfo{chunkSize: 10, maxRequestedOffset: 10,
+		chunkResendTimes: map[int64]int64{0: 0, 10: time.Now().Unix() + 100}, chunkRequestCounts: map[int64]int{0: 1, 10: 2},
+		resendTime: time.Now().Unix() + 100}
+	notificationLock.Unlock()
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+
+	// The default policy requests only the chunk whose resend time expired, after chunks were received out of order
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 1 || offsets[0] != 0 {
+		t.Errorf("The default resend policy returned %v instead of [0]", offsets)
+	}
+
+	policy := &testResendPolicy{offsets: []int64{10, 100, 10, 0}}
+	SetResendPolicy(policy)
+	defer SetResendPolicy(nil)
+
+	offsets := getOffsetsToResend(notification, metaData)
+	if len(offsets) != 2 || offsets[0] != 10 || offsets[1] != 0 {
+		t.Errorf("getOffsetsToResend returned %v instead of the in-flight chunks chosen by the policy", offsets)
+	}
+	if len(policy.snapshots) != 1 || policy.snapshots[0].Notification.ObjectID != "policy" || policy.snapshots[0].ChunkSize != 10 {
+		t.Errorf("The resend policy didn't get the snapshot of the transfer")
+	}
+
+	notificationLock.RLock()
+	chunksInfo := notificationChunks[id]
+	if len(chunksInfo.chunkResendTimes) != 2 || chunksInfo.chunkResendTimes[0] != 0 || chunksInfo.chunkRequestCounts[10] != 2 {
+		t.Errorf("The resend policy changed the state of the transfer")
+	}
+	notificationLock.RUnlock()
+
+	// nil restores the default policy
+	SetResendPolicy(nil)
+	if _, ok := getResendPolicy().(DefaultResendPolicy); !ok {
+		t.Errorf("SetResendPolicy(nil) didn't restore the default resend policy")
+	}
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (clock *testClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *testClock) advance(duration time.Duration) {
+	clock.now = clock.now.Add(duration)
+}
+
+func TestResendTiming(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	common.InitObjectLocks()
+	resendInterval := common.Configuration.ChunkResendInterval
+	jitterPercent := common.Configuration.ResendJitterPercent
+	common.Configuration.ChunkResendInterval = 60
+	common.Configuration.ResendJitterPercent = 0
+	clock := &testClock{now: time.Unix(1000000, 0)}
+	resendClock = clock
+	defer func() {
+		common.Configuration.ChunkResendInterval = resendInterval
+		common.Configuration.ResendJitterPercent = jitterPercent
+		resendClock = realClock{}
+	}()
+
+	notification := common.Notification{ObjectID: "timing", ObjectType: "type1", DestOrgID: "someorg",
+		DestType: "device", DestID: "dev1", Status: common.Getdata}
+	metaData := common.MetaData{ObjectID: "timing", ObjectType: "type1", DestOrgID: "someorg", OriginType: "device", OriginID: "dev1",
+		ObjectSize: 30, ChunkSize: 10}
+	id := common.GetNotificationID(notification)
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+
+	for _, offset := range []int64{0, 10, 20} {
+		if err := updateNotificationChunkInfo(false, metaData, notification.DestType, notification.DestID, offset); err != nil {
+			t.Errorf("updateNotificationChunkInfo failed. Error: %s", err.Error())
+		}
+	}
+
+	// The chunks are requested again ChunkResendInterval seconds after they were requested
+	clock.advance(59 * time.Second)
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 0 {
+		t.Errorf("getOffsetsToResend returned %v before the resend time", offsets)
+	}
+
+	// Receiving a chunk postpones the resend of the transfer, but not of the chunks received out of order before it
+	clock.advance(-29 * time.Second)
+	if _, _, err := handleChunkReceived(metaData, 10, 10); err != nil {
+		t.Errorf("handleChunkReceived failed. Error: %s", err.Error())
+	}
+	clock.advance(29 * time.Second)
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 0 {
+		t.Errorf("getOffsetsToResend returned %v before the resend time", offsets)
+	}
+	clock.advance(time.Second)
+	offsets := getOffsetsToResend(notification, metaData)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != 20 {
+		t.Errorf("getOffsetsToResend returned %v instead of [0 20]", offsets)
+	}
+
+	// A chunk that is requested again gets a new resend time
+	if err := updateNotificationChunkInfo(false, metaData, notification.DestType, notification.DestID, 0); err != nil {
+		t.Errorf("updateNotificationChunkInfo failed. Error: %s", err.Error())
+	}
+	clock.advance(time.Second)
+	if offsets := getOffsetsToResend(notification, metaData); len(offsets) != 1 || offsets[0] != 20 {
+		t.Errorf("getOffsetsToResend returned %v instead of [20]", offsets)
+	}
+}
@@ -0,0 +1,137 @@
+package communications
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// While the node is shutting down no new transfers of objects' data are started. The transfers that are in flight
+// when the node stops are checkpointed: the chunks that were received are written to the data checkpoint, and after a
+// restart only the other chunks are requested (see reconcileLoggedDataChunks).
+// The checkpoint doesn't flush the data to disk, if the data was corrupted by a power loss, it is requested again once
+// the verification of the object's hash fails.
+
+var shuttingDown int32
+
+// The interval at which Shutdown checks whether the transfers completed
+var shutdownPollInterval = time.Second
+
+// IsShuttingDown returns true if Shutdown was called
+func IsShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+func resetShutdown() {
+	atomic.StoreInt32(&shuttingDown, 0)
+}
+
+func dataCheckpointPath() string {
+	return common.Configuration.PersistenceRootPath + "/sync/db/data-checkpoint.log"
+}
+
+// LoadTransferCheckpoint loads the checkpoint of the transfers that were in flight when the node was shut down,
+// so that they are resumed
+func LoadTransferCheckpoint() common.SyncServiceError {
+	if common.Configuration.StorageProvider != common.Bolt || common.Configuration.DataWriteAheadLog {
+		return nil
+	}
+	return storage.LoadDataCheckpoint(dataCheckpointPath())
+}
+
+// Shutdown stops starting new transfers of objects' data, and waits until the transfers that are in flight complete
+// or ctx is done. The origins of the remaining transfers are notified that the node is going away, so that they don't
+// resend the notifications of the objects while it is down, and the transfers are checkpointed to be resumed after
+// a restart.
+// Shutdown must be called before the communications are stopped.
+func Shutdown(ctx context.Context) common.SyncServiceError {
+	atomic.StoreInt32(&shuttingDown, 1)
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		transfers := getTransfersInFlight()
+		if len(transfers) == 0 {
+			break
+		}
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Shutting down, waiting for %d transfers to complete\n", len(transfers))
+		}
+		select {
+		case <-ctx.Done():
+			waiting = false
+		case <-ticker.C:
+		}
+	}
+
+	transfers := getTransfersInFlight()
+	if len(transfers) == 0 {
+		return checkpointTransfers(nil)
+	}
+	if log.IsLogging(logger.INFO) {
+		log.Info("Shutting down with %d transfers in flight, checkpointing them\n", len(transfers))
+	}
+
+	retryInterval := int32(common.Configuration.ChunkResendInterval)
+	checkpoints := make([]storage.DataCheckpoint, 0, len(transfers))
+	for _, transfer := range transfers {
+		// Holding the object's lock, no chunk of the object is being written
+		lockIndex := common.HashStrings(transfer.OrgID, transfer.ObjectType, transfer.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		metaData, err := Store.RetrieveObject(transfer.OrgID, transfer.ObjectType, transfer.ObjectID)
+		if err != nil || metaData == nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			continue
+		}
+		id := common.CreateNotificationID(transfer.OrgID, transfer.ObjectType, transfer.ObjectID, transfer.DestType, transfer.DestID)
+		state, ok := DumpChunkState(id)
+		common.ObjectLocks.Unlock(lockIndex)
+		if !ok {
+			// The transfer completed
+			continue
+		}
+
+		// The chunks appended to a data URI are verified by their checksums when the transfer is resumed,
+		// the checkpoint doesn't have them
+		if metaData.DestinationDataURI == "" && len(state.Received) != 0 {
+			checkpoint := storage.DataCheckpoint{OrgID: metaData.DestOrgID, ObjectType: metaData.ObjectType,
+				ObjectID: metaData.ObjectID, InstanceID: metaData.InstanceID}
+			for _, received := range state.Received {
+				checkpoint.Chunks = append(checkpoint.Chunks, storage.LoggedDataChunk{Offset: received.Offset, Length: received.Length})
+			}
+			checkpoints = append(checkpoints, checkpoint)
+		}
+
+		if err := Comm.SendFeedbackMessage(common.GoingAwayCode, retryInterval, "The destination is shutting down", metaData,
+			true); err != nil && log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to notify %s %s that the node is going away. Error: %s\n", transfer.DestType, transfer.DestID, err)
+		}
+	}
+
+	return checkpointTransfers(checkpoints)
+}
+
+// getTransfersInFlight returns the transfers of objects' data that are being received, except the failed transfers
+func getTransfersInFlight() []ActiveTransfer {
+	transfers := ListActiveTransfers()
+	inFlight := transfers[:0]
+	for _, transfer := range transfers {
+		if !transfer.Failed {
+			inFlight = append(inFlight, transfer)
+		}
+	}
+	return inFlight
+}
+
+func checkpointTransfers(checkpoints []storage.DataCheckpoint) common.SyncServiceError {
+	if common.Configuration.StorageProvider != common.Bolt {
+		return nil
+	}
+	return storage.WriteDataCheckpoint(dataCheckpointPath(), checkpoints)
+}
@@ -0,0 +1,123 @@
+package communications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestShutdown(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+	storageProvider := common.Configuration.StorageProvider
+	pollInterval := shutdownPollInterval
+	defer func() {
+		common.Configuration.StorageProvider = storageProvider
+		shutdownPollInterval = pollInterval
+		resetShutdown()
+		storage.CloseDataLog()
+	}()
+	common.Configuration.StorageProvider = common.Bolt
+	shutdownPollInterval = 10 * time.Millisecond
+
+	// Wait only for the transfers of this test, not those left behind by other tests
+	notificationLock.Lock()
+	transfers := notificationChunks
+	notificationChunks = make(map[string]notificationChunksInfo)
+	notificationLock.Unlock()
+	defer func() {
+		notificationLock.Lock()
+		notificationChunks = transfers
+		notificationLock.Unlock()
+	}()
+
+	store, err := setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "shutdown", ObjectType: "type1", DestOrgID: "someorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: 22, ChunkSize: 5, InstanceID: 20, DataID: 20}
+	if _, err := Store.StoreObject(metaData, nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	for _, offset := range []int64{0, 5, 10} {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			t.Errorf("GetData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	for _, offset := range []int64{0, 10} {
+		message, err := buildDataMessage(metaData, []byte("hello"), 5, offset)
+		if err != nil {
+			t.Errorf("Failed to build data message. Error: %s", err.Error())
+		} else if _, err := handleData(message); err != nil {
+			t.Errorf("handleData failed (offset = %d). Error: %s", offset, err.Error())
+		}
+	}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID)
+	defer func() {
+		notificationLock.Lock()
+		delete(notificationChunks, id)
+		notificationLock.Unlock()
+	}()
+
+	// The transfer doesn't complete before the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed. Error: %s", err.Error())
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Shutdown didn't wait for the transfer to complete")
+	}
+	if !IsShuttingDown() {
+		t.Errorf("The node isn't shutting down after Shutdown")
+	}
+	notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType, DestOrgID: metaData.DestOrgID,
+		DestType: "type3", DestID: "456", Status: common.Getdata, InstanceID: metaData.InstanceID}
+	if offsets := getOffsetsForResendFromScratch(notification, metaData); len(offsets) != 0 {
+		t.Errorf("A transfer was started while shutting down")
+	}
+
+	// The received chunks are checkpointed
+	if err := LoadTransferCheckpoint(); err != nil {
+		t.Errorf("LoadTransferCheckpoint failed. Error: %s", err.Error())
+	}
+	chunks := storage.GetLoggedDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID)
+	if len(chunks) != 2 || chunks[0].Offset != 0 || chunks[0].Length != 5 || chunks[1].Offset != 10 || chunks[1].Length != 5 {
+		t.Errorf("Wrong checkpointed chunks: %v", chunks)
+	}
+
+	// Without transfers in flight Shutdown doesn't wait
+	storage.CloseDataLog()
+	notificationLock.Lock()
+	delete(notificationChunks, id)
+	notificationLock.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start = time.Now()
+	if err := Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed. Error: %s", err.Error())
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Shutdown waited without transfers in flight")
+	}
+	if err := LoadTransferCheckpoint(); err != nil {
+		t.Errorf("LoadTransferCheckpoint failed. Error: %s", err.Error())
+	}
+	if chunks := storage.GetLoggedDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID); len(chunks) != 0 {
+		t.Errorf("Chunks were checkpointed without transfers in flight")
+	}
+}
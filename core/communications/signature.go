@@ -0,0 +1,127 @@
+package communications
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// signatureRejectionReason verifies the signature of the fully assembled data of the object with the public key
+// of the object's organization. It returns the reason to reject the object's data, or an empty string if the data
+// is accepted. The data of the objects of an organization without a public key is accepted without verification.
+// An error is returned if the data couldn't be verified, e.g., if it couldn't be read.
+func signatureRejectionReason(metaData common.MetaData) (string, common.SyncServiceError) {
+	publicKey, err := loadSignaturePublicKey(metaData.DestOrgID)
+	if err != nil || publicKey == nil {
+		return "", err
+	}
+	if metaData.Signature == "" {
+		return "The object is not signed", nil
+	}
+	signature, decodeErr := base64.StdEncoding.DecodeString(metaData.Signature)
+	if decodeErr != nil {
+		return "The object's signature is not base64 encoded", nil
+	}
+	algorithm := metaData.HashAlgorithm
+	if algorithm == "" {
+		algorithm = common.Configuration.DefaultHashAlgorithm
+	}
+	hashType, ok := signatureHashes[strings.ToLower(algorithm)]
+	if !ok {
+		return fmt.Sprintf("Unsupported hash algorithm %s", algorithm), nil
+	}
+
+	digest, _, err := digestObjectData(metaData, metaData.DestinationDataURI, metaData.HashAlgorithm)
+	if err != nil {
+		return "", err
+	}
+
+	valid := false
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, hashType, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(signature, &ecdsaSignature); err == nil && len(rest) == 0 {
+			valid = ecdsa.Verify(key, digest, ecdsaSignature.R, ecdsaSignature.S)
+		}
+	}
+	if !valid {
+		return "The object's signature doesn't match its data", nil
+	}
+	return "", nil
+}
+
+// The hashes of the supported hash algorithms, used to verify RSA signatures
+var signatureHashes = map[string]crypto.Hash{
+	common.SHA1:   crypto.SHA1,
+	common.SHA256: crypto.SHA256,
+	common.SHA512: crypto.SHA512,
+}
+
+// loadSignaturePublicKey returns the public key used to verify the signatures of the objects of the organization,
+// or nil if the organization doesn't have a public key
+func loadSignaturePublicKey(orgID string) (crypto.PublicKey, common.SyncServiceError) {
+	if common.Configuration.SignaturePublicKeysPath == "" {
+		return nil, nil
+	}
+	path := common.Configuration.SignaturePublicKeysPath
+	if !strings.HasPrefix(path, "/") {
+		path = common.Configuration.PersistenceRootPath + path
+	}
+	path = strings.TrimSuffix(path, "/") + "/" + orgID + ".pem"
+
+	pemKey, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, &common.IOError{Message: fmt.Sprintf("Failed to read the public key of %s. Error: %s", orgID, err.Error())}
+	}
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, &Error{fmt.Sprintf("The public key of %s is not PEM encoded", orgID)}
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to parse the public key of %s. Error: %s", orgID, err.Error())}
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return publicKey, nil
+	}
+	return nil, &Error{fmt.Sprintf("The public key of %s is neither an RSA nor an ECDSA key", orgID)}
+}
+
+// rejectObjectData marks the object's data as rejected, and removes it, so that it is neither used by applications
+// nor sent to other nodes. Must be called while holding the object's lock.
+func rejectObjectData(metaData common.MetaData, reason string) common.SyncServiceError {
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Rejected the data of %s:%s:%s from %s %s. %s\n", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			metaData.OriginType, metaData.OriginID, reason)
+	}
+	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.SignatureRejected); err != nil {
+		return err
+	}
+	if err := Store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType,
+		metaData.OriginID); err != nil {
+		return err
+	}
+	return storage.DeleteStoredData(Store, metaData)
+}
@@ -0,0 +1,98 @@
+package communications
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestObjectSignature(t *testing.T) {
+	keysPath := common.Configuration.SignaturePublicKeysPath
+	defer func() { common.Configuration.SignaturePublicKeysPath = keysPath }()
+
+	store, err := setUpStorage(common.InMemory)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	Store = store
+	defer Store.Stop()
+
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Errorf("Failed to create the keys directory. Error: %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	common.Configuration.SignaturePublicKeysPath = dir
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	writeKey := func(orgID string, publicKey crypto.PublicKey) {
+		encoded, _ := x509.MarshalPKIXPublicKey(publicKey)
+		ioutil.WriteFile(dir+"/"+orgID+".pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: encoded}), 0600)
+	}
+	writeKey("rsaorg", &rsaKey.PublicKey)
+	writeKey("ecdsaorg", &ecdsaKey.PublicKey)
+
+	data := []byte("signed data")
+	digest := sha256.Sum256(data)
+	rsaSignature, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	r, s, _ := ecdsa.Sign(rand.Reader, ecdsaKey, digest[:])
+	ecdsaSignature, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+
+	tests := []struct {
+		orgID     string
+		signature []byte
+		data      string
+		accepted  bool
+	}{
+		{"rsaorg", rsaSignature, "signed data", true},
+		{"ecdsaorg", ecdsaSignature, "signed data", true},
+		{"rsaorg", rsaSignature, "tampered data", false},
+		{"ecdsaorg", ecdsaSignature, "tampered data", false},
+		{"rsaorg", ecdsaSignature, "signed data", false},
+		{"rsaorg", nil, "signed data", false},  // Objects of an organization with a key must be signed
+		{"otherorg", nil, "signed data", true}, // Organizations without a key don't verify signatures
+	}
+	for i, test := range tests {
+		metaData := common.MetaData{ObjectID: "signed", ObjectType: "type1", DestOrgID: test.orgID, HashAlgorithm: common.SHA256}
+		if test.signature != nil {
+			metaData.Signature = base64.StdEncoding.EncodeToString(test.signature)
+		}
+		if _, err := Store.StoreObject(metaData, []byte(test.data), common.PartiallyReceived); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+			continue
+		}
+		reason, err := signatureRejectionReason(metaData)
+		if err != nil {
+			t.Errorf("signatureRejectionReason failed in test %d. Error: %s", i, err.Error())
+		} else if (reason == "") != test.accepted {
+			t.Errorf("Test %d: the object's data was accepted=%t (%s)", i, reason == "", reason)
+		}
+	}
+
+	metaData := common.MetaData{ObjectID: "rejected", ObjectType: "type1", DestOrgID: "rsaorg"}
+	if _, err := Store.StoreObject(metaData, data, common.PartiallyReceived); err != nil {
+		t.Errorf("StoreObject failed. Error: %s", err.Error())
+	}
+	if err := rejectObjectData(metaData, "The object is not signed"); err != nil {
+		t.Errorf("rejectObjectData failed. Error: %s", err.Error())
+	}
+	if status, _ := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); status != common.SignatureRejected {
+		t.Errorf("The status of a rejected object is %s instead of %s", status, common.SignatureRejected)
+	}
+}
@@ -20,6 +20,11 @@ func (communication *TestComm) StopCommunication() common.SyncServiceError {
 	return nil
 }
 
+// ReloadTLS reloads the TLS certificates and keys from disk, and applies them to the connections established afterward
+func (communication *TestComm) ReloadTLS() common.SyncServiceError {
+	return nil
+}
+
 // SendNotificationMessage sends a notification message from the CSS to the ESS or from the ESS to the CSS
 func (communication *TestComm) SendNotificationMessage(notificationTopic string, destType string,
 	destID string, instanceID int64, dataID int64, metaData *common.MetaData) common.SyncServiceError {
@@ -39,6 +44,11 @@ func (communication *TestComm) RegisterAck(destination common.Destination) commo
 // HandleRegAck handles a registration acknowledgement message from the CSS
 func (communication *TestComm) HandleRegAck() {}
 
+// RegisterDenied sends a message from the CSS to an ESS that its registration was denied, with the reason
+func (communication *TestComm) RegisterDenied(destination common.Destination, reason string) common.SyncServiceError {
+	return nil
+}
+
 // RegisterAsNew send a notification from a CSS to a ESS that the ESS has to send a registerNew message in order
 // to register
 func (communication *TestComm) RegisterAsNew(destination common.Destination) common.SyncServiceError {
@@ -60,14 +70,28 @@ func (communication *TestComm) SendPing() common.SyncServiceError {
 	return nil
 }
 
+// SendHeartbeat sends a heartbeat message from ESS to CSS
+func (communication *TestComm) SendHeartbeat() common.SyncServiceError {
+	return nil
+}
+
 // GetData requests data to be sent from the CSS to the ESS or from the ESS to the CSS
 func (communication *TestComm) GetData(metaData common.MetaData, offset int64) common.SyncServiceError {
 	err := updateGetDataNotification(metaData, metaData.OriginType, metaData.OriginID, offset)
 	return err
 }
 
+// GetDataRange requests count consecutive chunks, starting at offset, to be sent from the CSS to the ESS or from the ESS to the CSS
+func (communication *TestComm) GetDataRange(metaData common.MetaData, offset int64, count int) common.SyncServiceError {
+	return updateGetDataRangeNotification(metaData, metaData.OriginType, metaData.OriginID, offset, count)
+}
+
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
-func (communication *TestComm) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
+func (communication *TestComm) SendData(metaData *common.MetaData, destType string, destID string, message []byte, chunked bool,
+	done func()) common.SyncServiceError {
+	if done != nil {
+		done()
+	}
 	return nil
 }
 
@@ -81,6 +105,16 @@ func (communication *TestComm) SendAckResendObjects(destination common.Destinati
 	return nil
 }
 
+// SendAckBatch sends a batch of acks of received and consumed notifications to the destination
+func (communication *TestComm) SendAckBatch(orgID string, destType string, destID string, acks []common.AckEntry) common.SyncServiceError {
+	return nil
+}
+
+// SendVerifyRequest sends the manifest of the objects of the ESS to the CSS, to verify them
+func (communication *TestComm) SendVerifyRequest(manifest []common.ManifestEntry, resend bool) common.SyncServiceError {
+	return nil
+}
+
 // UpdateOrganization adds or updates an organization
 func (communication *TestComm) UpdateOrganization(org common.Organization, timestamp time.Time) common.SyncServiceError {
 	return nil
@@ -110,3 +144,8 @@ func (communication *TestComm) SendFeedbackMessage(code int, retryInterval int32
 func (communication *TestComm) SendErrorMessage(err common.SyncServiceError, metaData *common.MetaData, sendToOrigin bool) common.SyncServiceError {
 	return nil
 }
+
+// SendPartiallyConsumed notifies the object's origin that the data of the object was consumed up to offset
+func (communication *TestComm) SendPartiallyConsumed(metaData *common.MetaData, offset int64) common.SyncServiceError {
+	return nil
+}
@@ -0,0 +1,124 @@
+package communications
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// The transports dial with a TLS configuration that looks up the latest loaded certificates on every handshake, so
+// that ReloadTLS rotates the client certificates and the CA certificates without restarting the node. The connections
+// that were established before the reload, and the transfers over them, are not interrupted.
+
+// The time (in nanoseconds since the epoch) at which the TLS files were last loaded
+var tlsLoadTime int64
+
+type reloadableTLSConfig struct {
+	current atomic.Value // *tls.Config
+}
+
+func newReloadableTLSConfig(config *tls.Config) *reloadableTLSConfig {
+	reloadable := &reloadableTLSConfig{}
+	reloadable.current.Store(config)
+	return reloadable
+}
+
+func (reloadable *reloadableTLSConfig) load() *tls.Config {
+	return reloadable.current.Load().(*tls.Config)
+}
+
+func (reloadable *reloadableTLSConfig) store(config *tls.Config) {
+	reloadable.current.Store(config)
+}
+
+// clientConfig returns the configuration to dial with. The verification of the server certificates is done by
+// VerifyConnection, against the CA certificates of the latest loaded configuration.
+func (reloadable *reloadableTLSConfig) clientConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify:   true,
+		VerifyConnection:     reloadable.verifyConnection,
+		GetClientCertificate: reloadable.getClientCertificate,
+	}
+}
+
+func (reloadable *reloadableTLSConfig) verifyConnection(state tls.ConnectionState) error {
+	config := reloadable.load()
+	if config.InsecureSkipVerify {
+		return nil
+	}
+	if len(state.PeerCertificates) == 0 {
+		return &Error{"The server didn't present a certificate"}
+	}
+	options := x509.VerifyOptions{Roots: config.RootCAs, DNSName: state.ServerName, Intermediates: x509.NewCertPool()}
+	for _, certificate := range state.PeerCertificates[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+	_, err := state.PeerCertificates[0].Verify(options)
+	return err
+}
+
+func (reloadable *reloadableTLSConfig) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	config := reloadable.load()
+	if len(config.Certificates) == 0 {
+		// No client certificate is sent
+		return &tls.Certificate{}, nil
+	}
+	return &config.Certificates[0], nil
+}
+
+// tlsFilePath returns the path of a certificate or key configuration property, relative to the PersistenceRootPath
+// configuration property if it doesn't start with a slash (/)
+func tlsFilePath(value string) string {
+	if strings.HasPrefix(value, "/") {
+		return value
+	}
+	return common.Configuration.PersistenceRootPath + value
+}
+
+// tlsFiles returns the paths of the configured TLS files of the transports
+func tlsFiles() []string {
+	values := make([]string, 0)
+	if common.Configuration.CommunicationProtocol != common.HTTPProtocol && common.Configuration.MQTTUseSSL {
+		values = append(values, common.Configuration.MQTTCACertificate, common.Configuration.MQTTSSLCert,
+			common.Configuration.MQTTSSLKey)
+	}
+	if common.Configuration.NodeType == common.ESS && common.Configuration.HTTPCSSUseSSL {
+		values = append(values, common.Configuration.HTTPCSSCACertificate)
+	}
+
+	files := make([]string, 0, len(values))
+	for _, value := range values {
+		// A value can be the certificate or the key itself
+		if value != "" && !strings.Contains(value, "-----BEGIN") {
+			files = append(files, tlsFilePath(value))
+		}
+	}
+	return files
+}
+
+func setTLSLoadTime(loadTime time.Time) {
+	atomic.StoreInt64(&tlsLoadTime, loadTime.UnixNano())
+}
+
+// ReloadTLSIfModified reloads the TLS files of the transports if any of them was modified since they were last loaded.
+// If the reload fails, for example when the certificate was replaced but the key wasn't yet, the previous
+// configuration remains in use and the reload is retried by the next call.
+func ReloadTLSIfModified() common.SyncServiceError {
+	now := time.Now()
+	loadTime := atomic.LoadInt64(&tlsLoadTime)
+	for _, file := range tlsFiles() {
+		if info, err := os.Stat(file); err == nil && info.ModTime().UnixNano() > loadTime {
+			if err := Comm.ReloadTLS(); err != nil {
+				return err
+			}
+			setTLSLoadTime(now)
+			return nil
+		}
+	}
+	return nil
+}
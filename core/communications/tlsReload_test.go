@@ -0,0 +1,175 @@
+package communications
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestReloadTLS(t *testing.T) {
+	configuration := common.Configuration
+	comm := Comm
+	defer func() {
+		common.Configuration = configuration
+		Comm = comm
+	}()
+
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Errorf("Failed to create the certificates directory. Error: %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	caCert, caKey := createTestCertificate(t, "ca", nil, nil)
+	serverCert, serverKey := createTestCertificate(t, "server", caCert, caKey)
+	otherCACert, _ := createTestCertificate(t, "other-ca", nil, nil)
+
+	writeFile := func(name string, blockType string, bytes []byte) {
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes})
+		if err := ioutil.WriteFile(dir+"/"+name, data, 0600); err != nil {
+			t.Errorf("Failed to write %s. Error: %s", name, err.Error())
+		}
+		// The modification is detected regardless of the resolution of the file system's timestamps
+		modTime := time.Now().Add(time.Second)
+		os.Chtimes(dir+"/"+name, modTime, modTime)
+	}
+	writeClientCertificate := func(name string) {
+		cert, key := createTestCertificate(t, name, caCert, caKey)
+		keyBytes, _ := x509.MarshalECPrivateKey(key)
+		writeFile("client.pem", "CERTIFICATE", cert.Raw)
+		writeFile("client.key", "EC PRIVATE KEY", keyBytes)
+	}
+
+	common.Configuration.CommunicationProtocol = common.MQTTProtocol
+	common.Configuration.MQTTUseSSL = true
+	common.Configuration.MQTTAllowInvalidCertificates = false
+	common.Configuration.MQTTCACertificate = dir + "/ca.pem"
+	common.Configuration.MQTTSSLCert = dir + "/client.pem"
+	common.Configuration.MQTTSSLKey = dir + "/client.key"
+	writeFile("ca.pem", "CERTIFICATE", caCert.Raw)
+	writeClientCertificate("client1")
+
+	setTLSLoadTime(time.Now())
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		t.Errorf("Failed to load the TLS configuration. Error: %s", err.Error())
+		return
+	}
+	communication := &MQTT{tlsConfig: newReloadableTLSConfig(tlsConfig)}
+	Comm = communication
+
+	// The server replies with the common name of the client's certificate
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert, ClientCAs: clientCAs})
+	if err != nil {
+		t.Errorf("Failed to listen. Error: %s", err.Error())
+		return
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err := tlsConn.Handshake(); err == nil {
+				tlsConn.Write([]byte(tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName))
+			}
+			tlsConn.Close()
+		}
+	}()
+
+	dial := func() (string, error) {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), communication.tlsConfig.clientConfig())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		name, err := ioutil.ReadAll(conn)
+		return string(name), err
+	}
+
+	if name, err := dial(); err != nil || name != "client1" {
+		t.Errorf("The connection didn't use the loaded certificate: %s, error: %v", name, err)
+	}
+
+	// Unmodified files aren't reloaded
+	communication.tlsConfig.store(&tls.Config{})
+	setTLSLoadTime(time.Now().Add(time.Minute))
+	if err := ReloadTLSIfModified(); err != nil {
+		t.Errorf("ReloadTLSIfModified failed. Error: %s", err.Error())
+	}
+	if len(communication.tlsConfig.load().Certificates) != 0 {
+		t.Errorf("The TLS configuration was reloaded without modified files")
+	}
+	communication.tlsConfig.store(tlsConfig)
+	setTLSLoadTime(time.Now())
+
+	// The rotated certificate is used by the connections established after the reload
+	writeClientCertificate("client2")
+	if err := ReloadTLSIfModified(); err != nil {
+		t.Errorf("ReloadTLSIfModified failed. Error: %s", err.Error())
+	}
+	if name, err := dial(); err != nil || name != "client2" {
+		t.Errorf("The connection didn't use the rotated certificate: %s, error: %v", name, err)
+	}
+
+	// A certificate that doesn't match the key isn't applied
+	cert, _ := createTestCertificate(t, "client3", caCert, caKey)
+	writeFile("client.pem", "CERTIFICATE", cert.Raw)
+	if err := ReloadTLSIfModified(); err == nil {
+		t.Errorf("A certificate that doesn't match the key was reloaded")
+	}
+	if name, err := dial(); err != nil || name != "client2" {
+		t.Errorf("The connection didn't use the previous certificate: %s, error: %v", name, err)
+	}
+
+	// The rotated CA certificate verifies the server
+	writeClientCertificate("client4")
+	writeFile("ca.pem", "CERTIFICATE", otherCACert.Raw)
+	if err := communication.ReloadTLS(); err != nil {
+		t.Errorf("ReloadTLS failed. Error: %s", err.Error())
+	}
+	if _, err := dial(); err == nil {
+		t.Errorf("The server was verified by the previous CA certificate")
+	}
+}
+
+// createTestCertificate creates a certificate for 127.0.0.1, signed by parent, or a self signed CA certificate if parent is nil
+func createTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serialNumber, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{SerialNumber: serialNumber, Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, BasicConstraintsValid: true}
+	if parent == nil {
+		template.IsCA = true
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create the certificate %s. Error: %s", name, err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
@@ -2,6 +2,7 @@ package dataURI
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net/url"
 	"os"
@@ -50,6 +51,13 @@ func AppendData(uri string, dataReader io.Reader, dataLength uint32, offset int6
 		return &common.IOError{Message: "Failed to write all the data to file."}
 	}
 
+	// The chunk is logged in the data write-ahead log after this returns, so it must be durable by then
+	if common.Configuration.DataWriteAheadLog {
+		if err := file.Sync(); err != nil {
+			return &common.IOError{Message: "Failed to sync file. Error: " + err.Error()}
+		}
+	}
+
 	if isLastChunk {
 		if err := os.Rename(filePath, dataURI.Path); err != nil {
 			return &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
@@ -58,6 +66,119 @@ func AppendData(uri string, dataReader io.Reader, dataLength uint32, offset int6
 	return nil
 }
 
+// AppendZeroData appends a chunk of length zeros to the file stored at the given URI. The zeros are written only over
+// existing data of the file (e.g., in a patch update), the file is extended over the rest of the zeros without writing
+// them, leaving a hole on file systems that support sparse files.
+func AppendZeroData(uri string, length uint32, offset int64, isLastChunk bool) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing zero data chunk at %s", uri)
+	}
+
+	dataURI, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
+		return &Error{"Invalid data URI"}
+	}
+
+	filePath := dataURI.Path + ".tmp"
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return common.CreateError(err, fmt.Sprintf("Failed to open file %s to append data. Error: ", dataURI.Path))
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return &common.IOError{Message: "Failed to get the size of a file. Error: " + err.Error()}
+	}
+
+	end := offset + int64(length)
+	if size := info.Size(); size > offset {
+		overlap := end
+		if size < end {
+			overlap = size
+		}
+		if _, err := file.WriteAt(make([]byte, overlap-offset), offset); err != nil {
+			return &common.IOError{Message: "Failed to write to file. Error: " + err.Error()}
+		}
+	}
+	if info.Size() < end {
+		if err := file.Truncate(end); err != nil {
+			return &common.IOError{Message: "Failed to extend file. Error: " + err.Error()}
+		}
+	}
+
+	// The chunk is logged in the data write-ahead log after this returns, so it must be durable by then
+	if common.Configuration.DataWriteAheadLog {
+		if err := file.Sync(); err != nil {
+			return &common.IOError{Message: "Failed to sync file. Error: " + err.Error()}
+		}
+	}
+
+	if isLastChunk {
+		if err := os.Rename(filePath, dataURI.Path); err != nil {
+			return &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
+		}
+	}
+	return nil
+}
+
+// VerifyAt checks that the chunk at offset of the data that is being appended to the file at the given URI
+// was written completely, i.e., that the file holds expectedLen bytes at offset whose CRC32 (IEEE) checksum is checksum.
+// It returns false if the chunk is missing or torn.
+func VerifyAt(uri string, offset int64, expectedLen int64, checksum uint32) (bool, common.SyncServiceError) {
+	dataURI, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
+		return false, &Error{"Invalid data URI"}
+	}
+
+	file, err := os.Open(dataURI.Path + ".tmp")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, common.CreateError(err, fmt.Sprintf("Failed to open file %s to verify data. Error: ", dataURI.Path))
+	}
+	defer file.Close()
+
+	hash := crc32.NewIEEE()
+	n, err := io.Copy(hash, io.NewSectionReader(file, offset, expectedLen))
+	if err != nil {
+		return false, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+	}
+	return n == expectedLen && hash.Sum32() == checksum, nil
+}
+
+// PrepareDataPatch copies the data stored at the given URI to the file that data chunks are appended to,
+// so that a patch update only has to write the changed byte ranges. The copy is truncated to the given size.
+func PrepareDataPatch(uri string, size int64) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Preparing data patch at %s", uri)
+	}
+	dataURI, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
+		return &Error{"Invalid data URI"}
+	}
+
+	source, err := os.Open(dataURI.Path)
+	if err != nil {
+		return common.CreateError(err, fmt.Sprintf("Failed to open file %s to patch data. Error: ", dataURI.Path))
+	}
+	defer source.Close()
+
+	file, err := os.OpenFile(dataURI.Path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return common.CreateError(err, fmt.Sprintf("Failed to open file %s to patch data. Error: ", dataURI.Path))
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, source); err != nil {
+		return &common.IOError{Message: "Failed to copy data to patch. Error: " + err.Error()}
+	}
+	if err := file.Truncate(size); err != nil {
+		return &common.IOError{Message: "Failed to truncate data to patch. Error: " + err.Error()}
+	}
+	return nil
+}
+
 // StoreData writes the data to the file stored at the given URI
 func StoreData(uri string, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
 	if trace.IsLogging(logger.TRACE) {
@@ -117,9 +238,20 @@ func GetData(uri string) (io.Reader, common.SyncServiceError) {
 // GetDataChunk retrieves the data stored at the given URI.
 // After reading, the reader has to be closed.
 func GetDataChunk(uri string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	result := make([]byte, size)
+	eof, n, err := ReadDataChunk(uri, result, offset)
+	if err != nil {
+		return nil, eof, 0, err
+	}
+	return result, eof, n, nil
+}
+
+// ReadDataChunk reads the data stored at the given URI at offset directly into buffer, up to the length of buffer.
+// Returns whether the end of the data was reached and the number of bytes read.
+func ReadDataChunk(uri string, buffer []byte, offset int64) (bool, int, common.SyncServiceError) {
 	dataURI, err := url.Parse(uri)
 	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
-		return nil, false, 0, &Error{"Invalid data URI"}
+		return false, 0, &Error{"Invalid data URI"}
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -129,18 +261,18 @@ func GetDataChunk(uri string, size int, offset int64) ([]byte, bool, int, common
 	file, err := os.Open(dataURI.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, true, 0, &common.NotFound{}
+			return true, 0, &common.NotFound{}
 		}
-		return nil, true, 0, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", dataURI.Path))
+		return true, 0, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", dataURI.Path))
 	}
 	defer file.Close()
 
 	eof := false
-	result := make([]byte, size)
-	n, err := file.ReadAt(result, offset)
+	size := len(buffer)
+	n, err := file.ReadAt(buffer, offset)
 	if n == size {
 		if err != nil { // This, most probably, can never happen when n == size, but the doc doesn't say it
-			return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+			return true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
 		}
 		var fi os.FileInfo
 		fi, err = file.Stat()
@@ -152,11 +284,11 @@ func GetDataChunk(uri string, size int, offset int64) ([]byte, bool, int, common
 		if err == io.EOF {
 			eof = true
 		} else {
-			return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+			return true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
 		}
 	}
 
-	return result, eof, n, nil
+	return eof, n, nil
 }
 
 // DeleteStoredData deletes the data file stored at the given URI
@@ -2,6 +2,8 @@ package dataURI
 
 import (
 	"bytes"
+	"hash/crc32"
+	"io/ioutil"
 	"os"
 	"testing"
 )
@@ -179,3 +181,77 @@ func TestDataURI(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyAt(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed to get current directory. Error: %s", err.Error())
+	}
+	uri := "file:///" + dir + "verify.txt"
+	defer os.Remove(dir + "verify.txt.tmp")
+
+	for _, offset := range []int64{0, 5} {
+		if err := AppendData(uri, bytes.NewReader([]byte("Hello")), 5, offset, 15, offset == 0, false); err != nil {
+			t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+		}
+	}
+
+	tests := []struct {
+		offset   int64
+		length   int64
+		checksum uint32
+		expected bool
+	}{
+		{0, 5, crc32.ChecksumIEEE([]byte("Hello")), true},
+		{5, 5, crc32.ChecksumIEEE([]byte("Hello")), true},
+		// A chunk whose data differs from the logged chunk
+		{0, 5, crc32.ChecksumIEEE([]byte("World")), false},
+		// A chunk that wasn't written completely
+		{5, 10, crc32.ChecksumIEEE([]byte("Hello     ")), false},
+		// A chunk that wasn't written
+		{10, 5, crc32.ChecksumIEEE([]byte("Hello")), false},
+	}
+	for _, test := range tests {
+		ok, err := VerifyAt(uri, test.offset, test.length, test.checksum)
+		if err != nil {
+			t.Errorf("VerifyAt failed (offset = %d). Error: %s", test.offset, err.Error())
+		} else if ok != test.expected {
+			t.Errorf("VerifyAt returned %t instead of %t (offset = %d, length = %d)", ok, test.expected, test.offset, test.length)
+		}
+	}
+
+	if ok, err := VerifyAt("file:///"+dir+"missing.txt", 0, 5, crc32.ChecksumIEEE([]byte("Hello"))); err != nil || ok {
+		t.Errorf("VerifyAt of missing data returned %t, %v", ok, err)
+	}
+}
+
+func TestAppendZeroData(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed to get current directory. Error: %s", err.Error())
+	}
+	uri := "file:///" + dir + "sparse.txt"
+	defer os.Remove(dir + "sparse.txt")
+	defer os.Remove(dir + "sparse.txt.tmp")
+
+	// Zeros over existing data are written, the rest of the zeros extend the file
+	if err := AppendData(uri, bytes.NewReader([]byte("HelloWorld")), 10, 0, 20, true, false); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if err := AppendZeroData(uri, 10, 5, false); err != nil {
+		t.Errorf("Failed to store zeros in data uri. Error: %s", err.Error())
+	}
+	if err := AppendData(uri, bytes.NewReader([]byte("!!")), 2, 18, 20, false, false); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if err := AppendZeroData(uri, 3, 15, true); err != nil {
+		t.Errorf("Failed to store zeros in data uri. Error: %s", err.Error())
+	}
+
+	expected := append(append([]byte("Hello"), make([]byte, 13)...), []byte("!!")...)
+	if data, err := ioutil.ReadFile(dir + "sparse.txt"); err != nil {
+		t.Errorf("Failed to read the data. Error: %s", err.Error())
+	} else if !bytes.Equal(data, expected) {
+		t.Errorf("Read incorrect data: %q instead of %q", data, expected)
+	}
+}
@@ -1,6 +1,7 @@
 package leader
 
 import (
+	"sync"
 	"time"
 
 	"github.com/open-horizon/edge-sync-service/core/storage"
@@ -17,8 +18,15 @@ var leaderID uuid.UUID
 var leaderTicker *time.Ticker
 var leaderStopChannel chan int
 var store storage.Storage
+
+// isLeader and lastTimestamp are written by the leadership periodic update, and read by the handlers of messages
+// and requests, that may run before the leadership is determined
 var isLeader bool
 var lastTimestamp time.Time
+var leadershipLock sync.RWMutex
+
+var leaderAddress string
+var leaderAddressLock sync.RWMutex
 
 var changeLeadership func(bool) common.SyncServiceError
 var unsubscribe func() common.SyncServiceError
@@ -28,15 +36,20 @@ func init() {
 	leaderStopChannel = make(chan int, 1)
 }
 
-// StartLeaderDetermination starts the leader determination process
+// StartLeaderDetermination starts the leader determination process.
+// The leadership is determined when StartLeaderDetermination returns.
 func StartLeaderDetermination(theStore storage.Storage) {
-	if common.Configuration.NodeType != common.CSS || common.Configuration.StorageProvider != common.Mongo {
+	if common.Configuration.NodeType != common.CSS || common.Configuration.StorageProvider != common.Mongo ||
+		common.Configuration.SingleNodeCSS {
 		return
 	}
 	store = theStore
-	isLeader = false
+	setLeadership(false)
 
 	initializeLeadership()
+	if IsOwnershipSharded() {
+		updateOwnership()
+	}
 	startLeadershipPeriodicUpdate()
 }
 
@@ -50,13 +63,13 @@ func initializeLeadership() {
 	}
 
 	if gotLeadership {
-		lastTimestamp = time.Now()
 		ok, err := store.LeaderPeriodicUpdate(leaderID.String())
 		if err != nil && log.IsLogging(logger.ERROR) {
 			log.Error("%s\n", err)
 		}
 		if ok {
-			isLeader = true
+			setLeadership(true)
+			setLeaderAddress(common.Configuration.AdvertisedAddress)
 			if trace.IsLogging(logger.TRACE) {
 				trace.Trace("Have taken over as the leader")
 			}
@@ -66,9 +79,12 @@ func initializeLeadership() {
 
 // CheckIfLeader checks if the current process is the leader
 func CheckIfLeader() bool {
-	if common.Configuration.NodeType != common.CSS || common.Configuration.StorageProvider != common.Mongo {
+	if common.Configuration.NodeType != common.CSS || common.Configuration.StorageProvider != common.Mongo ||
+		common.Configuration.SingleNodeCSS {
 		return true
 	}
+	leadershipLock.RLock()
+	defer leadershipLock.RUnlock()
 	if !isLeader {
 		return false
 	}
@@ -79,6 +95,36 @@ func CheckIfLeader() bool {
 	return false
 }
 
+// setLeadership records whether the current process is the leader. Taking or renewing the leadership
+// updates its timestamp.
+func setLeadership(leader bool) {
+	leadershipLock.Lock()
+	isLeader = leader
+	if leader {
+		lastTimestamp = time.Now()
+	}
+	leadershipLock.Unlock()
+}
+
+// GetLeaderAddress returns the advertised address of the leader, or an empty string if it isn't known
+func GetLeaderAddress() string {
+	leaderAddressLock.RLock()
+	defer leaderAddressLock.RUnlock()
+	return leaderAddress
+}
+
+func setLeaderAddress(address string) {
+	leaderAddressLock.Lock()
+	leaderAddress = address
+	leaderAddressLock.Unlock()
+}
+
+// NotLeaderError returns the error for a request that only the leader can handle, received by a replica.
+// The error holds the address of the leader, if it is known, so that the request can be sent to the leader.
+func NotLeaderError(message string) common.SyncServiceError {
+	return &common.NotLeader{Message: message, LeaderAddress: GetLeaderAddress()}
+}
+
 // SetChangeLeaderCallback sets the callback to be called when the leadership changes
 func SetChangeLeaderCallback(callback func(bool) common.SyncServiceError) {
 	changeLeadership = callback
@@ -98,10 +144,13 @@ func startLeadershipPeriodicUpdate() {
 		for keepRunning {
 			select {
 			case <-leaderTicker.C:
+				if IsOwnershipSharded() {
+					updateOwnership()
+				}
 				if isLeader {
 					ok, err := store.LeaderPeriodicUpdate(leaderID.String())
 					if err != nil || !ok {
-						isLeader = false
+						setLeadership(false)
 						if changeLeadership != nil {
 							changeLeadership(false)
 						}
@@ -117,10 +166,10 @@ func startLeadershipPeriodicUpdate() {
 							trace.Trace("Have lost the leadership")
 						}
 					} else {
-						lastTimestamp = time.Now()
+						setLeadership(true)
 					}
 				} else {
-					_, heartbeatTimeout, lastHeartbeatTS, version, err := store.RetrieveLeader()
+					_, address, heartbeatTimeout, lastHeartbeatTS, version, err := store.RetrieveLeader()
 					if err != nil {
 						if storage.IsNotFound(err) {
 							initializeLeadership()
@@ -128,6 +177,7 @@ func startLeadershipPeriodicUpdate() {
 							log.Error("%s\n", err)
 						}
 					} else {
+						setLeaderAddress(address)
 						timeOnServer, err := store.RetrieveTimeOnServer()
 						if err != nil {
 							if log.IsLogging(logger.ERROR) {
@@ -146,8 +196,8 @@ func startLeadershipPeriodicUpdate() {
 									if changeLeadership != nil {
 										changeLeadership(true)
 									}
-									isLeader = true
-									lastTimestamp = time.Now()
+									setLeadership(true)
+									setLeaderAddress(common.Configuration.AdvertisedAddress)
 									if trace.IsLogging(logger.TRACE) {
 										trace.Trace("Have taken over as the leader")
 									}
@@ -173,5 +223,8 @@ func StopLeadershipPeriodicUpdate() {
 		leaderStopChannel <- 1
 
 		store.ResignLeadership(leaderID.String())
+		if IsOwnershipSharded() {
+			store.RemoveReplica(leaderID.String())
+		}
 	}
 }
@@ -0,0 +1,52 @@
+package leader
+
+import (
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestCheckIfLeader(t *testing.T) {
+	nodeType := common.Configuration.NodeType
+	storageProvider := common.Configuration.StorageProvider
+	singleNode := common.Configuration.SingleNodeCSS
+	leadershipTimeout := common.Configuration.LeadershipTimeout
+	defer func() {
+		common.Configuration.NodeType = nodeType
+		common.Configuration.StorageProvider = storageProvider
+		common.Configuration.SingleNodeCSS = singleNode
+		common.Configuration.LeadershipTimeout = leadershipTimeout
+		setLeadership(false)
+	}()
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.StorageProvider = common.Mongo
+	common.Configuration.LeadershipTimeout = 30
+
+	// Before the leadership is determined, a CSS with mongo storage isn't the leader
+	setLeadership(false)
+	if CheckIfLeader() {
+		t.Errorf("A CSS that didn't take the leadership is the leader")
+	}
+	if CheckIfOwner("myorg", "type1", "object1") {
+		t.Errorf("A CSS that didn't take the leadership owns the objects")
+	}
+
+	setLeadership(true)
+	if !CheckIfLeader() {
+		t.Errorf("A CSS that took the leadership isn't the leader")
+	}
+
+	// A single node CSS is always the leader, and doesn't start the leader election
+	setLeadership(false)
+	common.Configuration.SingleNodeCSS = true
+	if !CheckIfLeader() {
+		t.Errorf("A single node CSS isn't the leader")
+	}
+	if !CheckIfOwner("myorg", "type1", "object1") {
+		t.Errorf("A single node CSS doesn't own the objects")
+	}
+	StartLeaderDetermination(nil)
+	if leaderTicker != nil {
+		t.Errorf("A single node CSS started the leader election")
+	}
+}
@@ -0,0 +1,168 @@
+package leader
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// When ShardObjectOwnership is set, the objects are assigned to the CSS instances by consistent hashing.
+// Each instance is placed at several points of a hash ring, and owns the objects whose hash is the closest
+// before one of its points. When an instance joins or leaves, only the objects of the ring segments that
+// it takes or gives up move to another instance.
+
+const ringPointsPerReplica = 64
+
+type ringPoint struct {
+	hash      uint32
+	replicaID string
+}
+
+var ownershipRing []ringPoint
+var replicaAddresses map[string]string
+var lastOwnershipUpdate time.Time
+var ownershipLock sync.RWMutex
+
+var changeOwnership func()
+
+// IsOwnershipSharded returns true if the objects are assigned to the CSS instances, rather than all owned by the leader
+func IsOwnershipSharded() bool {
+	return common.Configuration.ShardObjectOwnership && common.Configuration.NodeType == common.CSS &&
+		common.Configuration.StorageProvider == common.Mongo
+}
+
+// CheckIfOwner checks if the current process owns the object, i.e., receives its chunked data.
+// When the ownership of the objects isn't sharded, the leader owns all the objects.
+func CheckIfOwner(orgID string, objectType string, objectID string) bool {
+	if !IsOwnershipSharded() {
+		return CheckIfLeader()
+	}
+
+	ownershipLock.RLock()
+	defer ownershipLock.RUnlock()
+	if len(ownershipRing) == 0 ||
+		time.Since(lastOwnershipUpdate) >= time.Second*time.Duration(common.Configuration.LeadershipTimeout) {
+		return false
+	}
+	return ringOwner(ownershipRing, common.HashStrings(orgID, objectType, objectID)) == leaderID.String()
+}
+
+// NotOwnerError returns the error for a request that only the object's owner can handle, received by another instance.
+// The error holds the address of the owner, if it is known, so that the request can be sent to the owner.
+func NotOwnerError(message string, orgID string, objectType string, objectID string) common.SyncServiceError {
+	if !IsOwnershipSharded() {
+		return NotLeaderError(message)
+	}
+
+	ownershipLock.RLock()
+	defer ownershipLock.RUnlock()
+	address := ""
+	if len(ownershipRing) != 0 {
+		address = replicaAddresses[ringOwner(ownershipRing, common.HashStrings(orgID, objectType, objectID))]
+	}
+	return &common.NotLeader{Message: message, LeaderAddress: address}
+}
+
+// SetChangeOwnershipCallback sets the callback to be called when the objects are reassigned to the CSS instances
+func SetChangeOwnershipCallback(callback func()) {
+	changeOwnership = callback
+}
+
+// updateOwnership records that the instance is alive, and reassigns the objects if instances joined or left
+func updateOwnership() {
+	if err := store.ReplicaPeriodicUpdate(leaderID.String()); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("%s\n", err)
+		}
+		return
+	}
+	updateTime := time.Now()
+
+	replicas, err := store.RetrieveReplicas()
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("%s\n", err)
+		}
+		return
+	}
+	timeOnServer, err := store.RetrieveTimeOnServer()
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("%s\n", err)
+		}
+		return
+	}
+
+	timeout := time.Second * time.Duration(common.Configuration.LeadershipTimeout)
+	liveReplicas := make([]storage.Replica, 0, len(replicas))
+	for _, replica := range replicas {
+		sinceHeartbeat := timeOnServer.Sub(replica.LastHeartbeat)
+		if sinceHeartbeat <= timeout || replica.ID == leaderID.String() {
+			liveReplicas = append(liveReplicas, replica)
+		} else if sinceHeartbeat > 10*timeout && CheckIfLeader() {
+			// The leader removes the entries of the instances that are gone
+			if err := store.RemoveReplica(replica.ID); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("%s\n", err)
+			}
+		}
+	}
+
+	addresses := make(map[string]string, len(liveReplicas))
+	for _, replica := range liveReplicas {
+		addresses[replica.ID] = replica.Address
+	}
+
+	ownershipLock.Lock()
+	changed := len(addresses) != len(replicaAddresses)
+	for id := range addresses {
+		if _, ok := replicaAddresses[id]; !ok {
+			changed = true
+		}
+	}
+	if changed {
+		ownershipRing = buildOwnershipRing(liveReplicas)
+	}
+	replicaAddresses = addresses
+	lastOwnershipUpdate = updateTime
+	ownershipLock.Unlock()
+
+	if changed {
+		if log.IsLogging(logger.INFO) {
+			log.Info("The objects are assigned to %d CSS instances\n", len(liveReplicas))
+		}
+		if changeOwnership != nil {
+			changeOwnership()
+		}
+	}
+}
+
+func buildOwnershipRing(replicas []storage.Replica) []ringPoint {
+	ring := make([]ringPoint, 0, len(replicas)*ringPointsPerReplica)
+	for _, replica := range replicas {
+		for i := 0; i < ringPointsPerReplica; i++ {
+			ring = append(ring, ringPoint{hash: common.HashStrings(replica.ID, ":", strconv.Itoa(i)), replicaID: replica.ID})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash != ring[j].hash {
+			return ring[i].hash < ring[j].hash
+		}
+		return ring[i].replicaID < ring[j].replicaID
+	})
+	return ring
+}
+
+// ringOwner returns the ID of the instance of the first point of the ring at or after the hash
+func ringOwner(ring []ringPoint, hash uint32) string {
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].replicaID
+}
@@ -0,0 +1,64 @@
+package leader
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestOwnershipRing(t *testing.T) {
+	replicas := []storage.Replica{{ID: "replica1"}, {ID: "replica2"}, {ID: "replica3"}}
+	owners := func(ring []ringPoint) map[string]string {
+		result := make(map[string]string)
+		for i := 0; i < 3000; i++ {
+			objectID := "object" + strconv.Itoa(i)
+			result[objectID] = ringOwner(ring, common.HashStrings("myorg", "type1", objectID))
+		}
+		return result
+	}
+
+	before := owners(buildOwnershipRing(replicas))
+	counts := make(map[string]int)
+	for _, owner := range before {
+		counts[owner]++
+	}
+	for _, replica := range replicas {
+		if counts[replica.ID] < 500 {
+			t.Errorf("%s owns only %d of 3000 objects", replica.ID, counts[replica.ID])
+		}
+	}
+
+	// The order of the replicas doesn't matter
+	reversed := []storage.Replica{replicas[2], replicas[1], replicas[0]}
+	for objectID, owner := range owners(buildOwnershipRing(reversed)) {
+		if before[objectID] != owner {
+			t.Errorf("The owner of %s depends on the order of the replicas", objectID)
+			break
+		}
+	}
+
+	// Only objects that the new replica takes move
+	after := owners(buildOwnershipRing(append(replicas, storage.Replica{ID: "replica4"})))
+	moved := 0
+	for objectID, owner := range after {
+		if before[objectID] != owner {
+			moved++
+			if owner != "replica4" {
+				t.Errorf("%s moved from %s to %s when replica4 joined", objectID, before[objectID], owner)
+			}
+		}
+	}
+	if moved == 0 {
+		t.Errorf("No object moved to replica4")
+	}
+
+	// Only objects of the replica that left move
+	after = owners(buildOwnershipRing(replicas[1:]))
+	for objectID, owner := range after {
+		if before[objectID] != owner && before[objectID] != "replica1" {
+			t.Errorf("%s moved from %s to %s when replica1 left", objectID, before[objectID], owner)
+		}
+	}
+}
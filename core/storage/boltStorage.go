@@ -37,11 +37,17 @@ type boltObject struct {
 	ConsumedTimestamp                time.Time                       `json:"consumed-timestamp"`
 	Destinations                     []common.StoreDestinationStatus `json:"destinations"`
 	RemovedDestinationPolicyServices []common.ServiceID              `json:"removed-destination-policy-services"`
+	PendingDeletion                  bool                            `json:"pending-deletion"`
+	DataCodec                        *ObjectDataCodec                `json:"data-codec,omitempty"`
 }
 
 type boltDestination struct {
-	Destination  common.Destination `json:"destination"`
-	LastPingTime time.Time          `json:"last-ping-time"`
+	Destination    common.Destination        `json:"destination"`
+	LastPingTime   time.Time                 `json:"last-ping-time"`
+	LastSeen       time.Time                 `json:"last-seen"`
+	MessageVersion common.SyncServiceVersion `json:"message-version"`
+	Paused         bool                      `json:"paused"`
+	Offline        bool                      `json:"offline"`
 }
 
 type boltMessagingGroup struct {
@@ -50,6 +56,18 @@ type boltMessagingGroup struct {
 	LastUpdate time.Time `json:"last-update"`
 }
 
+type boltGroupMember struct {
+	OrgID    string `json:"org-id"`
+	Group    string `json:"group"`
+	DestType string `json:"destination-type"`
+	DestID   string `json:"destination-id"`
+}
+
+type boltOrderSequence struct {
+	Sent      int64 `json:"sent"`
+	Delivered int64 `json:"delivered"`
+}
+
 type boltACL struct {
 	Usernames []string `json:"usernames"`
 	OrgID     string   `json:"org-id"`
@@ -58,14 +76,18 @@ type boltACL struct {
 }
 
 var (
-	objectsBucket         []byte
-	webhooksBucket        []byte
-	notificationsBucket   []byte
-	timebaseBucket        []byte
-	destinationsBucket    []byte
-	messagingGroupsBucket []byte
-	organizationsBucket   []byte
-	aclBucket             []byte
+	objectsBucket           []byte
+	webhooksBucket          []byte
+	notificationsBucket     []byte
+	timebaseBucket          []byte
+	destinationsBucket      []byte
+	messagingGroupsBucket   []byte
+	organizationsBucket     []byte
+	aclBucket               []byte
+	webhookDeliveriesBucket []byte
+	objectCleanupsBucket    []byte
+	destinationGroupsBucket []byte
+	orderSequencesBucket    []byte
 )
 
 // Init initializes the Bolt store
@@ -97,6 +119,10 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 	messagingGroupsBucket = []byte(messagingGroups)
 	organizationsBucket = []byte(organizations)
 	aclBucket = []byte(acls)
+	webhookDeliveriesBucket = []byte(webhookDeliveries)
+	objectCleanupsBucket = []byte(objectCleanups)
+	destinationGroupsBucket = []byte(destinationGroups)
+	orderSequencesBucket = []byte(orderSequences)
 
 	err = store.db.Update(func(tx *bolt.Tx) error {
 		_, err = tx.CreateBucketIfNotExists(objectsBucket)
@@ -127,6 +153,22 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 		if err != nil {
 			return err
 		}
+		_, err = tx.CreateBucketIfNotExists(webhookDeliveriesBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(objectCleanupsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(destinationGroupsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(orderSequencesBucket)
+		if err != nil {
+			return err
+		}
 		b, err := tx.CreateBucketIfNotExists(timebaseBucket)
 		if err != nil {
 			return err
@@ -222,12 +264,14 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 	// If the object was receieved from a service (status NotReadyToSend/ReadyToSend), i.e. this node is the origin of the object,
 	// set instance id. If the object was received from the other side, this node is the receiver of the object:
 	// keep the instance id of the meta data.
-	if status == common.NotReadyToSend || status == common.ReadyToSend {
+	isOrigin := status == common.NotReadyToSend || status == common.ReadyToSend
+	if isOrigin {
 		newID := store.getInstanceID()
 		metaData.InstanceID = newID
 		if data != nil && !metaData.NoData && !metaData.MetaOnly {
 			metaData.DataID = newID
 		}
+		metaData.InstanceSequence = 1
 
 		if common.Configuration.NodeType == common.CSS {
 			var err error
@@ -254,11 +298,15 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 			}
 
 			metaData.DataID = object.Meta.DataID // Keep the previous data id
+			if isOrigin {
+				metaData.InstanceSequence = object.Meta.InstanceSequence + 1
+			}
 			object.Meta = metaData
 			object.Status = status
 			object.PolicyReceived = false
 			object.RemainingConsumers = metaData.ExpectedConsumers
 			object.RemainingReceivers = metaData.ExpectedConsumers
+			object.PendingDeletion = false
 			if metaData.DestinationPolicy == nil {
 				object.Destinations = dests
 			}
@@ -272,19 +320,31 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 	}
 
 	var dataPath string
-	if !metaData.NoData && data != nil {
-		dataPath = createDataPathFromMeta(store.localDataPath, metaData)
-		if _, err := dataURI.StoreData(dataPath, bytes.NewReader(data), uint32(len(data))); err != nil {
+	var dataCodec *ObjectDataCodec
+	storesData := !metaData.NoData && data != nil
+	if storesData {
+		dataPath = store.createDataPathFromMeta(metaData)
+		var err common.SyncServiceError
+		if dataCodec, err = NewObjectDataCodec(); err != nil {
+			return nil, err
+		}
+		if _, err := storeDataFile(dataPath, dataCodec.NewEncodingReader(bytes.NewReader(data), 0), uint32(len(data))); err != nil {
+			return nil, err
+		}
+	} else if !metaData.MetaOnly && !metaData.NoData && !isOrigin && len(metaData.PatchRanges) != 0 {
+		// A patch update overwrites only the changed byte ranges of the existing data
+		dataPath = store.createDataPathFromMeta(metaData)
+		if err := prepareDataFilePatch(dataPath, metaData.ObjectSize); err != nil {
 			return nil, err
 		}
 	} else if !metaData.MetaOnly {
-		if err := dataURI.DeleteStoredData(createDataPathFromMeta(store.localDataPath, metaData)); err != nil {
+		if err := deleteDataFiles(createDataPathFromMeta(store.localDataPath, metaData)); err != nil {
 			return nil, err
 		}
 	}
 	newObject := boltObject{Meta: metaData, Status: status, PolicyReceived: false,
 		RemainingConsumers: metaData.ExpectedConsumers, RemainingReceivers: metaData.ExpectedConsumers,
-		DataPath: dataPath, Destinations: dests}
+		DataPath: dataPath, Destinations: dests, DataCodec: dataCodec}
 
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
 		if (object.Meta.DestinationPolicy == nil && metaData.DestinationPolicy != nil) ||
@@ -292,9 +352,17 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 			return object, &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
 		}
 
+		if !storesData {
+			// The existing data keeps its codec
+			newObject.DataCodec = object.DataCodec
+		}
+
 		if metaData.DestinationPolicy != nil {
 			newObject.Destinations = object.Destinations
 		}
+		if isOrigin {
+			newObject.Meta.InstanceSequence = object.Meta.InstanceSequence + 1
+		}
 		return newObject, nil
 	}
 	err := store.updateObjectHelper(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, function)
@@ -319,8 +387,8 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 // Return false and no error, if the object doesn't exist
 func (store *BoltStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 
-	dataPath := createDataPath(store.localDataPath, orgID, objectType, objectID)
-	written, err := dataURI.StoreData(dataPath, dataReader, 0)
+	dataPath := store.createDataPath(orgID, objectType, objectID)
+	written, err := storeDataFile(dataPath, dataReader, 0)
 	if err != nil {
 		return false, err
 	}
@@ -333,10 +401,12 @@ func (store *BoltStorage) StoreObjectData(orgID string, objectType string, objec
 			newID := store.getInstanceID()
 			object.Meta.InstanceID = newID
 			object.Meta.DataID = newID
+			object.Meta.InstanceSequence++
 		}
 
 		object.DataPath = dataPath
 		object.Meta.ObjectSize = written
+		object.DataCodec = encodingDataCodec(dataReader)
 
 		return object, nil
 	}
@@ -372,7 +442,7 @@ func (store *BoltStorage) RetrieveObjectData(orgID string, objectType string, ob
 	function := func(object boltObject) common.SyncServiceError {
 		var err error
 		if object.DataPath != "" {
-			dataReader, err = dataURI.GetData(object.DataPath)
+			dataReader, err = getDataFile(object.DataPath)
 			return err
 		}
 		return nil
@@ -404,6 +474,53 @@ func (store *BoltStorage) RetrieveObjectAndStatus(orgID string, objectType strin
 	return meta, status, nil
 }
 
+// RetrieveObjectDataCodec returns the codec of the object's data, or nil if the data isn't encoded or the object doesn't exist
+func (store *BoltStorage) RetrieveObjectDataCodec(orgID string, objectType string, objectID string) (*ObjectDataCodec, common.SyncServiceError) {
+	var codec *ObjectDataCodec
+	function := func(object boltObject) common.SyncServiceError {
+		codec = object.DataCodec
+		return nil
+	}
+	if err := store.viewObjectHelper(orgID, objectType, objectID, function); err != nil {
+		if common.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return codec, nil
+}
+
+// RetrieveObjectsWithOtherDataKey returns the objects whose data is encrypted with a key other than keyID
+func (store *BoltStorage) RetrieveObjectsWithOtherDataKey(keyID string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if object.DataPath != "" && (object.DataCodec == nil || object.DataCodec.KeyID != keyID) {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StoreReencryptedObjectData replaces the object's data with the same data read from dataReader, encoded with codec,
+// and records the codec
+func (store *BoltStorage) StoreReencryptedObjectData(orgID string, objectType string, objectID string, codec *ObjectDataCodec,
+	dataReader io.Reader) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		if dataReader != nil && object.DataPath != "" {
+			// The data file is replaced, the readers that already opened it, including dataReader, keep reading the previous data
+			if _, err := storeDataFile(object.DataPath, dataReader, 0); err != nil {
+				return object, err
+			}
+		}
+		object.DataCodec = codec
+		return object, nil
+	}
+	return store.updateObjectHelper(orgID, objectType, objectID, function)
+}
+
 // RetrieveObjectStatus finds the object and returns its status
 func (store *BoltStorage) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
 	var status string
@@ -442,6 +559,25 @@ func (store *BoltStorage) RetrieveUpdatedObjects(orgID string, objectType string
 	return result, nil
 }
 
+// RetrieveObjectsWithStatus returns the objects of the type that have the given status
+func (store *BoltStorage) RetrieveObjectsWithStatus(orgID string, objectType string, status string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if orgID == object.Meta.DestOrgID && objectType == object.Meta.ObjectType && object.Status == status {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	if len(common.Configuration.ObjectsDataPath) > 0 {
+		for i := 0; i < len(result); i++ {
+			result[i].DestinationDataURI = createDataPathFromMeta(store.localDataPath, result[i])
+		}
+	}
+	return result, nil
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *BoltStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -651,10 +787,14 @@ func (store *BoltStorage) RetrieveObjects(orgID string, destType string, destID
 		return result, nil
 	}
 
+	groups, err := store.RetrieveDestinationGroups(orgID, destType, destID)
+	if err != nil {
+		return nil, err
+	}
+
 	function := func(object boltObject) (*boltObject, common.SyncServiceError) {
 		if object.Meta.DestinationPolicy == nil && orgID == object.Meta.DestOrgID &&
-			(object.Meta.DestType == "" || object.Meta.DestType == destType) &&
-			(object.Meta.DestID == "" || object.Meta.DestID == destID) {
+			objectSentToDestination(object.Meta, object.Destinations, destType, destID) && objectSentToGroups(object.Meta, groups) {
 			status := common.Pending
 			if object.Status == common.ReadyToSend && !object.Meta.Inactive {
 				status = common.Delivering
@@ -662,10 +802,11 @@ func (store *BoltStorage) RetrieveObjects(orgID string, destType string, destID
 			needToUpdate := false
 
 			// Add destination if it doesn't exist in the destinations list
-			if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil && dest != nil {
+			if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil && dest != nil &&
+				common.MatchDestinationAttributes(object.Meta.DestinationAttributes, dest.Attributes) {
 				existingDestIndex := -1
 				for i, d := range object.Destinations {
-					if d.Destination == *dest {
+					if common.SameDestination(d.Destination, *dest) {
 						existingDestIndex = i
 						break
 					}
@@ -715,6 +856,26 @@ func (store *BoltStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, co
 	return result, nil
 }
 
+// RetrieveObjectsToEvict returns the objects to remove to keep the size of the stored data below the storage's limit.
+// The bolt storage has no limit.
+func (store *BoltStorage) RetrieveObjectsToEvict() ([]common.MetaData, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveReceivedObjects returns all the objects that were completely received from the other side and not deleted
+func (store *BoltStorage) RetrieveReceivedObjects() ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if object.Status == common.CompletelyReceived || object.Status == common.ObjReceived || object.Status == common.ObjConsumed {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // GetObjectsToActivate returns inactive objects that are ready to be activated
 func (store *BoltStorage) GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError) {
 	currentTime := time.Now().UTC().Format(time.RFC3339)
@@ -733,26 +894,118 @@ func (store *BoltStorage) GetObjectsToActivate() ([]common.MetaData, common.Sync
 	return result, nil
 }
 
+// GetExpiredObjects returns the objects originated by this node whose expiration time has passed
+func (store *BoltStorage) GetExpiredObjects() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if (object.Status == common.NotReadyToSend || object.Status == common.ReadyToSend) &&
+			object.Meta.Expiration != "" && object.Meta.Expiration <= currentTime {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetOverdueObjects returns the objects originated by this node whose delivery deadline has passed
+func (store *BoltStorage) GetOverdueObjects() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if (object.Status == common.NotReadyToSend || object.Status == common.ReadyToSend) &&
+			object.Meta.DeliverBy != "" && object.Meta.DeliverBy <= currentTime {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteObjectsWithFilter marks the objects originated by this node that meet the given conditions as pending deletion
+func (store *BoltStorage) DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) (int, common.SyncServiceError) {
+	count := 0
+	function := func(object boltObject) (*boltObject, common.SyncServiceError) {
+		if orgID != object.Meta.DestOrgID || (object.Status != common.NotReadyToSend && object.Status != common.ReadyToSend) ||
+			!objectMatchesFilter(object.Meta, objectType, destinationType, destinationID, expirationTimeBefore) {
+			return nil, nil
+		}
+		object.PendingDeletion = true
+		count++
+		return &object, nil
+	}
+	if err := store.updateObjectsHelper(function); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RetrieveObjectsPendingDeletion returns the objects originated by this node that are marked as pending deletion
+func (store *BoltStorage) RetrieveObjectsPendingDeletion() ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if object.PendingDeletion && (object.Status == common.NotReadyToSend || object.Status == common.ReadyToSend) {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // AppendObjectData appends a chunk of data to the object's data
 func (store *BoltStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
 	offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	dataPath, err := store.appendDataPath(orgID, objectType, objectID, isFirstChunk, encodingDataCodec(dataReader))
+	if err != nil {
+		return err
+	}
+	return appendDataFile(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+}
+
+// AppendObjectZeroData appends a chunk of zeros to the object's data. The zeros aren't written to an uncompressed data file,
+// it is extended over them sparsely.
+func (store *BoltStorage) AppendObjectZeroData(orgID string, objectType string, objectID string, length uint32, offset int64,
+	total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	dataPath, err := store.appendDataPath(orgID, objectType, objectID, isFirstChunk, nil)
+	if err != nil {
+		return err
+	}
+	if isCompressedDataPath(dataPath) {
+		return appendDataFile(dataPath, NewZeroReader(int64(length)), length, offset, total, isFirstChunk, isLastChunk)
+	}
+	return dataURI.AppendZeroData(dataPath, length, offset, isLastChunk)
+}
 
+// appendDataPath returns the path of the object's data that chunks are appended to, the path is created for the first chunk.
+// The codec of the data is recorded with the first chunk.
+func (store *BoltStorage) appendDataPath(orgID string, objectType string, objectID string, isFirstChunk bool,
+	codec *ObjectDataCodec) (string, common.SyncServiceError) {
 	dataPath := ""
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		if isFirstChunk {
+			object.DataCodec = codec
+		}
 		dataPath = object.DataPath
 		if dataPath == "" {
 			if !isFirstChunk {
 				return object, &Error{"No path to store data"}
 			}
-			dataPath = createDataPathFromMeta(store.localDataPath, object.Meta)
+			dataPath = store.createDataPathFromMeta(object.Meta)
 			object.DataPath = dataPath
 		}
 		return object, nil
 	}
 	if err := store.updateObjectHelper(orgID, objectType, objectID, function); err != nil {
-		return err
+		return "", err
 	}
-	return dataURI.AppendData(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	return dataPath, nil
 }
 
 // UpdateObjectStatus updates an object's status
@@ -767,6 +1020,28 @@ func (store *BoltStorage) UpdateObjectStatus(orgID string, objectType string, ob
 	return store.updateObjectHelper(orgID, objectType, objectID, function)
 }
 
+// UpdateObjectMetadataOnly applies a metadata only update, received from the other side, to the stored object in place
+func (store *BoltStorage) UpdateObjectMetadataOnly(metaData common.MetaData, status string) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		if object.Status == common.ConsumedByDest {
+			// On ESS we remove the data of consumed objects, therefore we can't accept "meta only" updates
+			return object, &common.InvalidRequest{Message: "Can't update only the meta data of consumed object"}
+		}
+		metaData.DataID = object.Meta.DataID
+		metaData.ObjectSize = object.Meta.ObjectSize
+		metaData.ChunkSize = object.Meta.ChunkSize
+		metaData.PatchRanges = object.Meta.PatchRanges
+		object.Meta = metaData
+		object.Status = status
+		object.PolicyReceived = false
+		object.RemainingConsumers = metaData.ExpectedConsumers
+		object.RemainingReceivers = metaData.ExpectedConsumers
+		object.PendingDeletion = false
+		return object, nil
+	}
+	return store.updateObjectHelper(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, function)
+}
+
 // UpdateObjectSourceDataURI pdates object's source data URI
 func (store *BoltStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
@@ -776,6 +1051,15 @@ func (store *BoltStorage) UpdateObjectSourceDataURI(orgID string, objectType str
 	return store.updateObjectHelper(orgID, objectType, objectID, function)
 }
 
+// UpdateObjectPriority updates the priority of the transfers of the object's data
+func (store *BoltStorage) UpdateObjectPriority(orgID string, objectType string, objectID string, priority int) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		object.Meta.Priority = priority
+		return object, nil
+	}
+	return store.updateObjectHelper(orgID, objectType, objectID, function)
+}
+
 // RetrieveObjectRemainingConsumers finds the object and returns the number of remaining consumers
 // that haven't consumed the object yet
 func (store *BoltStorage) RetrieveObjectRemainingConsumers(orgID string, objectType string, objectID string) (int, common.SyncServiceError) {
@@ -833,19 +1117,26 @@ func (store *BoltStorage) DecrementAndReturnRemainingReceivers(orgID string, obj
 
 // CloseDataReader closes the data reader if necessary
 func (store *BoltStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
-	switch v := dataReader.(type) {
+	switch v := unwrapDataReader(dataReader).(type) {
 	case *os.File:
 		return v.Close()
+	case *compressedDataReader:
+		return v.Close()
 	}
 	return nil
 }
 
+// OpenObjectDataReader opens a reader of the object's data positioned at offset, for reading consecutive chunks
+func (store *BoltStorage) OpenObjectDataReader(orgID string, objectType string, objectID string, offset int64) (ObjectDataReader, common.SyncServiceError) {
+	return openObjectDataReader(store, orgID, objectType, objectID, offset)
+}
+
 // ReadObjectData returns the object data with the specified parameters
 func (store *BoltStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) (data []byte,
 	eof bool, length int, err common.SyncServiceError) {
 	function := func(object boltObject) common.SyncServiceError {
 		if object.DataPath != "" {
-			data, eof, length, err = dataURI.GetDataChunk(object.DataPath, size, offset)
+			data, eof, length, err = getDataFileChunk(object.DataPath, size, offset)
 			return err
 		}
 		eof = true
@@ -1023,7 +1314,8 @@ func (store *BoltStorage) UpdateObjectDeliveryStatus(status string, message stri
 		allConsumed := true
 		for i, d := range object.Destinations {
 			if !found && d.Destination.DestType == destType && d.Destination.DestID == destID {
-				if message != "" || d.Status == common.Error {
+				// The message of an error or of a pending delivery (e.g. waiting for storage space) is cleared by the next status
+				if message != "" || d.Status == common.Error || d.Status == common.Rejected || d.Status == common.Pending {
 					object.Destinations[i].Message = message
 				}
 				if status != "" {
@@ -1052,6 +1344,27 @@ func (store *BoltStorage) UpdateObjectDeliveryStatus(status string, message stri
 	return (allDeleted && status == common.Deleted), err
 }
 
+// UpdateObjectConsumedOffset records the offset up to which the destination consumed the object's data
+func (store *BoltStorage) UpdateObjectConsumedOffset(orgID string, objectType string, objectID string, destType string, destID string,
+	offset int64) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		for i, d := range object.Destinations {
+			if d.Destination.DestType == destType && d.Destination.DestID == destID {
+				if offset > d.ConsumedOffset {
+					object.Destinations[i].ConsumedOffset = offset
+				}
+				return object, nil
+			}
+		}
+		return object, &Error{"Failed to find destination."}
+	}
+	return store.updateObjectHelper(orgID, objectType, objectID, function)
+}
+
 // UpdateObjectDelivering marks the object as being delivered to all its destinations
 func (store *BoltStorage) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
@@ -1060,6 +1373,9 @@ func (store *BoltStorage) UpdateObjectDelivering(orgID string, objectType string
 
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
 		for i := range object.Destinations {
+			if object.Destinations[i].Status == common.Pending {
+				object.Destinations[i].Message = ""
+			}
 			object.Destinations[i].Status = common.Delivering
 		}
 		return object, nil
@@ -1140,6 +1456,94 @@ func (store *BoltStorage) RetrieveWebhooks(orgID string, objectType string) ([]s
 	return hooks, nil
 }
 
+// StoreWebhookDelivery stores or updates a webhook call to be retried
+func (store *BoltStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	encoded, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	id := getWebhookDeliveryID(delivery)
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookDeliveriesBucket).Put([]byte(id), encoded)
+	})
+	return err
+}
+
+// DeleteWebhookDelivery deletes a webhook call
+func (store *BoltStorage) DeleteWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	id := getWebhookDeliveryID(delivery)
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookDeliveriesBucket).Delete([]byte(id))
+	})
+	return err
+}
+
+// RetrieveWebhookDeliveries returns the webhook calls to be retried, or the dead-lettered ones if deadLetter is true
+func (store *BoltStorage) RetrieveWebhookDeliveries(deadLetter bool) ([]common.WebhookDelivery, common.SyncServiceError) {
+	result := make([]common.WebhookDelivery, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(webhookDeliveriesBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var delivery common.WebhookDelivery
+			if err := json.Unmarshal(value, &delivery); err != nil {
+				return err
+			}
+			if delivery.DeadLetter == deadLetter {
+				result = append(result, delivery)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StoreObjectCleanup stores or updates a removal of an object to be retried
+func (store *BoltStorage) StoreObjectCleanup(cleanup common.ObjectCleanup) common.SyncServiceError {
+	encoded, err := json.Marshal(cleanup)
+	if err != nil {
+		return err
+	}
+
+	id := createObjectCollectionID(cleanup.MetaData.DestOrgID, cleanup.MetaData.ObjectType, cleanup.MetaData.ObjectID)
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(objectCleanupsBucket).Put([]byte(id), encoded)
+	})
+	return err
+}
+
+// DeleteObjectCleanup deletes a removal of an object to be retried
+func (store *BoltStorage) DeleteObjectCleanup(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(objectCleanupsBucket).Delete([]byte(id))
+	})
+	return err
+}
+
+// RetrieveObjectCleanups returns the removals of objects to be retried
+func (store *BoltStorage) RetrieveObjectCleanups() ([]common.ObjectCleanup, common.SyncServiceError) {
+	result := make([]common.ObjectCleanup, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(objectCleanupsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var cleanup common.ObjectCleanup
+			if err := json.Unmarshal(value, &cleanup); err != nil {
+				return err
+			}
+			result = append(result, cleanup)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *BoltStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	if common.Configuration.NodeType == common.ESS {
@@ -1186,16 +1590,23 @@ func (store *BoltStorage) StoreDestination(destination common.Destination) commo
 		return nil
 	}
 
-	dest := boltDestination{Destination: destination, LastPingTime: time.Now()}
-	encoded, err := json.Marshal(dest)
-	if err != nil {
-		return err
-	}
+	now := time.Now()
+	dest := boltDestination{Destination: destination, LastPingTime: now, LastSeen: now}
 
 	id := getDestinationCollectionID(destination)
-	err = store.db.Update(func(tx *bolt.Tx) error {
-		err = tx.Bucket(destinationsBucket).Put([]byte(id), []byte(encoded))
-		return err
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		// A destination that registers again stays paused, and is no longer offline
+		if encoded := tx.Bucket(destinationsBucket).Get([]byte(id)); encoded != nil {
+			var existing boltDestination
+			if err := json.Unmarshal(encoded, &existing); err == nil {
+				dest.Paused = existing.Paused
+			}
+		}
+		encoded, err := json.Marshal(dest)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(destinationsBucket).Put([]byte(id), []byte(encoded))
 	})
 	return err
 }
@@ -1228,19 +1639,255 @@ func (store *BoltStorage) UpdateDestinationLastPingTime(destination common.Desti
 	return store.updateDestinationHelper(id, function)
 }
 
-// RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
-func (store *BoltStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
+// UpdateDestinationLastSeen updates the time the destination was last seen (for CSS)
+func (store *BoltStorage) UpdateDestinationLastSeen(destination common.Destination) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
-		return
+		return nil
 	}
 
-	toBeDeleted := make([]common.Destination, 0)
-	function := func(dest boltDestination) bool {
-		if dest.LastPingTime.Before(lastTimestamp) {
-			toBeDeleted = append(toBeDeleted, dest.Destination)
-			return true
-		}
-		return false
+	function := func(dest boltDestination) boltDestination {
+		dest.LastSeen = time.Now()
+		return dest
+	}
+	id := getDestinationCollectionID(destination)
+	return store.updateDestinationHelper(id, function)
+}
+
+// RetrieveDestinationLastSeen returns the time the destination was last seen (for CSS)
+func (store *BoltStorage) RetrieveDestinationLastSeen(orgID string, destType string, destID string) (time.Time, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return time.Time{}, nil
+	}
+
+	dest, err := store.retrieveBoltDestination(orgID, destType, destID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return dest.LastSeen, nil
+}
+
+// UpdateDestinationMessageVersion updates the message version negotiated with the destination (for CSS)
+func (store *BoltStorage) UpdateDestinationMessageVersion(destination common.Destination, version common.SyncServiceVersion) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	function := func(dest boltDestination) boltDestination {
+		dest.MessageVersion = version
+		return dest
+	}
+	id := getDestinationCollectionID(destination)
+	return store.updateDestinationHelper(id, function)
+}
+
+// RetrieveDestinationMessageVersion returns the message version negotiated with the destination (for CSS)
+func (store *BoltStorage) RetrieveDestinationMessageVersion(orgID string, destType string, destID string) (common.SyncServiceVersion, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return common.SyncServiceVersion{}, nil
+	}
+
+	dest, err := store.retrieveBoltDestination(orgID, destType, destID)
+	if err != nil {
+		return common.SyncServiceVersion{}, err
+	}
+	return dest.MessageVersion, nil
+}
+
+// UpdateDestinationPaused pauses or resumes sending data to the destination (for CSS)
+func (store *BoltStorage) UpdateDestinationPaused(orgID string, destType string, destID string, paused bool) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	function := func(dest boltDestination) boltDestination {
+		dest.Paused = paused
+		return dest
+	}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	return store.updateDestinationHelper(id, function)
+}
+
+// RetrieveDestinationPaused returns true if sending data to the destination is paused (for CSS)
+func (store *BoltStorage) RetrieveDestinationPaused(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return false, nil
+	}
+
+	dest, err := store.retrieveBoltDestination(orgID, destType, destID)
+	if err != nil {
+		return false, err
+	}
+	return dest.Paused, nil
+}
+
+// UpdateDestinationOffline marks the destination as offline or online (for CSS)
+func (store *BoltStorage) UpdateDestinationOffline(orgID string, destType string, destID string, offline bool) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	function := func(dest boltDestination) boltDestination {
+		dest.Offline = offline
+		return dest
+	}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	return store.updateDestinationHelper(id, function)
+}
+
+// RetrieveDestinationOffline returns true if the destination is offline (for CSS)
+func (store *BoltStorage) RetrieveDestinationOffline(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return false, nil
+	}
+
+	dest, err := store.retrieveBoltDestination(orgID, destType, destID)
+	if err != nil {
+		return false, err
+	}
+	return dest.Offline, nil
+}
+
+// UpdateDestinationAvailableSpace updates the storage space that the destination reported as available (for CSS)
+func (store *BoltStorage) UpdateDestinationAvailableSpace(destination common.Destination) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	function := func(dest boltDestination) boltDestination {
+		dest.Destination.AvailableSpace = destination.AvailableSpace
+		return dest
+	}
+	id := getDestinationCollectionID(destination)
+	return store.updateDestinationHelper(id, function)
+}
+
+// AddDestinationToGroup adds the destination to the destination group (for CSS)
+func (store *BoltStorage) AddDestinationToGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	encoded, err := json.Marshal(boltGroupMember{OrgID: orgID, Group: group, DestType: destType, DestID: destID})
+	if err != nil {
+		return err
+	}
+
+	id := createGroupMemberCollectionID(orgID, group, destType, destID)
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(destinationGroupsBucket).Put([]byte(id), encoded)
+	})
+	return err
+}
+
+// RemoveDestinationFromGroup removes the destination from the destination group (for CSS)
+func (store *BoltStorage) RemoveDestinationFromGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	id := createGroupMemberCollectionID(orgID, group, destType, destID)
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(destinationGroupsBucket).Delete([]byte(id))
+	})
+	return err
+}
+
+// RetrieveGroupMembers returns the registered destinations that are members of the destination group (for CSS)
+func (store *BoltStorage) RetrieveGroupMembers(orgID string, group string) ([]common.Destination, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	members := make([]boltGroupMember, 0)
+	function := func(member boltGroupMember) {
+		if member.OrgID == orgID && member.Group == group {
+			members = append(members, member)
+		}
+	}
+	if err := store.retrieveGroupMembersHelper(function); err != nil {
+		return nil, err
+	}
+
+	result := make([]common.Destination, 0)
+	for _, member := range members {
+		if dest, err := store.RetrieveDestination(orgID, member.DestType, member.DestID); err == nil && dest != nil {
+			result = append(result, *dest)
+		}
+	}
+	return result, nil
+}
+
+// RetrieveDestinationGroups returns the names of the destination groups the destination is a member of (for CSS)
+func (store *BoltStorage) RetrieveDestinationGroups(orgID string, destType string, destID string) ([]string, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	result := make([]string, 0)
+	function := func(member boltGroupMember) {
+		if member.OrgID == orgID && member.DestType == destType && member.DestID == destID {
+			result = append(result, member.Group)
+		}
+	}
+	if err := store.retrieveGroupMembersHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *BoltStorage) retrieveBoltDestination(orgID string, destType string, destID string) (*boltDestination, common.SyncServiceError) {
+	var result *boltDestination
+	function := func(dest boltDestination) {
+		if orgID == dest.Destination.DestOrgID && destType == dest.Destination.DestType && destID == dest.Destination.DestID {
+			result = &dest
+		}
+	}
+
+	if err := store.retrieveDestinationsHelper(function); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, &NotFound{"Destination not found"}
+	}
+	return result, nil
+}
+
+// RetrieveDestinationsInfo returns all the destinations with the provided orgID and destType, the time
+// they were last seen, their message versions, and whether they are paused or offline (for CSS)
+func (store *BoltStorage) RetrieveDestinationsInfo(orgID string, destType string) ([]common.DestinationInfo, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	result := make([]common.DestinationInfo, 0)
+	function := func(dest boltDestination) {
+		if (orgID == "" || orgID == dest.Destination.DestOrgID) &&
+			(destType == "" || destType == dest.Destination.DestType) {
+			result = append(result, common.DestinationInfo{Destination: dest.Destination, LastSeen: dest.LastSeen,
+				MessageVersion: dest.MessageVersion, Paused: dest.Paused, Offline: dest.Offline})
+		}
+	}
+
+	if err := store.retrieveDestinationsHelper(function); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
+func (store *BoltStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
+	if common.Configuration.NodeType == common.ESS {
+		return
+	}
+
+	toBeDeleted := make([]common.Destination, 0)
+	function := func(dest boltDestination) bool {
+		if dest.LastPingTime.Before(lastTimestamp) {
+			toBeDeleted = append(toBeDeleted, dest.Destination)
+			return true
+		}
+		return false
 	}
 
 	err := store.deleteDestinationsHelper(function)
@@ -1316,7 +1963,7 @@ func (store *BoltStorage) GetObjectsForDestination(orgID string, destType string
 		if notification.DestOrgID == orgID && notification.DestType == destType && notification.DestID == destID &&
 			(notification.Status == common.Update || notification.Status == common.UpdatePending || notification.Status == common.Updated ||
 				notification.Status == common.ReceivedByDestination || notification.Status == common.ConsumedByDestination ||
-				notification.Status == common.Error) {
+				notification.Status == common.Error || notification.Status == common.Rejected) {
 			notificationRecords = append(notificationRecords, notification)
 		}
 	}
@@ -1341,6 +1988,8 @@ func (store *BoltStorage) GetObjectsForDestination(orgID string, destType string
 			status = common.Consumed
 		case common.Error:
 			status = common.Error
+		case common.Rejected:
+			status = common.Rejected
 		}
 		objectStatus := common.ObjectStatus{OrgID: orgID, ObjectType: n.ObjectType, ObjectID: n.ObjectID, Status: status}
 		objectStatuses = append(objectStatuses, objectStatus)
@@ -1348,6 +1997,26 @@ func (store *BoltStorage) GetObjectsForDestination(orgID string, destType string
 	return objectStatuses, nil
 }
 
+// RetrievePendingObjects returns the objects that are pending delivery to the destination and their delivery status
+func (store *BoltStorage) RetrievePendingObjects(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+	objectStatuses := make([]common.ObjectStatus, 0)
+	function := func(notification common.Notification) {
+		if notification.DestOrgID == orgID && notification.DestType == destType && notification.DestID == destID {
+			if status, ok := pendingDeliveryStatus(notification.Status); ok {
+				objectStatuses = append(objectStatuses, common.ObjectStatus{OrgID: orgID, ObjectType: notification.ObjectType,
+					ObjectID: notification.ObjectID, Status: status})
+			}
+		}
+	}
+	if err := store.retrieveNotificationsHelper(function); err != nil {
+		return nil, err
+	}
+	return objectStatuses, nil
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 func (store *BoltStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(destOrgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	// 1. retrieve metadata
@@ -1424,8 +2093,11 @@ func (store *BoltStorage) UpdateRemovedDestinationPolicyServices(orgID string, o
 
 // UpdateNotificationRecord updates/adds a notification record to the object
 func (store *BoltStorage) UpdateNotificationRecord(notification common.Notification) common.SyncServiceError {
-	if notification.ResendTime == 0 {
-		notification.ResendTime = time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	if notification.Status == common.Rejected {
+		// The destination rejected the object, the notification is never resent
+		notification.ResendTime = 0
+	} else if notification.ResendTime == 0 {
+		notification.ResendTime = time.Now().Unix() + int64(common.Configuration.NotificationResendInterval*6)
 	}
 	function := func(*common.Notification) (*common.Notification, common.SyncServiceError) {
 		return &notification, nil
@@ -1433,9 +2105,9 @@ func (store *BoltStorage) UpdateNotificationRecord(notification common.Notificat
 	return store.updateNotificationHelper(notification, function)
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.NotificationResendInterval*6
 func (store *BoltStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
-	resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	resendTime := time.Now().Unix() + int64(common.Configuration.NotificationResendInterval*6)
 	function := func(notification *common.Notification) (*common.Notification, common.SyncServiceError) {
 		if notification != nil {
 			notification.ResendTime = resendTime
@@ -1544,6 +2216,139 @@ func (store *BoltStorage) RetrievePendingNotifications(orgID string, destType st
 	return result, nil
 }
 
+// RetrieveNotificationsWithStatus returns the list of the notifications that have the given status
+func (store *BoltStorage) RetrieveNotificationsWithStatus(orgID string, status string) ([]common.Notification, common.SyncServiceError) {
+	result := make([]common.Notification, 0)
+	function := func(notification common.Notification) {
+		if (orgID == "" || orgID == notification.DestOrgID) && notification.Status == status {
+			result = append(result, notification)
+		}
+	}
+	if err := store.retrieveNotificationsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetNumberOfNotificationRecords returns the number of notification records of the destination
+func (store *BoltStorage) GetNumberOfNotificationRecords(orgID string, destType string, destID string) (uint32, common.SyncServiceError) {
+	var count uint32
+	function := func(notification common.Notification) {
+		if notification.DestOrgID == orgID && notification.DestType == destType && notification.DestID == destID {
+			count++
+		}
+	}
+	if err := store.retrieveNotificationsHelper(function); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// IterateNotificationRecords calls the function with each of the notification records.
+// The records are iterated in a read transaction, that is, over a consistent snapshot of the records.
+func (store *BoltStorage) IterateNotificationRecords(iterate func(common.Notification) error) common.SyncServiceError {
+	var iterateErr error
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(notificationsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var notification common.Notification
+			if err := json.Unmarshal(value, &notification); err != nil {
+				return err
+			}
+			if iterateErr = iterate(notification); iterateErr != nil {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to iterate over the notifications. Error: %s.", err)}
+	}
+	return iterateErr
+}
+
+// RetrieveOrderedNotifications returns the notification records of the objects of the type that are delivered in order
+// to the destination
+func (store *BoltStorage) RetrieveOrderedNotifications(orgID string, objectType string, destType string, destID string) ([]common.Notification,
+	common.SyncServiceError) {
+	result := make([]common.Notification, 0)
+	function := func(notification common.Notification) {
+		if notification.DestOrgID == orgID && notification.ObjectType == objectType && notification.DestType == destType &&
+			notification.DestID == destID && notification.OrderSequence != 0 {
+			result = append(result, notification)
+		}
+	}
+	if err := store.retrieveNotificationsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// IncrementOrderSequence increments the order sequence number of the objects of the type that are sent to the destination
+func (store *BoltStorage) IncrementOrderSequence(orgID string, objectType string, destType string, destID string) (int64,
+	common.SyncServiceError) {
+	var sequence boltOrderSequence
+	err := store.updateOrderSequence(orgID, objectType, destType, destID, func(orderSequence *boltOrderSequence) {
+		orderSequence.Sent++
+		sequence = *orderSequence
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sequence.Sent, nil
+}
+
+// RetrieveDeliveredOrderSequence returns the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *BoltStorage) RetrieveDeliveredOrderSequence(orgID string, objectType string, originType string, originID string) (int64,
+	common.SyncServiceError) {
+	var sequence boltOrderSequence
+	id := createOrderSequenceCollectionID(orgID, objectType, originType, originID)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		if encoded := tx.Bucket(orderSequencesBucket).Get([]byte(id)); encoded != nil {
+			return json.Unmarshal(encoded, &sequence)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sequence.Delivered, nil
+}
+
+// UpdateDeliveredOrderSequence updates the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *BoltStorage) UpdateDeliveredOrderSequence(orgID string, objectType string, originType string, originID string,
+	sequence int64) common.SyncServiceError {
+	return store.updateOrderSequence(orgID, objectType, originType, originID, func(orderSequence *boltOrderSequence) {
+		orderSequence.Delivered = sequence
+	})
+}
+
+func (store *BoltStorage) updateOrderSequence(orgID string, objectType string, destType string, destID string,
+	update func(*boltOrderSequence)) common.SyncServiceError {
+	id := []byte(createOrderSequenceCollectionID(orgID, objectType, destType, destID))
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(orderSequencesBucket)
+		var orderSequence boltOrderSequence
+		if encoded := bucket.Get(id); encoded != nil {
+			if err := json.Unmarshal(encoded, &orderSequence); err != nil {
+				return err
+			}
+		}
+		update(&orderSequence)
+		encoded, err := json.Marshal(orderSequence)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(id, encoded)
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to update the order sequence. Error: %s.", err)}
+	}
+	return nil
+}
+
 // InsertInitialLeader inserts the initial leader entry
 func (store *BoltStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	return true, nil
@@ -1554,9 +2359,9 @@ func (store *BoltStorage) LeaderPeriodicUpdate(leaderID string) (bool, common.Sy
 	return false, nil
 }
 
-// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader document
-func (store *BoltStorage) RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError) {
-	return "", 0, time.Now(), 0, nil
+// RetrieveLeader retrieves the leader's ID and address, the Heartbeat timeout and Last heartbeat time stamp from the leader document
+func (store *BoltStorage) RetrieveLeader() (string, string, int32, time.Time, int64, common.SyncServiceError) {
+	return "", "", 0, time.Now(), 0, nil
 }
 
 // UpdateLeader updates the leader entry for a leadership takeover
@@ -1569,6 +2374,21 @@ func (store *BoltStorage) ResignLeadership(leaderID string) common.SyncServiceEr
 	return nil
 }
 
+// ReplicaPeriodicUpdate does the periodic update of the replica's entry
+func (store *BoltStorage) ReplicaPeriodicUpdate(replicaID string) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveReplicas retrieves the replicas' IDs, addresses and last heartbeat time stamps
+func (store *BoltStorage) RetrieveReplicas() ([]Replica, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RemoveReplica removes the replica's entry
+func (store *BoltStorage) RemoveReplica(replicaID string) common.SyncServiceError {
+	return nil
+}
+
 // RetrieveTimeOnServer retrieves the current time on the database server
 func (store *BoltStorage) RetrieveTimeOnServer() (time.Time, error) {
 	return time.Now(), nil
@@ -1680,6 +2500,34 @@ func (store *BoltStorage) DeleteOrganization(orgID string) common.SyncServiceErr
 		return &Error{fmt.Sprintf("Failed to delete notifications. Error: %s.", err)}
 	}
 
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(destinationGroupsBucket).Cursor()
+		prefix := []byte(orgID + ":")
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete destination groups. Error: %s.", err)}
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(orderSequencesBucket).Cursor()
+		prefix := []byte(orgID + ":")
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete order sequences. Error: %s.", err)}
+	}
+
 	objectFunction := func(object boltObject) bool {
 		if object.Meta.DestOrgID == orgID {
 			return true
@@ -1907,3 +2755,17 @@ func (store *BoltStorage) getInstanceID() int64 {
 func (store *BoltStorage) IsPersistent() bool {
 	return true
 }
+
+// SupportsDataPatch returns true if the storage can overwrite byte ranges of an object's existing data, and false otherwise
+func (store *BoltStorage) SupportsDataPatch() bool {
+	return true
+}
+
+// AvailableSpace returns the disk space, in bytes, available for objects' data, and -1 if it is unknown
+func (store *BoltStorage) AvailableSpace() (int64, common.SyncServiceError) {
+	space, err := availableDiskSpace(strings.TrimPrefix(store.localDataPath, "file://"))
+	if err != nil {
+		return -1, &Error{fmt.Sprintf("Failed to get the available disk space. Error: %s", err)}
+	}
+	return space, nil
+}
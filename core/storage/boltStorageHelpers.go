@@ -461,12 +461,29 @@ func (store *BoltStorage) retrieveACLHelper(retrieve func(boltACL)) common.SyncS
 	return err
 }
 
+func (store *BoltStorage) retrieveGroupMembersHelper(retrieve func(boltGroupMember)) common.SyncServiceError {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(destinationGroupsBucket).Cursor()
+
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var member boltGroupMember
+			if err := json.Unmarshal(value, &member); err != nil {
+				return err
+			}
+			retrieve(member)
+		}
+		return nil
+	})
+
+	return err
+}
+
 func createObjectDestinationPolicy(object boltObject) common.ObjectDestinationPolicy {
 	destinationList := make([]common.DestinationsStatus, len(object.Destinations))
 	for index, destination := range object.Destinations {
 		destinationList[index] = common.DestinationsStatus{
 			DestType: destination.Destination.DestType, DestID: destination.Destination.DestID,
-			Status: destination.Status, Message: destination.Message,
+			Status: destination.Status, Message: destination.Message, ConsumedOffset: destination.ConsumedOffset,
 		}
 	}
 	return common.ObjectDestinationPolicy{
@@ -482,3 +499,16 @@ func (store *BoltStorage) lock() {
 func (store *BoltStorage) unLock() {
 	store.lockChannel <- 1
 }
+
+// createDataPath returns the path of the file that new data of the object is stored in, compressed if CompressStoredData is set
+func (store *BoltStorage) createDataPath(orgID string, objectType string, objectID string) string {
+	path := createDataPath(store.localDataPath, orgID, objectType, objectID)
+	if common.Configuration.CompressStoredData {
+		path += compressedDataSuffix
+	}
+	return path
+}
+
+func (store *BoltStorage) createDataPathFromMeta(metaData common.MetaData) string {
+	return store.createDataPath(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
@@ -23,10 +25,89 @@ func TestBoltStorageStorageObjectActivation(t *testing.T) {
 	testStorageObjectActivation(common.Bolt, t)
 }
 
+func TestBoltStorageExpiredObjects(t *testing.T) {
+	testStorageExpiredObjects(common.Bolt, t)
+}
+
 func TestBoltStorageObjectData(t *testing.T) {
 	testStorageObjectData(common.Bolt, t)
 }
 
+func TestBoltStorageObjectDataReader(t *testing.T) {
+	testStorageObjectDataReader(common.Bolt, t)
+}
+
+func TestBoltStorageCompressedData(t *testing.T) {
+	compressStoredData := common.Configuration.CompressStoredData
+	maxDataChunkSize := common.Configuration.MaxDataChunkSize
+	defer func() {
+		common.Configuration.CompressStoredData = compressStoredData
+		common.Configuration.MaxDataChunkSize = maxDataChunkSize
+	}()
+	common.Configuration.CompressStoredData = true
+	common.Configuration.MaxDataChunkSize = 4
+
+	testStorageObjectData(common.Bolt, t)
+	testStorageObjectDataReader(common.Bolt, t)
+
+	store, err := setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "compressed", ObjectType: "type1", DestOrgID: "org555", ObjectSize: 10}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+
+	// The chunks are received out of order, and a chunk is received twice
+	chunks := []struct {
+		offset int64
+		data   string
+	}{{4, "4567"}, {0, "0123"}, {4, "4567"}, {8, "89"}}
+	for i, chunk := range chunks {
+		if err := store.AppendObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			bytes.NewReader([]byte(chunk.data)), uint32(len(chunk.data)), chunk.offset, 0, i == 0, i == len(chunks)-1); err != nil {
+			t.Errorf("AppendObjectData failed (offset = %d). Error: %s\n", chunk.offset, err.Error())
+			return
+		}
+	}
+
+	dataPath := store.(*Cache).Store.(*BoltStorage).createDataPathFromMeta(metaData)
+	if _, err := os.Stat(dataPath[len("file://"):]); err != nil {
+		t.Errorf("The compressed data file wasn't created. Error: %s", err)
+	}
+
+	tests := []struct {
+		size   int
+		offset int64
+		data   string
+		eof    bool
+	}{
+		{4, 0, "0123", false},
+		{4, 4, "4567", false},
+		{4, 8, "89", true},
+		{6, 3, "345678", false},
+		{20, 0, "0123456789", true},
+		{4, 12, "", true},
+	}
+	for _, test := range tests {
+		data, eof, length, err := store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, test.size, test.offset)
+		if err != nil {
+			t.Errorf("ReadObjectData failed (offset = %d). Error: %s\n", test.offset, err.Error())
+			continue
+		}
+		if string(data[:length]) != test.data || eof != test.eof {
+			t.Errorf("ReadObjectData (offset = %d) returned %s and eof=%t instead of %s and eof=%t", test.offset,
+				string(data[:length]), eof, test.data, test.eof)
+		}
+	}
+}
+
 func TestBoltStorageNotifications(t *testing.T) {
 	testStorageNotifications(common.Bolt, t)
 }
@@ -205,7 +286,7 @@ func TestBoltCacheStorageDestinations(t *testing.T) {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
 		t.Errorf("Wrong number of destinations: %d instead of 1\n", len(dests))
-	} else if dests[0] != tests[0].dest {
+	} else if !reflect.DeepEqual(dests[0], tests[0].dest) {
 		t.Errorf("Wrong destination\n")
 	}
 
@@ -241,6 +322,10 @@ func TestBoltStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.Bolt, t)
 }
 
+func TestBoltStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.Bolt, t)
+}
+
 func TestBoltStorageObjectExpiration(t *testing.T) {
 	testStorageObjectExpiration(common.Bolt, t)
 }
@@ -261,6 +346,10 @@ func TestBoltStorageObjectDestinations(t *testing.T) {
 	testStorageObjectDestinations(common.Bolt, t)
 }
 
+func TestBoltStorageDestinationGroups(t *testing.T) {
+	testStorageDestinationGroups(common.Bolt, t)
+}
+
 func TestBoltStorageOrganizations(t *testing.T) {
 	testStorageOrganizations(common.Bolt, t)
 }
@@ -268,3 +357,7 @@ func TestBoltStorageOrganizations(t *testing.T) {
 func TestBoltStorageInactiveDestinations(t *testing.T) {
 	testStorageInactiveDestinations(common.Bolt, t)
 }
+
+func TestBoltStorageDataKeys(t *testing.T) {
+	testStorageDataKeys(common.Bolt, t)
+}
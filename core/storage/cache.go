@@ -12,10 +12,19 @@ import (
 // Cache is the caching store
 type Cache struct {
 	destinations map[string]map[string]common.Destination
+	states       map[string]destinationState
 	Store        Storage
 	lock         sync.RWMutex
 }
 
+// destinationState is the cached state of a destination that is not part of common.Destination
+type destinationState struct {
+	lastSeen       time.Time
+	messageVersion common.SyncServiceVersion
+	paused         bool
+	offline        bool
+}
+
 // Init initializes the Cache store
 func (store *Cache) Init() common.SyncServiceError {
 	if err := store.Store.Init(); err != nil {
@@ -26,7 +35,7 @@ func (store *Cache) Init() common.SyncServiceError {
 }
 
 func (store *Cache) cacheDestinations() common.SyncServiceError {
-	destinations, err := store.Store.RetrieveDestinations("", "")
+	destinations, err := store.Store.RetrieveDestinationsInfo("", "")
 	if err != nil {
 		return &Error{"Failed to initialize the cache. Error: " + err.Error()}
 	}
@@ -35,12 +44,15 @@ func (store *Cache) cacheDestinations() common.SyncServiceError {
 	defer store.lock.Unlock()
 
 	store.destinations = make(map[string]map[string]common.Destination, 0)
+	store.states = make(map[string]destinationState, 0)
 	for _, dest := range destinations {
 		if store.destinations[dest.DestOrgID] == nil {
 			store.destinations[dest.DestOrgID] = make(map[string]common.Destination, 0)
 		}
 		id := dest.DestType + ":" + dest.DestID
-		store.destinations[dest.DestOrgID][id] = dest
+		store.destinations[dest.DestOrgID][id] = dest.Destination
+		store.states[dest.DestOrgID+":"+id] = destinationState{lastSeen: dest.LastSeen, messageVersion: dest.MessageVersion,
+			paused: dest.Paused, offline: dest.Offline}
 	}
 	return nil
 }
@@ -78,16 +90,49 @@ func (store *Cache) AppendObjectData(orgID string, objectType string, objectID s
 	return store.Store.AppendObjectData(orgID, objectType, objectID, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
 }
 
+// AppendObjectZeroData appends a chunk of zeros to the object's data
+func (store *Cache) AppendObjectZeroData(orgID string, objectType string, objectID string, length uint32, offset int64, total int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	return store.Store.AppendObjectZeroData(orgID, objectType, objectID, length, offset, total, isFirstChunk, isLastChunk)
+}
+
 // UpdateObjectStatus updates an object's status
 func (store *Cache) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
 	return store.Store.UpdateObjectStatus(orgID, objectType, objectID, status)
 }
 
+// UpdateObjectMetadataOnly applies a metadata only update, received from the other side, to the stored object in place
+func (store *Cache) UpdateObjectMetadataOnly(metaData common.MetaData, status string) common.SyncServiceError {
+	return store.Store.UpdateObjectMetadataOnly(metaData, status)
+}
+
 // UpdateObjectSourceDataURI pdates object's source data URI
 func (store *Cache) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
 	return store.Store.UpdateObjectSourceDataURI(orgID, objectType, objectID, sourceDataURI)
 }
 
+// UpdateObjectPriority updates the priority of the transfers of the object's data
+func (store *Cache) UpdateObjectPriority(orgID string, objectType string, objectID string, priority int) common.SyncServiceError {
+	return store.Store.UpdateObjectPriority(orgID, objectType, objectID, priority)
+}
+
+// RetrieveObjectDataCodec returns the codec of the object's data, or nil if the data isn't encoded or the object doesn't exist
+func (store *Cache) RetrieveObjectDataCodec(orgID string, objectType string, objectID string) (*ObjectDataCodec, common.SyncServiceError) {
+	return store.Store.RetrieveObjectDataCodec(orgID, objectType, objectID)
+}
+
+// RetrieveObjectsWithOtherDataKey returns the objects whose data is encrypted with a key other than keyID
+func (store *Cache) RetrieveObjectsWithOtherDataKey(keyID string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsWithOtherDataKey(keyID)
+}
+
+// StoreReencryptedObjectData replaces the object's data with the same data read from dataReader, encoded with codec,
+// and records the codec
+func (store *Cache) StoreReencryptedObjectData(orgID string, objectType string, objectID string, codec *ObjectDataCodec,
+	dataReader io.Reader) common.SyncServiceError {
+	return store.Store.StoreReencryptedObjectData(orgID, objectType, objectID, codec, dataReader)
+}
+
 // RetrieveObjectStatus finds the object and return its status
 func (store *Cache) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
 	return store.Store.RetrieveObjectStatus(orgID, objectType, objectID)
@@ -122,6 +167,11 @@ func (store *Cache) RetrieveUpdatedObjects(orgID string, objectType string, rece
 	return store.Store.RetrieveUpdatedObjects(orgID, objectType, received)
 }
 
+// RetrieveObjectsWithStatus returns the objects of the type that have the given status
+func (store *Cache) RetrieveObjectsWithStatus(orgID string, objectType string, status string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsWithStatus(orgID, objectType, status)
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *Cache) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -158,6 +208,16 @@ func (store *Cache) RetrieveConsumedObjects() ([]common.ConsumedObject, common.S
 	return store.Store.RetrieveConsumedObjects()
 }
 
+// RetrieveObjectsToEvict returns the objects to remove to keep the size of the stored data below the storage's limit
+func (store *Cache) RetrieveObjectsToEvict() ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsToEvict()
+}
+
+// RetrieveReceivedObjects returns all the objects that were completely received from the other side and not deleted
+func (store *Cache) RetrieveReceivedObjects() ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveReceivedObjects()
+}
+
 // RetrieveObject returns the object meta data with the specified parameters
 func (store *Cache) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
 	return store.Store.RetrieveObject(orgID, objectType, objectID)
@@ -183,6 +243,11 @@ func (store *Cache) CloseDataReader(dataReader io.Reader) common.SyncServiceErro
 	return store.Store.CloseDataReader(dataReader)
 }
 
+// OpenObjectDataReader opens a reader of the object's data positioned at offset, for reading consecutive chunks
+func (store *Cache) OpenObjectDataReader(orgID string, objectType string, objectID string, offset int64) (ObjectDataReader, common.SyncServiceError) {
+	return store.Store.OpenObjectDataReader(orgID, objectType, objectID, offset)
+}
+
 // MarkObjectDeleted marks the object as deleted
 func (store *Cache) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
 	return store.Store.MarkObjectDeleted(orgID, objectType, objectID)
@@ -203,6 +268,27 @@ func (store *Cache) GetObjectsToActivate() ([]common.MetaData, common.SyncServic
 	return store.Store.GetObjectsToActivate()
 }
 
+// GetExpiredObjects returns the objects originated by this node whose expiration time has passed
+func (store *Cache) GetExpiredObjects() ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.GetExpiredObjects()
+}
+
+// GetOverdueObjects returns the objects originated by this node whose delivery deadline has passed
+func (store *Cache) GetOverdueObjects() ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.GetOverdueObjects()
+}
+
+// DeleteObjectsWithFilter marks the objects originated by this node that meet the given conditions as pending deletion
+func (store *Cache) DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) (int, common.SyncServiceError) {
+	return store.Store.DeleteObjectsWithFilter(orgID, objectType, destinationType, destinationID, expirationTimeBefore)
+}
+
+// RetrieveObjectsPendingDeletion returns the objects originated by this node that are marked as pending deletion
+func (store *Cache) RetrieveObjectsPendingDeletion() ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsPendingDeletion()
+}
+
 // DeleteStoredObject deletes the object
 func (store *Cache) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
 	return store.Store.DeleteStoredObject(orgID, objectType, objectID)
@@ -231,6 +317,12 @@ func (store *Cache) UpdateObjectDeliveryStatus(status string, message string, or
 	return store.Store.UpdateObjectDeliveryStatus(status, message, orgID, objectType, objectID, destType, destID)
 }
 
+// UpdateObjectConsumedOffset records the offset up to which the destination consumed the object's data
+func (store *Cache) UpdateObjectConsumedOffset(orgID string, objectType string, objectID string, destType string, destID string,
+	offset int64) common.SyncServiceError {
+	return store.Store.UpdateObjectConsumedOffset(orgID, objectType, objectID, destType, destID, offset)
+}
+
 // UpdateObjectDelivering marks the object as being delivered to all its destinations
 func (store *Cache) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
 	return store.Store.UpdateObjectDelivering(orgID, objectType, objectID)
@@ -270,6 +362,36 @@ func (store *Cache) RetrieveWebhooks(orgID string, objectType string) ([]string,
 	return store.Store.RetrieveWebhooks(orgID, objectType)
 }
 
+// StoreWebhookDelivery stores or updates a webhook call to be retried
+func (store *Cache) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	return store.Store.StoreWebhookDelivery(delivery)
+}
+
+// DeleteWebhookDelivery deletes a webhook call
+func (store *Cache) DeleteWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	return store.Store.DeleteWebhookDelivery(delivery)
+}
+
+// RetrieveWebhookDeliveries returns the webhook calls to be retried, or the dead-lettered ones if deadLetter is true
+func (store *Cache) RetrieveWebhookDeliveries(deadLetter bool) ([]common.WebhookDelivery, common.SyncServiceError) {
+	return store.Store.RetrieveWebhookDeliveries(deadLetter)
+}
+
+// StoreObjectCleanup stores or updates a removal of an object to be retried
+func (store *Cache) StoreObjectCleanup(cleanup common.ObjectCleanup) common.SyncServiceError {
+	return store.Store.StoreObjectCleanup(cleanup)
+}
+
+// DeleteObjectCleanup deletes a removal of an object to be retried
+func (store *Cache) DeleteObjectCleanup(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.Store.DeleteObjectCleanup(orgID, objectType, objectID)
+}
+
+// RetrieveObjectCleanups returns the removals of objects to be retried
+func (store *Cache) RetrieveObjectCleanups() ([]common.ObjectCleanup, common.SyncServiceError) {
+	return store.Store.RetrieveObjectCleanups()
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *Cache) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	store.lock.RLock()
@@ -318,6 +440,8 @@ func (store *Cache) StoreDestination(dest common.Destination) common.SyncService
 		store.destinations[dest.DestOrgID] = make(map[string]common.Destination, 0)
 	}
 	store.destinations[dest.DestOrgID][dest.DestType+":"+dest.DestID] = dest
+	id := dest.DestOrgID + ":" + dest.DestType + ":" + dest.DestID
+	store.states[id] = destinationState{lastSeen: time.Now(), paused: store.states[id].paused}
 	return nil
 }
 
@@ -331,6 +455,7 @@ func (store *Cache) DeleteDestination(orgID string, destType string, destID stri
 	defer store.lock.Unlock()
 
 	delete(store.destinations[orgID], destType+":"+destID)
+	delete(store.states, orgID+":"+destType+":"+destID)
 	return nil
 }
 
@@ -339,6 +464,179 @@ func (store *Cache) UpdateDestinationLastPingTime(destination common.Destination
 	return store.Store.UpdateDestinationLastPingTime(destination) // ???
 }
 
+// UpdateDestinationLastSeen updates the time the destination was last seen (for CSS)
+func (store *Cache) UpdateDestinationLastSeen(destination common.Destination) common.SyncServiceError {
+	if err := store.Store.UpdateDestinationLastSeen(destination); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.destinations[destination.DestOrgID][destination.DestType+":"+destination.DestID]; ok {
+		id := destination.DestOrgID + ":" + destination.DestType + ":" + destination.DestID
+		state := store.states[id]
+		state.lastSeen = time.Now()
+		store.states[id] = state
+	}
+	return nil
+}
+
+// RetrieveDestinationLastSeen returns the time the destination was last seen (for CSS)
+func (store *Cache) RetrieveDestinationLastSeen(orgID string, destType string, destID string) (time.Time, common.SyncServiceError) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.destinations[orgID][destType+":"+destID]; !ok {
+		return time.Time{}, &NotFound{"Destination not found"}
+	}
+	return store.states[orgID+":"+destType+":"+destID].lastSeen, nil
+}
+
+// UpdateDestinationMessageVersion updates the message version negotiated with the destination (for CSS)
+func (store *Cache) UpdateDestinationMessageVersion(destination common.Destination, version common.SyncServiceVersion) common.SyncServiceError {
+	if err := store.Store.UpdateDestinationMessageVersion(destination, version); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.destinations[destination.DestOrgID][destination.DestType+":"+destination.DestID]; ok {
+		id := destination.DestOrgID + ":" + destination.DestType + ":" + destination.DestID
+		state := store.states[id]
+		state.messageVersion = version
+		store.states[id] = state
+	}
+	return nil
+}
+
+// RetrieveDestinationMessageVersion returns the message version negotiated with the destination (for CSS)
+func (store *Cache) RetrieveDestinationMessageVersion(orgID string, destType string, destID string) (common.SyncServiceVersion, common.SyncServiceError) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.destinations[orgID][destType+":"+destID]; !ok {
+		return common.SyncServiceVersion{}, &NotFound{"Destination not found"}
+	}
+	return store.states[orgID+":"+destType+":"+destID].messageVersion, nil
+}
+
+// UpdateDestinationPaused pauses or resumes sending data to the destination (for CSS)
+func (store *Cache) UpdateDestinationPaused(orgID string, destType string, destID string, paused bool) common.SyncServiceError {
+	if err := store.Store.UpdateDestinationPaused(orgID, destType, destID, paused); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.destinations[orgID][destType+":"+destID]; ok {
+		id := orgID + ":" + destType + ":" + destID
+		state := store.states[id]
+		state.paused = paused
+		store.states[id] = state
+	}
+	return nil
+}
+
+// RetrieveDestinationPaused returns true if sending data to the destination is paused (for CSS)
+func (store *Cache) RetrieveDestinationPaused(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.destinations[orgID][destType+":"+destID]; !ok {
+		return false, &NotFound{"Destination not found"}
+	}
+	return store.states[orgID+":"+destType+":"+destID].paused, nil
+}
+
+// UpdateDestinationOffline marks the destination as offline or online (for CSS)
+func (store *Cache) UpdateDestinationOffline(orgID string, destType string, destID string, offline bool) common.SyncServiceError {
+	if err := store.Store.UpdateDestinationOffline(orgID, destType, destID, offline); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.destinations[orgID][destType+":"+destID]; ok {
+		id := orgID + ":" + destType + ":" + destID
+		state := store.states[id]
+		state.offline = offline
+		store.states[id] = state
+	}
+	return nil
+}
+
+// RetrieveDestinationOffline returns true if the destination is offline (for CSS)
+func (store *Cache) RetrieveDestinationOffline(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.destinations[orgID][destType+":"+destID]; !ok {
+		return false, &NotFound{"Destination not found"}
+	}
+	return store.states[orgID+":"+destType+":"+destID].offline, nil
+}
+
+// UpdateDestinationAvailableSpace updates the storage space that the destination reported as available (for CSS)
+func (store *Cache) UpdateDestinationAvailableSpace(destination common.Destination) common.SyncServiceError {
+	if err := store.Store.UpdateDestinationAvailableSpace(destination); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := destination.DestType + ":" + destination.DestID
+	if dest, ok := store.destinations[destination.DestOrgID][id]; ok {
+		dest.AvailableSpace = destination.AvailableSpace
+		store.destinations[destination.DestOrgID][id] = dest
+	}
+	return nil
+}
+
+// RetrieveDestinationsInfo returns all the destinations with the provided orgID and destType, the time
+// they were last seen, their message versions, and whether they are paused or offline (for CSS)
+func (store *Cache) RetrieveDestinationsInfo(orgID string, destType string) ([]common.DestinationInfo, common.SyncServiceError) {
+	dests, err := store.RetrieveDestinations(orgID, destType)
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	result := make([]common.DestinationInfo, len(dests))
+	for i, dest := range dests {
+		state := store.states[dest.DestOrgID+":"+dest.DestType+":"+dest.DestID]
+		result[i] = common.DestinationInfo{Destination: dest, LastSeen: state.lastSeen, MessageVersion: state.messageVersion,
+			Paused: state.paused, Offline: state.offline}
+	}
+	return result, nil
+}
+
+// AddDestinationToGroup adds the destination to the destination group (for CSS)
+func (store *Cache) AddDestinationToGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	return store.Store.AddDestinationToGroup(orgID, group, destType, destID)
+}
+
+// RemoveDestinationFromGroup removes the destination from the destination group (for CSS)
+func (store *Cache) RemoveDestinationFromGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	return store.Store.RemoveDestinationFromGroup(orgID, group, destType, destID)
+}
+
+// RetrieveGroupMembers returns the registered destinations that are members of the destination group (for CSS)
+func (store *Cache) RetrieveGroupMembers(orgID string, group string) ([]common.Destination, common.SyncServiceError) {
+	return store.Store.RetrieveGroupMembers(orgID, group)
+}
+
+// RetrieveDestinationGroups returns the names of the destination groups the destination is a member of (for CSS)
+func (store *Cache) RetrieveDestinationGroups(orgID string, destType string, destID string) ([]string, common.SyncServiceError) {
+	return store.Store.RetrieveDestinationGroups(orgID, destType, destID)
+}
+
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *Cache) RemoveInactiveDestinations(lastTimestamp time.Time) {
 	store.Store.RemoveInactiveDestinations(lastTimestamp)
@@ -377,6 +675,11 @@ func (store *Cache) GetObjectsForDestination(orgID string, destType string, dest
 	return store.Store.GetObjectsForDestination(orgID, destType, destID)
 }
 
+// RetrievePendingObjects returns the objects that are pending delivery to the destination and their delivery status
+func (store *Cache) RetrievePendingObjects(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	return store.Store.RetrievePendingObjects(orgID, destType, destID)
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 func (store *Cache) RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	return store.Store.RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID, destType, destID)
@@ -397,7 +700,7 @@ func (store *Cache) UpdateNotificationRecord(notification common.Notification) c
 	return store.Store.UpdateNotificationRecord(notification)
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.NotificationResendInterval*6
 func (store *Cache) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
 	return store.Store.UpdateNotificationResendTime(notification)
 }
@@ -424,6 +727,47 @@ func (store *Cache) RetrievePendingNotifications(orgID string, destType string,
 	return store.Store.RetrievePendingNotifications(orgID, destType, destID)
 }
 
+// RetrieveNotificationsWithStatus returns the list of the notifications that have the given status
+func (store *Cache) RetrieveNotificationsWithStatus(orgID string, status string) ([]common.Notification, common.SyncServiceError) {
+	return store.Store.RetrieveNotificationsWithStatus(orgID, status)
+}
+
+// GetNumberOfNotificationRecords returns the number of notification records of the destination
+func (store *Cache) GetNumberOfNotificationRecords(orgID string, destType string, destID string) (uint32, common.SyncServiceError) {
+	return store.Store.GetNumberOfNotificationRecords(orgID, destType, destID)
+}
+
+// IterateNotificationRecords calls the function with each of the notification records
+func (store *Cache) IterateNotificationRecords(iterate func(common.Notification) error) common.SyncServiceError {
+	return store.Store.IterateNotificationRecords(iterate)
+}
+
+// RetrieveOrderedNotifications returns the notification records of the objects of the type that are delivered in order
+// to the destination
+func (store *Cache) RetrieveOrderedNotifications(orgID string, objectType string, destType string, destID string) ([]common.Notification,
+	common.SyncServiceError) {
+	return store.Store.RetrieveOrderedNotifications(orgID, objectType, destType, destID)
+}
+
+// IncrementOrderSequence increments the order sequence number of the objects of the type that are sent to the destination
+func (store *Cache) IncrementOrderSequence(orgID string, objectType string, destType string, destID string) (int64, common.SyncServiceError) {
+	return store.Store.IncrementOrderSequence(orgID, objectType, destType, destID)
+}
+
+// RetrieveDeliveredOrderSequence returns the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *Cache) RetrieveDeliveredOrderSequence(orgID string, objectType string, originType string, originID string) (int64,
+	common.SyncServiceError) {
+	return store.Store.RetrieveDeliveredOrderSequence(orgID, objectType, originType, originID)
+}
+
+// UpdateDeliveredOrderSequence updates the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *Cache) UpdateDeliveredOrderSequence(orgID string, objectType string, originType string, originID string,
+	sequence int64) common.SyncServiceError {
+	return store.Store.UpdateDeliveredOrderSequence(orgID, objectType, originType, originID, sequence)
+}
+
 // InsertInitialLeader inserts the initial leader entry
 func (store *Cache) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	return store.Store.InsertInitialLeader(leaderID)
@@ -434,8 +778,8 @@ func (store *Cache) LeaderPeriodicUpdate(leaderID string) (bool, common.SyncServ
 	return store.Store.LeaderPeriodicUpdate(leaderID)
 }
 
-// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader document
-func (store *Cache) RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError) {
+// RetrieveLeader retrieves the leader's ID and address, the Heartbeat timeout and Last heartbeat time stamp from the leader document
+func (store *Cache) RetrieveLeader() (string, string, int32, time.Time, int64, common.SyncServiceError) {
 	return store.Store.RetrieveLeader()
 }
 
@@ -449,6 +793,21 @@ func (store *Cache) ResignLeadership(leaderID string) common.SyncServiceError {
 	return store.Store.ResignLeadership(leaderID)
 }
 
+// ReplicaPeriodicUpdate does the periodic update of the replica's entry
+func (store *Cache) ReplicaPeriodicUpdate(replicaID string) common.SyncServiceError {
+	return store.Store.ReplicaPeriodicUpdate(replicaID)
+}
+
+// RetrieveReplicas retrieves the replicas' IDs, addresses and last heartbeat time stamps
+func (store *Cache) RetrieveReplicas() ([]Replica, common.SyncServiceError) {
+	return store.Store.RetrieveReplicas()
+}
+
+// RemoveReplica removes the replica's entry
+func (store *Cache) RemoveReplica(replicaID string) common.SyncServiceError {
+	return store.Store.RemoveReplica(replicaID)
+}
+
 // RetrieveTimeOnServer retrieves the current time on the database server
 func (store *Cache) RetrieveTimeOnServer() (time.Time, error) {
 	return store.Store.RetrieveTimeOnServer()
@@ -536,3 +895,13 @@ func (store *Cache) RetrieveACLsInOrg(aclType string, orgID string) ([]string, c
 func (store *Cache) IsPersistent() bool {
 	return store.Store.IsPersistent()
 }
+
+// SupportsDataPatch returns true if the storage can overwrite byte ranges of an object's existing data, and false otherwise
+func (store *Cache) SupportsDataPatch() bool {
+	return store.Store.SupportsDataPatch()
+}
+
+// AvailableSpace returns the storage space, in bytes, available for objects' data, and -1 if it is unknown
+func (store *Cache) AvailableSpace() (int64, common.SyncServiceError) {
+	return store.Store.AvailableSpace()
+}
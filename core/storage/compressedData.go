@@ -0,0 +1,548 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/dataURI"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// When CompressStoredData is set, the Bolt storage stores the data of objects compressed, in files whose names end
+// with compressedDataSuffix. The data is compressed in blocks, each an independent gzip stream of a chunk of the data
+// (up to MaxDataChunkSize bytes), so that chunks can be appended at any offset and any range of the data can be read
+// by decompressing only the blocks that hold it.
+//
+// Each block is preceded by a header with the offset and length of its data and the size of its compressed data.
+// Blocks are appended in the order they are written, and where blocks overlap (a chunk that was received again, or
+// the changed ranges of a patch update) the block written last wins. When all the data was written, an index of the
+// blocks is appended to the file, followed by a trailer with the position of the index and the size of the data.
+// Only files with an index are read, like the uncompressed data is only read after it was completely written.
+
+const compressedDataSuffix = ".compressed"
+
+const compressedDataMagic = "SSCDATA1"
+
+const (
+	compressedBlockHeaderSize = 24
+	compressedIndexEntrySize  = 32
+	compressedTrailerSize     = 16 + len(compressedDataMagic)
+)
+
+type compressedBlock struct {
+	offset   int64 // The offset of the block's data in the object's data
+	length   int64 // The length of the block's data
+	position int64 // The position of the compressed data in the file
+	size     int64 // The size of the compressed data
+}
+
+// The files of data being appended whose torn last block (if any) was already truncated by this process
+var verifiedCompressedFiles = make(map[string]bool)
+var verifiedCompressedFilesLock sync.Mutex
+
+func isCompressedDataPath(uri string) bool {
+	return strings.HasSuffix(uri, compressedDataSuffix)
+}
+
+// compressedDataBlockSize returns the maximal length of the data compressed into one block
+func compressedDataBlockSize() int {
+	if common.Configuration.MaxDataChunkSize > 0 {
+		return common.Configuration.MaxDataChunkSize
+	}
+	return 1024 * 1024
+}
+
+func compressedDataFilePath(uri string) (string, common.SyncServiceError) {
+	parsedURI, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(parsedURI.Scheme, "file") {
+		return "", &Error{"Invalid data URI"}
+	}
+	return parsedURI.Path, nil
+}
+
+// storeDataFile writes the data to the file at the given URI, compressed if the URI is of compressed data
+func storeDataFile(uri string, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	if !isCompressedDataPath(uri) {
+		return dataURI.StoreData(uri, dataReader, dataLength)
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing compressed data at %s", uri)
+	}
+	path, err := compressedDataFilePath(uri)
+	if err != nil {
+		return 0, err
+	}
+
+	file, fileErr := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if fileErr != nil {
+		return 0, common.CreateError(fileErr, fmt.Sprintf("Failed to open file %s to write data. Error: ", path))
+	}
+	defer file.Close()
+
+	var written int64
+	buffer := make([]byte, compressedDataBlockSize())
+	for {
+		n, readErr := io.ReadFull(dataReader, buffer)
+		if n > 0 {
+			if err := appendCompressedBlock(file, written, buffer[:n]); err != nil {
+				return 0, err
+			}
+			written += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return 0, &common.IOError{Message: "Failed to read the data. Error: " + readErr.Error()}
+		}
+	}
+	if written != int64(dataLength) && dataLength != 0 {
+		return 0, &common.IOError{Message: "Failed to write all the data to file."}
+	}
+	if err := finishCompressedData(file, path); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// appendDataFile writes a chunk of data at offset to the file at the given URI, compressed if the URI is of compressed data
+func appendDataFile(uri string, dataReader io.Reader, dataLength uint32, offset int64, total int64, isFirstChunk bool,
+	isLastChunk bool) common.SyncServiceError {
+	if !isCompressedDataPath(uri) {
+		return dataURI.AppendData(uri, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing compressed data chunk at %s", uri)
+	}
+	path, err := compressedDataFilePath(uri)
+	if err != nil {
+		return err
+	}
+
+	data, readErr := ioutil.ReadAll(dataReader)
+	if readErr != nil {
+		return &common.IOError{Message: "Failed to read the data. Error: " + readErr.Error()}
+	}
+	if len(data) != int(dataLength) {
+		return &common.IOError{Message: "Failed to write all the data to file."}
+	}
+
+	tmpPath := path + ".tmp"
+	flags := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if isFirstChunk {
+		flags |= os.O_TRUNC
+	}
+	file, fileErr := os.OpenFile(tmpPath, flags, 0600)
+	if fileErr != nil {
+		return common.CreateError(fileErr, fmt.Sprintf("Failed to open file %s to append data. Error: ", path))
+	}
+	defer file.Close()
+
+	if err := truncateTornCompressedBlock(file, tmpPath, isFirstChunk); err != nil {
+		return err
+	}
+	if err := appendCompressedBlock(file, offset, data); err != nil {
+		return err
+	}
+
+	// The chunk is logged in the data write-ahead log after this returns, so it must be durable by then
+	if common.Configuration.DataWriteAheadLog {
+		if err := file.Sync(); err != nil {
+			return &common.IOError{Message: "Failed to sync file. Error: " + err.Error()}
+		}
+	}
+
+	if isLastChunk {
+		return finishCompressedData(file, path)
+	}
+	return nil
+}
+
+// prepareDataFilePatch writes the data stored at the given URI to the file that data chunks are appended to,
+// truncated to the given size, so that a patch update only has to write the changed byte ranges.
+// The stored data may be uncompressed, if it was stored before CompressStoredData was set.
+func prepareDataFilePatch(uri string, size int64) common.SyncServiceError {
+	if !isCompressedDataPath(uri) {
+		return dataURI.PrepareDataPatch(uri, size)
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Preparing compressed data patch at %s", uri)
+	}
+	path, err := compressedDataFilePath(uri)
+	if err != nil {
+		return err
+	}
+
+	source, err := getDataFile(uri)
+	if common.IsNotFound(err) {
+		source, err = dataURI.GetData(strings.TrimSuffix(uri, compressedDataSuffix))
+	}
+	if err != nil {
+		return err
+	}
+	defer closeDataFile(source)
+
+	file, fileErr := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if fileErr != nil {
+		return common.CreateError(fileErr, fmt.Sprintf("Failed to open file %s to patch data. Error: ", path))
+	}
+	defer file.Close()
+
+	limitedSource := io.LimitReader(source, size)
+	buffer := make([]byte, compressedDataBlockSize())
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(limitedSource, buffer)
+		if n > 0 {
+			if err := appendCompressedBlock(file, offset, buffer[:n]); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return &common.IOError{Message: "Failed to copy data to patch. Error: " + readErr.Error()}
+		}
+	}
+
+	verifiedCompressedFilesLock.Lock()
+	verifiedCompressedFiles[path+".tmp"] = true
+	verifiedCompressedFilesLock.Unlock()
+	return nil
+}
+
+// getDataFile returns a reader of the data stored at the given URI, that decompresses it if the URI is of compressed data.
+// After reading, the reader has to be closed with closeDataFile.
+func getDataFile(uri string) (io.Reader, common.SyncServiceError) {
+	if !isCompressedDataPath(uri) {
+		return dataURI.GetData(uri)
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving compressed data from %s", uri)
+	}
+	file, blocks, size, err := openCompressedData(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedDataReader{file: file, blocks: blocks, size: size}, nil
+}
+
+// closeDataFile closes a reader returned by getDataFile
+func closeDataFile(dataReader io.Reader) common.SyncServiceError {
+	if closer, ok := dataReader.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return &common.IOError{Message: "Failed to close the data file. Error: " + err.Error()}
+		}
+	}
+	return nil
+}
+
+// getDataFileChunk reads up to size bytes at offset of the data stored at the given URI
+func getDataFileChunk(uri string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	if !isCompressedDataPath(uri) {
+		return dataURI.GetDataChunk(uri, size, offset)
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving compressed data from %s", uri)
+	}
+	file, blocks, dataSize, err := openCompressedData(uri)
+	if err != nil {
+		return nil, true, 0, err
+	}
+	defer file.Close()
+
+	result := make([]byte, size)
+	n, err := readCompressedData(file, blocks, dataSize, result, offset)
+	if err != nil {
+		return nil, true, 0, err
+	}
+	return result, offset+int64(n) >= dataSize, n, nil
+}
+
+// deleteDataFiles deletes the data stored at the given URI, both compressed and uncompressed
+func deleteDataFiles(uri string) common.SyncServiceError {
+	uri = strings.TrimSuffix(uri, compressedDataSuffix)
+	if err := dataURI.DeleteStoredData(uri); err != nil {
+		return err
+	}
+	return dataURI.DeleteStoredData(uri + compressedDataSuffix)
+}
+
+func appendCompressedBlock(file *os.File, offset int64, data []byte) common.SyncServiceError {
+	var buffer bytes.Buffer
+	buffer.Write(make([]byte, compressedBlockHeaderSize))
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return &common.IOError{Message: "Failed to compress the data. Error: " + err.Error()}
+	}
+	if err := writer.Close(); err != nil {
+		return &common.IOError{Message: "Failed to compress the data. Error: " + err.Error()}
+	}
+
+	block := buffer.Bytes()
+	binary.BigEndian.PutUint64(block[0:], uint64(offset))
+	binary.BigEndian.PutUint64(block[8:], uint64(len(data)))
+	binary.BigEndian.PutUint64(block[16:], uint64(len(block)-compressedBlockHeaderSize))
+
+	// The block is written at once, so that the blocks of chunks that are appended concurrently don't interleave
+	if _, err := file.Write(block); err != nil {
+		return &common.IOError{Message: "Failed to write to file. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// scanCompressedBlocks returns the blocks of a file that doesn't have an index yet, and the end of the last complete block
+func scanCompressedBlocks(file *os.File) ([]compressedBlock, int64, common.SyncServiceError) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+	}
+
+	blocks := make([]compressedBlock, 0)
+	header := make([]byte, compressedBlockHeaderSize)
+	var position int64
+	for position+compressedBlockHeaderSize <= fileInfo.Size() {
+		if _, err := file.ReadAt(header, position); err != nil {
+			return nil, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+		}
+		block := compressedBlock{offset: int64(binary.BigEndian.Uint64(header[0:])),
+			length: int64(binary.BigEndian.Uint64(header[8:])), position: position + compressedBlockHeaderSize,
+			size: int64(binary.BigEndian.Uint64(header[16:]))}
+		if block.offset < 0 || block.length < 0 || block.size < 0 || block.position+block.size > fileInfo.Size() {
+			// The block is torn
+			break
+		}
+		blocks = append(blocks, block)
+		position = block.position + block.size
+	}
+	return blocks, position, nil
+}
+
+// truncateTornCompressedBlock removes the last block of the file if it was torn by a crash, before blocks are appended
+// to the file for the first time by this process
+func truncateTornCompressedBlock(file *os.File, path string, isFirstChunk bool) common.SyncServiceError {
+	verifiedCompressedFilesLock.Lock()
+	defer verifiedCompressedFilesLock.Unlock()
+
+	if !isFirstChunk && !verifiedCompressedFiles[path] {
+		_, end, err := scanCompressedBlocks(file)
+		if err != nil {
+			return err
+		}
+		if err := file.Truncate(end); err != nil {
+			return &common.IOError{Message: "Failed to truncate data. Error: " + err.Error()}
+		}
+	}
+	verifiedCompressedFiles[path] = true
+	return nil
+}
+
+// finishCompressedData appends the index of the blocks to the file that the data was appended to, and moves it to path
+func finishCompressedData(file *os.File, path string) common.SyncServiceError {
+	tmpPath := path + ".tmp"
+	verifiedCompressedFilesLock.Lock()
+	delete(verifiedCompressedFiles, tmpPath)
+	verifiedCompressedFilesLock.Unlock()
+
+	blocks, end, err := scanCompressedBlocks(file)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(end); err != nil {
+		return &common.IOError{Message: "Failed to truncate data. Error: " + err.Error()}
+	}
+
+	var size int64
+	index := make([]byte, len(blocks)*compressedIndexEntrySize+compressedTrailerSize)
+	for i, block := range blocks {
+		entry := index[i*compressedIndexEntrySize:]
+		binary.BigEndian.PutUint64(entry[0:], uint64(block.offset))
+		binary.BigEndian.PutUint64(entry[8:], uint64(block.length))
+		binary.BigEndian.PutUint64(entry[16:], uint64(block.position))
+		binary.BigEndian.PutUint64(entry[24:], uint64(block.size))
+		if block.offset+block.length > size {
+			size = block.offset + block.length
+		}
+	}
+	trailer := index[len(blocks)*compressedIndexEntrySize:]
+	binary.BigEndian.PutUint64(trailer[0:], uint64(end))
+	binary.BigEndian.PutUint64(trailer[8:], uint64(size))
+	copy(trailer[16:], compressedDataMagic)
+	if _, err := file.Write(index); err != nil {
+		return &common.IOError{Message: "Failed to write to file. Error: " + err.Error()}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
+	}
+	// The uncompressed data of a previous version of the object, stored before CompressStoredData was set
+	if err := os.Remove(strings.TrimSuffix(path, compressedDataSuffix)); err != nil && !os.IsNotExist(err) {
+		return &common.IOError{Message: "Failed to delete data. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// openCompressedData opens the file of compressed data and reads its index
+func openCompressedData(uri string) (*os.File, []compressedBlock, int64, common.SyncServiceError) {
+	path, err := compressedDataFilePath(uri)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	file, fileErr := os.Open(path)
+	if fileErr != nil {
+		if os.IsNotExist(fileErr) {
+			return nil, nil, 0, &common.NotFound{}
+		}
+		return nil, nil, 0, common.CreateError(fileErr, fmt.Sprintf("Failed to open file %s to read data. Error: ", path))
+	}
+
+	blocks, size, err := readCompressedIndex(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	return file, blocks, size, nil
+}
+
+func readCompressedIndex(file *os.File) ([]compressedBlock, int64, common.SyncServiceError) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+	}
+	trailerPosition := fileInfo.Size() - int64(compressedTrailerSize)
+	if trailerPosition < 0 {
+		return nil, 0, &Error{"Invalid compressed data, the index is missing"}
+	}
+	trailer := make([]byte, compressedTrailerSize)
+	if _, err := file.ReadAt(trailer, trailerPosition); err != nil {
+		return nil, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+	}
+	indexPosition := int64(binary.BigEndian.Uint64(trailer[0:]))
+	size := int64(binary.BigEndian.Uint64(trailer[8:]))
+	if string(trailer[16:]) != compressedDataMagic || indexPosition < 0 || indexPosition > trailerPosition ||
+		(trailerPosition-indexPosition)%compressedIndexEntrySize != 0 {
+		return nil, 0, &Error{"Invalid compressed data, the index is missing"}
+	}
+
+	index := make([]byte, trailerPosition-indexPosition)
+	if _, err := file.ReadAt(index, indexPosition); err != nil {
+		return nil, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+	}
+	blocks := make([]compressedBlock, len(index)/compressedIndexEntrySize)
+	for i := range blocks {
+		entry := index[i*compressedIndexEntrySize:]
+		blocks[i] = compressedBlock{offset: int64(binary.BigEndian.Uint64(entry[0:])),
+			length: int64(binary.BigEndian.Uint64(entry[8:])), position: int64(binary.BigEndian.Uint64(entry[16:])),
+			size: int64(binary.BigEndian.Uint64(entry[24:]))}
+	}
+	return blocks, size, nil
+}
+
+// readCompressedData reads the data at offset into buffer, up to the length of buffer, and returns the number of bytes read.
+// Ranges of the data that no block holds are read as zeros.
+func readCompressedData(file *os.File, blocks []compressedBlock, size int64, buffer []byte, offset int64) (int, common.SyncServiceError) {
+	if offset >= size {
+		return 0, nil
+	}
+	if int64(len(buffer)) > size-offset {
+		buffer = buffer[:size-offset]
+	}
+	for i := range buffer {
+		buffer[i] = 0
+	}
+	end := offset + int64(len(buffer))
+
+	for _, block := range blocks {
+		if block.offset >= end || block.offset+block.length <= offset {
+			continue
+		}
+		reader, err := gzip.NewReader(io.NewSectionReader(file, block.position, block.size))
+		if err != nil {
+			return 0, &common.IOError{Message: "Failed to decompress data. Error: " + err.Error()}
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil || int64(len(data)) != block.length {
+			return 0, &common.IOError{Message: fmt.Sprintf("Failed to decompress the data at offset %d.", block.offset)}
+		}
+
+		from := offset
+		if block.offset > from {
+			from = block.offset
+		}
+		to := end
+		if block.offset+block.length < to {
+			to = block.offset + block.length
+		}
+		copy(buffer[from-offset:to-offset], data[from-block.offset:to-block.offset])
+	}
+	return len(buffer), nil
+}
+
+// compressedDataReader reads the decompressed data of a file of compressed data.
+// It decompresses the data a window of a block's size at a time.
+type compressedDataReader struct {
+	file         *os.File
+	blocks       []compressedBlock
+	size         int64
+	offset       int64
+	window       []byte
+	windowOffset int64
+}
+
+func (reader *compressedDataReader) Read(buffer []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	read := 0
+	for read < len(buffer) && reader.offset < reader.size {
+		if reader.window == nil || reader.offset < reader.windowOffset ||
+			reader.offset >= reader.windowOffset+int64(len(reader.window)) {
+			blockSize := int64(compressedDataBlockSize())
+			reader.windowOffset = reader.offset - reader.offset%blockSize
+			window := make([]byte, blockSize)
+			n, err := readCompressedData(reader.file, reader.blocks, reader.size, window, reader.windowOffset)
+			if err != nil {
+				return read, err
+			}
+			reader.window = window[:n]
+		}
+		n := copy(buffer[read:], reader.window[reader.offset-reader.windowOffset:])
+		reader.offset += int64(n)
+		read += n
+	}
+	return read, nil
+}
+
+// Seek sets the offset of the next Read, relative to the start or to the current offset
+func (reader *compressedDataReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return 0, &Error{"Invalid whence"}
+	}
+	if offset < 0 {
+		return 0, &Error{"Negative offset"}
+	}
+	reader.offset = offset
+	return offset, nil
+}
+
+func (reader *compressedDataReader) Close() error {
+	return reader.file.Close()
+}
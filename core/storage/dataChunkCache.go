@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// The data chunk cache keeps the decoded chunks of objects' data that were recently read to be sent, so that when
+// a popular object is sent to many destinations, the chunks that all of them request are read from the storage once.
+// The chunks are cached by the instance of the object, and the chunks of an instance are never served for another
+// instance: when a chunk of a newer instance of an object is cached, the chunks of the older instance are dropped,
+// and chunks of an older instance than the cached one aren't cached. The chunks of an object are dropped when its
+// data is deleted. The least recently used chunks are evicted when the size of the cached data exceeds
+// DataChunkCacheSizeKB.
+
+// chunkRange is the offset and the size of a chunk of an object's data
+type chunkRange struct {
+	offset int64
+	size   int
+}
+
+type cachedDataChunk struct {
+	objectKey string
+	chunkRange
+	data []byte
+	eof  bool
+}
+
+// cachedObjectChunks are the cached chunks of the data of an instance of an object
+type cachedObjectChunks struct {
+	instanceID int64
+	chunks     map[chunkRange]*list.Element
+}
+
+var dataChunkCache = struct {
+	lock    sync.Mutex
+	objects map[string]*cachedObjectChunks
+
+	// lru holds the cached chunks, the most recently used first
+	lru  *list.List
+	size int64
+}{objects: make(map[string]*cachedObjectChunks), lru: list.New()}
+
+// GetCachedDataChunk returns the cached chunk of size bytes at offset of the instance of the object's data,
+// whether it is the last chunk of the data, and whether it was found. The returned data must not be modified.
+func GetCachedDataChunk(orgID string, objectType string, objectID string, instanceID int64, offset int64,
+	size int) ([]byte, bool, bool) {
+	if common.Configuration.DataChunkCacheSizeKB <= 0 {
+		return nil, false, false
+	}
+
+	dataChunkCache.lock.Lock()
+	defer dataChunkCache.lock.Unlock()
+
+	object, ok := dataChunkCache.objects[createObjectCollectionID(orgID, objectType, objectID)]
+	if !ok || object.instanceID != instanceID {
+		return nil, false, false
+	}
+	element, ok := object.chunks[chunkRange{offset, size}]
+	if !ok {
+		return nil, false, false
+	}
+	dataChunkCache.lru.MoveToFront(element)
+	chunk := element.Value.(*cachedDataChunk)
+	return chunk.data, chunk.eof, true
+}
+
+// CacheDataChunk caches a copy of the chunk of size bytes at offset of the instance of the object's data, which was
+// read with that size, and whether it is the last chunk of the data
+func CacheDataChunk(orgID string, objectType string, objectID string, instanceID int64, offset int64, size int,
+	data []byte, eof bool) {
+	maxSize := int64(common.Configuration.DataChunkCacheSizeKB) * 1024
+	if maxSize <= 0 || int64(len(data)) > maxSize {
+		return
+	}
+
+	dataChunkCache.lock.Lock()
+	defer dataChunkCache.lock.Unlock()
+
+	objectKey := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := dataChunkCache.objects[objectKey]
+	if ok && object.instanceID > instanceID {
+		return
+	}
+	if ok && object.instanceID < instanceID {
+		removeCachedObjectChunks(objectKey)
+		ok = false
+	}
+	if !ok {
+		object = &cachedObjectChunks{instanceID: instanceID, chunks: make(map[chunkRange]*list.Element)}
+		dataChunkCache.objects[objectKey] = object
+	}
+
+	key := chunkRange{offset, size}
+	if _, ok := object.chunks[key]; ok {
+		return
+	}
+	chunk := &cachedDataChunk{objectKey: objectKey, chunkRange: key, data: append([]byte(nil), data...), eof: eof}
+	object.chunks[key] = dataChunkCache.lru.PushFront(chunk)
+	dataChunkCache.size += int64(len(chunk.data))
+
+	for dataChunkCache.size > maxSize {
+		removeCachedDataChunk(dataChunkCache.lru.Back())
+	}
+}
+
+// ForgetCachedDataChunks drops the cached chunks of the object's data
+func ForgetCachedDataChunks(orgID string, objectType string, objectID string) {
+	dataChunkCache.lock.Lock()
+	defer dataChunkCache.lock.Unlock()
+
+	removeCachedObjectChunks(createObjectCollectionID(orgID, objectType, objectID))
+}
+
+func removeCachedObjectChunks(objectKey string) {
+	if object, ok := dataChunkCache.objects[objectKey]; ok {
+		for _, element := range object.chunks {
+			removeCachedDataChunk(element)
+		}
+	}
+}
+
+func removeCachedDataChunk(element *list.Element) {
+	chunk := dataChunkCache.lru.Remove(element).(*cachedDataChunk)
+	dataChunkCache.size -= int64(len(chunk.data))
+	if object, ok := dataChunkCache.objects[chunk.objectKey]; ok {
+		delete(object.chunks, chunk.chunkRange)
+		if len(object.chunks) == 0 {
+			delete(dataChunkCache.objects, chunk.objectKey)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestDataChunkCache(t *testing.T) {
+	cacheSize := common.Configuration.DataChunkCacheSizeKB
+	defer func() { common.Configuration.DataChunkCacheSizeKB = cacheSize }()
+	common.Configuration.DataChunkCacheSizeKB = 2
+
+	chunk := func(b byte) []byte { return bytes.Repeat([]byte{b}, 512) }
+	checkChunk := func(objectID string, instanceID int64, offset int64, expected []byte) {
+		data, eof, found := GetCachedDataChunk("myorg", "type1", objectID, instanceID, offset, 512)
+		if expected == nil {
+			if found {
+				t.Errorf("GetCachedDataChunk returned a chunk of %s:%d at %d that isn't cached", objectID, instanceID, offset)
+			}
+		} else if !found || !bytes.Equal(data, expected) || eof != (offset == 512) {
+			t.Errorf("GetCachedDataChunk didn't return the cached chunk of %s:%d at %d", objectID, instanceID, offset)
+		}
+	}
+
+	data := chunk('a')
+	CacheDataChunk("myorg", "type1", "1", 1, 0, 512, data, false)
+	CacheDataChunk("myorg", "type1", "1", 1, 512, 512, chunk('b'), true)
+	data[0] = 'x'
+	checkChunk("1", 1, 0, chunk('a'))
+	checkChunk("1", 1, 512, chunk('b'))
+	if _, _, found := GetCachedDataChunk("myorg", "type1", "1", 1, 0, 256); found {
+		t.Errorf("GetCachedDataChunk returned a chunk of another size")
+	}
+
+	// The chunks of an instance aren't served for another instance, and a newer instance replaces the older one
+	checkChunk("1", 2, 0, nil)
+	CacheDataChunk("myorg", "type1", "1", 2, 0, 512, chunk('c'), false)
+	checkChunk("1", 2, 0, chunk('c'))
+	checkChunk("1", 1, 0, nil)
+	checkChunk("1", 1, 512, nil)
+	CacheDataChunk("myorg", "type1", "1", 1, 512, 512, chunk('b'), true)
+	checkChunk("1", 1, 512, nil)
+
+	// The least recently used chunks are evicted
+	CacheDataChunk("myorg", "type1", "2", 1, 0, 512, chunk('d'), false)
+	CacheDataChunk("myorg", "type1", "3", 1, 0, 512, chunk('e'), false)
+	checkChunk("1", 2, 0, chunk('c'))
+	CacheDataChunk("myorg", "type1", "4", 1, 0, 512, chunk('f'), false)
+	CacheDataChunk("myorg", "type1", "5", 1, 0, 512, chunk('g'), false)
+	checkChunk("2", 1, 0, nil)
+	checkChunk("3", 1, 0, chunk('e'))
+	checkChunk("1", 2, 0, chunk('c'))
+	checkChunk("4", 1, 0, chunk('f'))
+	checkChunk("5", 1, 0, chunk('g'))
+
+	// The chunks of an object are dropped when its data is deleted
+	ForgetCachedDataChunks("myorg", "type1", "4")
+	checkChunk("4", 1, 0, nil)
+	checkChunk("5", 1, 0, chunk('g'))
+
+	// Nothing is cached when the cache is disabled
+	common.Configuration.DataChunkCacheSizeKB = 0
+	CacheDataChunk("myorg", "type1", "6", 1, 0, 512, chunk('h'), false)
+	common.Configuration.DataChunkCacheSizeKB = 2
+	checkChunk("6", 1, 0, nil)
+}
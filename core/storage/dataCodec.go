@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// DataCodec transforms the data of objects before it is stored, and back after it is read from the storage,
+// e.g. to encrypt the data at rest.
+// The data is stored and read in chunks at arbitrary offsets, therefore the transformation must preserve the length
+// of the data and must be applicable to any range of the data independently, like a stream cipher in counter mode.
+// Each copy of an object's data is transformed with a random nonce of its own (see ObjectDataCodec), so that a stream
+// cipher never encrypts different data with the same key stream.
+type DataCodec interface {
+	// Encode transforms, in place, the data at offset of the copy of an object's data with the nonce before it is stored
+	Encode(nonce []byte, offset int64, data []byte)
+
+	// Decode transforms back, in place, the data at offset of the copy of an object's data with the nonce after it is read
+	// from the storage
+	Decode(nonce []byte, offset int64, data []byte)
+}
+
+// dataNonceSize is the size of the nonce of a copy of an object's data
+const dataNonceSize = 16
+
+var dataCodec DataCodec
+var dataCodecLock sync.RWMutex
+
+// RegisterDataCodec registers the codec applied to the data of all the objects in the storage.
+// The codec must be registered before any data is stored, and nil unregisters it.
+func RegisterDataCodec(codec DataCodec) {
+	dataCodecLock.Lock()
+	dataCodec = codec
+	dataCodecLock.Unlock()
+}
+
+// HasDataCodec returns true if a data codec is registered
+func HasDataCodec() bool {
+	return getDataCodec() != nil
+}
+
+func getDataCodec() DataCodec {
+	dataCodecLock.RLock()
+	defer dataCodecLock.RUnlock()
+	return dataCodec
+}
+
+// ObjectDataCodec applies the registered data codec to one copy of an object's data, i.e. the data written by a single
+// store of the object's data, or received in chunks by a single transfer.
+// Each copy of the data has a codec with a new nonce (see NewObjectDataCodec), which the store records with the data
+// (see GetObjectDataCodec), so that the data is never rewritten with the key stream of the previous copy.
+// A nil ObjectDataCodec leaves the data as is, it is the codec of data stored while no data codec was registered.
+type ObjectDataCodec struct {
+	// KeyID is the ID of the key that encrypts the data, if the data codec is a DataKeyring
+	KeyID string `json:"key-id" bson:"key-id"`
+
+	// Nonce is the random nonce of the copy of the data
+	Nonce []byte `json:"nonce" bson:"nonce"`
+}
+
+// NewObjectDataCodec returns the codec of a new copy of an object's data, or nil if no data codec is registered
+func NewObjectDataCodec() (*ObjectDataCodec, common.SyncServiceError) {
+	if !HasDataCodec() {
+		return nil, nil
+	}
+	nonce := make([]byte, dataNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, &Error{"Failed to generate a data nonce. Error: " + err.Error()}
+	}
+	return &ObjectDataCodec{KeyID: currentDataKeyID(), Nonce: nonce}, nil
+}
+
+// GetObjectDataCodec returns the codec of the stored copy of the object's data, or nil if the data isn't encoded.
+// The codec is looked up in the store only if a data codec is registered.
+func GetObjectDataCodec(store Storage, orgID string, objectType string, objectID string) (*ObjectDataCodec, common.SyncServiceError) {
+	if !HasDataCodec() {
+		return nil, nil
+	}
+	return store.RetrieveObjectDataCodec(orgID, objectType, objectID)
+}
+
+// Encode transforms, in place, the data at offset of the copy of the object's data before it is stored
+func (codec *ObjectDataCodec) Encode(offset int64, data []byte) {
+	if dataCodec := codec.dataCodec(); dataCodec != nil {
+		dataCodec.Encode(codec.Nonce, offset, data)
+	}
+}
+
+// Decode transforms back, in place, the data at offset of the copy of the object's data after it is read from the storage
+func (codec *ObjectDataCodec) Decode(offset int64, data []byte) {
+	if dataCodec := codec.dataCodec(); dataCodec != nil {
+		dataCodec.Decode(codec.Nonce, offset, data)
+	}
+}
+
+// NewEncodingReader returns a reader that encodes the data read from reader, which starts at offset of the copy of the data.
+// The store records the codec of the data that it stores from the returned reader.
+func (codec *ObjectDataCodec) NewEncodingReader(reader io.Reader, offset int64) io.Reader {
+	dataCodec := codec.dataCodec()
+	if dataCodec == nil || reader == nil {
+		return reader
+	}
+	return &codecReader{reader: reader, codec: codec, transform: dataCodec.Encode, encoding: true, offset: offset}
+}
+
+// NewDecodingReader returns a reader that decodes the data read from reader, which starts at offset of the copy of the data.
+// The returned reader can be closed with the store's CloseDataReader.
+func (codec *ObjectDataCodec) NewDecodingReader(reader io.Reader, offset int64) io.Reader {
+	dataCodec := codec.dataCodec()
+	if dataCodec == nil || reader == nil {
+		return reader
+	}
+	return &codecReader{reader: reader, codec: codec, transform: dataCodec.Decode, offset: offset}
+}
+
+// dataCodec returns the data codec that transforms the copy of the data, or nil if the data isn't transformed
+func (codec *ObjectDataCodec) dataCodec() DataCodec {
+	if codec == nil {
+		return nil
+	}
+	dataCodec := getDataCodec()
+	if keyring, ok := dataCodec.(*DataKeyring); ok {
+		return keyring.keyCodec(codec.KeyID)
+	}
+	return dataCodec
+}
+
+type codecReader struct {
+	reader    io.Reader
+	codec     *ObjectDataCodec
+	transform func(nonce []byte, offset int64, data []byte)
+	encoding  bool
+	offset    int64
+}
+
+func (reader *codecReader) Read(buffer []byte) (int, error) {
+	n, err := reader.reader.Read(buffer)
+	if n > 0 {
+		reader.transform(reader.codec.Nonce, reader.offset, buffer[:n])
+		reader.offset += int64(n)
+	}
+	return n, err
+}
+
+// unwrapDataReader returns the reader of the storage that a codec reader reads from
+func unwrapDataReader(dataReader io.Reader) io.Reader {
+	if reader, ok := dataReader.(*codecReader); ok {
+		return reader.reader
+	}
+	return dataReader
+}
+
+// encodingDataCodec returns the codec of the data read from dataReader, which is encoded if dataReader is an encoding reader
+func encodingDataCodec(dataReader io.Reader) *ObjectDataCodec {
+	if reader, ok := dataReader.(*codecReader); ok && reader.encoding {
+		return reader.codec
+	}
+	return nil
+}
+
+type aesCTRCodec struct {
+	block cipher.Block
+}
+
+// NewAESCTRCodec returns a codec that encrypts the data of objects with AES in counter mode.
+// The key must be 16, 24, or 32 bytes long. The nonce of each copy of an object's data is its initial counter block.
+func NewAESCTRCodec(key []byte) (DataCodec, common.SyncServiceError) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &Error{"Invalid data encryption key. Error: " + err.Error()}
+	}
+	return &aesCTRCodec{block: block}, nil
+}
+
+func (codec *aesCTRCodec) Encode(nonce []byte, offset int64, data []byte) {
+	codec.xorKeyStream(nonce, offset, data)
+}
+
+func (codec *aesCTRCodec) Decode(nonce []byte, offset int64, data []byte) {
+	codec.xorKeyStream(nonce, offset, data)
+}
+
+func (codec *aesCTRCodec) xorKeyStream(nonce []byte, offset int64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	// Advance the 128 bit big endian counter to the block that contains offset
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, nonce)
+	counter := uint64(offset / aes.BlockSize)
+	for i := aes.BlockSize - 1; i >= 0 && counter != 0; i-- {
+		sum := uint64(iv[i]) + counter&0xff
+		iv[i] = byte(sum)
+		counter = counter>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(codec.block, iv)
+
+	if skip := int(offset % aes.BlockSize); skip != 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	stream.XORKeyStream(data, data)
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestAESCTRCodec(t *testing.T) {
+	if _, err := NewAESCTRCodec([]byte("short")); err == nil {
+		t.Errorf("NewAESCTRCodec didn't fail for an invalid key")
+	}
+
+	codec, err := NewAESCTRCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewAESCTRCodec failed. Error: %s", err.Error())
+	}
+
+	nonce := []byte("fedcba9876543210")
+	plain := bytes.Repeat([]byte("edge sync service data "), 10)
+	encoded := append([]byte(nil), plain...)
+	codec.Encode(nonce, 0, encoded)
+	if bytes.Equal(encoded, plain) {
+		t.Errorf("Encode didn't transform the data")
+	}
+
+	// Chunks at arbitrary offsets are decoded independently
+	offsets := []int{0, 5, 17, 33, 100, len(plain)}
+	for i := 0; i < len(offsets)-1; i++ {
+		chunk := append([]byte(nil), encoded[offsets[i]:offsets[i+1]]...)
+		codec.Decode(nonce, int64(offsets[i]), chunk)
+		if !bytes.Equal(chunk, plain[offsets[i]:offsets[i+1]]) {
+			t.Errorf("Wrong data decoded at offset %d", offsets[i])
+		}
+	}
+
+	// The counter carries across the bytes of the nonce
+	carry := bytes.Repeat([]byte{0xff}, len(nonce))
+	data := append([]byte(nil), plain...)
+	codec.Encode(carry, 0, data)
+	chunk := append([]byte(nil), data[40:]...)
+	codec.Decode(carry, 40, chunk)
+	if !bytes.Equal(chunk, plain[40:]) {
+		t.Errorf("Wrong data decoded after the counter wrapped around")
+	}
+}
+
+func TestObjectDataCodec(t *testing.T) {
+	var noCodec *ObjectDataCodec
+	plain := bytes.Repeat([]byte("0123456789"), 50)
+	data := append([]byte(nil), plain...)
+	noCodec.Encode(0, data)
+	dataReader := bytes.NewReader(data)
+	if !bytes.Equal(data, plain) || noCodec.NewEncodingReader(dataReader, 0) != dataReader {
+		t.Errorf("A nil codec transformed the data")
+	}
+	if dataCodec, err := NewObjectDataCodec(); err != nil || dataCodec != nil {
+		t.Errorf("NewObjectDataCodec returned a codec while no data codec is registered")
+	}
+
+	codec, err := NewAESCTRCodec([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewAESCTRCodec failed. Error: %s", err.Error())
+	}
+	RegisterDataCodec(codec)
+	defer RegisterDataCodec(nil)
+
+	dataCodec, err := NewObjectDataCodec()
+	if err != nil || dataCodec == nil {
+		t.Fatalf("NewObjectDataCodec failed")
+	}
+	otherCodec, _ := NewObjectDataCodec()
+	if bytes.Equal(dataCodec.Nonce, otherCodec.Nonce) {
+		t.Errorf("Two copies of the data have the same nonce")
+	}
+
+	reader := dataCodec.NewEncodingReader(bytes.NewReader(plain[7:]), 7)
+	if encodingDataCodec(reader) != dataCodec {
+		t.Errorf("encodingDataCodec didn't return the codec of the encoding reader")
+	}
+	encoded, _ := ioutil.ReadAll(reader)
+	if len(encoded) != len(plain)-7 || bytes.Equal(encoded, plain[7:]) {
+		t.Errorf("The encoding reader didn't transform the data")
+	}
+
+	// Different copies of the same data are encoded with different key streams
+	other := append([]byte(nil), plain[7:]...)
+	otherCodec.Encode(7, other)
+	if bytes.Equal(other, encoded) {
+		t.Errorf("Two copies of the data were encoded with the same key stream")
+	}
+
+	sourceReader := bytes.NewReader(encoded)
+	reader = dataCodec.NewDecodingReader(sourceReader, 7)
+	if unwrapDataReader(reader) != sourceReader {
+		t.Errorf("unwrapDataReader didn't return the storage reader")
+	}
+	if encodingDataCodec(reader) != nil {
+		t.Errorf("encodingDataCodec returned the codec of a decoding reader")
+	}
+	decoded, _ := ioutil.ReadAll(reader)
+	if !bytes.Equal(decoded, plain[7:]) {
+		t.Errorf("The decoding reader didn't restore the data")
+	}
+
+	data = append([]byte(nil), encoded[93:200]...)
+	dataCodec.Decode(100, data)
+	if !bytes.Equal(data, plain[100:207]) {
+		t.Errorf("Decode didn't restore the data")
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// DataKeyring is a data codec that encrypts the data of each object with one of several keys, so that the key can be
+// rotated without re-encrypting the data of all the objects at once.
+// The ID of the key that encrypts a copy of an object's data is recorded in its codec (see ObjectDataCodec): new copies
+// of the data use the current key, and the existing copies keep their key until the data is re-encrypted with the current
+// key (see the store's StoreReencryptedObjectData). Therefore the code that encodes and decodes the data with the object's
+// codec doesn't need to know which key an object uses.
+type DataKeyring struct {
+	codecs       map[string]DataCodec
+	currentKeyID string
+}
+
+// NewDataKeyring returns a keyring of AES keys, by their IDs, with currentKeyID as the ID of the current key
+func NewDataKeyring(keys map[string][]byte, currentKeyID string) (*DataKeyring, common.SyncServiceError) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, &Error{fmt.Sprintf("The current data encryption key %s isn't in the keyring", currentKeyID)}
+	}
+	keyring := DataKeyring{codecs: make(map[string]DataCodec), currentKeyID: currentKeyID}
+	for keyID, key := range keys {
+		codec, err := NewAESCTRCodec(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.codecs[keyID] = codec
+	}
+	return &keyring, nil
+}
+
+// CurrentKeyID returns the ID of the key that encrypts the new copies of the data of objects
+func (keyring *DataKeyring) CurrentKeyID() string {
+	return keyring.currentKeyID
+}
+
+// Encode encrypts, in place, the data at offset of a copy of an object's data with the current key
+func (keyring *DataKeyring) Encode(nonce []byte, offset int64, data []byte) {
+	keyring.codecs[keyring.currentKeyID].Encode(nonce, offset, data)
+}
+
+// Decode decrypts, in place, the data at offset of a copy of an object's data with the current key
+func (keyring *DataKeyring) Decode(nonce []byte, offset int64, data []byte) {
+	keyring.codecs[keyring.currentKeyID].Decode(nonce, offset, data)
+}
+
+// keyCodec returns the codec of the key keyID
+func (keyring *DataKeyring) keyCodec(keyID string) DataCodec {
+	if codec, ok := keyring.codecs[keyID]; ok {
+		return codec
+	}
+	if log.IsLogging(logger.ERROR) {
+		log.Error("The data encryption key %s isn't in the keyring\n", keyID)
+	}
+	return keyring.codecs[keyring.currentKeyID]
+}
+
+// GetDataKeyring returns the registered data codec if it is a keyring, and nil otherwise
+func GetDataKeyring() *DataKeyring {
+	keyring, _ := getDataCodec().(*DataKeyring)
+	return keyring
+}
+
+// currentDataKeyID returns the ID of the key that encrypts the new copies of the data of objects
+func currentDataKeyID() string {
+	if keyring := GetDataKeyring(); keyring != nil {
+		return keyring.currentKeyID
+	}
+	return ""
+}
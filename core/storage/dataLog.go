@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// The data log is a write-ahead log of the chunks of objects' data that were written to the storage.
+// A chunk is logged only after its data was flushed to disk, therefore after a restart the log tells which chunks
+// of a partially received object are durable, even if the node lost power in the middle of a write.
+// Each record is a JSON line. A torn record at the end of the log (the node lost power while logging it) is ignored.
+
+type dataLogRecord struct {
+	OrgID      string `json:"org"`
+	ObjectType string `json:"type"`
+	ObjectID   string `json:"id"`
+	InstanceID int64  `json:"instanceId"`
+	Offset     int64  `json:"offset"`
+	Length     int64  `json:"length"`
+	Checksum   uint32 `json:"checksum,omitempty"`
+
+	// Forget marks that the object's data was completely received or deleted, and its chunks are no longer needed
+	Forget bool `json:"forget,omitempty"`
+}
+
+type dataLogObject struct {
+	orgID      string
+	objectType string
+	objectID   string
+	instanceID int64
+	chunks     map[int64]LoggedDataChunk
+}
+
+// LoggedDataChunk is a chunk of an object's data that was written to the storage
+type LoggedDataChunk struct {
+	Offset int64
+	Length int64
+
+	// Checksum is the CRC32 (IEEE) checksum of the chunk's data
+	Checksum uint32
+}
+
+var dataLogFile *os.File
+var dataLogObjects map[string]*dataLogObject
+var dataLogLock sync.Mutex
+
+// OpenDataLog opens the data log at path, creating it if it doesn't exist.
+// The log is compacted on open, so that it only holds the chunks of objects that weren't completely received.
+func OpenDataLog(path string) common.SyncServiceError {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	if dataLogFile != nil {
+		return nil
+	}
+
+	objects, err := readDataLog(path)
+	if err != nil {
+		return err
+	}
+	if err := writeDataLog(path, objects); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to open the data log. Error: %s.", err)}
+	}
+	dataLogFile = file
+	dataLogObjects = objects
+	return nil
+}
+
+// CloseDataLog closes the data log, and drops the chunks loaded from a checkpoint
+func CloseDataLog() {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	if dataLogFile != nil {
+		dataLogFile.Close()
+		dataLogFile = nil
+	}
+	dataLogObjects = nil
+}
+
+// LogDataChunk logs that the chunk at offset of the object's data was written to the storage.
+// It must be called only after the chunk's data was flushed to disk. checksum is the CRC32 (IEEE) checksum of the chunk's data.
+func LogDataChunk(orgID string, objectType string, objectID string, instanceID int64, offset int64, length int64,
+	checksum uint32) common.SyncServiceError {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	if dataLogFile == nil {
+		return nil
+	}
+
+	record := dataLogRecord{OrgID: orgID, ObjectType: objectType, ObjectID: objectID, InstanceID: instanceID, Offset: offset, Length: length,
+		Checksum: checksum}
+	if err := appendDataLogRecord(record); err != nil {
+		return err
+	}
+	applyDataLogRecord(dataLogObjects, record)
+	return nil
+}
+
+// GetLoggedDataChunks returns the logged chunks of the data of the object's instance, sorted by their offsets
+func GetLoggedDataChunks(orgID string, objectType string, objectID string, instanceID int64) []LoggedDataChunk {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	object, ok := dataLogObjects[createObjectCollectionID(orgID, objectType, objectID)]
+	if !ok || object.instanceID != instanceID {
+		return nil
+	}
+	chunks := make([]LoggedDataChunk, 0, len(object.chunks))
+	for _, chunk := range object.chunks {
+		chunks = append(chunks, chunk)
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+	return chunks
+}
+
+// ForgetDataChunks removes the logged chunks of the object's data
+func ForgetDataChunks(orgID string, objectType string, objectID string) common.SyncServiceError {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if dataLogFile == nil {
+		// The chunks were loaded from a checkpoint
+		delete(dataLogObjects, id)
+		return nil
+	}
+	if _, ok := dataLogObjects[id]; !ok {
+		return nil
+	}
+
+	record := dataLogRecord{OrgID: orgID, ObjectType: objectType, ObjectID: objectID, Forget: true}
+	if err := appendDataLogRecord(record); err != nil {
+		return err
+	}
+	applyDataLogRecord(dataLogObjects, record)
+	return nil
+}
+
+// DataCheckpoint holds the chunks of an object's data that were written to the storage when the node was shut down
+type DataCheckpoint struct {
+	OrgID      string
+	ObjectType string
+	ObjectID   string
+	InstanceID int64
+	Chunks     []LoggedDataChunk
+}
+
+// WriteDataCheckpoint writes the chunks of the transfers that were in flight when the node was shut down to a log at path,
+// in the format of the data log, so that the transfers are resumed after a restart (see LoadDataCheckpoint).
+// It does nothing if the data log is open, since the data log already holds the chunks.
+func WriteDataCheckpoint(path string, checkpoints []DataCheckpoint) common.SyncServiceError {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	if dataLogFile != nil {
+		return nil
+	}
+
+	objects := make(map[string]*dataLogObject)
+	for _, checkpoint := range checkpoints {
+		for _, chunk := range checkpoint.Chunks {
+			applyDataLogRecord(objects, dataLogRecord{OrgID: checkpoint.OrgID, ObjectType: checkpoint.ObjectType,
+				ObjectID: checkpoint.ObjectID, InstanceID: checkpoint.InstanceID, Offset: chunk.Offset, Length: chunk.Length})
+		}
+	}
+	if len(objects) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return &Error{fmt.Sprintf("Failed to remove the data checkpoint. Error: %s.", err)}
+		}
+		return nil
+	}
+	return writeDataLog(path, objects)
+}
+
+// LoadDataCheckpoint loads the chunks written by WriteDataCheckpoint, to be returned by GetLoggedDataChunks, and removes
+// the checkpoint. It is used when the data log isn't used, and the chunks are kept until the transfers are resumed or the node stops.
+func LoadDataCheckpoint(path string) common.SyncServiceError {
+	dataLogLock.Lock()
+	defer dataLogLock.Unlock()
+
+	if dataLogFile != nil {
+		return nil
+	}
+
+	objects, err := readDataLog(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return &Error{fmt.Sprintf("Failed to remove the data checkpoint. Error: %s.", err)}
+	}
+	dataLogObjects = objects
+	return nil
+}
+
+// Must be called while holding dataLogLock
+func appendDataLogRecord(record dataLogRecord) common.SyncServiceError {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal a data log record. Error: %s.", err)}
+	}
+	if _, err := dataLogFile.Write(append(line, '\n')); err != nil {
+		return &Error{fmt.Sprintf("Failed to write to the data log. Error: %s.", err)}
+	}
+	if err := dataLogFile.Sync(); err != nil {
+		return &Error{fmt.Sprintf("Failed to sync the data log. Error: %s.", err)}
+	}
+	return nil
+}
+
+func applyDataLogRecord(objects map[string]*dataLogObject, record dataLogRecord) {
+	id := createObjectCollectionID(record.OrgID, record.ObjectType, record.ObjectID)
+	if record.Forget {
+		delete(objects, id)
+		return
+	}
+	object, ok := objects[id]
+	if !ok || object.instanceID != record.InstanceID {
+		// The chunks of a previous instance of the object are obsolete
+		object = &dataLogObject{orgID: record.OrgID, objectType: record.ObjectType, objectID: record.ObjectID,
+			instanceID: record.InstanceID, chunks: make(map[int64]LoggedDataChunk)}
+		objects[id] = object
+	}
+	object.chunks[record.Offset] = LoggedDataChunk{Offset: record.Offset, Length: record.Length, Checksum: record.Checksum}
+}
+
+func readDataLog(path string) (map[string]*dataLogObject, common.SyncServiceError) {
+	objects := make(map[string]*dataLogObject)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return objects, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to open the data log. Error: %s.", err)}
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record dataLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn record, the rest of the log wasn't written
+			break
+		}
+		applyDataLogRecord(objects, record)
+	}
+	return objects, nil
+}
+
+// writeDataLog replaces the log at path with a log that holds only the chunks of the given objects
+func writeDataLog(path string, objects map[string]*dataLogObject) common.SyncServiceError {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to compact the data log. Error: %s.", err)}
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, object := range objects {
+		for _, chunk := range object.chunks {
+			line, _ := json.Marshal(dataLogRecord{OrgID: object.orgID, ObjectType: object.objectType, ObjectID: object.objectID,
+				InstanceID: object.instanceID, Offset: chunk.Offset, Length: chunk.Length, Checksum: chunk.Checksum})
+			writer.Write(append(line, '\n'))
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to compact the data log. Error: %s.", err)}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return &Error{fmt.Sprintf("Failed to compact the data log. Error: %s.", err)}
+	}
+	return nil
+}
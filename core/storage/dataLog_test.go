@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datalog")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data.wal")
+
+	if err := OpenDataLog(path); err != nil {
+		t.Fatalf("OpenDataLog failed. Error: %s", err.Error())
+	}
+	defer CloseDataLog()
+
+	for _, offset := range []int64{20, 0, 10} {
+		if err := LogDataChunk("myorg", "type1", "1", 5, offset, 10, uint32(offset)); err != nil {
+			t.Errorf("LogDataChunk failed. Error: %s", err.Error())
+		}
+	}
+	if err := LogDataChunk("myorg", "type1", "2", 1, 0, 10, 0); err != nil {
+		t.Errorf("LogDataChunk failed. Error: %s", err.Error())
+	}
+	if err := LogDataChunk("myorg", "type1", "3", 1, 0, 10, 0); err != nil {
+		t.Errorf("LogDataChunk failed. Error: %s", err.Error())
+	}
+	// A new instance of the object replaces the chunks of the previous instance
+	if err := LogDataChunk("myorg", "type1", "2", 2, 10, 10, 10); err != nil {
+		t.Errorf("LogDataChunk failed. Error: %s", err.Error())
+	}
+	if err := ForgetDataChunks("myorg", "type1", "3"); err != nil {
+		t.Errorf("ForgetDataChunks failed. Error: %s", err.Error())
+	}
+
+	checkChunks := func(objectID string, instanceID int64, expected []int64) {
+		chunks := GetLoggedDataChunks("myorg", "type1", objectID, instanceID)
+		if len(chunks) != len(expected) {
+			t.Errorf("GetLoggedDataChunks returned %d chunks of %s instead of %d", len(chunks), objectID, len(expected))
+			return
+		}
+		for i, chunk := range chunks {
+			if chunk.Offset != expected[i] || chunk.Length != 10 || chunk.Checksum != uint32(chunk.Offset) {
+				t.Errorf("GetLoggedDataChunks returned a wrong chunk of %s: %d:%d:%d", objectID, chunk.Offset, chunk.Length, chunk.Checksum)
+			}
+		}
+	}
+	checkChunks("1", 5, []int64{0, 10, 20})
+	checkChunks("1", 4, nil)
+	checkChunks("2", 1, nil)
+	checkChunks("2", 2, []int64{10})
+	checkChunks("3", 1, nil)
+
+	// A torn record at the end of the log is ignored when the log is opened again
+	CloseDataLog()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open the data log. Error: %s", err.Error())
+	}
+	file.Write([]byte(`{"org":"myorg","type":"type1","id":"1","instanceId":5,"off`))
+	file.Close()
+
+	if err := OpenDataLog(path); err != nil {
+		t.Fatalf("OpenDataLog failed. Error: %s", err.Error())
+	}
+	checkChunks("1", 5, []int64{0, 10, 20})
+	checkChunks("2", 2, []int64{10})
+	checkChunks("3", 1, nil)
+
+	if err := LogDataChunk("myorg", "type1", "1", 5, 30, 10, 30); err != nil {
+		t.Errorf("LogDataChunk failed. Error: %s", err.Error())
+	}
+	checkChunks("1", 5, []int64{0, 10, 20, 30})
+}
+
+func TestDataCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datacheckpoint")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data-checkpoint.log")
+	defer CloseDataLog()
+
+	checkpoints := []DataCheckpoint{
+		{OrgID: "myorg", ObjectType: "type1", ObjectID: "1", InstanceID: 5,
+			Chunks: []LoggedDataChunk{{Offset: 0, Length: 30}, {Offset: 50, Length: 10}}},
+		{OrgID: "myorg", ObjectType: "type1", ObjectID: "2", InstanceID: 1, Chunks: []LoggedDataChunk{{Offset: 10, Length: 10}}},
+	}
+	if err := WriteDataCheckpoint(path, checkpoints); err != nil {
+		t.Fatalf("WriteDataCheckpoint failed. Error: %s", err.Error())
+	}
+	if err := LoadDataCheckpoint(path); err != nil {
+		t.Fatalf("LoadDataCheckpoint failed. Error: %s", err.Error())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("The checkpoint wasn't removed after it was loaded")
+	}
+
+	chunks := GetLoggedDataChunks("myorg", "type1", "1", 5)
+	if len(chunks) != 2 || chunks[0].Offset != 0 || chunks[0].Length != 30 || chunks[1].Offset != 50 || chunks[1].Length != 10 {
+		t.Errorf("GetLoggedDataChunks returned wrong chunks of a checkpointed object: %v", chunks)
+	}
+	if chunks := GetLoggedDataChunks("myorg", "type1", "1", 6); len(chunks) != 0 {
+		t.Errorf("GetLoggedDataChunks returned chunks of another instance of a checkpointed object")
+	}
+
+	// The chunks of a resumed transfer are forgotten
+	if err := ForgetDataChunks("myorg", "type1", "2"); err != nil {
+		t.Errorf("ForgetDataChunks failed. Error: %s", err.Error())
+	}
+	if chunks := GetLoggedDataChunks("myorg", "type1", "2", 1); len(chunks) != 0 {
+		t.Errorf("GetLoggedDataChunks returned the chunks of a forgotten object")
+	}
+
+	// A checkpoint without transfers removes the previous checkpoint
+	if err := WriteDataCheckpoint(path, checkpoints); err != nil {
+		t.Fatalf("WriteDataCheckpoint failed. Error: %s", err.Error())
+	}
+	if err := WriteDataCheckpoint(path, nil); err != nil {
+		t.Fatalf("WriteDataCheckpoint failed. Error: %s", err.Error())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("An empty checkpoint didn't remove the previous checkpoint")
+	}
+
+	CloseDataLog()
+	if chunks := GetLoggedDataChunks("myorg", "type1", "1", 5); len(chunks) != 0 {
+		t.Errorf("The checkpointed chunks were kept after the data log was closed")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package storage
+
+import "syscall"
+
+// availableDiskSpace returns the disk space, in bytes, available to the sync service in the file system of path
+func availableDiskSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return -1, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
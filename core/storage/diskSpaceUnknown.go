@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package storage
+
+// availableDiskSpace returns -1, the available disk space is unknown on this platform
+func availableDiskSpace(path string) (int64, error) {
+	return -1, nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,7 +24,15 @@ type InMemoryStorage struct {
 	objects       map[string]inMemoryObject
 	notifications map[string]common.Notification
 	webhooks      map[string][]string
+	deliveries    map[string]common.WebhookDelivery
+	cleanups      map[string]common.ObjectCleanup
 	timebase      int64
+	accessCounter int64
+	dataSize      int64
+
+	// The order sequence numbers of the objects that are sent and delivered in order, by the types and the destinations
+	sentSequences      map[string]int64
+	deliveredSequences map[string]int64
 }
 
 type inMemoryObject struct {
@@ -34,6 +43,9 @@ type inMemoryObject struct {
 	remainingReceivers               int
 	consumedTimestamp                time.Time
 	removedDestinationPolicyServices []common.ServiceID
+	lastAccess                       int64
+	pendingDeletion                  bool
+	dataCodec                        *ObjectDataCodec
 }
 
 // Init initializes the InMemory store
@@ -43,6 +55,10 @@ func (store *InMemoryStorage) Init() common.SyncServiceError {
 	store.objects = make(map[string]inMemoryObject)
 	store.notifications = make(map[string]common.Notification)
 	store.webhooks = make(map[string][]string)
+	store.deliveries = make(map[string]common.WebhookDelivery)
+	store.cleanups = make(map[string]common.ObjectCleanup)
+	store.sentSequences = make(map[string]int64)
+	store.deliveredSequences = make(map[string]int64)
 
 	currentTime := time.Now().UnixNano()
 	store.timebase = currentTime
@@ -98,6 +114,10 @@ func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte,
 		if data != nil && !metaData.NoData && !metaData.MetaOnly {
 			metaData.DataID = newID
 		}
+		metaData.InstanceSequence = 1
+		if object, ok := store.objects[id]; ok {
+			metaData.InstanceSequence = object.meta.InstanceSequence + 1
+		}
 	}
 
 	if metaData.MetaOnly {
@@ -111,19 +131,41 @@ func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte,
 			object.status = status
 			object.remainingConsumers = metaData.ExpectedConsumers
 			object.remainingReceivers = metaData.ExpectedConsumers
+			object.pendingDeletion = false
 			if metaData.NoData {
 				object.data = nil
 			}
-			store.objects[id] = object
+			object.lastAccess = store.nextAccess()
+			store.setObject(id, object)
 			return nil, nil
 		}
 		// If not found, insert the object
 	}
+	var dataCodec *ObjectDataCodec
 	if metaData.NoData {
 		data = nil
+	} else if data == nil && len(metaData.PatchRanges) != 0 && status != common.NotReadyToSend && status != common.ReadyToSend {
+		// A patch update overwrites only the changed byte ranges of the existing data
+		if object, ok := store.objects[id]; ok {
+			data = object.data
+			if int64(len(data)) > metaData.ObjectSize {
+				data = data[:metaData.ObjectSize]
+			}
+			dataCodec = object.dataCodec
+		}
+	} else if data != nil {
+		var err common.SyncServiceError
+		if dataCodec, err = NewObjectDataCodec(); err != nil {
+			return nil, err
+		}
+		if dataCodec != nil {
+			data = append([]byte(nil), data...)
+			dataCodec.Encode(0, data)
+		}
 	}
-	store.objects[id] = inMemoryObject{meta: metaData, data: data, status: status,
-		remainingConsumers: metaData.ExpectedConsumers, remainingReceivers: metaData.ExpectedConsumers}
+	store.setObject(id, inMemoryObject{meta: metaData, data: data, status: status,
+		remainingConsumers: metaData.ExpectedConsumers, remainingReceivers: metaData.ExpectedConsumers, lastAccess: store.nextAccess(),
+		dataCodec: dataCodec})
 
 	return nil, nil
 }
@@ -150,10 +192,13 @@ func (store *InMemoryStorage) StoreObjectData(orgID string, objectType string, o
 			newID := store.getInstanceID()
 			object.meta.InstanceID = newID
 			object.meta.DataID = newID
+			object.meta.InstanceSequence++
 		}
 		object.data = data
 		object.meta.ObjectSize = int64(len(object.data))
-		store.objects[id] = object
+		object.dataCodec = encodingDataCodec(dataReader)
+		object.lastAccess = store.nextAccess()
+		store.setObject(id, object)
 		return true, nil
 	}
 
@@ -183,6 +228,7 @@ func (store *InMemoryStorage) AppendObjectData(orgID string, objectType string,
 		}
 		if isFirstChunk {
 			object.data = make([]byte, total)
+			object.dataCodec = encodingDataCodec(dataReader)
 		} else {
 			object.data = ensureArrayCapacity(object.data, total)
 		}
@@ -197,13 +243,21 @@ func (store *InMemoryStorage) AppendObjectData(orgID string, objectType string,
 				return &Error{fmt.Sprintf("Read %d bytes for the object data, instead of %d", count, dataLength)}
 			}
 		}
-		store.objects[id] = object
+		object.lastAccess = store.nextAccess()
+		store.setObject(id, object)
 		return nil
 	}
 
 	return notFound
 }
 
+// AppendObjectZeroData appends a chunk of zeros to the object's data, the zeros are written to the data in memory
+func (store *InMemoryStorage) AppendObjectZeroData(orgID string, objectType string, objectID string, length uint32, offset int64,
+	total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	return store.AppendObjectData(orgID, objectType, objectID, NewZeroReader(int64(length)), length, offset, total, isFirstChunk,
+		isLastChunk)
+}
+
 // UpdateObjectStatus updates an object's status
 func (store *InMemoryStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
 	store.lock()
@@ -215,13 +269,41 @@ func (store *InMemoryStorage) UpdateObjectStatus(orgID string, objectType string
 		if status == common.ConsumedByDest {
 			object.consumedTimestamp = time.Now()
 		}
-		store.objects[id] = object
+		store.setObject(id, object)
 		return nil
 	}
 
 	return &NotFound{"Object not found"}
 }
 
+// UpdateObjectMetadataOnly applies a metadata only update, received from the other side, to the stored object in place
+func (store *InMemoryStorage) UpdateObjectMetadataOnly(metaData common.MetaData, status string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	id := getObjectCollectionID(metaData)
+	object, ok := store.objects[id]
+	if !ok {
+		return &NotFound{"Object not found"}
+	}
+	if object.status == common.ConsumedByDest {
+		// On ESS we remove the data of consumed objects, therefore we can't accept "meta only" updates
+		return &Error{"Can't update only the meta data of consumed object"}
+	}
+	metaData.DataID = object.meta.DataID
+	metaData.ObjectSize = object.meta.ObjectSize
+	metaData.ChunkSize = object.meta.ChunkSize
+	metaData.PatchRanges = object.meta.PatchRanges
+	object.meta = metaData
+	object.status = status
+	object.remainingConsumers = metaData.ExpectedConsumers
+	object.remainingReceivers = metaData.ExpectedConsumers
+	object.pendingDeletion = false
+	object.lastAccess = store.nextAccess()
+	store.setObject(id, object)
+	return nil
+}
+
 // UpdateObjectSourceDataURI updates object's source data URI
 func (store *InMemoryStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
 	store.lock()
@@ -230,7 +312,76 @@ func (store *InMemoryStorage) UpdateObjectSourceDataURI(orgID string, objectType
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.meta.SourceDataURI = sourceDataURI
-		store.objects[id] = object
+		store.setObject(id, object)
+		return nil
+	}
+
+	return notFound
+}
+
+// UpdateObjectPriority updates the priority of the transfers of the object's data
+func (store *InMemoryStorage) UpdateObjectPriority(orgID string, objectType string, objectID string, priority int) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		object.meta.Priority = priority
+		store.setObject(id, object)
+		return nil
+	}
+
+	return notFound
+}
+
+// RetrieveObjectDataCodec returns the codec of the object's data, or nil if the data isn't encoded or the object doesn't exist
+func (store *InMemoryStorage) RetrieveObjectDataCodec(orgID string, objectType string, objectID string) (*ObjectDataCodec, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		return object.dataCodec, nil
+	}
+	return nil, nil
+}
+
+// RetrieveObjectsWithOtherDataKey returns the objects whose data is encrypted with a key other than keyID
+func (store *InMemoryStorage) RetrieveObjectsWithOtherDataKey(keyID string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if obj.data != nil && (obj.dataCodec == nil || obj.dataCodec.KeyID != keyID) {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
+// StoreReencryptedObjectData replaces the object's data with the same data read from dataReader, encoded with codec,
+// and records the codec
+func (store *InMemoryStorage) StoreReencryptedObjectData(orgID string, objectType string, objectID string, codec *ObjectDataCodec,
+	dataReader io.Reader) common.SyncServiceError {
+	var data []byte
+	if dataReader != nil {
+		var err error
+		if data, err = ioutil.ReadAll(dataReader); err != nil {
+			return &Error{"Failed to read object data. Error: " + err.Error()}
+		}
+	}
+
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		if data != nil {
+			object.data = data
+		}
+		object.dataCodec = codec
+		store.setObject(id, object)
 		return nil
 	}
 
@@ -272,7 +423,7 @@ func (store *InMemoryStorage) ResetObjectRemainingConsumers(orgID string, object
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.remainingConsumers = object.meta.ExpectedConsumers
-		store.objects[id] = object
+		store.setObject(id, object)
 		return nil
 	}
 
@@ -288,7 +439,7 @@ func (store *InMemoryStorage) DecrementAndReturnRemainingConsumers(orgID string,
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.remainingConsumers--
-		store.objects[id] = object
+		store.setObject(id, object)
 		return object.remainingConsumers, nil
 	}
 
@@ -304,7 +455,7 @@ func (store *InMemoryStorage) DecrementAndReturnRemainingReceivers(orgID string,
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.remainingReceivers--
-		store.objects[id] = object
+		store.setObject(id, object)
 		return object.remainingReceivers, nil
 	}
 
@@ -328,6 +479,21 @@ func (store *InMemoryStorage) RetrieveUpdatedObjects(orgID string, objectType st
 	return result, nil
 }
 
+// RetrieveObjectsWithStatus returns the objects of the type that have the given status
+func (store *InMemoryStorage) RetrieveObjectsWithStatus(orgID string, objectType string, status string) ([]common.MetaData,
+	common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if orgID == obj.meta.DestOrgID && objectType == obj.meta.ObjectType && obj.status == status {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *InMemoryStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -396,6 +562,20 @@ func (store *InMemoryStorage) RetrieveConsumedObjects() ([]common.ConsumedObject
 	return result, nil
 }
 
+// RetrieveReceivedObjects returns all the objects that were completely received from the other side and not deleted
+func (store *InMemoryStorage) RetrieveReceivedObjects() ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if obj.status == common.CompletelyReceived || obj.status == common.ObjReceived || obj.status == common.ObjConsumed {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
 // RetrieveObject returns the object meta data with the specified parameters
 func (store *InMemoryStorage) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
 	store.lock()
@@ -429,7 +609,10 @@ func (store *InMemoryStorage) RetrieveObjectData(orgID string, objectType string
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
-		if object.data != nil && len(object.data) > 0 {
+		// An empty object has empty, non-nil data, unlike an object without data
+		if object.data != nil {
+			object.lastAccess = store.nextAccess()
+			store.setObject(id, object)
 			return bytes.NewReader(object.data), nil
 		}
 		return nil, nil
@@ -440,13 +623,18 @@ func (store *InMemoryStorage) RetrieveObjectData(orgID string, objectType string
 
 // CloseDataReader closes the data reader if necessary
 func (store *InMemoryStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
-	switch v := dataReader.(type) {
+	switch v := unwrapDataReader(dataReader).(type) {
 	case *os.File:
 		return v.Close()
 	}
 	return nil
 }
 
+// OpenObjectDataReader opens a reader of the object's data positioned at offset, for reading consecutive chunks
+func (store *InMemoryStorage) OpenObjectDataReader(orgID string, objectType string, objectID string, offset int64) (ObjectDataReader, common.SyncServiceError) {
+	return openObjectDataReader(store, orgID, objectType, objectID, offset)
+}
+
 // ReadObjectData returns the object data with the specified parameters
 func (store *InMemoryStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
 	store.lock()
@@ -466,6 +654,8 @@ func (store *InMemoryStorage) ReadObjectData(orgID string, objectType string, ob
 		}
 		b := make([]byte, s)
 		copy(b, object.data[offset:])
+		object.lastAccess = store.nextAccess()
+		store.setObject(id, object)
 		return b, eof, int(s), nil
 	}
 
@@ -481,7 +671,7 @@ func (store *InMemoryStorage) MarkObjectDeleted(orgID string, objectType string,
 	if object, ok := store.objects[id]; ok {
 		object.meta.Deleted = true
 		object.status = common.ObjDeleted
-		store.objects[id] = object
+		store.setObject(id, object)
 		return nil
 	}
 
@@ -501,7 +691,7 @@ func (store *InMemoryStorage) ActivateObject(orgID string, objectType string, ob
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.meta.Inactive = false
-		store.objects[id] = object
+		store.setObject(id, object)
 		return nil
 	}
 
@@ -524,13 +714,77 @@ func (store *InMemoryStorage) GetObjectsToActivate() ([]common.MetaData, common.
 	return result, nil
 }
 
+// GetExpiredObjects returns the objects originated by this node whose expiration time has passed
+func (store *InMemoryStorage) GetExpiredObjects() ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if (obj.status == common.NotReadyToSend || obj.status == common.ReadyToSend) &&
+			obj.meta.Expiration != "" && obj.meta.Expiration <= currentTime {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
+// GetOverdueObjects returns the objects originated by this node whose delivery deadline has passed
+func (store *InMemoryStorage) GetOverdueObjects() ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if (obj.status == common.NotReadyToSend || obj.status == common.ReadyToSend) &&
+			obj.meta.DeliverBy != "" && obj.meta.DeliverBy <= currentTime {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
+// DeleteObjectsWithFilter marks the objects originated by this node that meet the given conditions as pending deletion
+func (store *InMemoryStorage) DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) (int, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	count := 0
+	for id, obj := range store.objects {
+		if orgID == obj.meta.DestOrgID && (obj.status == common.NotReadyToSend || obj.status == common.ReadyToSend) &&
+			objectMatchesFilter(obj.meta, objectType, destinationType, destinationID, expirationTimeBefore) {
+			obj.pendingDeletion = true
+			store.setObject(id, obj)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RetrieveObjectsPendingDeletion returns the objects originated by this node that are marked as pending deletion
+func (store *InMemoryStorage) RetrieveObjectsPendingDeletion() ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if obj.pendingDeletion && (obj.status == common.NotReadyToSend || obj.status == common.ReadyToSend) {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
 // DeleteStoredObject deletes the object
 func (store *InMemoryStorage) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
 	store.lock()
 	defer store.unLock()
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	delete(store.objects, id)
+	store.deleteObject(id)
 	return nil
 }
 
@@ -542,7 +796,7 @@ func (store *InMemoryStorage) DeleteStoredData(orgID string, objectType string,
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.data = nil
-		store.objects[id] = object
+		store.setObject(id, object)
 		return nil
 	}
 
@@ -558,7 +812,7 @@ func (store *InMemoryStorage) CleanObjects() common.SyncServiceError {
 	for _, obj := range store.objects {
 		if obj.status == common.PartiallyReceived || obj.status == common.CompletelyReceived {
 			id := createObjectCollectionID(obj.meta.DestOrgID, obj.meta.ObjectType, obj.meta.ObjectID)
-			delete(store.objects, id)
+			store.deleteObject(id)
 		}
 	}
 	return nil
@@ -577,6 +831,12 @@ func (store *InMemoryStorage) UpdateObjectDeliveryStatus(status string, message
 	return true, nil
 }
 
+// UpdateObjectConsumedOffset records the offset up to which the destination consumed the object's data
+func (store *InMemoryStorage) UpdateObjectConsumedOffset(orgID string, objectType string, objectID string, destType string, destID string,
+	offset int64) common.SyncServiceError {
+	return nil
+}
+
 // UpdateObjectDelivering marks the object as being delivered to all its destinations
 func (store *InMemoryStorage) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
 	return nil
@@ -664,6 +924,68 @@ func (store *InMemoryStorage) RetrieveWebhooks(orgID string, objectType string)
 	return nil, &NotFound{"No webhooks"}
 }
 
+// StoreWebhookDelivery stores or updates a webhook call to be retried
+func (store *InMemoryStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	store.deliveries[getWebhookDeliveryID(delivery)] = delivery
+	return nil
+}
+
+// DeleteWebhookDelivery deletes a webhook call
+func (store *InMemoryStorage) DeleteWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	delete(store.deliveries, getWebhookDeliveryID(delivery))
+	return nil
+}
+
+// RetrieveWebhookDeliveries returns the webhook calls to be retried, or the dead-lettered ones if deadLetter is true
+func (store *InMemoryStorage) RetrieveWebhookDeliveries(deadLetter bool) ([]common.WebhookDelivery, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.WebhookDelivery, 0)
+	for _, delivery := range store.deliveries {
+		if delivery.DeadLetter == deadLetter {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+// StoreObjectCleanup stores or updates a removal of an object to be retried
+func (store *InMemoryStorage) StoreObjectCleanup(cleanup common.ObjectCleanup) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	store.cleanups[createObjectCollectionID(cleanup.MetaData.DestOrgID, cleanup.MetaData.ObjectType, cleanup.MetaData.ObjectID)] = cleanup
+	return nil
+}
+
+// DeleteObjectCleanup deletes a removal of an object to be retried
+func (store *InMemoryStorage) DeleteObjectCleanup(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	delete(store.cleanups, createObjectCollectionID(orgID, objectType, objectID))
+	return nil
+}
+
+// RetrieveObjectCleanups returns the removals of objects to be retried
+func (store *InMemoryStorage) RetrieveObjectCleanups() ([]common.ObjectCleanup, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.ObjectCleanup, 0, len(store.cleanups))
+	for _, cleanup := range store.cleanups {
+		result = append(result, cleanup)
+	}
+	return result, nil
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *InMemoryStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	return nil, nil
@@ -689,6 +1011,77 @@ func (store *InMemoryStorage) UpdateDestinationLastPingTime(destination common.D
 	return nil
 }
 
+// UpdateDestinationLastSeen updates the time the destination was last seen (for CSS)
+func (store *InMemoryStorage) UpdateDestinationLastSeen(destination common.Destination) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveDestinationLastSeen returns the time the destination was last seen (for CSS)
+func (store *InMemoryStorage) RetrieveDestinationLastSeen(orgID string, destType string, destID string) (time.Time, common.SyncServiceError) {
+	return time.Time{}, nil
+}
+
+// UpdateDestinationMessageVersion updates the message version negotiated with the destination (for CSS)
+func (store *InMemoryStorage) UpdateDestinationMessageVersion(destination common.Destination, version common.SyncServiceVersion) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveDestinationMessageVersion returns the message version negotiated with the destination (for CSS)
+func (store *InMemoryStorage) RetrieveDestinationMessageVersion(orgID string, destType string, destID string) (common.SyncServiceVersion, common.SyncServiceError) {
+	return common.SyncServiceVersion{}, nil
+}
+
+// UpdateDestinationPaused pauses or resumes sending data to the destination (for CSS)
+func (store *InMemoryStorage) UpdateDestinationPaused(orgID string, destType string, destID string, paused bool) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveDestinationPaused returns true if sending data to the destination is paused (for CSS)
+func (store *InMemoryStorage) RetrieveDestinationPaused(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	return false, nil
+}
+
+// UpdateDestinationOffline marks the destination as offline or online (for CSS)
+func (store *InMemoryStorage) UpdateDestinationOffline(orgID string, destType string, destID string, offline bool) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveDestinationOffline returns true if the destination is offline (for CSS)
+func (store *InMemoryStorage) RetrieveDestinationOffline(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	return false, nil
+}
+
+// UpdateDestinationAvailableSpace updates the storage space that the destination reported as available (for CSS)
+func (store *InMemoryStorage) UpdateDestinationAvailableSpace(destination common.Destination) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveDestinationsInfo returns all the destinations with the provided orgID and destType, the time
+// they were last seen, their message versions, and whether they are paused or offline (for CSS)
+func (store *InMemoryStorage) RetrieveDestinationsInfo(orgID string, destType string) ([]common.DestinationInfo, common.SyncServiceError) {
+	return nil, nil
+}
+
+// AddDestinationToGroup adds the destination to the destination group (for CSS)
+func (store *InMemoryStorage) AddDestinationToGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	return nil
+}
+
+// RemoveDestinationFromGroup removes the destination from the destination group (for CSS)
+func (store *InMemoryStorage) RemoveDestinationFromGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveGroupMembers returns the registered destinations that are members of the destination group (for CSS)
+func (store *InMemoryStorage) RetrieveGroupMembers(orgID string, group string) ([]common.Destination, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveDestinationGroups returns the names of the destination groups the destination is a member of (for CSS)
+func (store *InMemoryStorage) RetrieveDestinationGroups(orgID string, destType string, destID string) ([]string, common.SyncServiceError) {
+	return nil, nil
+}
+
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *InMemoryStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {}
 
@@ -713,6 +1106,11 @@ func (store *InMemoryStorage) GetObjectsForDestination(orgID string, destType st
 	return nil, nil
 }
 
+// RetrievePendingObjects returns the objects that are pending delivery to the destination and their delivery status
+func (store *InMemoryStorage) RetrievePendingObjects(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	return nil, nil
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 func (store *InMemoryStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	return nil, nil
@@ -740,7 +1138,7 @@ func (store *InMemoryStorage) UpdateRemovedDestinationPolicyServices(orgID strin
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.removedDestinationPolicyServices = destinationPolicyServices
-		store.objects[id] = object
+		store.setObject(id, object)
 		return nil
 	}
 
@@ -752,20 +1150,25 @@ func (store *InMemoryStorage) UpdateNotificationRecord(notification common.Notif
 	store.lock()
 	defer store.unLock()
 
-	notification.ResendTime = time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	if notification.Status == common.Rejected {
+		// The destination rejected the object, the notification is never resent
+		notification.ResendTime = 0
+	} else {
+		notification.ResendTime = time.Now().Unix() + int64(common.Configuration.NotificationResendInterval*6)
+	}
 	id := getNotificationCollectionID(&notification)
 	store.notifications[id] = notification
 	return nil
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.NotificationResendInterval*6
 func (store *InMemoryStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
 	store.lock()
 	defer store.unLock()
 
 	id := getNotificationCollectionID(&notification)
 	if notification, ok := store.notifications[id]; ok {
-		resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+		resendTime := time.Now().Unix() + int64(common.Configuration.NotificationResendInterval*6)
 		notification.ResendTime = resendTime
 		store.notifications[id] = notification
 		return nil
@@ -845,6 +1248,101 @@ func (store *InMemoryStorage) RetrievePendingNotifications(orgID string, destTyp
 	return nil, nil
 }
 
+// RetrieveNotificationsWithStatus returns the list of the notifications that have the given status
+func (store *InMemoryStorage) RetrieveNotificationsWithStatus(orgID string, status string) ([]common.Notification, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.Notification, 0)
+	for _, notification := range store.notifications {
+		if (orgID == "" || orgID == notification.DestOrgID) && notification.Status == status {
+			result = append(result, notification)
+		}
+	}
+	return result, nil
+}
+
+// GetNumberOfNotificationRecords returns the number of notification records of the destination
+func (store *InMemoryStorage) GetNumberOfNotificationRecords(orgID string, destType string, destID string) (uint32, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	var count uint32
+	for _, notification := range store.notifications {
+		if notification.DestOrgID == orgID && notification.DestType == destType && notification.DestID == destID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// IterateNotificationRecords calls the function with each of the notification records.
+// The records are held in memory, they are iterated over a snapshot taken when the iteration starts.
+func (store *InMemoryStorage) IterateNotificationRecords(iterate func(common.Notification) error) common.SyncServiceError {
+	store.lock()
+	snapshot := make([]common.Notification, 0, len(store.notifications))
+	for _, notification := range store.notifications {
+		snapshot = append(snapshot, notification)
+	}
+	store.unLock()
+
+	for _, notification := range snapshot {
+		if err := iterate(notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetrieveOrderedNotifications returns the notification records of the objects of the type that are delivered in order
+// to the destination
+func (store *InMemoryStorage) RetrieveOrderedNotifications(orgID string, objectType string, destType string, destID string) ([]common.Notification,
+	common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.Notification, 0)
+	for _, notification := range store.notifications {
+		if notification.DestOrgID == orgID && notification.ObjectType == objectType && notification.DestType == destType &&
+			notification.DestID == destID && notification.OrderSequence != 0 {
+			result = append(result, notification)
+		}
+	}
+	return result, nil
+}
+
+// IncrementOrderSequence increments the order sequence number of the objects of the type that are sent to the destination
+func (store *InMemoryStorage) IncrementOrderSequence(orgID string, objectType string, destType string, destID string) (int64,
+	common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	id := createOrderSequenceCollectionID(orgID, objectType, destType, destID)
+	store.sentSequences[id]++
+	return store.sentSequences[id], nil
+}
+
+// RetrieveDeliveredOrderSequence returns the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *InMemoryStorage) RetrieveDeliveredOrderSequence(orgID string, objectType string, originType string, originID string) (int64,
+	common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	return store.deliveredSequences[createOrderSequenceCollectionID(orgID, objectType, originType, originID)], nil
+}
+
+// UpdateDeliveredOrderSequence updates the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *InMemoryStorage) UpdateDeliveredOrderSequence(orgID string, objectType string, originType string, originID string,
+	sequence int64) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	store.deliveredSequences[createOrderSequenceCollectionID(orgID, objectType, originType, originID)] = sequence
+	return nil
+}
+
 // InsertInitialLeader inserts the initial leader entry
 func (store *InMemoryStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	return true, nil
@@ -855,9 +1353,9 @@ func (store *InMemoryStorage) LeaderPeriodicUpdate(leaderID string) (bool, commo
 	return false, nil
 }
 
-// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader document
-func (store *InMemoryStorage) RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError) {
-	return "", 0, time.Now(), 0, nil
+// RetrieveLeader retrieves the leader's ID and address, the Heartbeat timeout and Last heartbeat time stamp from the leader document
+func (store *InMemoryStorage) RetrieveLeader() (string, string, int32, time.Time, int64, common.SyncServiceError) {
+	return "", "", 0, time.Now(), 0, nil
 }
 
 // UpdateLeader updates the leader entry for a leadership takeover
@@ -870,6 +1368,21 @@ func (store *InMemoryStorage) ResignLeadership(leaderID string) common.SyncServi
 	return nil
 }
 
+// ReplicaPeriodicUpdate does the periodic update of the replica's entry
+func (store *InMemoryStorage) ReplicaPeriodicUpdate(replicaID string) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveReplicas retrieves the replicas' IDs, addresses and last heartbeat time stamps
+func (store *InMemoryStorage) RetrieveReplicas() ([]Replica, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RemoveReplica removes the replica's entry
+func (store *InMemoryStorage) RemoveReplica(replicaID string) common.SyncServiceError {
+	return nil
+}
+
 // RetrieveTimeOnServer retrieves the current time on the database server
 func (store *InMemoryStorage) RetrieveTimeOnServer() (time.Time, error) {
 	return time.Now(), nil
@@ -957,6 +1470,74 @@ func (store *InMemoryStorage) getInstanceID() int64 {
 	return store.timebase
 }
 
+// nextAccess returns the next value of the access counter used to order objects for eviction
+func (store *InMemoryStorage) nextAccess() int64 {
+	store.accessCounter++
+	return store.accessCounter
+}
+
+// setObject stores the object and keeps track of the size of the stored data.
+// Should be called with the store locked.
+func (store *InMemoryStorage) setObject(id string, object inMemoryObject) {
+	store.dataSize += int64(len(object.data) - len(store.objects[id].data))
+	store.objects[id] = object
+}
+
+// deleteObject deletes the object and keeps track of the size of the stored data.
+// Should be called with the store locked.
+func (store *InMemoryStorage) deleteObject(id string) {
+	store.dataSize -= int64(len(store.objects[id].data))
+	delete(store.objects, id)
+}
+
+// RetrieveObjectsToEvict returns the least recently used objects that were received by the app or consumed,
+// whose removal brings the size of the stored data below InMemoryMaxDataSizeKB.
+// Objects that are still being received or that weren't delivered yet are never returned.
+func (store *InMemoryStorage) RetrieveObjectsToEvict() ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	maxSize := int64(common.Configuration.InMemoryMaxDataSizeKB) * 1024
+	if maxSize <= 0 || store.dataSize <= maxSize {
+		return nil, nil
+	}
+
+	// Objects that have notifications that weren't acknowledged are not delivered yet
+	pending := make(map[string]bool)
+	for _, notification := range store.notifications {
+		if notification.Status != common.AckReceived && notification.Status != common.AckConsumed &&
+			notification.Status != common.ConsumedByDestination {
+			pending[createObjectCollectionID(notification.DestOrgID, notification.ObjectType, notification.ObjectID)] = true
+		}
+	}
+
+	candidates := make([]inMemoryObject, 0)
+	for id, object := range store.objects {
+		if len(object.data) == 0 || pending[id] {
+			continue
+		}
+		if object.status == common.ObjReceived || object.status == common.ObjConsumed || object.status == common.ConsumedByDest {
+			candidates = append(candidates, object)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].lastAccess < candidates[j].lastAccess })
+
+	result := make([]common.MetaData, 0)
+	size := store.dataSize
+	for _, object := range candidates {
+		if size <= maxSize {
+			break
+		}
+		size -= int64(len(object.data))
+		result = append(result, object.meta)
+	}
+	if size > maxSize && log.IsLogging(logger.WARNING) {
+		log.Warning("The in-memory storage holds %d bytes, more than the maximum of %d bytes, but not enough objects can be evicted\n",
+			store.dataSize, maxSize)
+	}
+	return result, nil
+}
+
 func (store *InMemoryStorage) lock() {
 	<-store.lockChannel
 }
@@ -999,15 +1580,12 @@ func (store *InMemoryStorage) readPersistedTimebase(path string) int64 {
 		return 0
 	}
 
-	if versionMajor != common.Version.Major {
-		return 0
-	}
-
 	if err = binary.Read(data, binary.BigEndian, &versionMinor); err != nil {
 		return 0
 	}
 
-	if versionMinor != common.Version.Minor {
+	// Data persisted by older versions is still read
+	if !common.IsSupportedMessageVersion(common.SyncServiceVersion{Major: versionMajor, Minor: versionMinor}) {
 		return 0
 	}
 
@@ -1095,3 +1673,13 @@ func (store *InMemoryStorage) writePersistedTimebase(path string, timebase int64
 func (store *InMemoryStorage) IsPersistent() bool {
 	return false
 }
+
+// SupportsDataPatch returns true if the storage can overwrite byte ranges of an object's existing data, and false otherwise
+func (store *InMemoryStorage) SupportsDataPatch() bool {
+	return true
+}
+
+// AvailableSpace returns -1, the memory available for objects' data is unknown
+func (store *InMemoryStorage) AvailableSpace() (int64, common.SyncServiceError) {
+	return -1, nil
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
@@ -14,11 +16,20 @@ func TestInMemoryStorageObjectActivation(t *testing.T) {
 	testStorageObjectActivation(common.InMemory, t)
 }
 
+func TestInMemoryStorageExpiredObjects(t *testing.T) {
+	testStorageExpiredObjects(common.InMemory, t)
+}
+
 func TestInMemoryStorageObjectData(t *testing.T) {
 	common.Configuration.NodeType = common.ESS
 	testStorageObjectData(common.InMemory, t)
 }
 
+func TestInMemoryStorageObjectDataReader(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	testStorageObjectDataReader(common.InMemory, t)
+}
+
 func TestInMemoryStorageNotifications(t *testing.T) {
 	testStorageNotifications(common.InMemory, t)
 }
@@ -136,7 +147,7 @@ func TestInMemoryCacheStorageDestinations(t *testing.T) {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
 		t.Errorf("Wrong number of destinations: %d instead of 1\n", len(dests))
-	} else if dests[0] != tests[0].dest {
+	} else if !reflect.DeepEqual(dests[0], tests[0].dest) {
 		t.Errorf("Wrong destination\n")
 	}
 
@@ -171,3 +182,95 @@ func TestInMemoryCacheStorageDestinations(t *testing.T) {
 func TestInMemoryStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.InMemory, t)
 }
+
+func TestInMemoryStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.InMemory, t)
+}
+
+func TestInMemoryStorageEviction(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.InMemoryMaxDataSizeKB = 2
+	defer func() { common.Configuration.InMemoryMaxDataSizeKB = 0 }()
+
+	store := &InMemoryStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	data := make([]byte, 1024)
+	tests := []struct {
+		metaData     common.MetaData
+		status       string
+		notification string
+		evicted      bool
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1024}, common.ObjReceived, "", true},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1024}, common.PartiallyReceived, "", false},
+		{common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1024}, common.CompletelyReceived, "", false},
+		// An object with a notification that wasn't acknowledged is not evicted
+		{common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1024}, common.ObjConsumed,
+			common.Consumed, false},
+		{common.MetaData{ObjectID: "5", ObjectType: "type1", DestOrgID: "myorg", ObjectSize: 1024}, common.ObjReceived,
+			common.AckReceived, true},
+	}
+
+	for _, test := range tests {
+		if _, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+			t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+		}
+		if err := store.AppendObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
+			bytes.NewReader(data), uint32(len(data)), 0, test.metaData.ObjectSize, true, false); err != nil {
+			t.Errorf("AppendObjectData failed. Error: %s\n", err.Error())
+		}
+		if test.notification != "" {
+			notification := common.Notification{ObjectID: test.metaData.ObjectID, ObjectType: test.metaData.ObjectType,
+				DestOrgID: test.metaData.DestOrgID, DestType: "device", DestID: "dev1", Status: test.notification}
+			if err := store.UpdateNotificationRecord(notification); err != nil {
+				t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+			}
+		}
+	}
+
+	// Reading the data of an object makes it the most recently used
+	if _, _, _, err := store.ReadObjectData("myorg", "type1", "1", 10, 0); err != nil {
+		t.Errorf("ReadObjectData failed. Error: %s\n", err.Error())
+	}
+
+	objects, err := store.RetrieveObjectsToEvict()
+	if err != nil {
+		t.Errorf("RetrieveObjectsToEvict failed. Error: %s\n", err.Error())
+	} else if len(objects) != 2 || objects[0].ObjectID != "5" || objects[1].ObjectID != "1" {
+		t.Errorf("Wrong objects to evict: %v\n", objects)
+	}
+	for _, test := range tests {
+		evicted := false
+		for _, metaData := range objects {
+			evicted = evicted || metaData.ObjectID == test.metaData.ObjectID
+		}
+		if evicted != test.evicted {
+			t.Errorf("Object %s: evicted %t instead of %t\n", test.metaData.ObjectID, evicted, test.evicted)
+		}
+	}
+
+	// The size of the stored data follows the removals of objects and data
+	for _, metaData := range objects {
+		if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+			t.Errorf("DeleteStoredObject failed. Error: %s\n", err.Error())
+		}
+	}
+	if err := store.DeleteStoredData("myorg", "type1", "4"); err != nil {
+		t.Errorf("DeleteStoredData failed. Error: %s\n", err.Error())
+	}
+	if store.dataSize != 2048 {
+		t.Errorf("Wrong size of the stored data: %d instead of 2048\n", store.dataSize)
+	}
+	if objects, _ := store.RetrieveObjectsToEvict(); len(objects) != 0 {
+		t.Errorf("Objects were evicted below the limit: %v\n", objects)
+	}
+}
+
+func TestInMemoryStorageDataKeys(t *testing.T) {
+	testStorageDataKeys(common.InMemory, t)
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// When DeduplicateData is set, the data of an object is hashed when it is completely stored in its GridFS file.
+// The file is then turned into a blob, a GridFS file whose name is the hash of its content, or removed if a blob with
+// the same content already exists. The blob's document in the dataBlobs collection holds the IDs of the objects
+// that refer to it, and the blob is removed when the last of them is removed or gets other data.
+// The data of an object that is still being received remains in the object's own file.
+
+type blobObject struct {
+	ID   string   `bson:"_id"`
+	Refs []string `bson:"refs"`
+}
+
+func (store *MongoStorage) isDeduplicatingData() bool {
+	return common.Configuration.DeduplicateData && store.dataStore == nil
+}
+
+// dataFileID returns the ID of the GridFS file that holds the object's data, the blob that the object refers to
+// or the object's own file
+func (store *MongoStorage) dataFileID(id string) string {
+	if !store.isDeduplicatingData() {
+		return id
+	}
+	blob := blobObject{}
+	if err := store.fetchOne(dataBlobs, bson.M{"refs": id}, bson.M{"_id": bson.ElementString}, &blob); err != nil {
+		if err != mgo.ErrNotFound && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to retrieve the data blob of %s. Error: %s\n", id, err)
+		}
+		return id
+	}
+	return blob.ID
+}
+
+// deduplicateData makes the object refer to the blob with the content of its completely stored data
+func (store *MongoStorage) deduplicateData(id string) common.SyncServiceError {
+	if !store.isDeduplicatingData() {
+		return nil
+	}
+
+	hash, err := store.hashFile(id)
+	if err != nil {
+		return err
+	}
+	blobID := "sha256:" + hash
+
+	<-store.blobLock
+	defer func() { store.blobLock <- 1 }()
+
+	// The reference is added first, so that the blob isn't removed while its data is kept
+	if err := store.upsert(dataBlobs, bson.M{"_id": blobID}, bson.M{"$addToSet": bson.M{"refs": id}}); err != nil {
+		return &Error{fmt.Sprintf("Failed to add a reference to the data blob. Error: %s.", err)}
+	}
+	moved, err := store.moveFile(id, blobID)
+	if err != nil {
+		if store.update(dataBlobs, bson.M{"_id": blobID}, bson.M{"$pull": bson.M{"refs": id}}) == nil {
+			store.removeUnreferencedBlob(blobID)
+		}
+		return &Error{fmt.Sprintf("Failed to move the data to the data blob. Error: %s.", err)}
+	}
+	if moved {
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Stored the data of %s in a new data blob\n", id)
+		}
+		return nil
+	}
+
+	// A blob with the same content already exists
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deduplicated the data of %s\n", id)
+	}
+	return store.removeFile(id)
+}
+
+// releaseData removes the object's reference to its blob, and removes the blob if no other object refers to it
+func (store *MongoStorage) releaseData(id string) common.SyncServiceError {
+	if !store.isDeduplicatingData() {
+		return nil
+	}
+
+	<-store.blobLock
+	defer func() { store.blobLock <- 1 }()
+
+	blob := blobObject{}
+	if err := store.fetchOne(dataBlobs, bson.M{"refs": id}, bson.M{"_id": bson.ElementString}, &blob); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return &Error{fmt.Sprintf("Failed to retrieve the data blob. Error: %s.", err)}
+	}
+	if err := store.update(dataBlobs, bson.M{"_id": blob.ID}, bson.M{"$pull": bson.M{"refs": id}}); err != nil {
+		return &Error{fmt.Sprintf("Failed to remove a reference to the data blob. Error: %s.", err)}
+	}
+	return store.removeUnreferencedBlob(blob.ID)
+}
+
+// removeUnreferencedBlob removes the blob if no object refers to it.
+// Must be called while holding blobLock.
+func (store *MongoStorage) removeUnreferencedBlob(blobID string) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		return collection.Remove(bson.M{"_id": blobID, "refs": bson.M{"$size": 0}})
+	}
+
+	retry, err := store.withCollectionHelper(dataBlobs, function, false)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			// Other objects refer to the blob
+			return nil
+		}
+		return &Error{fmt.Sprintf("Failed to remove the data blob. Error: %s.", err)}
+	}
+	if retry {
+		return store.removeUnreferencedBlob(blobID)
+	}
+	return store.removeFile(blobID)
+}
+
+func (store *MongoStorage) hashFile(id string) (string, common.SyncServiceError) {
+	fileHandle, err := store.openFile(id)
+	if err != nil {
+		return "", &Error{fmt.Sprintf("Failed to open file to hash the data. Error: %s.", err)}
+	}
+	defer fileHandle.file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fileHandle.file); err != nil {
+		return "", &Error{fmt.Sprintf("Failed to hash the data. Error: %s.", err)}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// moveFile renames the GridFS file, the data isn't copied.
+// It returns false and no error if a file with the new name already exists.
+func (store *MongoStorage) moveFile(id string, newID string) (bool, common.SyncServiceError) {
+	moved := false
+	function := func(db *mgo.Database) error {
+		files := db.C("fs.files")
+		count, err := files.Find(bson.M{"filename": newID}).Count()
+		if err != nil || count > 0 {
+			return err
+		}
+		if _, err := files.UpdateAll(bson.M{"filename": id}, bson.M{"$set": bson.M{"filename": newID}}); err != nil {
+			return err
+		}
+		moved = true
+		return nil
+	}
+
+	retry, err := store.withDBHelper(function, false)
+	if err != nil {
+		return false, err
+	}
+	if retry {
+		return store.moveFile(id, newID)
+	}
+	return moved, nil
+}
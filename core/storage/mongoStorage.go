@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bufio"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -31,9 +32,11 @@ type MongoStorage struct {
 	session      *mgo.Session
 	dialInfo     *mgo.DialInfo
 	openFiles    map[string]*fileHandle
+	dataStore    *s3DataStore // When set, the data of objects is stored in S3 instead of GridFS
 	connected    bool
 	lockChannel  chan int
 	mapLock      chan int
+	blobLock     chan int
 	sessionCache []*mgo.Session
 	cacheSize    int
 	cacheIndex   int
@@ -48,12 +51,28 @@ type object struct {
 	RemainingReceivers int                             `bson:"remaining-receivers"`
 	Destinations       []common.StoreDestinationStatus `bson:"destinations"`
 	LastUpdate         bson.MongoTimestamp             `bson:"last-update"`
+	PendingDeletion    bool                            `bson:"pending-deletion"`
+	DataCodec          *ObjectDataCodec                `bson:"data-codec,omitempty"`
+}
+
+// SetBSON parses a stored object, and upgrades the meta data of objects stored with an older schema
+func (o *object) SetBSON(raw bson.Raw) error {
+	type plainObject object
+	if err := raw.Unmarshal((*plainObject)(o)); err != nil {
+		return err
+	}
+	common.UpgradeMetaData(&o.MetaData)
+	return nil
 }
 
 type destinationObject struct {
-	ID           string              `bson:"_id"`
-	Destination  common.Destination  `bson:"destination"`
-	LastPingTime bson.MongoTimestamp `bson:"last-ping-time"`
+	ID             string                    `bson:"_id"`
+	Destination    common.Destination        `bson:"destination"`
+	LastPingTime   bson.MongoTimestamp       `bson:"last-ping-time"`
+	LastSeen       time.Time                 `bson:"last-seen"`
+	MessageVersion common.SyncServiceVersion `bson:"message-version"`
+	Paused         bool                      `bson:"paused"`
+	Offline        bool                      `bson:"offline"`
 }
 
 type notificationObject struct {
@@ -64,11 +83,18 @@ type notificationObject struct {
 type leaderDocument struct {
 	ID               int32               `bson:"_id"`
 	UUID             string              `bson:"uuid"`
+	Address          string              `bson:"address"`
 	LastHeartbeatTS  bson.MongoTimestamp `bson:"last-heartbeat-ts"`
 	HeartbeatTimeout int32               `bson:"heartbeat-timeout"`
 	Version          int64               `bson:"version"`
 }
 
+type replicaDocument struct {
+	ID              string              `bson:"_id"`
+	Address         string              `bson:"address"`
+	LastHeartbeatTS bson.MongoTimestamp `bson:"last-heartbeat-ts"`
+}
+
 type isMasterResult struct {
 	IsMaster  bool      `bson:"isMaster"`
 	LocalTime time.Time `bson:"localTime"`
@@ -95,6 +121,31 @@ type webhookObject struct {
 	LastUpdate bson.MongoTimestamp `bson:"last-update"`
 }
 
+type webhookDeliveryObject struct {
+	ID       string                 `bson:"_id"`
+	Delivery common.WebhookDelivery `bson:"delivery"`
+}
+
+type objectCleanupObject struct {
+	ID      string               `bson:"_id"`
+	Cleanup common.ObjectCleanup `bson:"cleanup"`
+}
+
+type groupMemberObject struct {
+	ID       string `bson:"_id"`
+	OrgID    string `bson:"org-id"`
+	Group    string `bson:"group"`
+	DestType string `bson:"destination-type"`
+	DestID   string `bson:"destination-id"`
+}
+
+type orderSequenceObject struct {
+	ID        string `bson:"_id"`
+	OrgID     string `bson:"org-id"`
+	Sent      int64  `bson:"sent"`
+	Delivered int64  `bson:"delivered"`
+}
+
 type aclObject struct {
 	ID         string              `bson:"_id"`
 	Usernames  []string            `bson:"usernames"`
@@ -111,6 +162,8 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 	store.lockChannel <- 1
 	store.mapLock = make(chan int, 1)
 	store.mapLock <- 1
+	store.blobLock = make(chan int, 1)
+	store.blobLock <- 1
 
 	store.dialInfo = &mgo.DialInfo{
 		Addrs:        strings.Split(common.Configuration.MongoAddressCsv, ","),
@@ -235,6 +288,9 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 		log.Error("Failed to create an index on %s. Error: %s", objects, err)
 	}
 	db.C(acls).EnsureIndexKey("org-id", "acl-type")
+	db.C(destinationGroups).EnsureIndexKey("org-id", "group")
+	db.C(orderSequences).EnsureIndexKey("org-id")
+	db.C(dataBlobs).EnsureIndexKey("refs")
 
 	store.session = session
 	store.cacheSize = common.Configuration.MongoSessionCacheSize
@@ -246,6 +302,9 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 	}
 
 	store.openFiles = make(map[string]*fileHandle)
+	if common.Configuration.S3Endpoint != "" {
+		store.dataStore = newS3DataStore()
+	}
 
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Successfully initialized mongo driver")
@@ -297,25 +356,138 @@ func (store *MongoStorage) GetObjectsToActivate() ([]common.MetaData, common.Syn
 	return metaDatas, nil
 }
 
+// GetExpiredObjects returns the objects originated by this node whose expiration time has passed
+func (store *MongoStorage) GetExpiredObjects() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	query := bson.M{"$or": []bson.M{
+		bson.M{"status": common.NotReadyToSend},
+		bson.M{"status": common.ReadyToSend}},
+		"$and": []bson.M{
+			bson.M{"metadata.expiration": bson.M{"$ne": ""}},
+			bson.M{"metadata.expiration": bson.M{"$lte": currentTime}}}}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchAll(objects, query, selector, &result); err != nil {
+		return nil, err
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// GetOverdueObjects returns the objects originated by this node whose delivery deadline has passed
+func (store *MongoStorage) GetOverdueObjects() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	query := bson.M{"$or": []bson.M{
+		bson.M{"status": common.NotReadyToSend},
+		bson.M{"status": common.ReadyToSend}},
+		"$and": []bson.M{
+			bson.M{"metadata.deliver-by": bson.M{"$exists": true, "$ne": ""}},
+			bson.M{"metadata.deliver-by": bson.M{"$lte": currentTime}}}}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchAll(objects, query, selector, &result); err != nil {
+		return nil, err
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// DeleteObjectsWithFilter marks the objects originated by this node that meet the given conditions as pending deletion
+func (store *MongoStorage) DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) (int, common.SyncServiceError) {
+	query := bson.M{"metadata.destination-org-id": orgID,
+		"$or": []bson.M{
+			bson.M{"status": common.NotReadyToSend},
+			bson.M{"status": common.ReadyToSend}}}
+	if objectType != "" {
+		query["metadata.object-type"] = objectType
+	}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchAll(objects, query, selector, &result); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, r := range result {
+		if !objectMatchesFilter(r.MetaData, objectType, destinationType, destinationID, expirationTimeBefore) {
+			continue
+		}
+		// The instance id guards against marking an object that was updated after it was retrieved
+		if err := store.update(objects,
+			bson.M{"_id": getObjectCollectionID(r.MetaData), "metadata.instance-id": r.MetaData.InstanceID},
+			bson.M{
+				"$set":         bson.M{"pending-deletion": true},
+				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+			}); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return count, &Error{fmt.Sprintf("Failed to mark object as pending deletion. Error: %s.", err)}
+		}
+		count++
+	}
+	return count, nil
+}
+
+// RetrieveObjectsPendingDeletion returns the objects originated by this node that are marked as pending deletion
+func (store *MongoStorage) RetrieveObjectsPendingDeletion() ([]common.MetaData, common.SyncServiceError) {
+	query := bson.M{"pending-deletion": true,
+		"$or": []bson.M{
+			bson.M{"status": common.NotReadyToSend},
+			bson.M{"status": common.ReadyToSend}}}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchAll(objects, query, selector, &result); err != nil {
+		return nil, err
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
 // StoreObject stores an object
 // If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
 func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
 	id := getObjectCollectionID(metaData)
-	if !metaData.NoData && data != nil {
+	var dataCodec *ObjectDataCodec
+	storesData := !metaData.NoData && data != nil
+	if storesData {
+		var err common.SyncServiceError
+		if dataCodec, err = NewObjectDataCodec(); err != nil {
+			return nil, err
+		}
+		if dataCodec != nil {
+			data = append([]byte(nil), data...)
+			dataCodec.Encode(0, data)
+		}
 		if err := store.storeDataInFile(id, data); err != nil {
 			return nil, err
 		}
 	} else if !metaData.MetaOnly {
-		store.removeFile(id)
+		store.removeData(id)
 	}
 
 	if metaData.DestinationPolicy != nil {
 		metaData.DestinationPolicy.Timestamp = time.Now().UTC().UnixNano()
 	}
+	metaData.SchemaVersion = common.MetaDataSchemaVersion
 
 	var dests []common.StoreDestinationStatus
 	var deletedDests []common.StoreDestinationStatus
-	if status == common.NotReadyToSend || status == common.ReadyToSend {
+	isOrigin := status == common.NotReadyToSend || status == common.ReadyToSend
+	if isOrigin {
 		// The object was receieved from a service, i.e. this node is the origin of the object:
 		// set its instance id and create destinations array
 		newID := store.getInstanceID()
@@ -323,6 +495,7 @@ func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, st
 		if data != nil && !metaData.NoData && !metaData.MetaOnly {
 			metaData.DataID = newID
 		}
+		metaData.InstanceSequence = 1
 
 		var err error
 		dests, deletedDests, err = createDestinationsFromMeta(store, metaData)
@@ -340,6 +513,11 @@ func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, st
 	}
 
 	if existingObject != nil {
+		if !storesData {
+			// The existing data keeps its codec
+			dataCodec = existingObject.DataCodec
+		}
+
 		if (metaData.DestinationPolicy != nil && existingObject.MetaData.DestinationPolicy == nil) ||
 			(metaData.DestinationPolicy == nil && existingObject.MetaData.DestinationPolicy != nil) {
 			return nil, &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
@@ -353,11 +531,14 @@ func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, st
 		if metaData.DestinationPolicy != nil {
 			dests = existingObject.Destinations
 		}
+		if isOrigin {
+			metaData.InstanceSequence = existingObject.MetaData.InstanceSequence + 1
+		}
 	}
 
 	newObject := object{ID: id, MetaData: metaData, Status: status, PolicyReceived: false,
 		RemainingConsumers: metaData.ExpectedConsumers,
-		RemainingReceivers: metaData.ExpectedConsumers, Destinations: dests}
+		RemainingReceivers: metaData.ExpectedConsumers, Destinations: dests, DataCodec: dataCodec}
 	if err := store.upsert(objects, bson.M{"_id": id, "metadata.destination-org-id": metaData.DestOrgID}, newObject); err != nil {
 		return nil, &Error{fmt.Sprintf("Failed to store an object. Error: %s.", err)}
 	}
@@ -456,7 +637,8 @@ func (store *MongoStorage) UpdateObjectDeliveryStatus(status string, message str
 		allDeleted = true
 		for i, d := range result.Destinations {
 			if !found && d.Destination.DestType == destType && d.Destination.DestID == destID {
-				if message != "" || d.Status == common.Error {
+				// The message of an error or of a pending delivery (e.g. waiting for storage space) is cleared by the next status
+				if message != "" || d.Status == common.Error || d.Status == common.Rejected || d.Status == common.Pending {
 					d.Message = message
 				}
 				if status != "" {
@@ -500,6 +682,48 @@ func (store *MongoStorage) UpdateObjectDeliveryStatus(status string, message str
 	return false, &Error{"Failed to update object's destinations."}
 }
 
+// UpdateObjectConsumedOffset records the offset up to which the destination consumed the object's data
+func (store *MongoStorage) UpdateObjectConsumedOffset(orgID string, objectType string, objectID string, destType string, destID string,
+	offset int64) common.SyncServiceError {
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+
+	for i := 0; i < maxUpdateTries; i++ {
+		if err := store.fetchOne(objects, bson.M{"_id": id},
+			bson.M{"destinations": bson.ElementArray, "last-update": bson.ElementTimestamp},
+			&result); err != nil {
+			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+		}
+		found := false
+		for i, d := range result.Destinations {
+			if d.Destination.DestType == destType && d.Destination.DestID == destID {
+				if offset <= d.ConsumedOffset {
+					return nil
+				}
+				result.Destinations[i].ConsumedOffset = offset
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &Error{"Failed to find destination."}
+		}
+
+		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate},
+			bson.M{
+				"$set":         bson.M{"destinations": result.Destinations},
+				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+			}); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+		}
+		return nil
+	}
+	return &Error{"Failed to update object's destinations."}
+}
+
 // UpdateObjectDelivering marks the object as being delivered to all its destinations
 func (store *MongoStorage) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
 	result := object{}
@@ -511,6 +735,9 @@ func (store *MongoStorage) UpdateObjectDelivering(orgID string, objectType strin
 			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
 		}
 		for i, d := range result.Destinations {
+			if d.Status == common.Pending {
+				d.Message = ""
+			}
 			d.Status = common.Delivering
 			result.Destinations[i] = d
 		}
@@ -529,6 +756,61 @@ func (store *MongoStorage) UpdateObjectDelivering(orgID string, objectType strin
 	return &Error{fmt.Sprintf("Failed to update object's destinations.")}
 }
 
+// RetrieveObjectDataCodec returns the codec of the object's data, or nil if the data isn't encoded or the object doesn't exist
+func (store *MongoStorage) RetrieveObjectDataCodec(orgID string, objectType string, objectID string) (*ObjectDataCodec, common.SyncServiceError) {
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"data-codec": bson.ElementDocument}, &result); err != nil {
+		switch err {
+		case mgo.ErrNotFound:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to retrieve object's data codec. Error: %s.", err)}
+		}
+	}
+	return result.DataCodec, nil
+}
+
+// RetrieveObjectsWithOtherDataKey returns the objects whose data is encrypted with a key other than keyID
+func (store *MongoStorage) RetrieveObjectsWithOtherDataKey(keyID string) ([]common.MetaData, common.SyncServiceError) {
+	// The data that isn't encoded has no codec, and is encrypted too
+	query := bson.M{"data-codec.key-id": bson.M{"$ne": keyID}, "metadata.no-data": false, "metadata.link": ""}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchAll(objects, query, selector, &result); err != nil {
+		return nil, err
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// StoreReencryptedObjectData replaces the object's data with the same data read from dataReader, encoded with codec,
+// and records the codec
+func (store *MongoStorage) StoreReencryptedObjectData(orgID string, objectType string, objectID string, codec *ObjectDataCodec,
+	dataReader io.Reader) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if dataReader != nil {
+		if err := store.replaceDataInFile(id, dataReader); err != nil {
+			return err
+		}
+	}
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"data-codec": codec},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{"Object not found"}
+		}
+		return &Error{fmt.Sprintf("Failed to update object's data codec. Error: %s.", err)}
+	}
+	return nil
+}
+
 // RetrieveObjectStatus finds the object and return its status
 func (store *MongoStorage) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
 	result := object{}
@@ -642,6 +924,26 @@ func (store *MongoStorage) RetrieveUpdatedObjects(orgID string, objectType strin
 	return metaDatas, nil
 }
 
+// RetrieveObjectsWithStatus returns the objects of the type that have the given status
+func (store *MongoStorage) RetrieveObjectsWithStatus(orgID string, objectType string, status string) ([]common.MetaData, common.SyncServiceError) {
+	result := []object{}
+	query := bson.M{"status": status, "metadata.destination-org-id": orgID, "metadata.object-type": objectType}
+	if err := store.fetchAll(objects, query, nil, &result); err != nil {
+		switch err {
+		case mgo.ErrNotFound:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+		}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *MongoStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -797,6 +1099,11 @@ func (store *MongoStorage) RetrieveObjects(orgID string, destType string, destID
 			bson.M{"status": common.NotReadyToSend},
 		}}
 
+	groups, err := store.RetrieveDestinationGroups(orgID, destType, destID)
+	if err != nil {
+		return nil, err
+	}
+
 OUTER:
 	for i := 0; i < maxUpdateTries; i++ {
 		if err := store.fetchAll(objects, query, nil, &result); err != nil {
@@ -813,18 +1120,18 @@ OUTER:
 			if r.MetaData.DestinationPolicy != nil {
 				continue
 			}
-			if (r.MetaData.DestType == "" || r.MetaData.DestType == destType) &&
-				(r.MetaData.DestID == "" || r.MetaData.DestID == destID) {
+			if objectSentToDestination(r.MetaData, r.Destinations, destType, destID) && objectSentToGroups(r.MetaData, groups) {
 				status := common.Pending
 				if r.Status == common.ReadyToSend && !r.MetaData.Inactive {
 					status = common.Delivering
 				}
 				needToUpdate := false
 				// Add destination if it doesn't exist
-				if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil {
+				if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil && dest != nil &&
+					common.MatchDestinationAttributes(r.MetaData.DestinationAttributes, dest.Attributes) {
 					existingDestIndex := -1
 					for i, d := range r.Destinations {
-						if d.Destination == *dest {
+						if common.SameDestination(d.Destination, *dest) {
 							existingDestIndex = i
 							break
 						}
@@ -872,6 +1179,18 @@ func (store *MongoStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, c
 	return nil, nil
 }
 
+// RetrieveObjectsToEvict returns the objects to remove to keep the size of the stored data below the storage's limit.
+// The mongo storage has no limit.
+func (store *MongoStorage) RetrieveObjectsToEvict() ([]common.MetaData, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveReceivedObjects returns all the objects that were completely received from the other side and not deleted
+// ESS only API
+func (store *MongoStorage) RetrieveReceivedObjects() ([]common.MetaData, common.SyncServiceError) {
+	return nil, nil
+}
+
 // RetrieveObject returns the object meta data with the specified parameters
 func (store *MongoStorage) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
 	result := object{}
@@ -905,7 +1224,11 @@ func (store *MongoStorage) RetrieveObjectAndStatus(orgID string, objectType stri
 // RetrieveObjectData returns the object data with the specified parameters
 func (store *MongoStorage) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	fileHandle, err := store.openFile(id)
+	if store.dataStore != nil {
+		return store.dataStore.openReader(id, 0)
+	}
+	fileID := store.dataFileID(id)
+	fileHandle, err := store.openFile(fileID)
 	if err != nil {
 		switch err {
 		case mgo.ErrNotFound:
@@ -914,13 +1237,15 @@ func (store *MongoStorage) RetrieveObjectData(orgID string, objectType string, o
 			return nil, &Error{fmt.Sprintf("Failed to open file to read the data. Error: %s.", err)}
 		}
 	}
-	store.putFileHandle(id, fileHandle)
+	store.putFileHandle(fileID, fileHandle)
 	return fileHandle.file, nil
 }
 
 // CloseDataReader closes the data reader if necessary
 func (store *MongoStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
-	switch v := dataReader.(type) {
+	switch v := unwrapDataReader(dataReader).(type) {
+	case *s3DataReader:
+		return v.Close()
 	case *mgo.GridFile:
 		err := v.Close()
 		if id, ok := v.Id().(string); ok {
@@ -934,10 +1259,30 @@ func (store *MongoStorage) CloseDataReader(dataReader io.Reader) common.SyncServ
 	}
 }
 
+// OpenObjectDataReader opens a reader of the object's data positioned at offset, for reading consecutive chunks
+func (store *MongoStorage) OpenObjectDataReader(orgID string, objectType string, objectID string, offset int64) (ObjectDataReader, common.SyncServiceError) {
+	if store.dataStore != nil {
+		// Read the data from offset with a range request instead of skipping to it
+		dataReader, err := store.dataStore.openReader(createObjectCollectionID(orgID, objectType, objectID), offset)
+		if err != nil {
+			return nil, err
+		}
+		reader := &objectDataReader{store: store, dataReader: dataReader, offset: offset}
+		if dataReader != nil {
+			reader.reader = bufio.NewReader(dataReader)
+		}
+		return reader, nil
+	}
+	return openObjectDataReader(store, orgID, objectType, objectID, offset)
+}
+
 // ReadObjectData returns the object data with the specified parameters
 func (store *MongoStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	fileHandle, err := store.openFile(id)
+	if store.dataStore != nil {
+		return store.dataStore.readData(id, size, offset)
+	}
+	fileHandle, err := store.openFile(store.dataFileID(id))
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return nil, true, 0, &common.NotFound{}
@@ -1000,19 +1345,30 @@ func (store *MongoStorage) StoreObjectData(orgID string, objectType string, obje
 		if err := store.update(objects, bson.M{"_id": id},
 			bson.M{
 				"$set":         bson.M{"metadata.data-id": newID, "metadata.instance-id": newID},
+				"$inc":         bson.M{"metadata.instance-sequence": 1},
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			return false, &Error{fmt.Sprintf("Failed to set instance id. Error: %s.", err)}
 		}
 	}
 
-	_, size, err := store.copyDataToFile(id, dataReader, true, true)
+	var size int64
+	var err common.SyncServiceError
+	if store.dataStore != nil {
+		size, err = store.dataStore.putData(id, dataReader)
+	} else {
+		_, size, err = store.copyDataToFile(id, dataReader, true, true)
+		if err == nil {
+			err = store.deduplicateData(id)
+		}
+	}
 	if err != nil {
 		return false, err
 	}
 
 	// Update object size
-	if err := store.update(objects, bson.M{"_id": id}, bson.M{"$set": bson.M{"metadata.object-size": size}}); err != nil {
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"metadata.object-size": size, "data-codec": encodingDataCodec(dataReader)}}); err != nil {
 		return false, &Error{fmt.Sprintf("Failed to update object's size. Error: %s.", err)}
 	}
 
@@ -1023,9 +1379,17 @@ func (store *MongoStorage) StoreObjectData(orgID string, objectType string, obje
 func (store *MongoStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader,
 	dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
+	if isFirstChunk {
+		if err := store.update(objects, bson.M{"_id": id}, bson.M{"$set": bson.M{"data-codec": encodingDataCodec(dataReader)}}); err != nil {
+			return &Error{fmt.Sprintf("Failed to update object's data codec. Error: %s.", err)}
+		}
+	}
+	if store.dataStore != nil {
+		return store.dataStore.appendData(id, dataReader, dataLength, offset, isFirstChunk, isLastChunk)
+	}
 	var fileHandle *fileHandle
 	if isFirstChunk {
-		store.removeFile(id)
+		store.removeObjectFile(id)
 		fh, err := store.createFile(id)
 		if err != nil {
 			return err
@@ -1101,6 +1465,7 @@ func (store *MongoStorage) AppendObjectData(orgID string, objectType string, obj
 		if err != nil {
 			return &Error{fmt.Sprintf("Failed to close the file. Error: %s.", err)}
 		}
+		return store.deduplicateData(id)
 	} else {
 		store.putFileHandle(id, fileHandle)
 	}
@@ -1108,6 +1473,13 @@ func (store *MongoStorage) AppendObjectData(orgID string, objectType string, obj
 	return nil
 }
 
+// AppendObjectZeroData appends a chunk of zeros to the object's data, the zeros are written to the stored data
+func (store *MongoStorage) AppendObjectZeroData(orgID string, objectType string, objectID string, length uint32, offset int64,
+	total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	return store.AppendObjectData(orgID, objectType, objectID, NewZeroReader(int64(length)), length, offset, total, isFirstChunk,
+		isLastChunk)
+}
+
 // UpdateObjectStatus updates object's status
 func (store *MongoStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
@@ -1121,11 +1493,62 @@ func (store *MongoStorage) UpdateObjectStatus(orgID string, objectType string, o
 	return nil
 }
 
+// UpdateObjectMetadataOnly applies a metadata only update, received from the other side, to the stored object in place
+func (store *MongoStorage) UpdateObjectMetadataOnly(metaData common.MetaData, status string) common.SyncServiceError {
+	result := object{}
+	id := getObjectCollectionID(metaData)
+	for i := 0; i < maxUpdateTries; i++ {
+		if err := store.fetchOne(objects, bson.M{"_id": id},
+			bson.M{"metadata": bson.ElementDocument, "last-update": bson.ElementTimestamp}, &result); err != nil {
+			if err == mgo.ErrNotFound {
+				return &NotFound{"Object not found"}
+			}
+			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+		}
+		metaData.DataID = result.MetaData.DataID
+		metaData.ObjectSize = result.MetaData.ObjectSize
+		metaData.ChunkSize = result.MetaData.ChunkSize
+		metaData.PatchRanges = result.MetaData.PatchRanges
+		metaData.SchemaVersion = common.MetaDataSchemaVersion
+
+		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate},
+			bson.M{
+				"$set": bson.M{"metadata": metaData, "status": status, "policy-received": false,
+					"remaining-consumers": metaData.ExpectedConsumers, "remaining-receivers": metaData.ExpectedConsumers,
+					"pending-deletion": false},
+				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+			}); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return &Error{fmt.Sprintf("Failed to update object's meta data. Error: %s.", err)}
+		}
+		return nil
+	}
+	return &Error{"Failed to update object's meta data."}
+}
+
 // UpdateObjectSourceDataURI updates object's source data URI
 func (store *MongoStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
 	return nil
 }
 
+// UpdateObjectPriority updates the priority of the transfers of the object's data
+func (store *MongoStorage) UpdateObjectPriority(orgID string, objectType string, objectID string, priority int) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"metadata.priority": priority},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{"Object not found"}
+		}
+		return &Error{fmt.Sprintf("Failed to update object's priority. Error: %s.", err)}
+	}
+	return nil
+}
+
 // MarkObjectDeleted marks the object as deleted
 func (store *MongoStorage) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
@@ -1175,7 +1598,7 @@ func (store *MongoStorage) DeleteStoredData(orgID string, objectType string, obj
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Deleting object's data %s\n", id)
 	}
-	if err := store.removeFile(id); err != nil {
+	if err := store.removeData(id); err != nil {
 		if log.IsLogging(logger.ERROR) {
 			log.Error("Error in DeleteStoredData: failed to delete data file. Error: %s\n", err)
 		}
@@ -1302,6 +1725,70 @@ func (store *MongoStorage) RetrieveWebhooks(orgID string, objectType string) ([]
 	return result.Hooks, nil
 }
 
+// StoreWebhookDelivery stores or updates a webhook call to be retried
+func (store *MongoStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	id := getWebhookDeliveryID(delivery)
+	if err := store.upsert(webhookDeliveries, bson.M{"_id": id}, webhookDeliveryObject{ID: id, Delivery: delivery}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a webhook delivery. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteWebhookDelivery deletes a webhook call
+func (store *MongoStorage) DeleteWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	id := getWebhookDeliveryID(delivery)
+	if err := store.removeAll(webhookDeliveries, bson.M{"_id": id}); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a webhook delivery. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveWebhookDeliveries returns the webhook calls to be retried, or the dead-lettered ones if deadLetter is true
+func (store *MongoStorage) RetrieveWebhookDeliveries(deadLetter bool) ([]common.WebhookDelivery, common.SyncServiceError) {
+	result := []webhookDeliveryObject{}
+	if err := store.fetchAll(webhookDeliveries, bson.M{"delivery.dead-letter": deadLetter}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the webhook deliveries. Error: %s.", err)}
+	}
+
+	deliveries := make([]common.WebhookDelivery, len(result))
+	for i, r := range result {
+		deliveries[i] = r.Delivery
+	}
+	return deliveries, nil
+}
+
+// StoreObjectCleanup stores or updates a removal of an object to be retried
+func (store *MongoStorage) StoreObjectCleanup(cleanup common.ObjectCleanup) common.SyncServiceError {
+	id := createObjectCollectionID(cleanup.MetaData.DestOrgID, cleanup.MetaData.ObjectType, cleanup.MetaData.ObjectID)
+	if err := store.upsert(objectCleanups, bson.M{"_id": id}, objectCleanupObject{ID: id, Cleanup: cleanup}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store an object cleanup. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteObjectCleanup deletes a removal of an object to be retried
+func (store *MongoStorage) DeleteObjectCleanup(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.removeAll(objectCleanups, bson.M{"_id": id}); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete an object cleanup. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveObjectCleanups returns the removals of objects to be retried
+func (store *MongoStorage) RetrieveObjectCleanups() ([]common.ObjectCleanup, common.SyncServiceError) {
+	result := []objectCleanupObject{}
+	if err := store.fetchAll(objectCleanups, nil, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the object cleanups. Error: %s.", err)}
+	}
+
+	cleanups := make([]common.ObjectCleanup, len(result))
+	for i, r := range result {
+		cleanups[i] = r.Cleanup
+	}
+	return cleanups, nil
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *MongoStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	result := []destinationObject{}
@@ -1347,7 +1834,11 @@ func (store *MongoStorage) DestinationExists(orgID string, destType string, dest
 // StoreDestination stores the destination
 func (store *MongoStorage) StoreDestination(destination common.Destination) common.SyncServiceError {
 	id := getDestinationCollectionID(destination)
-	newObject := destinationObject{ID: id, Destination: destination}
+	newObject := destinationObject{ID: id, Destination: destination, LastSeen: time.Now()}
+	// A destination that registers again stays paused, and is no longer offline
+	if paused, err := store.RetrieveDestinationPaused(destination.DestOrgID, destination.DestType, destination.DestID); err == nil {
+		newObject.Paused = paused
+	}
 	err := store.upsert(destinations, bson.M{"_id": id, "destination.destination-org-id": destination.DestOrgID}, newObject)
 	if err != nil {
 		return &Error{fmt.Sprintf("Failed to store a destination. Error: %s.", err)}
@@ -1381,6 +1872,216 @@ func (store *MongoStorage) UpdateDestinationLastPingTime(destination common.Dest
 	return nil
 }
 
+// UpdateDestinationLastSeen updates the time the destination was last seen (for CSS)
+func (store *MongoStorage) UpdateDestinationLastSeen(destination common.Destination) common.SyncServiceError {
+	id := getDestinationCollectionID(destination)
+	err := store.update(destinations,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"last-seen": time.Now()}},
+	)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{}
+		}
+		return &Error{fmt.Sprintf("Failed to update the last seen time for destination. Error: %s\n", err)}
+	}
+
+	return nil
+}
+
+// RetrieveDestinationLastSeen returns the time the destination was last seen (for CSS)
+func (store *MongoStorage) RetrieveDestinationLastSeen(orgID string, destType string, destID string) (time.Time, common.SyncServiceError) {
+	result := destinationObject{}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.fetchOne(destinations, bson.M{"_id": id}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return time.Time{}, &NotFound{"Destination not found"}
+		}
+		return time.Time{}, &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", err)}
+	}
+	return result.LastSeen, nil
+}
+
+// UpdateDestinationMessageVersion updates the message version negotiated with the destination (for CSS)
+func (store *MongoStorage) UpdateDestinationMessageVersion(destination common.Destination, version common.SyncServiceVersion) common.SyncServiceError {
+	id := getDestinationCollectionID(destination)
+	err := store.update(destinations,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"message-version": version}},
+	)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{}
+		}
+		return &Error{fmt.Sprintf("Failed to update the message version for destination. Error: %s\n", err)}
+	}
+
+	return nil
+}
+
+// RetrieveDestinationMessageVersion returns the message version negotiated with the destination (for CSS)
+func (store *MongoStorage) RetrieveDestinationMessageVersion(orgID string, destType string, destID string) (common.SyncServiceVersion, common.SyncServiceError) {
+	result := destinationObject{}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.fetchOne(destinations, bson.M{"_id": id}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return common.SyncServiceVersion{}, &NotFound{"Destination not found"}
+		}
+		return common.SyncServiceVersion{}, &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", err)}
+	}
+	return result.MessageVersion, nil
+}
+
+// UpdateDestinationPaused pauses or resumes sending data to the destination (for CSS)
+func (store *MongoStorage) UpdateDestinationPaused(orgID string, destType string, destID string, paused bool) common.SyncServiceError {
+	id := createDestinationCollectionID(orgID, destType, destID)
+	err := store.update(destinations,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"paused": paused}},
+	)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{"Destination not found"}
+		}
+		return &Error{fmt.Sprintf("Failed to update the paused state of the destination. Error: %s\n", err)}
+	}
+
+	return nil
+}
+
+// RetrieveDestinationPaused returns true if sending data to the destination is paused (for CSS)
+func (store *MongoStorage) RetrieveDestinationPaused(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	result := destinationObject{}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.fetchOne(destinations, bson.M{"_id": id}, bson.M{"paused": bson.ElementInt32}, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, &NotFound{"Destination not found"}
+		}
+		return false, &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", err)}
+	}
+	return result.Paused, nil
+}
+
+// UpdateDestinationOffline marks the destination as offline or online (for CSS)
+func (store *MongoStorage) UpdateDestinationOffline(orgID string, destType string, destID string, offline bool) common.SyncServiceError {
+	id := createDestinationCollectionID(orgID, destType, destID)
+	err := store.update(destinations,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"offline": offline}},
+	)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{"Destination not found"}
+		}
+		return &Error{fmt.Sprintf("Failed to update the offline state of the destination. Error: %s\n", err)}
+	}
+
+	return nil
+}
+
+// RetrieveDestinationOffline returns true if the destination is offline (for CSS)
+func (store *MongoStorage) RetrieveDestinationOffline(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	result := destinationObject{}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.fetchOne(destinations, bson.M{"_id": id}, bson.M{"offline": bson.ElementInt32}, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, &NotFound{"Destination not found"}
+		}
+		return false, &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", err)}
+	}
+	return result.Offline, nil
+}
+
+// UpdateDestinationAvailableSpace updates the storage space that the destination reported as available (for CSS)
+func (store *MongoStorage) UpdateDestinationAvailableSpace(destination common.Destination) common.SyncServiceError {
+	id := getDestinationCollectionID(destination)
+	err := store.update(destinations,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"destination.available-space": destination.AvailableSpace}},
+	)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return &NotFound{"Destination not found"}
+		}
+		return &Error{fmt.Sprintf("Failed to update the available space of the destination. Error: %s\n", err)}
+	}
+
+	return nil
+}
+
+// AddDestinationToGroup adds the destination to the destination group (for CSS)
+func (store *MongoStorage) AddDestinationToGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	id := createGroupMemberCollectionID(orgID, group, destType, destID)
+	member := groupMemberObject{ID: id, OrgID: orgID, Group: group, DestType: destType, DestID: destID}
+	if err := store.upsert(destinationGroups, bson.M{"_id": id}, member); err != nil {
+		return &Error{fmt.Sprintf("Failed to add the destination to the group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RemoveDestinationFromGroup removes the destination from the destination group (for CSS)
+func (store *MongoStorage) RemoveDestinationFromGroup(orgID string, group string, destType string, destID string) common.SyncServiceError {
+	id := createGroupMemberCollectionID(orgID, group, destType, destID)
+	if err := store.removeAll(destinationGroups, bson.M{"_id": id}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to remove the destination from the group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveGroupMembers returns the registered destinations that are members of the destination group (for CSS)
+func (store *MongoStorage) RetrieveGroupMembers(orgID string, group string) ([]common.Destination, common.SyncServiceError) {
+	result := []groupMemberObject{}
+	if err := store.fetchAll(destinationGroups, bson.M{"org-id": orgID, "group": group}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the members of the group. Error: %s.", err)}
+	}
+
+	dests := make([]common.Destination, 0)
+	for _, r := range result {
+		if dest, err := store.RetrieveDestination(orgID, r.DestType, r.DestID); err == nil && dest != nil {
+			dests = append(dests, *dest)
+		}
+	}
+	return dests, nil
+}
+
+// RetrieveDestinationGroups returns the names of the destination groups the destination is a member of (for CSS)
+func (store *MongoStorage) RetrieveDestinationGroups(orgID string, destType string, destID string) ([]string, common.SyncServiceError) {
+	result := []groupMemberObject{}
+	query := bson.M{"org-id": orgID, "destination-type": destType, "destination-id": destID}
+	if err := store.fetchAll(destinationGroups, query, bson.M{"group": bson.ElementString}, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the groups of the destination. Error: %s.", err)}
+	}
+
+	groups := make([]string, len(result))
+	for i, r := range result {
+		groups[i] = r.Group
+	}
+	return groups, nil
+}
+
+// RetrieveDestinationsInfo returns all the destinations with the provided orgID and destType, the time
+// they were last seen, their message versions, and whether they are paused or offline (for CSS)
+func (store *MongoStorage) RetrieveDestinationsInfo(orgID string, destType string) ([]common.DestinationInfo, common.SyncServiceError) {
+	result := []destinationObject{}
+	query := bson.M{}
+	if orgID != "" {
+		query["destination.destination-org-id"] = orgID
+	}
+	if destType != "" {
+		query["destination.destination-type"] = destType
+	}
+	if err := store.fetchAll(destinations, query, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destinations. Error: %s.", err)}
+	}
+
+	dests := make([]common.DestinationInfo, len(result))
+	for i, r := range result {
+		dests[i] = common.DestinationInfo{Destination: r.Destination, LastSeen: r.LastSeen, MessageVersion: r.MessageVersion,
+			Paused: r.Paused, Offline: r.Offline}
+	}
+	return dests, nil
+}
+
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *MongoStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
 	timestamp, err := bson.NewMongoTimestamp(lastTimestamp, 1)
@@ -1448,7 +2149,8 @@ func (store *MongoStorage) GetObjectsForDestination(orgID string, destType strin
 		bson.M{"notification.status": common.Updated},
 		bson.M{"notification.status": common.ReceivedByDestination},
 		bson.M{"notification.status": common.ConsumedByDestination},
-		bson.M{"notification.status": common.Error}},
+		bson.M{"notification.status": common.Error},
+		bson.M{"notification.status": common.Rejected}},
 		"notification.destination-org-id": orgID,
 		"notification.destination-id":     destID,
 		"notification.destination-type":   destType}
@@ -1473,6 +2175,8 @@ func (store *MongoStorage) GetObjectsForDestination(orgID string, destType strin
 			status = common.Consumed
 		case common.Error:
 			status = common.Error
+		case common.Rejected:
+			status = common.Rejected
 		}
 		objectStatus := common.ObjectStatus{OrgID: orgID, ObjectType: n.Notification.ObjectType, ObjectID: n.Notification.ObjectID, Status: status}
 		objectStatuses = append(objectStatuses, objectStatus)
@@ -1480,6 +2184,32 @@ func (store *MongoStorage) GetObjectsForDestination(orgID string, destType strin
 	return objectStatuses, nil
 }
 
+// RetrievePendingObjects returns the objects that are pending delivery to the destination and their delivery status
+func (store *MongoStorage) RetrievePendingObjects(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	notificationRecords := []notificationObject{}
+	query := bson.M{"$or": []bson.M{
+		bson.M{"notification.status": common.Update},
+		bson.M{"notification.status": common.UpdatePending},
+		bson.M{"notification.status": common.Updated},
+		bson.M{"notification.status": common.Data}},
+		"notification.destination-org-id": orgID,
+		"notification.destination-id":     destID,
+		"notification.destination-type":   destType}
+
+	if err := store.fetchAll(notifications, query, nil, &notificationRecords); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+
+	objectStatuses := make([]common.ObjectStatus, 0)
+	for _, n := range notificationRecords {
+		if status, ok := pendingDeliveryStatus(n.Notification.Status); ok {
+			objectStatuses = append(objectStatuses, common.ObjectStatus{OrgID: orgID, ObjectType: n.Notification.ObjectType,
+				ObjectID: n.Notification.ObjectID, Status: status})
+		}
+	}
+	return objectStatuses, nil
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and the destination status
 func (store *MongoStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(destOrgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	result := []object{}
@@ -1544,8 +2274,11 @@ func (store *MongoStorage) UpdateRemovedDestinationPolicyServices(orgID string,
 // UpdateNotificationRecord updates/adds a notification record to the object
 func (store *MongoStorage) UpdateNotificationRecord(notification common.Notification) common.SyncServiceError {
 	id := getNotificationCollectionID(&notification)
-	if notification.ResendTime == 0 {
-		resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	if notification.Status == common.Rejected {
+		// The destination rejected the object, the notification is never resent
+		notification.ResendTime = 0
+	} else if notification.ResendTime == 0 {
+		resendTime := time.Now().Unix() + int64(common.Configuration.NotificationResendInterval*6)
 		notification.ResendTime = resendTime
 	}
 	n := notificationObject{ID: id, Notification: notification}
@@ -1563,10 +2296,10 @@ func (store *MongoStorage) UpdateNotificationRecord(notification common.Notifica
 	return nil
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.NotificationResendInterval*6
 func (store *MongoStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
 	id := getNotificationCollectionID(&notification)
-	resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	resendTime := time.Now().Unix() + int64(common.Configuration.NotificationResendInterval*6)
 	if err := store.update(notifications, bson.M{"_id": id}, bson.M{"$set": bson.M{"notification.resend-time": resendTime}}); err != nil {
 		return &Error{fmt.Sprintf("Failed to update notification resend time. Error: %s.", err)}
 	}
@@ -1700,9 +2433,131 @@ func (store *MongoStorage) RetrievePendingNotifications(orgID string, destType s
 	return notifications, nil
 }
 
+// RetrieveNotificationsWithStatus returns the list of the notifications that have the given status
+func (store *MongoStorage) RetrieveNotificationsWithStatus(orgID string, status string) ([]common.Notification, common.SyncServiceError) {
+	result := []notificationObject{}
+	query := bson.M{"notification.status": status}
+	if orgID != "" {
+		query["notification.destination-org-id"] = orgID
+	}
+	if err := store.fetchAll(notifications, query, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+
+	notifications := make([]common.Notification, 0)
+	for _, n := range result {
+		notifications = append(notifications, n.Notification)
+	}
+	return notifications, nil
+}
+
+// GetNumberOfNotificationRecords returns the number of notification records of the destination
+func (store *MongoStorage) GetNumberOfNotificationRecords(orgID string, destType string, destID string) (uint32, common.SyncServiceError) {
+	query := bson.M{"notification.destination-org-id": orgID, "notification.destination-type": destType,
+		"notification.destination-id": destID}
+	return store.count(notifications, query)
+}
+
+// IterateNotificationRecords calls the function with each of the notification records.
+// The records are read through a cursor in the order of their IDs, which don't change, so a record isn't reported twice.
+// A failed iteration isn't retried, as the records that were reported would be reported again.
+func (store *MongoStorage) IterateNotificationRecords(iterate func(common.Notification) error) common.SyncServiceError {
+	if !store.connected {
+		return &NotConnected{"Disconnected from the database"}
+	}
+	session := store.getSession().Copy()
+	defer session.Close()
+
+	iter := session.DB(common.Configuration.MongoDbName).C(notifications).Find(nil).Sort("_id").Iter()
+	result := notificationObject{}
+	for iter.Next(&result) {
+		if err := iterate(result.Notification); err != nil {
+			iter.Close()
+			return err
+		}
+		result = notificationObject{}
+	}
+	if err := iter.Close(); err != nil {
+		common.HealthStatus.DBReadFailed()
+		return &Error{fmt.Sprintf("Failed to iterate over the notifications. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveOrderedNotifications returns the notification records of the objects of the type that are delivered in order
+// to the destination
+func (store *MongoStorage) RetrieveOrderedNotifications(orgID string, objectType string, destType string, destID string) ([]common.Notification,
+	common.SyncServiceError) {
+	query := bson.M{"notification.destination-org-id": orgID, "notification.object-type": objectType,
+		"notification.destination-type": destType, "notification.destination-id": destID,
+		"notification.order-sequence": bson.M{"$gt": 0}}
+	result := []notificationObject{}
+	if err := store.fetchAll(notifications, query, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+
+	notifications := make([]common.Notification, len(result))
+	for i, r := range result {
+		notifications[i] = r.Notification
+	}
+	return notifications, nil
+}
+
+// IncrementOrderSequence increments the order sequence number of the objects of the type that are sent to the destination
+func (store *MongoStorage) IncrementOrderSequence(orgID string, objectType string, destType string, destID string) (int64,
+	common.SyncServiceError) {
+	id := createOrderSequenceCollectionID(orgID, objectType, destType, destID)
+	result := orderSequenceObject{}
+	function := func(collection *mgo.Collection) error {
+		_, err := collection.FindId(id).Apply(mgo.Change{
+			Update:    bson.M{"$inc": bson.M{"sent": 1}, "$set": bson.M{"org-id": orgID}},
+			Upsert:    true,
+			ReturnNew: true,
+		}, &result)
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(orderSequences, function, false)
+	if err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to increment the order sequence. Error: %s.", err)}
+	}
+	if retry {
+		return store.IncrementOrderSequence(orgID, objectType, destType, destID)
+	}
+	return result.Sent, nil
+}
+
+// RetrieveDeliveredOrderSequence returns the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *MongoStorage) RetrieveDeliveredOrderSequence(orgID string, objectType string, originType string, originID string) (int64,
+	common.SyncServiceError) {
+	id := createOrderSequenceCollectionID(orgID, objectType, originType, originID)
+	result := orderSequenceObject{}
+	if err := store.fetchOne(orderSequences, bson.M{"_id": id}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return 0, nil
+		}
+		return 0, &Error{fmt.Sprintf("Failed to retrieve the delivered order sequence. Error: %s.", err)}
+	}
+	return result.Delivered, nil
+}
+
+// UpdateDeliveredOrderSequence updates the order sequence number up to which the objects of the type that were received
+// from the origin were delivered
+func (store *MongoStorage) UpdateDeliveredOrderSequence(orgID string, objectType string, originType string, originID string,
+	sequence int64) common.SyncServiceError {
+	id := createOrderSequenceCollectionID(orgID, objectType, originType, originID)
+	if err := store.upsert(orderSequences, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"org-id": orgID, "delivered": sequence}}); err != nil {
+		return &Error{fmt.Sprintf("Failed to update the delivered order sequence. Error: %s.", err)}
+	}
+	return nil
+}
+
 // InsertInitialLeader inserts the initial leader document if the collection is empty
 func (store *MongoStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
-	doc := leaderDocument{ID: 1, UUID: leaderID, HeartbeatTimeout: common.Configuration.LeadershipTimeout, Version: 1}
+	doc := leaderDocument{ID: 1, UUID: leaderID, Address: common.Configuration.AdvertisedAddress,
+		HeartbeatTimeout: common.Configuration.LeadershipTimeout, Version: 1}
 	err := store.insert(leader, doc)
 
 	if err != nil {
@@ -1731,17 +2586,17 @@ func (store *MongoStorage) LeaderPeriodicUpdate(leaderID string) (bool, common.S
 	return true, nil
 }
 
-// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader document
-func (store *MongoStorage) RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError) {
+// RetrieveLeader retrieves the leader's ID and address, the Heartbeat timeout and Last heartbeat time stamp from the leader document
+func (store *MongoStorage) RetrieveLeader() (string, string, int32, time.Time, int64, common.SyncServiceError) {
 	doc := leaderDocument{}
 	err := store.fetchOne(leader, bson.M{"_id": 1}, nil, &doc)
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return "", 0, time.Now(), 0, &NotFound{}
+			return "", "", 0, time.Now(), 0, &NotFound{}
 		}
-		return "", 0, time.Now(), 0, &Error{fmt.Sprintf("Failed to fetch the document in the syncLeaderElection collection. Error: %s", err)}
+		return "", "", 0, time.Now(), 0, &Error{fmt.Sprintf("Failed to fetch the document in the syncLeaderElection collection. Error: %s", err)}
 	}
-	return doc.UUID, doc.HeartbeatTimeout, doc.LastHeartbeatTS.Time(), doc.Version, nil
+	return doc.UUID, doc.Address, doc.HeartbeatTimeout, doc.LastHeartbeatTS.Time(), doc.Version, nil
 }
 
 // UpdateLeader updates the leader entry for a leadership takeover
@@ -1752,6 +2607,7 @@ func (store *MongoStorage) UpdateLeader(leaderID string, version int64) (bool, c
 			"$currentDate": bson.M{"last-heartbeat-ts": bson.M{"$type": "timestamp"}},
 			"$set": bson.M{
 				"uuid":              leaderID,
+				"address":           common.Configuration.AdvertisedAddress,
 				"heartbeat-timeout": common.Configuration.LeadershipTimeout,
 				"version":           version + 1,
 			},
@@ -1788,6 +2644,42 @@ func (store *MongoStorage) ResignLeadership(leaderID string) common.SyncServiceE
 	return nil
 }
 
+// ReplicaPeriodicUpdate does the periodic update of the replica's document, inserting it if it doesn't exist
+func (store *MongoStorage) ReplicaPeriodicUpdate(replicaID string) common.SyncServiceError {
+	err := store.upsert(replicas,
+		bson.M{"_id": replicaID},
+		bson.M{
+			"$currentDate": bson.M{"last-heartbeat-ts": bson.M{"$type": "timestamp"}},
+			"$set":         bson.M{"address": common.Configuration.AdvertisedAddress},
+		},
+	)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to update the document in the syncReplicas collection. Error: %s\n", err)}
+	}
+	return nil
+}
+
+// RetrieveReplicas retrieves the replicas' IDs, addresses and last heartbeat time stamps from the replicas' documents
+func (store *MongoStorage) RetrieveReplicas() ([]Replica, common.SyncServiceError) {
+	result := []replicaDocument{}
+	if err := store.fetchAll(replicas, nil, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the documents in the syncReplicas collection. Error: %s", err)}
+	}
+	replicasList := make([]Replica, 0, len(result))
+	for _, doc := range result {
+		replicasList = append(replicasList, Replica{ID: doc.ID, Address: doc.Address, LastHeartbeat: doc.LastHeartbeatTS.Time()})
+	}
+	return replicasList, nil
+}
+
+// RemoveReplica removes the replica's document
+func (store *MongoStorage) RemoveReplica(replicaID string) common.SyncServiceError {
+	if err := store.removeAll(replicas, bson.M{"_id": replicaID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete the document in the syncReplicas collection. Error: %s\n", err)}
+	}
+	return nil
+}
+
 // RetrieveTimeOnServer retrieves the current time on the database server
 func (store *MongoStorage) RetrieveTimeOnServer() (time.Time, error) {
 	result := isMasterResult{}
@@ -1860,6 +2752,14 @@ func (store *MongoStorage) DeleteOrganization(orgID string) common.SyncServiceEr
 		return &Error{fmt.Sprintf("Failed to delete notifications. Error: %s.", err)}
 	}
 
+	if err := store.removeAll(destinationGroups, bson.M{"org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete destination groups. Error: %s.", err)}
+	}
+
+	if err := store.removeAll(orderSequences, bson.M{"org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete order sequences. Error: %s.", err)}
+	}
+
 	type idstruct struct {
 		ID string `bson:"_id"`
 	}
@@ -1868,7 +2768,7 @@ func (store *MongoStorage) DeleteOrganization(orgID string) common.SyncServiceEr
 		return &Error{fmt.Sprintf("Failed to fetch objects to delete. Error: %s.", err)}
 	}
 	for _, result := range results {
-		store.removeFile(result.ID)
+		store.removeData(result.ID)
 	}
 
 	if err := store.removeAll(objects, bson.M{"metadata.destination-org-id": orgID}); err != nil && err != mgo.ErrNotFound {
@@ -1973,3 +2873,14 @@ func (store *MongoStorage) RetrieveACLsInOrg(aclType string, orgID string) ([]st
 func (store *MongoStorage) IsPersistent() bool {
 	return true
 }
+
+// SupportsDataPatch returns true if the storage can overwrite byte ranges of an object's existing data, and false otherwise
+func (store *MongoStorage) SupportsDataPatch() bool {
+	// GridFS files are written sequentially, so an existing file can't be patched
+	return false
+}
+
+// AvailableSpace returns -1, the space available in the database is unknown
+func (store *MongoStorage) AvailableSpace() (int64, common.SyncServiceError) {
+	return -1, nil
+}
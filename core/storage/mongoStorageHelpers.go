@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
@@ -79,7 +80,7 @@ func (store *MongoStorage) deleteObject(orgID string, objectType string, objectI
 		return &Error{fmt.Sprintf("Failed to delete object. Error: %s.", err)}
 	}
 
-	if err := store.removeFile(id); err != nil {
+	if err := store.removeData(id); err != nil {
 		if log.IsLogging(logger.ERROR) {
 			log.Error("Error in deleteStoredObject: failed to delete data file. Error: %s\n", err)
 		}
@@ -90,7 +91,7 @@ func (store *MongoStorage) deleteObject(orgID string, objectType string, objectI
 func (store *MongoStorage) copyDataToFile(id string, dataReader io.Reader, isFirstChunk bool, isLastChunk bool) (fileHanlde *fileHandle,
 	written int64, err common.SyncServiceError) {
 	if isFirstChunk {
-		store.removeFile(id)
+		store.removeObjectFile(id)
 		fileHanlde, err = store.createFile(id)
 	} else {
 		fileHanlde = store.getFileHandle(id)
@@ -119,7 +120,11 @@ func (store *MongoStorage) copyDataToFile(id string, dataReader io.Reader, isFir
 }
 
 func (store *MongoStorage) storeDataInFile(id string, data []byte) common.SyncServiceError {
-	store.removeFile(id)
+	if store.dataStore != nil {
+		_, err := store.dataStore.putData(id, bytes.NewReader(data))
+		return err
+	}
+	store.removeObjectFile(id)
 	fileHanlde, err := store.createFile(id)
 	if err != nil {
 		return &Error{fmt.Sprintf("Failed to create file to store the data. Error: %s.", err)}
@@ -134,7 +139,28 @@ func (store *MongoStorage) storeDataInFile(id string, data []byte) common.SyncSe
 	if err = fileHanlde.file.Close(); err != nil {
 		return &Error{fmt.Sprintf("Failed to close the file. Error: %s.", err)}
 	}
-	return nil
+	return store.deduplicateData(id)
+}
+
+// replaceDataInFile replaces the object's data with the data read from dataReader, which may read the data being replaced.
+// The data is written to a file of its own, which replaces the object's file after all of the data was written.
+func (store *MongoStorage) replaceDataInFile(id string, dataReader io.Reader) common.SyncServiceError {
+	if store.dataStore != nil {
+		_, err := store.dataStore.putData(id, dataReader)
+		return err
+	}
+	newID := "replaced:" + id
+	if _, _, err := store.copyDataToFile(newID, dataReader, true, true); err != nil {
+		store.removeFile(newID)
+		return err
+	}
+	if err := store.removeObjectFile(id); err != nil {
+		return err
+	}
+	if moved, err := store.moveFile(newID, id); err != nil || !moved {
+		return &Error{fmt.Sprintf("Failed to replace the data file. Error: %v.", err)}
+	}
+	return store.deduplicateData(id)
 }
 
 func (store *MongoStorage) retrievePolicies(query interface{}) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -160,7 +186,7 @@ func (store *MongoStorage) retrievePolicies(query interface{}) ([]common.ObjectD
 		for destIndex, destination := range oneResult.Destinations {
 			destinationList[destIndex] = common.DestinationsStatus{
 				DestType: destination.Destination.DestType, DestID: destination.Destination.DestID,
-				Status: destination.Status, Message: destination.Message,
+				Status: destination.Status, Message: destination.Message, ConsumedOffset: destination.ConsumedOffset,
 			}
 		}
 		objects[index] = common.ObjectDestinationPolicy{
@@ -289,6 +315,22 @@ func (store *MongoStorage) count(collectionName string, selector interface{}) (u
 	return count, nil
 }
 
+// removeData removes the object's data from S3 or GridFS
+func (store *MongoStorage) removeData(id string) common.SyncServiceError {
+	if store.dataStore != nil {
+		return store.dataStore.deleteData(id)
+	}
+	return store.removeObjectFile(id)
+}
+
+// removeObjectFile removes the object's GridFS file, and its reference to the blob with its data
+func (store *MongoStorage) removeObjectFile(id string) common.SyncServiceError {
+	if err := store.releaseData(id); err != nil {
+		return err
+	}
+	return store.removeFile(id)
+}
+
 func (store *MongoStorage) removeFile(id string) common.SyncServiceError {
 	function := func(db *mgo.Database) error {
 		return db.GridFS("fs").Remove(id)
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
 	"testing"
 
+	"github.com/globalsign/mgo/bson"
 	"github.com/open-horizon/edge-sync-service/common"
 )
 
@@ -22,6 +26,10 @@ func TestMongoStorageObjectActivation(t *testing.T) {
 	testStorageObjectActivation(common.Mongo, t)
 }
 
+func TestMongoStorageExpiredObjects(t *testing.T) {
+	testStorageExpiredObjects(common.Mongo, t)
+}
+
 func TestMongoStorageObjectExpiration(t *testing.T) {
 	testStorageObjectExpiration(common.Mongo, t)
 }
@@ -30,6 +38,10 @@ func TestMongoStorageObjectData(t *testing.T) {
 	testStorageObjectData(common.Mongo, t)
 }
 
+func TestMongoStorageObjectDataReader(t *testing.T) {
+	testStorageObjectDataReader(common.Mongo, t)
+}
+
 func TestMongoStorageOrgDeleteObjects(t *testing.T) {
 	testStorageOrgDeleteObjects(common.Mongo, t)
 }
@@ -84,7 +96,7 @@ func TestMongoStorageDestinations(t *testing.T) {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
 		t.Errorf("Wrong number of destinations: %d instead of 1\n", len(dests))
-	} else if dests[0] != tests[0].dest {
+	} else if !reflect.DeepEqual(dests[0], tests[0].dest) {
 		t.Errorf("Wrong destination\n")
 	}
 
@@ -156,6 +168,14 @@ func TestMongoStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.Mongo, t)
 }
 
+func TestMongoStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.Mongo, t)
+}
+
+func TestMongoStorageDestinationGroups(t *testing.T) {
+	testStorageDestinationGroups(common.Mongo, t)
+}
+
 func TestMongoStorageOrganizations(t *testing.T) {
 	testStorageOrganizations(common.Mongo, t)
 }
@@ -163,3 +183,109 @@ func TestMongoStorageOrganizations(t *testing.T) {
 func TestMongoStorageInactiveDestinations(t *testing.T) {
 	testStorageInactiveDestinations(common.Mongo, t)
 }
+
+func TestMongoStorageDataDeduplication(t *testing.T) {
+	deduplicateData := common.Configuration.DeduplicateData
+	defer func() { common.Configuration.DeduplicateData = deduplicateData }()
+	common.Configuration.DeduplicateData = true
+	common.Configuration.MongoDbName = "d_test_db"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	data := []byte("the same data in all the objects")
+	otherData := []byte("other data")
+	objects := []common.MetaData{
+		{ObjectID: "dedup1", ObjectType: "type1", DestOrgID: "myorg"},
+		{ObjectID: "dedup2", ObjectType: "type1", DestOrgID: "myorg"},
+		{ObjectID: "dedup3", ObjectType: "type2", DestOrgID: "myorg"},
+	}
+	blobs := func() uint32 {
+		count, err := store.count("fs.files", bson.M{"filename": bson.M{"$regex": "^sha256:"}})
+		if err != nil {
+			t.Errorf("Failed to count the data blobs. Error: %s", err.Error())
+		}
+		return count
+	}
+	checkData := func(metaData common.MetaData, expected []byte) {
+		dataReader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve the data of %s", metaData.ObjectID)
+			return
+		}
+		storedData, _ := ioutil.ReadAll(dataReader)
+		store.CloseDataReader(dataReader)
+		if !bytes.Equal(storedData, expected) {
+			t.Errorf("The data of %s (%s) doesn't match the stored data (%s)", metaData.ObjectID, string(storedData), string(expected))
+		}
+		chunk, _, _, err := store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 5, 4)
+		if err != nil || !bytes.Equal(chunk, expected[4:9]) {
+			t.Errorf("Failed to read a chunk of the data of %s", metaData.ObjectID)
+		}
+	}
+
+	for _, metaData := range objects {
+		store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	}
+	initialBlobs := blobs()
+
+	// Stored with the meta data
+	if _, err := store.StoreObject(objects[0], data, common.CompletelyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	// Stored chunk by chunk
+	if _, err := store.StoreObject(objects[1], nil, common.PartiallyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if err := store.AppendObjectData(objects[1].DestOrgID, objects[1].ObjectType, objects[1].ObjectID, bytes.NewReader(data[:10]),
+		10, 0, int64(len(data)), true, false); err != nil {
+		t.Errorf("Failed to append data. Error: %s", err.Error())
+	}
+	if err := store.AppendObjectData(objects[1].DestOrgID, objects[1].ObjectType, objects[1].ObjectID, bytes.NewReader(data[10:]),
+		uint32(len(data)-10), 10, int64(len(data)), false, true); err != nil {
+		t.Errorf("Failed to append data. Error: %s", err.Error())
+	}
+	// Stored after the meta data
+	if _, err := store.StoreObject(objects[2], nil, common.CompletelyReceived); err != nil {
+		t.Errorf("Failed to store object. Error: %s", err.Error())
+	}
+	if _, err := store.StoreObjectData(objects[2].DestOrgID, objects[2].ObjectType, objects[2].ObjectID, bytes.NewReader(data)); err != nil {
+		t.Errorf("Failed to store data. Error: %s", err.Error())
+	}
+
+	if count := blobs(); count != initialBlobs+1 {
+		t.Errorf("%d data blobs were stored for identical data instead of 1", count-initialBlobs)
+	}
+	for _, metaData := range objects {
+		checkData(metaData, data)
+	}
+
+	// The shared data is removed when no object refers to it
+	if err := store.DeleteStoredData(objects[0].DestOrgID, objects[0].ObjectType, objects[0].ObjectID); err != nil {
+		t.Errorf("Failed to delete data. Error: %s", err.Error())
+	}
+	if _, err := store.StoreObjectData(objects[1].DestOrgID, objects[1].ObjectType, objects[1].ObjectID, bytes.NewReader(otherData)); err != nil {
+		t.Errorf("Failed to store data. Error: %s", err.Error())
+	}
+	checkData(objects[1], otherData)
+	checkData(objects[2], data)
+	if count := blobs(); count != initialBlobs+2 {
+		t.Errorf("%d data blobs are stored instead of 2", count-initialBlobs)
+	}
+	if err := store.DeleteStoredObject(objects[2].DestOrgID, objects[2].ObjectType, objects[2].ObjectID); err != nil {
+		t.Errorf("Failed to delete object. Error: %s", err.Error())
+	}
+	if err := store.DeleteStoredObject(objects[1].DestOrgID, objects[1].ObjectType, objects[1].ObjectID); err != nil {
+		t.Errorf("Failed to delete object. Error: %s", err.Error())
+	}
+	if count := blobs(); count != initialBlobs {
+		t.Errorf("%d data blobs remain after their objects were deleted", count-initialBlobs)
+	}
+}
+
+func TestMongoStorageDataKeys(t *testing.T) {
+	testStorageDataKeys(common.Mongo, t)
+}
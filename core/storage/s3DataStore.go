@@ -0,0 +1,436 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// s3MinPartSize is the minimal size of a part of a multipart upload, except for the last part
+const s3MinPartSize = 5 * 1024 * 1024
+
+// s3MaxOutOfOrderChunks is the maximal number of out-of-order chunks kept while waiting for the missing chunks
+const s3MaxOutOfOrderChunks = 100
+
+// s3DataStore stores the data of objects in a bucket of an S3 compatible object store.
+// The data received chunk by chunk is uploaded as a multipart upload, and chunks are read with range requests.
+type s3DataStore struct {
+	endpoint        string
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	client          *http.Client
+	uploads         map[string]*s3Upload
+	lock            sync.Mutex
+}
+
+// s3Upload holds the state of a multipart upload of an object's data
+type s3Upload struct {
+	uploadID string
+	parts    []s3CompletedPart
+	buffer   []byte           // The data that hasn't been uploaded yet
+	offset   int64            // The offset of the next expected chunk
+	chunks   map[int64][]byte // Chunks that were received out of order, keyed by their offsets
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// s3DataReader reads the data of an object from the body of an S3 response
+type s3DataReader struct {
+	io.ReadCloser
+}
+
+func newS3DataStore() *s3DataStore {
+	return &s3DataStore{endpoint: strings.TrimSuffix(common.Configuration.S3Endpoint, "/"), bucket: common.Configuration.S3Bucket,
+		region: common.Configuration.S3Region, accessKeyID: common.Configuration.S3AccessKeyID,
+		secretAccessKey: common.Configuration.S3SecretAccessKey, client: &http.Client{Timeout: 5 * time.Minute},
+		uploads: make(map[string]*s3Upload)}
+}
+
+// putData stores the data read from dataReader, replacing the existing data. It returns the size of the data.
+func (store *s3DataStore) putData(id string, dataReader io.Reader) (int64, common.SyncServiceError) {
+	store.abortUpload(id)
+
+	upload := &s3Upload{}
+	buffer := make([]byte, s3MinPartSize)
+	for {
+		n, err := io.ReadFull(dataReader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			store.abortMultipartUpload(id, upload)
+			return 0, &Error{fmt.Sprintf("Failed to read the data. Error: %s.", err)}
+		}
+		upload.buffer = buffer[:n]
+		upload.offset += int64(n)
+		if err != nil {
+			if err := store.completeUpload(id, upload); err != nil {
+				return 0, err
+			}
+			return upload.offset, nil
+		}
+		if err := store.uploadPart(id, upload); err != nil {
+			store.abortMultipartUpload(id, upload)
+			return 0, err
+		}
+	}
+}
+
+// appendData appends a chunk of data to the data being uploaded.
+// Chunks that arrive out of order are kept until the missing chunks arrive.
+func (store *s3DataStore) appendData(id string, dataReader io.Reader, dataLength uint32, offset int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	var data []byte
+	var err error
+	if dataLength > 0 {
+		data = make([]byte, dataLength)
+		_, err = io.ReadFull(dataReader, data)
+	} else {
+		data, err = ioutil.ReadAll(dataReader)
+	}
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to read the data from the dataReader. Error: %s.", err)}
+	}
+
+	if isFirstChunk {
+		store.abortUpload(id)
+	}
+	store.lock.Lock()
+	upload := store.uploads[id]
+	if upload == nil {
+		if !isFirstChunk {
+			store.lock.Unlock()
+			return &Error{fmt.Sprintf("Failed to append the data at offset %d, the upload of %s doesn't exist.", offset, id)}
+		}
+		upload = &s3Upload{}
+		store.uploads[id] = upload
+	}
+	store.lock.Unlock()
+
+	if offset == upload.offset {
+		for data != nil {
+			upload.buffer = append(upload.buffer, data...)
+			upload.offset += int64(len(data))
+			data = upload.chunks[upload.offset]
+			delete(upload.chunks, upload.offset)
+		}
+	} else {
+		if upload.chunks == nil {
+			upload.chunks = make(map[int64][]byte)
+		}
+		if len(upload.chunks) > s3MaxOutOfOrderChunks {
+			if trace.IsLogging(logger.INFO) {
+				trace.Info(" Discard data chunk at offset %d since there are too many (%d) out-of-order chunks\n", offset, len(upload.chunks))
+			}
+			return &Discarded{fmt.Sprintf(" Discard data chunk at offset %d since there are too many out-of-order chunks\n", offset)}
+		}
+		upload.chunks[offset] = data
+	}
+
+	if isLastChunk {
+		store.lock.Lock()
+		delete(store.uploads, id)
+		store.lock.Unlock()
+		return store.completeUpload(id, upload)
+	}
+	if len(upload.buffer) >= s3MinPartSize {
+		return store.uploadPart(id, upload)
+	}
+	return nil
+}
+
+// readData reads size bytes of the data starting at offset with a range request
+func (store *s3DataStore) readData(id string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1))
+	response, err := store.send(http.MethodGet, id, nil, nil, header)
+	if err != nil {
+		return nil, true, 0, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return nil, true, 0, &common.NotFound{}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The offset is beyond the end of the data
+		return make([]byte, 0), true, 0, nil
+	case http.StatusOK, http.StatusPartialContent:
+	default:
+		return nil, true, 0, store.responseError(http.MethodGet, id, response)
+	}
+
+	data, readErr := ioutil.ReadAll(response.Body)
+	if readErr != nil {
+		return nil, true, 0, &Error{fmt.Sprintf("Failed to read the data. Error: %s.", readErr)}
+	}
+	eof := response.StatusCode == http.StatusOK
+	if contentRange := response.Header.Get("Content-Range"); contentRange != "" {
+		// Content-Range: bytes <first>-<last>/<total>
+		if index := strings.LastIndex(contentRange, "/"); index != -1 {
+			if total, err := strconv.ParseInt(contentRange[index+1:], 10, 64); err == nil {
+				eof = offset+int64(len(data)) >= total
+			}
+		}
+	}
+	return data, eof, len(data), nil
+}
+
+// openReader opens a reader of the data positioned at offset. It returns nil if the object has no data.
+func (store *s3DataStore) openReader(id string, offset int64) (io.Reader, common.SyncServiceError) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := store.send(http.MethodGet, id, nil, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return &s3DataReader{response.Body}, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		response.Body.Close()
+		return &s3DataReader{ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	case http.StatusNotFound:
+		response.Body.Close()
+		return nil, nil
+	default:
+		response.Body.Close()
+		return nil, store.responseError(http.MethodGet, id, response)
+	}
+}
+
+// deleteData deletes the data and aborts its upload if it is in progress
+func (store *s3DataStore) deleteData(id string) common.SyncServiceError {
+	store.abortUpload(id)
+	response, err := store.send(http.MethodDelete, id, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return store.responseError(http.MethodDelete, id, response)
+	}
+	return nil
+}
+
+func (store *s3DataStore) abortUpload(id string) {
+	store.lock.Lock()
+	upload := store.uploads[id]
+	delete(store.uploads, id)
+	store.lock.Unlock()
+	if upload != nil {
+		store.abortMultipartUpload(id, upload)
+	}
+}
+
+// uploadPart uploads the buffered data as the next part of the multipart upload, starting the upload if necessary
+func (store *s3DataStore) uploadPart(id string, upload *s3Upload) common.SyncServiceError {
+	if upload.uploadID == "" {
+		response, err := store.send(http.MethodPost, id, url.Values{"uploads": {""}}, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return store.responseError(http.MethodPost, id, response)
+		}
+		result := s3InitiateMultipartUploadResult{}
+		if err := xml.NewDecoder(response.Body).Decode(&result); err != nil || result.UploadID == "" {
+			return &Error{fmt.Sprintf("Failed to start the multipart upload of %s. Error: invalid response.", id)}
+		}
+		upload.uploadID = result.UploadID
+	}
+
+	partNumber := len(upload.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {upload.uploadID}}
+	response, err := store.send(http.MethodPut, id, query, upload.buffer, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return store.responseError(http.MethodPut, id, response)
+	}
+	upload.parts = append(upload.parts, s3CompletedPart{PartNumber: partNumber, ETag: response.Header.Get("ETag")})
+	upload.buffer = nil
+	return nil
+}
+
+// completeUpload uploads the remaining buffered data and completes the upload.
+// Data that fits in a single part is stored with a single request.
+func (store *s3DataStore) completeUpload(id string, upload *s3Upload) common.SyncServiceError {
+	if upload.uploadID == "" {
+		response, err := store.send(http.MethodPut, id, nil, upload.buffer, nil)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return store.responseError(http.MethodPut, id, response)
+		}
+		return nil
+	}
+
+	if len(upload.buffer) != 0 {
+		if err := store.uploadPart(id, upload); err != nil {
+			store.abortMultipartUpload(id, upload)
+			return err
+		}
+	}
+	body, err := xml.Marshal(s3CompleteMultipartUpload{Parts: upload.parts})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to complete the multipart upload of %s. Error: %s.", id, err)}
+	}
+	response, sendErr := store.send(http.MethodPost, id, url.Values{"uploadId": {upload.uploadID}}, body, nil)
+	if sendErr != nil {
+		return sendErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return store.responseError(http.MethodPost, id, response)
+	}
+	return nil
+}
+
+func (store *s3DataStore) abortMultipartUpload(id string, upload *s3Upload) {
+	if upload.uploadID == "" {
+		return
+	}
+	response, err := store.send(http.MethodDelete, id, url.Values{"uploadId": {upload.uploadID}}, nil, nil)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to abort the multipart upload of %s. Error: %s\n", id, err)
+		}
+		return
+	}
+	response.Body.Close()
+}
+
+func (store *s3DataStore) responseError(method string, id string, response *http.Response) common.SyncServiceError {
+	return &Error{fmt.Sprintf("S3 request %s of %s failed. Status: %s.", method, id, response.Status)}
+}
+
+// send sends a request about the object with the given ID to the S3 object store, signed with AWS signature version 4
+func (store *s3DataStore) send(method string, id string, query url.Values, body []byte, header http.Header) (*http.Response, common.SyncServiceError) {
+	canonicalURI := "/" + s3Escape(store.bucket, false) + "/" + s3Escape(id, false)
+	canonicalQuery := s3CanonicalQuery(query)
+	requestURL := store.endpoint + canonicalURI
+	if canonicalQuery != "" {
+		requestURL += "?" + canonicalQuery
+	}
+
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to create S3 request. Error: %s.", err)}
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.ContentLength = int64(len(body))
+
+	if store.accessKeyID != "" {
+		store.sign(request, canonicalURI, canonicalQuery, body)
+	}
+
+	response, err := store.client.Do(request)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("S3 request %s of %s failed. Error: %s.", method, id, err)}
+	}
+	return response, nil
+}
+
+func (store *s3DataStore) sign(request *http.Request, canonicalURI string, canonicalQuery string, body []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + request.URL.Host + "\n" + "x-amz-content-sha256:" + payloadHash + "\n" + "x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{request.Method, canonicalURI, canonicalQuery, canonicalHeaders, signedHeaders, payloadHash}, "\n")
+
+	scope := date + "/" + store.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+store.secretAccessKey), date)
+	key = hmacSHA256(key, store.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		store.accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3Escape escapes a string as required by AWS signature version 4: all the characters except the unreserved ones are escaped
+func s3Escape(value string, escapeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' ||
+			(c == '/' && !escapeSlash) {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parameters := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parameters = append(parameters, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parameters, "&")
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
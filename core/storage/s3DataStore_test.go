@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// fakeS3 is a minimal in-memory S3 server supporting the requests used by s3DataStore
+type fakeS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[int][]byte
+	uploads int
+}
+
+func (server *fakeS3) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if !strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := request.URL.Path
+	query := request.URL.Query()
+	body, _ := ioutil.ReadAll(request.Body)
+
+	switch {
+	case request.Method == http.MethodPost && query.Get("uploadId") == "" && strings.Contains(request.URL.RawQuery, "uploads"):
+		server.uploads++
+		uploadID := strconv.Itoa(server.uploads)
+		server.parts[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(writer, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case request.Method == http.MethodPut && query.Get("uploadId") != "":
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		server.parts[query.Get("uploadId")][partNumber] = body
+		writer.Header().Set("ETag", fmt.Sprintf("\"%d\"", partNumber))
+	case request.Method == http.MethodPost && query.Get("uploadId") != "":
+		parts := server.parts[query.Get("uploadId")]
+		data := make([]byte, 0)
+		for i := 1; i <= len(parts); i++ {
+			if i < len(parts) && len(parts[i]) < s3MinPartSize {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data = append(data, parts[i]...)
+		}
+		server.objects[key] = data
+		delete(server.parts, query.Get("uploadId"))
+	case request.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(server.parts, query.Get("uploadId"))
+		writer.WriteHeader(http.StatusNoContent)
+	case request.Method == http.MethodPut:
+		server.objects[key] = body
+	case request.Method == http.MethodDelete:
+		delete(server.objects, key)
+		writer.WriteHeader(http.StatusNoContent)
+	case request.Method == http.MethodGet:
+		data, ok := server.objects[key]
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rangeHeader := request.Header.Get("Range")
+		if rangeHeader == "" {
+			writer.Write(data)
+			return
+		}
+		bounds := strings.Split(strings.TrimPrefix(rangeHeader, "bytes="), "-")
+		first, _ := strconv.Atoi(bounds[0])
+		last := len(data) - 1
+		if bounds[1] != "" {
+			last, _ = strconv.Atoi(bounds[1])
+		}
+		if first >= len(data) {
+			writer.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if last >= len(data) {
+			last = len(data) - 1
+		}
+		writer.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+		writer.WriteHeader(http.StatusPartialContent)
+		writer.Write(data[first : last+1])
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3DataStore(t *testing.T) {
+	server := &fakeS3{objects: make(map[string][]byte), parts: make(map[string]map[int][]byte)}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	common.Configuration.S3Endpoint = httpServer.URL
+	common.Configuration.S3Bucket = "bucket"
+	common.Configuration.S3AccessKeyID = "key"
+	common.Configuration.S3SecretAccessKey = "secret"
+	defer func() {
+		common.Configuration.S3Endpoint = ""
+		common.Configuration.S3Bucket = ""
+		common.Configuration.S3AccessKeyID = ""
+		common.Configuration.S3SecretAccessKey = ""
+	}()
+	store := newS3DataStore()
+
+	// Small data is stored with a single request, large data with a multipart upload
+	large := bytes.Repeat([]byte("0123456789"), s3MinPartSize/4)
+	for _, data := range [][]byte{[]byte("hello world"), large} {
+		if size, err := store.putData("myorg:type1:1", bytes.NewReader(data)); err != nil {
+			t.Errorf("putData failed. Error: %s", err.Error())
+		} else if size != int64(len(data)) {
+			t.Errorf("putData returned size %d instead of %d", size, len(data))
+		}
+		if !bytes.Equal(server.objects["/bucket/myorg:type1:1"], data) {
+			t.Errorf("Wrong data stored (%d bytes)", len(data))
+		}
+	}
+
+	if data, eof, length, err := store.readData("myorg:type1:1", 10, 20); err != nil {
+		t.Errorf("readData failed. Error: %s", err.Error())
+	} else if eof || length != 10 || string(data) != "0123456789" {
+		t.Errorf("readData returned %s (eof = %t, length = %d)", string(data), eof, length)
+	}
+	if _, eof, length, err := store.readData("myorg:type1:1", 10, int64(len(large)-5)); err != nil {
+		t.Errorf("readData failed. Error: %s", err.Error())
+	} else if !eof || length != 5 {
+		t.Errorf("readData of the last chunk returned eof = %t, length = %d", eof, length)
+	}
+	if _, _, _, err := store.readData("myorg:type1:2", 10, 0); !common.IsNotFound(err) {
+		t.Errorf("readData of missing data didn't return not found")
+	}
+
+	// Chunks received out of order are uploaded in order
+	chunks := [][]byte{[]byte("hello "), []byte("sync "), []byte("world")}
+	offsets := []int64{0, 6, 11}
+	for _, i := range []int{0, 2, 1} {
+		if err := store.appendData("myorg:type1:3", bytes.NewReader(chunks[i]), uint32(len(chunks[i])), offsets[i], i == 0, i == 1); err != nil {
+			t.Errorf("appendData failed (offset = %d). Error: %s", offsets[i], err.Error())
+		}
+	}
+	reader, err := store.openReader("myorg:type1:3", 6)
+	if err != nil || reader == nil {
+		t.Errorf("openReader failed")
+	} else {
+		data, _ := ioutil.ReadAll(reader)
+		reader.(*s3DataReader).Close()
+		if string(data) != "sync world" {
+			t.Errorf("Wrong data read: %s instead of sync world", string(data))
+		}
+	}
+
+	if err := store.deleteData("myorg:type1:3"); err != nil {
+		t.Errorf("deleteData failed. Error: %s", err.Error())
+	}
+	if reader, err := store.openReader("myorg:type1:3", 0); err != nil || reader != nil {
+		t.Errorf("openReader returned a reader of deleted data")
+	}
+}
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"time"
 
@@ -11,16 +13,29 @@ import (
 )
 
 const (
-	destinations    = "syncDestinations"
-	leader          = "syncLeaderElection"
-	notifications   = "syncNotifications"
-	objects         = "syncObjects"
-	messagingGroups = "syncMessagingGroups"
-	webhooks        = "syncWebhooks"
-	organizations   = "syncOrganizations"
-	acls            = "syncACLs"
+	destinations      = "syncDestinations"
+	leader            = "syncLeaderElection"
+	notifications     = "syncNotifications"
+	objects           = "syncObjects"
+	messagingGroups   = "syncMessagingGroups"
+	webhooks          = "syncWebhooks"
+	organizations     = "syncOrganizations"
+	acls              = "syncACLs"
+	webhookDeliveries = "syncWebhookDeliveries"
+	objectCleanups    = "syncObjectCleanups"
+	destinationGroups = "syncDestinationGroups"
+	replicas          = "syncReplicas"
+	dataBlobs         = "syncDataBlobs"
+	orderSequences    = "syncOrderSequences"
 )
 
+// Replica is a CSS instance that shares the storage with other CSS instances
+type Replica struct {
+	ID            string
+	Address       string
+	LastHeartbeat time.Time
+}
+
 // Storage is the interface for stores
 type Storage interface {
 	// Initialize the store
@@ -37,22 +52,47 @@ type Storage interface {
 
 	// Store an object
 	// If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
+	// The data is stored encoded with a new ObjectDataCodec
 	StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError)
 
 	// Store object's data
 	// Return true if the object was found and updated
 	// Return false and no error, if the object doesn't exist
+	// The codec of the data is recorded if dataReader is an encoding reader (see ObjectDataCodec)
 	StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError)
 
 	// Append a chunk of data to the object's data
+	// The codec of the data is recorded with the first chunk, if dataReader is an encoding reader (see ObjectDataCodec)
 	AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError
 
+	// Append a chunk of zeros to the object's data, without writing the zeros where the storage supports sparse data
+	AppendObjectZeroData(orgID string, objectType string, objectID string, length uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError
+
 	// Update object's status
 	UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError
 
+	// UpdateObjectMetadataOnly applies a metadata only update, received from the other side, to the stored object in place.
+	// The object's data, and the fields of the meta data that describe it (DataID, ObjectSize, ChunkSize and
+	// PatchRanges), are kept.
+	UpdateObjectMetadataOnly(metaData common.MetaData, status string) common.SyncServiceError
+
 	// Update object's source data URI
 	UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError
 
+	// UpdateObjectPriority updates the priority of the transfers of the object's data
+	UpdateObjectPriority(orgID string, objectType string, objectID string, priority int) common.SyncServiceError
+
+	// RetrieveObjectDataCodec returns the codec of the object's data, or nil if the data isn't encoded or the object doesn't exist
+	RetrieveObjectDataCodec(orgID string, objectType string, objectID string) (*ObjectDataCodec, common.SyncServiceError)
+
+	// RetrieveObjectsWithOtherDataKey returns the objects whose data is encrypted with a key other than keyID
+	RetrieveObjectsWithOtherDataKey(keyID string) ([]common.MetaData, common.SyncServiceError)
+
+	// StoreReencryptedObjectData replaces the object's data with the same data read from dataReader, encoded with codec,
+	// and records the codec. A nil dataReader only records the codec. The rest of the object is kept.
+	StoreReencryptedObjectData(orgID string, objectType string, objectID string, codec *ObjectDataCodec,
+		dataReader io.Reader) common.SyncServiceError
+
 	// Find the object and return its status
 	RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError)
 
@@ -72,6 +112,9 @@ type Storage interface {
 	// If received is true, return objects marked as received
 	RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError)
 
+	// RetrieveObjectsWithStatus returns the objects of the type that have the given status
+	RetrieveObjectsWithStatus(orgID string, objectType string, status string) ([]common.MetaData, common.SyncServiceError)
+
 	// RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 	// If received is true, return objects marked as policy received
 	RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
@@ -94,6 +137,13 @@ type Storage interface {
 	// RetrieveConsumedObjects returns all the consumed objects originated from this node
 	RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError)
 
+	// RetrieveObjectsToEvict returns the objects to remove to keep the size of the stored data below the storage's limit.
+	// Only the in-memory storage has a limit, see InMemoryMaxDataSizeKB.
+	RetrieveObjectsToEvict() ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveReceivedObjects returns all the objects that were completely received from the other side and not deleted
+	RetrieveReceivedObjects() ([]common.MetaData, common.SyncServiceError)
+
 	// Return the object meta data with the specified parameters
 	RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError)
 
@@ -109,6 +159,10 @@ type Storage interface {
 	// Close the data reader if necessary
 	CloseDataReader(dataReader io.Reader) common.SyncServiceError
 
+	// OpenObjectDataReader opens a reader of the object's data positioned at offset, for reading consecutive chunks
+	// The reader must be closed when done
+	OpenObjectDataReader(orgID string, objectType string, objectID string, offset int64) (ObjectDataReader, common.SyncServiceError)
+
 	// Marks the object as deleted
 	MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError
 
@@ -121,6 +175,20 @@ type Storage interface {
 	// GetObjectsToActivate returns inactive objects that are ready to be activated
 	GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError)
 
+	// GetExpiredObjects returns the objects originated by this node whose expiration time has passed
+	GetExpiredObjects() ([]common.MetaData, common.SyncServiceError)
+
+	// GetOverdueObjects returns the objects originated by this node whose delivery deadline (DeliverBy) has passed
+	GetOverdueObjects() ([]common.MetaData, common.SyncServiceError)
+
+	// DeleteObjectsWithFilter marks the objects originated by this node that meet the given conditions as pending deletion,
+	// and returns the number of marked objects. The deletion of the marked objects is completed by the communications module.
+	DeleteObjectsWithFilter(orgID string, objectType string, destinationType string, destinationID string,
+		expirationTimeBefore string) (int, common.SyncServiceError)
+
+	// RetrieveObjectsPendingDeletion returns the objects originated by this node that are marked as pending deletion
+	RetrieveObjectsPendingDeletion() ([]common.MetaData, common.SyncServiceError)
+
 	// Delete the object
 	DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError
 
@@ -139,6 +207,11 @@ type Storage interface {
 	UpdateObjectDeliveryStatus(status string, message string, orgID string, objectType string, objectID string,
 		destType string, destID string) (bool, common.SyncServiceError)
 
+	// UpdateObjectConsumedOffset records the offset up to which the destination consumed the object's data.
+	// The consumed offset only grows, a lower offset is ignored.
+	UpdateObjectConsumedOffset(orgID string, objectType string, objectID string, destType string, destID string,
+		offset int64) common.SyncServiceError
+
 	// UpdateObjectDelivering marks the object as being delivered to all its destinations
 	UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError
 
@@ -164,6 +237,24 @@ type Storage interface {
 	// RetrieveWebhooks gets the webhooks for the object type
 	RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError)
 
+	// StoreWebhookDelivery stores or updates a webhook call to be retried
+	StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError
+
+	// DeleteWebhookDelivery deletes a webhook call
+	DeleteWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError
+
+	// RetrieveWebhookDeliveries returns the webhook calls to be retried, or the dead-lettered ones if deadLetter is true
+	RetrieveWebhookDeliveries(deadLetter bool) ([]common.WebhookDelivery, common.SyncServiceError)
+
+	// StoreObjectCleanup stores or updates a removal of an object to be retried
+	StoreObjectCleanup(cleanup common.ObjectCleanup) common.SyncServiceError
+
+	// DeleteObjectCleanup deletes a removal of an object to be retried
+	DeleteObjectCleanup(orgID string, objectType string, objectID string) common.SyncServiceError
+
+	// RetrieveObjectCleanups returns the removals of objects to be retried
+	RetrieveObjectCleanups() ([]common.ObjectCleanup, common.SyncServiceError)
+
 	// Return all the destinations with the provided orgID and destType
 	RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError)
 
@@ -182,6 +273,49 @@ type Storage interface {
 	// UpdateDestinationLastPingTime updates the last ping time for the destination
 	UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError
 
+	// UpdateDestinationLastSeen updates the time the destination was last seen (for CSS)
+	UpdateDestinationLastSeen(destination common.Destination) common.SyncServiceError
+
+	// RetrieveDestinationLastSeen returns the time the destination was last seen (for CSS)
+	RetrieveDestinationLastSeen(orgID string, destType string, destID string) (time.Time, common.SyncServiceError)
+
+	// UpdateDestinationMessageVersion updates the message version negotiated with the destination (for CSS)
+	UpdateDestinationMessageVersion(destination common.Destination, version common.SyncServiceVersion) common.SyncServiceError
+
+	// RetrieveDestinationMessageVersion returns the message version negotiated with the destination (for CSS)
+	RetrieveDestinationMessageVersion(orgID string, destType string, destID string) (common.SyncServiceVersion, common.SyncServiceError)
+
+	// UpdateDestinationPaused pauses or resumes sending data to the destination (for CSS)
+	UpdateDestinationPaused(orgID string, destType string, destID string, paused bool) common.SyncServiceError
+
+	// RetrieveDestinationPaused returns true if sending data to the destination is paused (for CSS)
+	RetrieveDestinationPaused(orgID string, destType string, destID string) (bool, common.SyncServiceError)
+
+	// UpdateDestinationOffline marks the destination as offline or online (for CSS)
+	UpdateDestinationOffline(orgID string, destType string, destID string, offline bool) common.SyncServiceError
+
+	// RetrieveDestinationOffline returns true if the destination is offline (for CSS)
+	RetrieveDestinationOffline(orgID string, destType string, destID string) (bool, common.SyncServiceError)
+
+	// UpdateDestinationAvailableSpace updates the storage space that the destination reported as available (for CSS)
+	UpdateDestinationAvailableSpace(destination common.Destination) common.SyncServiceError
+
+	// RetrieveDestinationsInfo returns all the destinations with the provided orgID and destType, the time
+	// they were last seen, their message versions, and whether they are paused or offline (for CSS)
+	RetrieveDestinationsInfo(orgID string, destType string) ([]common.DestinationInfo, common.SyncServiceError)
+
+	// AddDestinationToGroup adds the destination to the destination group (for CSS)
+	AddDestinationToGroup(orgID string, group string, destType string, destID string) common.SyncServiceError
+
+	// RemoveDestinationFromGroup removes the destination from the destination group (for CSS)
+	RemoveDestinationFromGroup(orgID string, group string, destType string, destID string) common.SyncServiceError
+
+	// RetrieveGroupMembers returns the registered destinations that are members of the destination group (for CSS)
+	RetrieveGroupMembers(orgID string, group string) ([]common.Destination, common.SyncServiceError)
+
+	// RetrieveDestinationGroups returns the names of the destination groups the destination is a member of (for CSS)
+	RetrieveDestinationGroups(orgID string, destType string, destID string) ([]string, common.SyncServiceError)
+
 	// RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 	RemoveInactiveDestinations(lastTimestamp time.Time)
 
@@ -194,6 +328,10 @@ type Storage interface {
 	// GetObjectsForDestination retrieves objects that are in use on a given node
 	GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError)
 
+	// RetrievePendingObjects returns the objects that are pending delivery to the destination, i.e., whose notifications
+	// to the destination weren't received or consumed by it yet, and their delivery status for the destination
+	RetrievePendingObjects(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError)
+
 	// RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 	RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError)
 
@@ -204,9 +342,10 @@ type Storage interface {
 	UpdateRemovedDestinationPolicyServices(orgID string, objectType string, objectID string, destinationPolicyServices []common.ServiceID) common.SyncServiceError
 
 	// Update/add a notification record to an object
+	// A rejected notification is stored without a resend time, it is never resent
 	UpdateNotificationRecord(notification common.Notification) common.SyncServiceError
 
-	// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+	// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.NotificationResendInterval*6
 	UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError
 
 	// RetrieveNotificationRecord retrieves notification
@@ -221,14 +360,42 @@ type Storage interface {
 	// Return the list of pending notifications that are waiting to be sent to the destination
 	RetrievePendingNotifications(orgID string, destType string, destID string) ([]common.Notification, common.SyncServiceError)
 
+	// Return the list of the notifications of the organization (of all the organizations if orgID is empty) that have the given status
+	RetrieveNotificationsWithStatus(orgID string, status string) ([]common.Notification, common.SyncServiceError)
+
+	// GetNumberOfNotificationRecords returns the number of notification records of the destination
+	GetNumberOfNotificationRecords(orgID string, destType string, destID string) (uint32, common.SyncServiceError)
+
+	// IterateNotificationRecords calls the function with each of the notification records, without loading all the records
+	// into memory. The iteration stops at the first error returned by the function, and that error is returned.
+	// Records that exist throughout the iteration are reported exactly once, records that are stored or deleted during
+	// the iteration may or may not be reported. The function must not update the storage.
+	IterateNotificationRecords(iterate func(common.Notification) error) common.SyncServiceError
+
+	// RetrieveOrderedNotifications returns the notification records of the objects of the type that are delivered in order
+	// to the destination, that is, the records with an order sequence number
+	RetrieveOrderedNotifications(orgID string, objectType string, destType string, destID string) ([]common.Notification, common.SyncServiceError)
+
+	// IncrementOrderSequence increments the order sequence number of the objects of the type that are sent to the destination,
+	// and returns the incremented sequence number
+	IncrementOrderSequence(orgID string, objectType string, destType string, destID string) (int64, common.SyncServiceError)
+
+	// RetrieveDeliveredOrderSequence returns the order sequence number up to which the objects of the type that were received
+	// from the origin were delivered
+	RetrieveDeliveredOrderSequence(orgID string, objectType string, originType string, originID string) (int64, common.SyncServiceError)
+
+	// UpdateDeliveredOrderSequence updates the order sequence number up to which the objects of the type that were received
+	// from the origin were delivered
+	UpdateDeliveredOrderSequence(orgID string, objectType string, originType string, originID string, sequence int64) common.SyncServiceError
+
 	// InsertInitialLeader inserts the initial leader document in the collection is empty
 	InsertInitialLeader(leaderID string) (bool, common.SyncServiceError)
 
 	// LeaderPeriodicUpdate does the periodic update of the leader document by the leader
 	LeaderPeriodicUpdate(leaderID string) (bool, common.SyncServiceError)
 
-	// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader document
-	RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError)
+	// RetrieveLeader retrieves the leader's ID and address, the Heartbeat timeout and Last heartbeat time stamp from the leader document
+	RetrieveLeader() (string, string, int32, time.Time, int64, common.SyncServiceError)
 
 	// UpdateLeader updates the leader entry for a leadership takeover
 	UpdateLeader(leaderID string, version int64) (bool, common.SyncServiceError)
@@ -236,6 +403,15 @@ type Storage interface {
 	// ResignLeadership causes this sync service to give up the Leadership
 	ResignLeadership(leaderID string) common.SyncServiceError
 
+	// ReplicaPeriodicUpdate does the periodic update of the replica's entry, inserting it if it doesn't exist
+	ReplicaPeriodicUpdate(replicaID string) common.SyncServiceError
+
+	// RetrieveReplicas retrieves the replicas' IDs, addresses and last heartbeat time stamps
+	RetrieveReplicas() ([]Replica, common.SyncServiceError)
+
+	// RemoveReplica removes the replica's entry
+	RemoveReplica(replicaID string) common.SyncServiceError
+
 	// RetrieveTimeOnServer retrieves the current time on the database server
 	RetrieveTimeOnServer() (time.Time, error)
 
@@ -287,6 +463,12 @@ type Storage interface {
 
 	// IsPersistent returns true if the storage is persistent, and false otherwise
 	IsPersistent() bool
+
+	// SupportsDataPatch returns true if the storage can overwrite byte ranges of an object's existing data, and false otherwise
+	SupportsDataPatch() bool
+
+	// AvailableSpace returns the storage space, in bytes, available for objects' data, and -1 if it is unknown
+	AvailableSpace() (int64, common.SyncServiceError)
 }
 
 // Error is the error used in the storage layer
@@ -313,6 +495,10 @@ func IsNotFound(err error) bool {
 	return ok
 }
 
+func getWebhookDeliveryID(delivery common.WebhookDelivery) string {
+	return delivery.MetaData.DestOrgID + ":" + delivery.MetaData.ObjectType + ":" + delivery.MetaData.ObjectID + ":" + delivery.URL
+}
+
 var notFound = &NotFound{"Object not found"}
 
 // NotConnected is the error returned if there is no connection to the database
@@ -330,6 +516,18 @@ func IsNotConnected(err error) bool {
 	return ok
 }
 
+// IsTransient returns true if the error passed in is a transient error, such as a lost connection to the database,
+// so that the failed operation may succeed if it is retried
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case *NotConnected:
+		return true
+	case interface{ Temporary() bool }:
+		return e.Temporary()
+	}
+	return false
+}
+
 // Discarded is the error returned if an out-of-order chunk wasn't appended to the stored object because of memory usage protection
 type Discarded struct {
 	message string
@@ -345,6 +543,57 @@ func IsDiscarded(err error) bool {
 	return ok
 }
 
+// objectMatchesFilter returns true if the object meets the given conditions, empty conditions are ignored
+func objectMatchesFilter(metaData common.MetaData, objectType string, destinationType string, destinationID string,
+	expirationTimeBefore string) bool {
+	if objectType != "" && objectType != metaData.ObjectType {
+		return false
+	}
+
+	if destinationType != "" {
+		if metaData.DestType != "" {
+			if destinationType != metaData.DestType || (destinationID != "" && destinationID != metaData.DestID) {
+				return false
+			}
+		} else {
+			found := false
+			for _, dest := range metaData.DestinationsList {
+				parts := strings.SplitN(dest, ":", 2)
+				if len(parts) == 2 && parts[0] == destinationType && (destinationID == "" || parts[1] == destinationID) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	if expirationTimeBefore != "" {
+		expiration, err := time.Parse(time.RFC3339, metaData.Expiration)
+		before, _ := time.Parse(time.RFC3339, expirationTimeBefore)
+		if err != nil || expiration.After(before) {
+			return false
+		}
+	}
+	return true
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(data []byte) (int, error) {
+	for i := range data {
+		data[i] = 0
+	}
+	return len(data), nil
+}
+
+// NewZeroReader returns a reader of length zeros
+func NewZeroReader(length int64) io.Reader {
+	return io.LimitReader(zeroReader{}, length)
+}
+
 // Objects
 func getObjectCollectionID(metaData common.MetaData) string {
 	return createObjectCollectionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
@@ -387,12 +636,85 @@ func createDestinationCollectionID(orgID string, destType string, destID string)
 	return strBuilder.String()
 }
 
+// Destination groups
+func createGroupMemberCollectionID(orgID string, group string, destType string, destID string) string {
+	var strBuilder strings.Builder
+	strBuilder.Grow(len(orgID) + len(group) + len(destType) + len(destID) + 4)
+	strBuilder.WriteString(orgID)
+	strBuilder.WriteByte(':')
+	strBuilder.WriteString(group)
+	strBuilder.WriteByte(':')
+	strBuilder.WriteString(destType)
+	strBuilder.WriteByte(':')
+	strBuilder.WriteString(destID)
+	return strBuilder.String()
+}
+
+// Order sequences
+func createOrderSequenceCollectionID(orgID string, objectType string, destType string, destID string) string {
+	var strBuilder strings.Builder
+	strBuilder.Grow(len(orgID) + len(objectType) + len(destType) + len(destID) + 4)
+	strBuilder.WriteString(orgID)
+	strBuilder.WriteByte(':')
+	strBuilder.WriteString(objectType)
+	strBuilder.WriteByte(':')
+	strBuilder.WriteString(destType)
+	strBuilder.WriteByte(':')
+	strBuilder.WriteString(destID)
+	return strBuilder.String()
+}
+
+// objectSentToGroups returns false if the object is sent to a destination group that is not in the list of groups
+func objectSentToGroups(metaData common.MetaData, groups []string) bool {
+	if metaData.DestGroup == "" {
+		return true
+	}
+	for _, group := range groups {
+		if group == metaData.DestGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// objectSentToDestination returns true if the object is sent to the destination: the destination is in the object's
+// DestinationsList or destinations, or the object is sent to its type (or to all the destinations)
+func objectSentToDestination(metaData common.MetaData, destinations []common.StoreDestinationStatus, destType string,
+	destID string) bool {
+	if len(metaData.DestinationsList) == 0 {
+		return (metaData.DestType == "" || metaData.DestType == destType) && (metaData.DestID == "" || metaData.DestID == destID)
+	}
+	for _, d := range metaData.DestinationsList {
+		if d == destType+":"+destID {
+			return true
+		}
+	}
+	for _, d := range destinations {
+		if d.Destination.DestType == destType && d.Destination.DestID == destID {
+			return true
+		}
+	}
+	return false
+}
+
 func resendNotification(notification common.Notification, retrieveReceived bool) bool {
 	s := notification.Status
 	return (s == common.Update || s == common.Consumed || s == common.Getdata || s == common.Delete || s == common.Deleted || s == common.Received ||
 		(retrieveReceived && (s == common.Data || s == common.ReceivedByDestination)))
 }
 
+// pendingDeliveryStatus returns the delivery status of an object whose notification to a destination has the given
+// status, and whether the object is still pending delivery to the destination
+func pendingDeliveryStatus(notificationStatus string) (string, bool) {
+	switch notificationStatus {
+	case common.UpdatePending:
+		return common.Pending, true
+	case common.Update, common.Updated, common.Data:
+		return common.Delivering, true
+	}
+	return "", false
+}
+
 func ensureArrayCapacity(data []byte, newCapacity int64) []byte {
 	if newCapacity <= int64(cap(data)) {
 		return data
@@ -418,7 +740,9 @@ func createDataPathFromMeta(prefix string, metaData common.MetaData) string {
 	return createDataPath(prefix, metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 }
 
-func createDestinationFromList(orgID string, store Storage, destinationsList []string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+// createDestinationFromList returns the destinations in the list. If preStage is true, the destinations that aren't
+// registered yet are skipped, they are added to the object when they register.
+func createDestinationFromList(orgID string, store Storage, destinationsList []string, preStage bool) ([]common.StoreDestinationStatus, common.SyncServiceError) {
 	dests := make([]common.StoreDestinationStatus, 0)
 	for _, d := range destinationsList {
 		parts := strings.Split(d, ":")
@@ -426,6 +750,9 @@ func createDestinationFromList(orgID string, store Storage, destinationsList []s
 			if dest, err := store.RetrieveDestination(orgID, parts[0], parts[1]); err == nil && dest != nil {
 				dests = append(dests, common.StoreDestinationStatus{Destination: *dest, Status: common.Pending})
 			} else {
+				if preStage && (err == nil || IsNotFound(err)) {
+					continue
+				}
 				if IsNotFound(err) {
 					return nil, &common.InvalidRequest{Message: fmt.Sprintf("Invalid destination %s:%s", parts[0], parts[1])}
 				}
@@ -444,7 +771,7 @@ func compareDestinations(oldList []common.StoreDestinationStatus, newList []comm
 	for _, dest := range oldList {
 		found := false
 		for index, newDest := range newList {
-			if dest.Destination == newDest.Destination {
+			if common.SameDestination(dest.Destination, newDest.Destination) {
 				if useOldStatus {
 					newList[index] = dest
 				}
@@ -459,7 +786,7 @@ func compareDestinations(oldList []common.StoreDestinationStatus, newList []comm
 	for index, newDest := range newList {
 		found := false
 		for _, dest := range oldList {
-			if dest.Destination == newDest.Destination {
+			if common.SameDestination(dest.Destination, newDest.Destination) {
 				if useOldStatus {
 					newList[index] = dest
 				}
@@ -479,7 +806,14 @@ func createDestinationsFromMeta(store Storage, metaData common.MetaData) ([]comm
 		return nil, nil, nil
 	}
 	dests := make([]common.StoreDestinationStatus, 0)
-	if metaData.DestID != "" {
+	if metaData.DestGroup != "" {
+		// The members of the group are expanded again when the object is sent
+		if members, err := store.RetrieveGroupMembers(metaData.DestOrgID, metaData.DestGroup); err == nil {
+			for _, dest := range members {
+				dests = append(dests, common.StoreDestinationStatus{Destination: dest, Status: common.Pending})
+			}
+		}
+	} else if metaData.DestID != "" {
 		// We check that destType is not empty in updateObject()
 		if dest, err := store.RetrieveDestination(metaData.DestOrgID, metaData.DestType, metaData.DestID); err == nil && dest != nil {
 			dests = append(dests, common.StoreDestinationStatus{Destination: *dest, Status: common.Pending})
@@ -494,12 +828,21 @@ func createDestinationsFromMeta(store Storage, metaData common.MetaData) ([]comm
 			}
 		} else {
 			var err error
-			dests, err = createDestinationFromList(metaData.DestOrgID, store, metaData.DestinationsList)
+			dests, err = createDestinationFromList(metaData.DestOrgID, store, metaData.DestinationsList, common.Configuration.PreStageObjects)
 			if err != nil {
 				return nil, nil, err
 			}
 		}
 	}
+	if len(metaData.DestinationAttributes) != 0 {
+		matchingDests := make([]common.StoreDestinationStatus, 0, len(dests))
+		for _, dest := range dests {
+			if common.MatchDestinationAttributes(metaData.DestinationAttributes, dest.Destination.Attributes) {
+				matchingDests = append(matchingDests, dest)
+			}
+		}
+		dests = matchingDests
+	}
 
 	existingDestList, _ := store.GetObjectDestinationsList(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	if existingDestList != nil {
@@ -513,7 +856,7 @@ func createDestinationsFromMeta(store Storage, metaData common.MetaData) ([]comm
 func createDestinations(orgID string, store Storage, existingDestinations []common.StoreDestinationStatus, destinationsList []string) ([]common.StoreDestinationStatus,
 	[]common.StoreDestinationStatus, []common.StoreDestinationStatus, common.SyncServiceError) {
 
-	dests, err := createDestinationFromList(orgID, store, destinationsList)
+	dests, err := createDestinationFromList(orgID, store, destinationsList, false)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -527,6 +870,8 @@ func DeleteStoredObject(store Storage, metaData common.MetaData) common.SyncServ
 	if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
 		return err
 	}
+	ForgetDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	ForgetCachedDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 
 	if common.Configuration.NodeType == common.ESS && metaData.DestinationDataURI != "" {
 		if err := dataURI.DeleteStoredData(metaData.DestinationDataURI); err != nil {
@@ -546,5 +891,82 @@ func DeleteStoredData(store Storage, metaData common.MetaData) common.SyncServic
 		return nil
 	}
 
+	ForgetCachedDataChunks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	return store.DeleteStoredData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 }
+
+// ObjectDataReader reads the data of an object sequentially, chunk by chunk, without seeking to each chunk
+type ObjectDataReader interface {
+	// NextChunk reads the next chunk of at most maxSize bytes.
+	// It returns the chunk, true if it is the last chunk of the data, and the length of the chunk.
+	NextChunk(maxSize int) ([]byte, bool, int, common.SyncServiceError)
+
+	// Offset returns the offset of the next chunk
+	Offset() int64
+
+	// Close closes the reader
+	Close() common.SyncServiceError
+}
+
+type objectDataReader struct {
+	store      Storage
+	dataReader io.Reader
+	reader     *bufio.Reader
+	offset     int64
+}
+
+// openObjectDataReader opens an ObjectDataReader on top of the store's RetrieveObjectData
+func openObjectDataReader(store Storage, orgID string, objectType string, objectID string,
+	offset int64) (ObjectDataReader, common.SyncServiceError) {
+	dataReader, err := store.RetrieveObjectData(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	reader := &objectDataReader{store: store, dataReader: dataReader, offset: offset}
+	if dataReader == nil {
+		return reader, nil
+	}
+
+	if seeker, ok := dataReader.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, dataReader, offset)
+	}
+	if err != nil && err != io.EOF {
+		store.CloseDataReader(dataReader)
+		return nil, &Error{fmt.Sprintf("Failed to position the data reader at offset %d. Error: %s.", offset, err)}
+	}
+	reader.reader = bufio.NewReader(dataReader)
+	return reader, nil
+}
+
+func (reader *objectDataReader) NextChunk(maxSize int) ([]byte, bool, int, common.SyncServiceError) {
+	if reader.reader == nil {
+		return make([]byte, 0), true, 0, nil
+	}
+	data := make([]byte, maxSize)
+	length, err := io.ReadFull(reader.reader, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, 0, &Error{fmt.Sprintf("Failed to read the data. Error: %s.", err)}
+	}
+	reader.offset += int64(length)
+
+	eof := err != nil
+	if !eof {
+		if _, err := reader.reader.Peek(1); err == io.EOF {
+			eof = true
+		}
+	}
+	return data[:length], eof, length, nil
+}
+
+func (reader *objectDataReader) Offset() int64 {
+	return reader.offset
+}
+
+func (reader *objectDataReader) Close() common.SyncServiceError {
+	if reader.dataReader == nil {
+		return nil
+	}
+	return reader.store.CloseDataReader(reader.dataReader)
+}
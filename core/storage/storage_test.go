@@ -2,8 +2,11 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -776,6 +779,106 @@ func testStorageObjectActivation(storageType string, t *testing.T) {
 	}
 }
 
+func testStorageExpiredObjects(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	notExpired := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		metaData common.MetaData
+		status   string
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "expiration", DestOrgID: "myorg", DestID: "dev1", DestType: "device"},
+			common.ReadyToSend},
+		{common.MetaData{ObjectID: "2", ObjectType: "expiration", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+			Expiration: expired}, common.ReadyToSend},
+		{common.MetaData{ObjectID: "3", ObjectType: "expiration", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+			Expiration: notExpired}, common.ReadyToSend},
+		{common.MetaData{ObjectID: "4", ObjectType: "expiration", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+			Expiration: expired}, common.PartiallyReceived},
+	}
+
+	for _, test := range tests {
+		if _, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+	}
+
+	expiredObjects, err := store.GetExpiredObjects()
+	if err != nil {
+		t.Errorf("GetExpiredObjects failed. Error: %s\n", err.Error())
+	} else if len(expiredObjects) != 1 {
+		t.Errorf("GetExpiredObjects returned incorrect number of objects: %d instead of 1.\n", len(expiredObjects))
+	} else if expiredObjects[0].ObjectID != "2" {
+		t.Errorf("GetExpiredObjects returned incorrect objects: id=%s instead of 2.\n", expiredObjects[0].ObjectID)
+	}
+
+	for _, test := range tests {
+		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+	}
+}
+
+func testStorageObjectDataReader(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "reader", ObjectType: "type1", DestOrgID: "org555", DestID: "dev1", DestType: "device",
+		ObjectSize: 10}
+	if _, err := store.StoreObject(metaData, []byte("0123456789"), common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+
+	tests := []struct {
+		offset int64
+		chunks []string
+	}{
+		{0, []string{"0123", "4567", "89"}},
+		{3, []string{"3456", "789"}},
+		{6, []string{"6789"}},
+	}
+
+	for _, test := range tests {
+		reader, err := store.OpenObjectDataReader(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, test.offset)
+		if err != nil {
+			t.Errorf("OpenObjectDataReader failed (offset = %d). Error: %s\n", test.offset, err.Error())
+			continue
+		}
+		for i, expected := range test.chunks {
+			data, eof, length, err := reader.NextChunk(4)
+			if err != nil {
+				t.Errorf("NextChunk failed (offset = %d). Error: %s\n", test.offset, err.Error())
+				break
+			}
+			if string(data[:length]) != expected {
+				t.Errorf("NextChunk returned %s instead of %s (offset = %d)\n", string(data[:length]), expected, test.offset)
+			}
+			if eof != (i == len(test.chunks)-1) {
+				t.Errorf("NextChunk returned eof=%t for chunk %d (offset = %d)\n", eof, i, test.offset)
+			}
+		}
+		if reader.Offset() != metaData.ObjectSize {
+			t.Errorf("Wrong reader offset %d instead of %d (offset = %d)\n", reader.Offset(), metaData.ObjectSize, test.offset)
+		}
+		if err := reader.Close(); err != nil {
+			t.Errorf("Failed to close the reader (offset = %d). Error: %s\n", test.offset, err.Error())
+		}
+	}
+}
+
 func testStorageObjectData(storageType string, t *testing.T) {
 	store, err := setUpStorage(storageType)
 	if err != nil {
@@ -1061,6 +1164,37 @@ func testStorageNotifications(storageType string, t *testing.T) {
 		t.Errorf("RetrieveNotifications returned wrong number of notifications: %d instead of 2\n", len(notifications))
 	}
 
+	if count, err := store.GetNumberOfNotificationRecords(tests[0].n.DestOrgID, tests[0].n.DestType, tests[0].n.DestID); err != nil {
+		t.Errorf("GetNumberOfNotificationRecords failed. Error: %s\n", err.Error())
+	} else if count != 5 {
+		t.Errorf("GetNumberOfNotificationRecords returned wrong number of notification records: %d instead of 5\n", count)
+	}
+
+	iterated := make(map[string]bool)
+	if err := store.IterateNotificationRecords(func(notification common.Notification) error {
+		if notification.DestOrgID == tests[0].n.DestOrgID {
+			id := common.GetNotificationID(notification)
+			if iterated[id] {
+				t.Errorf("IterateNotificationRecords reported notification %s twice\n", id)
+			}
+			iterated[id] = true
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("IterateNotificationRecords failed. Error: %s\n", err.Error())
+	} else if len(iterated) != len(tests) {
+		t.Errorf("IterateNotificationRecords reported %d notifications instead of %d\n", len(iterated), len(tests))
+	}
+
+	calls := 0
+	stopErr := errors.New("stop")
+	if err := store.IterateNotificationRecords(func(notification common.Notification) error {
+		calls++
+		return stopErr
+	}); err != stopErr || calls != 1 {
+		t.Errorf("IterateNotificationRecords didn't stop at the error of the function: %v after %d calls\n", err, calls)
+	}
+
 	if notifications, err := store.RetrievePendingNotifications(tests[5].n.DestOrgID, tests[5].n.DestType,
 		tests[5].n.DestID); err != nil {
 		t.Errorf("RetrievePendingNotifications failed. Error: %s\n", err.Error())
@@ -1078,6 +1212,24 @@ func testStorageNotifications(storageType string, t *testing.T) {
 		t.Errorf("RetrievePendingNotifications returned wrong number of notifications: %d instead of 0\n", len(notifications))
 	}
 
+	if objects, err := store.RetrievePendingObjects(tests[0].n.DestOrgID, tests[0].n.DestType, tests[0].n.DestID); err != nil {
+		t.Errorf("RetrievePendingObjects failed. Error: %s\n", err.Error())
+	} else if storageType == common.InMemory || (storageType == common.Bolt && common.Configuration.NodeType == common.ESS) {
+		if len(objects) != 0 {
+			t.Errorf("RetrievePendingObjects returned wrong number of objects: %d instead of 0\n", len(objects))
+		}
+	} else {
+		expected := map[string]string{"1": common.Delivering, "3": common.Delivering, "5": common.Pending}
+		if len(objects) != len(expected) {
+			t.Errorf("RetrievePendingObjects returned wrong number of objects: %d instead of %d\n", len(objects), len(expected))
+		}
+		for _, object := range objects {
+			if status, ok := expected[object.ObjectID]; !ok || status != object.Status {
+				t.Errorf("RetrievePendingObjects returned object %s with status %s\n", object.ObjectID, object.Status)
+			}
+		}
+	}
+
 	if err := store.DeleteNotificationRecords(tests[0].n.DestOrgID, tests[0].n.ObjectType, tests[0].n.ObjectID, "", ""); err != nil {
 		t.Errorf("DeleteNotificationRecords failed. Error: %s\n", err.Error())
 	} else {
@@ -1192,6 +1344,66 @@ func testStorageWebhooks(storageType string, t *testing.T) {
 	}
 }
 
+func testStorageWebhookDeliveries(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg"}
+	tests := []common.WebhookDelivery{
+		{URL: "http://abc/xyz", MetaData: metaData, Attempts: 1, NextAttempt: time.Now()},
+		{URL: "http://abc/xyz/111", MetaData: metaData, Attempts: 2, NextAttempt: time.Now()},
+		{URL: "http://abc/xyz/222", MetaData: metaData, Attempts: 5, DeadLetter: true},
+	}
+
+	for _, test := range tests {
+		if err := store.StoreWebhookDelivery(test); err != nil {
+			t.Errorf("StoreWebhookDelivery failed. Error: %s\n", err.Error())
+		}
+	}
+
+	// Storing a delivery again updates it
+	tests[0].Attempts = 3
+	if err := store.StoreWebhookDelivery(tests[0]); err != nil {
+		t.Errorf("StoreWebhookDelivery failed. Error: %s\n", err.Error())
+	}
+
+	if deliveries, err := store.RetrieveWebhookDeliveries(false); err != nil {
+		t.Errorf("RetrieveWebhookDeliveries failed. Error: %s\n", err.Error())
+	} else if len(deliveries) != 2 {
+		t.Errorf("RetrieveWebhookDeliveries returned %d deliveries instead of 2\n", len(deliveries))
+	} else {
+		for _, delivery := range deliveries {
+			if delivery.URL == tests[0].URL && delivery.Attempts != 3 {
+				t.Errorf("RetrieveWebhookDeliveries returned %d attempts instead of 3\n", delivery.Attempts)
+			}
+			if delivery.MetaData.ObjectID != metaData.ObjectID {
+				t.Errorf("RetrieveWebhookDeliveries returned incorrect meta data\n")
+			}
+		}
+	}
+
+	if deliveries, err := store.RetrieveWebhookDeliveries(true); err != nil {
+		t.Errorf("RetrieveWebhookDeliveries failed. Error: %s\n", err.Error())
+	} else if len(deliveries) != 1 || deliveries[0].URL != tests[2].URL {
+		t.Errorf("RetrieveWebhookDeliveries returned incorrect dead-lettered deliveries\n")
+	}
+
+	for _, test := range tests {
+		if err := store.DeleteWebhookDelivery(test); err != nil {
+			t.Errorf("DeleteWebhookDelivery failed. Error: %s\n", err.Error())
+		}
+	}
+	if deliveries, err := store.RetrieveWebhookDeliveries(false); err != nil {
+		t.Errorf("RetrieveWebhookDeliveries failed. Error: %s\n", err.Error())
+	} else if len(deliveries) != 0 {
+		t.Errorf("RetrieveWebhookDeliveries returned %d deliveries after they were deleted\n", len(deliveries))
+	}
+}
+
 func testStorageObjectExpiration(storageType string, t *testing.T) {
 	common.Configuration.NodeType = common.CSS
 	store, err := setUpStorage(storageType)
@@ -1583,7 +1795,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 			if len(deletedDests) != test.numberOfDeletedDests {
 				t.Errorf("StoreObject returned wrong number of deleted destinations: %d instead of %d (objectID = %s).\n",
 					len(deletedDests), test.numberOfDeletedDests, test.metaData.ObjectID)
-			} else if len(deletedDests) == 1 && deletedDests[0].Destination != *test.deletedDest {
+			} else if len(deletedDests) == 1 && !reflect.DeepEqual(deletedDests[0].Destination, *test.deletedDest) {
 				t.Errorf("StoreObject returned wrong deleted destination (objectID = %s).\n", test.metaData.ObjectID)
 			}
 		}
@@ -1595,7 +1807,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				if len(dests) != 1 {
 					t.Errorf("GetObjectDestinations returned wrong number of destinations: %d instead of 1 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
-				} else if dests[0] != dest1 {
+				} else if !reflect.DeepEqual(dests[0], dest1) {
 					t.Errorf("GetObjectDestinations returned wrong destination (objectID = %s).\n",
 						test.metaData.ObjectID)
 				}
@@ -1604,7 +1816,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 					t.Errorf("GetObjectDestinations returned wrong number of destinations: %d instead of 2 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
 				} else {
-					if (dests[0] != dest2 && dests[0] != dest1) || (dests[1] != dest1 && dests[1] != dest2) {
+					if (!reflect.DeepEqual(dests[0], dest2) && !reflect.DeepEqual(dests[0], dest1)) || (!reflect.DeepEqual(dests[1], dest1) && !reflect.DeepEqual(dests[1], dest2)) {
 						t.Errorf("GetObjectDestinations returned wrong destination (objectID = %s).\n",
 							test.metaData.ObjectID)
 					}
@@ -1620,7 +1832,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				if len(dests) != 1 {
 					t.Errorf("GetObjectDestinationsList returned wrong number of destinations: %d instead of 1 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
-				} else if dests[0].Destination != dest1 {
+				} else if !reflect.DeepEqual(dests[0].Destination, dest1) {
 					t.Errorf("GetObjectDestinations returned wrong destination (objectID = %s).\n",
 						test.metaData.ObjectID)
 				} else if dests[0].Status != common.Pending {
@@ -1635,7 +1847,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 					t.Errorf("GetObjectDestinationsList returned wrong number of destinations: %d instead of 2 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
 				} else {
-					if (dests[0].Destination != dest2 && dests[0].Destination != dest1) || (dests[1].Destination != dest1 && dests[1].Destination != dest2) {
+					if (!reflect.DeepEqual(dests[0].Destination, dest2) && !reflect.DeepEqual(dests[0].Destination, dest1)) || (!reflect.DeepEqual(dests[1].Destination, dest1) && !reflect.DeepEqual(dests[1].Destination, dest2)) {
 						t.Errorf("GetObjectDestinationsList returned wrong destination (objectID = %s).\n",
 							test.metaData.ObjectID)
 					} else {
@@ -1688,7 +1900,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				t.Errorf("GetObjectDestinationsList returned no destinations (objectID = %s).\n", test.metaData.ObjectID)
 			}
 			for _, d := range dests {
-				if d.Status != common.Delivered && d.Destination != dest2 {
+				if d.Status != common.Delivered && !reflect.DeepEqual(d.Destination, dest2) {
 					t.Errorf("GetObjectDestinations returned wrong status: %s instead of Delivered (objectID = %s).\n", d.Status,
 						test.metaData.ObjectID)
 				}
@@ -1706,7 +1918,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				t.Errorf("GetObjectDestinationsList returned no destinations (objectID = %s).\n", test.metaData.ObjectID)
 			}
 			for _, d := range dests {
-				if (d.Status != common.Error || d.Message != "Error") && d.Destination != dest2 {
+				if (d.Status != common.Error || d.Message != "Error") && !reflect.DeepEqual(d.Destination, dest2) {
 					t.Errorf("GetObjectDestinations returned wrong status or message: (%s, %s) instead of (error, Error) (objectID = %s).\n", d.Status,
 						d.Message, test.metaData.ObjectID)
 				}
@@ -1715,6 +1927,95 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 	}
 }
 
+func testStorageDestinationGroups(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	dest1 := common.Destination{DestOrgID: "grouporg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	dest2 := common.Destination{DestOrgID: "grouporg", DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol}
+	dest3 := common.Destination{DestOrgID: "grouporg", DestType: "device", DestID: "dev3", Communication: common.MQTTProtocol}
+	for _, dest := range []common.Destination{dest1, dest2, dest3} {
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+	}
+
+	if err := store.AddDestinationToGroup("grouporg", "group1", "device", "dev1"); err != nil {
+		t.Errorf("AddDestinationToGroup failed. Error: %s\n", err.Error())
+	}
+	if err := store.AddDestinationToGroup("grouporg", "group1", "device", "dev2"); err != nil {
+		t.Errorf("AddDestinationToGroup failed. Error: %s\n", err.Error())
+	}
+	if err := store.AddDestinationToGroup("grouporg", "group2", "device", "dev2"); err != nil {
+		t.Errorf("AddDestinationToGroup failed. Error: %s\n", err.Error())
+	}
+
+	if members, err := store.RetrieveGroupMembers("grouporg", "group1"); err != nil {
+		t.Errorf("RetrieveGroupMembers failed. Error: %s\n", err.Error())
+	} else if len(members) != 2 {
+		t.Errorf("RetrieveGroupMembers returned %d members instead of 2\n", len(members))
+	}
+	if groups, err := store.RetrieveDestinationGroups("grouporg", "device", "dev2"); err != nil {
+		t.Errorf("RetrieveDestinationGroups failed. Error: %s\n", err.Error())
+	} else if len(groups) != 2 {
+		t.Errorf("RetrieveDestinationGroups returned %d groups instead of 2\n", len(groups))
+	}
+
+	// The object is sent to the members of the group
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "grouporg", DestGroup: "group1", NoData: true}
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	if dests, err := store.GetObjectDestinations(metaData); err != nil {
+		t.Errorf("GetObjectDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 2 {
+		t.Errorf("GetObjectDestinations returned %d destinations instead of 2\n", len(dests))
+	}
+
+	// Objects of the group are retrieved only for members of the group
+	if objects, err := store.RetrieveObjects("grouporg", "device", "dev3", common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(objects) != 0 {
+		t.Errorf("RetrieveObjects returned an object of a group the destination isn't a member of\n")
+	}
+	if err := store.AddDestinationToGroup("grouporg", "group1", "device", "dev3"); err != nil {
+		t.Errorf("AddDestinationToGroup failed. Error: %s\n", err.Error())
+	}
+	if objects, err := store.RetrieveObjects("grouporg", "device", "dev3", common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(objects) != 1 {
+		t.Errorf("RetrieveObjects returned %d objects instead of 1\n", len(objects))
+	}
+	if dests, err := store.GetObjectDestinations(metaData); err != nil {
+		t.Errorf("GetObjectDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 3 {
+		t.Errorf("GetObjectDestinations returned %d destinations instead of 3\n", len(dests))
+	}
+
+	if err := store.RemoveDestinationFromGroup("grouporg", "group1", "device", "dev1"); err != nil {
+		t.Errorf("RemoveDestinationFromGroup failed. Error: %s\n", err.Error())
+	}
+	if groups, err := store.RetrieveDestinationGroups("grouporg", "device", "dev1"); err != nil {
+		t.Errorf("RetrieveDestinationGroups failed. Error: %s\n", err.Error())
+	} else if len(groups) != 0 {
+		t.Errorf("RetrieveDestinationGroups returned %d groups instead of 0\n", len(groups))
+	}
+
+	if err := store.DeleteOrganization("grouporg"); err != nil {
+		t.Errorf("DeleteOrganization failed. Error: %s\n", err.Error())
+	}
+	if groups, err := store.RetrieveDestinationGroups("grouporg", "device", "dev2"); err != nil {
+		t.Errorf("RetrieveDestinationGroups failed. Error: %s\n", err.Error())
+	} else if len(groups) != 0 {
+		t.Errorf("RetrieveDestinationGroups returned groups of a deleted organization\n")
+	}
+}
+
 func testStorageOrganizations(storageType string, t *testing.T) {
 	common.Configuration.NodeType = common.CSS
 	store, err := setUpStorage(storageType)
@@ -1857,6 +2158,104 @@ func testStorageInactiveDestinations(storageType string, t *testing.T) {
 
 }
 
+func testStorageDataKeys(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+	defer RegisterDataCodec(nil)
+
+	keys := map[string][]byte{"1": []byte("0123456789abcdef"), "2": []byte("fedcba9876543210fedcba9876543210")}
+	plain := bytes.Repeat([]byte("edge sync service data "), 20)
+	metaData := func(objectID string) common.MetaData {
+		return common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: "keysorg", ObjectSize: int64(len(plain))}
+	}
+	storeObject := func(objectID string) {
+		if _, err := store.StoreObject(metaData(objectID), plain, common.CompletelyReceived); err != nil {
+			t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+		}
+	}
+	checkObject := func(objectID string, expectedKeyID string) *ObjectDataCodec {
+		dataCodec, err := store.RetrieveObjectDataCodec("keysorg", "type1", objectID)
+		if err != nil || dataCodec == nil {
+			t.Errorf("RetrieveObjectDataCodec failed for object %s. Error: %v\n", objectID, err)
+			return nil
+		} else if dataCodec.KeyID != expectedKeyID {
+			t.Errorf("The data of object %s is encrypted with key %s instead of %s\n", objectID, dataCodec.KeyID, expectedKeyID)
+		}
+		dataReader, err := store.RetrieveObjectData("keysorg", "type1", objectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("RetrieveObjectData failed for object %s. Error: %v\n", objectID, err)
+			return dataCodec
+		}
+		data, _ := ioutil.ReadAll(dataCodec.NewDecodingReader(dataReader, 0))
+		store.CloseDataReader(dataReader)
+		if !bytes.Equal(data, plain) {
+			t.Errorf("Wrong data decoded for object %s\n", objectID)
+		}
+		return dataCodec
+	}
+
+	keyring, err := NewDataKeyring(map[string][]byte{"1": keys["1"]}, "1")
+	if err != nil {
+		t.Fatalf("NewDataKeyring failed. Error: %s", err.Error())
+	}
+	RegisterDataCodec(keyring)
+	storeObject("old")
+	oldCodec := checkObject("old", "1")
+
+	// Rotate the key: new copies of the data use the new key, existing data keeps its key
+	if _, err := NewDataKeyring(keys, "3"); err == nil {
+		t.Errorf("NewDataKeyring didn't fail for a current key that isn't in the keyring\n")
+	}
+	keyring, err = NewDataKeyring(keys, "2")
+	if err != nil {
+		t.Fatalf("NewDataKeyring failed. Error: %s", err.Error())
+	}
+	RegisterDataCodec(keyring)
+	storeObject("new")
+	checkObject("new", "2")
+	updatedMetaData := metaData("old")
+	updatedMetaData.MetaOnly = true
+	if _, err := store.StoreObject(updatedMetaData, nil, common.CompletelyReceived); err != nil {
+		t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+	}
+	checkObject("old", "1")
+
+	objects, err := store.RetrieveObjectsWithOtherDataKey("2")
+	if err != nil {
+		t.Errorf("RetrieveObjectsWithOtherDataKey failed. Error: %s\n", err.Error())
+	} else if len(objects) != 1 || objects[0].ObjectID != "old" {
+		t.Errorf("RetrieveObjectsWithOtherDataKey returned %d objects instead of the old object\n", len(objects))
+	}
+
+	// Re-encrypt the old object into a new copy of its data
+	dataReader, err := store.RetrieveObjectData("keysorg", "type1", "old")
+	if err != nil || dataReader == nil {
+		t.Errorf("RetrieveObjectData failed. Error: %v\n", err)
+		return
+	}
+	dataCodec, _ := NewObjectDataCodec()
+	err = store.StoreReencryptedObjectData("keysorg", "type1", "old", dataCodec,
+		dataCodec.NewEncodingReader(oldCodec.NewDecodingReader(dataReader, 0), 0))
+	store.CloseDataReader(dataReader)
+	if err != nil {
+		t.Errorf("StoreReencryptedObjectData failed. Error: %s\n", err.Error())
+	}
+	if newCodec := checkObject("old", "2"); newCodec != nil && bytes.Equal(newCodec.Nonce, oldCodec.Nonce) {
+		t.Errorf("The re-encrypted data reused the nonce of the previous copy\n")
+	}
+	if objects, err := store.RetrieveObjectsWithOtherDataKey("2"); err != nil || len(objects) != 0 {
+		t.Errorf("RetrieveObjectsWithOtherDataKey returned %d objects after the re-encryption\n", len(objects))
+	}
+
+	if dataCodec, err := store.RetrieveObjectDataCodec("keysorg", "type1", "missing"); err != nil || dataCodec != nil {
+		t.Errorf("RetrieveObjectDataCodec returned a codec for a missing object\n")
+	}
+}
+
 func setUpStorage(storageType string) (Storage, error) {
 	var store Storage
 	switch storageType {